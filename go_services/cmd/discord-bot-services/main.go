@@ -0,0 +1,127 @@
+// Command discord-bot-services is the single binary for both Go services.
+// Shipping one binary instead of two halves the image layers and the build
+// matrix, and gives deployments an "all" mode that runs both services in one
+// process with one coordinated shutdown — when either service stops (signal,
+// bind failure, forced close), the other is drained too, so a half-dead
+// process can't keep answering health checks.
+//
+// Subcommands:
+//
+//	discord-bot-services health-api  [flags]   # the health/metrics API (:8082)
+//	discord-bot-services url-fetcher [flags]   # the URL fetcher (:8081)
+//	discord-bot-services all                   # both, one process
+//
+// Each subcommand's -h lists its flags and its environment-variable contract.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	healthapi "github.com/voraehita25-star/discord-bot/go_services/health_api"
+	urlfetcher "github.com/voraehita25-star/discord-bot/go_services/url_fetcher"
+)
+
+func printUsage(w *os.File) {
+	fmt.Fprint(w, `Usage: discord-bot-services <subcommand> [flags]
+
+Subcommands:
+  health-api   run the health/metrics API
+  url-fetcher  run the URL fetcher
+  all          run both services in one process with coordinated shutdown
+
+Run "discord-bot-services <subcommand> -h" for that service's flags and
+environment variables.
+`)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage(os.Stderr)
+		os.Exit(2)
+	}
+	var err error
+	switch sub, args := os.Args[1], os.Args[2:]; sub {
+	case "health-api":
+		err = healthapi.Run(args, nil)
+	case "url-fetcher":
+		err = urlfetcher.Run(args, nil)
+	case "all":
+		err = runAll(args, nil)
+	case "help", "-h", "--help":
+		printUsage(os.Stdout)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown subcommand %q\n\n", sub)
+		printUsage(os.Stderr)
+		os.Exit(2)
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return // -h already printed usage; not a failure
+	}
+	if err != nil {
+		// Covers bind/serve errors and server.ErrForcedClose alike: a
+		// cut-short drain is a deploy-visible failure, not a log line.
+		log.Printf("Error: %v", err)
+		os.Exit(1)
+	}
+}
+
+// runAll runs both services in this process and ties their lifetimes
+// together: a real shutdown signal — or either service returning for any
+// reason — sends SIGTERM down both services' injected signal channels, so
+// both drain and runAll returns only when both are done. signals is
+// injectable for the lifecycle test; nil subscribes to SIGINT/SIGTERM.
+func runAll(args []string, signals <-chan os.Signal) error {
+	if len(args) > 0 {
+		return fmt.Errorf("all takes no arguments (got %q); configuration is env-only", args[0])
+	}
+	if signals == nil {
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		signals = sigCh
+	}
+
+	// Buffered so the shutdown broadcast below never blocks even if a
+	// service has already returned and no longer reads its channel.
+	healthSig := make(chan os.Signal, 1)
+	fetchSig := make(chan os.Signal, 1)
+	stop := func() {
+		for _, ch := range []chan os.Signal{healthSig, fetchSig} {
+			select {
+			case ch <- syscall.SIGTERM:
+			default: // already signalled
+			}
+		}
+	}
+
+	type result struct {
+		name string
+		err  error
+	}
+	results := make(chan result, 2)
+	go func() { results <- result{"health-api", healthapi.Run(nil, healthSig)} }()
+	go func() { results <- result{"url-fetcher", urlfetcher.Run(nil, fetchSig)} }()
+
+	var firstErr error
+	for remaining := 2; remaining > 0; {
+		select {
+		case <-signals:
+			stop()
+		case res := <-results:
+			remaining--
+			if res.err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", res.name, res.err)
+			}
+			// One service down takes the other with it — a process serving
+			// half its surface would pass naive liveness checks forever.
+			stop()
+		}
+	}
+	return firstErr
+}
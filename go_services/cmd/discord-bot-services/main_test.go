@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// freePort binds :0, records the port, and releases it for the service to
+// claim — the usual pre-pick race is acceptable in a test process.
+func freePort(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+	return port
+}
+
+func awaitHealthy(t *testing.T, url string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s never became healthy (last: %v)", url, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestRunAllServesBothAndShutsDownTogether boots the "all" mode for real —
+// both services, both listeners — and confirms one SIGTERM drains both.
+// url_fetcher registers into prometheus.DefaultRegisterer, so the full
+// startup can run only once per test process; this is that one run.
+func TestRunAllServesBothAndShutsDownTogether(t *testing.T) {
+	healthPort := freePort(t)
+	fetchPort := freePort(t)
+	t.Setenv("GO_HEALTH_API_PORT", healthPort)
+	t.Setenv("URL_FETCHER_PORT", fetchPort)
+
+	sigCh := make(chan os.Signal, 1)
+	result := make(chan error, 1)
+	go func() { result <- runAll(nil, sigCh) }()
+
+	healthURL := "http://127.0.0.1:" + healthPort + "/health"
+	fetchURL := "http://127.0.0.1:" + fetchPort + "/health"
+	awaitHealthy(t, healthURL)
+	awaitHealthy(t, fetchURL)
+
+	sigCh <- syscall.SIGTERM
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("runAll = %v, want clean nil", err)
+		}
+	case <-time.After(15 * time.Second):
+		t.Fatal("runAll did not return after SIGTERM")
+	}
+
+	// Both listeners are actually gone.
+	for _, url := range []string{healthURL, fetchURL} {
+		if _, err := http.Get(url); err == nil {
+			t.Errorf("%s still serving after shutdown", url)
+		}
+	}
+}
+
+func TestRunAllRejectsArguments(t *testing.T) {
+	if err := runAll([]string{"--verbose"}, nil); err == nil {
+		t.Error("runAll accepted arguments; configuration is env-only")
+	}
+}
@@ -0,0 +1,165 @@
+package healthapi
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/voraehita25-star/discord-bot/go_services/healthkit"
+)
+
+func TestResolveAdminListenConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		host, port  string
+		allowRemote string
+		wantHost    string
+		wantPort    string
+		wantEnabled bool
+	}{
+		{name: "both unset keeps single listener"},
+		{name: "port alone enables split", port: "9090", wantHost: "127.0.0.1", wantPort: "9090", wantEnabled: true},
+		{name: "host alone enables with default port", host: "localhost", wantHost: "localhost", wantPort: defaultAdminPort, wantEnabled: true},
+		{name: "invalid port falls back to default", port: "not-a-port", wantHost: "127.0.0.1", wantPort: defaultAdminPort, wantEnabled: true},
+		{name: "out-of-range port falls back", port: "70000", wantHost: "127.0.0.1", wantPort: defaultAdminPort, wantEnabled: true},
+		{name: "non-loopback host forced back", host: "0.0.0.0", port: "9090", wantHost: "127.0.0.1", wantPort: "9090", wantEnabled: true},
+		{name: "non-loopback host with opt-in", host: "0.0.0.0", port: "9090", allowRemote: "1", wantHost: "0.0.0.0", wantPort: "9090", wantEnabled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ADMIN_HOST", tt.host)
+			t.Setenv("ADMIN_PORT", tt.port)
+			t.Setenv("HEALTH_API_ALLOW_REMOTE", tt.allowRemote)
+			host, port, enabled := resolveAdminListenConfig()
+			if enabled != tt.wantEnabled {
+				t.Fatalf("enabled = %v, want %v", enabled, tt.wantEnabled)
+			}
+			if host != tt.wantHost || port != tt.wantPort {
+				t.Errorf("resolved %s:%s, want %s:%s", host, port, tt.wantHost, tt.wantPort)
+			}
+		})
+	}
+}
+
+// startListener serves handler on an ephemeral loopback port, exactly the way
+// main() wires a split deployment, and returns the base URL.
+func startListener(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 5 * time.Second}
+	go func() { _ = server.Serve(ln) }()
+	t.Cleanup(func() { _ = server.Close() })
+	return "http://" + ln.Addr().String()
+}
+
+func TestSplitListeners_RouteAvailability(t *testing.T) {
+	hs := healthkit.New(healthkit.WithVersion("test"))
+	hs.SetServiceStatus("bot", true)
+
+	primary := startListener(t, hs.PublicRoutes())
+	admin := startListener(t, hs.Routes())
+
+	status := func(method, base, path string) int {
+		var resp *http.Response
+		var err error
+		switch method {
+		case http.MethodGet:
+			resp, err = http.Get(base + path)
+		case http.MethodPost:
+			resp, err = http.Post(base+path, "application/json", strings.NewReader("{}"))
+		}
+		if err != nil {
+			t.Fatalf("%s %s%s: %v", method, base, path, err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode
+	}
+
+	// Probes answer on BOTH listeners (the primary is what the pod network
+	// sees; the admin listener keeping them too costs nothing).
+	for _, base := range []string{primary, admin} {
+		for _, path := range []string{"/health", "/health/live", "/health/ready"} {
+			if code := status(http.MethodGet, base, path); code == http.StatusNotFound {
+				t.Errorf("GET %s%s = 404, want it served", base, path)
+			}
+		}
+	}
+
+	// The telemetry surface exists only on the admin listener.
+	adminOnly := []struct {
+		method, path string
+	}{
+		{http.MethodGet, "/metrics"},
+		{http.MethodGet, "/stats"},
+		{http.MethodPost, "/metrics/push"},
+		{http.MethodPost, "/metrics/batch"},
+		{http.MethodPost, "/health/service"},
+	}
+	for _, ep := range adminOnly {
+		if code := status(ep.method, primary, ep.path); code != http.StatusNotFound {
+			t.Errorf("%s primary%s = %d, want 404 (must not exist on the public listener)", ep.method, ep.path, code)
+		}
+		if code := status(ep.method, admin, ep.path); code == http.StatusNotFound {
+			t.Errorf("%s admin%s = 404, want it served", ep.method, ep.path)
+		}
+	}
+
+	// Spot-check real payloads, not just route presence.
+	resp, err := http.Get(primary + "/health/live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "OK" {
+		t.Errorf("primary /health/live = %d %q, want 200 OK", resp.StatusCode, body)
+	}
+	if code := status(http.MethodGet, admin, "/metrics"); code != http.StatusOK {
+		t.Errorf("admin /metrics = %d, want 200", code)
+	}
+}
+
+// TestSplitListeners_IndependentPorts pins that the two listeners really are
+// separate sockets: closing the admin one must not take the probes with it.
+func TestSplitListeners_IndependentPorts(t *testing.T) {
+	hs := healthkit.New(healthkit.WithVersion("test"))
+	primary := startListener(t, hs.PublicRoutes())
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	adminServer := &http.Server{Handler: hs.Routes(), ReadHeaderTimeout: 5 * time.Second}
+	go func() { _ = adminServer.Serve(ln) }()
+	adminBase := "http://" + ln.Addr().String()
+
+	resp, err := http.Get(adminBase + "/metrics")
+	if err != nil {
+		t.Fatalf("admin warmup: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if err := adminServer.Close(); err != nil {
+		t.Fatalf("closing admin server: %v", err)
+	}
+	if resp, err := http.Get(adminBase + "/metrics"); err == nil {
+		_ = resp.Body.Close()
+		t.Error("admin listener still answering after close")
+	}
+
+	if resp, err := http.Get(primary + "/health/live"); err != nil {
+		t.Fatalf("primary probe after admin close: %v", err)
+	} else {
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("primary /health/live = %d, want 200", resp.StatusCode)
+		}
+	}
+}
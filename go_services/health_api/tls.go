@@ -0,0 +1,159 @@
+package healthapi
+
+// Optional TLS (and mTLS) for the listener. The health API historically only
+// ever bound loopback, but a central Prometheus scraping it over the network
+// needs transport security. HEALTH_API_TLS_CERT / HEALTH_API_TLS_KEY switch
+// the server to ListenAndServeTLS; HEALTH_API_CLIENT_CA additionally verifies
+// client certificates and requires one on the write (POST) endpoints, while
+// GET probes stay reachable for scrapers and kubelets that don't carry a
+// cert. Certificates are served through a GetCertificate callback backed by a
+// reloader, so SIGHUP swaps a renewed cert in place without dropping the
+// listener or any open connection. Unlike the usual fail-safe env posture, a
+// HALF-configured TLS setup fails startup outright: silently serving
+// plaintext because the key path had a typo is exactly the exposure TLS was
+// meant to close.
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// certReloader owns the server certificate and hands it to the TLS stack per
+// handshake, so reload() can swap a renewed pair without touching the server.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// newCertReloader loads the pair once, failing fast on unreadable or
+// mismatched files.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reload re-reads the pair from disk. On failure the previous certificate
+// stays in service — a bad renewal must not take down a working listener.
+func (c *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS key pair (%s, %s): %w", c.certFile, c.keyFile, err)
+	}
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+	return nil
+}
+
+// getCertificate is the tls.Config.GetCertificate callback: the current
+// certificate, whatever reload() last installed.
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// watchSIGHUP reloads the certificate on each SIGHUP. Runs for the process
+// lifetime, like the shutdown signal goroutine in main.
+func (c *certReloader) watchSIGHUP() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	for range sigCh {
+		if err := c.reload(); err != nil {
+			log.Printf("WARNING: TLS certificate reload failed: %v — keeping the previous certificate", err)
+			continue
+		}
+		log.Printf("TLS certificate reloaded from %s", c.certFile)
+	}
+}
+
+// tlsSetup is the resolved TLS posture for the listener.
+type tlsSetup struct {
+	config   *tls.Config
+	reloader *certReloader
+	// requireClientCert gates the write endpoints on a verified client cert
+	// (set iff HEALTH_API_CLIENT_CA was given).
+	requireClientCert bool
+}
+
+// tlsFromEnv reads HEALTH_API_TLS_CERT / HEALTH_API_TLS_KEY /
+// HEALTH_API_CLIENT_CA. nil with no error means TLS is simply off (the
+// historical plaintext-on-loopback default); any half-configuration is a
+// startup error.
+func tlsFromEnv() (*tlsSetup, error) {
+	certFile := strings.TrimSpace(os.Getenv("HEALTH_API_TLS_CERT"))
+	keyFile := strings.TrimSpace(os.Getenv("HEALTH_API_TLS_KEY"))
+	caFile := strings.TrimSpace(os.Getenv("HEALTH_API_CLIENT_CA"))
+
+	if certFile == "" && keyFile == "" {
+		if caFile != "" {
+			return nil, fmt.Errorf("HEALTH_API_CLIENT_CA is set but HEALTH_API_TLS_CERT/HEALTH_API_TLS_KEY are not — mTLS requires the server certificate")
+		}
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("HEALTH_API_TLS_CERT and HEALTH_API_TLS_KEY must both be set (got cert=%q key=%q)", certFile, keyFile)
+	}
+
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	setup := &tlsSetup{
+		config: &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: reloader.getCertificate,
+		},
+		reloader: reloader,
+	}
+
+	if caFile != "" {
+		pemBytes, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading HEALTH_API_CLIENT_CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pemBytes) {
+			return nil, fmt.Errorf("HEALTH_API_CLIENT_CA %s contains no usable certificates", caFile)
+		}
+		setup.config.ClientCAs = pool
+		// Verify-if-given at the handshake, require-per-route in HTTP:
+		// RequireAndVerifyClientCert would lock certless scrapers out of the
+		// GET probes, which must stay anonymous.
+		setup.config.ClientAuth = tls.VerifyClientCertIfGiven
+		setup.requireClientCert = true
+	}
+	return setup, nil
+}
+
+// requireClientCertForWrites rejects non-read requests that did not present a
+// CA-verified client certificate. Reads pass through untouched so probes and
+// scrapers work without one; the bearer-token layer inside healthkit still
+// applies to everything.
+func requireClientCertForWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			http.Error(w, "client certificate required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,286 @@
+package healthapi
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCert is one generated certificate with its PEM renderings, enough to
+// write env-pointed files, build client tls.Configs, and sign children.
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// generateCert builds a short-lived ECDSA certificate. parent == nil makes it
+// self-signed (used for both the server cert and the client CA).
+func generateCert(t *testing.T, cn string, isCA bool, extUsage []x509.ExtKeyUsage, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatalf("generating serial: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           extUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if isCA {
+		template.KeyUsage |= x509.KeyUsageCertSign
+	}
+	signerCert, signerKey := template, key
+	if parent != nil {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parsing certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshaling key: %v", err)
+	}
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// writeCertFiles writes a cert's PEM pair into dir and returns the paths.
+func writeCertFiles(t *testing.T, dir, name string, c *testCert) (certFile, keyFile string) {
+	t.Helper()
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, c.certPEM, 0o600); err != nil {
+		t.Fatalf("writing cert: %v", err)
+	}
+	if err := os.WriteFile(keyFile, c.keyPEM, 0o600); err != nil {
+		t.Fatalf("writing key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestTLSFromEnv_Validation(t *testing.T) {
+	dir := t.TempDir()
+	server := generateCert(t, "health-api", false, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, nil)
+	certFile, keyFile := writeCertFiles(t, dir, "server", server)
+	ca := generateCert(t, "client-ca", true, nil, nil)
+	caFile := filepath.Join(dir, "ca.crt")
+	if err := os.WriteFile(caFile, ca.certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	badFile := filepath.Join(dir, "garbage.pem")
+	if err := os.WriteFile(badFile, []byte("not pem at all"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		cert, key, ca string
+		wantErr       bool
+		wantNil       bool
+		wantMTLS      bool
+	}{
+		{name: "all unset", wantNil: true},
+		{name: "cert without key", cert: certFile, wantErr: true},
+		{name: "key without cert", key: keyFile, wantErr: true},
+		{name: "ca without cert pair", ca: caFile, wantErr: true},
+		{name: "missing cert file", cert: filepath.Join(dir, "nope.crt"), key: keyFile, wantErr: true},
+		{name: "garbage key file", cert: certFile, key: badFile, wantErr: true},
+		{name: "valid pair", cert: certFile, key: keyFile},
+		{name: "valid pair with ca", cert: certFile, key: keyFile, ca: caFile, wantMTLS: true},
+		{name: "garbage ca", cert: certFile, key: keyFile, ca: badFile, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HEALTH_API_TLS_CERT", tt.cert)
+			t.Setenv("HEALTH_API_TLS_KEY", tt.key)
+			t.Setenv("HEALTH_API_CLIENT_CA", tt.ca)
+			setup, err := tlsFromEnv()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want a fail-fast error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("tlsFromEnv: %v", err)
+			}
+			if tt.wantNil {
+				if setup != nil {
+					t.Fatal("want TLS off (nil setup)")
+				}
+				return
+			}
+			if setup == nil || setup.config == nil {
+				t.Fatal("want a usable setup")
+			}
+			if setup.requireClientCert != tt.wantMTLS {
+				t.Errorf("requireClientCert = %v, want %v", setup.requireClientCert, tt.wantMTLS)
+			}
+			if tt.wantMTLS && setup.config.ClientAuth != tls.VerifyClientCertIfGiven {
+				t.Errorf("ClientAuth = %v, want VerifyClientCertIfGiven", setup.config.ClientAuth)
+			}
+		})
+	}
+}
+
+// startTLSServer serves the handler over the given setup on an ephemeral
+// loopback port and returns the base URL.
+func startTLSServer(t *testing.T, setup *tlsSetup, handler http.Handler) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	server := &http.Server{Handler: handler, TLSConfig: setup.config}
+	go func() { _ = server.ServeTLS(ln, "", "") }()
+	t.Cleanup(func() { _ = server.Close() })
+	return "https://" + ln.Addr().String()
+}
+
+func TestTLSServer_HappyPathAndMTLS(t *testing.T) {
+	dir := t.TempDir()
+	serverCert := generateCert(t, "health-api", false, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, nil)
+	certFile, keyFile := writeCertFiles(t, dir, "server", serverCert)
+	ca := generateCert(t, "client-ca", true, nil, nil)
+	caFile := filepath.Join(dir, "ca.crt")
+	if err := os.WriteFile(caFile, ca.certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	clientCert := generateCert(t, "pusher", false, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, ca)
+
+	t.Setenv("HEALTH_API_TLS_CERT", certFile)
+	t.Setenv("HEALTH_API_TLS_KEY", keyFile)
+	t.Setenv("HEALTH_API_CLIENT_CA", caFile)
+	setup, err := tlsFromEnv()
+	if err != nil {
+		t.Fatalf("tlsFromEnv: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health/live", func(w http.ResponseWriter, r *http.Request) { _, _ = io.WriteString(w, "OK") })
+	mux.HandleFunc("/metrics/push", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	base := startTLSServer(t, setup, requireClientCertForWrites(mux))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCert.cert)
+	certlessClient := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: roots},
+	}}
+
+	// GET probe without a client cert: allowed.
+	resp, err := certlessClient.Get(base + "/health/live")
+	if err != nil {
+		t.Fatalf("TLS GET: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("certless GET = %d, want 200", resp.StatusCode)
+	}
+
+	// POST without a client cert: rejected by the write gate.
+	resp, err = certlessClient.Post(base+"/metrics/push", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("certless POST: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("certless POST = %d, want 403", resp.StatusCode)
+	}
+
+	// POST with a CA-signed client cert: accepted.
+	pair, err := tls.X509KeyPair(clientCert.certPEM, clientCert.keyPEM)
+	if err != nil {
+		t.Fatalf("client key pair: %v", err)
+	}
+	certedClient := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{pair}},
+	}}
+	resp, err = certedClient.Post(base+"/metrics/push", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("certed POST: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("certed POST = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestCertReloader_SwapAndFailureKeepsOld(t *testing.T) {
+	dir := t.TempDir()
+	first := generateCert(t, "gen-1", false, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, nil)
+	certFile, keyFile := writeCertFiles(t, dir, "server", first)
+
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader: %v", err)
+	}
+	serial := func() *big.Int {
+		served, err := reloader.getCertificate(nil)
+		if err != nil {
+			t.Fatalf("getCertificate: %v", err)
+		}
+		leaf, err := x509.ParseCertificate(served.Certificate[0])
+		if err != nil {
+			t.Fatalf("parsing served cert: %v", err)
+		}
+		return leaf.SerialNumber
+	}
+	if serial().Cmp(first.cert.SerialNumber) != 0 {
+		t.Fatal("initial load did not serve the first certificate")
+	}
+
+	// Overwrite in place (what a cert renewal does) and reload.
+	second := generateCert(t, "gen-2", false, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, nil)
+	writeCertFiles(t, dir, "server", second)
+	if err := reloader.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if serial().Cmp(second.cert.SerialNumber) != 0 {
+		t.Error("reload did not swap to the renewed certificate")
+	}
+
+	// A broken renewal must error AND keep serving the previous cert.
+	if err := os.WriteFile(keyFile, []byte("truncated garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloader.reload(); err == nil {
+		t.Error("reload of a garbage key reported success")
+	}
+	if serial().Cmp(second.cert.SerialNumber) != 0 {
+		t.Error("failed reload dropped the working certificate")
+	}
+}
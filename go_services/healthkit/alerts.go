@@ -0,0 +1,346 @@
+package healthkit
+
+// A minimal alert engine for the deployments that don't run Alertmanager.
+// ALERT_RULES_PATH points at a JSON file of rules over signals the service
+// already tracks internally — no new collection, just thresholds on what
+// /health and /stats expose anyway:
+//
+//	aggregate_degraded      1 when the aggregate status is not "healthy"
+//	memory_alloc_mb         cached MemStats alloc, MB
+//	memory_sys_mb           cached MemStats sys, MB
+//	goroutines              live goroutine count
+//	service_up:<name>       1/0 from the reported service map
+//	queue_depth:<queue>     last pushed depth (queue label allowlist)
+//	breaker_open:<service>  1 when that breaker is open (service allowlist)
+//
+// Each rule names a signal, an operator, a threshold, and a "for" duration;
+// the evaluator rides the collector tick and walks each rule through the
+// usual inactive → pending → firing lifecycle, POSTing firing/resolved
+// notifications to ALERT_WEBHOOK_URL. Rules referencing unknown signals fail
+// validation as a unit at load — a half-loaded rule file silently dropping
+// the misspelled rule is exactly the alert that never fires. Current state
+// is inspectable at GET /alerts.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Alert lifecycle states, Prometheus vocabulary.
+const (
+	alertStateInactive = "inactive"
+	alertStatePending  = "pending"
+	alertStateFiring   = "firing"
+)
+
+// alertWebhookTimeout bounds one notification POST so a dead webhook can
+// never stall the collector goroutine for long.
+const alertWebhookTimeout = 5 * time.Second
+
+// AlertRule is one entry of the ALERT_RULES_PATH file.
+type AlertRule struct {
+	Name       string  `json:"name"`
+	Signal     string  `json:"signal"`
+	Op         string  `json:"op"`
+	Threshold  float64 `json:"threshold"`
+	ForSeconds int     `json:"for_seconds"`
+}
+
+// alertRuleState is the evaluator's per-rule memory: the lifecycle state,
+// when it was entered, and the last observed signal value.
+type alertRuleState struct {
+	state string
+	since time.Time
+	value float64
+}
+
+// alertEngine holds the loaded rules and their states under its own mutex —
+// writes come from the evaluator, reads from GET /alerts.
+type alertEngine struct {
+	mu         sync.Mutex
+	rules      []AlertRule
+	states     map[string]*alertRuleState
+	webhookURL string
+	client     *http.Client
+}
+
+// alertNotification is the webhook POST body for both firing and resolved.
+type alertNotification struct {
+	Rule            string  `json:"rule"`
+	State           string  `json:"state"`
+	Signal          string  `json:"signal"`
+	Value           float64 `json:"value"`
+	Threshold       float64 `json:"threshold"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	At              string  `json:"at"`
+}
+
+// validateAlertRule returns "" or a human-readable problem. Parameterized
+// signals validate their parameter against the same allowlists the push
+// paths enforce, so a rule cannot reference a series that can never exist.
+func validateAlertRule(r AlertRule) string {
+	if r.Name == "" || len(r.Name) > 100 {
+		return "invalid rule name"
+	}
+	switch r.Op {
+	case ">", ">=", "<", "<=", "==", "!=":
+	default:
+		return fmt.Sprintf("unknown operator %q", r.Op)
+	}
+	if r.ForSeconds < 0 {
+		return "negative for_seconds"
+	}
+	switch r.Signal {
+	case "aggregate_degraded", "memory_alloc_mb", "memory_sys_mb", "goroutines":
+		return ""
+	}
+	if name, ok := strings.CutPrefix(r.Signal, "service_up:"); ok {
+		if len(name) == 0 || len(name) > 100 {
+			return "invalid service name in signal"
+		}
+		return ""
+	}
+	if queue, ok := strings.CutPrefix(r.Signal, "queue_depth:"); ok {
+		if !allowedLabelValues["queue"][queue] {
+			return fmt.Sprintf("unknown queue %q", queue)
+		}
+		return ""
+	}
+	if service, ok := strings.CutPrefix(r.Signal, "breaker_open:"); ok {
+		if !allowedLabelValues["service"][service] {
+			return fmt.Sprintf("unknown breaker service %q", service)
+		}
+		return ""
+	}
+	return fmt.Sprintf("unknown signal %q", r.Signal)
+}
+
+// loadAlertRules parses and validates a rule file. Any invalid rule fails
+// the whole file: partial loads are worse than no loads here, because the
+// dropped rule is precisely the one somebody expected to fire.
+func loadAlertRules(path string) ([]AlertRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []AlertRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse alert rules: %w", err)
+	}
+	seen := make(map[string]bool, len(rules))
+	for i, r := range rules {
+		if msg := validateAlertRule(r); msg != "" {
+			return nil, fmt.Errorf("alert rule %d (%q): %s", i, r.Name, msg)
+		}
+		if seen[r.Name] {
+			return nil, fmt.Errorf("alert rule %d: duplicate name %q", i, r.Name)
+		}
+		seen[r.Name] = true
+	}
+	return rules, nil
+}
+
+// alertSignalValue resolves one signal to its current value. The second
+// return is false when the signal cannot be evaluated yet (a service that
+// has never reported), which leaves the rule inactive rather than guessing.
+func (h *Service) alertSignalValue(signal string) (float64, bool) {
+	switch signal {
+	case "aggregate_degraded":
+		if h.AggregateStatus() != "healthy" {
+			return 1, true
+		}
+		return 0, true
+	case "memory_alloc_mb":
+		return float64(h.cachedMemAlloc.Load()) / 1024 / 1024, true
+	case "memory_sys_mb":
+		return float64(h.cachedMemSys.Load()) / 1024 / 1024, true
+	case "goroutines":
+		return float64(runtime.NumGoroutine()), true
+	}
+	if name, ok := strings.CutPrefix(signal, "service_up:"); ok {
+		healthy, seen := h.loadStatusSnapshot().services[name]
+		if !seen {
+			return 0, false
+		}
+		if healthy {
+			return 1, true
+		}
+		return 0, true
+	}
+	if queue, ok := strings.CutPrefix(signal, "queue_depth:"); ok {
+		return h.queues.depth(queue), true
+	}
+	if service, ok := strings.CutPrefix(signal, "breaker_open:"); ok {
+		for _, open := range h.breakers.open() {
+			if open == service {
+				return 1, true
+			}
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// alertCondition applies the rule operator.
+func alertCondition(value, threshold float64, op string) bool {
+	switch op {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case "==":
+		return value == threshold
+	case "!=":
+		return value != threshold
+	}
+	return false
+}
+
+// evaluateAlerts runs one evaluation pass. Rides the collector tick, so the
+// "for" duration resolves at collector-interval granularity — fine for a
+// threshold alert. Notifications are gathered under the lock and sent after
+// it, so a slow webhook never blocks GET /alerts.
+func (h *Service) evaluateAlerts(now time.Time) {
+	var pending []alertNotification
+	h.alerts.mu.Lock()
+	for _, rule := range h.alerts.rules {
+		value, ok := h.alertSignalValue(rule.Signal)
+		if !ok {
+			continue
+		}
+		st := h.alerts.states[rule.Name]
+		st.value = value
+		active := alertCondition(value, rule.Threshold, rule.Op)
+		switch {
+		case active && st.state == alertStateInactive:
+			st.state = alertStatePending
+			st.since = now
+			// A zero "for" fires on the same pass it goes pending.
+			fallthrough
+		case active && st.state == alertStatePending:
+			if now.Sub(st.since) >= time.Duration(rule.ForSeconds)*time.Second {
+				pending = append(pending, alertNotification{
+					Rule: rule.Name, State: alertStateFiring,
+					Signal: rule.Signal, Value: value, Threshold: rule.Threshold,
+					DurationSeconds: now.Sub(st.since).Seconds(),
+					At:              formatTimestamp(now),
+				})
+				st.state = alertStateFiring
+				st.since = now
+			}
+		case !active && st.state == alertStateFiring:
+			pending = append(pending, alertNotification{
+				Rule: rule.Name, State: "resolved",
+				Signal: rule.Signal, Value: value, Threshold: rule.Threshold,
+				DurationSeconds: now.Sub(st.since).Seconds(),
+				At:              formatTimestamp(now),
+			})
+			st.state = alertStateInactive
+			st.since = time.Time{}
+		case !active:
+			st.state = alertStateInactive
+			st.since = time.Time{}
+		}
+	}
+	url := h.alerts.webhookURL
+	client := h.alerts.client
+	h.alerts.mu.Unlock()
+
+	for _, n := range pending {
+		sendAlertWebhook(client, url, n)
+	}
+}
+
+// sendAlertWebhook delivers one notification; failures are logged, not
+// retried — the next state change will speak for itself.
+func sendAlertWebhook(client *http.Client, url string, n alertNotification) {
+	if url == "" {
+		return
+	}
+	body, err := json.Marshal(n)
+	if err != nil {
+		log.Printf("WARNING: failed to encode alert notification for %s: %v", n.Rule, err)
+		return
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body)) //nolint:noctx // bounded by the client timeout
+	if err != nil {
+		log.Printf("WARNING: alert webhook for %s (%s) failed: %v", n.Rule, n.State, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("WARNING: alert webhook for %s (%s) returned %d", n.Rule, n.State, resp.StatusCode)
+	}
+}
+
+// AlertStatus is one row of GET /alerts: the rule plus its live state.
+type AlertStatus struct {
+	Name       string  `json:"name"`
+	Signal     string  `json:"signal"`
+	Op         string  `json:"op"`
+	Threshold  float64 `json:"threshold"`
+	ForSeconds int     `json:"for_seconds"`
+	State      string  `json:"state"`
+	Value      float64 `json:"value"`
+	Since      string  `json:"since,omitempty"`
+}
+
+// handleAlerts serves GET /alerts in rule-file order.
+func (h *Service) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	h.alerts.mu.Lock()
+	rows := make([]AlertStatus, 0, len(h.alerts.rules))
+	for _, rule := range h.alerts.rules {
+		st := h.alerts.states[rule.Name]
+		row := AlertStatus{
+			Name: rule.Name, Signal: rule.Signal, Op: rule.Op,
+			Threshold: rule.Threshold, ForSeconds: rule.ForSeconds,
+			State: st.state, Value: st.value,
+		}
+		if !st.since.IsZero() {
+			row.Since = formatTimestamp(st.since)
+		}
+		rows = append(rows, row)
+	}
+	h.alerts.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{"alerts": rows}); err != nil {
+		log.Printf("Failed to encode alerts: %v", err)
+	}
+}
+
+// WithAlertRules points the engine at a rule file; loading happens in New.
+func WithAlertRules(path string) Option {
+	return func(h *Service) {
+		h.alertRulesPath = strings.TrimSpace(path)
+	}
+}
+
+// WithAlertWebhook sets the notification target; empty means evaluate (and
+// expose /alerts) without delivering anywhere.
+func WithAlertWebhook(url string) Option {
+	return func(h *Service) {
+		h.alerts.webhookURL = strings.TrimSpace(url)
+	}
+}
+
+// alertRulesFromEnv reads ALERT_RULES_PATH (unset means no alerting).
+func alertRulesFromEnv() string {
+	return strings.TrimSpace(os.Getenv("ALERT_RULES_PATH"))
+}
+
+// alertWebhookFromEnv reads ALERT_WEBHOOK_URL.
+func alertWebhookFromEnv() string {
+	return strings.TrimSpace(os.Getenv("ALERT_WEBHOOK_URL"))
+}
@@ -0,0 +1,217 @@
+package healthkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeAlertRules writes a rule file and returns its path.
+func writeAlertRules(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "alerts.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write alert rules: %v", err)
+	}
+	return path
+}
+
+// alertSink is an httptest webhook target recording every notification.
+type alertSink struct {
+	mu    sync.Mutex
+	got   []alertNotification
+	check *httptest.Server
+}
+
+func newAlertSink(t *testing.T) *alertSink {
+	t.Helper()
+	s := &alertSink{}
+	s.check = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n alertNotification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			t.Errorf("webhook body: %v", err)
+		}
+		s.mu.Lock()
+		s.got = append(s.got, n)
+		s.mu.Unlock()
+	}))
+	t.Cleanup(s.check.Close)
+	return s
+}
+
+func (s *alertSink) notifications() []alertNotification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]alertNotification(nil), s.got...)
+}
+
+func TestAlertRuleValidation(t *testing.T) {
+	tests := []struct {
+		name, rules string
+	}{
+		{"unknown signal", `[{"name":"r","signal":"cpu_temperature","op":">","threshold":1}]`},
+		{"unknown queue", `[{"name":"r","signal":"queue_depth:mystery","op":">","threshold":1}]`},
+		{"unknown breaker service", `[{"name":"r","signal":"breaker_open:mystery","op":"==","threshold":1}]`},
+		{"bad operator", `[{"name":"r","signal":"goroutines","op":"~=","threshold":1}]`},
+		{"empty name", `[{"name":"","signal":"goroutines","op":">","threshold":1}]`},
+		{"negative for", `[{"name":"r","signal":"goroutines","op":">","threshold":1,"for_seconds":-5}]`},
+		{"duplicate names", `[{"name":"r","signal":"goroutines","op":">","threshold":1},{"name":"r","signal":"goroutines","op":"<","threshold":1}]`},
+		{"not json", `goroutines > 9000`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadAlertRules(writeAlertRules(t, tt.rules)); err == nil {
+				t.Errorf("loadAlertRules accepted %s", tt.rules)
+			}
+		})
+	}
+
+	// One bad rule fails the whole file — no partial loads.
+	path := writeAlertRules(t,
+		`[{"name":"ok","signal":"goroutines","op":">","threshold":1},{"name":"bad","signal":"nope","op":">","threshold":1}]`)
+	if _, err := loadAlertRules(path); err == nil {
+		t.Error("file with one invalid rule loaded partially")
+	}
+	hs := New(WithVersion("test"), WithAlertRules(path))
+	if len(hs.alerts.rules) != 0 {
+		t.Errorf("invalid file left %d rules active, want alerting disabled", len(hs.alerts.rules))
+	}
+}
+
+func TestAlertPendingFiringResolved(t *testing.T) {
+	sink := newAlertSink(t)
+	rules := writeAlertRules(t,
+		`[{"name":"deep_ai_queue","signal":"queue_depth:ai_request","op":">","threshold":100,"for_seconds":30}]`)
+	clk := newFakeClock(time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk),
+		WithAlertRules(rules), WithAlertWebhook(sink.check.URL))
+	r := buildRouter(hs, "tok")
+
+	alertState := func(t *testing.T) AlertStatus {
+		t.Helper()
+		rec := doReq(t, r, http.MethodGet, "/alerts", "tok", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("alerts = %d, want 200", rec.Code)
+		}
+		var resp struct {
+			Alerts []AlertStatus `json:"alerts"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Alerts) != 1 {
+			t.Fatalf("alerts body %s: %v", rec.Body.String(), err)
+		}
+		return resp.Alerts[0]
+	}
+
+	if got := alertState(t); got.State != alertStateInactive {
+		t.Fatalf("initial state = %q, want inactive", got.State)
+	}
+
+	// Over threshold: pending, nothing delivered yet.
+	pushQueueDepth(t, r, "tok", "ai_request", 150)
+	hs.evaluateAlerts(clk.Now())
+	if got := alertState(t); got.State != alertStatePending || got.Value != 150 {
+		t.Fatalf("state = %q value %v, want pending 150", got.State, got.Value)
+	}
+	if n := sink.notifications(); len(n) != 0 {
+		t.Fatalf("notifications while pending = %v, want none", n)
+	}
+
+	// Still over once "for" elapses: firing, one webhook POST.
+	clk.Advance(30 * time.Second)
+	hs.evaluateAlerts(clk.Now())
+	if got := alertState(t); got.State != alertStateFiring {
+		t.Fatalf("state = %q, want firing", got.State)
+	}
+	n := sink.notifications()
+	if len(n) != 1 || n[0].State != alertStateFiring {
+		t.Fatalf("notifications = %+v, want one firing", n)
+	}
+	if n[0].Rule != "deep_ai_queue" || n[0].Value != 150 || n[0].DurationSeconds != 30 {
+		t.Errorf("firing payload = %+v, want deep_ai_queue/150/30s", n[0])
+	}
+
+	// Re-evaluation while firing stays quiet — no repeat notifications.
+	clk.Advance(10 * time.Second)
+	hs.evaluateAlerts(clk.Now())
+	if n := sink.notifications(); len(n) != 1 {
+		t.Fatalf("notifications after steady firing = %d, want still 1", len(n))
+	}
+
+	// Back under: resolved, with the firing duration.
+	pushQueueDepth(t, r, "tok", "ai_request", 5)
+	clk.Advance(10 * time.Second)
+	hs.evaluateAlerts(clk.Now())
+	if got := alertState(t); got.State != alertStateInactive {
+		t.Errorf("state after recovery = %q, want inactive", got.State)
+	}
+	n = sink.notifications()
+	if len(n) != 2 || n[1].State != "resolved" || n[1].DurationSeconds != 20 {
+		t.Errorf("notifications = %+v, want a resolved with 20s duration", n)
+	}
+}
+
+func TestAlertShortBlipNeverFires(t *testing.T) {
+	sink := newAlertSink(t)
+	rules := writeAlertRules(t,
+		`[{"name":"blip","signal":"queue_depth:ai_request","op":">","threshold":100,"for_seconds":60}]`)
+	clk := newFakeClock(time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk),
+		WithAlertRules(rules), WithAlertWebhook(sink.check.URL))
+	r := buildRouter(hs, "tok")
+
+	pushQueueDepth(t, r, "tok", "ai_request", 200)
+	hs.evaluateAlerts(clk.Now())
+	clk.Advance(30 * time.Second)
+	pushQueueDepth(t, r, "tok", "ai_request", 10) // drains within "for"
+	hs.evaluateAlerts(clk.Now())
+	clk.Advance(time.Hour)
+	hs.evaluateAlerts(clk.Now())
+	if n := sink.notifications(); len(n) != 0 {
+		t.Errorf("notifications = %+v, want none for a sub-threshold blip", n)
+	}
+}
+
+func TestAlertZeroForFiresImmediately(t *testing.T) {
+	sink := newAlertSink(t)
+	rules := writeAlertRules(t,
+		`[{"name":"gemini_down","signal":"service_up:gemini","op":"==","threshold":0}]`)
+	clk := newFakeClock(time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk),
+		WithAlertRules(rules), WithAlertWebhook(sink.check.URL))
+
+	// Never-reported service: not evaluable, stays inactive.
+	hs.evaluateAlerts(clk.Now())
+	if n := sink.notifications(); len(n) != 0 {
+		t.Fatalf("notifications before any report = %v, want none", n)
+	}
+
+	hs.SetServiceStatus("gemini", false)
+	hs.evaluateAlerts(clk.Now())
+	n := sink.notifications()
+	if len(n) != 1 || n[0].State != alertStateFiring {
+		t.Fatalf("notifications = %+v, want an immediate firing", n)
+	}
+
+	hs.SetServiceStatus("gemini", true)
+	hs.evaluateAlerts(clk.Now())
+	if n := sink.notifications(); len(n) != 2 || n[1].State != "resolved" {
+		t.Errorf("notifications = %+v, want a resolved", n)
+	}
+}
+
+func TestAlertsEndpointAuth(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+	if rec := doReq(t, r, http.MethodGet, "/alerts", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated = %d, want 401", rec.Code)
+	}
+	rec := doReq(t, r, http.MethodGet, "/alerts", "tok", "")
+	if rec.Code != http.StatusOK {
+		t.Errorf("alerts = %d, want 200", rec.Code)
+	}
+}
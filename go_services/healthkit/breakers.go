@@ -0,0 +1,183 @@
+package healthkit
+
+// Circuit-breaker state log. The Python side has pushed circuit_breaker
+// gauges for a long time, but a gauge only answers "what is the state NOW" —
+// during an outage the questions are "which breakers are open, since when,
+// and how often have they flapped". The push path therefore also maintains a
+// per-service record: current state, when it was entered, the previous
+// state, and a bounded history of transitions, queryable over
+// GET /circuit-breakers. Open breakers are listed in the /health response,
+// and with BREAKER_AFFECTS_HEALTH=true they degrade the aggregate status the
+// same way an unhealthy service or an overdue shard does — off by default
+// because a breaker opening against an optional dependency (Spotify, say)
+// should not flip readiness for the whole pod unless the operator opts in.
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBreakerTransitions bounds the per-breaker history; the total transition
+// counter keeps counting after old entries fall off.
+const maxBreakerTransitions = 20
+
+// breakerStateName maps the pushed tri-state enum to its JSON name.
+func breakerStateName(state int) string {
+	switch state {
+	case 0:
+		return "closed"
+	case 1:
+		return "half_open"
+	default:
+		return "open"
+	}
+}
+
+// BreakerTransition is one recorded state change.
+type BreakerTransition struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	At   string `json:"at"`
+}
+
+// BreakerInfo is one breaker's entry in the GET /circuit-breakers response.
+type BreakerInfo struct {
+	Service string `json:"service"`
+	State   string `json:"state"`
+	// Since is when the current state was entered (first observation time
+	// for a breaker that has never transitioned).
+	Since         string `json:"since"`
+	PreviousState string `json:"previous_state,omitempty"`
+	// Transitions is the lifetime count; History holds only the most recent
+	// maxBreakerTransitions of them.
+	Transitions uint64              `json:"transitions"`
+	History     []BreakerTransition `json:"history,omitempty"`
+}
+
+// breakerEntry is the internal per-service record.
+type breakerEntry struct {
+	state       int
+	since       time.Time
+	prev        int
+	hasPrev     bool
+	transitions uint64
+	history     []breakerTransition
+}
+
+type breakerTransition struct {
+	from, to int
+	at       time.Time
+}
+
+func (e *breakerEntry) render(service string) BreakerInfo {
+	info := BreakerInfo{
+		Service:     service,
+		State:       breakerStateName(e.state),
+		Since:       formatTimestamp(e.since),
+		Transitions: e.transitions,
+	}
+	if e.hasPrev {
+		info.PreviousState = breakerStateName(e.prev)
+	}
+	for _, tr := range e.history {
+		info.History = append(info.History, BreakerTransition{
+			From: breakerStateName(tr.from),
+			To:   breakerStateName(tr.to),
+			At:   formatTimestamp(tr.at),
+		})
+	}
+	return info
+}
+
+// breakerStore tracks breaker states under its own lock, so the push path
+// can update it while holding nothing else. Size is bounded by the service
+// label's allowlist (safeLabel collapses unknown services to "other").
+type breakerStore struct {
+	mu    sync.Mutex
+	items map[string]*breakerEntry
+}
+
+// record applies one observed state for service. Same-state pushes refresh
+// nothing — `since` keeps meaning "entered this state at".
+func (s *breakerStore) record(service string, state int, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.items[service]
+	if !ok {
+		s.items[service] = &breakerEntry{state: state, since: now}
+		return
+	}
+	if e.state == state {
+		return
+	}
+	e.history = append(e.history, breakerTransition{from: e.state, to: state, at: now})
+	if len(e.history) > maxBreakerTransitions {
+		e.history = e.history[len(e.history)-maxBreakerTransitions:]
+	}
+	e.transitions++
+	e.prev = e.state
+	e.hasPrev = true
+	e.state = state
+	e.since = now
+}
+
+// list renders every tracked breaker, sorted by service name.
+func (s *breakerStore) list() []BreakerInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]BreakerInfo, 0, len(s.items))
+	for service, e := range s.items {
+		out = append(out, e.render(service))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Service < out[j].Service })
+	return out
+}
+
+// open returns the services whose breaker is currently open, sorted.
+func (s *breakerStore) open() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for service, e := range s.items {
+		if e.state == 2 {
+			out = append(out, service)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// WithBreakerHealthImpact sets whether an open breaker degrades the
+// aggregate /health status.
+func WithBreakerHealthImpact(enabled bool) Option {
+	return func(h *Service) {
+		h.breakerAffectsHealth = enabled
+	}
+}
+
+// breakerAffectsHealthFromEnv reads BREAKER_AFFECTS_HEALTH. Exactly "true"
+// enables it — same strict parse as TRUST_PROXY, because accidentally
+// degrading readiness is worse than an ignored typo (which the warning
+// surfaces).
+func breakerAffectsHealthFromEnv() bool {
+	raw := strings.TrimSpace(os.Getenv("BREAKER_AFFECTS_HEALTH"))
+	if raw == "" || raw == "true" {
+		return raw == "true"
+	}
+	log.Printf("WARNING: invalid BREAKER_AFFECTS_HEALTH %q (only \"true\" enables it) — breakers will not affect health", raw)
+	return false
+}
+
+// handleBreakers serves GET /circuit-breakers: the current state, entry
+// time and bounded transition history per pushed breaker.
+func (h *Service) handleBreakers(w http.ResponseWriter, r *http.Request) {
+	entries := h.breakers.list()
+	p := parsePageParams(r.URL.Query())
+	start, end := paginate(len(entries), p)
+	writeListResponse(w, r.URL, len(entries), p, entries[start:end], h.listMaxBytes)
+}
@@ -0,0 +1,185 @@
+package healthkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pushBreaker posts one circuit_breaker gauge for service with the given
+// numeric state.
+func pushBreaker(t *testing.T, hs *Service, service string, state float64) {
+	t.Helper()
+	body := fmt.Sprintf(`{"type":"gauge","name":"circuit_breaker","value":%v,"labels":{"service":%q}}`, state, service)
+	if rec := postJSON(t, hs.handleMetricsPush, body); rec.Code != http.StatusOK {
+		t.Fatalf("breaker push %s=%v: status = %d (%s), want 200", service, state, rec.Code, rec.Body.String())
+	}
+}
+
+// breakerList fetches and decodes GET /circuit-breakers.
+func breakerList(t *testing.T, r http.Handler, token string) []BreakerInfo {
+	t.Helper()
+	rec := doReq(t, r, http.MethodGet, "/circuit-breakers", token, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/circuit-breakers = %d, want 200", rec.Code)
+	}
+	var resp struct {
+		Items []BreakerInfo `json:"items"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return resp.Items
+}
+
+func TestBreakerStateLogAndQuery(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk))
+	r := buildRouter(hs, "tok")
+
+	if rec := doReq(t, r, http.MethodGet, "/circuit-breakers", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated breaker list = %d, want 401", rec.Code)
+	}
+
+	pushBreaker(t, hs, "gemini", 2)
+	clk.Advance(30 * time.Second)
+	pushBreaker(t, hs, "gemini", 1)
+	clk.Advance(30 * time.Second)
+	halfOpenAt := formatTimestamp(clk.Now().Add(-30 * time.Second))
+	pushBreaker(t, hs, "gemini", 0)
+	pushBreaker(t, hs, "spotify", 2)
+
+	items := breakerList(t, r, "tok")
+	if len(items) != 2 || items[0].Service != "gemini" || items[1].Service != "spotify" {
+		t.Fatalf("items = %+v, want gemini then spotify (sorted)", items)
+	}
+	g := items[0]
+	if g.State != "closed" || g.PreviousState != "half_open" || g.Transitions != 2 {
+		t.Errorf("gemini = %+v, want closed after 2 transitions from half_open", g)
+	}
+	if g.Since != formatTimestamp(clk.Now()) {
+		t.Errorf("gemini since = %s, want the closed-transition time", g.Since)
+	}
+	if len(g.History) != 2 || g.History[0].From != "open" || g.History[0].To != "half_open" ||
+		g.History[0].At != halfOpenAt || g.History[1].To != "closed" {
+		t.Errorf("gemini history = %+v, want open→half_open→closed with timestamps", g.History)
+	}
+	s := items[1]
+	if s.State != "open" || s.Transitions != 0 || s.PreviousState != "" {
+		t.Errorf("spotify = %+v, want open with no transitions yet", s)
+	}
+}
+
+func TestBreakerSameStatePushKeepsSince(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk))
+	openedAt := formatTimestamp(clk.Now())
+
+	pushBreaker(t, hs, "gemini", 2)
+	clk.Advance(time.Minute)
+	pushBreaker(t, hs, "gemini", 2) // periodic re-push of the same state
+
+	items := hs.breakers.list()
+	if len(items) != 1 || items[0].Since != openedAt || items[0].Transitions != 0 {
+		t.Errorf("items = %+v, want since pinned to the original open time", items)
+	}
+}
+
+func TestBreakerHistoryBounded(t *testing.T) {
+	hs := New(WithVersion("test"))
+	// A flapping breaker: open, closed, open, ... for 30 pushes.
+	for i := 0; i < 30; i++ {
+		state := 2.0
+		if i%2 == 1 {
+			state = 0
+		}
+		pushBreaker(t, hs, "gemini", state)
+	}
+	items := hs.breakers.list()
+	if len(items) != 1 {
+		t.Fatalf("items = %+v, want one breaker", items)
+	}
+	if got := items[0].Transitions; got != 29 {
+		t.Errorf("transitions = %d, want 29 (first push is initial state)", got)
+	}
+	if got := len(items[0].History); got != maxBreakerTransitions {
+		t.Errorf("history length = %d, want bounded at %d", got, maxBreakerTransitions)
+	}
+}
+
+func TestBreakerInvalidStateRejected(t *testing.T) {
+	hs := New(WithVersion("test"))
+	rec := postJSON(t, hs.handleMetricsPush,
+		`{"type":"gauge","name":"circuit_breaker","value":3,"labels":{"service":"gemini"}}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), reasonInvalidEnumValue) {
+		t.Errorf("state 3 = %d (%s), want 400 %s", rec.Code, rec.Body.String(), reasonInvalidEnumValue)
+	}
+	if items := hs.breakers.list(); len(items) != 0 {
+		t.Errorf("rejected push must not enter the log, got %+v", items)
+	}
+}
+
+func TestBreakerHealthImpact(t *testing.T) {
+	// Off by default: an open breaker is listed but never degrades.
+	hs := New(WithVersion("test"))
+	pushBreaker(t, hs, "gemini", 2)
+	status := hs.GetStatus()
+	if status.Status != "healthy" {
+		t.Errorf("default: status = %s, want healthy (impact is opt-in)", status.Status)
+	}
+	if len(status.OpenBreakers) != 1 || status.OpenBreakers[0] != "gemini" {
+		t.Errorf("open_breakers = %v, want [gemini] even without impact", status.OpenBreakers)
+	}
+
+	// Opted in: open degrades, recovery restores.
+	hs = New(WithVersion("test"), WithBreakerHealthImpact(true))
+	pushBreaker(t, hs, "gemini", 2)
+	if got := hs.GetStatus().Status; got != "degraded" {
+		t.Errorf("opted in: status = %s, want degraded", got)
+	}
+	report := hs.GetReadinessReport()
+	if report.Ready {
+		t.Error("opted in: ready = true, want false while a breaker is open")
+	}
+	found := false
+	for _, reason := range report.Reasons {
+		if reason == "circuit_breaker_open:gemini" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("reasons = %v, want circuit_breaker_open:gemini", report.Reasons)
+	}
+	pushBreaker(t, hs, "gemini", 0)
+	if got := hs.GetStatus().Status; got != "healthy" {
+		t.Errorf("after close: status = %s, want healthy", got)
+	}
+	// Half-open is not open: no degradation.
+	pushBreaker(t, hs, "gemini", 1)
+	if got := hs.GetStatus().Status; got != "healthy" {
+		t.Errorf("half-open: status = %s, want healthy", got)
+	}
+}
+
+func TestBreakerAffectsHealthFromEnv(t *testing.T) {
+	tests := []struct {
+		name, raw string
+		want      bool
+	}{
+		{"unset", "", false},
+		{"true", "true", true},
+		{"cased", "TRUE", false},
+		{"junk", "yes", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BREAKER_AFFECTS_HEALTH", tt.raw)
+			if got := breakerAffectsHealthFromEnv(); got != tt.want {
+				t.Errorf("breakerAffectsHealthFromEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package healthkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"testing"
+)
+
+func TestResolveBuildInfo_LdflagsTakePrecedence(t *testing.T) {
+	oldCommit, oldDate := gitCommit, buildDate
+	defer func() { gitCommit, buildDate = oldCommit, oldDate }()
+	gitCommit, buildDate = "abc1234", "2026-08-28T00:00:00Z"
+
+	bi := ResolveBuildInfo()
+	if bi.GitCommit != "abc1234" {
+		t.Errorf("GitCommit = %q, want the -ldflags value", bi.GitCommit)
+	}
+	if bi.BuildDate != "2026-08-28T00:00:00Z" {
+		t.Errorf("BuildDate = %q, want the -ldflags value", bi.BuildDate)
+	}
+	if bi.GoVersion != runtime.Version() {
+		t.Errorf("GoVersion = %q, want %q", bi.GoVersion, runtime.Version())
+	}
+}
+
+func TestResolveBuildInfo_FallbackNeverEmpty(t *testing.T) {
+	oldCommit, oldDate := gitCommit, buildDate
+	defer func() { gitCommit, buildDate = oldCommit, oldDate }()
+	gitCommit, buildDate = "", ""
+
+	// Unstamped build: every field still carries something — either the
+	// embedded vcs metadata or the "unknown" sentinel, never "".
+	bi := ResolveBuildInfo()
+	if bi.GitCommit == "" || bi.BuildDate == "" || bi.GoVersion == "" {
+		t.Errorf("fallback left an empty field: %+v", bi)
+	}
+}
+
+func TestVersionEndpoint(t *testing.T) {
+	hs := New(WithVersion("3.5.0"))
+	// Anonymous even with a token configured, like /health.
+	r := buildRouter(hs, "tok")
+
+	rec := doReq(t, r, http.MethodGet, "/version", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/version = %d, want 200", rec.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("/version body is not JSON: %v", err)
+	}
+	if body["version"] != "3.5.0" {
+		t.Errorf("version = %q, want 3.5.0", body["version"])
+	}
+	for _, key := range []string{"git_commit", "build_date", "go_version"} {
+		if body[key] == "" {
+			t.Errorf("/version body missing %q: %v", key, body)
+		}
+	}
+}
+
+func TestHealthIncludesBuild(t *testing.T) {
+	hs := New(WithVersion("test"))
+	rec := doReq(t, hs.Routes(), http.MethodGet, "/health", "", "")
+
+	var body struct {
+		Build BuildInfo `json:"build"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("/health body is not JSON: %v", err)
+	}
+	if body.Build.GoVersion != runtime.Version() {
+		t.Errorf("build.go_version = %q, want %q", body.Build.GoVersion, runtime.Version())
+	}
+	if body.Build.GitCommit == "" || body.Build.BuildDate == "" {
+		t.Errorf("/health build block has empty fields: %+v", body.Build)
+	}
+}
+
+func TestBuildInfoGauge(t *testing.T) {
+	hs := New(WithVersion("3.5.0"))
+	mf := findMetric(t, hs, "discord_bot_build_info")
+	if mf == nil {
+		t.Fatal("discord_bot_build_info not registered")
+	}
+	m := mf.GetMetric()[0]
+	if m.GetGauge().GetValue() != 1 {
+		t.Errorf("build_info value = %v, want the constant 1", m.GetGauge().GetValue())
+	}
+	labels := map[string]string{}
+	for _, lp := range m.GetLabel() {
+		labels[lp.GetName()] = lp.GetValue()
+	}
+	if labels["version"] != "3.5.0" {
+		t.Errorf("version label = %q, want 3.5.0", labels["version"])
+	}
+	for _, name := range []string{"commit", "go_version"} {
+		if labels[name] == "" {
+			t.Errorf("label %q is empty: %v", name, labels)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package healthkit
+
+// Series cardinality guard for the push surface's endpoint label. The other
+// pushed labels (status, result, type, service) stay on their small fixed
+// allowlists in allowedLabelValues, but collapsing every endpoint the Python
+// side reports into seven buckets threw away exactly the granularity the
+// request dashboards want. The guard lets well-formed endpoint values mint
+// real series — up to a per-metric-family budget (default 200,
+// MAX_SERIES_PER_METRIC) — and routes everything past the budget onto a
+// single "overflow" series, counted on discord_bot_series_overflow_total so
+// a client that suddenly fragments its endpoint names shows up as a climbing
+// counter rather than an OOM'd Prometheus.
+//
+// Two values are reserved and never spend budget: "other" (what malformed
+// values and absent labels collapse to, unchanged from the allowlist era) and
+// "overflow" itself. Values must match the same lowercase snake_case pattern
+// as pushed summary names; anything else — path traversal attempts, cased
+// junk, raw URLs — still lands on "other" exactly as before, so the guard
+// only ever admits names that are safe to appear verbatim in scrape output.
+//
+// The tracking map is bounded by construction: each family stores at most
+// `limit` combination keys and nothing is recorded once a family is full, so
+// an attacker hammering distinct endpoints grows the overflow counter, not
+// memory. GET /metrics/cardinality reports the live per-family counts.
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultSeriesLimit is the per-metric-family budget of distinct label-value
+// combinations; override with WithSeriesLimit / MAX_SERIES_PER_METRIC.
+const defaultSeriesLimit = 200
+
+// cardinalityGuard tracks distinct label-value combinations per metric
+// family under a shared mutex. Memory is bounded: a family's set never
+// exceeds the limit.
+type cardinalityGuard struct {
+	mu       sync.Mutex
+	limit    int
+	families map[string]map[string]struct{}
+}
+
+func newCardinalityGuard(limit int) *cardinalityGuard {
+	if limit <= 0 {
+		limit = defaultSeriesLimit
+	}
+	return &cardinalityGuard{limit: limit, families: make(map[string]map[string]struct{})}
+}
+
+// admit reports whether the label-value combination may exist as a real
+// series on family: already-seen combinations are always admitted, new ones
+// only while the family has budget left.
+func (g *cardinalityGuard) admit(family, combo string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	set := g.families[family]
+	if set == nil {
+		set = make(map[string]struct{})
+		g.families[family] = set
+	}
+	if _, ok := set[combo]; ok {
+		return true
+	}
+	if len(set) >= g.limit {
+		return false
+	}
+	set[combo] = struct{}{}
+	return true
+}
+
+// snapshot returns the configured limit and the current per-family counts.
+func (g *cardinalityGuard) snapshot() (limit int, counts map[string]int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	counts = make(map[string]int, len(g.families))
+	for family, set := range g.families {
+		counts[family] = len(set)
+	}
+	return g.limit, counts
+}
+
+// guardedEndpoint resolves the endpoint label for one observation on family.
+// Malformed values collapse to "other" (the pre-guard behavior); well-formed
+// values pass through while the family's series budget lasts and land on
+// "overflow" afterwards. rest carries the observation's other, already
+// bounded label values so the budget counts whole combinations, matching
+// what Prometheus actually stores.
+func (h *Service) guardedEndpoint(family, value string, rest ...string) string {
+	value = strings.TrimSpace(value)
+	if value == "other" || value == "overflow" || !summaryNameRE.MatchString(value) {
+		if value != "other" && value != "overflow" {
+			value = "other"
+		}
+		return value
+	}
+	combo := value
+	for _, r := range rest {
+		combo += "\x00" + r
+	}
+	if h.cardGuard.admit(family, combo) {
+		return value
+	}
+	h.metrics.seriesOverflow.WithLabelValues(family).Inc()
+	return "overflow"
+}
+
+// WithSeriesLimit sets the per-metric-family series budget. Non-positive
+// values keep the default.
+func WithSeriesLimit(n int) Option {
+	return func(h *Service) {
+		if n > 0 {
+			h.seriesLimit = n
+		}
+	}
+}
+
+// seriesLimitFromEnv reads MAX_SERIES_PER_METRIC. Same fail-safe posture as
+// the other *FromEnv helpers: garbage keeps the default with a warning.
+func seriesLimitFromEnv() int {
+	raw := strings.TrimSpace(os.Getenv("MAX_SERIES_PER_METRIC"))
+	if raw == "" {
+		return defaultSeriesLimit
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("WARNING: invalid MAX_SERIES_PER_METRIC %q (must be a positive integer) — using default %d", raw, defaultSeriesLimit)
+		return defaultSeriesLimit
+	}
+	return n
+}
+
+// CardinalityFamily is one metric family's entry in the /metrics/cardinality
+// response.
+type CardinalityFamily struct {
+	Metric string `json:"metric"`
+	Series int    `json:"series"`
+}
+
+// CardinalityReport is the GET /metrics/cardinality response body.
+type CardinalityReport struct {
+	Limit    int                 `json:"limit"`
+	Families []CardinalityFamily `json:"families"`
+}
+
+// handleCardinality serves GET /metrics/cardinality: the per-family counts
+// of admitted label-value combinations, for spotting a family creeping
+// toward its budget before the overflow counter starts moving.
+func (h *Service) handleCardinality(w http.ResponseWriter, r *http.Request) {
+	limit, counts := h.cardGuard.snapshot()
+	report := CardinalityReport{Limit: limit, Families: make([]CardinalityFamily, 0, len(counts))}
+	for metric, n := range counts {
+		report.Families = append(report.Families, CardinalityFamily{Metric: metric, Series: n})
+	}
+	sort.Slice(report.Families, func(i, j int) bool {
+		return report.Families[i].Metric < report.Families[j].Metric
+	})
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("Failed to encode cardinality response: %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package healthkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// endpointValues collects the distinct endpoint label values on a scraped
+// metric family.
+func endpointValues(t *testing.T, hs *Service, family string) map[string]bool {
+	t.Helper()
+	mf := findMetric(t, hs, family)
+	if mf == nil {
+		t.Fatalf("family %s missing from scrape", family)
+	}
+	values := map[string]bool{}
+	for _, m := range mf.GetMetric() {
+		for _, l := range m.GetLabel() {
+			if l.GetName() == "endpoint" {
+				values[l.GetValue()] = true
+			}
+		}
+	}
+	return values
+}
+
+func TestCardinalityGuardCapsEndpointSeries(t *testing.T) {
+	hs := New(WithVersion("test")) // default limit: 200
+
+	// 500 distinct, well-formed endpoints. The first 200 mint real series;
+	// the other 300 land on the single "overflow" series.
+	for i := 0; i < 500; i++ {
+		body := fmt.Sprintf(`{"type":"counter","name":"requests","value":1,"labels":{"status":"success","endpoint":"ep_%03d"}}`, i)
+		if rec := postJSON(t, hs.handleMetricsPush, body); rec.Code != http.StatusOK {
+			t.Fatalf("push %d = %d (%s), want 200", i, rec.Code, rec.Body.String())
+		}
+	}
+
+	values := endpointValues(t, hs, "discord_bot_requests_total")
+	if !values["overflow"] {
+		t.Fatal("overflow series missing")
+	}
+	if got := len(values) - 1; got != 200 {
+		t.Errorf("real endpoint series = %d, want exactly the 200 budget", got)
+	}
+	if got := testutil.ToFloat64(hs.metrics.seriesOverflow.WithLabelValues("requests")); got != 300 {
+		t.Errorf("series_overflow{requests} = %v, want 300", got)
+	}
+	// The overflow series absorbed every over-budget observation.
+	if got := testutil.ToFloat64(hs.metrics.requestsTotal.WithLabelValues("overflow", "success")); got != 300 {
+		t.Errorf("requests{overflow,success} = %v, want 300", got)
+	}
+}
+
+func TestCardinalityFamiliesBudgetIndependently(t *testing.T) {
+	hs := New(WithVersion("test"), WithSeriesLimit(2))
+
+	for _, ep := range []string{"alpha", "beta", "gamma"} {
+		postJSON(t, hs.handleMetricsPush,
+			fmt.Sprintf(`{"type":"counter","name":"requests","value":1,"labels":{"status":"success","endpoint":%q}}`, ep))
+		postJSON(t, hs.handleMetricsPush,
+			fmt.Sprintf(`{"type":"histogram","name":"request_duration","value":0.1,"labels":{"endpoint":%q}}`, ep))
+	}
+
+	// Each family spent its own two-series budget; "requests" filling up did
+	// not eat into "request_duration".
+	for _, family := range []string{"discord_bot_requests_total", "discord_bot_request_duration_seconds"} {
+		values := endpointValues(t, hs, family)
+		if !values["alpha"] || !values["beta"] || values["gamma"] || !values["overflow"] {
+			t.Errorf("%s endpoints = %v, want alpha+beta+overflow", family, values)
+		}
+	}
+	for _, metric := range []string{"requests", "request_duration"} {
+		if got := testutil.ToFloat64(hs.metrics.seriesOverflow.WithLabelValues(metric)); got != 1 {
+			t.Errorf("series_overflow{%s} = %v, want 1", metric, got)
+		}
+	}
+}
+
+func TestGuardedEndpointReservedAndMalformed(t *testing.T) {
+	hs := New(WithVersion("test"), WithSeriesLimit(1))
+	tests := []struct {
+		name, value, want string
+	}{
+		{"first well-formed value spends the budget", "ai", "ai"},
+		{"seen value re-admitted past the cap", "ai", "ai"},
+		{"new value over budget", "music", "overflow"},
+		{"path traversal collapses", "/../../etc", "other"},
+		{"cased junk collapses", "NOPE", "other"},
+		{"empty collapses", "", "other"},
+		{"reserved other passes through untracked", "other", "other"},
+		{"reserved overflow passes through untracked", "overflow", "overflow"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hs.guardedEndpoint("requests", tt.value); got != tt.want {
+				t.Errorf("guardedEndpoint(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+	// Reserved values and junk never entered the tracking map.
+	if _, counts := hs.cardGuard.snapshot(); counts["requests"] != 1 {
+		t.Errorf("tracked combinations = %d, want 1", counts["requests"])
+	}
+}
+
+func TestCardinalityEndpoint(t *testing.T) {
+	hs := New(WithVersion("test"), WithSeriesLimit(5))
+	r := buildRouter(hs, "tok")
+
+	if rec := doReq(t, r, http.MethodGet, "/metrics/cardinality", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated cardinality = %d, want 401", rec.Code)
+	}
+
+	postJSON(t, hs.handleMetricsPush, `{"type":"counter","name":"requests","value":1,"labels":{"status":"success","endpoint":"ai"}}`)
+	postJSON(t, hs.handleMetricsPush, `{"type":"histogram","name":"request_duration","value":0.1,"labels":{"endpoint":"ai"}}`)
+
+	rec := doReq(t, r, http.MethodGet, "/metrics/cardinality", "tok", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("cardinality = %d, want 200", rec.Code)
+	}
+	var report CardinalityReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if report.Limit != 5 {
+		t.Errorf("limit = %d, want 5", report.Limit)
+	}
+	want := []CardinalityFamily{{Metric: "request_duration", Series: 1}, {Metric: "requests", Series: 1}}
+	if len(report.Families) != 2 || report.Families[0] != want[0] || report.Families[1] != want[1] {
+		t.Errorf("families = %+v, want %+v (sorted by metric)", report.Families, want)
+	}
+}
+
+func TestSeriesLimitFromEnv(t *testing.T) {
+	tests := []struct {
+		name, raw string
+		want      int
+	}{
+		{"unset keeps default", "", defaultSeriesLimit},
+		{"valid override", "50", 50},
+		{"garbage keeps default", "lots", defaultSeriesLimit},
+		{"non-positive keeps default", "-1", defaultSeriesLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_SERIES_PER_METRIC", tt.raw)
+			if got := seriesLimitFromEnv(); got != tt.want {
+				t.Errorf("seriesLimitFromEnv() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
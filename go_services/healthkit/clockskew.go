@@ -0,0 +1,132 @@
+package healthkit
+
+// Client clock-skew tracking. The Python side stamps its pushes with its own
+// notion of time, and one host has drifted 30+ seconds from this server,
+// which made lining up a push with the log lines around it painful. Pushes
+// and heartbeats may now carry an optional `client_timestamp` (RFC3339); the
+// handler computes the skew against this server's clock, publishes it on a
+// per-writer gauge (discord_bot_client_clock_skew_seconds), surfaces the
+// largest absolute skew seen in /health's metrics map, and warns — at most
+// once per minute, a drifting NTP daemon would otherwise warn on every push
+// — when the skew exceeds CLOCK_SKEW_WARN_SECONDS.
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultSkewWarnThreshold is the absolute skew above which the rate-limited
+// warning fires. 10s is well past NTP jitter but still small enough to catch
+// the drifting host before log correlation becomes hopeless.
+const defaultSkewWarnThreshold = 10 * time.Second
+
+// skewWarnMinInterval spaces the threshold warnings: skew is a host-level
+// condition, so one line per interval carries all the information.
+const skewWarnMinInterval = time.Minute
+
+// Writer labels for the skew gauge — one per surface that can carry a
+// client_timestamp, fixed here so the label cardinality is bounded.
+const (
+	skewWriterPush      = "metrics_push"
+	skewWriterBatch     = "metrics_batch"
+	skewWriterHeartbeat = "heartbeat"
+)
+
+// WithClockSkewWarnThreshold sets the absolute skew above which the
+// rate-limited warning fires.
+func WithClockSkewWarnThreshold(d time.Duration) Option {
+	return func(h *Service) {
+		if d > 0 {
+			h.skewWarnThreshold = d
+		}
+	}
+}
+
+// skewWarnFromEnv reads the CLOCK_SKEW_WARN_SECONDS override with the usual
+// fail-safe posture.
+func skewWarnFromEnv() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("CLOCK_SKEW_WARN_SECONDS"))
+	if raw == "" {
+		return defaultSkewWarnThreshold
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("WARNING: invalid CLOCK_SKEW_WARN_SECONDS %q (must be a positive integer) — using default %s", raw, defaultSkewWarnThreshold)
+		return defaultSkewWarnThreshold
+	}
+	return time.Duration(n) * time.Second
+}
+
+// observeClientClock records one writer's client_timestamp: gauge, max-skew
+// bookkeeping, and the rate-limited threshold warning. Unparseable stamps are
+// logged (through the same rate limit) and otherwise ignored — the field is
+// advisory, so a bad clock report must never reject the metric it rode in on.
+func (h *Service) observeClientClock(ctx context.Context, writer, clientTS string) {
+	cfg := h.config()
+	now := h.clock.Now()
+	clientTime, err := time.Parse(time.RFC3339, clientTS)
+	if err != nil {
+		h.mu.Lock()
+		shouldWarn := h.skewWarnAllowedLocked(now)
+		h.mu.Unlock()
+		if shouldWarn {
+			cfg.Logger.LogAttrs(ctx, slog.LevelWarn, "unparseable client_timestamp",
+				slog.String("writer", writer),
+				slog.String("request_id", RequestIDFromContext(ctx)),
+			)
+		}
+		return
+	}
+
+	// Positive skew = the client's clock runs ahead of this server's.
+	skew := clientTime.Sub(now)
+	h.metrics.clientClockSkew.WithLabelValues(writer).Set(skew.Seconds())
+
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+
+	h.mu.Lock()
+	if !h.skewSeen || abs > h.maxSkew {
+		h.maxSkew = abs
+		h.skewSeen = true
+	}
+	shouldWarn := abs > cfg.SkewWarnThreshold && h.skewWarnAllowedLocked(now)
+	h.mu.Unlock()
+
+	if shouldWarn {
+		cfg.Logger.LogAttrs(ctx, slog.LevelWarn, "client clock skew above threshold",
+			slog.String("writer", writer),
+			slog.Int64("skew_ms", skew.Milliseconds()),
+			slog.Int64("threshold_ms", cfg.SkewWarnThreshold.Milliseconds()),
+			slog.String("request_id", RequestIDFromContext(ctx)),
+		)
+	}
+}
+
+// skewWarnAllowedLocked consumes the warning budget when the rate limit
+// permits another line. Caller holds mu (write).
+func (h *Service) skewWarnAllowedLocked(now time.Time) bool {
+	if !h.lastSkewWarn.IsZero() && now.Sub(h.lastSkewWarn) < skewWarnMinInterval {
+		return false
+	}
+	h.lastSkewWarn = now
+	return true
+}
+
+// maxSkewMillisLocked returns the largest absolute skew observed so far; ok
+// is false until the first client_timestamp arrives, so /health keeps its
+// historical key set for deployments that never send one. Caller holds mu
+// (read).
+func (h *Service) maxSkewMillisLocked() (int64, bool) {
+	if !h.skewSeen {
+		return 0, false
+	}
+	return h.maxSkew.Milliseconds(), true
+}
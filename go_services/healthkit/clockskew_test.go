@@ -0,0 +1,249 @@
+package healthkit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveClientClock_SkewMath(t *testing.T) {
+	base := time.Unix(1_700_000_000, 0).UTC()
+	tests := []struct {
+		name       string
+		clientTime time.Time
+		wantGauge  float64
+		wantMaxMs  int64
+	}{
+		{"client ahead", base.Add(5 * time.Second), 5, 5000},
+		{"client behind", base.Add(-30 * time.Second), -30, 30000},
+		{"in sync", base, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock(base)
+			hs := New(WithVersion("test"), WithClock(clock))
+
+			hs.observeClientClock(context.Background(), skewWriterPush,
+				tt.clientTime.Format(time.RFC3339))
+
+			got := testutil.ToFloat64(hs.metrics.clientClockSkew.WithLabelValues(skewWriterPush))
+			if got != tt.wantGauge {
+				t.Errorf("skew gauge = %v, want %v", got, tt.wantGauge)
+			}
+			ms, ok := hs.GetStatus().Metrics["max_clock_skew_ms"]
+			if !ok || ms != tt.wantMaxMs {
+				t.Errorf("max_clock_skew_ms = %v (present %v), want %d", ms, ok, tt.wantMaxMs)
+			}
+		})
+	}
+}
+
+func TestObserveClientClock_MaxIsAbsoluteAndSticky(t *testing.T) {
+	base := time.Unix(1_700_000_000, 0).UTC()
+	clock := newFakeClock(base)
+	hs := New(WithVersion("test"), WithClock(clock))
+
+	hs.observeClientClock(context.Background(), skewWriterPush, base.Add(-20*time.Second).Format(time.RFC3339))
+	hs.observeClientClock(context.Background(), skewWriterPush, base.Add(3*time.Second).Format(time.RFC3339))
+
+	if ms := hs.GetStatus().Metrics["max_clock_skew_ms"]; ms != int64(20000) {
+		t.Errorf("max_clock_skew_ms = %v, want 20000 (absolute max, not last)", ms)
+	}
+}
+
+func TestObserveClientClock_NoObservationNoKey(t *testing.T) {
+	hs := New(WithVersion("test"))
+	if _, ok := hs.GetStatus().Metrics["max_clock_skew_ms"]; ok {
+		t.Error("max_clock_skew_ms present before any client_timestamp arrived")
+	}
+}
+
+func TestClockSkew_WarnThresholdRateLimited(t *testing.T) {
+	base := time.Unix(1_700_000_000, 0).UTC()
+	clock := newFakeClock(base)
+	var buf bytes.Buffer
+	hs := New(WithVersion("test"), WithClock(clock),
+		WithLogger(slog.New(slog.NewJSONHandler(&buf, nil))),
+		WithClockSkewWarnThreshold(10*time.Second))
+
+	warnCount := func() int {
+		n := 0
+		for _, rec := range logRecords(t, &buf) {
+			if rec["level"] == "WARN" {
+				n++
+			}
+		}
+		return n
+	}
+
+	// Under threshold: no warning at all.
+	hs.observeClientClock(context.Background(), skewWriterPush, clock.Now().Add(9*time.Second).Format(time.RFC3339))
+	if got := warnCount(); got != 0 {
+		t.Fatalf("under-threshold skew warned %d times", got)
+	}
+
+	// Over threshold: exactly one warning for a burst of observations.
+	for i := 0; i < 5; i++ {
+		hs.observeClientClock(context.Background(), skewWriterPush, clock.Now().Add(-31*time.Second).Format(time.RFC3339))
+	}
+	if got := warnCount(); got != 1 {
+		t.Fatalf("over-threshold burst warned %d times, want 1 (rate-limited)", got)
+	}
+
+	// Past the rate-limit window the next breach warns again.
+	clock.Advance(skewWarnMinInterval + time.Second)
+	hs.observeClientClock(context.Background(), skewWriterPush, clock.Now().Add(-31*time.Second).Format(time.RFC3339))
+	if got := warnCount(); got != 2 {
+		t.Errorf("post-window breach warned %d times total, want 2", got)
+	}
+}
+
+func TestObserveClientClock_InvalidTimestampAdvisory(t *testing.T) {
+	hs, buf := captureLogger(t)
+	hs.observeClientClock(context.Background(), skewWriterPush, "yesterday-ish")
+
+	if _, ok := hs.GetStatus().Metrics["max_clock_skew_ms"]; ok {
+		t.Error("unparseable client_timestamp recorded a skew")
+	}
+	records := logRecords(t, buf)
+	if len(records) != 1 || records[0]["level"] != "WARN" {
+		t.Errorf("unparseable stamp: got records %v, want one WARN", records)
+	}
+}
+
+func TestHandleMetricsPush_ClientTimestamp(t *testing.T) {
+	base := time.Unix(1_700_000_000, 0).UTC()
+	clock := newFakeClock(base)
+	hs := New(WithVersion("test"), WithClock(clock))
+	r := buildRouter(hs, "push-token")
+
+	body := fmt.Sprintf(`{"name":"requests","type":"counter","labels":{"endpoint":"x","status":"200"},"client_timestamp":%q}`,
+		base.Add(7*time.Second).Format(time.RFC3339))
+	rec := doReq(t, r, http.MethodPost, "/metrics/push", "push-token", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("push with client_timestamp: code = %d, body %s", rec.Code, rec.Body.String())
+	}
+	if got := testutil.ToFloat64(hs.metrics.clientClockSkew.WithLabelValues(skewWriterPush)); got != 7 {
+		t.Errorf("push skew gauge = %v, want 7", got)
+	}
+
+	// A bad stamp is advisory: the metric itself still lands.
+	rec = doReq(t, r, http.MethodPost, "/metrics/push", "push-token",
+		`{"name":"requests","type":"counter","labels":{"endpoint":"x","status":"200"},"client_timestamp":"not-a-time"}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("push with bad client_timestamp: code = %d, want 200", rec.Code)
+	}
+}
+
+func TestHandleMetricsBatch_ClientTimestamp(t *testing.T) {
+	base := time.Unix(1_700_000_000, 0).UTC()
+	clock := newFakeClock(base)
+	hs := New(WithVersion("test"), WithClock(clock))
+	r := buildRouter(hs, "push-token")
+
+	// Only the first stamped item is observed for the batch.
+	body := fmt.Sprintf(`[{"name":"requests","type":"counter","labels":{"endpoint":"a","status":"200"}},`+
+		`{"name":"requests","type":"counter","labels":{"endpoint":"b","status":"200"},"client_timestamp":%q}]`,
+		base.Add(-4*time.Second).Format(time.RFC3339))
+	rec := doReq(t, r, http.MethodPost, "/metrics/batch", "push-token", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("batch: code = %d, body %s", rec.Code, rec.Body.String())
+	}
+	if got := testutil.ToFloat64(hs.metrics.clientClockSkew.WithLabelValues(skewWriterBatch)); got != -4 {
+		t.Errorf("batch skew gauge = %v, want -4", got)
+	}
+}
+
+func TestHandleHeartbeat_ClientTimestamp(t *testing.T) {
+	base := time.Unix(1_700_000_000, 0).UTC()
+	clock := newFakeClock(base)
+	hs := New(WithVersion("test"), WithClock(clock))
+	r := buildRouter(hs, "push-token")
+
+	body := fmt.Sprintf(`{"services":{"bot":true},"client_timestamp":%q}`,
+		base.Add(12*time.Second).Format(time.RFC3339))
+	rec := doReq(t, r, http.MethodPost, "/health/heartbeat", "push-token", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("heartbeat: code = %d, body %s", rec.Code, rec.Body.String())
+	}
+	if got := testutil.ToFloat64(hs.metrics.clientClockSkew.WithLabelValues(skewWriterHeartbeat)); got != 12 {
+		t.Errorf("heartbeat skew gauge = %v, want 12", got)
+	}
+}
+
+func TestSkewWarnFromEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want time.Duration
+	}{
+		{"unset uses default", "", defaultSkewWarnThreshold},
+		{"valid override", "30", 30 * time.Second},
+		{"zero falls back", "0", defaultSkewWarnThreshold},
+		{"negative falls back", "-5", defaultSkewWarnThreshold},
+		{"garbage falls back", "soon", defaultSkewWarnThreshold},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CLOCK_SKEW_WARN_SECONDS", tt.env)
+			if got := skewWarnFromEnv(); got != tt.want {
+				t.Errorf("skewWarnFromEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatTimestamp(t *testing.T) {
+	tests := []struct {
+		name string
+		in   time.Time
+		want string
+	}{
+		{
+			"millisecond precision",
+			time.Date(2026, 8, 28, 12, 34, 56, 789_000_000, time.UTC),
+			"2026-08-28T12:34:56.789Z",
+		},
+		{
+			"whole seconds keep fixed width",
+			time.Date(2026, 8, 28, 12, 34, 56, 0, time.UTC),
+			"2026-08-28T12:34:56.000Z",
+		},
+		{
+			"non-UTC input normalized",
+			time.Date(2026, 8, 28, 19, 34, 56, 250_000_000, time.FixedZone("ICT", 7*3600)),
+			"2026-08-28T12:34:56.250Z",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatTimestamp(tt.in); got != tt.want {
+				t.Errorf("formatTimestamp() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthTimestampsMillisecondFormat(t *testing.T) {
+	clock := newFakeClock(time.Date(2026, 8, 28, 1, 2, 3, 456_000_000, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clock))
+	hs.ApplyHeartbeat(map[string]bool{"bot": true})
+	hs.ApplyShardReport(ShardReport{ShardID: 0, TotalShards: 1, Connected: true, LatencyMs: 50})
+
+	status := hs.GetStatus()
+	for field, value := range map[string]string{
+		"timestamp":          status.Timestamp,
+		"last_heartbeat":     status.LastHeartbeat,
+		"shards.last_report": status.Shards["0"].LastReport,
+	} {
+		if _, err := time.Parse(rfc3339Milli, value); err != nil {
+			t.Errorf("%s = %q does not match the millisecond format: %v", field, value, err)
+		}
+	}
+}
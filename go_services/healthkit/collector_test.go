@@ -0,0 +1,135 @@
+package healthkit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCollectSystemMetrics_SamplingFloor(t *testing.T) {
+	clock := newFakeClock(time.Unix(1000, 0))
+	hs := New(WithVersion("test"), WithClock(clock))
+
+	hs.CollectSystemMetrics()
+	first := hs.lastMemSample.Load()
+	if first == 0 {
+		t.Fatal("first call must sample")
+	}
+
+	// Within the interval: dropped, no matter how many callers pile on.
+	clock.Advance(time.Second)
+	hs.CollectSystemMetrics()
+	hs.CollectSystemMetrics()
+	if got := hs.lastMemSample.Load(); got != first {
+		t.Errorf("call inside the sampling floor re-sampled (stamp %d -> %d)", first, got)
+	}
+
+	// Past the interval: sampled again.
+	clock.Advance(2 * time.Second)
+	hs.CollectSystemMetrics()
+	if got := hs.lastMemSample.Load(); got == first {
+		t.Error("call past the sampling floor did not re-sample")
+	}
+}
+
+func TestCollectSystemMetrics_IntervalOption(t *testing.T) {
+	clock := newFakeClock(time.Unix(1000, 0))
+	hs := New(WithVersion("test"), WithClock(clock),
+		WithCollectorInterval(100*time.Millisecond))
+	hs.CollectSystemMetrics()
+	first := hs.lastMemSample.Load()
+	clock.Advance(150 * time.Millisecond)
+	hs.CollectSystemMetrics()
+	if hs.lastMemSample.Load() == first {
+		t.Error("shortened interval not honored")
+	}
+}
+
+func TestCollectorIntervalFromEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want time.Duration
+	}{
+		{"unset uses default", "", defaultCollectorInterval},
+		{"valid override", "500", 500 * time.Millisecond},
+		{"zero falls back", "0", defaultCollectorInterval},
+		{"negative falls back", "-10", defaultCollectorInterval},
+		{"garbage falls back", "fast", defaultCollectorInterval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MEMSTATS_INTERVAL_MS", tt.env)
+			if got := collectorIntervalFromEnv(); got != tt.want {
+				t.Errorf("collectorIntervalFromEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadiness_WorksWithoutCollector(t *testing.T) {
+	// No StartCollector, no CollectSystemMetrics priming: readiness must not
+	// depend on a MemStats sample ever having happened.
+	hs := New(WithVersion("test"))
+	hs.SetServiceStatus("bot", true)
+
+	report := hs.GetReadinessReport()
+	if !report.Ready || report.Status != "healthy" {
+		t.Errorf("readiness without collector: %+v", report)
+	}
+
+	hs.SetServiceStatus("bot", false)
+	report = hs.GetReadinessReport()
+	if report.Ready || len(report.Reasons) != 1 || report.Reasons[0] != "service_unhealthy:bot" {
+		t.Errorf("degraded readiness without collector: %+v", report)
+	}
+}
+
+func TestAggregateStatus(t *testing.T) {
+	clock := newFakeClock(time.Unix(1000, 0))
+	hs := New(WithVersion("test"), WithClock(clock))
+	if got := hs.AggregateStatus(); got != "healthy" {
+		t.Errorf("empty service: %q", got)
+	}
+	hs.SetServiceStatus("bot", false)
+	if got := hs.AggregateStatus(); got != "degraded" {
+		t.Errorf("unhealthy service: %q", got)
+	}
+	hs.SetServiceStatus("bot", true)
+	// Shard disconnected past grace degrades the cheap accessor too.
+	hs.ApplyShardReport(ShardReport{ShardID: 0, TotalShards: 1, Connected: false})
+	clock.Advance(defaultShardDisconnectGrace + time.Second)
+	if got := hs.AggregateStatus(); got != "degraded" {
+		t.Errorf("overdue shard: %q", got)
+	}
+}
+
+// BenchmarkReadinessProbe compares the old probe cost (full GetStatus
+// document per probe) against the new cheap path GetReadinessReport uses.
+func BenchmarkReadinessProbe(b *testing.B) {
+	hs := New(WithVersion("bench"))
+	for i := 0; i < 50; i++ {
+		hs.SetServiceStatus(fmt.Sprintf("service-%d", i), true)
+	}
+	b.Run("full_GetStatus", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if hs.GetStatus().Status != "healthy" {
+				b.Fatal("unexpected status")
+			}
+		}
+	})
+	b.Run("readiness_report", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if !hs.GetReadinessReport().Ready {
+				b.Fatal("unexpected readiness")
+			}
+		}
+	})
+	b.Run("aggregate_status", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if hs.AggregateStatus() != "healthy" {
+				b.Fatal("unexpected status")
+			}
+		}
+	})
+}
@@ -0,0 +1,190 @@
+package healthkit
+
+// Per-command usage metrics. The bot's slash commands (/ask, /summarize, …)
+// flow through the same push pipeline as everything else: counter
+// "command_invocations" (labels command, status) and histogram
+// "command_duration" (label command), exported as
+// discord_bot_command_invocations_total and
+// discord_bot_command_duration_seconds.
+//
+// The command label is user-adjacent — a typo'd or malicious client could
+// mint one series per message — so values are validated against an allowlist
+// FILE rather than a hard-coded map: the command roster changes faster than
+// this service deploys. The file is one command per line ('#' comments and
+// blank lines ignored), named by COMMAND_ALLOWLIST_PATH, and re-read on every
+// config reload (SIGHUP or POST /admin/reload) so adding a command never
+// needs a restart. Unlisted values collapse to "other", same posture as
+// safeLabel/safeModelLabel.
+//
+// GET /stats/commands answers "what are people actually using?" without a
+// scrape: a leaderboard of the top N commands by invocation count, computed
+// from internal accumulators fed by the same applyMetric arms as the
+// Prometheus series, so the two can't drift.
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultCommandLeaders is the leaderboard size when ?limit is absent.
+const defaultCommandLeaders = 10
+
+// commandStore holds the allowlist and the usage accumulators. Its own mutex,
+// like the incident and breaker stores: reads come from request handlers,
+// allowlist swaps from the reload path.
+type commandStore struct {
+	mu       sync.Mutex
+	allowed  map[string]bool
+	counts   map[string]float64
+	duration map[string]float64 // summed seconds per command
+}
+
+// safeLabel maps a pushed command value onto the bounded set: allowlisted
+// names pass through, everything else (including empty) collapses to "other".
+func (c *commandStore) safeLabel(value string) string {
+	value = sanitizeLabel(strings.TrimSpace(value))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.allowed[value] {
+		return value
+	}
+	return "other"
+}
+
+func (c *commandStore) recordCount(command string, n float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[command] += n
+}
+
+func (c *commandStore) recordDuration(command string, seconds float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.duration[command] += seconds
+}
+
+// setAllowed swaps the allowlist; returns whether it actually changed, so the
+// reload path can report it accurately.
+func (c *commandStore) setAllowed(next map[string]bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(next) == len(c.allowed) {
+		same := true
+		for name := range next {
+			if !c.allowed[name] {
+				same = false
+				break
+			}
+		}
+		if same {
+			return false
+		}
+	}
+	c.allowed = next
+	return true
+}
+
+// CommandUsage is one leaderboard row of GET /stats/commands.
+type CommandUsage struct {
+	Command              string  `json:"command"`
+	Count                float64 `json:"count"`
+	TotalDurationSeconds float64 `json:"total_duration_seconds,omitempty"`
+}
+
+// leaderboard returns the top n commands by count (descending, name ascending
+// on ties so the order is deterministic).
+func (c *commandStore) leaderboard(n int) []CommandUsage {
+	c.mu.Lock()
+	rows := make([]CommandUsage, 0, len(c.counts))
+	for name, count := range c.counts {
+		rows = append(rows, CommandUsage{
+			Command:              name,
+			Count:                count,
+			TotalDurationSeconds: c.duration[name],
+		})
+	}
+	c.mu.Unlock()
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Count != rows[j].Count {
+			return rows[i].Count > rows[j].Count
+		}
+		return rows[i].Command < rows[j].Command
+	})
+	if len(rows) > n {
+		rows = rows[:n]
+	}
+	return rows
+}
+
+// loadCommandAllowlist parses an allowlist file: one command per line, '#'
+// starts a comment, blank lines are skipped. Returns the set and any read
+// error — callers decide whether that keeps a previous set (reload) or starts
+// empty (construction).
+func loadCommandAllowlist(path string) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	allowed := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line != "" {
+			allowed[sanitizeLabel(line)] = true
+		}
+	}
+	return allowed, nil
+}
+
+// reloadCommandAllowlist re-reads the allowlist file for the reload path.
+// Returns (changed, error message): a read failure keeps the previous set —
+// a reload never half-applies.
+func (h *Service) reloadCommandAllowlist() (bool, string) {
+	if h.commandAllowlistPath == "" {
+		return false, ""
+	}
+	allowed, err := loadCommandAllowlist(h.commandAllowlistPath)
+	if err != nil {
+		return false, "failed to read COMMAND_ALLOWLIST_PATH: " + err.Error() + " — keeping the previous allowlist"
+	}
+	return h.commands.setAllowed(allowed), ""
+}
+
+// handleCommandStats serves GET /stats/commands?limit=N.
+func (h *Service) handleCommandStats(w http.ResponseWriter, r *http.Request) {
+	limit := defaultCommandLeaders
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			writeParamError(w, "limit", "invalid limit (must be a positive integer)")
+			return
+		}
+		limit = n
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"commands": h.commands.leaderboard(limit),
+	}); err != nil {
+		log.Printf("Failed to encode command stats: %v", err)
+	}
+}
+
+// WithCommandAllowlist sets the command allowlist file path; empty disables
+// the file (every command then collapses to "other").
+func WithCommandAllowlist(path string) Option {
+	return func(h *Service) { h.commandAllowlistPath = path }
+}
+
+// commandAllowlistFromEnv reads COMMAND_ALLOWLIST_PATH; empty disables the
+// file.
+func commandAllowlistFromEnv() string {
+	return strings.TrimSpace(os.Getenv("COMMAND_ALLOWLIST_PATH"))
+}
@@ -0,0 +1,186 @@
+package healthkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeAllowlist writes a command allowlist file and returns its path.
+func writeAllowlist(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, "commands.txt")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write allowlist: %v", err)
+	}
+	return path
+}
+
+// pushCommand pushes one command_invocations counter payload.
+func pushCommand(t *testing.T, r http.Handler, token, command string, value float64) {
+	t.Helper()
+	body := fmt.Sprintf(`{"type":"counter","name":"command_invocations","value":%g,"labels":{"command":%q}}`, value, command)
+	rec := doReq(t, r, http.MethodPost, "/metrics/push", token, body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("push command %q = %d, want 200; body %s", command, rec.Code, rec.Body.String())
+	}
+}
+
+func TestCommandLabelAllowlistAndFallback(t *testing.T) {
+	path := writeAllowlist(t, t.TempDir(), "ask\nsummarize # the long one\n\n# music\nplay\n")
+	hs := New(WithVersion("test"), WithCommandAllowlist(path))
+	r := buildRouter(hs, "tok")
+
+	pushCommand(t, r, "tok", "ask", 3)
+	pushCommand(t, r, "tok", "summarize", 1)
+	pushCommand(t, r, "tok", "selfdestruct", 1) // unlisted
+	pushCommand(t, r, "tok", "", 1)             // absent
+
+	mf := findMetric(t, hs, "discord_bot_command_invocations_total")
+	got := map[string]float64{}
+	for _, m := range mf.GetMetric() {
+		var command, status string
+		for _, lp := range m.GetLabel() {
+			switch lp.GetName() {
+			case "command":
+				command = lp.GetValue()
+			case "status":
+				status = lp.GetValue()
+			}
+		}
+		if status != "success" {
+			t.Errorf("status label = %q, want the schema default success", status)
+		}
+		got[command] = m.GetCounter().GetValue()
+	}
+	want := map[string]float64{"ask": 3, "summarize": 1, "other": 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("series = %v, want %v", got, want)
+	}
+}
+
+func TestCommandDurationHistogram(t *testing.T) {
+	path := writeAllowlist(t, t.TempDir(), "ask\n")
+	hs := New(WithVersion("test"), WithCommandAllowlist(path))
+	r := buildRouter(hs, "tok")
+
+	for _, body := range []string{
+		`{"type":"histogram","name":"command_duration","value":0.5,"labels":{"command":"ask"}}`,
+		`{"type":"histogram","name":"command_duration","value":1.5,"labels":{"command":"ask"}}`,
+		`{"type":"histogram","name":"command_duration","value":9.9,"labels":{"command":"mystery"}}`,
+	} {
+		if rec := doReq(t, r, http.MethodPost, "/metrics/push", "tok", body); rec.Code != http.StatusOK {
+			t.Fatalf("push = %d, want 200; body %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	mf := findMetric(t, hs, "discord_bot_command_duration_seconds")
+	sums := map[string]float64{}
+	for _, m := range mf.GetMetric() {
+		for _, lp := range m.GetLabel() {
+			if lp.GetName() == "command" {
+				sums[lp.GetValue()] = m.GetHistogram().GetSampleSum()
+			}
+		}
+	}
+	if sums["ask"] != 2.0 {
+		t.Errorf("ask duration sum = %v, want 2.0", sums["ask"])
+	}
+	if sums["other"] != 9.9 {
+		t.Errorf("other duration sum = %v, want the unlisted command's 9.9", sums["other"])
+	}
+}
+
+func TestCommandAllowlistReload(t *testing.T) {
+	dir := t.TempDir()
+	path := writeAllowlist(t, dir, "ask\n")
+	hs := New(WithVersion("test"), WithCommandAllowlist(path))
+	r := buildRouter(hs, "tok")
+
+	pushCommand(t, r, "tok", "summarize", 1)
+	if got := hs.commands.safeLabel("summarize"); got != "other" {
+		t.Fatalf("pre-reload safeLabel = %q, want other", got)
+	}
+
+	// Adding the command to the file and reloading makes it a real series —
+	// no restart.
+	writeAllowlist(t, dir, "ask\nsummarize\n")
+	res := hs.ReloadFromEnv()
+	found := false
+	for _, a := range res.Applied {
+		if a == "command_allowlist" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("reload applied = %v, want command_allowlist", res.Applied)
+	}
+	pushCommand(t, r, "tok", "summarize", 2)
+	if got := hs.commands.safeLabel("summarize"); got != "summarize" {
+		t.Errorf("post-reload safeLabel = %q, want summarize", got)
+	}
+
+	// A reload with an unchanged file reports nothing.
+	if res = hs.ReloadFromEnv(); len(res.Applied) != 0 {
+		t.Errorf("no-op reload applied = %v, want empty", res.Applied)
+	}
+
+	// A vanished file keeps the previous allowlist and surfaces the error.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	res = hs.ReloadFromEnv()
+	if len(res.Errors) != 1 {
+		t.Fatalf("reload errors = %v, want the read failure", res.Errors)
+	}
+	if got := hs.commands.safeLabel("summarize"); got != "summarize" {
+		t.Errorf("safeLabel after failed reload = %q, want the previous allowlist kept", got)
+	}
+}
+
+func TestCommandLeaderboard(t *testing.T) {
+	path := writeAllowlist(t, t.TempDir(), "ask\nsummarize\nplay\n")
+	hs := New(WithVersion("test"), WithCommandAllowlist(path))
+	r := buildRouter(hs, "tok")
+
+	pushCommand(t, r, "tok", "ask", 10)
+	pushCommand(t, r, "tok", "play", 25)
+	pushCommand(t, r, "tok", "summarize", 10)
+	pushCommand(t, r, "tok", "unlisted", 3)
+	if rec := doReq(t, r, http.MethodPost, "/metrics/push", "tok",
+		`{"type":"histogram","name":"command_duration","value":4.5,"labels":{"command":"play"}}`); rec.Code != http.StatusOK {
+		t.Fatalf("duration push = %d, want 200", rec.Code)
+	}
+
+	if rec := doReq(t, r, http.MethodGet, "/stats/commands", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated = %d, want 401", rec.Code)
+	}
+	rec := doReq(t, r, http.MethodGet, "/stats/commands?limit=3", "tok", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("leaderboard = %d, want 200", rec.Code)
+	}
+	var resp struct {
+		Commands []CommandUsage `json:"commands"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	// Count descending, name ascending on the 10/10 tie; "other" (count 3)
+	// falls off the top 3.
+	want := []CommandUsage{
+		{Command: "play", Count: 25, TotalDurationSeconds: 4.5},
+		{Command: "ask", Count: 10},
+		{Command: "summarize", Count: 10},
+	}
+	if !reflect.DeepEqual(resp.Commands, want) {
+		t.Errorf("leaderboard = %+v, want %+v", resp.Commands, want)
+	}
+
+	if rec := doReq(t, r, http.MethodGet, "/stats/commands?limit=0", "tok", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("limit=0 = %d, want 400", rec.Code)
+	}
+}
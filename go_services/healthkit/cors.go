@@ -0,0 +1,118 @@
+package healthkit
+
+// CORS for the browser-based status page. Off by default: with no
+// CORS_ALLOWED_ORIGINS configured the middleware isn't even installed and
+// responses carry no CORS headers at all, exactly as before. When enabled,
+// the allowance is deliberately narrow — read-only methods against an
+// explicit origin list; the write endpoints never get CORS headers, so a
+// browser page can render health but can never be tricked into pushing
+// metrics or toggling maintenance cross-origin (the bearer token is the real
+// gate there, but there is no reason to hand browsers a CORS green light to
+// try).
+//
+// Origins match exactly, or via a single leading wildcard label:
+// "https://*.example.com" admits any subdomain of example.com over https —
+// but not example.com itself, and never a scheme the pattern didn't name.
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// corsMaxAge is how long browsers may cache a preflight verdict.
+const corsMaxAge = "600"
+
+// corsOriginAllowed reports whether origin matches any configured pattern.
+func corsOriginAllowed(origin string, patterns []string) bool {
+	for _, p := range patterns {
+		if p == origin {
+			return true
+		}
+		// Wildcard subdomain: scheme://*.domain matches scheme://<sub>.domain
+		// (any depth), not the bare domain.
+		scheme, host, ok := strings.Cut(p, "://")
+		if !ok || !strings.HasPrefix(host, "*.") {
+			continue
+		}
+		oScheme, oHost, ok := strings.Cut(origin, "://")
+		if !ok || oScheme != scheme {
+			continue
+		}
+		if strings.HasSuffix(oHost, host[1:]) { // ".domain"
+			return true
+		}
+	}
+	return false
+}
+
+// corsMiddleware handles preflights and decorates read responses. Installed
+// only when origins are configured (see baseRouter).
+func (h *Service) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !corsOriginAllowed(origin, h.corsOrigins) {
+			// Not a CORS request, or not an origin we trust: no headers, and
+			// for a stray preflight just fall through to the router's 405.
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// The response varies by Origin whether or not we allow it — without
+		// this a shared cache could replay one origin's grant to another.
+		w.Header().Add("Vary", "Origin")
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			// Preflight. Only the read methods are ever granted; a preflight
+			// for POST gets no CORS headers and the browser blocks it.
+			if m := r.Header.Get("Access-Control-Request-Method"); m != http.MethodGet && m != http.MethodHead {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-None-Match")
+			w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		// Actual requests: decorate reads only. POST responses stay bare even
+		// for a trusted origin.
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", "ETag")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WithCORSOrigins sets the origin allowlist; empty keeps CORS off entirely.
+func WithCORSOrigins(origins []string) Option {
+	return func(h *Service) { h.corsOrigins = origins }
+}
+
+// corsOriginsFromEnv parses CORS_ALLOWED_ORIGINS (comma-separated). Entries
+// without a scheme are dropped with a warning rather than guessed at — an
+// allowlist entry that matches more than the operator wrote is how CORS
+// holes happen.
+func corsOriginsFromEnv() []string {
+	raw := strings.TrimSpace(os.Getenv("CORS_ALLOWED_ORIGINS"))
+	if raw == "" {
+		return nil
+	}
+	var origins []string
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "://") || entry == "*" {
+			log.Printf("WARNING: ignoring CORS_ALLOWED_ORIGINS entry %q (must be scheme://host, optionally with one leading *. label)", entry)
+			continue
+		}
+		origins = append(origins, entry)
+	}
+	return origins
+}
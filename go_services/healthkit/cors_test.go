@@ -0,0 +1,137 @@
+package healthkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// doCORS issues one request with an Origin header (and optional preflight
+// method) against a fresh recorder.
+func doCORS(t *testing.T, r http.Handler, method, path, origin, preflightFor string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if preflightFor != "" {
+		req.Header.Set("Access-Control-Request-Method", preflightFor)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCORSDisabledByDefault(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+
+	rec := doCORS(t, r, http.MethodGet, "/health", "https://dash.example.com", "")
+	if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("CORS headers present with no allowlist configured")
+	}
+}
+
+func TestCORSAllowedAndDisallowedOrigin(t *testing.T) {
+	hs := New(WithVersion("test"), WithCORSOrigins([]string{"https://dash.example.com"}))
+	r := buildRouter(hs, "tok")
+
+	rec := doCORS(t, r, http.MethodGet, "/health", "https://dash.example.com", "")
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://dash.example.com" {
+		t.Errorf("Allow-Origin = %q, want the requesting origin echoed", got)
+	}
+	if rec.Header().Get("Vary") == "" {
+		t.Error("no Vary: Origin on a CORS response")
+	}
+
+	rec = doCORS(t, r, http.MethodGet, "/health", "https://evil.example.net", "")
+	if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("CORS grant for an origin outside the allowlist")
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("disallowed origin still gets the plain response, got %d", rec.Code)
+	}
+}
+
+func TestCORSWildcardSubdomain(t *testing.T) {
+	tests := []struct {
+		name, origin string
+		want         bool
+	}{
+		{"subdomain", "https://status.example.com", true},
+		{"deep subdomain", "https://a.b.example.com", true},
+		{"bare domain", "https://example.com", false},
+		{"wrong scheme", "http://status.example.com", false},
+		{"suffix trick", "https://evilexample.com", false},
+		{"other domain", "https://example.org", false},
+	}
+	patterns := []string{"https://*.example.com"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := corsOriginAllowed(tt.origin, patterns); got != tt.want {
+				t.Errorf("corsOriginAllowed(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	hs := New(WithVersion("test"), WithCORSOrigins([]string{"https://dash.example.com"}))
+	r := buildRouter(hs, "tok")
+
+	rec := doCORS(t, r, http.MethodOptions, "/health", "https://dash.example.com", http.MethodGet)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("preflight = %d, want 204", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Methods"); got != "GET, HEAD, OPTIONS" {
+		t.Errorf("Allow-Methods = %q, want read methods only", got)
+	}
+	if rec.Header().Get("Access-Control-Allow-Headers") == "" {
+		t.Error("no Allow-Headers on preflight")
+	}
+	if rec.Header().Get("Access-Control-Max-Age") != corsMaxAge {
+		t.Errorf("Max-Age = %q, want %s", rec.Header().Get("Access-Control-Max-Age"), corsMaxAge)
+	}
+
+	// A preflight asking for POST is never granted, even from a trusted
+	// origin — write endpoints have no CORS surface.
+	rec = doCORS(t, r, http.MethodOptions, "/metrics/push", "https://dash.example.com", http.MethodPost)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("preflight granted for POST")
+	}
+}
+
+func TestCORSPostResponsesStayBare(t *testing.T) {
+	hs := New(WithVersion("test"), WithCORSOrigins([]string{"https://dash.example.com"}))
+	r := buildRouter(hs, "tok")
+
+	req := httptest.NewRequest(http.MethodPost, "/metrics/push", nil)
+	req.Header.Set("Origin", "https://dash.example.com")
+	req.Header.Set("Authorization", "Bearer tok")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("CORS headers on a POST response")
+	}
+}
+
+func TestCORSOriginsFromEnv(t *testing.T) {
+	tests := []struct {
+		name, raw string
+		want      int
+	}{
+		{"unset", "", 0},
+		{"two valid", "https://a.example.com, https://b.example.com", 2},
+		{"wildcard kept", "https://*.example.com", 1},
+		{"schemeless dropped", "dashboard.example.com, https://ok.example.com", 1},
+		{"bare star dropped", "*", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CORS_ALLOWED_ORIGINS", tt.raw)
+			if got := corsOriginsFromEnv(); len(got) != tt.want {
+				t.Errorf("corsOriginsFromEnv() = %v, want %d entries", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package healthkit
+
+// One-shot debug snapshot for bug reports. Triaging a user report used to
+// mean asking them for five separate curl outputs (/health, /stats/daily,
+// /stats/cost, /stats, /metrics) and hoping they ran them within the same
+// minute. GET /debug/snapshot assembles everything into a single JSON
+// document: the health status, every internal accumulator (token counts, the
+// cost estimate, the daily rollup), the goroutine count with a grouped
+// top-N stack summary, the build identity, and the active configuration.
+// Secrets are redacted before serialization — the bearer token and the alert
+// webhook URL (whose path routinely embeds a credential) never appear in a
+// snapshot, because snapshots get pasted into public issue trackers.
+// ?format=gzip compresses the document and sets a timestamped
+// Content-Disposition filename so "download and attach" is one click.
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultSnapshotGroups is the goroutine-group count when ?goroutines is
+// absent.
+const defaultSnapshotGroups = 10
+
+// maxGoroutineDumpBytes bounds the runtime.Stack buffer growth — a process
+// with pathologically many goroutines gets a truncated (still parseable)
+// dump rather than an allocation spiral inside the debugging endpoint.
+const maxGoroutineDumpBytes = 16 << 20
+
+// debugSnapshot is the GET /debug/snapshot response body.
+type debugSnapshot struct {
+	GeneratedAt string             `json:"generated_at"`
+	Health      HealthStatus       `json:"health"`
+	Build       BuildInfo          `json:"build"`
+	Tokens      []tokenSnapshotRow `json:"tokens"`
+	Cost        costReport         `json:"cost"`
+	Rollup      []dayStats         `json:"rollup"`
+	Goroutines  goroutineReport    `json:"goroutines"`
+	Config      snapshotConfig     `json:"config"`
+}
+
+// tokenSnapshotRow is one (type, model) accumulator cell.
+type tokenSnapshotRow struct {
+	Type  string  `json:"type"`
+	Model string  `json:"model"`
+	Count float64 `json:"count"`
+}
+
+// goroutineReport carries the live count plus the grouped stack summary.
+type goroutineReport struct {
+	Count  int              `json:"count"`
+	Groups []goroutineGroup `json:"top_groups"`
+}
+
+// goroutineGroup is one distinct (state, frames) shape and how many
+// goroutines share it — 200 identical chan-receive workers collapse into one
+// row instead of 200 pages of dump.
+type goroutineGroup struct {
+	Count  int      `json:"count"`
+	State  string   `json:"state"`
+	Frames []string `json:"frames"`
+}
+
+// snapshotConfig is the active configuration as the snapshot reports it.
+// Secret-bearing fields hold redacted placeholders, never the real value.
+type snapshotConfig struct {
+	AuthToken        string  `json:"auth_token"`
+	MaxServices      int     `json:"max_services"`
+	MetricsPrefix    string  `json:"metrics_prefix,omitempty"`
+	WriteRPS         float64 `json:"write_rps"`
+	WriteBurst       int     `json:"write_burst"`
+	MaxInFlight      int     `json:"max_in_flight"`
+	MaxConcurrent    int     `json:"max_concurrent"`
+	QueueWait        string  `json:"queue_wait"`
+	ListMaxBytes     int     `json:"list_max_bytes"`
+	StreamMaxItems   int     `json:"stream_max_items"`
+	RollupRetention  int     `json:"rollup_retention_days"`
+	TokenPriceInput  float64 `json:"token_price_input_per_1k"`
+	TokenPriceOutput float64 `json:"token_price_output_per_1k"`
+	MaxMemoryBytes   uint64  `json:"max_memory_bytes"`
+	MaxGoroutines    int     `json:"max_goroutines"`
+	QueueThreshold   float64 `json:"queue_backlog_threshold"`
+	QueueGrace       string  `json:"queue_backlog_grace"`
+	AlertRuleCount   int     `json:"alert_rule_count"`
+	AlertWebhook     string  `json:"alert_webhook,omitempty"`
+}
+
+// redactSecret replaces a configured secret with a placeholder. Empty stays
+// empty so the snapshot still distinguishes "no token configured" (an
+// actionable misconfiguration) from "token configured".
+func redactSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+// redactWebhookURL keeps only the scheme and host of a webhook URL. Slack-
+// and Discord-style webhooks carry the credential in the path, and query
+// strings or userinfo can too, so everything past the host is dropped rather
+// than selectively scrubbed.
+func redactWebhookURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "[redacted]"
+	}
+	return u.Scheme + "://" + u.Host + "/[redacted]"
+}
+
+// parseGoroutineDump groups a runtime.Stack(all=true) dump by stack shape.
+// Each goroutine block contributes its header state (wait durations like
+// "chan receive, 3 minutes" stripped to "chan receive" so otherwise
+// identical goroutines still group) and its function-name frames (arguments
+// and file/line positions dropped). Groups come back count-descending.
+func parseGoroutineDump(dump []byte) []goroutineGroup {
+	type key struct{ sig string }
+	groups := make(map[key]*goroutineGroup)
+	for _, block := range strings.Split(string(dump), "\n\n") {
+		lines := strings.Split(strings.TrimSpace(block), "\n")
+		if len(lines) == 0 || !strings.HasPrefix(lines[0], "goroutine ") {
+			continue
+		}
+		state := ""
+		if open := strings.Index(lines[0], "["); open >= 0 {
+			if close := strings.Index(lines[0][open:], "]"); close > 0 {
+				state = lines[0][open+1 : open+close]
+				if comma := strings.Index(state, ","); comma >= 0 {
+					state = state[:comma]
+				}
+			}
+		}
+		var frames []string
+		for _, line := range lines[1:] {
+			// File/line positions are tab-indented; only the function lines
+			// (including "created by ...") name the shape.
+			if strings.HasPrefix(line, "\t") || line == "" {
+				continue
+			}
+			if strings.HasSuffix(line, ")") {
+				if open := strings.LastIndex(line, "("); open > 0 {
+					line = line[:open]
+				}
+			}
+			frames = append(frames, line)
+		}
+		if len(frames) == 0 {
+			continue
+		}
+		k := key{sig: state + "|" + strings.Join(frames, "|")}
+		g, ok := groups[k]
+		if !ok {
+			g = &goroutineGroup{State: state, Frames: frames}
+			groups[k] = g
+		}
+		g.Count++
+	}
+	out := make([]goroutineGroup, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, *g)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Frames[0] < out[j].Frames[0]
+	})
+	return out
+}
+
+// captureGoroutines dumps and groups every live goroutine stack, keeping the
+// top n groups.
+func captureGoroutines(n int) goroutineReport {
+	buf := make([]byte, 1<<20)
+	for {
+		written := runtime.Stack(buf, true)
+		if written < len(buf) {
+			buf = buf[:written]
+			break
+		}
+		if len(buf) >= maxGoroutineDumpBytes {
+			break // truncated dump; the parser handles a cut-off tail
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	groups := parseGoroutineDump(buf)
+	if len(groups) > n {
+		groups = groups[:n]
+	}
+	return goroutineReport{Count: runtime.NumGoroutine(), Groups: groups}
+}
+
+// buildSnapshotConfig renders the effective configuration with secrets
+// redacted. Live-reloadable fields come from the current Config snapshot;
+// structural ones from the Service itself.
+func (h *Service) buildSnapshotConfig() snapshotConfig {
+	cfg := h.config()
+	h.queues.mu.Lock()
+	queueThreshold, queueGrace := h.queues.threshold, h.queues.grace
+	h.queues.mu.Unlock()
+	h.alerts.mu.Lock()
+	ruleCount, webhook := len(h.alerts.rules), h.alerts.webhookURL
+	h.alerts.mu.Unlock()
+	return snapshotConfig{
+		AuthToken:        redactSecret(cfg.AuthToken),
+		MaxServices:      h.maxServices,
+		MetricsPrefix:    h.metricsPrefix,
+		WriteRPS:         h.writeRPS,
+		WriteBurst:       h.writeBurst,
+		MaxInFlight:      h.maxInFlight,
+		MaxConcurrent:    h.maxConcurrent,
+		QueueWait:        h.queueWait.String(),
+		ListMaxBytes:     h.listMaxBytes,
+		StreamMaxItems:   h.streamMaxItems,
+		RollupRetention:  h.rollupRetention,
+		TokenPriceInput:  h.tokenPriceInput,
+		TokenPriceOutput: h.tokenPriceOutput,
+		MaxMemoryBytes:   cfg.MaxMemoryBytes,
+		MaxGoroutines:    cfg.MaxGoroutines,
+		QueueThreshold:   queueThreshold,
+		QueueGrace:       queueGrace.String(),
+		AlertRuleCount:   ruleCount,
+		AlertWebhook:     redactWebhookURL(webhook),
+	}
+}
+
+// buildDebugSnapshot assembles the full document.
+func (h *Service) buildDebugSnapshot(topGroups int) debugSnapshot {
+	counts, _ := h.tokenCosts.snapshot()
+	tokens := make([]tokenSnapshotRow, 0, len(counts))
+	for k, v := range counts {
+		tokens = append(tokens, tokenSnapshotRow{Type: k.Type, Model: k.Model, Count: v})
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].Type != tokens[j].Type {
+			return tokens[i].Type < tokens[j].Type
+		}
+		return tokens[i].Model < tokens[j].Model
+	})
+	return debugSnapshot{
+		GeneratedAt: formatTimestamp(h.clock.Now()),
+		Health:      h.GetStatus(),
+		Build:       h.build,
+		Tokens:      tokens,
+		Cost:        h.buildCostReport(),
+		Rollup:      h.rollup.snapshot(),
+		Goroutines:  captureGoroutines(topGroups),
+		Config:      h.buildSnapshotConfig(),
+	}
+}
+
+// handleDebugSnapshot serves GET /debug/snapshot.
+func (h *Service) handleDebugSnapshot(w http.ResponseWriter, r *http.Request) {
+	topGroups := defaultSnapshotGroups
+	if raw := r.URL.Query().Get("goroutines"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			writeParamError(w, "goroutines", "invalid goroutines (must be a positive integer)")
+			return
+		}
+		topGroups = n
+	}
+	snap := h.buildDebugSnapshot(topGroups)
+	switch format := strings.ToLower(r.URL.Query().Get("format")); format {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(snap); err != nil {
+			log.Printf("Failed to encode debug snapshot: %v", err)
+		}
+	case "gzip":
+		name := "health-snapshot-" + h.clock.Now().UTC().Format("20060102T150405Z") + ".json.gz"
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+		gz := gzip.NewWriter(w)
+		if err := json.NewEncoder(gz).Encode(snap); err != nil {
+			log.Printf("Failed to encode debug snapshot: %v", err)
+		}
+		if err := gz.Close(); err != nil {
+			log.Printf("Failed to finish gzip snapshot: %v", err)
+		}
+	default:
+		writeParamError(w, "format", "invalid format (must be json or gzip)")
+	}
+}
@@ -0,0 +1,227 @@
+package healthkit
+
+// Version negotiation for evolving endpoints. As v2 response shapes roll out,
+// clients need machine-readable warning before a v1 form disappears — a
+// changelog nobody reads is not a deprecation policy. Endpoints or schema
+// versions declared deprecated (DEPRECATIONS env, JSON) emit RFC 9745
+// `Deprecation` and RFC 8594 `Sunset` headers, every request to one is
+// counted on <namespace>_deprecated_requests_total{endpoint}, and GET
+// /capabilities lists the full status so a client can check once instead of
+// sniffing headers. Past the sunset date requests get 410 with a migration
+// hint — but only when DEPRECATION_ENFORCE_SUNSET is explicitly on, so
+// flipping a date in config can never break clients before an operator
+// decides it should.
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Deprecation declares one deprecated endpoint or schema version. Dates are
+// RFC3339; a malformed date is dropped with a warning rather than silently
+// enforcing the wrong instant.
+type Deprecation struct {
+	// Name is the stable identifier, e.g. "health_v1" or "fetch_schema_v1";
+	// it is also the metric's endpoint label.
+	Name string `json:"name"`
+	// Since is when the form was deprecated (emitted as the Deprecation
+	// header); optional.
+	Since string `json:"since,omitempty"`
+	// Sunset is when the form may be removed (emitted as the Sunset header,
+	// and the 410 cutoff under enforcement); optional.
+	Sunset string `json:"sunset,omitempty"`
+	// Migration is the hint returned in the 410 envelope and /capabilities.
+	Migration string `json:"migration,omitempty"`
+}
+
+// deprecationEntry is the parsed form.
+type deprecationEntry struct {
+	decl   Deprecation
+	since  time.Time
+	sunset time.Time
+}
+
+// DeprecationSet is the framework core: header emission, request counting,
+// sunset enforcement and the /capabilities document. Standalone (not bound to
+// Service) so the url_fetcher binary applies the identical policy with its
+// own registry and namespace.
+type DeprecationSet struct {
+	clock   Clock
+	enforce bool
+	entries map[string]deprecationEntry
+	counter *prometheus.CounterVec
+}
+
+// NewDeprecationSet builds the set, registering the request counter on reg
+// under the given namespace. A nil clock means real time.
+func NewDeprecationSet(reg prometheus.Registerer, namespace string, clock Clock, enforce bool, deps ...Deprecation) *DeprecationSet {
+	if clock == nil {
+		clock = realClock{}
+	}
+	s := &DeprecationSet{
+		clock:   clock,
+		enforce: enforce,
+		entries: make(map[string]deprecationEntry, len(deps)),
+		counter: promauto.With(reg).NewCounterVec(
+			prometheus.CounterOpts{
+				Name: namespace + "_deprecated_requests_total",
+				Help: "Requests still using a deprecated endpoint or schema version",
+			},
+			[]string{"endpoint"},
+		),
+	}
+	for _, dep := range deps {
+		if dep.Name == "" {
+			log.Printf("WARNING: deprecation entry without a name — skipped")
+			continue
+		}
+		entry := deprecationEntry{decl: dep}
+		if dep.Since != "" {
+			t, err := time.Parse(time.RFC3339, dep.Since)
+			if err != nil {
+				log.Printf("WARNING: deprecation %q has invalid since %q — dropping the date", dep.Name, dep.Since)
+			} else {
+				entry.since = t
+			}
+		}
+		if dep.Sunset != "" {
+			t, err := time.Parse(time.RFC3339, dep.Sunset)
+			if err != nil {
+				log.Printf("WARNING: deprecation %q has invalid sunset %q — dropping the date", dep.Name, dep.Sunset)
+			} else {
+				entry.sunset = t
+			}
+		}
+		s.entries[dep.Name] = entry
+	}
+	return s
+}
+
+// Wrap applies the policy for name to a handler. With no matching declaration
+// it returns next unchanged, so routes can be wrapped unconditionally and the
+// config alone decides which forms are deprecated.
+func (s *DeprecationSet) Wrap(name string, next http.HandlerFunc) http.HandlerFunc {
+	entry, ok := s.entries[name]
+	if !ok {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.counter.WithLabelValues(name).Inc()
+		// RFC 9745: "@<unix>" when the deprecation instant is known.
+		if entry.since.IsZero() {
+			w.Header().Set("Deprecation", "true")
+		} else {
+			w.Header().Set("Deprecation", "@"+strconv.FormatInt(entry.since.Unix(), 10))
+		}
+		if !entry.sunset.IsZero() {
+			w.Header().Set("Sunset", entry.sunset.UTC().Format(http.TimeFormat))
+			if s.enforce && s.clock.Now().After(entry.sunset) {
+				w.Header().Set("Content-Type", "application/json")
+				writeError(w, http.StatusGone, "sunset",
+					"this form is past its sunset date and has been removed",
+					map[string]any{"migration": entry.decl.Migration})
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// DeprecationStatus is one row of the /capabilities document.
+type DeprecationStatus struct {
+	Name       string `json:"name"`
+	Since      string `json:"since,omitempty"`
+	Sunset     string `json:"sunset,omitempty"`
+	Migration  string `json:"migration,omitempty"`
+	PastSunset bool   `json:"past_sunset"`
+	Enforced   bool   `json:"enforced"`
+}
+
+// Status lists every declared deprecation, sorted by name.
+func (s *DeprecationSet) Status() []DeprecationStatus {
+	now := s.clock.Now()
+	out := make([]DeprecationStatus, 0, len(s.entries))
+	for name, entry := range s.entries {
+		out = append(out, DeprecationStatus{
+			Name:       name,
+			Since:      entry.decl.Since,
+			Sunset:     entry.decl.Sunset,
+			Migration:  entry.decl.Migration,
+			PastSunset: !entry.sunset.IsZero() && now.After(entry.sunset),
+			Enforced:   s.enforce,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// CapabilitiesHandler serves GET /capabilities: what this service is and
+// which of its forms are on the way out.
+func (s *DeprecationSet) CapabilitiesHandler(service, version string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(struct {
+			Service      string              `json:"service,omitempty"`
+			Version      string              `json:"version,omitempty"`
+			Deprecations []DeprecationStatus `json:"deprecations"`
+		}{Service: service, Version: version, Deprecations: s.Status()}); err != nil {
+			log.Printf("Failed to encode capabilities: %v", err)
+		}
+	}
+}
+
+// WithDeprecations declares the deprecated forms the Service's routes should
+// announce (see DeprecationsFromEnv for the env contract).
+func WithDeprecations(deps []Deprecation) Option {
+	return func(h *Service) { h.pendingDeprecations = deps }
+}
+
+// WithSunsetEnforcement turns post-sunset requests into 410s instead of
+// warnings-only headers.
+func WithSunsetEnforcement(enforce bool) Option {
+	return func(h *Service) { h.enforceSunset = enforce }
+}
+
+// DeprecationsFromEnv reads the DEPRECATIONS JSON array, e.g.
+//
+//	[{"name":"health_v1","since":"2026-06-01T00:00:00Z",
+//	  "sunset":"2027-01-01T00:00:00Z","migration":"use /health?schema=v2"}]
+//
+// Exported because the url_fetcher binary shares the env contract. Fail-safe:
+// malformed JSON warns and deprecates nothing.
+func DeprecationsFromEnv() []Deprecation {
+	raw := strings.TrimSpace(os.Getenv("DEPRECATIONS"))
+	if raw == "" {
+		return nil
+	}
+	var deps []Deprecation
+	if err := json.Unmarshal([]byte(raw), &deps); err != nil {
+		log.Printf("WARNING: invalid DEPRECATIONS JSON (%v) — no forms marked deprecated", err)
+		return nil
+	}
+	return deps
+}
+
+// SunsetEnforcementFromEnv reads DEPRECATION_ENFORCE_SUNSET. Off unless
+// explicitly affirmative — a config date flip must never 410 clients before
+// an operator opts in.
+func SunsetEnforcementFromEnv() bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("DEPRECATION_ENFORCE_SUNSET"))) {
+	case "1", "true", "yes", "on":
+		return true
+	case "", "0", "false", "no", "off":
+		return false
+	default:
+		log.Printf("WARNING: invalid DEPRECATION_ENFORCE_SUNSET %q — enforcement stays off", os.Getenv("DEPRECATION_ENFORCE_SUNSET"))
+		return false
+	}
+}
@@ -0,0 +1,212 @@
+package healthkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// depFixture builds a Service whose /health document is deprecated with the
+// given dates, on a fake clock anchored at base.
+func depFixture(t *testing.T, base time.Time, enforce bool, dep Deprecation) (*Service, http.Handler) {
+	t.Helper()
+	hs := New(WithVersion("test"), WithClock(newFakeClock(base)),
+		WithDeprecations([]Deprecation{dep}), WithSunsetEnforcement(enforce))
+	return hs, hs.Routes()
+}
+
+func depGet(t *testing.T, r http.Handler, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestDeprecationWrap_HeaderEmission(t *testing.T) {
+	base := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC)
+	sunset := base.Add(90 * 24 * time.Hour)
+	_, r := depFixture(t, base, false, Deprecation{
+		Name:   "health_v1",
+		Since:  base.Format(time.RFC3339),
+		Sunset: sunset.Format(time.RFC3339),
+	})
+
+	rec := depGet(t, r, "/health")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("deprecated /health before sunset: code = %d, want 200", rec.Code)
+	}
+	wantDep := "@" + strconv.FormatInt(base.Unix(), 10)
+	if got := rec.Header().Get("Deprecation"); got != wantDep {
+		t.Errorf("Deprecation = %q, want %q", got, wantDep)
+	}
+	if got := rec.Header().Get("Sunset"); got != sunset.Format(http.TimeFormat) {
+		t.Errorf("Sunset = %q, want %q", got, sunset.Format(http.TimeFormat))
+	}
+
+	// Undeclared endpoints stay clean.
+	rec = depGet(t, r, "/health/live")
+	if rec.Header().Get("Deprecation") != "" || rec.Header().Get("Sunset") != "" {
+		t.Error("deprecation headers leaked onto an undeclared endpoint")
+	}
+}
+
+func TestDeprecationWrap_UnconfiguredIsNoop(t *testing.T) {
+	hs := New(WithVersion("test"))
+	rec := depGet(t, hs.Routes(), "/health")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/health = %d", rec.Code)
+	}
+	if rec.Header().Get("Deprecation") != "" {
+		t.Error("Deprecation header with nothing configured")
+	}
+}
+
+func TestDeprecationWrap_CountsRequests(t *testing.T) {
+	base := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC)
+	hs, r := depFixture(t, base, false, Deprecation{Name: "health_v1"})
+
+	for i := 0; i < 3; i++ {
+		depGet(t, r, "/health")
+	}
+	got := testutil.ToFloat64(hs.deprecations.counter.WithLabelValues("health_v1"))
+	if got != 3 {
+		t.Errorf("deprecated_requests_total{health_v1} = %v, want 3", got)
+	}
+}
+
+func TestDeprecationWrap_PostSunset(t *testing.T) {
+	base := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC)
+	dep := Deprecation{
+		Name:      "health_v1",
+		Sunset:    base.Add(-time.Hour).Format(time.RFC3339),
+		Migration: "use /health?schema=v2",
+	}
+
+	// Enforcement off (the default): past-sunset requests still answer, with
+	// the headers as the only signal.
+	_, r := depFixture(t, base, false, dep)
+	rec := depGet(t, r, "/health")
+	if rec.Code != http.StatusOK {
+		t.Errorf("unenforced post-sunset /health = %d, want 200", rec.Code)
+	}
+	if rec.Header().Get("Sunset") == "" {
+		t.Error("unenforced post-sunset response lost the Sunset header")
+	}
+
+	// Enforcement on: 410 with the migration hint in the envelope.
+	_, r = depFixture(t, base, true, dep)
+	rec = depGet(t, r, "/health")
+	if rec.Code != http.StatusGone {
+		t.Fatalf("enforced post-sunset /health = %d, want 410", rec.Code)
+	}
+	envelope := decodeErrorEnvelope(t, rec)
+	if envelope.Code != "sunset" {
+		t.Errorf("code = %q, want sunset", envelope.Code)
+	}
+	if envelope.Details["migration"] != dep.Migration {
+		t.Errorf("migration = %q, want %q", envelope.Details["migration"], dep.Migration)
+	}
+
+	// Enforcement on but sunset still ahead: normal response.
+	future := dep
+	future.Sunset = base.Add(time.Hour).Format(time.RFC3339)
+	_, r = depFixture(t, base, true, future)
+	if rec := depGet(t, r, "/health"); rec.Code != http.StatusOK {
+		t.Errorf("enforced pre-sunset /health = %d, want 200", rec.Code)
+	}
+}
+
+func TestDeprecation_InvalidDatesDropped(t *testing.T) {
+	base := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC)
+	_, r := depFixture(t, base, true, Deprecation{Name: "health_v1", Sunset: "next spring"})
+
+	rec := depGet(t, r, "/health")
+	if rec.Code != http.StatusOK {
+		t.Errorf("bad sunset date must never enforce: code = %d", rec.Code)
+	}
+	if rec.Header().Get("Sunset") != "" {
+		t.Error("unparseable sunset emitted a Sunset header")
+	}
+	if rec.Header().Get("Deprecation") != "true" {
+		t.Errorf("Deprecation = %q, want the bare \"true\" form without a date", rec.Header().Get("Deprecation"))
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	base := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC)
+	_, r := depFixture(t, base, true, Deprecation{
+		Name:      "health_v1",
+		Sunset:    base.Add(-time.Hour).Format(time.RFC3339),
+		Migration: "use /health?schema=v2",
+	})
+
+	rec := depGet(t, r, "/capabilities")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/capabilities = %d", rec.Code)
+	}
+	var doc struct {
+		Service      string              `json:"service"`
+		Version      string              `json:"version"`
+		Deprecations []DeprecationStatus `json:"deprecations"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("capabilities body: %v", err)
+	}
+	if doc.Service != "health_api" || doc.Version != "test" {
+		t.Errorf("service/version = %q/%q", doc.Service, doc.Version)
+	}
+	if len(doc.Deprecations) != 1 {
+		t.Fatalf("deprecations = %+v, want one entry", doc.Deprecations)
+	}
+	d := doc.Deprecations[0]
+	if d.Name != "health_v1" || !d.PastSunset || !d.Enforced || d.Migration == "" {
+		t.Errorf("capabilities row = %+v", d)
+	}
+}
+
+func TestDeprecationsFromEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want int
+	}{
+		{"unset", "", 0},
+		{"valid", `[{"name":"health_v1","sunset":"2027-01-01T00:00:00Z"}]`, 1},
+		{"two entries", `[{"name":"a"},{"name":"b"}]`, 2},
+		{"garbage ignored", `{not json]`, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DEPRECATIONS", tt.env)
+			if got := DeprecationsFromEnv(); len(got) != tt.want {
+				t.Errorf("DeprecationsFromEnv() = %+v, want %d entries", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSunsetEnforcementFromEnv(t *testing.T) {
+	tests := []struct {
+		env  string
+		want bool
+	}{
+		{"", false},
+		{"1", true},
+		{"true", true},
+		{"on", true},
+		{"0", false},
+		{"off", false},
+		{"maybe", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("DEPRECATION_ENFORCE_SUNSET", tt.env)
+		if got := SunsetEnforcementFromEnv(); got != tt.want {
+			t.Errorf("SunsetEnforcementFromEnv() with %q = %v, want %v", tt.env, got, tt.want)
+		}
+	}
+}
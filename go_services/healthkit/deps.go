@@ -0,0 +1,112 @@
+package healthkit
+
+// Service dependency declarations and cascade-aware status. When the database
+// goes down, "bot" and "gemini_cache" honestly report unhealthy too — and the
+// status page becomes a wall of red that hides which failure is the root
+// cause. A service may declare depends_on alongside its status report; with
+// declarations present, /health classifies each unhealthy service as "failed"
+// (no unhealthy dependency — a root cause) or "impacted" (a declared
+// dependency is down too, so its own red is probably collateral), and lists
+// the root causes separately so the operator starts at the right box.
+//
+// The graph must stay acyclic: a cycle would make every member of it
+// "impacted" by the others and no root cause would ever surface. Cycles are
+// therefore rejected at declaration time with a 400, including the trivial
+// self-dependency. Declarations are independent of status reports — a service
+// may declare a dependency on a name that has not reported yet; an unreported
+// dependency is simply not unhealthy, so it never excuses a failure.
+
+import "sort"
+
+// depReasonCycle is the stable rejection reason when a declaration would
+// close a dependency cycle (same contract as the push reason* constants).
+const depReasonCycle = "dependency_cycle"
+
+// Service-state classifications shown in /health's service_states map.
+const (
+	serviceStateOK       = "ok"
+	serviceStateFailed   = "failed"   // unhealthy with every dependency healthy
+	serviceStateImpacted = "impacted" // unhealthy with an unhealthy dependency
+)
+
+// SetServiceDependencies declares (or, with an empty non-nil list, clears)
+// a service's dependencies. Returns "" on success or a stable reason:
+// invalid_name for out-of-bounds names, dependency_cycle when the new edges
+// would close a cycle. Rejected declarations leave the graph untouched.
+func (h *Service) SetServiceDependencies(name string, deps []string) string {
+	// Same name bounds as status reports — dependency edges must not be a
+	// back door for unbounded map growth.
+	if len(name) == 0 || len(name) > 100 {
+		return heartbeatReasonInvalidName
+	}
+	for _, d := range deps {
+		if len(d) == 0 || len(d) > 100 {
+			return heartbeatReasonInvalidName
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(deps) == 0 {
+		delete(h.deps, name)
+		return ""
+	}
+	if h.depCycleLocked(name, deps) {
+		return depReasonCycle
+	}
+	h.deps[name] = append([]string(nil), deps...)
+	return ""
+}
+
+// depCycleLocked reports whether adding name -> deps edges would close a
+// cycle: a cycle exists exactly when name is reachable from one of its
+// proposed dependencies through the existing graph. Caller holds mu.
+func (h *Service) depCycleLocked(name string, deps []string) bool {
+	seen := make(map[string]bool)
+	stack := append([]string(nil), deps...)
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n == name {
+			return true
+		}
+		if seen[n] {
+			continue
+		}
+		seen[n] = true
+		stack = append(stack, h.deps[n]...)
+	}
+	return false
+}
+
+// classifyServicesLocked computes the per-service state map and the sorted
+// root-cause list from the current reported states. Returns nils when no
+// dependencies are declared, so deployments that never declare any keep the
+// historical /health key set. Caller holds mu (read or write).
+func (h *Service) classifyServicesLocked(services map[string]bool) (map[string]string, []string) {
+	if len(h.deps) == 0 {
+		return nil, nil
+	}
+	states := make(map[string]string, len(services))
+	var rootCauses []string
+	for name, healthy := range services {
+		if healthy {
+			states[name] = serviceStateOK
+			continue
+		}
+		impacted := false
+		for _, dep := range h.deps[name] {
+			if up, reported := services[dep]; reported && !up {
+				impacted = true
+				break
+			}
+		}
+		if impacted {
+			states[name] = serviceStateImpacted
+		} else {
+			states[name] = serviceStateFailed
+			rootCauses = append(rootCauses, name)
+		}
+	}
+	sort.Strings(rootCauses) // deterministic order for clients and tests
+	return states, rootCauses
+}
@@ -0,0 +1,152 @@
+package healthkit
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// reportService posts one status report with optional depends_on JSON.
+func reportService(t *testing.T, r http.Handler, token, body string) int {
+	t.Helper()
+	return doReq(t, r, http.MethodPost, "/health/service", token, body).Code
+}
+
+func TestDependencyChainMarksRootCause(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+
+	// bot -> gemini_cache -> database: only the database is a root cause
+	// when the whole chain is red.
+	if code := reportService(t, r, "tok", `{"name":"database","healthy":true}`); code != http.StatusOK {
+		t.Fatalf("database report = %d, want 200", code)
+	}
+	if code := reportService(t, r, "tok", `{"name":"gemini_cache","healthy":true,"depends_on":["database"]}`); code != http.StatusOK {
+		t.Fatalf("gemini_cache report = %d, want 200", code)
+	}
+	if code := reportService(t, r, "tok", `{"name":"bot","healthy":true,"depends_on":["gemini_cache"]}`); code != http.StatusOK {
+		t.Fatalf("bot report = %d, want 200", code)
+	}
+
+	hs.SetServiceStatus("database", false)
+	hs.SetServiceStatus("gemini_cache", false)
+	hs.SetServiceStatus("bot", false)
+
+	status := hs.GetStatus()
+	if !reflect.DeepEqual(status.RootCauses, []string{"database"}) {
+		t.Errorf("root_causes = %v, want [database]", status.RootCauses)
+	}
+	want := map[string]string{
+		"database":     serviceStateFailed,
+		"gemini_cache": serviceStateImpacted,
+		"bot":          serviceStateImpacted,
+	}
+	if !reflect.DeepEqual(status.ServiceStates, want) {
+		t.Errorf("service_states = %v, want %v", status.ServiceStates, want)
+	}
+}
+
+func TestDependencyDiamond(t *testing.T) {
+	hs := New(WithVersion("test"))
+	// top -> {left, right} -> base.
+	for name, deps := range map[string][]string{
+		"top":   {"left", "right"},
+		"left":  {"base"},
+		"right": {"base"},
+	} {
+		if reason := hs.SetServiceDependencies(name, deps); reason != "" {
+			t.Fatalf("declare %s: %s", name, reason)
+		}
+	}
+	for _, name := range []string{"base", "left", "right", "top"} {
+		hs.SetServiceStatus(name, true)
+	}
+
+	// The whole diamond goes red: only the base surfaces.
+	for _, name := range []string{"base", "left", "right", "top"} {
+		hs.SetServiceStatus(name, false)
+	}
+	status := hs.GetStatus()
+	if !reflect.DeepEqual(status.RootCauses, []string{"base"}) {
+		t.Errorf("root_causes = %v, want [base]", status.RootCauses)
+	}
+
+	// Base recovers but left stays down: left becomes the root cause, top
+	// stays impacted through it, right is healthy again.
+	hs.SetServiceStatus("base", true)
+	hs.SetServiceStatus("right", true)
+	status = hs.GetStatus()
+	if !reflect.DeepEqual(status.RootCauses, []string{"left"}) {
+		t.Errorf("root_causes = %v, want [left]", status.RootCauses)
+	}
+	want := map[string]string{
+		"base":  serviceStateOK,
+		"left":  serviceStateFailed,
+		"right": serviceStateOK,
+		"top":   serviceStateImpacted,
+	}
+	if !reflect.DeepEqual(status.ServiceStates, want) {
+		t.Errorf("service_states = %v, want %v", status.ServiceStates, want)
+	}
+}
+
+func TestDependencyCycleRejected(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+
+	if code := reportService(t, r, "tok", `{"name":"a","healthy":true,"depends_on":["b"]}`); code != http.StatusOK {
+		t.Fatalf("a -> b = %d, want 200", code)
+	}
+	if code := reportService(t, r, "tok", `{"name":"b","healthy":true,"depends_on":["c"]}`); code != http.StatusOK {
+		t.Fatalf("b -> c = %d, want 200", code)
+	}
+	rec := doReq(t, r, http.MethodPost, "/health/service", "tok",
+		`{"name":"c","healthy":true,"depends_on":["a"]}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("c -> a = %d, want 400 for the a->b->c->a cycle", rec.Code)
+	}
+	if got := rec.Body.String(); !strings.Contains(got, depReasonCycle) {
+		t.Errorf("body = %s, want reason %s", got, depReasonCycle)
+	}
+	// The rejected report must not have landed at all.
+	if _, ok := hs.GetStatus().Services["c"]; ok {
+		t.Error("c registered despite the cycle rejection")
+	}
+
+	// Self-dependency is the trivial cycle.
+	if reason := hs.SetServiceDependencies("d", []string{"d"}); reason != depReasonCycle {
+		t.Errorf("self-dependency reason = %q, want %s", reason, depReasonCycle)
+	}
+}
+
+func TestDependencyDeclarationLifecycle(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+
+	// No declarations: the classification keys stay absent.
+	hs.SetServiceStatus("database", false)
+	status := hs.GetStatus()
+	if status.ServiceStates != nil || status.RootCauses != nil {
+		t.Errorf("states/root_causes = %v/%v, want absent without declarations", status.ServiceStates, status.RootCauses)
+	}
+
+	// An unreported dependency never excuses a failure: bot depends on a
+	// name that has not reported, so bot itself is the root cause.
+	if code := reportService(t, r, "tok", `{"name":"bot","healthy":false,"depends_on":["never_reported"]}`); code != http.StatusOK {
+		t.Fatalf("bot report = %d, want 200", code)
+	}
+	status = hs.GetStatus()
+	if !reflect.DeepEqual(status.RootCauses, []string{"bot", "database"}) {
+		t.Errorf("root_causes = %v, want [bot database]", status.RootCauses)
+	}
+
+	// depends_on: [] clears the declaration; once none remain the keys
+	// disappear again.
+	if code := reportService(t, r, "tok", `{"name":"bot","healthy":true,"depends_on":[]}`); code != http.StatusOK {
+		t.Fatalf("clearing report = %d, want 200", code)
+	}
+	if status = hs.GetStatus(); status.ServiceStates != nil {
+		t.Errorf("service_states = %v, want absent after clearing", status.ServiceStates)
+	}
+}
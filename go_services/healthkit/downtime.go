@@ -0,0 +1,266 @@
+package healthkit
+
+// Scheduled downtime windows. The nightly 03:00 UTC Postgres restart for
+// backups is planned, but /health still went degraded and paged the on-call
+// for it every single night. POST /admin/downtime declares a window
+// {service, start, end, recurrence: daily|weekly|null}; while a window is
+// active, that service's unhealthy state is reported with suppressed:true
+// and is ignored by the aggregate status and readiness. The truth is never
+// hidden — the services map still shows false, incidents still open, SLA
+// still accrues — only the paging signal is silenced, and only for the
+// declared slot. Windows are listable (GET), deletable (DELETE /{id}), and
+// expired one-shots are pruned. All times are UTC; recurrence repeats the
+// start..end slot every 24h/168h from the declared start.
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxDowntimeWindows caps the store — the endpoint is authenticated, but a
+// scripted loop should hit a wall, not unbounded memory.
+const maxDowntimeWindows = 100
+
+// Stable rejection reasons for downtime declarations, same contract as the
+// push reasons.
+const (
+	downtimeReasonInvalidWindow  = "invalid_window"
+	downtimeReasonBadRecurrence  = "unknown_recurrence"
+	downtimeReasonTooManyWindows = "too_many_windows"
+)
+
+// DowntimeWindow is one declared window — the POST payload (minus ID) and
+// the GET /admin/downtime row.
+type DowntimeWindow struct {
+	ID      string `json:"id"`
+	Service string `json:"service"`
+	// Start/End are RFC3339; for recurring windows they fix the first
+	// occurrence and the slot's time-of-day/day-of-week.
+	Start      string `json:"start"`
+	End        string `json:"end"`
+	Recurrence string `json:"recurrence,omitempty"` // "", "daily" or "weekly"
+}
+
+// downtimeWindow is the stored, parsed form.
+type downtimeWindow struct {
+	id         string
+	service    string
+	start, end time.Time
+	recurrence string
+}
+
+func (w *downtimeWindow) render() DowntimeWindow {
+	return DowntimeWindow{
+		ID:         w.id,
+		Service:    w.service,
+		Start:      formatTimestamp(w.start),
+		End:        formatTimestamp(w.end),
+		Recurrence: w.recurrence,
+	}
+}
+
+// period returns the recurrence interval, or 0 for a one-shot.
+func (w *downtimeWindow) period() time.Duration {
+	switch w.recurrence {
+	case "daily":
+		return 24 * time.Hour
+	case "weekly":
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+// activeAt reports whether the window covers now. Recurrence is evaluated by
+// phase within the period, anchored at the declared start — all in UTC, so a
+// "daily 03:00–03:20" slot means the same wall-clock slot every day
+// regardless of where the operator declared it from.
+func (w *downtimeWindow) activeAt(now time.Time) bool {
+	if now.Before(w.start) {
+		return false
+	}
+	p := w.period()
+	if p == 0 {
+		return now.Before(w.end)
+	}
+	phase := now.Sub(w.start) % p
+	return phase < w.end.Sub(w.start)
+}
+
+// expired reports whether the window can never be active again (one-shots
+// past their end; recurring windows never expire).
+func (w *downtimeWindow) expired(now time.Time) bool {
+	return w.period() == 0 && !now.Before(w.end)
+}
+
+// downtimeStore holds the declared windows under its own lock: writes come
+// from the admin handlers, reads from every status evaluation.
+type downtimeStore struct {
+	mu    sync.Mutex
+	seq   int
+	items []*downtimeWindow
+}
+
+// pruneLocked drops expired one-shots.
+func (s *downtimeStore) pruneLocked(now time.Time) {
+	kept := s.items[:0]
+	for _, w := range s.items {
+		if !w.expired(now) {
+			kept = append(kept, w)
+		}
+	}
+	s.items = kept
+}
+
+// add validates and stores one window, returning it or a stable reason.
+func (s *downtimeStore) add(payload DowntimeWindow, now time.Time) (DowntimeWindow, string) {
+	if len(payload.Service) == 0 || len(payload.Service) > 100 {
+		return DowntimeWindow{}, heartbeatReasonInvalidName
+	}
+	start, err := time.Parse(time.RFC3339, payload.Start)
+	if err != nil {
+		return DowntimeWindow{}, downtimeReasonInvalidWindow
+	}
+	end, err := time.Parse(time.RFC3339, payload.End)
+	if err != nil || !end.After(start) {
+		return DowntimeWindow{}, downtimeReasonInvalidWindow
+	}
+	w := &downtimeWindow{
+		service:    payload.Service,
+		start:      start.UTC(),
+		end:        end.UTC(),
+		recurrence: payload.Recurrence,
+	}
+	switch payload.Recurrence {
+	case "":
+		// One-shot: declaring a window already over is a client bug.
+		if w.expired(now) {
+			return DowntimeWindow{}, downtimeReasonInvalidWindow
+		}
+	case "daily", "weekly":
+		// The slot must fit inside its period or it would cover everything.
+		if end.Sub(start) >= w.period() {
+			return DowntimeWindow{}, downtimeReasonInvalidWindow
+		}
+	default:
+		return DowntimeWindow{}, downtimeReasonBadRecurrence
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(now)
+	if len(s.items) >= maxDowntimeWindows {
+		return DowntimeWindow{}, downtimeReasonTooManyWindows
+	}
+	s.seq++
+	w.id = "dt-" + strconv.Itoa(s.seq)
+	s.items = append(s.items, w)
+	return w.render(), ""
+}
+
+// remove deletes a window by ID, reporting whether it existed.
+func (s *downtimeStore) remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, w := range s.items {
+		if w.id == id {
+			s.items = append(s.items[:i], s.items[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// list renders every live window, oldest declaration first.
+func (s *downtimeStore) list(now time.Time) []DowntimeWindow {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(now)
+	out := make([]DowntimeWindow, 0, len(s.items))
+	for _, w := range s.items {
+		out = append(out, w.render())
+	}
+	return out
+}
+
+// activeFor reports whether any window covers service at now.
+func (s *downtimeStore) activeFor(service string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.items {
+		if w.service == service && w.activeAt(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// downtimeView splits the unhealthy services into suppressed (covered by an
+// active window, sorted) and reports whether any unhealthy service is NOT
+// covered — the bit that decides whether the aggregate still degrades.
+func (h *Service) downtimeView(services map[string]bool, now time.Time) (suppressed []string, unsuppressedDown bool) {
+	for name, healthy := range services {
+		if healthy {
+			continue
+		}
+		if h.downtime.activeFor(name, now) {
+			suppressed = append(suppressed, name)
+		} else {
+			unsuppressedDown = true
+		}
+	}
+	sort.Strings(suppressed)
+	return suppressed, unsuppressedDown
+}
+
+// handleDowntimePost serves POST /admin/downtime.
+func (h *Service) handleDowntimePost(w http.ResponseWriter, r *http.Request) {
+	body, err := requestBody(w, r, 1<<16) // 64KB
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, err.Error(), nil)
+		return
+	}
+	var payload DowntimeWindow
+	if err := json.NewDecoder(body).Decode(&payload); err != nil {
+		h.decodeBodyError(w, r, err)
+		return
+	}
+	window, reason := h.downtime.add(payload, h.clock.Now())
+	if reason != "" {
+		code := http.StatusBadRequest
+		if reason == downtimeReasonTooManyWindows {
+			code = http.StatusConflict
+		}
+		writeError(w, code, reason, "downtime window rejected", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(window); err != nil {
+		log.Printf("Failed to encode downtime window: %v", err)
+	}
+}
+
+// handleDowntimeList serves GET /admin/downtime.
+func (h *Service) handleDowntimeList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"windows": h.downtime.list(h.clock.Now()),
+	}); err != nil {
+		log.Printf("Failed to encode downtime windows: %v", err)
+	}
+}
+
+// handleDowntimeDelete serves DELETE /admin/downtime/{id}.
+func (h *Service) handleDowntimeDelete(w http.ResponseWriter, r *http.Request) {
+	if !h.downtime.remove(chi.URLParam(r, "id")) {
+		writeError(w, http.StatusNotFound, errCodeNotFound, "downtime window not found", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
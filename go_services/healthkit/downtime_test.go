@@ -0,0 +1,239 @@
+package healthkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// declareDowntime posts one window and returns its ID.
+func declareDowntime(t *testing.T, r http.Handler, token, body string) string {
+	t.Helper()
+	rec := doReq(t, r, http.MethodPost, "/admin/downtime", token, body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("declare = %d, want 201; body %s", rec.Code, rec.Body.String())
+	}
+	var window DowntimeWindow
+	if err := json.Unmarshal(rec.Body.Bytes(), &window); err != nil || window.ID == "" {
+		t.Fatalf("declare body %s: %v", rec.Body.String(), err)
+	}
+	return window.ID
+}
+
+func TestDowntimeSuppressesDegraded(t *testing.T) {
+	base := time.Date(2026, 8, 1, 3, 0, 0, 0, time.UTC)
+	clk := newFakeClock(base)
+	hs := New(WithVersion("test"), WithClock(clk))
+	r := buildRouter(hs, "tok")
+	hs.SetServiceStatus("bot", true)
+	hs.SetServiceStatus("database", true)
+
+	declareDowntime(t, r, "tok", fmt.Sprintf(`{"service":"database","start":%q,"end":%q}`,
+		base.Format(time.RFC3339), base.Add(20*time.Minute).Format(time.RFC3339)))
+
+	// Inside the window: the raw state stays visible, the aggregate doesn't.
+	hs.SetServiceStatus("database", false)
+	status := hs.GetStatus()
+	if status.Status != "healthy" {
+		t.Errorf("status inside window = %q, want healthy", status.Status)
+	}
+	if status.Services["database"] {
+		t.Error("Services[database] = true, want the raw false preserved")
+	}
+	if len(status.SuppressedServices) != 1 || status.SuppressedServices[0] != "database" {
+		t.Errorf("suppressed = %v, want [database]", status.SuppressedServices)
+	}
+	report := hs.GetReadinessReport()
+	if !report.Ready || len(report.Reasons) != 0 {
+		t.Errorf("readiness = %v %v, want ready with no reasons", report.Ready, report.Reasons)
+	}
+
+	// Past the window: ordinary degradation again.
+	clk.Advance(21 * time.Minute)
+	status = hs.GetStatus()
+	if status.Status != "degraded" || len(status.SuppressedServices) != 0 {
+		t.Errorf("status past window = %q (suppressed %v), want degraded with none", status.Status, status.SuppressedServices)
+	}
+	if report := hs.GetReadinessReport(); report.Ready {
+		t.Error("readiness past window = ready, want not ready")
+	}
+}
+
+func TestDowntimeOnlyCoversItsService(t *testing.T) {
+	base := time.Date(2026, 8, 1, 3, 0, 0, 0, time.UTC)
+	clk := newFakeClock(base)
+	hs := New(WithVersion("test"), WithClock(clk))
+	r := buildRouter(hs, "tok")
+
+	declareDowntime(t, r, "tok", fmt.Sprintf(`{"service":"database","start":%q,"end":%q}`,
+		base.Format(time.RFC3339), base.Add(time.Hour).Format(time.RFC3339)))
+	hs.SetServiceStatus("database", false)
+	hs.SetServiceStatus("gemini", false)
+
+	// An uncovered unhealthy service still degrades; the covered one is
+	// suppressed alongside it.
+	status := hs.GetStatus()
+	if status.Status != "degraded" {
+		t.Errorf("status = %q, want degraded — gemini has no window", status.Status)
+	}
+	if len(status.SuppressedServices) != 1 || status.SuppressedServices[0] != "database" {
+		t.Errorf("suppressed = %v, want [database]", status.SuppressedServices)
+	}
+	report := hs.GetReadinessReport()
+	if len(report.Reasons) != 1 || report.Reasons[0] != "service_unhealthy:gemini" {
+		t.Errorf("reasons = %v, want only gemini", report.Reasons)
+	}
+}
+
+func TestDowntimeRecurrence(t *testing.T) {
+	// Daily 03:00–03:20 UTC, declared a week earlier.
+	start := time.Date(2026, 7, 25, 3, 0, 0, 0, time.UTC)
+	w := &downtimeWindow{
+		service: "database", start: start, end: start.Add(20 * time.Minute), recurrence: "daily",
+	}
+	tests := []struct {
+		name string
+		at   time.Time
+		want bool
+	}{
+		{"first occurrence", start.Add(time.Minute), true},
+		{"before declaration", start.Add(-time.Hour), false},
+		{"next day inside", time.Date(2026, 8, 1, 3, 10, 0, 0, time.UTC), true},
+		{"next day just past", time.Date(2026, 8, 1, 3, 20, 0, 0, time.UTC), false},
+		{"same day outside", time.Date(2026, 8, 1, 15, 10, 0, 0, time.UTC), false},
+		{"months later", time.Date(2026, 12, 24, 3, 5, 0, 0, time.UTC), true},
+	}
+	for _, tt := range tests {
+		t.Run("daily "+tt.name, func(t *testing.T) {
+			if got := w.activeAt(tt.at); got != tt.want {
+				t.Errorf("activeAt(%s) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+
+	weekly := &downtimeWindow{
+		service: "database", start: start, end: start.Add(2 * time.Hour), recurrence: "weekly",
+	}
+	if !weekly.activeAt(start.AddDate(0, 0, 14).Add(time.Hour)) {
+		t.Error("weekly window inactive two weeks later at the same slot")
+	}
+	if weekly.activeAt(start.AddDate(0, 0, 15).Add(time.Hour)) {
+		t.Error("weekly window active on the wrong weekday")
+	}
+}
+
+func TestDowntimeOverlappingWindows(t *testing.T) {
+	base := time.Date(2026, 8, 1, 3, 0, 0, 0, time.UTC)
+	clk := newFakeClock(base)
+	hs := New(WithVersion("test"), WithClock(clk))
+	r := buildRouter(hs, "tok")
+	hs.SetServiceStatus("database", false)
+
+	// Two overlapping one-shots: suppression holds until BOTH have ended.
+	declareDowntime(t, r, "tok", fmt.Sprintf(`{"service":"database","start":%q,"end":%q}`,
+		base.Format(time.RFC3339), base.Add(10*time.Minute).Format(time.RFC3339)))
+	declareDowntime(t, r, "tok", fmt.Sprintf(`{"service":"database","start":%q,"end":%q}`,
+		base.Add(5*time.Minute).Format(time.RFC3339), base.Add(30*time.Minute).Format(time.RFC3339)))
+
+	clk.Advance(7 * time.Minute) // inside both
+	if got := hs.AggregateStatus(); got != "healthy" {
+		t.Errorf("status inside both = %q, want healthy", got)
+	}
+	clk.Advance(13 * time.Minute) // first ended, second active
+	if got := hs.AggregateStatus(); got != "healthy" {
+		t.Errorf("status inside second only = %q, want healthy", got)
+	}
+	clk.Advance(15 * time.Minute) // both over
+	if got := hs.AggregateStatus(); got != "degraded" {
+		t.Errorf("status past both = %q, want degraded", got)
+	}
+}
+
+func TestDowntimeListDeleteAndPrune(t *testing.T) {
+	base := time.Date(2026, 8, 1, 3, 0, 0, 0, time.UTC)
+	clk := newFakeClock(base)
+	hs := New(WithVersion("test"), WithClock(clk))
+	r := buildRouter(hs, "tok")
+
+	oneShot := declareDowntime(t, r, "tok", fmt.Sprintf(`{"service":"database","start":%q,"end":%q}`,
+		base.Format(time.RFC3339), base.Add(10*time.Minute).Format(time.RFC3339)))
+	recurring := declareDowntime(t, r, "tok", fmt.Sprintf(`{"service":"gemini","start":%q,"end":%q,"recurrence":"daily"}`,
+		base.Format(time.RFC3339), base.Add(10*time.Minute).Format(time.RFC3339)))
+
+	list := func(t *testing.T) []DowntimeWindow {
+		t.Helper()
+		rec := doReq(t, r, http.MethodGet, "/admin/downtime", "tok", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("list = %d, want 200", rec.Code)
+		}
+		var resp struct {
+			Windows []DowntimeWindow `json:"windows"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode list: %v", err)
+		}
+		return resp.Windows
+	}
+	if got := list(t); len(got) != 2 {
+		t.Fatalf("windows = %d, want 2", len(got))
+	}
+
+	// An expired one-shot is pruned; the recurring window never is.
+	clk.Advance(time.Hour)
+	got := list(t)
+	if len(got) != 1 || got[0].ID != recurring {
+		t.Errorf("windows after expiry = %v, want only %s", got, recurring)
+	}
+
+	// Deleting the pruned window is a 404; deleting the live one works.
+	if rec := doReq(t, r, http.MethodDelete, "/admin/downtime/"+oneShot, "tok", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("delete pruned = %d, want 404", rec.Code)
+	}
+	if rec := doReq(t, r, http.MethodDelete, "/admin/downtime/"+recurring, "tok", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("delete = %d, want 204", rec.Code)
+	}
+	if got := list(t); len(got) != 0 {
+		t.Errorf("windows after delete = %v, want none", got)
+	}
+}
+
+func TestDowntimeValidation(t *testing.T) {
+	base := time.Date(2026, 8, 1, 3, 0, 0, 0, time.UTC)
+	clk := newFakeClock(base)
+	hs := New(WithVersion("test"), WithClock(clk))
+	r := buildRouter(hs, "tok")
+
+	start := base.Format(time.RFC3339)
+	end := base.Add(time.Hour).Format(time.RFC3339)
+	tests := []struct {
+		name, body, wantCode string
+	}{
+		{"empty service", fmt.Sprintf(`{"service":"","start":%q,"end":%q}`, start, end), heartbeatReasonInvalidName},
+		{"bad start", fmt.Sprintf(`{"service":"database","start":"tonight","end":%q}`, end), downtimeReasonInvalidWindow},
+		{"end before start", fmt.Sprintf(`{"service":"database","start":%q,"end":%q}`, end, start), downtimeReasonInvalidWindow},
+		{"already over", fmt.Sprintf(`{"service":"database","start":%q,"end":%q}`,
+			base.Add(-2*time.Hour).Format(time.RFC3339), base.Add(-time.Hour).Format(time.RFC3339)), downtimeReasonInvalidWindow},
+		{"bad recurrence", fmt.Sprintf(`{"service":"database","start":%q,"end":%q,"recurrence":"hourly"}`, start, end), downtimeReasonBadRecurrence},
+		{"slot swallows period", fmt.Sprintf(`{"service":"database","start":%q,"end":%q,"recurrence":"daily"}`,
+			start, base.Add(25*time.Hour).Format(time.RFC3339)), downtimeReasonInvalidWindow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doReq(t, r, http.MethodPost, "/admin/downtime", "tok", tt.body)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("declare = %d, want 400", rec.Code)
+			}
+			if env := decodeErrorEnvelope(t, rec); env.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", env.Code, tt.wantCode)
+			}
+		})
+	}
+
+	// Writes are auth-gated like every admin surface.
+	if rec := doReq(t, r, http.MethodPost, "/admin/downtime", "",
+		fmt.Sprintf(`{"service":"database","start":%q,"end":%q}`, start, end)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated declare = %d, want 401", rec.Code)
+	}
+}
@@ -0,0 +1,357 @@
+package healthkit
+
+// Dynamic metric registration. allowedMetricNames' hardcoded switch means
+// every new Python-side metric needs a Go change and a redeploy; this file
+// lets an operator declare new pushable metrics at runtime instead.
+// POST /metrics/register (auth-protected, same write gauntlet as the pushes)
+// takes {name, type, help, labels[]}, validates it strictly, registers the
+// collector, and appends the schema to a JSON file so the registration
+// survives restarts — New() replays the file before the first scrape.
+// /metrics/push and /metrics/batch then route names that aren't built in
+// through the dynamic collectors, with the same value/op validation the
+// built-ins get.
+//
+// Validation is deliberately strict — these inputs become collector names and
+// label dimensions in the registry: snake_case names (the summary_set regex),
+// at most maxDynLabels label keys from the same safe charset, bounded help
+// text. Re-registering an IDENTICAL schema is idempotent (the Python agent
+// can declare on every startup); the same name with a DIFFERENT schema is a
+// 409 — silently morphing a live collector would corrupt every dashboard
+// reading it.
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// maxDynLabels caps the label dimensions one dynamic metric may declare.
+	maxDynLabels = 5
+	// maxDynHelpRunes caps the help text carried into the registry.
+	maxDynHelpRunes = 200
+	// maxDynMetrics caps how many dynamic metrics may exist at once — the
+	// registration endpoint is authenticated, but a runaway re-registration
+	// loop with generated names should hit a wall, not the registry.
+	maxDynMetrics = 100
+)
+
+// Stable rejection reasons for the registration endpoint, same contract as
+// the push reasons.
+const (
+	reasonSchemaConflict      = "schema_conflict"
+	reasonInvalidLabel        = "invalid_label"
+	reasonInvalidType         = "invalid_type"
+	reasonInvalidHelp         = "invalid_help"
+	reasonTooManyMetrics      = "too_many_metrics"
+	reasonReservedName        = "reserved_name"
+	reasonTooManySchemaLabels = "too_many_labels"
+)
+
+// dynLabelRE bounds declared label names: lowercase snake_case, max 32 chars.
+var dynLabelRE = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// MetricSchema is one dynamic metric declaration — the /metrics/register
+// payload and the schema-file entry.
+type MetricSchema struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"` // counter | gauge | histogram
+	Help   string   `json:"help"`
+	Labels []string `json:"labels,omitempty"`
+}
+
+// validate normalizes the schema in place and returns "" or a stable reason.
+func (s *MetricSchema) validate() string {
+	s.Name = strings.TrimSpace(s.Name)
+	// Same regex that gates summary_set names — one contract for every
+	// dynamically minted collector name.
+	if !summaryNameRE.MatchString(s.Name) {
+		return reasonInvalidName
+	}
+	if allowedMetricNames[s.Name] {
+		// The built-ins keep their hardcoded handling; shadowing one would
+		// silently change its validation rules.
+		return reasonReservedName
+	}
+	switch s.Type {
+	case "counter", "gauge", "histogram":
+	default:
+		return reasonInvalidType
+	}
+	s.Help = strings.TrimSpace(s.Help)
+	if s.Help == "" || len([]rune(s.Help)) > maxDynHelpRunes {
+		return reasonInvalidHelp
+	}
+	for _, r := range s.Help {
+		if unicode.IsControl(r) {
+			return reasonInvalidHelp
+		}
+	}
+	if len(s.Labels) > maxDynLabels {
+		return reasonTooManySchemaLabels
+	}
+	seen := make(map[string]bool, len(s.Labels))
+	for i, label := range s.Labels {
+		label = strings.TrimSpace(label)
+		if !dynLabelRE.MatchString(label) || seen[label] {
+			return reasonInvalidLabel
+		}
+		seen[label] = true
+		s.Labels[i] = label
+	}
+	sort.Strings(s.Labels) // canonical order for conflict comparison
+	return ""
+}
+
+// dynMetric is one registered dynamic metric: its schema and the collector
+// (exactly one of the vecs is non-nil, per the schema type).
+type dynMetric struct {
+	schema    MetricSchema
+	counter   *prometheus.CounterVec
+	gauge     *prometheus.GaugeVec
+	histogram *prometheus.HistogramVec
+}
+
+// dynStore holds the dynamic registry; its own lock, touched on the
+// registration path and (read-mostly) per push.
+type dynStore struct {
+	mu      sync.RWMutex
+	metrics map[string]*dynMetric
+}
+
+// WithMetricSchemaPath sets the JSON file registrations persist to (and are
+// replayed from at construction). Empty disables persistence.
+func WithMetricSchemaPath(path string) Option {
+	return func(h *Service) { h.dynPath = path }
+}
+
+// metricSchemaPathFromEnv reads METRIC_SCHEMA_PATH; empty disables the file.
+func metricSchemaPathFromEnv() string {
+	return strings.TrimSpace(os.Getenv("METRIC_SCHEMA_PATH"))
+}
+
+// registerDynMetric validates and registers one schema. The bool reports
+// whether a NEW registration happened (false for the idempotent-duplicate
+// case); a non-"" reason means rejection.
+func (h *Service) registerDynMetric(schema MetricSchema) (bool, string) {
+	if reason := schema.validate(); reason != "" {
+		return false, reason
+	}
+	h.dyn.mu.Lock()
+	defer h.dyn.mu.Unlock()
+	if existing, ok := h.dyn.metrics[schema.Name]; ok {
+		if reflect.DeepEqual(existing.schema, schema) {
+			return false, "" // idempotent re-declaration
+		}
+		return false, reasonSchemaConflict
+	}
+	if len(h.dyn.metrics) >= maxDynMetrics {
+		return false, reasonTooManyMetrics
+	}
+
+	dm := &dynMetric{schema: schema}
+	var collector prometheus.Collector
+	switch schema.Type {
+	case "counter":
+		dm.counter = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "discord_bot_" + schema.Name + "_total",
+			Help: schema.Help,
+		}, schema.Labels)
+		collector = dm.counter
+	case "gauge":
+		dm.gauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "discord_bot_" + schema.Name,
+			Help: schema.Help,
+		}, schema.Labels)
+		collector = dm.gauge
+	case "histogram":
+		dm.histogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "discord_bot_" + schema.Name,
+			Help:    schema.Help,
+			Buckets: prometheus.DefBuckets,
+		}, schema.Labels)
+		collector = dm.histogram
+	}
+	// Manual registration like getSummaryGauge: a collision with an existing
+	// registry name must surface as an error, not a promauto panic.
+	if err := h.registerer.Register(collector); err != nil {
+		return false, reasonNameCollision
+	}
+	h.dyn.metrics[schema.Name] = dm
+	return true, ""
+}
+
+// dynLabelValues builds the label values for one push in schema order.
+// Values are free-form (the schema declares keys, not value sets) but pass
+// through the usual length cap and a control-character strip.
+func dynLabelValues(schema MetricSchema, labels map[string]string) []string {
+	values := make([]string, len(schema.Labels))
+	for i, key := range schema.Labels {
+		var b strings.Builder
+		for _, r := range labels[key] {
+			if !unicode.IsControl(r) {
+				b.WriteRune(r)
+			}
+		}
+		values[i] = sanitizeLabel(b.String())
+	}
+	return values
+}
+
+// applyDynMetric routes one push whose name isn't built in. The bool reports
+// whether a dynamic metric claimed the name; when true the string is the
+// usual ""-or-reason result.
+func (h *Service) applyDynMetric(p MetricsPayload) (bool, string) {
+	h.dyn.mu.RLock()
+	dm, ok := h.dyn.metrics[p.Name]
+	h.dyn.mu.RUnlock()
+	if !ok {
+		return false, ""
+	}
+	if p.Type != dm.schema.Type {
+		return true, reasonNameTypeMismatch
+	}
+	// Absolute-counter tracking (monotonic.go) only covers the built-in
+	// counters; rejecting the mode here beats silently double-counting.
+	if p.Mode != "" {
+		return true, reasonUnsupportedMode
+	}
+	if math.IsNaN(p.Value) || math.IsInf(p.Value, 0) {
+		return true, reasonNonFiniteValue
+	}
+	values := dynLabelValues(dm.schema, p.Labels)
+	switch dm.schema.Type {
+	case "counter":
+		if p.Op != "" {
+			return true, reasonUnsupportedOp
+		}
+		if p.Value < 0 {
+			return true, reasonNegativeCounter
+		}
+		dm.counter.WithLabelValues(values...).Add(p.Value)
+	case "gauge":
+		switch p.Op {
+		case "", "set":
+			dm.gauge.WithLabelValues(values...).Set(p.Value)
+		case "inc":
+			dm.gauge.WithLabelValues(values...).Add(p.Value)
+		case "dec":
+			dm.gauge.WithLabelValues(values...).Sub(p.Value)
+		default:
+			return true, reasonUnknownOp
+		}
+	case "histogram":
+		if p.Op != "" {
+			return true, reasonUnsupportedOp
+		}
+		if p.Value < 0 {
+			return true, reasonNegativeValue
+		}
+		dm.histogram.WithLabelValues(values...).Observe(p.Value)
+	}
+	return true, ""
+}
+
+// saveDynSchemas persists the registered schemas, write-then-rename like the
+// rollup snapshot. No-op without a configured path.
+func (h *Service) saveDynSchemas() error {
+	if h.dynPath == "" {
+		return nil
+	}
+	h.dyn.mu.RLock()
+	schemas := make([]MetricSchema, 0, len(h.dyn.metrics))
+	for _, dm := range h.dyn.metrics {
+		schemas = append(schemas, dm.schema)
+	}
+	h.dyn.mu.RUnlock()
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].Name < schemas[j].Name })
+
+	data, err := json.Marshal(schemas)
+	if err != nil {
+		return err
+	}
+	tmp := h.dynPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, h.dynPath); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// loadDynSchemas replays the schema file at construction. Best-effort like
+// the rollup load: a missing or corrupt file starts empty, never fails
+// startup; individual invalid entries are skipped with a warning.
+func (h *Service) loadDynSchemas() {
+	if h.dynPath == "" {
+		return
+	}
+	data, err := os.ReadFile(h.dynPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("WARNING: could not read metric schema file %s: %v", h.dynPath, err)
+		}
+		return
+	}
+	var schemas []MetricSchema
+	if err := json.Unmarshal(data, &schemas); err != nil {
+		log.Printf("WARNING: metric schema file %s is corrupt, starting empty: %v", h.dynPath, err)
+		return
+	}
+	for _, schema := range schemas {
+		if _, reason := h.registerDynMetric(schema); reason != "" {
+			log.Printf("WARNING: skipping persisted metric schema %q: %s", schema.Name, reason)
+		}
+	}
+}
+
+// handleMetricsRegister is POST /metrics/register.
+func (h *Service) handleMetricsRegister(w http.ResponseWriter, r *http.Request) {
+	body, err := requestBody(w, r, 1<<16) // 64KB
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, err.Error(), nil)
+		return
+	}
+	var schema MetricSchema
+	if err := json.NewDecoder(body).Decode(&schema); err != nil {
+		h.decodeBodyError(w, r, err)
+		return
+	}
+
+	created, reason := h.registerDynMetric(schema)
+	if reason != "" {
+		code := http.StatusBadRequest
+		if reason == reasonSchemaConflict || reason == reasonNameCollision {
+			code = http.StatusConflict
+		}
+		writeError(w, code, reason, "registration rejected", nil)
+		return
+	}
+	if created {
+		if err := h.saveDynSchemas(); err != nil {
+			// The in-memory registration stands; losing the file only costs
+			// the next restart, and that is worth a loud log line, not a 500.
+			log.Printf("WARNING: failed to persist metric schemas: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	if err := json.NewEncoder(w).Encode(schema); err != nil {
+		log.Printf("Failed to encode register response: %v", err)
+	}
+}
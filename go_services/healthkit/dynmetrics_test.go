@@ -0,0 +1,171 @@
+package healthkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func registerSchema(t *testing.T, r http.Handler, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	return doReq(t, r, http.MethodPost, "/metrics/register", token, body)
+}
+
+func TestDynMetricRegisterPushScrape(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+
+	// Unauthenticated registration is refused like every write.
+	if rec := registerSchema(t, r, "", `{"name":"queue_jobs","type":"counter","help":"x"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated register = %d, want 401", rec.Code)
+	}
+
+	rec := registerSchema(t, r, "tok",
+		`{"name":"queue_jobs","type":"counter","help":"Jobs processed by the worker queue","labels":["queue"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register = %d (%s), want 201", rec.Code, rec.Body.String())
+	}
+
+	// Push through the normal endpoint: the name isn't built in, so it must
+	// route through the dynamic collector.
+	rec = doReq(t, r, http.MethodPost, "/metrics/push", "tok",
+		`{"type":"counter","name":"queue_jobs","value":3,"labels":{"queue":"music"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("push to dynamic metric = %d (%s), want 200", rec.Code, rec.Body.String())
+	}
+
+	mf := findMetric(t, hs, "discord_bot_queue_jobs_total")
+	if mf == nil {
+		t.Fatal("dynamic counter missing from scrape")
+	}
+	if got := mf.GetMetric()[0].GetCounter().GetValue(); got != 3 {
+		t.Errorf("scraped value = %v, want 3", got)
+	}
+	if got := mf.GetMetric()[0].GetLabel()[0].GetValue(); got != "music" {
+		t.Errorf("label = %q, want music", got)
+	}
+
+	// Type mismatch against the registered schema is the usual stable reason.
+	rec = doReq(t, r, http.MethodPost, "/metrics/push", "tok",
+		`{"type":"gauge","name":"queue_jobs","value":3}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("mismatched-type push = %d, want 400", rec.Code)
+	}
+	// A name nobody registered still reads as unknown.
+	rec = doReq(t, r, http.MethodPost, "/metrics/push", "tok",
+		`{"type":"counter","name":"never_registered","value":1}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unregistered push = %d, want 400", rec.Code)
+	}
+}
+
+func TestDynMetricDuplicateAndConflict(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+
+	const schema = `{"name":"queue_jobs","type":"counter","help":"Jobs","labels":["queue"]}`
+	if rec := registerSchema(t, r, "tok", schema); rec.Code != http.StatusCreated {
+		t.Fatalf("first register = %d, want 201", rec.Code)
+	}
+	// Identical re-declaration is idempotent — the agent declares on startup.
+	if rec := registerSchema(t, r, "tok", schema); rec.Code != http.StatusOK {
+		t.Errorf("idempotent re-register = %d, want 200", rec.Code)
+	}
+	// Same name, different shape: 409 with the stable reason.
+	rec := registerSchema(t, r, "tok", `{"name":"queue_jobs","type":"gauge","help":"Jobs"}`)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("conflicting register = %d, want 409", rec.Code)
+	}
+	if env := decodeErrorEnvelope(t, rec); env.Code != reasonSchemaConflict {
+		t.Errorf("conflict body = %s, want code %q", rec.Body.String(), reasonSchemaConflict)
+	}
+}
+
+func TestDynMetricValidation(t *testing.T) {
+	tests := []struct {
+		name, body, wantReason string
+	}{
+		{"bad name", `{"name":"Queue-Jobs","type":"counter","help":"x"}`, reasonInvalidName},
+		{"reserved name", `{"name":"requests","type":"counter","help":"x"}`, reasonReservedName},
+		{"bad type", `{"name":"queue_jobs","type":"summary","help":"x"}`, reasonInvalidType},
+		{"empty help", `{"name":"queue_jobs","type":"counter","help":" "}`, reasonInvalidHelp},
+		{"six labels", `{"name":"queue_jobs","type":"counter","help":"x","labels":["a","b","c","d","e","f"]}`, reasonTooManySchemaLabels},
+		{"bad label charset", `{"name":"queue_jobs","type":"counter","help":"x","labels":["Queue Name"]}`, reasonInvalidLabel},
+		{"duplicate label", `{"name":"queue_jobs","type":"counter","help":"x","labels":["queue","queue"]}`, reasonInvalidLabel},
+	}
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := registerSchema(t, r, "tok", tt.body)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("register = %d, want 400", rec.Code)
+			}
+			if env := decodeErrorEnvelope(t, rec); env.Code != tt.wantReason {
+				t.Errorf("code = %s, want %q", rec.Body.String(), tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestDynMetricSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metric_schemas.json")
+
+	hs1 := New(WithVersion("test"), WithMetricSchemaPath(path))
+	r1 := buildRouter(hs1, "tok")
+	rec := registerSchema(t, r1, "tok",
+		`{"name":"playlist_depth","type":"gauge","help":"Queue depth","labels":["queue"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register = %d, want 201", rec.Code)
+	}
+
+	// "Restart": a fresh Service on the same schema file accepts the push
+	// with no re-registration.
+	hs2 := New(WithVersion("test"), WithMetricSchemaPath(path))
+	r2 := buildRouter(hs2, "tok")
+	rec = doReq(t, r2, http.MethodPost, "/metrics/push", "tok",
+		`{"type":"gauge","name":"playlist_depth","value":7,"labels":{"queue":"music"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("push after restart = %d (%s), want 200", rec.Code, rec.Body.String())
+	}
+	mf := findMetric(t, hs2, "discord_bot_playlist_depth")
+	if mf == nil {
+		t.Fatal("replayed gauge missing from scrape")
+	}
+	if got := mf.GetMetric()[0].GetGauge().GetValue(); got != 7 {
+		t.Errorf("scraped value = %v, want 7", got)
+	}
+}
+
+func TestDynMetricHistogramAndGaugeOps(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+
+	if rec := registerSchema(t, r, "tok", `{"name":"job_seconds","type":"histogram","help":"Job duration"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("histogram register = %d, want 201", rec.Code)
+	}
+	if rec := doReq(t, r, http.MethodPost, "/metrics/push", "tok",
+		`{"type":"histogram","name":"job_seconds","value":0.5}`); rec.Code != http.StatusOK {
+		t.Fatalf("histogram push = %d, want 200", rec.Code)
+	}
+	mf := findMetric(t, hs, "discord_bot_job_seconds")
+	if mf == nil || mf.GetMetric()[0].GetHistogram().GetSampleCount() != 1 {
+		t.Error("histogram observation missing from scrape")
+	}
+	// Negative observations stay rejected like the built-in histograms.
+	if rec := doReq(t, r, http.MethodPost, "/metrics/push", "tok",
+		`{"type":"histogram","name":"job_seconds","value":-1}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("negative histogram push = %d, want 400", rec.Code)
+	}
+
+	if rec := registerSchema(t, r, "tok", `{"name":"worker_pool","type":"gauge","help":"Pool size"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("gauge register = %d, want 201", rec.Code)
+	}
+	doReq(t, r, http.MethodPost, "/metrics/push", "tok", `{"type":"gauge","name":"worker_pool","value":5}`)
+	doReq(t, r, http.MethodPost, "/metrics/push", "tok", `{"type":"gauge","name":"worker_pool","value":2,"op":"inc"}`)
+	doReq(t, r, http.MethodPost, "/metrics/push", "tok", `{"type":"gauge","name":"worker_pool","value":1,"op":"dec"}`)
+	if got := findMetric(t, hs, "discord_bot_worker_pool").GetMetric()[0].GetGauge().GetValue(); got != 6 {
+		t.Errorf("gauge after set/inc/dec = %v, want 6", got)
+	}
+}
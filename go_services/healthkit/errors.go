@@ -0,0 +1,83 @@
+package healthkit
+
+// Every error response speaks one JSON envelope:
+//
+//	{"error": {"code": "...", "message": "...", "details": {...}}}
+//
+// The codes are stable machine-readable strings — where a failure already
+// had a reason constant (unknown_name, negative_value, invalid_name, the
+// heartbeat reasons) that constant IS the code, so clients that learned the
+// push-path vocabulary parse every endpoint the same way; the constants
+// below cover the failure modes that predate the reason system (auth, body
+// handling, query parameters, overload). The message is for humans and may
+// change; the code and the details keys are the contract. Before this, the
+// surface was a mix of http.Error plain text and bare status codes that the
+// Python client had to special-case per endpoint.
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+const (
+	errCodeInvalidJSON      = "invalid_json"
+	errCodeInvalidBody      = "invalid_body" // unreadable body: bad gzip, bad snappy, bad exposition…
+	errCodeBodyTooLarge     = "body_too_large"
+	errCodeBatchTooLarge    = "batch_too_large"
+	errCodeInvalidParameter = "invalid_parameter"
+	errCodeNotFound         = "not_found"
+	errCodeUnauthorized     = "unauthorized"
+	errCodeForbidden        = "forbidden"
+	errCodeWritesDisabled   = "writes_disabled"
+	errCodeRateLimited      = "rate_limited"
+	errCodeSaturated        = "saturated"
+	errCodeTimeout          = "timeout"
+	errCodeInternal         = "internal"
+)
+
+// errorBody is the envelope's inner object.
+type errorBody struct {
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// writeError emits the envelope. Encoding failures are logged, not
+// recoverable — the status line is already on the wire.
+func writeError(w http.ResponseWriter, status int, code, message string, details map[string]any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(map[string]errorBody{
+		"error": {Code: code, Message: message, Details: details},
+	}); err != nil {
+		log.Printf("Failed to encode error response: %v", err)
+	}
+}
+
+// writeParamError is the shorthand for query-parameter validation failures:
+// always 400/invalid_parameter, with the offending parameter named in the
+// details so a client can pinpoint it without parsing the message.
+func writeParamError(w http.ResponseWriter, param, message string) {
+	writeError(w, http.StatusBadRequest, errCodeInvalidParameter, message,
+		map[string]any{"parameter": param})
+}
+
+// recoverer replaces chi's middleware.Recoverer so that even a panic speaks
+// the envelope (code "internal") instead of an empty 500. Same contract
+// otherwise: the stack goes to the log, http.ErrAbortHandler propagates.
+func recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rvr := recover(); rvr != nil {
+				if rvr == http.ErrAbortHandler { //nolint:errorlint // sentinel comparison, per net/http docs
+					panic(rvr)
+				}
+				log.Printf("ERROR: panic serving %s %s: %v\n%s", r.Method, r.URL.Path, rvr, debug.Stack())
+				writeError(w, http.StatusInternalServerError, errCodeInternal, "internal server error", nil)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,90 @@
+package healthkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// decodeErrorEnvelope decodes the standard error envelope from a recorder
+// and fails the test if the body isn't one.
+func decodeErrorEnvelope(t *testing.T, rec *httptest.ResponseRecorder) errorBody {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Errorf("error Content-Type = %q, want application/json", ct)
+	}
+	var resp struct {
+		Error errorBody `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode error envelope from %q: %v", rec.Body.String(), err)
+	}
+	if resp.Error.Code == "" {
+		t.Fatalf("error envelope %q carries no code", rec.Body.String())
+	}
+	return resp.Error
+}
+
+func TestErrorEnvelopeCodes(t *testing.T) {
+	hs := New(WithVersion("test"), WithMaxServices(1))
+	hs.SetServiceStatus("bot", true)
+	r := buildRouter(hs, "tok")
+
+	tests := []struct {
+		name, method, path, token, body string
+		wantStatus                      int
+		wantCode                        string
+	}{
+		{"invalid json", http.MethodPost, "/health/service", "tok", "{not json", http.StatusBadRequest, errCodeInvalidJSON},
+		{"unknown metric", http.MethodPost, "/metrics/push", "tok", `{"type":"counter","name":"mystery","value":1}`, http.StatusBadRequest, reasonUnknownName},
+		{"negative counter", http.MethodPost, "/metrics/push", "tok", `{"type":"counter","name":"requests","value":-1}`, http.StatusBadRequest, reasonNegativeCounter},
+		{"missing token", http.MethodPost, "/metrics/push", "", `{}`, http.StatusUnauthorized, errCodeUnauthorized},
+		{"service cap", http.MethodPost, "/health/service", "tok", `{"name":"one_too_many","healthy":true}`, http.StatusConflict, heartbeatReasonMapFull},
+		{"invalid parameter", http.MethodGet, "/stats/guilds?top=junk", "tok", "", http.StatusBadRequest, errCodeInvalidParameter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doReq(t, r, tt.method, tt.path, tt.token, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if env := decodeErrorEnvelope(t, rec); env.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", env.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestErrorEnvelopeDetails(t *testing.T) {
+	hs := New(WithVersion("test"), WithMaxServices(1))
+	hs.SetServiceStatus("bot", true)
+	r := buildRouter(hs, "tok")
+
+	rec := doReq(t, r, http.MethodPost, "/health/service", "tok", `{"name":"extra","healthy":true}`)
+	env := decodeErrorEnvelope(t, rec)
+	if env.Details["max_services"] != float64(1) {
+		t.Errorf("details = %v, want max_services 1", env.Details)
+	}
+
+	rec = doReq(t, r, http.MethodGet, "/stats/guilds?top=0", "tok", "")
+	if env := decodeErrorEnvelope(t, rec); env.Details["parameter"] != "top" {
+		t.Errorf("details = %v, want parameter top", env.Details)
+	}
+}
+
+func TestRecovererEmitsEnvelope(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := hs.Routes()
+	r.Get("/panic", func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	})
+	rec := doReq(t, r, http.MethodGet, "/panic", "", "")
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	if env := decodeErrorEnvelope(t, rec); env.Code != errCodeInternal {
+		t.Errorf("code = %q, want internal", env.Code)
+	}
+}
@@ -0,0 +1,121 @@
+package healthkit
+
+// Conditional GETs for the dashboard's 1 Hz /health poll. Most responses are
+// byte-for-byte identical in the parts anyone acts on, so the handlers hash
+// the SEMANTIC state into a weak ETag and answer If-None-Match with an empty
+// 304. Volatile fields — Timestamp, Uptime, the memory/goroutine figures —
+// are deliberately left out of the hash: including them would change the tag
+// every second and make the whole exercise pointless, which is exactly why
+// the ETag is weak (the bodies aren't byte-identical, just equivalent).
+// Service keys are sorted before hashing so map iteration order can't make
+// two identical states disagree.
+//
+// Cache-Control stays "no-cache, max-age=0": intermediaries may hold a copy
+// but must revalidate every time, so a health flip is never served stale.
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// healthStatusETag computes the weak validator for one status snapshot.
+func healthStatusETag(status HealthStatus) string {
+	h := fnv.New64a()
+	writeField := func(s string) {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	writeField(status.Status)
+	writeField(status.Version)
+	writeField(status.Build.GitCommit)
+	names := make([]string, 0, len(status.Services))
+	for name := range status.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeField(name + "=" + strconv.FormatBool(status.Services[name]))
+	}
+	writeField(strconv.FormatUint(status.HeartbeatGeneration, 10))
+	shardIDs := make([]string, 0, len(status.Shards))
+	for id := range status.Shards {
+		shardIDs = append(shardIDs, id)
+	}
+	sort.Strings(shardIDs)
+	for _, id := range shardIDs {
+		writeField(id + "=" + strconv.FormatBool(status.Shards[id].Connected))
+	}
+	if status.Maintenance != nil {
+		writeField("maintenance")
+	}
+	for _, name := range status.OpenBreakers { // already sorted
+		writeField("breaker=" + name)
+	}
+	effNames := make([]string, 0, len(status.EffectiveServices))
+	for name := range status.EffectiveServices {
+		effNames = append(effNames, name)
+	}
+	sort.Strings(effNames)
+	for _, name := range effNames {
+		writeField("eff=" + name + "=" + strconv.FormatBool(status.EffectiveServices[name]))
+	}
+	// The root-cause classification can change (a dependency declaration
+	// lands) while the raw service booleans stay identical.
+	stateNames := make([]string, 0, len(status.ServiceStates))
+	for name := range status.ServiceStates {
+		stateNames = append(stateNames, name)
+	}
+	sort.Strings(stateNames)
+	for _, name := range stateNames {
+		writeField("state=" + name + "=" + status.ServiceStates[name])
+	}
+	// A window opening or closing changes the suppressed list (and usually
+	// Status) without touching the raw service booleans.
+	for _, name := range status.SuppressedServices { // already sorted
+		writeField("supp=" + name)
+	}
+	// Unknown services (see initial.go) are absent from the Services map, so
+	// a promotion out of unknown must change the tag through this entry.
+	for _, name := range status.UnknownServices { // already sorted
+		writeField("unk=" + name)
+	}
+	return fmt.Sprintf(`W/"%x"`, h.Sum64())
+}
+
+// etagMatches implements the If-None-Match comparison: a comma-separated
+// list, weak comparison (W/ prefixes ignored), and the * wildcard.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	opaque := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.TrimPrefix(candidate, "W/") == opaque {
+			return true
+		}
+	}
+	return false
+}
+
+// writeConditional sets the validator headers and answers 304 when the
+// client's validator still matches. Returns true when the caller should skip
+// the body. Only for handlers whose success path is cacheable — the /health
+// 503 branch bypasses this on purpose (an unhealthy answer should carry its
+// body every time).
+func writeConditional(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache, max-age=0")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
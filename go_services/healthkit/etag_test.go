@@ -0,0 +1,148 @@
+package healthkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthETag_304WhenUnchanged(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk))
+	r := buildRouter(hs, "tok")
+	hs.SetServiceStatus("database", true)
+
+	rec := doReq(t, r, http.MethodGet, "/health", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/health = %d, want 200", rec.Code)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag on /health")
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-cache, max-age=0" {
+		t.Errorf("Cache-Control = %q, want no-cache, max-age=0", cc)
+	}
+
+	// Nothing semantic changed — but volatile fields did (clock moved).
+	clk.Advance(30 * time.Second)
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec2 := httptest.NewRecorder()
+	r.ServeHTTP(rec2, req)
+	if rec2.Code != http.StatusNotModified {
+		t.Fatalf("conditional /health = %d, want 304", rec2.Code)
+	}
+	if rec2.Body.Len() != 0 {
+		t.Errorf("304 body = %d bytes, want empty", rec2.Body.Len())
+	}
+}
+
+func TestHealthETag_ChangesOnStatusFlip(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+	hs.SetServiceStatus("database", true)
+	hs.SetServiceStatus("gateway", true)
+
+	etag := doReq(t, r, http.MethodGet, "/health", "", "").Header().Get("ETag")
+
+	hs.SetServiceStatus("gateway", false)
+	// The aggregate flips unhealthy → the 503 path answers in full, no 304.
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unhealthy conditional /health = %d, want 503 with a body", rec.Code)
+	}
+	if rec.Body.Len() == 0 {
+		t.Error("503 served without a body")
+	}
+
+	// Recovered: healthy again, but the map content is the same as before the
+	// flip, so the tag matches the original.
+	hs.SetServiceStatus("gateway", true)
+	if got := doReq(t, r, http.MethodGet, "/health", "", "").Header().Get("ETag"); got != etag {
+		t.Errorf("ETag after recovery = %q, want the original %q (same semantic state)", got, etag)
+	}
+
+	// A new service is a semantic change: new tag.
+	hs.SetServiceStatus("voice", true)
+	if got := doReq(t, r, http.MethodGet, "/health", "", "").Header().Get("ETag"); got == etag {
+		t.Error("ETag unchanged after a new service registered")
+	}
+}
+
+func TestStatsETag(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+	hs.SetServiceStatus("database", true)
+
+	rec := doReq(t, r, http.MethodGet, "/stats", "tok", "")
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag on /stats")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/stats", nil)
+	req.Header.Set("Authorization", "Bearer tok")
+	req.Header.Set("If-None-Match", etag)
+	rec2 := httptest.NewRecorder()
+	r.ServeHTTP(rec2, req)
+	if rec2.Code != http.StatusNotModified {
+		t.Fatalf("conditional /stats = %d, want 304", rec2.Code)
+	}
+
+	hs.SetServiceStatus("database", false)
+	hs.SetServiceStatus("database", true)
+	hs.SetServiceStatus("gateway", true)
+	rec3 := httptest.NewRecorder()
+	r.ServeHTTP(rec3, req)
+	if rec3.Code != http.StatusOK {
+		t.Fatalf("conditional /stats after change = %d, want 200", rec3.Code)
+	}
+	if rec3.Header().Get("ETag") == etag {
+		t.Error("ETag unchanged after the service map grew")
+	}
+}
+
+func TestETagDeterministicAcrossMapOrder(t *testing.T) {
+	// Two statuses with the same services inserted in different orders must
+	// hash identically — the only ordering defense is the sort in the hasher.
+	a := HealthStatus{Status: "healthy", Version: "v", Services: map[string]bool{}}
+	b := HealthStatus{Status: "healthy", Version: "v", Services: map[string]bool{}}
+	names := []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot"}
+	for _, n := range names {
+		a.Services[n] = true
+	}
+	for i := len(names) - 1; i >= 0; i-- {
+		b.Services[names[i]] = true
+	}
+	for i := 0; i < 10; i++ {
+		if healthStatusETag(a) != healthStatusETag(b) {
+			t.Fatal("identical states hash differently across insertion order")
+		}
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		name, header, etag string
+		want               bool
+	}{
+		{"empty header", "", `W/"abc"`, false},
+		{"exact weak", `W/"abc"`, `W/"abc"`, true},
+		{"weak vs strong", `"abc"`, `W/"abc"`, true},
+		{"list", `"x", W/"abc"`, `W/"abc"`, true},
+		{"wildcard", "*", `W/"abc"`, true},
+		{"no match", `W/"def"`, `W/"abc"`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagMatches(tt.header, tt.etag); got != tt.want {
+				t.Errorf("etagMatches(%q, %q) = %v, want %v", tt.header, tt.etag, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package healthkit_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/voraehita25-star/discord-bot/go_services/healthkit"
+)
+
+// Example_embedding mounts the health/metrics routes under a prefix inside
+// another binary's chi router — the reuse case the package exists for. Each
+// Service owns its own Prometheus registry, so embedding never collides with
+// the host binary's metrics.
+func Example_embedding() {
+	svc := healthkit.New(healthkit.WithVersion("1.2.3"))
+	svc.SetServiceStatus("bot", true)
+
+	parent := chi.NewRouter()
+	parent.Mount("/internal", svc.Routes())
+
+	ts := httptest.NewServer(parent)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/internal/health/live")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(resp.Body)
+	fmt.Println(resp.StatusCode, string(body))
+	// Output: 200 OK
+}
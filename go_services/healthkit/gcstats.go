@@ -0,0 +1,154 @@
+package healthkit
+
+// GC pause visibility. gc_cycles says the collector ran; it says nothing
+// about whether stop-the-world pauses are eating the probe latency budget.
+// The collector tick already holds a fresh MemStats, so this file mines it
+// further: pause quantiles (p50/p95/max over the runtime's recent-pause ring)
+// as a summary-style gauge set, cumulative pause time as a counter, live heap
+// objects and the next-GC target. The fiddly part is PauseNs — a 256-entry
+// circular buffer indexed by NumGC, where entry (NumGC+255)%256 is the most
+// recent pause — so the indexing lives in a pure function with its own tests.
+//
+// POST /admin/gc complements the passive metrics for live debugging: trigger
+// a collection (optionally adjusting GOGC via debug.SetGCPercent first) and
+// get before/after heap stats back, instead of eyeballing two scrapes.
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sort"
+)
+
+// gcPauseRing is the size of MemStats.PauseNs.
+const gcPauseRing = 256
+
+// recentGCPauses extracts up to max pauses from the circular buffer, newest
+// first. NumGC counts completed cycles; the pause of cycle k lives at index
+// (k+255)%256, so the most recent entry is (numGC+255)%256 and older ones
+// walk backwards from there. Only min(numGC, 256, max) entries are real.
+func recentGCPauses(numGC uint32, pauseNs *[gcPauseRing]uint64, max int) []uint64 {
+	n := int(numGC)
+	if n > gcPauseRing {
+		n = gcPauseRing
+	}
+	if n > max {
+		n = max
+	}
+	out := make([]uint64, 0, n)
+	for i := 0; i < n; i++ {
+		out = append(out, pauseNs[(int(numGC)-1-i+gcPauseRing*2)%gcPauseRing])
+	}
+	return out
+}
+
+// pauseQuantiles computes nearest-rank p50/p95 and the max, in nanoseconds.
+// Zero values for an empty input.
+func pauseQuantiles(pauses []uint64) (p50, p95, max uint64) {
+	if len(pauses) == 0 {
+		return 0, 0, 0
+	}
+	sorted := make([]uint64, len(pauses))
+	copy(sorted, pauses)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := func(q float64) uint64 {
+		idx := int(q*float64(len(sorted))+0.5) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		if idx >= len(sorted) {
+			idx = len(sorted) - 1
+		}
+		return sorted[idx]
+	}
+	return rank(0.50), rank(0.95), sorted[len(sorted)-1]
+}
+
+// recordGCStats updates the GC gauge set from one MemStats sample. Runs on
+// the collector tick only (lastPauseTotal is collector-owned, like the
+// self-health latches).
+func (h *Service) recordGCStats(m *runtime.MemStats) {
+	p50, p95, max := pauseQuantiles(recentGCPauses(m.NumGC, &m.PauseNs, gcPauseRing))
+	h.metrics.gcPauseQuantile.WithLabelValues("0.5").Set(float64(p50) / 1e9)
+	h.metrics.gcPauseQuantile.WithLabelValues("0.95").Set(float64(p95) / 1e9)
+	h.metrics.gcPauseQuantile.WithLabelValues("max").Set(float64(max) / 1e9)
+
+	// PauseTotalNs is monotonic, so the counter advances by the delta since
+	// the previous sample (zero on the first tick after start).
+	if m.PauseTotalNs >= h.lastPauseTotal {
+		h.metrics.gcPauseTotal.Add(float64(m.PauseTotalNs-h.lastPauseTotal) / 1e9)
+	}
+	h.lastPauseTotal = m.PauseTotalNs
+
+	h.metrics.heapObjects.Set(float64(m.HeapObjects))
+	h.metrics.nextGC.Set(float64(m.NextGC))
+}
+
+// gcHeapSnapshot is one side of the before/after pair /admin/gc returns.
+type gcHeapSnapshot struct {
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+	HeapObjects    uint64 `json:"heap_objects"`
+	NumGC          uint32 `json:"num_gc"`
+	PauseTotalMs   uint64 `json:"pause_total_ms"`
+}
+
+func readGCHeapSnapshot() gcHeapSnapshot {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return gcHeapSnapshot{
+		HeapAllocBytes: m.HeapAlloc,
+		HeapObjects:    m.HeapObjects,
+		NumGC:          m.NumGC,
+		PauseTotalMs:   m.PauseTotalNs / 1e6,
+	}
+}
+
+// gcRequest is the optional /admin/gc body. GCPercent maps straight to
+// debug.SetGCPercent: -1 disables the collector, 100 is the default.
+type gcRequest struct {
+	GCPercent *int `json:"gc_percent"`
+}
+
+// handleGC is POST /admin/gc: optionally retune GOGC, force a collection,
+// and report before/after heap stats. Auth-gated like the other admin
+// endpoints — forcing stop-the-world pauses is a DoS lever.
+func (h *Service) handleGC(w http.ResponseWriter, r *http.Request) {
+	var req gcRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1024)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, errCodeInvalidJSON, "invalid JSON body", nil)
+		return
+	}
+
+	resp := struct {
+		Before gcHeapSnapshot `json:"before"`
+		After  gcHeapSnapshot `json:"after"`
+		// PreviousGCPercent is present only when gc_percent was set.
+		PreviousGCPercent *int `json:"previous_gc_percent,omitempty"`
+	}{}
+
+	if req.GCPercent != nil {
+		// debug.SetGCPercent accepts anything, but an absurd value here is a
+		// typo, not a plan — bound it like every other validated input.
+		if *req.GCPercent < -1 || *req.GCPercent > 10000 {
+			writeParamError(w, "gc_percent", "gc_percent must be between -1 and 10000")
+			return
+		}
+		prev := debug.SetGCPercent(*req.GCPercent)
+		resp.PreviousGCPercent = &prev
+		log.Printf("GC percent changed via /admin/gc: %d -> %d", prev, *req.GCPercent)
+	}
+
+	resp.Before = readGCHeapSnapshot()
+	runtime.GC()
+	resp.After = readGCHeapSnapshot()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode gc response: %v", err)
+	}
+}
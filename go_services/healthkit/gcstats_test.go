@@ -0,0 +1,196 @@
+package healthkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestRecentGCPauses_FewCycles(t *testing.T) {
+	// 3 completed cycles: cycle k's pause sits at (k+255)%256, i.e. cycles
+	// 1..3 land at indices 0..2. Newest first means [3, 2, 1].
+	var ring [gcPauseRing]uint64
+	ring[0], ring[1], ring[2] = 1, 2, 3
+
+	got := recentGCPauses(3, &ring, gcPauseRing)
+	want := []uint64{3, 2, 1}
+	if len(got) != len(want) {
+		t.Fatalf("got %d pauses, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("pause[%d] = %d, want %d", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRecentGCPauses_WrappedRing(t *testing.T) {
+	// 300 cycles: only the last 256 are real, and the newest (cycle 300)
+	// lives at index (300+255)%256 = 43.
+	var ring [gcPauseRing]uint64
+	for i := range ring {
+		ring[i] = uint64(i)
+	}
+
+	got := recentGCPauses(300, &ring, gcPauseRing)
+	if len(got) != gcPauseRing {
+		t.Fatalf("got %d pauses, want the full ring of %d", len(got), gcPauseRing)
+	}
+	if got[0] != 43 {
+		t.Errorf("newest pause = %d, want index 43 ((300+255)%%256)", got[0])
+	}
+	if got[1] != 42 {
+		t.Errorf("second-newest pause = %d, want 42", got[1])
+	}
+	// Walking 255 entries back from 43 wraps to 44.
+	if got[gcPauseRing-1] != 44 {
+		t.Errorf("oldest pause = %d, want 44 (wrapped)", got[gcPauseRing-1])
+	}
+}
+
+func TestRecentGCPauses_ZeroCycles(t *testing.T) {
+	var ring [gcPauseRing]uint64
+	if got := recentGCPauses(0, &ring, gcPauseRing); len(got) != 0 {
+		t.Errorf("got %d pauses before the first GC, want 0", len(got))
+	}
+}
+
+func TestPauseQuantiles(t *testing.T) {
+	pauses := make([]uint64, 100)
+	for i := range pauses {
+		pauses[i] = uint64(i + 1) // 1..100, already distinct
+	}
+	p50, p95, max := pauseQuantiles(pauses)
+	if p50 != 50 {
+		t.Errorf("p50 = %d, want 50", p50)
+	}
+	if p95 != 95 {
+		t.Errorf("p95 = %d, want 95", p95)
+	}
+	if max != 100 {
+		t.Errorf("max = %d, want 100", max)
+	}
+
+	if p50, p95, max := pauseQuantiles(nil); p50 != 0 || p95 != 0 || max != 0 {
+		t.Errorf("empty input quantiles = %d/%d/%d, want zeros", p50, p95, max)
+	}
+}
+
+// gaugeValue extracts one labelled sample from a gathered family.
+func gaugeValue(t *testing.T, mf *dto.MetricFamily, label, value string) float64 {
+	t.Helper()
+	for _, m := range mf.GetMetric() {
+		for _, lp := range m.GetLabel() {
+			if lp.GetName() == label && lp.GetValue() == value {
+				return m.GetGauge().GetValue()
+			}
+		}
+	}
+	t.Fatalf("no sample with %s=%q in %s", label, value, mf.GetName())
+	return 0
+}
+
+func TestRecordGCStats_SyntheticMemStats(t *testing.T) {
+	hs := New(WithVersion("test"))
+
+	var m runtime.MemStats
+	m.NumGC = 4
+	// Cycles 1..4 at indices 0..3; max 40ms, p50 is the 2nd of 4 sorted.
+	m.PauseNs[0], m.PauseNs[1], m.PauseNs[2], m.PauseNs[3] = 10e6, 20e6, 30e6, 40e6
+	m.PauseTotalNs = 100e6
+	m.HeapObjects = 1234
+	m.NextGC = 64 << 20
+	hs.recordGCStats(&m)
+
+	mf := findMetric(t, hs, "discord_bot_gc_pause_seconds")
+	if mf == nil {
+		t.Fatal("pause quantile gauge not registered")
+	}
+	if got := gaugeValue(t, mf, "quantile", "max"); got != 0.04 {
+		t.Errorf("max pause = %v, want 0.04s", got)
+	}
+	if got := gaugeValue(t, mf, "quantile", "0.5"); got != 0.02 {
+		t.Errorf("p50 pause = %v, want 0.02s", got)
+	}
+	if mf := findMetric(t, hs, "discord_bot_heap_objects"); mf.GetMetric()[0].GetGauge().GetValue() != 1234 {
+		t.Error("heap_objects gauge not set from MemStats")
+	}
+	if mf := findMetric(t, hs, "discord_bot_next_gc_bytes"); mf.GetMetric()[0].GetGauge().GetValue() != float64(64<<20) {
+		t.Error("next_gc_bytes gauge not set from MemStats")
+	}
+
+	// Second sample: the total-pause counter advances by the delta only.
+	m.PauseTotalNs = 250e6
+	hs.recordGCStats(&m)
+	mf = findMetric(t, hs, "discord_bot_gc_pause_total_seconds")
+	if got := mf.GetMetric()[0].GetCounter().GetValue(); got != 0.25 {
+		t.Errorf("pause total counter = %v, want 0.25 (cumulative)", got)
+	}
+}
+
+func TestAdminGC(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+
+	if rec := doReq(t, r, http.MethodPost, "/admin/gc", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated /admin/gc = %d, want 401", rec.Code)
+	}
+
+	rec := doReq(t, r, http.MethodPost, "/admin/gc", "tok", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/admin/gc = %d, want 200", rec.Code)
+	}
+	var resp struct {
+		Before            gcHeapSnapshot `json:"before"`
+		After             gcHeapSnapshot `json:"after"`
+		PreviousGCPercent *int           `json:"previous_gc_percent"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("gc body is not JSON: %v", err)
+	}
+	if resp.After.NumGC <= resp.Before.NumGC {
+		t.Errorf("num_gc before=%d after=%d, want a forced cycle in between", resp.Before.NumGC, resp.After.NumGC)
+	}
+	if resp.PreviousGCPercent != nil {
+		t.Error("previous_gc_percent present without a gc_percent in the request")
+	}
+}
+
+func TestAdminGC_SetPercent(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+	// Capture and always restore the process-wide setting.
+	orig := debug.SetGCPercent(100)
+	debug.SetGCPercent(orig)
+	defer debug.SetGCPercent(orig)
+
+	rec := doReq(t, r, http.MethodPost, "/admin/gc", "tok", `{"gc_percent":150}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/admin/gc with gc_percent = %d, want 200", rec.Code)
+	}
+	var resp struct {
+		PreviousGCPercent *int `json:"previous_gc_percent"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("gc body is not JSON: %v", err)
+	}
+	if resp.PreviousGCPercent == nil || *resp.PreviousGCPercent != orig {
+		t.Errorf("previous_gc_percent = %v, want %d", resp.PreviousGCPercent, orig)
+	}
+
+	// Out-of-range and malformed bodies are rejected before any GC runs.
+	if rec := doReq(t, r, http.MethodPost, "/admin/gc", "tok", `{"gc_percent":99999}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("absurd gc_percent = %d, want 400", rec.Code)
+	}
+	if rec := doReq(t, r, http.MethodPost, "/admin/gc", "tok", `{"gc_percent":`); rec.Code != http.StatusBadRequest {
+		t.Errorf("truncated body = %d, want 400", rec.Code)
+	}
+	if !strings.Contains(doReq(t, r, http.MethodPost, "/admin/gc", "tok", `{"gc_percent":99999}`).Body.String(), "gc_percent") {
+		t.Error("rejection body does not name the offending field")
+	}
+}
@@ -0,0 +1,139 @@
+package healthkit
+
+// gRPC transport for the push/status/health surface (see
+// proto/healthmetrics.proto for the contract and the rationale). Every RPC
+// is a thin shim over the SAME entry points the HTTP handlers use —
+// applyMetric, SetServiceStatus/SetServiceMessage, GetStatus — so the two
+// transports cannot drift: a payload rejected with "negative_counter" over
+// HTTP is rejected with the same reason string over gRPC.
+//
+// Auth matches the HTTP posture exactly: the write RPCs (PushMetrics,
+// SetServiceStatus) require `authorization: Bearer <token>` metadata and
+// fail CLOSED when HEALTH_API_TOKEN is unset, mirroring requireBearerToken;
+// GetHealth stays anonymous like GET /health. Unlike an HTTP 400 per push,
+// a streaming push validates each point independently and NEVER aborts the
+// stream on a bad point — the closing PushSummary carries per-reason
+// rejection counts instead, so one poisoned sample in a batch of thousands
+// doesn't cost a reconnect.
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/voraehita25-star/discord-bot/go_services/healthkit/proto"
+)
+
+// grpcHealthMetrics implements healthmetrics.v1.HealthMetrics on top of a
+// Service. Unexported — callers go through RegisterGRPC.
+type grpcHealthMetrics struct {
+	pb.UnimplementedHealthMetricsServer
+	svc *Service
+}
+
+// RegisterGRPC registers the HealthMetrics service implementation backed by
+// this Service on the given gRPC registrar.
+func (h *Service) RegisterGRPC(s grpc.ServiceRegistrar) {
+	pb.RegisterHealthMetricsServer(s, &grpcHealthMetrics{svc: h})
+}
+
+// authorizeWrite enforces the write-endpoint bearer token from incoming
+// metadata: fail-closed Unavailable when no token is configured (same
+// rationale as requireBearerToken — a deploy that forgot HEALTH_API_TOKEN
+// must not silently run unauthenticated), Unauthenticated on a missing or
+// wrong token, constant-time comparison either way.
+func (g *grpcHealthMetrics) authorizeWrite(ctx context.Context) error {
+	expected := g.svc.authToken
+	if expected == "" {
+		return status.Error(codes.Unavailable, "service refuses writes: HEALTH_API_TOKEN not configured")
+	}
+	var provided string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		const prefix = "Bearer "
+		for _, v := range md.Get("authorization") {
+			if strings.HasPrefix(v, prefix) {
+				provided = strings.TrimSpace(v[len(prefix):])
+			}
+		}
+	}
+	if len(provided) != len(expected) || subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) != 1 {
+		return status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+	}
+	return nil
+}
+
+// PushMetrics applies a stream of metric points through applyMetric — the
+// exact validation path (name allowlist, label sanitization, negative-counter
+// rejection, ...) behind POST /metrics/push. Rejected points are tallied per
+// stable reason string and never abort the stream.
+func (g *grpcHealthMetrics) PushMetrics(stream grpc.ClientStreamingServer[pb.MetricPoint, pb.PushSummary]) error {
+	if err := g.authorizeWrite(stream.Context()); err != nil {
+		return err
+	}
+	summary := &pb.PushSummary{RejectedByReason: map[string]uint64{}}
+	for {
+		point, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(summary)
+		}
+		if err != nil {
+			return err
+		}
+		reason := g.svc.applyMetric(MetricsPayload{
+			Type:   point.GetType(),
+			Name:   point.GetName(),
+			Value:  point.GetValue(),
+			Labels: point.GetLabels(),
+			Op:     point.GetOp(),
+		})
+		if reason != "" {
+			summary.Rejected++
+			summary.RejectedByReason[reason]++
+			continue
+		}
+		summary.Accepted++
+	}
+}
+
+// SetServiceStatus mirrors POST /health/service: same name bounds, same
+// service-map cap (with its stable reason), same message semantics — the
+// note is applied only after the status write succeeded, and an empty
+// message clears the old one.
+func (g *grpcHealthMetrics) SetServiceStatus(ctx context.Context, req *pb.ServiceStatusRequest) (*pb.ServiceStatusReply, error) {
+	if err := g.authorizeWrite(ctx); err != nil {
+		return nil, err
+	}
+	name := req.GetName()
+	if len(name) == 0 || len(name) > 100 {
+		return &pb.ServiceStatusReply{Reason: heartbeatReasonInvalidName}, nil
+	}
+	if !g.svc.SetServiceStatus(name, req.GetHealthy()) {
+		return &pb.ServiceStatusReply{Reason: heartbeatReasonMapFull}, nil
+	}
+	g.svc.SetServiceMessage(name, req.GetMessage())
+	return &pb.ServiceStatusReply{Accepted: true}, nil
+}
+
+// GetHealth returns the semantic fields of GET /health from the same
+// GetStatus snapshot the HTTP handler serves (the memory/goroutine metrics
+// map stays HTTP-only, as the contract documents).
+func (g *grpcHealthMetrics) GetHealth(context.Context, *pb.Empty) (*pb.HealthSnapshot, error) {
+	st := g.svc.GetStatus()
+	return &pb.HealthSnapshot{
+		Status:              st.Status,
+		Version:             st.Version,
+		Timestamp:           st.Timestamp,
+		Services:            st.Services,
+		UnknownServices:     st.UnknownServices,
+		SuppressedServices:  st.SuppressedServices,
+		OpenBreakers:        st.OpenBreakers,
+		HeartbeatGeneration: st.HeartbeatGeneration,
+	}, nil
+}
@@ -0,0 +1,180 @@
+package healthkit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "github.com/voraehita25-star/discord-bot/go_services/healthkit/proto"
+)
+
+// startGRPC serves the given Service over a bufconn listener and returns a
+// connected client; everything is torn down on test cleanup.
+func startGRPC(t *testing.T, hs *Service) pb.HealthMetricsClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	hs.RegisterGRPC(srv)
+	go func() { _ = srv.Serve(lis) }()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial bufconn: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+		srv.Stop()
+		_ = lis.Close()
+	})
+	return pb.NewHealthMetricsClient(conn)
+}
+
+// authed attaches the write bearer token as gRPC metadata.
+func authed(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+func grpcTestContext(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// TestGRPCPushMetricsStreamValidation: every streamed point goes through the
+// same applyMetric validation as POST /metrics/push, rejections carry the
+// same stable reason strings, and a bad point never aborts the stream.
+func TestGRPCPushMetricsStreamValidation(t *testing.T) {
+	hs := New(WithVersion("test"), WithAuthToken("tok"))
+	client := startGRPC(t, hs)
+
+	stream, err := client.PushMetrics(authed(grpcTestContext(t), "tok"))
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	points := []*pb.MetricPoint{
+		{Type: "counter", Name: "requests", Value: 1,
+			Labels: map[string]string{"endpoint": "/api", "status": "success"}},
+		{Type: "counter", Name: "not_on_the_allowlist", Value: 1},
+		{Type: "counter", Name: "requests", Value: -5,
+			Labels: map[string]string{"endpoint": "/api", "status": "success"}},
+		{Type: "gauge", Name: "active_connections", Value: 3, Op: "set"},
+	}
+	for _, p := range points {
+		if err := stream.Send(p); err != nil {
+			t.Fatalf("send %v: %v", p, err)
+		}
+	}
+	summary, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("close stream: %v", err)
+	}
+	if summary.GetAccepted() != 2 || summary.GetRejected() != 2 {
+		t.Errorf("summary = %d accepted / %d rejected, want 2/2", summary.GetAccepted(), summary.GetRejected())
+	}
+	byReason := summary.GetRejectedByReason()
+	if byReason[reasonUnknownName] != 1 || byReason[reasonNegativeCounter] != 1 {
+		t.Errorf("rejected_by_reason = %v, want one %q and one %q", byReason, reasonUnknownName, reasonNegativeCounter)
+	}
+}
+
+// TestGRPCSetServiceStatusAndGetHealth: status writes land in the same
+// service map the HTTP handlers read, with the HTTP surface's name bounds
+// and map-cap reasons, and GetHealth reflects them.
+func TestGRPCSetServiceStatusAndGetHealth(t *testing.T) {
+	hs := New(WithVersion("test"), WithAuthToken("tok"), WithMaxServices(1))
+	client := startGRPC(t, hs)
+	ctx := authed(grpcTestContext(t), "tok")
+
+	reply, err := client.SetServiceStatus(ctx, &pb.ServiceStatusRequest{Name: "worker", Healthy: false, Message: "reconnecting"})
+	if err != nil || !reply.GetAccepted() {
+		t.Fatalf("SetServiceStatus = (%v, %v), want accepted", reply, err)
+	}
+	if reply, err := client.SetServiceStatus(ctx, &pb.ServiceStatusRequest{Name: strings.Repeat("x", 101)}); err != nil || reply.GetAccepted() || reply.GetReason() != heartbeatReasonInvalidName {
+		t.Errorf("oversized name: reply = (%v, %v), want reason %q", reply, err, heartbeatReasonInvalidName)
+	}
+	if reply, err := client.SetServiceStatus(ctx, &pb.ServiceStatusRequest{Name: "second", Healthy: true}); err != nil || reply.GetAccepted() || reply.GetReason() != heartbeatReasonMapFull {
+		t.Errorf("over-cap name: reply = (%v, %v), want reason %q", reply, err, heartbeatReasonMapFull)
+	}
+
+	snap, err := client.GetHealth(grpcTestContext(t), &pb.Empty{})
+	if err != nil {
+		t.Fatalf("GetHealth: %v", err)
+	}
+	if snap.GetStatus() != "degraded" {
+		t.Errorf("status = %q, want degraded (worker reported unhealthy)", snap.GetStatus())
+	}
+	if healthy, ok := snap.GetServices()["worker"]; !ok || healthy {
+		t.Errorf("services = %v, want worker:false", snap.GetServices())
+	}
+	if snap.GetVersion() != "test" || snap.GetTimestamp() == "" {
+		t.Errorf("snapshot version/timestamp = %q/%q", snap.GetVersion(), snap.GetTimestamp())
+	}
+}
+
+// TestGRPCWriteAuth: the write RPCs carry the HTTP posture — Unauthenticated
+// without the right bearer metadata, fail-closed Unavailable when no token is
+// configured — while GetHealth stays anonymous like GET /health.
+func TestGRPCWriteAuth(t *testing.T) {
+	hs := New(WithVersion("test"), WithAuthToken("tok"))
+	client := startGRPC(t, hs)
+
+	wantCode := func(err error, want codes.Code) {
+		t.Helper()
+		if status.Code(err) != want {
+			t.Errorf("error = %v, want code %v", err, want)
+		}
+	}
+
+	// Wrong and missing tokens on both write RPCs.
+	_, err := client.SetServiceStatus(authed(grpcTestContext(t), "wrong"), &pb.ServiceStatusRequest{Name: "w", Healthy: true})
+	wantCode(err, codes.Unauthenticated)
+	stream, err := client.PushMetrics(grpcTestContext(t))
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	if _, err := stream.CloseAndRecv(); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("tokenless push error = %v, want Unauthenticated", err)
+	}
+
+	// Reads stay anonymous.
+	if _, err := client.GetHealth(grpcTestContext(t), &pb.Empty{}); err != nil {
+		t.Errorf("anonymous GetHealth should pass, got: %v", err)
+	}
+
+	// No configured token: writes refuse entirely (same 503-posture as HTTP).
+	tokenless := startGRPC(t, New(WithVersion("test")))
+	_, err = tokenless.SetServiceStatus(authed(grpcTestContext(t), "tok"), &pb.ServiceStatusRequest{Name: "w", Healthy: true})
+	wantCode(err, codes.Unavailable)
+}
+
+// TestGRPCPushMetricsRecvError: a broken stream surfaces the transport error
+// instead of a summary — only EOF closes with SendAndClose.
+func TestGRPCPushMetricsRecvError(t *testing.T) {
+	hs := New(WithVersion("test"), WithAuthToken("tok"))
+	client := startGRPC(t, hs)
+
+	ctx, cancel := context.WithCancel(authed(context.Background(), "tok"))
+	stream, err := client.PushMetrics(ctx)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	cancel()
+	if _, err := stream.CloseAndRecv(); err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("cancelled stream should fail with the RPC error, got: %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package healthkit
+
+// Guild-scoped activity counters. Product wants "messages handled per guild",
+// but a raw guild ID as a Prometheus label would both explode cardinality
+// (one series per guild, forever) and leak the IDs into every scrape. The
+// "guild_activity" push path splits the two needs:
+//
+//   - Prometheus gets discord_bot_guild_activity_total{guild_bucket}, where
+//     the guild ID is consistently hashed (FNV-1a) into one of GUILD_BUCKETS
+//     buckets (default 64) — bounded cardinality, no IDs on the wire, and a
+//     per-bucket rate is still enough to spot "one guild is hammering us".
+//   - Exact per-guild counts live in an internal top-K tracker capped at
+//     maxTrackedGuilds entries: when full, a new guild evicts the current
+//     minimum, and a periodic decay halves every count and drops the dust, so
+//     a guild that was hot last week cannot squat in the table forever. The
+//     tracker backs the auth-protected GET /stats/guilds leaderboard.
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultGuildBuckets is the Prometheus-side hash-bucket count.
+	// Overridable via GUILD_BUCKETS.
+	defaultGuildBuckets = 64
+
+	// maxTrackedGuilds caps the exact-count tracker.
+	maxTrackedGuilds = 1000
+
+	// guildDecayInterval is how often the tracker halves its counts (driven
+	// by the collector tick, so granularity is the collector interval).
+	guildDecayInterval = 10 * time.Minute
+
+	// defaultGuildLeaders is the leaderboard size when ?top is absent.
+	defaultGuildLeaders = 50
+)
+
+// guildBucketLabel hashes a guild ID into its stable bucket label.
+func guildBucketLabel(id string, buckets int) string {
+	f := fnv.New32a()
+	f.Write([]byte(id))
+	return strconv.Itoa(int(f.Sum32() % uint32(buckets)))
+}
+
+// guildTracker is the bounded exact-count table. Its own mutex, same pattern
+// as the other stores.
+type guildTracker struct {
+	mu        sync.Mutex
+	capacity  int
+	counts    map[string]float64
+	lastDecay time.Time
+}
+
+// add credits a guild, evicting the current minimum-count entry when the
+// table is full and the guild is new. Evicting the minimum (rather than
+// refusing the insert) keeps the table converging on the actual top-K: a
+// newly active guild can always displace a cold one.
+func (g *guildTracker) add(id string, n float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.counts[id]; !ok && len(g.counts) >= g.capacity {
+		minID, minCount := "", 0.0
+		for cand, count := range g.counts {
+			if minID == "" || count < minCount {
+				minID, minCount = cand, count
+			}
+		}
+		delete(g.counts, minID)
+	}
+	g.counts[id] += n
+}
+
+// maybeDecay halves every count once per guildDecayInterval and drops entries
+// that fall below one — without decay, a guild that was hot once would hold
+// its slot (and its rank) indefinitely.
+func (g *guildTracker) maybeDecay(now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.lastDecay.IsZero() {
+		g.lastDecay = now
+		return
+	}
+	if now.Sub(g.lastDecay) < guildDecayInterval {
+		return
+	}
+	g.lastDecay = now
+	g.decayLocked()
+}
+
+func (g *guildTracker) decayLocked() {
+	for id, count := range g.counts {
+		count /= 2
+		if count < 1 {
+			delete(g.counts, id)
+		} else {
+			g.counts[id] = count
+		}
+	}
+}
+
+// GuildActivity is one leaderboard row of GET /stats/guilds.
+type GuildActivity struct {
+	Guild string  `json:"guild"`
+	Count float64 `json:"count"`
+}
+
+// top returns the n highest-count guilds (count descending, ID ascending on
+// ties so the order is deterministic).
+func (g *guildTracker) top(n int) []GuildActivity {
+	g.mu.Lock()
+	rows := make([]GuildActivity, 0, len(g.counts))
+	for id, count := range g.counts {
+		rows = append(rows, GuildActivity{Guild: id, Count: count})
+	}
+	g.mu.Unlock()
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Count != rows[j].Count {
+			return rows[i].Count > rows[j].Count
+		}
+		return rows[i].Guild < rows[j].Guild
+	})
+	if len(rows) > n {
+		rows = rows[:n]
+	}
+	return rows
+}
+
+// handleGuildStats serves GET /stats/guilds?top=50. Auth-protected: unlike
+// the scrape, this body carries raw guild IDs.
+func (h *Service) handleGuildStats(w http.ResponseWriter, r *http.Request) {
+	top := defaultGuildLeaders
+	if raw := r.URL.Query().Get("top"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			writeParamError(w, "top", "invalid top (must be a positive integer)")
+			return
+		}
+		top = n
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"guilds": h.guilds.top(top),
+	}); err != nil {
+		log.Printf("Failed to encode guild stats: %v", err)
+	}
+}
+
+// WithGuildBuckets overrides the hash-bucket count; non-positive values are
+// ignored.
+func WithGuildBuckets(n int) Option {
+	return func(h *Service) {
+		if n > 0 {
+			h.guildBuckets = n
+		}
+	}
+}
+
+// guildBucketsFromEnv reads the GUILD_BUCKETS override with the usual
+// fail-safe posture.
+func guildBucketsFromEnv() int {
+	raw := strings.TrimSpace(os.Getenv("GUILD_BUCKETS"))
+	if raw == "" {
+		return defaultGuildBuckets
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("WARNING: invalid GUILD_BUCKETS %q (must be a positive integer) — using default %d", raw, defaultGuildBuckets)
+		return defaultGuildBuckets
+	}
+	return n
+}
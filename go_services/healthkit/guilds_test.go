@@ -0,0 +1,181 @@
+package healthkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGuildBucketLabelStableAndBounded(t *testing.T) {
+	a := guildBucketLabel("123456789012345678", 64)
+	if b := guildBucketLabel("123456789012345678", 64); b != a {
+		t.Errorf("same ID hashed to %s then %s, want a stable bucket", a, b)
+	}
+	for i := 0; i < 200; i++ {
+		bucket, err := strconv.Atoi(guildBucketLabel(fmt.Sprintf("guild_%d", i), 8))
+		if err != nil || bucket < 0 || bucket >= 8 {
+			t.Fatalf("bucket = %d (err %v), want 0..7", bucket, err)
+		}
+	}
+}
+
+func TestGuildTrackerEvictsMinimum(t *testing.T) {
+	g := guildTracker{capacity: 3, counts: make(map[string]float64)}
+	g.add("a", 10)
+	g.add("b", 2)
+	g.add("c", 5)
+	// Table full: a new guild displaces the coldest entry (b), not the
+	// newcomer itself.
+	g.add("d", 1)
+	want := []GuildActivity{{"a", 10}, {"c", 5}, {"d", 1}}
+	if got := g.top(10); !reflect.DeepEqual(got, want) {
+		t.Errorf("top after eviction = %v, want %v", got, want)
+	}
+	// An EXISTING guild updates in place even at capacity.
+	g.add("c", 7)
+	if got := g.top(1); !reflect.DeepEqual(got, []GuildActivity{{"c", 12}}) {
+		t.Errorf("top after update = %v, want c=12", got)
+	}
+	if got := len(g.top(10)); got != 3 {
+		t.Errorf("table size = %d, want the capacity 3", got)
+	}
+}
+
+func TestGuildTrackerDecay(t *testing.T) {
+	g := guildTracker{capacity: 10, counts: make(map[string]float64)}
+	g.add("hot", 100)
+	g.add("warm", 3)
+	g.add("dust", 1.5)
+	g.decayLocked()
+	// Halved: 100 -> 50, 3 -> 1.5; 1.5 -> 0.75 falls below one and is
+	// dropped entirely.
+	want := []GuildActivity{{"hot", 50}, {"warm", 1.5}}
+	if got := g.top(10); !reflect.DeepEqual(got, want) {
+		t.Errorf("top after decay = %v, want %v", got, want)
+	}
+	// Repeated decay eventually clears everything.
+	for i := 0; i < 10; i++ {
+		g.decayLocked()
+	}
+	if got := g.top(10); len(got) != 0 {
+		t.Errorf("top after repeated decay = %v, want empty", got)
+	}
+}
+
+func TestGuildTrackerMaybeDecayInterval(t *testing.T) {
+	base := time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC)
+	g := guildTracker{capacity: 10, counts: map[string]float64{"a": 8}}
+
+	g.maybeDecay(base) // first call only arms the timer
+	g.maybeDecay(base.Add(guildDecayInterval - time.Second))
+	if g.counts["a"] != 8 {
+		t.Fatalf("count = %v, want 8 before the interval elapses", g.counts["a"])
+	}
+	g.maybeDecay(base.Add(guildDecayInterval))
+	if g.counts["a"] != 4 {
+		t.Fatalf("count = %v, want 4 after one decay", g.counts["a"])
+	}
+	// The interval restarts from the decay, not from every call.
+	g.maybeDecay(base.Add(guildDecayInterval + time.Second))
+	if g.counts["a"] != 4 {
+		t.Errorf("count = %v, want 4 — second decay fired too early", g.counts["a"])
+	}
+}
+
+func TestGuildActivityPush(t *testing.T) {
+	hs := New(WithVersion("test"), WithGuildBuckets(4))
+	r := buildRouter(hs, "tok")
+
+	push := func(guild string, value float64) int {
+		body := fmt.Sprintf(`{"type":"counter","name":"guild_activity","value":%g,"labels":{"guild":%q}}`, value, guild)
+		return doReq(t, r, http.MethodPost, "/metrics/push", "tok", body).Code
+	}
+	if code := push("111111111111111111", 5); code != http.StatusOK {
+		t.Fatalf("push = %d, want 200", code)
+	}
+	if code := push("222222222222222222", 2); code != http.StatusOK {
+		t.Fatalf("push = %d, want 200", code)
+	}
+
+	// Prometheus sees only hashed buckets, never the IDs.
+	mf := findMetric(t, hs, "discord_bot_guild_activity_total")
+	total := 0.0
+	for _, m := range mf.GetMetric() {
+		for _, lp := range m.GetLabel() {
+			if lp.GetName() != "guild_bucket" {
+				t.Errorf("unexpected label %s", lp.GetName())
+			}
+			if strings.Contains(lp.GetValue(), "1111") || strings.Contains(lp.GetValue(), "2222") {
+				t.Errorf("label value %q leaks a guild ID", lp.GetValue())
+			}
+			if bucket, err := strconv.Atoi(lp.GetValue()); err != nil || bucket < 0 || bucket >= 4 {
+				t.Errorf("bucket label = %q, want 0..3", lp.GetValue())
+			}
+		}
+		total += m.GetCounter().GetValue()
+	}
+	if total != 7 {
+		t.Errorf("bucket total = %v, want 7", total)
+	}
+
+	// A payload without a guild label is rejected with the stable reason.
+	rec := doReq(t, r, http.MethodPost, "/metrics/push", "tok",
+		`{"type":"counter","name":"guild_activity","value":1}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), reasonMissingGuild) {
+		t.Errorf("missing guild = %d %q, want 400 with %s", rec.Code, rec.Body.String(), reasonMissingGuild)
+	}
+}
+
+func TestGuildStatsEndpoint(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+	for i, count := range []float64{30, 10, 20} {
+		hs.guilds.add(fmt.Sprintf("guild_%d", i), count)
+	}
+
+	if rec := doReq(t, r, http.MethodGet, "/stats/guilds", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated = %d, want 401", rec.Code)
+	}
+	rec := doReq(t, r, http.MethodGet, "/stats/guilds?top=2", "tok", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("guilds = %d, want 200", rec.Code)
+	}
+	var resp struct {
+		Guilds []GuildActivity `json:"guilds"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	want := []GuildActivity{{"guild_0", 30}, {"guild_2", 20}}
+	if !reflect.DeepEqual(resp.Guilds, want) {
+		t.Errorf("guilds = %v, want %v", resp.Guilds, want)
+	}
+	if rec := doReq(t, r, http.MethodGet, "/stats/guilds?top=junk", "tok", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("top=junk = %d, want 400", rec.Code)
+	}
+}
+
+func TestGuildBucketsFromEnv(t *testing.T) {
+	tests := []struct {
+		name, raw string
+		want      int
+	}{
+		{"empty uses default", "", defaultGuildBuckets},
+		{"valid", "128", 128},
+		{"zero invalid", "0", defaultGuildBuckets},
+		{"junk invalid", "many", defaultGuildBuckets},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GUILD_BUCKETS", tt.raw)
+			if got := guildBucketsFromEnv(); got != tt.want {
+				t.Errorf("guildBucketsFromEnv() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,3894 @@
+// Package healthkit is the reusable core of the health_api service: the
+// health/readiness model, the Prometheus push/ingest surface and the stats
+// endpoints, exposed as a Service with an embeddable chi router. The
+// health_api binary is a thin wrapper around it (listen config, signals,
+// rollup persistence); other binaries can mount the same routes under a
+// prefix via Service.Routes.
+//
+// Everything that used to be package-level state in health_api (the promauto
+// metrics, the token-cost accumulator, the rollup, the ingest store) is
+// instance-scoped here, each Service owning its own Prometheus registry
+// unless the caller brings one via WithRegistry.
+package healthkit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultMaxServices = 100
+	maxLabelLength     = 64
+)
+
+// serviceMetrics holds one Service's Prometheus collectors. These were
+// package-level promauto globals on the default registry before the healthkit
+// extraction; instance scoping lets several Services (and several tests)
+// coexist, each bound to its own registerer.
+type serviceMetrics struct {
+	requestsTotal                *prometheus.CounterVec
+	requestDuration              *prometheus.HistogramVec
+	aiResponseTime               *prometheus.HistogramVec
+	activeConnections            prometheus.Gauge
+	memoryUsage                  prometheus.Gauge
+	goroutineCount               prometheus.Gauge
+	circuitBreakerState          *prometheus.GaugeVec
+	rateLimitHits                *prometheus.CounterVec
+	cacheHits                    *prometheus.CounterVec
+	tokensUsed                   *prometheus.CounterVec
+	commandInvocations           *prometheus.CounterVec
+	commandDuration              *prometheus.HistogramVec
+	guildActivity                *prometheus.CounterVec
+	queueDepth                   *prometheus.GaugeVec
+	queueOldestAge               *prometheus.GaugeVec
+	queueDropped                 *prometheus.CounterVec
+	serviceRegistrationsRejected prometheus.Counter
+	remoteWriteDropped           prometheus.Counter
+	pushIPRejected               prometheus.Counter
+	seriesOverflow               *prometheus.CounterVec
+	statsdDropped                prometheus.Counter
+	redisIngestErrors            prometheus.Counter
+	writesThrottled              prometheus.Counter
+	writesShed                   prometheus.Counter
+	handlerTimeouts              *prometheus.CounterVec
+	snapshotWrites               *prometheus.CounterVec
+	snapshotWriteDuration        prometheus.Histogram
+	probeDuration                *prometheus.HistogramVec
+	maintenanceMode              prometheus.Gauge
+	memoryGrowth                 prometheus.Gauge
+	gcPauseQuantile              *prometheus.GaugeVec
+	gcPauseTotal                 prometheus.Counter
+	heapObjects                  prometheus.Gauge
+	nextGC                       prometheus.Gauge
+	shardConnected               *prometheus.GaugeVec
+	shardLatency                 *prometheus.GaugeVec
+	clientClockSkew              *prometheus.GaugeVec
+	cpuSeconds                   prometheus.Gauge
+	openFDs                      prometheus.Gauge
+	maxFDs                       prometheus.Gauge
+	diskFreeBytes                prometheus.Gauge
+}
+
+// newServiceMetrics registers the collector set on reg. Metric names, help
+// strings and label sets are unchanged from the pre-extraction globals — the
+// scrape output is part of the dashboard/alerting contract. nil bucket slices
+// mean the historical defaults (see metricstuning.go for the env overrides).
+func newServiceMetrics(reg prometheus.Registerer, requestDurationBuckets, aiResponseBuckets []float64) *serviceMetrics {
+	if requestDurationBuckets == nil {
+		requestDurationBuckets = prometheus.DefBuckets
+	}
+	if aiResponseBuckets == nil {
+		aiResponseBuckets = defaultAIResponseBuckets
+	}
+	f := promauto.With(reg)
+	return &serviceMetrics{
+		requestsTotal: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "discord_bot_requests_total",
+				Help: "Total number of requests",
+			},
+			[]string{"endpoint", "status"},
+		),
+
+		requestDuration: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "discord_bot_request_duration_seconds",
+				Help:    "Request duration in seconds",
+				Buckets: requestDurationBuckets,
+			},
+			[]string{"endpoint"},
+		),
+
+		aiResponseTime: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "discord_bot_ai_response_seconds",
+				Help:    "AI response time in seconds",
+				Buckets: aiResponseBuckets,
+			},
+			[]string{"model"},
+		),
+
+		activeConnections: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "discord_bot_active_connections",
+				Help: "Number of active connections",
+			},
+		),
+
+		memoryUsage: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "discord_bot_memory_bytes",
+				Help: "Current memory usage in bytes",
+			},
+		),
+
+		goroutineCount: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "discord_bot_goroutines",
+				Help: "Number of goroutines",
+			},
+		),
+
+		circuitBreakerState: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "discord_bot_circuit_breaker_state",
+				Help: "Circuit breaker state (0=closed, 1=half-open, 2=open)",
+			},
+			[]string{"service"},
+		),
+
+		rateLimitHits: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "discord_bot_rate_limit_hits_total",
+				Help: "Total rate limit hits",
+			},
+			[]string{"type"},
+		),
+
+		cacheHits: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "discord_bot_cache_total",
+				Help: "Cache hits and misses",
+			},
+			[]string{"result"}, // "hit" or "miss"
+		),
+
+		tokensUsed: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "discord_bot_tokens_total",
+				Help: "Total tokens used",
+			},
+			// model distinguishes which backing model burned the tokens now that
+			// the bot routes between several; see safeModelLabel for the allowlist.
+			[]string{"type", "model"}, // type: "input" or "output"
+		),
+
+		commandInvocations: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "discord_bot_command_invocations_total",
+				Help: "Slash command invocations",
+			},
+			// command is allowlist-bounded (see commands.go), status reuses the
+			// requests vocabulary.
+			[]string{"command", "status"},
+		),
+
+		commandDuration: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "discord_bot_command_duration_seconds",
+				Help:    "Slash command handling duration in seconds",
+				Buckets: requestDurationBuckets,
+			},
+			[]string{"command"},
+		),
+
+		guildActivity: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "discord_bot_guild_activity_total",
+				Help: "Messages handled per hashed guild bucket",
+			},
+			// guild_bucket is the FNV-1a bucket of the guild ID (see
+			// guilds.go) — bounded cardinality, no raw IDs in the scrape.
+			[]string{"guild_bucket"},
+		),
+
+		queueDepth: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "discord_bot_queue_depth",
+				Help: "Current depth of an internal queue",
+			},
+			[]string{"queue"},
+		),
+
+		queueOldestAge: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "discord_bot_queue_oldest_age_seconds",
+				Help: "Age in seconds of the oldest item in an internal queue",
+			},
+			[]string{"queue"},
+		),
+
+		queueDropped: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "discord_bot_queue_dropped_total",
+				Help: "Items shed from an internal queue",
+			},
+			[]string{"queue"},
+		),
+
+		serviceRegistrationsRejected: f.NewCounter(
+			prometheus.CounterOpts{
+				Name: "discord_bot_service_registrations_rejected_total",
+				Help: "Service registrations rejected because the service map hit its cap",
+			},
+		),
+		remoteWriteDropped: f.NewCounter(
+			prometheus.CounterOpts{
+				Name: "discord_bot_remote_write_dropped_total",
+				Help: "Remote-write series dropped for not being on the allowlist (or malformed names)",
+			},
+		),
+		pushIPRejected: f.NewCounter(
+			prometheus.CounterOpts{
+				Name: "discord_bot_push_ip_rejected_total",
+				Help: "Write requests rejected by the TRUSTED_PUSH_CIDRS source-IP allowlist",
+			},
+		),
+		seriesOverflow: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "discord_bot_series_overflow_total",
+				Help: "Observations routed to the overflow series because the metric family hit its cardinality budget",
+			},
+			[]string{"metric"},
+		),
+
+		statsdDropped: f.NewCounter(
+			prometheus.CounterOpts{
+				Name: "discord_bot_statsd_dropped_total",
+				Help: "StatsD lines dropped: unparseable, unknown name, or failed validation",
+			},
+		),
+
+		redisIngestErrors: f.NewCounter(
+			prometheus.CounterOpts{
+				Name: "discord_bot_redis_ingest_errors_total",
+				Help: "Redis ingest failures: connection errors, undecodable messages, rejected metrics",
+			},
+		),
+
+		writesThrottled: f.NewCounter(
+			prometheus.CounterOpts{
+				Name: "discord_bot_write_rate_limited_total",
+				Help: "Write requests rejected with 429 by the POST-route token bucket",
+			},
+		),
+
+		writesShed: f.NewCounter(
+			prometheus.CounterOpts{
+				Name: "discord_bot_write_load_shed_total",
+				Help: "Write requests rejected with 503 by the in-flight cap",
+			},
+		),
+
+		handlerTimeouts: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "health_api_handler_timeouts_total",
+				Help: "Requests cut off by a per-route handler timeout (see timeouts.go)",
+			},
+			[]string{"route"},
+		),
+
+		snapshotWrites: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "discord_bot_snapshot_writes_total",
+				Help: "Rollup/state snapshot writes by result",
+			},
+			[]string{"result"}, // "success" or "failure"
+		),
+
+		snapshotWriteDuration: f.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "discord_bot_snapshot_write_seconds",
+				Help:    "Rollup/state snapshot write duration in seconds",
+				Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5},
+			},
+		),
+
+		probeDuration: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "discord_bot_probe_duration_seconds",
+				Help:    "Active health probe round duration in seconds",
+				Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 30, 60},
+			},
+			// Probe names come from operator config (HEALTH_PROBES), not from
+			// untrusted input, so the label cardinality is bounded by config.
+			[]string{"probe"},
+		),
+
+		shardConnected: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "discord_bot_shard_connected",
+				Help: "Whether the gateway shard is connected (1) or not (0)",
+			},
+			[]string{"shard"},
+		),
+
+		shardLatency: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "discord_bot_shard_latency_seconds",
+				Help: "Gateway heartbeat latency reported by the shard",
+			},
+			[]string{"shard"},
+		),
+
+		clientClockSkew: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "discord_bot_client_clock_skew_seconds",
+				Help: "Client clock minus server clock, from the writer's client_timestamp",
+			},
+			[]string{"writer"},
+		),
+
+		cpuSeconds: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "discord_bot_process_cpu_seconds",
+				Help: "Cumulative user+system CPU time consumed by the process",
+			},
+		),
+
+		openFDs: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "discord_bot_open_fds",
+				Help: "Open file descriptors held by the process",
+			},
+		),
+
+		maxFDs: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "discord_bot_max_fds",
+				Help: "File descriptor rlimit (RLIMIT_NOFILE soft limit)",
+			},
+		),
+
+		diskFreeBytes: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "discord_bot_disk_free_bytes",
+				Help: "Free bytes available on the data volume (DISK_PATH)",
+			},
+		),
+
+		maintenanceMode: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "discord_bot_maintenance_mode",
+				Help: "1 while operator-enabled maintenance mode gates readiness, else 0",
+			},
+		),
+		memoryGrowth: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "discord_bot_memory_growth_bytes_per_minute",
+				Help: "Windowed linear-regression slope of heap allocation (see memtrend.go)",
+			},
+		),
+		gcPauseQuantile: f.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "discord_bot_gc_pause_seconds",
+				Help: "GC stop-the-world pause quantiles over the runtime's recent-pause ring",
+			},
+			[]string{"quantile"},
+		),
+		gcPauseTotal: f.NewCounter(
+			prometheus.CounterOpts{
+				Name: "discord_bot_gc_pause_total_seconds",
+				Help: "Cumulative GC stop-the-world pause time",
+			},
+		),
+		heapObjects: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "discord_bot_heap_objects",
+				Help: "Live objects on the heap (MemStats.HeapObjects)",
+			},
+		),
+		nextGC: f.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "discord_bot_next_gc_bytes",
+				Help: "Heap size target that triggers the next GC cycle (MemStats.NextGC)",
+			},
+		),
+	}
+}
+
+// Clock abstracts time so tests can drive staleness/cooldown/uptime logic
+// without sleeping. Production code always uses realClock; tests inject a
+// fake via WithClock. Keep the surface minimal — only what the service uses.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker mirrors the subset of *time.Ticker the service consumes (the channel
+// must be behind a method so fakes can supply their own).
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct{ t *time.Ticker }
+
+func (r realTicker) C() <-chan time.Time { return r.t.C }
+func (r realTicker) Stop()               { r.t.Stop() }
+
+// HealthStatus represents the health of the system
+type HealthStatus struct {
+	Status    string `json:"status"`
+	Timestamp string `json:"timestamp"`
+	Version   string `json:"version"`
+	// Build identifies the running binary (see buildinfo.go) — the answer to
+	// "which commit is this pod actually running?" during triage.
+	Build    BuildInfo       `json:"build"`
+	Uptime   string          `json:"uptime"`
+	Services map[string]bool `json:"services"`
+	Metrics  map[string]any  `json:"metrics"`
+	// HeartbeatGeneration increments once per applied heartbeat batch.
+	// Two reads with the same generation saw the same heartbeat; a change
+	// means a whole batch (never part of one) landed in between.
+	HeartbeatGeneration uint64 `json:"heartbeat_generation"`
+	// LastHeartbeat is the batch timestamp (RFC3339 UTC) of the most recent
+	// heartbeat; empty until the first one. Staleness checks compare against
+	// this single batch time, not per-service write times.
+	LastHeartbeat string `json:"last_heartbeat,omitempty"`
+	// Heartbeats lists the services enrolled in registration-mode heartbeats
+	// (see RecordHeartbeat): when each last checked in and the interval it
+	// declared, so an operator can see at a glance which worker went quiet.
+	Heartbeats map[string]HeartbeatInfo `json:"heartbeats,omitempty"`
+	// Shards holds the latest gateway shard self-reports, keyed by shard id
+	// (see POST /health/shard); absent until the first report.
+	Shards map[string]ShardInfo `json:"shards,omitempty"`
+	// Maintenance is present (enabled:true) only while the operator-driven
+	// maintenance window gates readiness; see POST /admin/maintenance.
+	Maintenance *MaintenanceInfo `json:"maintenance,omitempty"`
+	// OpenBreakers lists services whose pushed circuit breaker is currently
+	// open (see breakers.go); absent when none are. Whether they also
+	// degrade Status is gated by BREAKER_AFFECTS_HEALTH.
+	OpenBreakers []string `json:"open_breakers,omitempty"`
+	// EffectiveServices is the hysteresis-lagged view of Services that
+	// readiness actually consumes (see hysteresis.go); present only when the
+	// READINESS_* thresholds are configured. Services keeps the raw reported
+	// states, so both truths stay visible during an incident.
+	EffectiveServices map[string]bool `json:"effective_services,omitempty"`
+	// ServiceStates classifies each service as ok/failed/impacted and
+	// RootCauses lists the unhealthy services with no unhealthy dependency
+	// (see deps.go); both present only once dependencies are declared.
+	ServiceStates map[string]string `json:"service_states,omitempty"`
+	RootCauses    []string          `json:"root_causes,omitempty"`
+	// SuppressedServices lists unhealthy services whose state is covered by
+	// an active downtime window (see downtime.go) and therefore ignored by
+	// the aggregate; Services still shows them false.
+	SuppressedServices []string `json:"suppressed_services,omitempty"`
+	// UnknownServices lists seeded services that have never reported (see
+	// initial.go). Unknown is not unhealthy — the names are absent from
+	// Services entirely until the first real report.
+	UnknownServices []string `json:"unknown_services,omitempty"`
+}
+
+// HeartbeatInfo is one registration-mode heartbeat as shown in /health.
+type HeartbeatInfo struct {
+	LastSeen        string `json:"last_seen"` // RFC3339 UTC
+	IntervalSeconds int    `json:"interval_seconds"`
+}
+
+// MetricsPayload for receiving metrics from Python
+type MetricsPayload struct {
+	Type   string            `json:"type"`
+	Name   string            `json:"name"`
+	Value  float64           `json:"value"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// Op applies to gauges only: "set" (default), "inc" or "dec". Python
+	// shards each know their own connection delta, not the global total, so
+	// Set-only semantics let the last writer clobber everyone else.
+	Op string `json:"op,omitempty"`
+	// Mode applies to built-in counters only: "delta" (the default, for
+	// single pushes and batch items alike) or "absolute" — see monotonic.go
+	// for the restart-recovery semantics.
+	Mode string `json:"mode,omitempty"`
+	// ClientTimestamp (RFC3339) is the sender's own clock when it built the
+	// payload; see clockskew.go. Advisory — never rejects the metric.
+	ClientTimestamp string `json:"client_timestamp,omitempty"`
+}
+
+// Service is the health/metrics core: service health map, Prometheus push
+// surface, stats endpoints. Construct with New; mount its HTTP surface with
+// Routes. One Service per registry — registering two on the same registry
+// panics on the duplicate collectors.
+type Service struct {
+	startTime time.Time
+	version   string
+	// build is the resolved build identity (see buildinfo.go), fixed at New.
+	build       BuildInfo
+	maxServices int
+	clock       Clock
+	// authToken gates the write endpoints (fail-closed when empty) and, when
+	// set, the richer read endpoints too — see requireBearerToken /
+	// requireReadToken for the exact posture.
+	authToken string
+
+	registry *prometheus.Registry
+	// metricsPrefix and the bucket overrides tune registration itself; they
+	// are consumed once in New and inert afterwards (see metricstuning.go).
+	metricsPrefix          string
+	requestDurationBuckets []float64
+	aiResponseBuckets      []float64
+	// registerer is registry, wrapped with the prefix when one is set; every
+	// registration (including lazy ones like getSummaryGauge) goes through it.
+	registerer      prometheus.Registerer
+	metrics         *serviceMetrics
+	httpMetrics     *HTTPMetrics
+	pushed          *ingestStore
+	tokenCosts      *tokenAccumulator
+	rollup          *dailyRollup
+	rollupRetention int
+	listMaxBytes    int
+	streamMaxItems  int
+	allowedModels   map[string]bool
+
+	// Write-path protection (see rateLimitWrites / shedWrites): a token bucket
+	// over all POST routes plus an in-flight cap. Read probes are exempt —
+	// the whole point is keeping /health/live responsive under a push flood.
+	writeRPS      float64
+	writeBurst    int
+	maxInFlight   int
+	writeLimiter  *rate.Limiter
+	inFlightCount atomic.Int64
+
+	// Per-route handler timeouts (see timeouts.go): one budget per route
+	// class, each 0 when disabled.
+	probeTimeout   time.Duration
+	metricsTimeout time.Duration
+	pushTimeout    time.Duration
+	statsTimeout   time.Duration
+
+	// Router-wide load shedding (see loadshed.go): a concurrency cap with a
+	// bounded queue wait, mounted on every router this Service builds.
+	maxConcurrent int
+	queueWait     time.Duration
+	limiter       *ConcurrencyLimiter
+
+	// shuttingDown flips once BeginShutdown is called (see shutdown.go):
+	// readiness answers 503 immediately while in-flight requests drain.
+	shuttingDown atomic.Bool
+
+	// Per-1k-token prices for /stats/cost. Zero (the default) makes every
+	// estimate 0 rather than refusing the endpoint — operators who don't care
+	// about cost simply never set the prices.
+	tokenPriceInput  float64
+	tokenPriceOutput float64
+
+	// Lazily registered summary_set gauges (see getSummaryGauge).
+	summaryMu     sync.Mutex
+	summaryGauges map[string]*prometheus.GaugeVec
+
+	// Cached MemStats snapshot, refreshed by CollectSystemMetrics on the
+	// collector tick. GetStatus reads these atomics instead of calling
+	// runtime.ReadMemStats() inline: that is a stop-the-world pause, and
+	// GetStatus backs the UNAUTHENTICATED /health, /health/ready and /stats
+	// handlers, so an inline read let a tight request loop force repeated STW
+	// GC pauses (a DoS lever once bound to a non-loopback address).
+	cachedMemAlloc atomic.Uint64
+	cachedMemSys   atomic.Uint64
+	cachedNumGC    atomic.Uint32
+	// collectorInterval is both the collector's tick and the minimum spacing
+	// between ReadMemStats calls (lastMemSample, unix nanos, enforces it), so
+	// even overlapping manual CollectSystemMetrics calls cannot stack
+	// stop-the-world pauses. Default 2s; MEMSTATS_INTERVAL_MS overrides.
+	collectorInterval time.Duration
+	lastMemSample     atomic.Int64
+	// Extended stats cache (see sysstats.go): same pattern, fed by the same
+	// tick. sysStatsOK flips true after the first successful sample and gates
+	// the extra /health keys; sysStatsWarnOnce rate-limits the unavailability
+	// log to one line per process.
+	cachedCPUSeconds atomicFloat64
+	cachedOpenFDs    atomic.Uint64
+	cachedMaxFDs     atomic.Uint64
+	cachedDiskFree   atomic.Uint64
+	sysStatsOK       atomic.Bool
+	sysStatsWarnOnce sync.Once
+	// diskPath is the volume whose free space the collector tracks.
+	diskPath string
+	// logger backs the request middleware and rejection logs (see logging.go).
+	logger *slog.Logger
+
+	// statusSnapshot is the published immutable view of services/messages
+	// (see snapshot.go); snapshotGeneration is its publish counter, guarded
+	// by mu like the master maps it summarizes.
+	statusSnapshot     atomic.Pointer[statusSnapshot]
+	snapshotGeneration uint64
+
+	mu       sync.RWMutex
+	services map[string]bool
+	// unknownServices holds expected-but-unreported services (see
+	// initial.go), keyed by name with the time each was seeded; guarded by
+	// mu alongside services. unknownGrace is the startup window after which
+	// a still-unknown service degrades readiness (0 = never).
+	unknownServices map[string]time.Time
+	unknownGrace    time.Duration
+	// serviceMessages holds the optional per-service status note, keyed like
+	// services and guarded by the same mu. Values are stored ALREADY sanitized
+	// (see sanitizeServiceMessage) — sinks only add their output encoding.
+	serviceMessages map[string]string
+	// heartbeatGeneration counts applied heartbeat batches; lastHeartbeat is
+	// the batch timestamp. Both are guarded by mu and published together with
+	// the services map in GetStatus, so a consumer comparing generations
+	// across two reads can detect that a heartbeat landed in between —
+	// individual snapshots are never torn (see ApplyHeartbeat).
+	heartbeatGeneration uint64
+	lastHeartbeat       time.Time
+	// heartbeatRegs tracks registration-mode heartbeats ("I'm alive" pings
+	// with a declared interval, see RecordHeartbeat); guarded by mu. The
+	// sweeper flips a service unhealthy when its deadline (2× the declared
+	// interval) passes without a new ping.
+	heartbeatRegs map[string]*heartbeatReg
+	// Maintenance mode (see maintenance.go): operator-driven readiness gate.
+	// All three guarded by mu; maintUntil zero means no auto-expiry.
+	maintEnabled bool
+	maintReason  string
+	maintUntil   time.Time
+	// Runtime self-health thresholds (see selfhealth.go). The thresholds are
+	// construction-time config; the tripped latches are owned by the single
+	// collector goroutine (checkRuntimeThresholds runs only on its tick), so
+	// they need no lock of their own.
+	maxMemoryBytes           uint64
+	maxGoroutines            int
+	runtimeMemTripped        bool
+	runtimeGoroutinesTripped bool
+	// memTrend is the sliding-window leak detector (see memtrend.go), owned
+	// by the collector goroutine like the latches above; nil when disabled.
+	memTrend *memTrendTracker
+	// lastPauseTotal backs the GC pause counter delta (see gcstats.go);
+	// collector-owned like memTrend.
+	lastPauseTotal uint64
+	// Startup-probe state (see startup.go): everHealthy records which services
+	// have reported healthy at least once, and startupDone latches once
+	// /health/startup first answers 200. Both guarded by mu; the requirements
+	// themselves are set at construction and read-only after.
+	startupRequired []string
+	startupGrace    time.Duration
+	everHealthy     map[string]bool
+	startupDone     bool
+	// Per-shard gateway reports (see shards.go), keyed by shard id and
+	// guarded by mu; shardGrace is the disconnect window before aggregate
+	// status degrades.
+	shards     map[int]*shardState
+	shardGrace time.Duration
+	// Client clock-skew tracking (see clockskew.go): the largest absolute
+	// skew observed, and the warning rate-limit anchor. Guarded by mu; the
+	// threshold is construction-time config.
+	skewWarnThreshold time.Duration
+	maxSkew           time.Duration
+	skewSeen          bool
+	lastSkewWarn      time.Time
+	// Deprecation policy (see deprecation.go). pendingDeprecations holds the
+	// declarations until New builds the set against the registry.
+	deprecations        *DeprecationSet
+	pendingDeprecations []Deprecation
+	enforceSunset       bool
+	// Live-reloadable configuration (see reload.go): the snapshot every
+	// request-path reader consults, the immutable-env baseline captured at
+	// construction for "requires restart" diffing, and the probe restart
+	// plumbing. reloadMu serializes reloads against RunProbes.
+	liveCfg      atomic.Pointer[Config]
+	immutableEnv map[string]string
+	reloadMu     sync.Mutex
+	probeParent  context.Context
+	probeCancel  context.CancelFunc
+	// Incident log (see incidents.go): opened/closed by SetServiceStatus
+	// transitions, queried over /incidents. The store carries its own lock;
+	// cap and debounce are construction-time config.
+	incidentLog      *incidentStore
+	incidentCap      int
+	incidentDebounce time.Duration
+	// Series cardinality guard for the free-form endpoint label (see
+	// cardinality.go). The guard carries its own lock; the limit is
+	// construction-time config.
+	cardGuard   *cardinalityGuard
+	seriesLimit int
+	// absCounters is the absolute-mode baseline store (see monotonic.go);
+	// entry count is bounded by cardGuard admission.
+	absCounters absCounterStore
+	// breakers logs circuit-breaker transitions (see breakers.go); it
+	// carries its own lock. breakerAffectsHealth is construction-time config.
+	breakers             breakerStore
+	breakerAffectsHealth bool
+	// tracer exports spans over OTLP when traceEndpoint is set (see
+	// tracing.go); nil means tracing is disabled and costs nothing.
+	tracer        *tracer
+	traceEndpoint string
+	// Readiness hysteresis (see hysteresis.go), guarded by mu like the
+	// service map it shadows. The zero config means instant edges.
+	hyst    map[string]*hystState
+	hystCfg hystConfig
+	// Declared service dependencies (see deps.go), guarded by mu. Kept
+	// acyclic by SetServiceDependencies.
+	deps map[string][]string
+	// Collector-fed stats ring (see history.go); its own mutex.
+	history         *statsRing
+	historyCapacity int
+	// Command allowlist + usage accumulators (see commands.go); own mutex.
+	commands             commandStore
+	commandAllowlistPath string
+	// Guild activity tracker + hash-bucket count (see guilds.go); own mutex.
+	guilds       guildTracker
+	guildBuckets int
+	// Queue backlog watch (see queues.go); own mutex.
+	queues queueWatch
+	// Alert rules + lifecycle states (see alerts.go); own mutex.
+	alerts         alertEngine
+	alertRulesPath string
+	// Scheduled downtime windows (see downtime.go); own mutex.
+	downtime downtimeStore
+	// Availability tallies (see sla.go), guarded by mu like the service map
+	// they mirror. slaUnhealthy counts currently-unhealthy services so the
+	// aggregate row can track 0↔N edges without double-counting overlap.
+	sla          map[string]*slaState
+	slaAgg       slaState
+	slaUnhealthy int
+	// corsOrigins is the browser-origin allowlist (see cors.go); empty means
+	// no CORS headers at all. Construction-time config.
+	corsOrigins []string
+	// trustedPushNets is the write-endpoint source-IP allowlist (see
+	// ipallow.go); nil disables the check. trustProxy gates whether
+	// X-Forwarded-For is believed. Construction-time config.
+	trustedPushNets []*net.IPNet
+	trustProxy      bool
+	// Remote-write mirror state (see remotewrite.go): the series-name
+	// allowlist and the dynamically registered remote_* gauges, guarded by
+	// their own mutex (registration happens on the request path).
+	rwAllowed map[string]bool
+	rwGauges  map[string]prometheus.Gauge
+	rwMu      sync.Mutex
+	// Dynamic metric registrations (see dynmetrics.go): runtime-declared
+	// pushable metrics and the JSON file they persist to.
+	dyn     dynStore
+	dynPath string
+	// persistFailStreak counts consecutive failed snapshot writes; guarded by
+	// mu and reset to 0 by any success. The "persistence" pseudo-service flips
+	// to unhealthy once the streak reaches persistFailureThreshold (see
+	// recordSnapshotWrite in persistence.go).
+	persistFailStreak int
+}
+
+// Option customizes New. Defaults are always production-correct; binaries
+// usually pass OptionsFromEnv() and embedders set what they need.
+type Option func(*Service)
+
+// WithClock injects a test clock (see Clock).
+func WithClock(c Clock) Option {
+	return func(h *Service) { h.clock = c }
+}
+
+// WithVersion sets the version string reported by /health and /stats.
+func WithVersion(version string) Option {
+	return func(h *Service) { h.version = version }
+}
+
+// WithAuthToken sets the bearer token for the write endpoints (and, when
+// non-empty, the richer read endpoints). Empty keeps the fail-closed default:
+// writes are rejected outright, reads stay anonymous.
+func WithAuthToken(token string) Option {
+	return func(h *Service) { h.authToken = token }
+}
+
+// WithRegistry makes the Service register its collectors on reg instead of a
+// private registry. The caller owns reg's lifecycle (and its Go/process
+// collectors, which the private default includes automatically).
+func WithRegistry(reg *prometheus.Registry) Option {
+	return func(h *Service) { h.registry = reg }
+}
+
+// WithMaxServices overrides the service-map cap (see SetServiceStatus).
+func WithMaxServices(n int) Option {
+	return func(h *Service) { h.maxServices = n }
+}
+
+// WithListMaxBytes overrides the paginated-list byte ceiling.
+func WithListMaxBytes(n int) Option {
+	return func(h *Service) { h.listMaxBytes = n }
+}
+
+// WithStreamMaxItems overrides the /metrics/stream total-item ceiling.
+func WithStreamMaxItems(n int) Option {
+	return func(h *Service) { h.streamMaxItems = n }
+}
+
+// WithWriteRateLimit overrides the POST-route token bucket (requests per
+// second sustained, burst above it).
+func WithWriteRateLimit(rps float64, burst int) Option {
+	return func(h *Service) {
+		h.writeRPS = rps
+		h.writeBurst = burst
+	}
+}
+
+// WithMaxInFlight overrides the concurrent-POST cap (see shedWrites).
+func WithMaxInFlight(n int) Option {
+	return func(h *Service) { h.maxInFlight = n }
+}
+
+// WithAllowedModels sets the allowlist for the `model` label on tokens /
+// ai_response_time pushes (see safeModelLabel).
+func WithAllowedModels(models map[string]bool) Option {
+	return func(h *Service) { h.allowedModels = models }
+}
+
+// WithTokenPrices sets the per-1k-token prices used by /stats/cost.
+func WithTokenPrices(input, output float64) Option {
+	return func(h *Service) {
+		h.tokenPriceInput = input
+		h.tokenPriceOutput = output
+	}
+}
+
+// WithRollupRetention sets how many UTC day buckets the daily rollup keeps.
+func WithRollupRetention(days int) Option {
+	return func(h *Service) { h.rollupRetention = days }
+}
+
+// New creates a Service with production defaults, then applies opts.
+func New(opts ...Option) *Service {
+	h := &Service{
+		version:           "dev",
+		maxServices:       defaultMaxServices,
+		clock:             realClock{},
+		services:          make(map[string]bool),
+		unknownServices:   make(map[string]time.Time),
+		sla:               make(map[string]*slaState),
+		serviceMessages:   make(map[string]string),
+		heartbeatRegs:     make(map[string]*heartbeatReg),
+		everHealthy:       make(map[string]bool),
+		shards:            make(map[int]*shardState),
+		shardGrace:        defaultShardDisconnectGrace,
+		skewWarnThreshold: defaultSkewWarnThreshold,
+		listMaxBytes:      defaultListMaxBytes,
+		streamMaxItems:    defaultStreamMaxItems,
+		rollupRetention:   defaultRollupRetentionDays,
+		probeTimeout:      defaultProbeTimeout,
+		metricsTimeout:    defaultMetricsTimeout,
+		pushTimeout:       defaultPushTimeout,
+		statsTimeout:      defaultStatsTimeout,
+		collectorInterval: defaultCollectorInterval,
+		incidentCap:       defaultIncidentCap,
+		incidentDebounce:  defaultIncidentDebounce,
+		seriesLimit:       defaultSeriesLimit,
+		historyCapacity:   defaultHistoryCapacity,
+		guildBuckets:      defaultGuildBuckets,
+		writeRPS:          defaultWriteRPS,
+		writeBurst:        defaultWriteBurst,
+		maxInFlight:       defaultMaxInFlight,
+		maxConcurrent:     defaultMaxConcurrent,
+		queueWait:         defaultQueueWait,
+		allowedModels:     map[string]bool{},
+		rwAllowed:         map[string]bool{},
+		rwGauges:          map[string]prometheus.Gauge{},
+		summaryGauges:     make(map[string]*prometheus.GaugeVec),
+		diskPath:          defaultDiskPath,
+		logger:            slog.New(slog.NewJSONHandler(os.Stderr, nil)),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	// After options so an injected clock also anchors the uptime baseline and
+	// drives the rollup/ingest freshness logic.
+	h.startTime = h.clock.Now()
+	if h.registry == nil {
+		h.registry = prometheus.NewRegistry()
+		// Scrape parity with the pre-extraction default registry, which
+		// carried the standard Go and process collectors.
+		h.registry.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+	}
+	// The env-configured prefix wraps the registerer, so every collector
+	// below registers under <prefix>_<historical name> without any of them
+	// knowing about it. The Go/process collectors registered above keep their
+	// canonical names on purpose.
+	var reg prometheus.Registerer = h.registry
+	if h.metricsPrefix != "" {
+		reg = prometheus.WrapRegistererWithPrefix(h.metricsPrefix+"_", h.registry)
+	}
+	h.registerer = reg
+	h.metrics = newServiceMetrics(reg, h.requestDurationBuckets, h.aiResponseBuckets)
+	h.httpMetrics = NewHTTPMetrics(reg, "discord_bot")
+	// Probes bypass the shed: an orchestrator must see "alive but overloaded"
+	// rather than a 503 it would restart the pod over.
+	h.limiter = NewConcurrencyLimiter(reg, "discord_bot", h.maxConcurrent, h.queueWait,
+		"/health/live", "/health/ready", "/health/startup")
+	h.writeLimiter = rate.NewLimiter(rate.Limit(h.writeRPS), h.writeBurst)
+	h.tokenCosts = &tokenAccumulator{counts: make(map[tokenSeriesKey]float64)}
+	h.rollup = newDailyRollup(h.rollupRetention, h.clock)
+	h.incidentLog = newIncidentStore(h.incidentCap, h.incidentDebounce)
+	h.cardGuard = newCardinalityGuard(h.seriesLimit)
+	h.absCounters.last = make(map[string]float64)
+	h.breakers.items = make(map[string]*breakerEntry)
+	h.hyst = make(map[string]*hystState)
+	h.deps = make(map[string][]string)
+	h.history = newStatsRing(h.historyCapacity)
+	h.guilds.capacity = maxTrackedGuilds
+	h.guilds.counts = make(map[string]float64)
+	h.queues.depths = make(map[string]float64)
+	h.queues.overSince = make(map[string]time.Time)
+	h.alerts.states = make(map[string]*alertRuleState)
+	h.alerts.client = &http.Client{Timeout: alertWebhookTimeout}
+	if h.alertRulesPath != "" {
+		rules, err := loadAlertRules(h.alertRulesPath)
+		if err != nil {
+			// Fail loudly but keep serving: a health service that refuses to
+			// start over a typo in an alert file takes the probes down with it.
+			log.Printf("WARNING: invalid alert rules %s: %v — alerting disabled", h.alertRulesPath, err)
+		} else {
+			h.alerts.rules = rules
+			for _, r := range rules {
+				h.alerts.states[r.Name] = &alertRuleState{state: alertStateInactive}
+			}
+		}
+	}
+	h.commands.allowed = make(map[string]bool)
+	h.commands.counts = make(map[string]float64)
+	h.commands.duration = make(map[string]float64)
+	if h.commandAllowlistPath != "" {
+		allowed, err := loadCommandAllowlist(h.commandAllowlistPath)
+		if err != nil {
+			// Fail-safe: an unreadable file means an empty allowlist (every
+			// command collapses to "other"), never a startup failure.
+			log.Printf("WARNING: failed to read COMMAND_ALLOWLIST_PATH %q: %v — starting with an empty command allowlist", h.commandAllowlistPath, err)
+		} else {
+			h.commands.allowed = allowed
+		}
+	}
+	if h.traceEndpoint != "" {
+		h.tracer = newTracer(h.traceEndpoint, "health_api")
+	}
+	h.pushed = newIngestStore(ingestTTL, h.clock)
+	reg.MustRegister(h.pushed)
+	h.deprecations = NewDeprecationSet(reg, "discord_bot", h.clock, h.enforceSunset, h.pendingDeprecations...)
+	// Build identity: the standard build_info join gauge — constant 1 with
+	// identifying labels, so alerts can annotate any series with the running
+	// version/commit via group_left (see buildinfo.go).
+	h.build = ResolveBuildInfo()
+	buildGauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "discord_bot",
+		Name:      "build_info",
+		Help:      "Build identity of the running binary (constant 1; join on the labels)",
+	}, []string{"version", "commit", "go_version"})
+	reg.MustRegister(buildGauge)
+	buildGauge.WithLabelValues(h.version, h.build.GitCommit, h.build.GoVersion).Set(1)
+	// The live-config snapshot the request path reads, and the immutable-env
+	// baseline reloads diff against (see reload.go). Captured last so the
+	// snapshot reflects whatever the options decided.
+	h.liveCfg.Store(&Config{
+		AuthToken:         h.authToken,
+		MaxMemoryBytes:    h.maxMemoryBytes,
+		MaxGoroutines:     h.maxGoroutines,
+		SkewWarnThreshold: h.skewWarnThreshold,
+		Logger:            h.logger,
+		logEnv:            logEnvString(),
+	})
+	h.immutableEnv = captureImmutableEnv()
+	// Replay persisted dynamic metric registrations (see dynmetrics.go) —
+	// after the registerer exists, before the first scrape can happen.
+	h.dyn.metrics = make(map[string]*dynMetric)
+	h.loadDynSchemas()
+	return h
+}
+
+// OptionsFromEnv assembles the env-derived configuration — BOT_VERSION,
+// HEALTH_API_TOKEN, MAX_SERVICES, LIST_RESPONSE_MAX_BYTES, ALLOWED_MODELS,
+// TOKEN_PRICE_INPUT/TOKEN_PRICE_OUTPUT, ROLLUP_RETENTION_DAYS — as options
+// for New, so the env contract stays in one place. Binaries call it once at
+// startup; embedders that configure programmatically skip it.
+func OptionsFromEnv() []Option {
+	version := os.Getenv("BOT_VERSION")
+	if version == "" {
+		version = "dev"
+	}
+
+	// Bearer token for write endpoints. Empty = writes are rejected entirely.
+	// Read once at startup so a later env mutation can't sneak in a weaker
+	// value while the server is running.
+	authToken := os.Getenv("HEALTH_API_TOKEN")
+	if authToken == "" {
+		log.Println("WARNING: HEALTH_API_TOKEN not set — write endpoints (/health/service, /metrics/push, /metrics/batch) will refuse all requests")
+	}
+
+	return []Option{
+		WithVersion(version),
+		WithAuthToken(authToken),
+		WithMaxServices(maxServicesFromEnv()),
+		WithListMaxBytes(listMaxBytesFromEnv()),
+		WithStreamMaxItems(streamMaxItemsFromEnv()),
+		WithWriteRateLimit(writeRateFromEnv()),
+		WithMaxInFlight(maxInFlightFromEnv()),
+		WithAllowedModels(allowedModelsFromEnv()),
+		WithTokenPrices(tokenPriceFromEnv("TOKEN_PRICE_INPUT"), tokenPriceFromEnv("TOKEN_PRICE_OUTPUT")),
+		WithRollupRetention(rollupRetentionFromEnv()),
+		WithStartupRequirements(startupRequiredFromEnv(), startupGraceFromEnv()),
+		WithUnknownGrace(unknownGraceFromEnv()),
+		WithHandlerTimeouts(
+			timeoutFromEnv("PROBE_TIMEOUT_SECONDS", defaultProbeTimeout),
+			timeoutFromEnv("METRICS_TIMEOUT_SECONDS", defaultMetricsTimeout),
+			timeoutFromEnv("PUSH_TIMEOUT_SECONDS", defaultPushTimeout),
+			timeoutFromEnv("STATS_TIMEOUT_SECONDS", defaultStatsTimeout),
+		),
+		WithRuntimeThresholds(maxMemoryFromEnv(), maxGoroutinesFromEnv()),
+		WithMemoryTrend(memTrendFromEnv()),
+		WithIncidentCap(maxIncidentsFromEnv()),
+		WithCORSOrigins(corsOriginsFromEnv()),
+		WithTrustedPushCIDRs(trustedCIDRsFromEnv(), trustProxyFromEnv()),
+		WithRemoteWriteAllowlist(remoteWriteAllowlistFromEnv()),
+		WithMetricSchemaPath(metricSchemaPathFromEnv()),
+		WithIncidentDebounce(incidentDebounceFromEnv()),
+		WithSeriesLimit(seriesLimitFromEnv()),
+		WithBreakerHealthImpact(breakerAffectsHealthFromEnv()),
+		WithTraceEndpoint(traceEndpointFromEnv()),
+		WithReadinessHysteresis(hysteresisFromEnv()),
+		WithHistoryCapacity(historyCapacityFromEnv()),
+		WithCommandAllowlist(commandAllowlistFromEnv()),
+		WithGuildBuckets(guildBucketsFromEnv()),
+		WithQueueBacklogThreshold(queueThresholdFromEnv(), queueGraceFromEnv()),
+		WithAlertRules(alertRulesFromEnv()),
+		WithAlertWebhook(alertWebhookFromEnv()),
+		WithDiskPath(diskPathFromEnv()),
+		WithShardDisconnectGrace(shardGraceFromEnv()),
+		WithClockSkewWarnThreshold(skewWarnFromEnv()),
+		WithMaxConcurrent(maxConcurrentFromEnv()),
+		WithQueueWait(queueWaitFromEnv()),
+		WithCollectorInterval(collectorIntervalFromEnv()),
+		WithLogger(loggerFromEnv()),
+		WithDeprecations(DeprecationsFromEnv()),
+		WithSunsetEnforcement(SunsetEnforcementFromEnv()),
+	}
+}
+
+// maxServicesFromEnv reads the MAX_SERVICES cap override. Anything that isn't a
+// positive integer (including 0 — a zero cap would reject every registration,
+// which is never what an operator meant) is rejected with a warning and the
+// default is kept, so a typo can't silently break service registration.
+func maxServicesFromEnv() int {
+	raw := strings.TrimSpace(os.Getenv("MAX_SERVICES"))
+	if raw == "" {
+		return defaultMaxServices
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("WARNING: invalid MAX_SERVICES %q (must be a positive integer) — using default %d", raw, defaultMaxServices)
+		return defaultMaxServices
+	}
+	return n
+}
+
+// SetServiceStatus sets the status of a service.
+// Returns false if the service map is full and the name is new — updates to
+// EXISTING keys are always allowed, even at the cap, so a known service can
+// still flip healthy/unhealthy. Rejections are counted on
+// discord_bot_service_registrations_rejected_total so they can be alerted on
+// instead of only showing up as a log line.
+func (h *Service) SetServiceStatus(name string, healthy bool) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// Only allow update for existing keys or insert if under cap. Unknown
+	// seeds (see initial.go) already hold a slot, so promoting one is never
+	// rejected.
+	if _, exists := h.services[name]; !exists {
+		if _, seeded := h.unknownServices[name]; !seeded && len(h.services)+len(h.unknownServices) >= h.maxServices {
+			log.Printf("WARNING: service map full (%d), rejecting new service: %s", h.maxServices, name)
+			h.metrics.serviceRegistrationsRejected.Inc()
+			return false
+		}
+	}
+	h.setServiceStatusLocked(name, healthy, h.clock.Now())
+	h.publishStatusSnapshotLocked()
+	return true
+}
+
+// setServiceStatusLocked applies one status write — map update, startup
+// bookkeeping, hysteresis, SLA and incident edges — WITHOUT publishing the
+// snapshot, so a batch caller (see servicebatch.go) can apply many writes and
+// publish once. Caller holds mu and owns the publish.
+func (h *Service) setServiceStatusLocked(name string, healthy bool, now time.Time) {
+	prev, exists := h.services[name]
+	h.services[name] = healthy
+	// First real report promotes the service out of "unknown" (see
+	// initial.go) — real state always wins.
+	delete(h.unknownServices, name)
+	if healthy {
+		// First-ever healthy report feeds the startup probe (see startup.go).
+		h.everHealthy[name] = true
+	}
+	h.recordHysteresisLocked(name, healthy, now)
+	// Health edges drive the availability tallies (see sla.go) and the
+	// incident log (see incidents.go). A brand-new service reporting
+	// unhealthy is an outage too; the incident store takes its own lock, so
+	// calling under mu is safe.
+	h.recordSLATransitionLocked(name, healthy, prev, exists, now)
+	if !healthy && (prev || !exists) {
+		h.incidentLog.openIncident(name, now)
+	} else if healthy && exists && !prev {
+		h.incidentLog.resolve(name, now)
+	}
+}
+
+// GetStatus returns the current health status
+func (h *Service) GetStatus() HealthStatus {
+	// Read the cached MemStats snapshot (see the cachedMem* fields) instead of
+	// a per-request stop-the-world runtime.ReadMemStats. NumGoroutine() is
+	// cheap, so keep it live.
+	memAlloc := h.cachedMemAlloc.Load()
+	memSys := h.cachedMemSys.Load()
+	numGC := h.cachedNumGC.Load()
+
+	// Lazily end an expired maintenance window before snapshotting.
+	h.expireMaintenance()
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	// Services and the service-derived aggregate come from the published
+	// snapshot (see snapshot.go) — no per-request copy; the map handed out
+	// below is immutable and shared.
+	snap := h.loadStatusSnapshot()
+	status := snap.status
+	// With hysteresis configured the effective states, not the raw reported
+	// ones, decide the service-derived aggregate (see hysteresis.go).
+	var effective map[string]bool
+	if h.hystCfg.enabled() {
+		var anyDown bool
+		effective, anyDown = h.effectiveServicesLocked(h.clock.Now())
+		if anyDown {
+			status = "degraded"
+		} else {
+			status = "healthy"
+		}
+	}
+	// Scheduled downtime (see downtime.go): when every service dragging the
+	// aggregate down sits inside an active window, the degradation is planned
+	// and the aggregate stays healthy.
+	downFrom := snap.services
+	if effective != nil {
+		downFrom = effective
+	}
+	suppressed, unsuppressedDown := h.downtimeView(downFrom, h.clock.Now())
+	if status == "degraded" && len(suppressed) > 0 && !unsuppressedDown {
+		status = "healthy"
+	}
+	// Maintenance outranks healthy/degraded: the instance is deliberately
+	// asking to be drained, which is more specific than either.
+	if h.maintEnabled {
+		status = maintenanceStatus
+	}
+
+	lastHeartbeat := ""
+	if !h.lastHeartbeat.IsZero() {
+		lastHeartbeat = formatTimestamp(h.lastHeartbeat)
+	}
+
+	var heartbeats map[string]HeartbeatInfo
+	if len(h.heartbeatRegs) > 0 {
+		heartbeats = make(map[string]HeartbeatInfo, len(h.heartbeatRegs))
+		for name, reg := range h.heartbeatRegs {
+			heartbeats[name] = HeartbeatInfo{
+				LastSeen:        formatTimestamp(reg.lastSeen),
+				IntervalSeconds: reg.intervalSeconds,
+			}
+		}
+	}
+
+	metricsMap := map[string]any{
+		"memory_alloc_mb": float64(memAlloc) / 1024 / 1024,
+		"memory_sys_mb":   float64(memSys) / 1024 / 1024,
+		"goroutines":      runtime.NumGoroutine(),
+		"gc_cycles":       numGC,
+	}
+	// Present only once a client_timestamp has been observed, so deployments
+	// that never send one keep the historical key set.
+	if ms, ok := h.maxSkewMillisLocked(); ok {
+		metricsMap["max_clock_skew_ms"] = ms
+	}
+	// Extended stats (see sysstats.go) appear only once a sample succeeded,
+	// so non-Linux hosts keep the historical key set.
+	if h.sysStatsOK.Load() {
+		metricsMap["cpu_seconds"] = h.cachedCPUSeconds.Load()
+		metricsMap["open_fds"] = h.cachedOpenFDs.Load()
+		metricsMap["max_fds"] = h.cachedMaxFDs.Load()
+		metricsMap["disk_free_mb"] = float64(h.cachedDiskFree.Load()) / 1024 / 1024
+	}
+
+	now := h.clock.Now()
+	shards, shardOverdue := h.shardsLocked(now)
+	// A shard disconnected past its grace window degrades aggregate status —
+	// but never upgrades it, and maintenance still outranks everything.
+	if shardOverdue && status == "healthy" {
+		status = "degraded"
+	}
+	// Open circuit breakers are always visible; whether they degrade is the
+	// operator's call (BREAKER_AFFECTS_HEALTH).
+	openBreakers := h.breakers.open()
+	if h.breakerAffectsHealth && len(openBreakers) > 0 && status == "healthy" {
+		status = "degraded"
+	}
+	// A sustained queue backlog (see queues.go) degrades the aggregate and
+	// surfaces as a synthetic "queues" pseudo-service so dashboards keyed on
+	// the services map light up without a schema change.
+	services := snap.services
+	if overdueQueues := h.queues.overdue(now); len(overdueQueues) > 0 {
+		if status == "healthy" {
+			status = "degraded"
+		}
+		withQueues := make(map[string]bool, len(services)+1)
+		for name, healthy := range services {
+			withQueues[name] = healthy
+		}
+		withQueues["queues"] = false
+		services = withQueues
+	}
+	// Root-cause classification (see deps.go); nils until a dependency is
+	// declared, keeping the historical key set.
+	serviceStates, rootCauses := h.classifyServicesLocked(snap.services)
+	return HealthStatus{
+		Status:              status,
+		Timestamp:           formatTimestamp(now),
+		Version:             h.version,
+		Build:               h.build,
+		Uptime:              now.Sub(h.startTime).String(),
+		Services:            services,
+		HeartbeatGeneration: h.heartbeatGeneration,
+		LastHeartbeat:       lastHeartbeat,
+		Heartbeats:          heartbeats,
+		Shards:              shards,
+		Maintenance:         h.maintenanceInfoLocked(),
+		OpenBreakers:        openBreakers,
+		EffectiveServices:   effective,
+		ServiceStates:       serviceStates,
+		RootCauses:          rootCauses,
+		SuppressedServices:  suppressed,
+		UnknownServices:     h.unknownNamesLocked(),
+		Metrics:             metricsMap,
+	}
+}
+
+// ReadinessReport is the machine-readable body of /health/ready: every input
+// the readiness decision actually consumed, so `kubectl describe` shows WHY a
+// pod is not ready instead of the bare "NOT READY" string. Reasons are stable
+// machine-parsable strings ("service_unhealthy:<name>"); new gating conditions
+// (maintenance, draining, startup grace, ...) append their own reasons here.
+type ReadinessReport struct {
+	Ready    bool            `json:"ready"`
+	Status   string          `json:"status"`
+	Services map[string]bool `json:"services"`
+	Reasons  []string        `json:"reasons,omitempty"`
+}
+
+// AggregateStatus returns just the overall status string — the published
+// snapshot's aggregate with the maintenance and shard-grace overrides
+// applied. Probes that only need healthy/degraded/maintenance (readiness
+// being the main one) use this instead of GetStatus, which also assembles
+// the metrics map, heartbeat and shard copies per call.
+func (h *Service) AggregateStatus() string {
+	h.expireMaintenance()
+	snap := h.loadStatusSnapshot()
+	status := snap.status
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	// Hysteresis replaces the snapshot's service-derived aggregate with the
+	// effective one; the maintenance/shard/breaker overrides still apply.
+	downFrom := snap.services
+	if h.hystCfg.enabled() {
+		effective, anyDown := h.effectiveServicesLocked(h.clock.Now())
+		downFrom = effective
+		if anyDown {
+			status = "degraded"
+		} else {
+			status = "healthy"
+		}
+	}
+	// Planned downtime suppresses the service-derived degradation (see
+	// downtime.go), same rule as GetStatus.
+	if status == "degraded" {
+		if suppressed, unsuppressedDown := h.downtimeView(downFrom, h.clock.Now()); len(suppressed) > 0 && !unsuppressedDown {
+			status = "healthy"
+		}
+	}
+	if h.maintEnabled {
+		return maintenanceStatus
+	}
+	if status == "healthy" && h.shardsOverdueLocked(h.clock.Now()) {
+		status = "degraded"
+	}
+	if status == "healthy" && h.breakerAffectsHealth && len(h.breakers.open()) > 0 {
+		status = "degraded"
+	}
+	if status == "healthy" && len(h.queues.overdue(h.clock.Now())) > 0 {
+		status = "degraded"
+	}
+	return status
+}
+
+// GetReadinessReport builds the readiness decision and its inputs from the
+// cached status snapshot and the cheap aggregate accessor — no MemStats
+// reads or metrics-map assembly at all, so a 1s kube probe costs a pointer
+// load plus the maintenance/shard checks.
+func (h *Service) GetReadinessReport() ReadinessReport {
+	status := h.AggregateStatus()
+	snap := h.loadStatusSnapshot()
+	h.mu.RLock()
+	maintenance := h.maintenanceInfoLocked()
+	// With hysteresis on, the effective states are what gated Status above, so
+	// the reasons must come from the same view or they'd contradict it.
+	unhealthyFrom := snap.services
+	if h.hystCfg.enabled() {
+		unhealthyFrom, _ = h.effectiveServicesLocked(h.clock.Now())
+	}
+	staleUnknown := h.staleUnknownLocked(h.clock.Now())
+	h.mu.RUnlock()
+	report := ReadinessReport{
+		Ready:    status == "healthy",
+		Status:   status,
+		Services: snap.services,
+	}
+	for name, healthy := range unhealthyFrom {
+		if !healthy {
+			// A service inside an active downtime window didn't gate Status
+			// above, so it must not appear as a readiness reason either.
+			if h.downtime.activeFor(name, h.clock.Now()) {
+				continue
+			}
+			report.Reasons = append(report.Reasons, "service_unhealthy:"+name)
+		}
+	}
+	if h.breakerAffectsHealth {
+		for _, name := range h.breakers.open() {
+			report.Reasons = append(report.Reasons, "circuit_breaker_open:"+name)
+		}
+	}
+	for _, name := range h.queues.overdue(h.clock.Now()) {
+		report.Reasons = append(report.Reasons, "queue_backlog:"+name)
+	}
+	// A service still unknown past the startup window (see initial.go) gates
+	// readiness even though it never degrades the aggregate — "hasn't
+	// reported yet" has become "never wired up".
+	for _, name := range staleUnknown {
+		report.Ready = false
+		report.Reasons = append(report.Reasons, "service_unknown:"+name)
+	}
+	if maintenance != nil {
+		// Same prefix:detail shape as service_unhealthy; the free-text reason
+		// (already sanitized at ingest) rides behind the stable prefix.
+		reason := "maintenance"
+		if maintenance.Reason != "" {
+			reason += ":" + maintenance.Reason
+		}
+		report.Reasons = append(report.Reasons, reason)
+	}
+	// Shutdown drain outranks everything: NOT READY from the first probe
+	// after BeginShutdown, so upstreams stop routing here while the listener
+	// is still up finishing in-flight requests (see shutdown.go).
+	if h.shuttingDown.Load() {
+		report.Ready = false
+		report.Reasons = append(report.Reasons, "shutting_down")
+	}
+	sort.Strings(report.Reasons) // deterministic order for clients and tests
+	return report
+}
+
+// wantsPlainText reports whether the probe explicitly asked for text/plain
+// (dumb probes that can't parse JSON). First recognized media type in the
+// Accept header wins; JSON stays the default for everything else.
+func wantsPlainText(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		switch strings.ToLower(strings.TrimSpace(strings.SplitN(part, ";", 2)[0])) {
+		case "text/plain":
+			return true
+		case "application/json":
+			return false
+		}
+	}
+	return false
+}
+
+// --- pagination ------------------------------------------------------------
+//
+// Shared envelope for every endpoint that returns a collection, so list
+// responses can't grow unbounded as features land. limit/offset query params
+// with defaults and a hard maximum, a total count, Link-style next/prev hints,
+// and a byte ceiling: a window that still encodes too large is halved until it
+// fits, with truncated=true, instead of OOMing the encoder.
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+	// defaultListMaxBytes bounds an encoded list body. Overridable via
+	// LIST_RESPONSE_MAX_BYTES (see listMaxBytesFromEnv).
+	defaultListMaxBytes = 256 * 1024
+)
+
+// listMaxBytesFromEnv reads the LIST_RESPONSE_MAX_BYTES override. Same
+// validation posture as maxServicesFromEnv: non-positive or unparsable values
+// warn and keep the default.
+func listMaxBytesFromEnv() int {
+	raw := strings.TrimSpace(os.Getenv("LIST_RESPONSE_MAX_BYTES"))
+	if raw == "" {
+		return defaultListMaxBytes
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("WARNING: invalid LIST_RESPONSE_MAX_BYTES %q (must be a positive integer) — using default %d", raw, defaultListMaxBytes)
+		return defaultListMaxBytes
+	}
+	return n
+}
+
+// pageParams are the parsed limit/offset pagination query params.
+type pageParams struct {
+	Limit  int
+	Offset int
+}
+
+// parsePageParams parses limit/offset. Invalid or out-of-range values fall
+// back to the defaults/caps (fail-safe) rather than erroring — probes and
+// dashboards shouldn't 400 on a sloppy query string.
+func parsePageParams(q url.Values) pageParams {
+	p := pageParams{Limit: defaultPageLimit}
+	if raw := q.Get("limit"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			p.Limit = min(n, maxPageLimit)
+		}
+	}
+	if raw := q.Get("offset"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			p.Offset = n
+		}
+	}
+	return p
+}
+
+// paginate returns the [start, end) window bounds over total items.
+func paginate(total int, p pageParams) (start, end int) {
+	start = min(p.Offset, total)
+	end = min(start+p.Limit, total)
+	return start, end
+}
+
+// listResponse is the common envelope for paginated collections.
+type listResponse struct {
+	Items     any    `json:"items"`
+	Total     int    `json:"total"`
+	Limit     int    `json:"limit"`
+	Offset    int    `json:"offset"`
+	Next      string `json:"next,omitempty"`
+	Prev      string `json:"prev,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// pageLink rebuilds reqURL with a different offset for next/prev hints.
+func pageLink(reqURL *url.URL, p pageParams, offset int) string {
+	u := *reqURL
+	q := u.Query()
+	q.Set("limit", strconv.Itoa(p.Limit))
+	q.Set("offset", strconv.Itoa(offset))
+	u.RawQuery = q.Encode()
+	return u.RequestURI()
+}
+
+// writeListResponse encodes the already-windowed items inside the common
+// envelope. If the encoded body exceeds maxBytes the window is halved
+// (repeatedly) and Truncated is set — the Total stays honest so clients can
+// re-request with a smaller limit.
+func writeListResponse[T any](w http.ResponseWriter, reqURL *url.URL, total int, p pageParams, items []T, maxBytes int) {
+	resp := listResponse{
+		Total:  total,
+		Limit:  p.Limit,
+		Offset: p.Offset,
+	}
+	if p.Offset+len(items) < total {
+		resp.Next = pageLink(reqURL, p, p.Offset+p.Limit)
+	}
+	if p.Offset > 0 {
+		resp.Prev = pageLink(reqURL, p, max(p.Offset-p.Limit, 0))
+	}
+
+	for {
+		resp.Items = items
+		encoded, err := json.Marshal(resp)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, errCodeInternal, "encoding failed", nil)
+			return
+		}
+		if len(encoded) <= maxBytes || len(items) == 0 {
+			w.Header().Set("Content-Type", "application/json")
+			if _, werr := w.Write(encoded); werr != nil {
+				log.Printf("Failed to write list response: %v", werr)
+			}
+			return
+		}
+		items = items[:len(items)/2]
+		resp.Truncated = true
+	}
+}
+
+// defaultCollectorInterval is the collector tick and the ReadMemStats
+// sampling floor. 2s keeps the dashboard figures fresh while bounding the
+// stop-the-world cost to one pause per interval regardless of probe traffic.
+const defaultCollectorInterval = 2 * time.Second
+
+// WithCollectorInterval overrides the collector tick / MemStats sampling
+// floor; non-positive values are ignored.
+func WithCollectorInterval(d time.Duration) Option {
+	return func(h *Service) {
+		if d > 0 {
+			h.collectorInterval = d
+		}
+	}
+}
+
+// collectorIntervalFromEnv reads the MEMSTATS_INTERVAL_MS override with the
+// usual fail-safe posture.
+func collectorIntervalFromEnv() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("MEMSTATS_INTERVAL_MS"))
+	if raw == "" {
+		return defaultCollectorInterval
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("WARNING: invalid MEMSTATS_INTERVAL_MS %q (must be a positive integer) — using default %s", raw, defaultCollectorInterval)
+		return defaultCollectorInterval
+	}
+	return time.Duration(n) * time.Millisecond
+}
+
+// CollectSystemMetrics updates system metrics. This is the ONLY place that
+// calls the stop-the-world runtime.ReadMemStats (on the collector tick);
+// GetStatus reads the cached snapshot it stores here. Exported so binaries
+// can prime the snapshot once before starting the collector. Calls landing
+// within collectorInterval of the previous sample are dropped, so the STW
+// pause happens at most once per interval no matter who calls this.
+func (h *Service) CollectSystemMetrics() {
+	now := h.clock.Now().UnixNano()
+	last := h.lastMemSample.Load()
+	if last != 0 && now-last < h.collectorInterval.Nanoseconds() {
+		return
+	}
+	if !h.lastMemSample.CompareAndSwap(last, now) {
+		return // another caller won the sample; theirs is fresh enough
+	}
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	h.cachedMemAlloc.Store(m.Alloc)
+	h.cachedMemSys.Store(m.Sys)
+	h.cachedNumGC.Store(m.NumGC)
+	h.metrics.memoryUsage.Set(float64(m.Alloc))
+	h.recordGCStats(&m)
+	goroutines := runtime.NumGoroutine()
+	h.metrics.goroutineCount.Set(float64(goroutines))
+	h.collectSysStats()
+	h.checkRuntimeThresholds(m.Alloc, goroutines)
+	h.checkMemoryTrend(m.Alloc)
+	// Guild-count decay rides the collector tick too (see guilds.go).
+	h.guilds.maybeDecay(h.clock.Now())
+	// One history point per sample (see history.go) — the ring shares the
+	// collector's cadence, so its retention is capacity × interval.
+	h.history.record(statPoint{
+		at:         h.clock.Now(),
+		alloc:      m.Alloc,
+		sys:        m.Sys,
+		goroutines: int32(goroutines),
+		gcCycles:   m.NumGC,
+		status:     historyStatusCode(h.AggregateStatus()),
+	})
+	// Alert rules evaluate on the same cadence (see alerts.go).
+	h.evaluateAlerts(h.clock.Now())
+}
+
+// StartCollector runs the system-metrics refresh loop until ctx is cancelled.
+// Run it as a goroutine: `go svc.StartCollector(ctx)`.
+func (h *Service) StartCollector(ctx context.Context) {
+	ticker := h.clock.NewTicker(h.collectorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Metrics collector stopped")
+			return
+		case <-ticker.C():
+			h.CollectSystemMetrics()
+		}
+	}
+}
+
+// sanitizeLabel truncates and cleans a Prometheus label value to prevent
+// cardinality explosion from arbitrary user-supplied values.
+func sanitizeLabel(value string) string {
+	if len(value) > maxLabelLength {
+		value = value[:maxLabelLength]
+	}
+	return value
+}
+
+// allowedMetricNames restricts which metric names are accepted via push endpoints.
+var allowedMetricNames = map[string]bool{
+	"requests": true, "rate_limit": true, "cache": true, "tokens": true,
+	"request_duration": true, "ai_response_time": true,
+	"active_connections": true, "circuit_breaker": true,
+	"command_invocations": true, "command_duration": true,
+	"guild_activity": true,
+	"queue_depth":    true, "queue_oldest_age_seconds": true, "queue_dropped": true,
+}
+
+// allowedLabelValues restricts label values to a known set to prevent cardinality
+// explosion. The endpoint label is the exception: it moved to the budgeted
+// pass-through in cardinality.go, because an allowlist here threw away the
+// per-endpoint granularity the request dashboards exist for.
+var allowedLabelValues = map[string]map[string]bool{
+	"status":  {"success": true, "error": true, "timeout": true, "other": true},
+	"result":  {"hit": true, "miss": true},
+	"type":    {"input": true, "output": true, "user": true, "channel": true, "guild": true},
+	"service": {"gemini": true, "spotify": true, "database": true, "health": true, "url_fetcher": true},
+	"queue":   {"message_processing": true, "ai_request": true, "webhook_retry": true, "other": true},
+}
+
+// maxLabelsPerPayload caps how many labels one pushed payload may carry. The
+// widest declared schema today has two keys; eight leaves generous headroom
+// without letting a confused client ship a whole attribute bag per sample.
+const maxLabelsPerPayload = 8
+
+// metricLabelSchemas declares, per pushed metric name, the label keys the
+// payload may carry and the default substituted when a label is absent or
+// empty/whitespace-only. Before this existed, `"labels": {"endpoint": ""}`
+// minted a real empty-string series and "Status" vs "status" fragmented
+// series by case. Defaults mirror what an unlabeled payload has always meant
+// semantically (an unqualified request IS a success) rather than the
+// catch-all "other" bucket junk VALUES collapse to. The model key declares no
+// default: safeModelLabel already owns the empty-to-"unknown" mapping, and a
+// literal "unknown" here would bounce off its allowlist into "other".
+var metricLabelSchemas = map[string]map[string]string{
+	"requests":           {"status": "success", "endpoint": "other"},
+	"rate_limit":         {"type": "other"},
+	"cache":              {"result": "other"},
+	"tokens":             {"type": "other", "model": ""},
+	"request_duration":   {"endpoint": "other"},
+	"ai_response_time":   {"model": ""},
+	"active_connections": {},
+	"circuit_breaker":    {"service": "other"},
+	// The command key declares no default: commandStore.safeLabel owns the
+	// empty-to-"other" mapping alongside the allowlist check (see commands.go).
+	"command_invocations": {"command": "", "status": "success"},
+	"command_duration":    {"command": ""},
+	// No default for guild: a guild_activity payload without one is
+	// meaningless and is rejected (see the applyMetric arm).
+	"guild_activity":           {"guild": ""},
+	"queue_depth":              {"queue": "other"},
+	"queue_oldest_age_seconds": {"queue": "other"},
+	"queue_dropped":            {"queue": "other"},
+}
+
+// summaryLabelSchema covers every summary_set payload (their metric names are
+// dynamic, but the label shape is fixed). The empty default means an absent
+// quantile stays absent — applySummarySet then rejects it as invalid_quantile,
+// because there is no sane quantile to assume.
+var summaryLabelSchema = map[string]string{"quantile": ""}
+
+// normalizeLabels canonicalizes a payload's label map against its metric's
+// declared schema: keys are lowercased and trimmed, keys outside the schema
+// are rejected, two keys collapsing onto the same canonical key with
+// conflicting values are rejected (which of "Status" and "status" did the
+// client mean?), empty/whitespace-only values are treated as absent, and
+// absent keys take the schema default. Returns the normalized map and "" on
+// success, or nil and a stable reason constant. Every ingestion path shares
+// this via applyMetric, so push/batch/stream/statsd can never diverge.
+//
+// Unknown metric names pass through untouched: applyMetric owns that
+// rejection and its reasonUnknownName is the more useful diagnosis.
+func normalizeLabels(name, typ string, labels map[string]string) (map[string]string, string) {
+	schema := metricLabelSchemas[name]
+	if typ == "summary_set" {
+		schema = summaryLabelSchema
+	}
+	if schema == nil {
+		return labels, ""
+	}
+	if len(labels) > maxLabelsPerPayload {
+		return nil, reasonTooManyLabels
+	}
+
+	normalized := make(map[string]string, len(schema))
+	for key, value := range labels {
+		canonical := strings.ToLower(strings.TrimSpace(key))
+		if _, allowed := schema[canonical]; !allowed {
+			return nil, reasonUnknownLabel
+		}
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if existing, ok := normalized[canonical]; ok && existing != value {
+			return nil, reasonDuplicateLabel
+		}
+		normalized[canonical] = value
+	}
+	for key, def := range schema {
+		if _, ok := normalized[key]; !ok && def != "" {
+			normalized[key] = def
+		}
+	}
+	return normalized, ""
+}
+
+// allowedModelsFromEnv parses ALLOWED_MODELS, a comma-separated list of model
+// names. Same fail-safe posture as the other *FromEnv helpers: garbage entries
+// (empty after trimming) are dropped rather than failing startup.
+func allowedModelsFromEnv() map[string]bool {
+	models := map[string]bool{}
+	for _, m := range strings.Split(os.Getenv("ALLOWED_MODELS"), ",") {
+		m = strings.TrimSpace(m)
+		if m != "" {
+			models[sanitizeLabel(m)] = true
+		}
+	}
+	return models
+}
+
+// safeModelLabel maps a pushed model label onto a bounded set: the empty
+// value (payloads from before the label existed) stays "unknown" so the
+// Python side keeps working mid-deploy, allowlisted names (h.allowedModels,
+// deploy-time data from ALLOWED_MODELS — the model roster changes faster than
+// this service does) pass through, and anything else collapses to "other" —
+// same cardinality posture as safeLabel.
+func (h *Service) safeModelLabel(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	sanitized := sanitizeLabel(value)
+	if h.allowedModels[sanitized] {
+		return sanitized
+	}
+	return "other"
+}
+
+// --- AI cost estimation (/stats/cost) --------------------------------------
+//
+// Prometheus counters can't be read back cheaply (a scrape is not a query
+// API), so the token totals that /stats/cost needs are mirrored into a small
+// mutex-guarded accumulator bumped in the SAME code path as tokensUsed
+// (applyMetric's "tokens" arm) — the two can't drift. Prices are per 1k
+// tokens (see WithTokenPrices / TOKEN_PRICE_INPUT / TOKEN_PRICE_OUTPUT).
+
+// tokenSeriesKey identifies one accumulated token series; both fields hold
+// POST-sanitization values (safeLabel / safeModelLabel), so the key space is
+// bounded exactly like the Prometheus label space.
+type tokenSeriesKey struct {
+	Type  string
+	Model string
+}
+
+type tokenAccumulator struct {
+	mu        sync.Mutex
+	counts    map[tokenSeriesKey]float64
+	lastReset time.Time // zero until the first reset=true admin action
+}
+
+func (a *tokenAccumulator) add(typ, model string, n float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.counts[tokenSeriesKey{Type: typ, Model: model}] += n
+}
+
+func (a *tokenAccumulator) snapshot() (map[tokenSeriesKey]float64, time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make(map[tokenSeriesKey]float64, len(a.counts))
+	for k, v := range a.counts {
+		out[k] = v
+	}
+	return out, a.lastReset
+}
+
+func (a *tokenAccumulator) reset(now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.counts = make(map[tokenSeriesKey]float64)
+	a.lastReset = now
+}
+
+// --- Prometheus text ingestion (/metrics/ingest) ----------------------------
+//
+// The Python process already speaks Prometheus text exposition via
+// prometheus_client; re-encoding each sample into MetricsPayload JSON was
+// wasteful and lossy (histograms flattened to observations). /metrics/ingest
+// accepts the standard text format, keeps families whose name carries the
+// allowlisted prefix, and re-exports them through this registry under the
+// "pushed_" namespace so one scrape of the Go service covers both processes.
+// Families that stop being pushed go stale and are dropped after a TTL —
+// re-exporting a dead process's last numbers forever would lie to alerts.
+
+const (
+	// ingestAllowedPrefix gates which pushed families are accepted. The
+	// Python exporter namespaces its own metrics with bot_.
+	ingestAllowedPrefix = "bot_"
+	// ingestExportPrefix namespaces re-exported families so they can never
+	// collide with (or spoof) this service's own discord_bot_* metrics.
+	ingestExportPrefix = "pushed_"
+	// ingestTTL is how long a family survives without being re-pushed.
+	ingestTTL = 5 * time.Minute
+)
+
+// Stable reasons for the per-family error list (same contract as the push
+// reason* constants: machine-readable, never free text).
+const (
+	ingestReasonNotAllowed      = "name_not_allowed"
+	ingestReasonUnsupportedType = "unsupported_type"
+)
+
+// ingestFamily is one retained metric family plus its freshness stamp.
+type ingestFamily struct {
+	mf       *dto.MetricFamily
+	lastPush time.Time
+}
+
+// ingestStore retains pushed families and re-exports them as an unchecked
+// prometheus.Collector (Describe sends nothing because the set of descriptors
+// changes with every push).
+type ingestStore struct {
+	mu       sync.Mutex
+	families map[string]*ingestFamily
+	ttl      time.Duration
+	clock    Clock
+}
+
+func newIngestStore(ttl time.Duration, clock Clock) *ingestStore {
+	return &ingestStore{
+		families: make(map[string]*ingestFamily),
+		ttl:      ttl,
+		clock:    clock,
+	}
+}
+
+// ingestable reports whether a family type can be re-exported as a const
+// metric. Summaries and untyped samples are rejected — a re-exported summary
+// would need quantile streams we don't have.
+func ingestable(t dto.MetricType) bool {
+	switch t {
+	case dto.MetricType_COUNTER, dto.MetricType_GAUGE, dto.MetricType_HISTOGRAM:
+		return true
+	default:
+		return false
+	}
+}
+
+// absorb filters and retains one parsed exposition. Returns the number of
+// accepted families and the per-family rejection list.
+func (s *ingestStore) absorb(families map[string]*dto.MetricFamily) (int, []ingestFamilyError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	accepted := 0
+	var errs []ingestFamilyError
+	for name, mf := range families {
+		if !strings.HasPrefix(name, ingestAllowedPrefix) {
+			errs = append(errs, ingestFamilyError{Family: name, Reason: ingestReasonNotAllowed})
+			continue
+		}
+		if !ingestable(mf.GetType()) {
+			errs = append(errs, ingestFamilyError{Family: name, Reason: ingestReasonUnsupportedType})
+			continue
+		}
+		s.families[name] = &ingestFamily{mf: mf, lastPush: now}
+		accepted++
+	}
+	s.dropStale(now)
+	// Deterministic error order for clients and tests.
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Family < errs[j].Family })
+	return accepted, errs
+}
+
+// dropStale removes families older than the TTL. Callers hold s.mu.
+func (s *ingestStore) dropStale(now time.Time) {
+	for name, fam := range s.families {
+		if now.Sub(fam.lastPush) > s.ttl {
+			delete(s.families, name)
+		}
+	}
+}
+
+// Describe intentionally sends nothing: the descriptor set changes with every
+// push, which is exactly what unchecked collectors are for.
+func (s *ingestStore) Describe(_ chan<- *prometheus.Desc) {}
+
+// Collect re-exports the retained families as const metrics under the
+// ingestExportPrefix namespace.
+func (s *ingestStore) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropStale(s.clock.Now())
+	for name, fam := range s.families {
+		exportName := ingestExportPrefix + name
+		help := fam.mf.GetHelp()
+		for _, m := range fam.mf.GetMetric() {
+			labelNames := make([]string, 0, len(m.GetLabel()))
+			labelValues := make([]string, 0, len(m.GetLabel()))
+			for _, lp := range m.GetLabel() {
+				labelNames = append(labelNames, lp.GetName())
+				labelValues = append(labelValues, lp.GetValue())
+			}
+			desc := prometheus.NewDesc(exportName, help, labelNames, nil)
+
+			var metric prometheus.Metric
+			var err error
+			switch fam.mf.GetType() {
+			case dto.MetricType_COUNTER:
+				metric, err = prometheus.NewConstMetric(desc, prometheus.CounterValue, m.GetCounter().GetValue(), labelValues...)
+			case dto.MetricType_GAUGE:
+				metric, err = prometheus.NewConstMetric(desc, prometheus.GaugeValue, m.GetGauge().GetValue(), labelValues...)
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				buckets := make(map[float64]uint64, len(h.GetBucket()))
+				for _, b := range h.GetBucket() {
+					// NewConstHistogram derives the +Inf bucket from the
+					// total count itself.
+					if !math.IsInf(b.GetUpperBound(), +1) {
+						buckets[b.GetUpperBound()] = b.GetCumulativeCount()
+					}
+				}
+				metric, err = prometheus.NewConstHistogram(desc, h.GetSampleCount(), h.GetSampleSum(), buckets, labelValues...)
+			}
+			if err != nil {
+				// A malformed metric (e.g. inconsistent labels) must not
+				// poison the whole scrape — skip it and keep collecting.
+				log.Printf("WARNING: skipping re-export of %s: %v", exportName, err)
+				continue
+			}
+			ch <- metric
+		}
+	}
+}
+
+// ingestFamilyError pinpoints one rejected family with a stable reason.
+type ingestFamilyError struct {
+	Family string `json:"family"`
+	Reason string `json:"reason"`
+}
+
+// ingestResponse is the /metrics/ingest response body.
+type ingestResponse struct {
+	Ingested int                 `json:"ingested"`
+	Skipped  int                 `json:"skipped"`
+	Errors   []ingestFamilyError `json:"errors,omitempty"`
+}
+
+// handleMetricsIngest accepts a Prometheus text exposition (POST body) and
+// folds it into the pushed-metrics store. Unparseable input is a 400;
+// per-family rejections follow the batch-handler contract (200 with a skip
+// list).
+func (h *Service) handleMetricsIngest(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1MB
+
+	// Legacy validation: re-exported names must satisfy the classic
+	// [a-zA-Z_:] metric-name rules, since they become names in OUR registry.
+	parser := expfmt.NewTextParser(model.LegacyValidation)
+	families, err := parser.TextToMetricFamilies(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "invalid exposition format: "+err.Error(), nil)
+		return
+	}
+
+	ingested, errs := h.pushed.absorb(families)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(ingestResponse{
+		Ingested: ingested,
+		Skipped:  len(errs),
+		Errors:   errs,
+	}); err != nil {
+		log.Printf("Failed to encode ingest response: %v", err)
+	}
+}
+
+// --- daily rollup (/stats/daily) -------------------------------------------
+//
+// A "yesterday vs today" view without standing up Grafana: UTC day buckets of
+// token usage, request counts by status, and cache hit/miss counts, fed from
+// the SAME applyMetric arms that feed Prometheus. In-memory with a capped
+// retention window; optionally persisted to a JSON file across restarts
+// (ROLLUP_FILE) since a rollup that dies with the process answers nothing
+// about yesterday.
+
+const defaultRollupRetentionDays = 30
+
+// dayStats is one UTC day's accumulated numbers. CacheHitRatio is derived at
+// serve time, not stored, so the stored form stays a plain sum.
+type dayStats struct {
+	Date             string             `json:"date"` // "2006-01-02" (UTC)
+	TokensInput      float64            `json:"tokens_input"`
+	TokensOutput     float64            `json:"tokens_output"`
+	RequestsByStatus map[string]float64 `json:"requests_by_status"`
+	CacheHits        float64            `json:"cache_hits"`
+	CacheMisses      float64            `json:"cache_misses"`
+	CacheHitRatio    float64            `json:"cache_hit_ratio"`
+}
+
+type dailyRollup struct {
+	mu        sync.Mutex
+	days      map[string]*dayStats
+	retention int
+	clock     Clock
+}
+
+func newDailyRollup(retention int, clock Clock) *dailyRollup {
+	return &dailyRollup{
+		days:      make(map[string]*dayStats),
+		retention: retention,
+		clock:     clock,
+	}
+}
+
+// rollupRetentionFromEnv parses ROLLUP_RETENTION_DAYS with the usual
+// fail-safe posture.
+func rollupRetentionFromEnv() int {
+	raw := strings.TrimSpace(os.Getenv("ROLLUP_RETENTION_DAYS"))
+	if raw == "" {
+		return defaultRollupRetentionDays
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("WARNING: invalid ROLLUP_RETENTION_DAYS %q (must be a positive integer) — using default %d", raw, defaultRollupRetentionDays)
+		return defaultRollupRetentionDays
+	}
+	return n
+}
+
+// today returns the current bucket, creating it and pruning expired ones.
+// Callers hold r.mu.
+func (r *dailyRollup) today() *dayStats {
+	key := r.clock.Now().UTC().Format("2006-01-02")
+	day, ok := r.days[key]
+	if !ok {
+		day = &dayStats{Date: key, RequestsByStatus: make(map[string]float64)}
+		r.days[key] = day
+		r.prune()
+	}
+	return day
+}
+
+// prune drops the oldest buckets beyond the retention window. The date keys
+// sort lexically in chronological order, so no time parsing is needed.
+// Callers hold r.mu.
+func (r *dailyRollup) prune() {
+	if len(r.days) <= r.retention {
+		return
+	}
+	keys := make([]string, 0, len(r.days))
+	for k := range r.days {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys[:len(keys)-r.retention] {
+		delete(r.days, k)
+	}
+}
+
+func (r *dailyRollup) recordTokens(typ string, n float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	day := r.today()
+	switch typ {
+	case "input":
+		day.TokensInput += n
+	case "output":
+		day.TokensOutput += n
+	}
+}
+
+func (r *dailyRollup) recordRequest(status string, n float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.today().RequestsByStatus[status] += n
+}
+
+func (r *dailyRollup) recordCache(result string, n float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	day := r.today()
+	switch result {
+	case "hit":
+		day.CacheHits += n
+	case "miss":
+		day.CacheMisses += n
+	}
+}
+
+// snapshot returns the buckets sorted by date ascending, with the derived
+// cache hit ratio filled in.
+func (r *dailyRollup) snapshot() []dayStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]dayStats, 0, len(r.days))
+	for _, day := range r.days {
+		d := *day
+		// Copy the map so callers can't race with later pushes.
+		d.RequestsByStatus = make(map[string]float64, len(day.RequestsByStatus))
+		for k, v := range day.RequestsByStatus {
+			d.RequestsByStatus[k] = v
+		}
+		if total := d.CacheHits + d.CacheMisses; total > 0 {
+			d.CacheHitRatio = d.CacheHits / total
+		}
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Date < out[j].Date })
+	return out
+}
+
+// saveToFile persists the buckets as JSON (called on graceful shutdown).
+// Write-then-rename so a crash or full disk mid-write can corrupt only the
+// temp file, never an existing snapshot a restart would need.
+func (r *dailyRollup) saveToFile(path string) error {
+	data, err := json.Marshal(r.snapshot())
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// loadFromFile restores buckets saved by saveToFile. Best-effort: a missing
+// or corrupt file means starting empty, never failing startup. Loaded buckets
+// outside the retention window are pruned immediately.
+func (r *dailyRollup) loadFromFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var days []dayStats
+	if err := json.Unmarshal(data, &days); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range days {
+		d := days[i]
+		if d.Date == "" {
+			continue
+		}
+		if d.RequestsByStatus == nil {
+			d.RequestsByStatus = make(map[string]float64)
+		}
+		d.CacheHitRatio = 0 // derived field, recomputed at serve time
+		r.days[d.Date] = &d
+	}
+	r.prune()
+	return nil
+}
+
+// handleStatsDaily serves GET /stats/daily: the rollup as an array of day
+// objects, oldest first.
+func (h *Service) handleStatsDaily(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.rollup.snapshot()); err != nil {
+		log.Printf("Failed to encode daily stats response: %v", err)
+	}
+}
+
+// LoadRollup restores the daily rollup from a JSON file written by
+// SaveRollup. Best-effort semantics are the caller's (a missing file is
+// normal on first boot); the underlying parse keeps its fail-safe posture.
+func (h *Service) LoadRollup(path string) error {
+	return h.rollup.loadFromFile(path)
+}
+
+// SaveRollup persists the daily rollup as JSON — binaries call it on graceful
+// shutdown, after the connection drain, so completed in-flight pushes are
+// included. Every write feeds the snapshot metrics and the "persistence"
+// failure-streak logic (see recordSnapshotWrite).
+func (h *Service) SaveRollup(path string) error {
+	start := h.clock.Now()
+	err := h.rollup.saveToFile(path)
+	h.recordSnapshotWrite(h.clock.Now().Sub(start), err)
+	return err
+}
+
+// tokenPriceFromEnv parses a non-negative price from the named env var. Same
+// fail-safe posture as the other *FromEnv helpers.
+func tokenPriceFromEnv(name string) float64 {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" {
+		return 0
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		log.Printf("WARNING: invalid %s %q (must be a non-negative number) — using 0", name, raw)
+		return 0
+	}
+	return v
+}
+
+// costBreakdownRow is one model's share of the /stats/cost estimate.
+type costBreakdownRow struct {
+	Model         string  `json:"model"`
+	InputTokens   float64 `json:"input_tokens"`
+	OutputTokens  float64 `json:"output_tokens"`
+	EstimatedCost float64 `json:"estimated_cost"`
+}
+
+// costReport is the /stats/cost response body.
+type costReport struct {
+	Since         string             `json:"since"`
+	PricesPer1K   map[string]float64 `json:"prices_per_1k"`
+	EstimatedCost float64            `json:"estimated_total_cost"`
+	Breakdown     []costBreakdownRow `json:"breakdown"`
+	Reset         bool               `json:"reset,omitempty"`
+}
+
+// buildCostReport computes the spend estimate from the accumulated token
+// counts — shared by /stats/cost and the debug snapshot.
+func (h *Service) buildCostReport() costReport {
+	counts, lastReset := h.tokenCosts.snapshot()
+
+	since := h.startTime
+	if !lastReset.IsZero() {
+		since = lastReset
+	}
+
+	rows := map[string]*costBreakdownRow{}
+	for k, v := range counts {
+		row, ok := rows[k.Model]
+		if !ok {
+			row = &costBreakdownRow{Model: k.Model}
+			rows[k.Model] = row
+		}
+		// Only input/output are token counts; the other safeLabel "type"
+		// values belong to different metrics and never reach this accumulator.
+		switch k.Type {
+		case "input":
+			row.InputTokens += v
+		case "output":
+			row.OutputTokens += v
+		}
+	}
+
+	report := costReport{
+		Since: formatTimestamp(since),
+		PricesPer1K: map[string]float64{
+			"input":  h.tokenPriceInput,
+			"output": h.tokenPriceOutput,
+		},
+		Breakdown: make([]costBreakdownRow, 0, len(rows)),
+	}
+	for _, row := range rows {
+		row.EstimatedCost = row.InputTokens/1000*h.tokenPriceInput + row.OutputTokens/1000*h.tokenPriceOutput
+		report.EstimatedCost += row.EstimatedCost
+		report.Breakdown = append(report.Breakdown, *row)
+	}
+	sort.Slice(report.Breakdown, func(i, j int) bool {
+		return report.Breakdown[i].Model < report.Breakdown[j].Model
+	})
+	return report
+}
+
+// handleStatsCost serves GET /stats/cost: estimated spend derived from the
+// accumulated token counts. With ?reset=true (admin, write-token-gated in the
+// router) it returns the final report for the window and then zeroes the
+// accumulator, so the closing numbers are never lost.
+func (h *Service) handleStatsCost(w http.ResponseWriter, r *http.Request) {
+	report := h.buildCostReport()
+
+	if r.URL.Query().Get("reset") == "true" {
+		h.tokenCosts.reset(h.clock.Now())
+		report.Reset = true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("Failed to encode cost response: %v", err)
+	}
+}
+
+// requireBearerToken builds an HTTP middleware that requires
+// `Authorization: Bearer <token>` on every request. If `expected` is empty
+// it fails CLOSED — every write is rejected. That's deliberate: a default
+// of "skip auth when no token is configured" would mean a fresh deploy
+// that forgot to set HEALTH_API_TOKEN silently runs with no auth at all,
+// and an attacker who can reach the bind address can poison every metric.
+// Use constant-time comparison to avoid token-length / prefix timing leaks.
+func requireBearerToken(expected string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if expected == "" {
+				writeError(w, http.StatusServiceUnavailable, errCodeWritesDisabled, "service refuses writes: HEALTH_API_TOKEN not configured", nil)
+				return
+			}
+			authHdr := r.Header.Get("Authorization")
+			const prefix = "Bearer "
+			if !strings.HasPrefix(authHdr, prefix) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="health_api"`)
+				writeError(w, http.StatusUnauthorized, errCodeUnauthorized, "missing bearer token", nil)
+				return
+			}
+			provided := strings.TrimSpace(authHdr[len(prefix):])
+			// subtle.ConstantTimeCompare requires equal-length inputs to be
+			// useful — guard the length first, then compare bytes.
+			if len(provided) != len(expected) || subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) != 1 {
+				writeError(w, http.StatusUnauthorized, errCodeUnauthorized, "invalid bearer token", nil)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireReadToken builds middleware for the READ endpoints (/metrics, /stats)
+// that mirrors the Python sibling's posture (utils/monitoring/health_api.py
+// _PROTECTED_ENDPOINTS includes /metrics and /stats). It enforces the bearer
+// token ONLY when one is configured: with a token set, /metrics + /stats are
+// no longer served anonymously (closing the auth-parity gap with Python); with
+// no token set, reads stay anonymous so the default tokenless Prometheus scrape
+// keeps working — go-health-1's bind gate keeps that case loopback-only.
+//
+// This is deliberately NOT requireBearerToken: writes must stay fail-CLOSED
+// (503 when no token), but a tokenless deploy must still be able to scrape
+// /metrics on loopback, so reads degrade to anonymous instead of 503.
+// The /health* probes are intentionally NOT wrapped — the Python health
+// poller fetches GO_HEALTH_API_URL (/health) with no Authorization header,
+// and Kubernetes-style liveness/readiness probes need them unauthenticated.
+func requireReadToken(expected string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if expected == "" {
+			// No token configured: reads are anonymous (loopback-only via the
+			// bind gate). Return next unwrapped so there's zero per-request cost.
+			return next
+		}
+		// A token is configured — require it, reusing the same constant-time
+		// bearer check as the write endpoints.
+		return requireBearerToken(expected)(next)
+	}
+}
+
+// writeTokenMiddleware is the live-token variant of requireBearerToken: it
+// resolves the expected token per request from the Config snapshot, so a
+// reloaded HEALTH_API_TOKEN takes effect immediately on routers that were
+// built before the reload. The static constructors above stay as the tested
+// source of truth for the comparison itself.
+func (h *Service) writeTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requireBearerToken(h.config().AuthToken)(next).ServeHTTP(w, r)
+	})
+}
+
+// readTokenMiddleware is the live-token variant of requireReadToken.
+func (h *Service) readTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requireReadToken(h.config().AuthToken)(next).ServeHTTP(w, r)
+	})
+}
+
+// safeLabel returns value only if it's in the allowed set for that label key,
+// otherwise returns "other".
+func safeLabel(key, value string) string {
+	if allowed, ok := allowedLabelValues[key]; ok {
+		sanitized := sanitizeLabel(value)
+		if allowed[sanitized] {
+			return sanitized
+		}
+	}
+	// Unknown key or value not in allowed set — return "other" to prevent label cardinality explosion
+	return "other"
+}
+
+// --- service status messages ------------------------------------------------
+//
+// A service may attach a short free-text note to its status ("reconnecting,
+// attempt 3"). The text is attacker-influenced once push access leaks, and it
+// flows into JSON responses, logs, and downstream into the dashboard's HTML
+// and Discord webhooks — all injection surfaces. sanitizeServiceMessage is the
+// single choke point every sink shares: messages are sanitized at ingestion
+// and stored neutral, so a sink only adds its own output encoding on top
+// (encoding/json escapes the JSON surfaces automatically; an HTML sink wraps
+// with html.EscapeString). The sanitizer itself never tries to be the output
+// encoder — mixing the two is how double-escaping bugs happen.
+
+// maxServiceMessageRunes caps a stored message. Counted in runes, not bytes —
+// the Thai/Korean operator notes this will carry are multi-byte.
+const maxServiceMessageRunes = 256
+
+// sanitizeServiceMessage strips control characters (ANSI escape sequences
+// would otherwise reach terminals through the logs), neutralizes Discord mass
+// mentions and mention syntax with a zero-width space, and caps the length.
+// Truncation runs LAST so it can only shorten already-neutral text — it can
+// never cut a neutralizing insertion back into a live @everyone.
+func sanitizeServiceMessage(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsControl(r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	out := b.String()
+
+	// Discord: @everyone/@here ping entire servers; <@...> is the user/role
+	// mention syntax. A zero-width space breaks the parse without mangling
+	// what a human reads.
+	out = strings.ReplaceAll(out, "@everyone", "@\u200beveryone")
+	out = strings.ReplaceAll(out, "@here", "@\u200bhere")
+	out = strings.ReplaceAll(out, "<@", "<@\u200b")
+
+	if runes := []rune(out); len(runes) > maxServiceMessageRunes {
+		out = string(runes[:maxServiceMessageRunes])
+	}
+	return strings.TrimSpace(out)
+}
+
+// SetServiceMessage attaches a status note to a service, replacing any
+// previous one; an empty (or sanitized-to-empty) message clears it. All
+// message ingestion funnels through here so nothing can bypass the sanitizer.
+func (h *Service) SetServiceMessage(name, message string) {
+	message = sanitizeServiceMessage(message)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if message == "" {
+		delete(h.serviceMessages, name)
+	} else {
+		h.serviceMessages[name] = message
+	}
+	h.publishStatusSnapshotLocked()
+}
+
+// ServiceMessages returns the current status notes (sanitized form; see the
+// package comment above sanitizeServiceMessage for what sinks still owe on
+// output). The map is an immutable published snapshot — treat it as
+// read-only.
+func (h *Service) ServiceMessages() map[string]string {
+	return h.loadStatusSnapshot().messages
+}
+
+// serviceEntry is one row of the paginated /health/services list.
+type serviceEntry struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+}
+
+// --- transparent gzip request bodies ----------------------------------------
+//
+// Batch pushes from the Python side run to hundreds of KB of JSON every cycle
+// and were bumping into the MaxBytesReader caps. The write endpoints accept
+// `Content-Encoding: gzip` instead of raising the caps: JSON metric payloads
+// compress ~10x, and the size limit applies to the DECOMPRESSED stream, so a
+// gzip bomb hits the same ceiling a plain oversized body does — it cannot
+// expand past the limit in memory.
+
+// errBodyTooLarge marks a decompressed request body that exceeded the
+// endpoint's size limit (surfaced as 413, where the plain-body path's
+// MaxBytesReader yields the generic 400).
+var errBodyTooLarge = errors.New("request body too large")
+
+// limitedBody errors (rather than silently truncating, as io.LimitReader
+// would) once more than its budget has been read. Budget is limit+1 so a body
+// of exactly limit bytes still reads its EOF cleanly.
+type limitedBody struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		return 0, errBodyTooLarge
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// requestBody returns the request body with limit enforced, transparently
+// decompressing when the client sent Content-Encoding: gzip. A non-nil error
+// is a client problem (corrupt gzip header, unsupported encoding) and maps to
+// a 400.
+func requestBody(w http.ResponseWriter, r *http.Request, limit int64) (io.Reader, error) {
+	switch enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); enc {
+	case "", "identity":
+		return http.MaxBytesReader(w, r.Body, limit), nil
+	case "gzip":
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		return &limitedBody{r: gz, remaining: limit + 1}, nil
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", enc)
+	}
+}
+
+// decodeBodyError maps a JSON-decode failure to its HTTP response: a
+// structured 413 when the body blew the limit — both the gzip path's
+// errBodyTooLarge and the plain path's *http.MaxBytesError, which used to
+// surface as an unhelpful generic "invalid JSON" 400 — and the usual 400
+// otherwise (which also covers gzip streams that turn corrupt after the
+// header). Oversized bodies are counted per route so a bloated pusher shows
+// up on a graph before anyone goes log-diving.
+func (h *Service) decodeBodyError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.Is(err, errBodyTooLarge) || errors.As(err, &maxBytesErr) {
+		route := notFoundRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				route = pattern
+			}
+		}
+		h.httpMetrics.ObserveBodyTooLarge(route)
+		writeError(w, http.StatusRequestEntityTooLarge, errCodeBodyTooLarge, "request body too large", nil)
+		return
+	}
+	writeError(w, http.StatusBadRequest, errCodeInvalidJSON, "invalid JSON", nil)
+}
+
+// handleServiceStatus updates a service's health status (called from Python).
+func (h *Service) handleServiceStatus(w http.ResponseWriter, r *http.Request) {
+	// Limit request body size (decompressed, when gzipped)
+	body, err := requestBody(w, r, 1<<16) // 64KB
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, err.Error(), nil)
+		return
+	}
+
+	var payload struct {
+		Name    string `json:"name"`
+		Healthy bool   `json:"healthy"`
+		Message string `json:"message,omitempty"`
+		// DependsOn declares the service's dependencies (see deps.go): nil
+		// leaves the declaration unchanged, [] clears it.
+		DependsOn []string `json:"depends_on,omitempty"`
+	}
+
+	if err := json.NewDecoder(body).Decode(&payload); err != nil {
+		h.decodeBodyError(w, r, err)
+		return
+	}
+
+	// Validate service name (prevent unbounded map growth)
+	if len(payload.Name) == 0 || len(payload.Name) > 100 {
+		writeError(w, http.StatusBadRequest, heartbeatReasonInvalidName, "invalid service name", nil)
+		return
+	}
+
+	// Dependency declarations are validated (and cycles rejected) BEFORE the
+	// status write, so a 400 here leaves the report entirely unapplied.
+	if payload.DependsOn != nil {
+		if reason := h.SetServiceDependencies(payload.Name, payload.DependsOn); reason != "" {
+			writeError(w, http.StatusBadRequest, reason, "dependency declaration rejected", nil)
+			return
+		}
+	}
+
+	if !h.SetServiceStatus(payload.Name, payload.Healthy) {
+		// 409 with a JSON body that names the cap — a silent drop here once
+		// cost a two-hour hunt for a worker that never appeared in /health.
+		writeError(w, http.StatusConflict, heartbeatReasonMapFull,
+			"service map full: registration rejected",
+			map[string]any{"max_services": h.maxServices})
+		return
+	}
+	// The status update above is the authoritative write; the note is applied
+	// only once it succeeded, and an omitted/empty message clears the old one
+	// (a stale "reconnecting…" next to healthy:true is worse than no note).
+	h.SetServiceMessage(payload.Name, payload.Message)
+	w.WriteHeader(http.StatusOK)
+}
+
+// --- atomic heartbeat batches (/health/heartbeat) ---------------------------
+//
+// The Python heartbeat used to update its services one POST at a time;
+// between calls GetStatus could observe 3 fresh and 5 stale services and
+// flap readiness once per cycle. A heartbeat batch applies all-or-nothing
+// under the service mutex: every item is validated BEFORE any write, the
+// whole map update and the generation bump happen in one critical section,
+// and GetStatus snapshots under the same lock — so no observer ever sees a
+// partially applied heartbeat.
+
+// Stable machine-readable reasons for rejected heartbeat batches (same
+// contract as the push reason* constants).
+const (
+	heartbeatReasonEmpty       = "empty_batch"
+	heartbeatReasonInvalidName = "invalid_name"
+	heartbeatReasonMapFull     = "service_map_full"
+)
+
+// ApplyHeartbeat applies one heartbeat batch atomically. On success it
+// returns the new generation and ""; on rejection it returns 0 and a stable
+// reason, with NO item applied — a batch that is partly invalid must not
+// half-land, that's the torn state this exists to remove.
+func (h *Service) ApplyHeartbeat(services map[string]bool) (uint64, string) {
+	if len(services) == 0 {
+		return 0, heartbeatReasonEmpty
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Validate everything first; writes only start once the whole batch is
+	// known to fit.
+	newNames := 0
+	for name := range services {
+		if len(name) == 0 || len(name) > 100 {
+			return 0, heartbeatReasonInvalidName
+		}
+		if _, exists := h.services[name]; !exists {
+			if _, seeded := h.unknownServices[name]; !seeded {
+				newNames++
+			}
+		}
+	}
+	if len(h.services)+len(h.unknownServices)+newNames > h.maxServices {
+		log.Printf("WARNING: service map full (%d), rejecting heartbeat batch with %d new services", h.maxServices, newNames)
+		h.metrics.serviceRegistrationsRejected.Inc()
+		return 0, heartbeatReasonMapFull
+	}
+
+	for name, healthy := range services {
+		h.services[name] = healthy
+		delete(h.unknownServices, name)
+	}
+	h.publishStatusSnapshotLocked()
+	h.heartbeatGeneration++
+	// One batch timestamp for the whole update — staleness is a property of
+	// the heartbeat, not of the order items happened to be written in.
+	h.lastHeartbeat = h.clock.Now()
+	return h.heartbeatGeneration, ""
+}
+
+// --- registration-mode heartbeats -------------------------------------------
+//
+// Some workers can't meaningfully report healthy/unhealthy — they just want
+// to say "I'm alive" on a cadence. A registration heartbeat is
+// {name, interval_seconds}: the service stays healthy as long as pings keep
+// arriving within 2× the declared interval, and the sweeper flips it to
+// unhealthy ("missed heartbeat") when they stop. The 2× grace absorbs one
+// dropped ping — flipping on a single miss made every GC pause look like an
+// outage.
+
+const (
+	heartbeatReasonInvalidInterval = "invalid_interval"
+	// maxHeartbeatIntervalSeconds caps the declared interval — the same bound
+	// as probe intervals; a multi-hour heartbeat is a config error, not a
+	// liveness signal.
+	maxHeartbeatIntervalSeconds = 3600
+	// heartbeatSweepInterval is how often the sweeper checks deadlines. 1s
+	// keeps detection latency well under the smallest allowed 2s deadline.
+	heartbeatSweepInterval = time.Second
+	// missedHeartbeatMessage is the stable reason shown on a flipped service.
+	missedHeartbeatMessage = "missed heartbeat"
+)
+
+// heartbeatReg is one service's registration-mode heartbeat state.
+type heartbeatReg struct {
+	intervalSeconds int
+	lastSeen        time.Time
+}
+
+// RecordHeartbeat records one "I'm alive" ping, (re)declaring the interval.
+// It marks the service healthy — a ping after a missed-heartbeat flip is the
+// recovery — and returns "" on success or a stable rejection reason.
+func (h *Service) RecordHeartbeat(name string, intervalSeconds int) string {
+	if len(name) == 0 || len(name) > 100 {
+		return heartbeatReasonInvalidName
+	}
+	if intervalSeconds < 1 || intervalSeconds > maxHeartbeatIntervalSeconds {
+		return heartbeatReasonInvalidInterval
+	}
+	// The status write owns the cap check; the registration only lands if the
+	// service made it into the map.
+	if !h.SetServiceStatus(name, true) {
+		return heartbeatReasonMapFull
+	}
+	h.SetServiceMessage(name, "")
+	h.mu.Lock()
+	h.heartbeatRegs[name] = &heartbeatReg{
+		intervalSeconds: intervalSeconds,
+		lastSeen:        h.clock.Now(),
+	}
+	h.mu.Unlock()
+	return ""
+}
+
+// sweepMissedHeartbeats flips every registered service whose deadline (2× its
+// declared interval) has passed without a ping. One pass; the sweeper loop
+// drives it.
+func (h *Service) sweepMissedHeartbeats() {
+	now := h.clock.Now()
+	var missed []string
+	h.mu.RLock()
+	for name, reg := range h.heartbeatRegs {
+		deadline := 2 * time.Duration(reg.intervalSeconds) * time.Second
+		if now.Sub(reg.lastSeen) > deadline && h.services[name] {
+			missed = append(missed, name)
+		}
+	}
+	h.mu.RUnlock()
+	for _, name := range missed {
+		log.Printf("WARNING: service %q missed its heartbeat deadline — marking unhealthy", name)
+		h.SetServiceStatus(name, false)
+		h.SetServiceMessage(name, missedHeartbeatMessage)
+	}
+}
+
+// StartHeartbeatSweeper runs the deadline sweeper until ctx is cancelled.
+// Call it like StartCollector (own goroutine, same shutdown context).
+func (h *Service) StartHeartbeatSweeper(ctx context.Context) {
+	ticker := h.clock.NewTicker(heartbeatSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			h.sweepMissedHeartbeats()
+		}
+	}
+}
+
+// heartbeatResponse is the /health/heartbeat success body.
+type heartbeatResponse struct {
+	Generation uint64 `json:"generation"`
+	Applied    int    `json:"applied"`
+}
+
+// handleHeartbeat ingests one atomic heartbeat batch (called from Python).
+func (h *Service) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	// Limit request body size (decompressed, when gzipped)
+	body, err := requestBody(w, r, 1<<16) // 64KB
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, err.Error(), nil)
+		return
+	}
+
+	var payload struct {
+		Services map[string]bool `json:"services"`
+		// Registration mode (see RecordHeartbeat): a bare "I'm alive" ping.
+		Name            string `json:"name"`
+		IntervalSeconds int    `json:"interval_seconds"`
+		// Sender's own clock, for skew tracking (see clockskew.go).
+		ClientTimestamp string `json:"client_timestamp,omitempty"`
+	}
+	if err := json.NewDecoder(body).Decode(&payload); err != nil {
+		h.decodeBodyError(w, r, err)
+		return
+	}
+
+	if payload.ClientTimestamp != "" {
+		h.observeClientClock(r.Context(), skewWriterHeartbeat, payload.ClientTimestamp)
+	}
+
+	// Registration mode and batch mode share the endpoint; the presence of
+	// "name" picks the former (a batch never has one).
+	if payload.Name != "" || payload.IntervalSeconds != 0 {
+		reason := h.RecordHeartbeat(payload.Name, payload.IntervalSeconds)
+		if reason != "" {
+			code := http.StatusBadRequest
+			var details map[string]any
+			if reason == heartbeatReasonMapFull {
+				code = http.StatusConflict
+				details = map[string]any{"max_services": h.maxServices}
+			}
+			writeError(w, code, reason, "heartbeat rejected", details)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]any{
+			"name": payload.Name,
+			// The deadline the sweeper will hold the service to.
+			"deadline_seconds": 2 * payload.IntervalSeconds,
+		}); err != nil {
+			log.Printf("Failed to encode heartbeat response: %v", err)
+		}
+		return
+	}
+
+	generation, reason := h.ApplyHeartbeat(payload.Services)
+	if reason != "" {
+		code := http.StatusBadRequest
+		var details map[string]any
+		if reason == heartbeatReasonMapFull {
+			// Same status + max_services detail as the single-service
+			// endpoint's cap rejection, so clients share one handling path.
+			code = http.StatusConflict
+			details = map[string]any{"max_services": h.maxServices}
+		}
+		writeError(w, code, reason, "heartbeat rejected: no service applied", details)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(heartbeatResponse{
+		Generation: generation,
+		Applied:    len(payload.Services),
+	}); err != nil {
+		log.Printf("Failed to encode heartbeat response: %v", err)
+	}
+}
+
+// handleMetricsPush ingests a single metric (called from Python).
+func (h *Service) handleMetricsPush(w http.ResponseWriter, r *http.Request) {
+	// Limit request body size (decompressed, when gzipped)
+	body, err := requestBody(w, r, 1<<16) // 64KB
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, err.Error(), nil)
+		return
+	}
+
+	var payload MetricsPayload
+	if err := json.NewDecoder(body).Decode(&payload); err != nil {
+		h.decodeBodyError(w, r, err)
+		return
+	}
+
+	if payload.ClientTimestamp != "" {
+		h.observeClientClock(r.Context(), skewWriterPush, payload.ClientTimestamp)
+	}
+
+	if reason := h.applyMetric(payload); reason != "" {
+		h.logPushRejection(r.Context(), "/metrics/push", reason)
+		// The server span (tracing.go) records the rejection so traces show
+		// WHY the 400 happened, not just that it did.
+		if sp := spanFromContext(r.Context()); sp != nil {
+			sp.addEvent("payload_rejected", time.Now(), spanAttr{key: "reason", str: reason})
+			sp.setError(pushErrorMessage(reason))
+		}
+		writeError(w, http.StatusBadRequest, reason, pushErrorMessage(reason), nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Stable machine-readable reasons for rejected/skipped metric payloads. Shared
+// by /metrics/push (mapped to a 400 message) and /metrics/batch (surfaced
+// per-index in the errors array) so the Python side never has to parse prose.
+const (
+	reasonUnknownName      = "unknown_name"
+	reasonUnknownType      = "unknown_type"
+	reasonNameTypeMismatch = "name_type_mismatch"
+	reasonNegativeCounter  = "negative_counter"
+	reasonNegativeValue    = "negative_value"
+	reasonNonFiniteValue   = "non_finite_value"
+	reasonInvalidEnumValue = "invalid_enum_value"
+	reasonInvalidName      = "invalid_name"
+	reasonInvalidQuantile  = "invalid_quantile"
+	reasonNameCollision    = "name_collision"
+	reasonUnknownOp        = "unknown_op"
+	reasonUnsupportedOp    = "unsupported_op"
+	reasonUnknownMode      = "unknown_mode"
+	reasonUnsupportedMode  = "unsupported_mode"
+	reasonTooManySeries    = "too_many_series"
+	reasonMissingGuild     = "missing_guild"
+	reasonUnknownLabel     = "unknown_label"
+	reasonDuplicateLabel   = "duplicate_label"
+	reasonTooManyLabels    = "too_many_labels"
+	// reasonMalformedLine is stream-only: an NDJSON line that didn't decode at
+	// all, so there is no payload to validate further.
+	reasonMalformedLine = "malformed_line"
+)
+
+// pushErrorMessage maps a reason constant to the human-readable 400 body the
+// single-push endpoint returns (the reason itself is included for machines).
+func pushErrorMessage(reason string) string {
+	switch reason {
+	case reasonUnknownName:
+		return "unknown metric name (" + reason + ")"
+	case reasonUnknownType:
+		return "unknown metric type (" + reason + ")"
+	case reasonNameTypeMismatch:
+		return "metric name/type mismatch (" + reason + ")"
+	case reasonNegativeCounter:
+		return "counter value must be non-negative finite (" + reason + ")"
+	case reasonNegativeValue:
+		return "metric value must be non-negative (" + reason + ")"
+	case reasonNonFiniteValue:
+		return "metric value must be finite (" + reason + ")"
+	case reasonInvalidEnumValue:
+		return "circuit_breaker value must be 0, 1, or 2 (" + reason + ")"
+	case reasonInvalidName:
+		return "metric name must match " + summaryNameRE.String() + " (" + reason + ")"
+	case reasonInvalidQuantile:
+		return "quantile label must be one of 0.5, 0.9, 0.95, 0.99 (" + reason + ")"
+	case reasonNameCollision:
+		return "metric name collides with an existing metric (" + reason + ")"
+	case reasonUnknownOp:
+		return "op must be set, inc, or dec (" + reason + ")"
+	case reasonUnsupportedOp:
+		return "op is only supported for numeric gauges (" + reason + ")"
+	case reasonUnknownMode:
+		return "mode must be delta or absolute (" + reason + ")"
+	case reasonUnsupportedMode:
+		return "mode is only supported for built-in counters (" + reason + ")"
+	case reasonTooManySeries:
+		return "absolute-tracking series budget exhausted for this metric (" + reason + ")"
+	case reasonMissingGuild:
+		return "guild_activity requires a guild label (" + reason + ")"
+	case reasonUnknownLabel:
+		return "label key not in the metric's schema (" + reason + ")"
+	case reasonDuplicateLabel:
+		return "label keys collide after normalization with conflicting values (" + reason + ")"
+	case reasonTooManyLabels:
+		return fmt.Sprintf("too many labels (max %d) (%s)", maxLabelsPerPayload, reason)
+	default:
+		return reason
+	}
+}
+
+// --- summary_set: pre-aggregated quantiles pushed from Python --------------
+//
+// The Python process already computes p50/p95/p99 for some internal timings;
+// rather than replaying raw observations it pushes the quantiles themselves.
+// Each summary_set payload carries a DYNAMIC metric name (so it bypasses
+// allowedMetricNames and is instead gated by a strict name regex), a
+// `quantile` label from a fixed allowlist, and the quantile's value. The
+// backing GaugeVec `discord_bot_<name>_quantile{quantile=...}` is registered
+// lazily on first push, exactly once, under summaryMu.
+
+// summaryNameRE bounds pushed summary names: lowercase snake_case, max 64
+// chars. Anything else could mint hostile or colliding Prometheus names.
+var summaryNameRE = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// allowedQuantiles fixes the quantile label set so arbitrary label values
+// can't explode series cardinality (same posture as allowedLabelValues).
+var allowedQuantiles = map[string]bool{"0.5": true, "0.9": true, "0.95": true, "0.99": true}
+
+// getSummaryGauge returns the GaugeVec for a summary name, registering it on
+// first use. Registration collisions (the derived name already exists in the
+// registry as some other metric) surface as an error instead of a panic —
+// promauto would panic, so this path registers manually.
+func (h *Service) getSummaryGauge(name string) (*prometheus.GaugeVec, error) {
+	h.summaryMu.Lock()
+	defer h.summaryMu.Unlock()
+	if g, ok := h.summaryGauges[name]; ok {
+		return g, nil
+	}
+	g := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "discord_bot_" + name + "_quantile",
+			Help: "Pre-aggregated quantiles pushed from Python for " + name,
+		},
+		[]string{"quantile"},
+	)
+	if err := h.registerer.Register(g); err != nil {
+		return nil, err
+	}
+	h.summaryGauges[name] = g
+	return g, nil
+}
+
+// applySummarySet validates and applies one summary_set payload. Same contract
+// as applyMetric: "" on success, stable reason string on rejection.
+func (h *Service) applySummarySet(p MetricsPayload) string {
+	if p.Op != "" {
+		return reasonUnsupportedOp
+	}
+	if p.Mode != "" {
+		return reasonUnsupportedMode
+	}
+	if !summaryNameRE.MatchString(p.Name) {
+		return reasonInvalidName
+	}
+	if math.IsNaN(p.Value) || math.IsInf(p.Value, 0) {
+		return reasonNonFiniteValue
+	}
+	q := p.Labels["quantile"]
+	if !allowedQuantiles[q] {
+		return reasonInvalidQuantile
+	}
+	g, err := h.getSummaryGauge(p.Name)
+	if err != nil {
+		log.Printf("WARNING: summary_set %q collides with an existing metric: %v", p.Name, err)
+		return reasonNameCollision
+	}
+	g.WithLabelValues(q).Set(p.Value)
+	return ""
+}
+
+// applyMetric validates one metric payload and, if valid, applies it to the
+// Prometheus registry. Returns "" on success or one of the stable reason
+// constants above. This is the single source of truth for push validation —
+// /metrics/push turns a reason into a 400, /metrics/batch into a skipped item.
+//
+// DEFENSE-IN-DEPTH NOTE (go-health-3): the NaN/Inf arms are currently
+// UNREACHABLE via the HTTP paths — encoding/json rejects NaN/Infinity/
+// quoted-number bodies before this runs, so every such request already gets
+// 400 "invalid JSON". They are kept (not deleted) so that if a future non-JSON
+// ingestion path is ever wired here it stays poison-proof; the predicate is
+// locked by TestNaNInfGuardLogic. The `value < 0` arms ARE reachable and are
+// the live, tested protection (Counter.Add panics on negatives, and a negative
+// observation poisons a histogram _sum).
+func (h *Service) applyMetric(p MetricsPayload) string {
+	// Canonicalize the label map first so every arm below (and every caller —
+	// push, batch, stream, statsd) sees the same normalized view.
+	labels, reason := normalizeLabels(p.Name, p.Type, p.Labels)
+	if reason != "" {
+		return reason
+	}
+	p.Labels = labels
+	// summary_set carries a dynamic metric name, so it is gated by its own
+	// regex + quantile allowlist instead of allowedMetricNames.
+	if p.Type == "summary_set" {
+		return h.applySummarySet(p)
+	}
+	if !allowedMetricNames[p.Name] {
+		// Runtime-registered metrics (see dynmetrics.go) claim the name
+		// before it is rejected as unknown.
+		if claimed, reason := h.applyDynMetric(p); claimed {
+			return reason
+		}
+		return reasonUnknownName
+	}
+	switch p.Type {
+	case "counter":
+		// Op is a gauge-only concept; a client that sets it on a counter is
+		// confused and should hear about it rather than be half-applied.
+		if p.Op != "" {
+			return reasonUnsupportedOp
+		}
+		switch p.Mode {
+		case "", modeDelta, modeAbsolute:
+		default:
+			return reasonUnknownMode
+		}
+		if math.IsNaN(p.Value) || math.IsInf(p.Value, 0) {
+			return reasonNonFiniteValue
+		}
+		if p.Value < 0 {
+			return reasonNegativeCounter
+		}
+		switch p.Name {
+		case "requests":
+			status := safeLabel("status", p.Labels["status"])
+			endpoint := h.guardedEndpoint("requests", p.Labels["endpoint"], status)
+			add, reason := h.counterDelta(p, endpoint, status)
+			if reason != "" {
+				return reason
+			}
+			h.metrics.requestsTotal.WithLabelValues(endpoint, status).Add(add)
+			h.rollup.recordRequest(status, add)
+		case "rate_limit":
+			typ := safeLabel("type", p.Labels["type"])
+			add, reason := h.counterDelta(p, typ)
+			if reason != "" {
+				return reason
+			}
+			h.metrics.rateLimitHits.WithLabelValues(typ).Add(add)
+		case "cache":
+			result := safeLabel("result", p.Labels["result"])
+			add, reason := h.counterDelta(p, result)
+			if reason != "" {
+				return reason
+			}
+			h.metrics.cacheHits.WithLabelValues(result).Add(add)
+			h.rollup.recordCache(result, add)
+		case "tokens":
+			typ := safeLabel("type", p.Labels["type"])
+			model := h.safeModelLabel(p.Labels["model"])
+			add, reason := h.counterDelta(p, typ, model)
+			if reason != "" {
+				return reason
+			}
+			h.metrics.tokensUsed.WithLabelValues(typ, model).Add(add)
+			// Mirror into the /stats/cost accumulator and the daily rollup —
+			// same code path, same sanitized labels, so the totals can't drift.
+			h.tokenCosts.add(typ, model, add)
+			h.rollup.recordTokens(typ, add)
+		case "command_invocations":
+			command := h.commands.safeLabel(p.Labels["command"])
+			status := safeLabel("status", p.Labels["status"])
+			add, reason := h.counterDelta(p, command, status)
+			if reason != "" {
+				return reason
+			}
+			h.metrics.commandInvocations.WithLabelValues(command, status).Add(add)
+			// Feed the /stats/commands leaderboard from the same sanitized
+			// label, so the JSON and the scrape can't drift.
+			h.commands.recordCount(command, add)
+		case "guild_activity":
+			guild := sanitizeLabel(p.Labels["guild"])
+			if guild == "" {
+				return reasonMissingGuild
+			}
+			// The exact ID keys the absolute-mode tracking (and the top-K
+			// table below); only the hashed bucket reaches Prometheus.
+			add, reason := h.counterDelta(p, guild)
+			if reason != "" {
+				return reason
+			}
+			h.metrics.guildActivity.WithLabelValues(guildBucketLabel(guild, h.guildBuckets)).Add(add)
+			h.guilds.add(guild, add)
+		case "queue_dropped":
+			queue := safeLabel("queue", p.Labels["queue"])
+			add, reason := h.counterDelta(p, queue)
+			if reason != "" {
+				return reason
+			}
+			h.metrics.queueDropped.WithLabelValues(queue).Add(add)
+		default:
+			return reasonNameTypeMismatch
+		}
+	case "histogram":
+		if p.Op != "" {
+			return reasonUnsupportedOp
+		}
+		if p.Mode != "" {
+			return reasonUnsupportedMode
+		}
+		if math.IsNaN(p.Value) || math.IsInf(p.Value, 0) {
+			return reasonNonFiniteValue
+		}
+		if p.Value < 0 {
+			return reasonNegativeValue
+		}
+		switch p.Name {
+		case "request_duration":
+			h.metrics.requestDuration.WithLabelValues(h.guardedEndpoint("request_duration", p.Labels["endpoint"])).Observe(p.Value)
+		case "ai_response_time":
+			h.metrics.aiResponseTime.WithLabelValues(h.safeModelLabel(p.Labels["model"])).Observe(p.Value)
+		case "command_duration":
+			command := h.commands.safeLabel(p.Labels["command"])
+			h.metrics.commandDuration.WithLabelValues(command).Observe(p.Value)
+			h.commands.recordDuration(command, p.Value)
+		default:
+			return reasonNameTypeMismatch
+		}
+	case "gauge":
+		if p.Mode != "" {
+			return reasonUnsupportedMode
+		}
+		if math.IsNaN(p.Value) || math.IsInf(p.Value, 0) {
+			return reasonNonFiniteValue
+		}
+		op := p.Op
+		if op == "" {
+			op = "set"
+		}
+		switch op {
+		case "set", "inc", "dec":
+		default:
+			return reasonUnknownOp
+		}
+		switch p.Name {
+		case "active_connections":
+			// active_connections is a count — reject negatives. For inc/dec
+			// the value is the delta's magnitude (dec subtracts), so the same
+			// non-negative rule applies.
+			if p.Value < 0 {
+				return reasonNegativeValue
+			}
+			switch op {
+			case "set":
+				h.metrics.activeConnections.Set(p.Value)
+			case "inc":
+				h.metrics.activeConnections.Add(p.Value)
+			case "dec":
+				h.metrics.activeConnections.Sub(p.Value)
+			}
+		case "circuit_breaker":
+			// circuit_breaker is a tri-state enum (0=closed, 1=half-open,
+			// 2=open per the gauge Help text) — reject anything else so a
+			// bad push can't corrupt dashboards/alerts that map it to a state.
+			// Deltas on a state enum are meaningless, so only "set" applies.
+			if op != "set" {
+				return reasonUnsupportedOp
+			}
+			if p.Value != 0 && p.Value != 1 && p.Value != 2 {
+				return reasonInvalidEnumValue
+			}
+			service := safeLabel("service", p.Labels["service"])
+			h.metrics.circuitBreakerState.WithLabelValues(service).Set(p.Value)
+			h.breakers.record(service, int(p.Value), h.clock.Now())
+		case "queue_depth", "queue_oldest_age_seconds":
+			// Both are non-negative quantities; same delta semantics as
+			// active_connections.
+			if p.Value < 0 {
+				return reasonNegativeValue
+			}
+			queue := safeLabel("queue", p.Labels["queue"])
+			gauge := h.metrics.queueDepth
+			if p.Name == "queue_oldest_age_seconds" {
+				gauge = h.metrics.queueOldestAge
+			}
+			switch op {
+			case "set":
+				gauge.WithLabelValues(queue).Set(p.Value)
+			case "inc":
+				gauge.WithLabelValues(queue).Add(p.Value)
+			case "dec":
+				gauge.WithLabelValues(queue).Sub(p.Value)
+			}
+			if p.Name == "queue_depth" {
+				h.queues.observe(queue, op, p.Value, h.clock.Now())
+			}
+		default:
+			return reasonNameTypeMismatch
+		}
+	default:
+		return reasonUnknownType
+	}
+	return ""
+}
+
+// maxBatchErrorDetails caps the per-item errors array in a batch response so a
+// pathological all-bad batch (up to 1000 items) keeps the body small.
+const maxBatchErrorDetails = 50
+
+// batchItemError pinpoints one skipped batch item by index with a stable
+// machine-readable reason (see the reason* constants).
+type batchItemError struct {
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+// batchResponse is the /metrics/batch response body.
+type batchResponse struct {
+	Processed int              `json:"processed"`
+	Skipped   int              `json:"skipped"`
+	Errors    []batchItemError `json:"errors,omitempty"`
+}
+
+// handleMetricsBatch ingests a batch of metrics (called from Python).
+func (h *Service) handleMetricsBatch(w http.ResponseWriter, r *http.Request) {
+	// Limit request body size to 1MB (decompressed, when gzipped) to prevent abuse
+	body, err := requestBody(w, r, 1<<20)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, err.Error(), nil)
+		return
+	}
+
+	var payloads []MetricsPayload
+	if err := json.NewDecoder(body).Decode(&payloads); err != nil {
+		h.decodeBodyError(w, r, err)
+		return
+	}
+
+	// Limit batch size to prevent abuse
+	if len(payloads) > 1000 {
+		writeError(w, http.StatusBadRequest, errCodeBatchTooLarge, "batch too large", map[string]any{"max": 1000})
+		return
+	}
+
+	// One batch comes from one writer, so the first stamped item speaks for
+	// the whole batch — observing all 1000 would just re-set the same gauge.
+	for _, p := range payloads {
+		if p.ClientTimestamp != "" {
+			h.observeClientClock(r.Context(), skewWriterBatch, p.ClientTimestamp)
+			break
+		}
+	}
+
+	// The apply loop gets its own child span (under the server span when the
+	// caller sent a traceparent) carrying item counts; rejected payloads are
+	// recorded as events with their stable reasons. No-ops when tracing is
+	// off.
+	span, _, finish := h.startSpan(r.Context(), "metrics.batch.apply")
+	processed := 0
+	var itemErrors []batchItemError
+	for i, p := range payloads {
+		reason := h.applyMetric(p)
+		if reason == "" {
+			processed++
+			continue
+		}
+		if span != nil {
+			span.addEvent("payload_rejected", time.Now(),
+				spanAttr{key: "index", num: int64(i), isNum: true},
+				spanAttr{key: "reason", str: reason})
+		}
+		// The single-push endpoint returns 400 for the same conditions; batch
+		// keeps 200 and reports each dropped item with its index and a stable
+		// reason, capped so a fully-bad 1000-item batch can't bloat the body.
+		if len(itemErrors) < maxBatchErrorDetails {
+			itemErrors = append(itemErrors, batchItemError{Index: i, Reason: reason})
+		}
+	}
+	if span != nil {
+		span.setAttrInt("batch.item_count", int64(len(payloads)))
+		span.setAttrInt("batch.processed", int64(processed))
+		span.setAttrInt("batch.rejected", int64(len(payloads)-processed))
+		if processed < len(payloads) {
+			span.setError(fmt.Sprintf("%d of %d payloads rejected", len(payloads)-processed, len(payloads)))
+		}
+	}
+	finish()
+
+	// One warn per distinct reason (not per item): a fully-bad 1000-item
+	// batch must not emit 1000 log records.
+	if len(itemErrors) > 0 {
+		seen := make(map[string]bool, len(itemErrors))
+		for _, ie := range itemErrors {
+			if !seen[ie.Reason] {
+				seen[ie.Reason] = true
+				h.logPushRejection(r.Context(), "/metrics/batch", ie.Reason)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(batchResponse{
+		Processed: processed,
+		Skipped:   len(payloads) - processed,
+		Errors:    itemErrors,
+	}); err != nil {
+		log.Printf("Failed to encode batch response: %v", err)
+	}
+}
+
+const (
+	// defaultStreamMaxItems bounds one /metrics/stream request. Overridable via
+	// STREAM_MAX_ITEMS (see streamMaxItemsFromEnv). 50k lines is hours of
+	// backlog for the Python pusher — the limit exists to stop a runaway or
+	// hostile client from holding the connection forever, not to force
+	// chunking.
+	defaultStreamMaxItems = 50000
+
+	// maxStreamLineBytes bounds ONE NDJSON line. A MetricsPayload is a few
+	// hundred bytes at most; a megabyte line is not a metric.
+	maxStreamLineBytes = 1 << 20
+)
+
+// streamMaxItemsFromEnv reads the STREAM_MAX_ITEMS override. Same validation
+// posture as listMaxBytesFromEnv: non-positive or unparsable values warn and
+// keep the default.
+func streamMaxItemsFromEnv() int {
+	raw := strings.TrimSpace(os.Getenv("STREAM_MAX_ITEMS"))
+	if raw == "" {
+		return defaultStreamMaxItems
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("WARNING: invalid STREAM_MAX_ITEMS %q (must be a positive integer) — using default %d", raw, defaultStreamMaxItems)
+		return defaultStreamMaxItems
+	}
+	return n
+}
+
+// handleMetricsStream ingests newline-delimited MetricsPayload objects
+// (NDJSON), one per line, applying each as it arrives. Unlike /metrics/batch
+// there is no MaxBytesReader and no 1000-item cap: the body is bounded by the
+// total-item ceiling (streamMaxItems), the per-line cap and the server's read
+// timeout instead, so the Python side can stream an arbitrary backlog without
+// buffering and chunking it. A malformed or invalid line is skipped and
+// counted, never aborts the stream; lines already applied stay applied even
+// when the stream later errors (pushes are not transactional — same stance as
+// /metrics/batch).
+func (h *Service) handleMetricsStream(w http.ResponseWriter, r *http.Request) {
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLineBytes)
+
+	processed, skipped, seen := 0, 0, 0
+	var itemErrors []batchItemError
+	skip := func(index int, reason string) {
+		skipped++
+		if len(itemErrors) < maxBatchErrorDetails {
+			itemErrors = append(itemErrors, batchItemError{Index: index, Reason: reason})
+		}
+	}
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if seen >= h.streamMaxItems {
+			writeError(w, http.StatusBadRequest, errCodeBatchTooLarge, "stream too large", map[string]any{"max": h.streamMaxItems})
+			return
+		}
+		index := seen
+		seen++
+
+		var p MetricsPayload
+		if err := json.Unmarshal(line, &p); err != nil {
+			skip(index, reasonMalformedLine)
+			continue
+		}
+		if reason := h.applyMetric(p); reason != "" {
+			skip(index, reason)
+			continue
+		}
+		processed++
+	}
+	if err := scanner.Err(); err != nil {
+		// Oversized line or transport error. Items before it are already
+		// applied; the 400 tells the client the stream as a whole failed.
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "stream read error: "+err.Error(), nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(batchResponse{
+		Processed: processed,
+		Skipped:   skipped,
+		Errors:    itemErrors,
+	}); err != nil {
+		log.Printf("Failed to encode stream response: %v", err)
+	}
+}
+
+// --- write-path rate limiting and load shedding -----------------------------
+//
+// A looping Python worker once hammered /metrics/push at thousands of
+// requests per second and starved the /health handler, tripping the liveness
+// probe. Two layers keep that from recurring: a token bucket across all POST
+// routes (429 + Retry-After, client backs off) and an in-flight cap (503, the
+// saturated-server signal). Both apply ONLY inside the write Group — the
+// read probes must stay answerable precisely when the write path is drowning.
+
+const (
+	// defaultWriteRPS / defaultWriteBurst size the POST token bucket. The
+	// legitimate pusher sends a handful of requests per 10s cycle; 50/s
+	// sustained with a 100 burst is an order of magnitude of headroom while
+	// still strangling a tight retry loop.
+	defaultWriteRPS   = 50
+	defaultWriteBurst = 100
+
+	// defaultMaxInFlight caps concurrent POST handlers. Pushes are cheap, so
+	// this many in flight at once already means something is looping.
+	defaultMaxInFlight = 64
+)
+
+// writeRateFromEnv reads the WRITE_RATE_RPS / WRITE_RATE_BURST overrides.
+// Same validation posture as the other env knobs: non-positive or unparsable
+// values warn and keep the defaults.
+func writeRateFromEnv() (float64, int) {
+	rps := float64(defaultWriteRPS)
+	if raw := strings.TrimSpace(os.Getenv("WRITE_RATE_RPS")); raw != "" {
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v <= 0 {
+			log.Printf("WARNING: invalid WRITE_RATE_RPS %q (must be a positive number) — using default %v", raw, rps)
+		} else {
+			rps = v
+		}
+	}
+	burst := defaultWriteBurst
+	if raw := strings.TrimSpace(os.Getenv("WRITE_RATE_BURST")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			log.Printf("WARNING: invalid WRITE_RATE_BURST %q (must be a positive integer) — using default %d", raw, burst)
+		} else {
+			burst = n
+		}
+	}
+	return rps, burst
+}
+
+// maxInFlightFromEnv reads the WRITE_MAX_INFLIGHT override.
+func maxInFlightFromEnv() int {
+	raw := strings.TrimSpace(os.Getenv("WRITE_MAX_INFLIGHT"))
+	if raw == "" {
+		return defaultMaxInFlight
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("WARNING: invalid WRITE_MAX_INFLIGHT %q (must be a positive integer) — using default %d", raw, defaultMaxInFlight)
+		return defaultMaxInFlight
+	}
+	return n
+}
+
+// rateLimitWrites is the POST token bucket. Reserve (rather than Allow) so
+// the 429 can carry an honest Retry-After; a reservation we won't use is
+// cancelled to give the tokens back.
+func (h *Service) rateLimitWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res := h.writeLimiter.Reserve()
+		if delay := res.Delay(); delay > 0 {
+			res.Cancel()
+			h.metrics.writesThrottled.Inc()
+			seconds := int(delay/time.Second) + 1 // round up; 0 would mean "retry now"
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeError(w, http.StatusTooManyRequests, errCodeRateLimited, "rate limit exceeded", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// shedWrites caps concurrent POST handlers. Over the cap the request is shed
+// with 503 immediately — queueing it would just move the starvation into the
+// connection backlog.
+func (h *Service) shedWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.inFlightCount.Add(1) > int64(h.maxInFlight) {
+			h.inFlightCount.Add(-1)
+			h.metrics.writesShed.Inc()
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusServiceUnavailable, errCodeSaturated, "server saturated", nil)
+			return
+		}
+		defer h.inFlightCount.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// baseRouter builds a chi router carrying the middleware stack every listener
+// gets, whether it serves the full surface (Routes) or only the anonymous
+// probes (PublicRoutes).
+func (h *Service) baseRouter() chi.Router {
+	r := chi.NewRouter()
+
+	// Middleware. The per-route metrics sit OUTERMOST so they observe the
+	// final status of everything below, including panics turned into 500s by
+	// Recoverer (and any timeout middleware, should one ever be added — see
+	// the NOTE below for why there isn't one today).
+	r.Use(h.httpMetrics.Middleware)
+	// Tracing (see tracing.go) only when an OTLP endpoint is configured; the
+	// default router never pays for it.
+	if h.tracer != nil {
+		r.Use(h.traceMiddleware)
+	}
+	// The logger resolves per request from the live Config snapshot so a
+	// reloaded LOG_LEVEL/LOG_FORMAT applies to routers already serving.
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			RequestLogger(h.config().Logger)(next).ServeHTTP(w, r)
+		})
+	})
+	// Load shedding sits after logging (shed requests should still appear in
+	// the logs and metrics) and before Recoverer + the handlers it protects.
+	r.Use(h.limiter.Middleware)
+	// CORS (see cors.go) only when an allowlist is configured; the default
+	// router carries no CORS surface whatsoever.
+	if len(h.corsOrigins) > 0 {
+		r.Use(h.corsMiddleware)
+	}
+	// Local recoverer (see errors.go): same contract as chi's, but the 500
+	// speaks the JSON error envelope instead of an empty body.
+	r.Use(recoverer)
+	// NOTE: there is deliberately no router-wide timeout here. chi's
+	// middleware.Timeout only signals via the request context — it does NOT
+	// interrupt handlers that ignore ctx, and can race a "superfluous
+	// response.WriteHeader" when a slow handler eventually writes. Per-route
+	// budgets come from timeoutMiddleware (see timeouts.go), whose buffered
+	// writer avoids that race; http.Server.WriteTimeout remains the outer
+	// backstop.
+	// Security headers
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.Header().Set("X-Frame-Options", "DENY")
+			next.ServeHTTP(w, r)
+		})
+	})
+	return r
+}
+
+// registerProbeRoutes mounts the anonymous probe endpoints: /health,
+// /health/live and /health/ready. These are intentionally anonymous: the
+// Python health poller fetches /health with no Authorization header, and
+// liveness/readiness probes must not require a token. Only /metrics and
+// /stats (which expose the richer telemetry/version surface) are token-gated
+// in Routes. Shared between Routes and PublicRoutes so the two listeners of a
+// split deployment serve byte-identical probe responses.
+func (h *Service) registerProbeRoutes(r chi.Router) {
+	// Probes get the tightest per-route budget (see timeouts.go): a liveness
+	// answer that takes longer than 2s is already a failed probe.
+	r = r.With(h.timeoutMiddleware("probes", h.probeTimeout))
+	// The v1 health document announces its deprecation status when one is
+	// configured (see deprecation.go); unconfigured, Wrap is a no-op.
+	r.Get("/health", h.deprecations.Wrap("health_v1", func(w http.ResponseWriter, r *http.Request) {
+		status := h.GetStatus()
+
+		if status.Status != "healthy" {
+			// No conditional handling on the failure path: an unhealthy
+			// answer carries its body every time.
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			if err := json.NewEncoder(w).Encode(status); err != nil {
+				log.Printf("Failed to encode health status: %v", err)
+			}
+			return
+		}
+
+		// The dashboard polls this at 1 Hz; a weak ETag over the semantic
+		// state (see etag.go) turns the unchanged case into an empty 304.
+		if writeConditional(w, r, healthStatusETag(status)) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			log.Printf("Failed to encode health status: %v", err)
+		}
+	}))
+
+	// Simple liveness probe
+	r.Get("/health/live", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write([]byte("OK")); err != nil {
+			log.Printf("Failed to write liveness response: %v", err)
+		}
+	})
+
+	// Readiness probe. JSON by default (listing every gating condition the
+	// decision consumed — see ReadinessReport); plain "READY"/"NOT READY" via
+	// Accept: text/plain for dumb probes. Status codes are unchanged either way.
+	r.Get("/health/ready", func(w http.ResponseWriter, r *http.Request) {
+		report := h.GetReadinessReport()
+		code := http.StatusOK
+		if !report.Ready {
+			code = http.StatusServiceUnavailable
+		}
+
+		if wantsPlainText(r.Header.Get("Accept")) {
+			w.WriteHeader(code)
+			text := "READY"
+			if !report.Ready {
+				text = "NOT READY"
+			}
+			if _, err := w.Write([]byte(text)); err != nil {
+				log.Printf("Failed to write readiness response: %v", err)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			log.Printf("Failed to encode readiness response: %v", err)
+		}
+	})
+}
+
+// PublicRoutes is the probe-only surface for a split deployment: just
+// /health, /health/live and /health/ready, with the same middleware stack as
+// Routes. A binary binds this to the pod-reachable address and keeps the full
+// Routes surface (metrics, pushes, stats, admin) on a loopback-only admin
+// listener, so exposing the probes to an orchestrator never exposes the
+// telemetry write path with them.
+func (h *Service) PublicRoutes() chi.Router {
+	r := h.baseRouter()
+	h.registerProbeRoutes(r)
+	return r
+}
+
+// Routes wires the chi router: middleware, read endpoints and the token-gated
+// write Group. A chi.Router is itself an http.Handler, so binaries serve it
+// directly and embedders mount it under a prefix in their own router. Keeping
+// the wiring in one method means the security-critical middleware-to-route
+// binding can be exercised by an httptest integration test
+// (TestRouterAuthWiring) instead of being reachable only by running a binary.
+func (h *Service) Routes() chi.Router {
+	r := h.baseRouter()
+
+	// Token gates resolve the expected token per request from the live Config
+	// snapshot (see reload.go), so a reloaded HEALTH_API_TOKEN applies to this
+	// router without rebuilding it.
+
+	// Prometheus metrics endpoint. Gated by requireReadToken: when
+	// HEALTH_API_TOKEN is set the full Prometheus surface (token counts, cache
+	// ratios, AI latency histograms, circuit-breaker states, ...) requires the
+	// bearer token, matching the Python sibling's _PROTECTED_ENDPOINTS; when no
+	// token is set it stays anonymous so the default loopback scrape works.
+	r.With(h.readTokenMiddleware, h.timeoutMiddleware("metrics", h.metricsTimeout)).Handle("/metrics",
+		promhttp.HandlerFor(h.registry, promhttp.HandlerOpts{}))
+
+	// Health check endpoints (/health, /health/live, /health/ready) — see
+	// registerProbeRoutes, which also backs the split-listener PublicRoutes.
+	h.registerProbeRoutes(r)
+
+	// Deprecation status for everything this service serves.
+	r.Get("/capabilities", h.deprecations.CapabilitiesHandler("health_api", h.version))
+
+	// Machine-readable API contract (see openapi.go). Anonymous like
+	// /version — the document describes the surface, it carries no data.
+	// The conformance tests in openapi_test.go keep it honest against the
+	// route set this method actually wires.
+	r.Get("/openapi.json", OpenAPIHandler(healthAPISpecJSON))
+	if DocsUIEnabled() {
+		r.Get("/docs", SwaggerUIHandler("health_api", "/openapi.json"))
+	}
+
+	// Build identity. Anonymous like /health, which already reports the
+	// version — /version just answers it without the full status document.
+	r.Get("/version", VersionHandler(h.version, h.build))
+
+	// Machine-readable contract for the /health document (see schema.go).
+	r.Get("/health/schema", h.handleHealthSchema)
+
+	// Startup probe: 503 until the required services have each been healthy
+	// once (or the grace deadline passes), then 200 forever (see startup.go).
+	r.With(h.timeoutMiddleware("probes", h.probeTimeout)).Get("/health/startup", h.handleStartup)
+
+	// All write endpoints below require a bearer token. We wrap them in a
+	// Group so the middleware applies to every Post() but does NOT touch
+	// the read-only /health, /metrics, /stats handlers above.
+	r.Group(func(r chi.Router) {
+		// The source-IP allowlist (see ipallow.go) sits outermost — it's the
+		// cheapest check and needs no body or token. Auth next so an
+		// unauthenticated flood can't drain the token bucket out from under
+		// the legitimate pusher; shed before rate-limiting so a saturated
+		// server answers with the cheaper check.
+		r.Use(h.ipAllowMiddleware)
+		r.Use(h.writeTokenMiddleware)
+		r.Use(h.shedWrites)
+		r.Use(h.rateLimitWrites)
+		// Innermost so only requests that actually reach a push handler
+		// consume (and can miss) the push budget — see timeouts.go.
+		r.Use(h.timeoutMiddleware("push", h.pushTimeout))
+
+		// Handlers are named methods (see below) so they can be exercised
+		// directly by httptest in main_test.go — the security-critical input
+		// validation here is the source of truth for the contract.
+		r.Post("/health/service", h.handleServiceStatus)
+		// Atomic status batches (see servicebatch.go).
+		r.Post("/health/services", h.handleServiceBatch)
+		r.Post("/health/heartbeat", h.handleHeartbeat)
+		r.Post("/health/shard", h.handleShard)
+		r.Post("/metrics/push", h.handleMetricsPush)
+		r.Post("/metrics/batch", h.handleMetricsBatch)
+		r.Post("/metrics/stream", h.handleMetricsStream)
+		r.Post("/metrics/ingest", h.handleMetricsIngest)
+		// Prometheus remote-write receive path (see remotewrite.go).
+		r.Post("/api/v1/write", h.handleRemoteWrite)
+		// Runtime metric declarations (see dynmetrics.go).
+		r.Post("/metrics/register", h.handleMetricsRegister)
+	}) // end auth-protected Group
+
+	// Maintenance toggle: auth-gated like the writes, but deliberately OUTSIDE
+	// the shed/rate-limit group — the operator needs to drain the instance
+	// precisely when it is saturated, so the toggle must not be shed with the
+	// metric pushes.
+	r.With(h.writeTokenMiddleware).Post("/admin/maintenance", h.handleMaintenance)
+
+	// Config reload (see reload.go): auth-gated and, like the maintenance
+	// toggle, outside the shed/rate-limit group — the operator may well be
+	// reloading to RAISE a limit on a saturated instance.
+	r.With(h.writeTokenMiddleware).Post("/admin/reload", h.handleReload)
+
+	// Forced GC with before/after heap stats (see gcstats.go). Auth-gated:
+	// stop-the-world pauses on demand are a DoS lever.
+	r.With(h.writeTokenMiddleware).Post("/admin/gc", h.handleGC)
+
+	// Scheduled downtime windows (see downtime.go). Declarations and
+	// deletions are operator writes; the list is read-gated like /stats.
+	r.With(h.writeTokenMiddleware).Post("/admin/downtime", h.handleDowntimePost)
+	r.With(h.readTokenMiddleware).Get("/admin/downtime", h.handleDowntimeList)
+	r.With(h.writeTokenMiddleware).Delete("/admin/downtime/{id}", h.handleDowntimeDelete)
+
+	// Incident log (see incidents.go). Reads are token-gated like
+	// /health/services — they expose the service inventory and outage history;
+	// notes are operator writes.
+	r.With(h.readTokenMiddleware).Get("/circuit-breakers", h.handleBreakers)
+	r.With(h.readTokenMiddleware).Get("/incidents", h.handleIncidentList)
+	r.With(h.readTokenMiddleware).Get("/incidents/{id}", h.handleIncidentGet)
+	r.With(h.writeTokenMiddleware).Post("/incidents/{id}/notes", h.handleIncidentNote)
+
+	// Paginated service list. Token-gated like /stats — it exposes the full
+	// service-name inventory. Sorted so pagination windows are stable.
+	r.With(h.readTokenMiddleware).Get("/health/services", func(w http.ResponseWriter, r *http.Request) {
+		status := h.GetStatus()
+		names := make([]string, 0, len(status.Services))
+		for name := range status.Services {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		messages := h.ServiceMessages()
+		entries := make([]serviceEntry, 0, len(names))
+		for _, name := range names {
+			entries = append(entries, serviceEntry{
+				Name:    name,
+				Healthy: status.Services[name],
+				Message: messages[name],
+			})
+		}
+		p := parsePageParams(r.URL.Query())
+		start, end := paginate(len(entries), p)
+		writeListResponse(w, r.URL, len(entries), p, entries[start:end], h.listMaxBytes)
+	})
+
+	// Stats summary. Token-gated like /metrics (see requireReadToken): the JSON
+	// body exposes version, uptime, service names and memory/goroutine/GC
+	// figures, which the Python sibling treats as a protected endpoint. The
+	// whole /stats family shares the "stats" timeout budget (see timeouts.go).
+	statsTimeout := h.timeoutMiddleware("stats", h.statsTimeout)
+	r.With(h.readTokenMiddleware, statsTimeout).Get("/stats", func(w http.ResponseWriter, r *http.Request) {
+		// GetStatus() reads the cached MemStats snapshot (cachedMem* atomics,
+		// refreshed by the background collector tick) — it no longer does
+		// an inline stop-the-world runtime.ReadMemStats per request. So the
+		// collectSystemMetrics() call that used to sit here was a redundant
+		// second STW MemStats read with no effect on the response. Dropped.
+		status := h.GetStatus()
+		// Content negotiation (see promtext.go): Prometheus text on request,
+		// JSON by default.
+		if statsWantsPrometheus(r) {
+			h.writeStatsPromText(w, status)
+			return
+		}
+		// Same conditional handling as /health (see etag.go) — the JSON
+		// shape differs but the semantic state is the same snapshot.
+		if writeConditional(w, r, healthStatusETag(status)) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			log.Printf("Failed to encode stats response: %v", err)
+		}
+	})
+
+	// Daily rollup, token-gated like /stats (same telemetry surface).
+	r.With(h.readTokenMiddleware, statsTimeout).Get("/stats/daily", h.handleStatsDaily)
+
+	// Process-lifetime availability per service and in aggregate (see sla.go).
+	r.With(h.readTokenMiddleware, statsTimeout).Get("/stats/sla", h.handleSLA)
+	r.With(h.readTokenMiddleware, statsTimeout).Get("/stats/history", h.handleStatsHistory)
+	r.With(h.readTokenMiddleware, statsTimeout).Get("/stats/commands", h.handleCommandStats)
+	r.With(h.readTokenMiddleware, statsTimeout).Get("/stats/guilds", h.handleGuildStats)
+	// Live alert-rule states (see alerts.go) — same telemetry surface.
+	r.With(h.readTokenMiddleware).Get("/alerts", h.handleAlerts)
+
+	// Single-document debug export for bug reports (see debugsnap.go).
+	// Token-gated: it bundles the whole telemetry surface in one body.
+	r.With(h.readTokenMiddleware).Get("/debug/snapshot", h.handleDebugSnapshot)
+	r.With(h.readTokenMiddleware).Get("/metrics/cardinality", h.handleCardinality)
+
+	// AI cost estimate derived from the pushed token counters. Plain reads are
+	// gated like /stats; the ?reset=true variant zeroes the accumulator, which
+	// is a write, so it demands the full bearer token (fail-closed when no
+	// token is configured — same posture as every other write).
+	costRead := h.readTokenMiddleware(statsTimeout(http.HandlerFunc(h.handleStatsCost)))
+	costReset := h.writeTokenMiddleware(statsTimeout(http.HandlerFunc(h.handleStatsCost)))
+	r.Get("/stats/cost", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("reset") == "true" {
+			costReset.ServeHTTP(w, r)
+			return
+		}
+		costRead.ServeHTTP(w, r)
+	})
+
+	return r
+}
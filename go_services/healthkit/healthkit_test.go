@@ -0,0 +1,2652 @@
+package healthkit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// ---------------------------------------------------------------------------
+// HealthService unit tests
+// ---------------------------------------------------------------------------
+
+func TestNewHealthService(t *testing.T) {
+	hs := New(WithVersion("1.0.0"))
+	if hs == nil {
+		t.Fatal("NewHealthService returned nil")
+	}
+	if hs.version != "1.0.0" {
+		t.Errorf("expected version '1.0.0', got '%s'", hs.version)
+	}
+}
+
+func TestGetStatusHealthy(t *testing.T) {
+	hs := New(WithVersion("test"))
+	hs.SetServiceStatus("bot", true)
+	hs.SetServiceStatus("database", true)
+
+	status := hs.GetStatus()
+	if status.Status != "healthy" {
+		t.Errorf("expected 'healthy', got '%s'", status.Status)
+	}
+	if status.Version != "test" {
+		t.Errorf("expected version 'test', got '%s'", status.Version)
+	}
+}
+
+func TestGetStatusDegraded(t *testing.T) {
+	hs := New(WithVersion("test"))
+	hs.SetServiceStatus("bot", true)
+	hs.SetServiceStatus("database", false) // unhealthy → degraded
+
+	status := hs.GetStatus()
+	if status.Status != "degraded" {
+		t.Errorf("expected 'degraded', got '%s'", status.Status)
+	}
+}
+
+func TestSetServiceStatusCap(t *testing.T) {
+	hs := New(WithVersion("test"))
+	hs.maxServices = 5 // small cap so the boundary is cheap to exercise
+
+	// Fill to exactly the cap — every insert up to and including the cap-th
+	// must be accepted.
+	for i := 0; i < hs.maxServices; i++ {
+		if !hs.SetServiceStatus(fmt.Sprintf("svc-%d", i), true) {
+			t.Fatalf("insert %d under/at cap should be accepted", i)
+		}
+	}
+
+	// One over: rejected, and the map must not grow.
+	if hs.SetServiceStatus("overflow", true) {
+		t.Error("insert past cap should be rejected")
+	}
+
+	// Update of an EXISTING key at cap must still be allowed.
+	if !hs.SetServiceStatus("svc-0", false) {
+		t.Error("update of existing key at cap should be accepted")
+	}
+
+	hs.mu.RLock()
+	count := len(hs.services)
+	healthy := hs.services["svc-0"]
+	hs.mu.RUnlock()
+
+	if count != hs.maxServices {
+		t.Errorf("expected exactly %d services, got %d", hs.maxServices, count)
+	}
+	if healthy {
+		t.Error("expected svc-0 to be unhealthy after at-cap update")
+	}
+}
+
+func TestMaxServicesFromEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want int
+	}{
+		{"unset uses default", "", defaultMaxServices},
+		{"valid override", "250", 250},
+		{"zero rejected", "0", defaultMaxServices},
+		{"negative rejected", "-5", defaultMaxServices},
+		{"garbage rejected", "lots", defaultMaxServices},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("MAX_SERVICES", tc.env)
+			if got := maxServicesFromEnv(); got != tc.want {
+				t.Errorf("maxServicesFromEnv() with %q = %d, want %d", tc.env, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHandleServiceStatus_CapConflict(t *testing.T) {
+	hs := New(WithVersion("test"))
+	hs.maxServices = 1
+	hs.SetServiceStatus("existing", true)
+
+	// New name past the cap => 409 with a JSON body naming the cap.
+	rec := postJSON(t, hs.handleServiceStatus, `{"name":"newcomer","healthy":true}`)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409", rec.Code)
+	}
+	env := decodeErrorEnvelope(t, rec)
+	if env.Code != heartbeatReasonMapFull {
+		t.Errorf("409 code = %q, want %q", env.Code, heartbeatReasonMapFull)
+	}
+	if got, _ := env.Details["max_services"].(float64); int(got) != 1 {
+		t.Errorf("409 details max_services = %v, want 1", env.Details["max_services"])
+	}
+
+	// Update of the existing key at cap still succeeds.
+	rec = postJSON(t, hs.handleServiceStatus, `{"name":"existing","healthy":false}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("at-cap update status = %d, want 200", rec.Code)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Atomic heartbeat batches
+// ---------------------------------------------------------------------------
+
+func TestApplyHeartbeat_AllOrNothingOnInvalidName(t *testing.T) {
+	hs := New(WithVersion("test"))
+	hs.SetServiceStatus("bot", true)
+	genBefore := hs.GetStatus().HeartbeatGeneration
+
+	// One valid item + one invalid name: NOTHING may land, including the
+	// valid item — that half-applied state is what the batch exists to remove.
+	gen, reason := hs.ApplyHeartbeat(map[string]bool{
+		"database": true,
+		"":         true,
+	})
+	if reason != heartbeatReasonInvalidName {
+		t.Fatalf("reason = %q, want %q", reason, heartbeatReasonInvalidName)
+	}
+	if gen != 0 {
+		t.Errorf("rejected batch returned generation %d, want 0", gen)
+	}
+
+	hs.mu.RLock()
+	_, databaseApplied := hs.services["database"]
+	hs.mu.RUnlock()
+	if databaseApplied {
+		t.Error("valid item of a rejected batch must not be applied")
+	}
+	if got := hs.GetStatus().HeartbeatGeneration; got != genBefore {
+		t.Errorf("generation moved from %d to %d on a rejected batch", genBefore, got)
+	}
+}
+
+func TestApplyHeartbeat_AllOrNothingOnCap(t *testing.T) {
+	hs := New(WithVersion("test"))
+	hs.maxServices = 2
+	hs.SetServiceStatus("bot", true)
+
+	// Batch mixes an existing name (doesn't count against the cap) with two
+	// new ones; only one slot is free, so the whole batch is rejected — the
+	// existing name's update must not land either.
+	_, reason := hs.ApplyHeartbeat(map[string]bool{
+		"bot":      false,
+		"database": true,
+		"gemini":   true,
+	})
+	if reason != heartbeatReasonMapFull {
+		t.Fatalf("reason = %q, want %q", reason, heartbeatReasonMapFull)
+	}
+
+	hs.mu.RLock()
+	count := len(hs.services)
+	botHealthy := hs.services["bot"]
+	hs.mu.RUnlock()
+	if count != 1 {
+		t.Errorf("service count = %d, want 1 (nothing applied)", count)
+	}
+	if !botHealthy {
+		t.Error("existing service's update from a rejected batch must not be applied")
+	}
+
+	// Existing-name updates never count against the cap: the same batch
+	// minus one newcomer fits.
+	if _, reason := hs.ApplyHeartbeat(map[string]bool{"bot": false, "database": true}); reason != "" {
+		t.Errorf("batch that fits the cap rejected with %q", reason)
+	}
+}
+
+func TestApplyHeartbeat_GenerationAndTimestamp(t *testing.T) {
+	fc := newFakeClock(time.Date(2026, 2, 3, 10, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(fc))
+
+	status := hs.GetStatus()
+	if status.HeartbeatGeneration != 0 || status.LastHeartbeat != "" {
+		t.Fatalf("pre-heartbeat status = gen %d, last %q; want 0 and empty",
+			status.HeartbeatGeneration, status.LastHeartbeat)
+	}
+
+	gen, reason := hs.ApplyHeartbeat(map[string]bool{"bot": true, "database": true})
+	if reason != "" || gen != 1 {
+		t.Fatalf("first batch: gen=%d reason=%q, want 1 and empty", gen, reason)
+	}
+
+	fc.Advance(30 * time.Second)
+	if gen, _ := hs.ApplyHeartbeat(map[string]bool{"bot": true}); gen != 2 {
+		t.Fatalf("second batch generation = %d, want 2", gen)
+	}
+
+	status = hs.GetStatus()
+	if status.HeartbeatGeneration != 2 {
+		t.Errorf("status generation = %d, want 2", status.HeartbeatGeneration)
+	}
+	// One timestamp for the whole batch, taken from the injected clock.
+	if status.LastHeartbeat != "2026-02-03T10:00:30.000Z" {
+		t.Errorf("last_heartbeat = %q, want 2026-02-03T10:00:30.000Z", status.LastHeartbeat)
+	}
+}
+
+func TestHandleHeartbeat(t *testing.T) {
+	hs := New(WithVersion("test"))
+
+	rec := postJSON(t, hs.handleHeartbeat, `{"services":{"bot":true,"database":false}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body=%s)", rec.Code, rec.Body.String())
+	}
+	var ok struct {
+		Generation uint64 `json:"generation"`
+		Applied    int    `json:"applied"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &ok); err != nil {
+		t.Fatalf("200 body is not JSON: %v", err)
+	}
+	if ok.Generation != 1 || ok.Applied != 2 {
+		t.Errorf("body = %+v, want generation 1 applied 2", ok)
+	}
+
+	// Empty batch and invalid names are 400s with a stable reason.
+	for _, tc := range []struct {
+		name, body, reason string
+	}{
+		{"empty batch", `{"services":{}}`, heartbeatReasonEmpty},
+		{"missing field", `{}`, heartbeatReasonEmpty},
+		{"invalid name", `{"services":{"":true}}`, heartbeatReasonInvalidName},
+	} {
+		rec := postJSON(t, hs.handleHeartbeat, tc.body)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", tc.name, rec.Code)
+			continue
+		}
+		if env := decodeErrorEnvelope(t, rec); env.Code != tc.reason {
+			t.Errorf("%s: code = %v, want %q", tc.name, env.Code, tc.reason)
+		}
+	}
+
+	// Cap overflow mirrors the single-service endpoint: 409 + max_services.
+	hs.maxServices = 2
+	rec = postJSON(t, hs.handleHeartbeat, `{"services":{"gemini":true}}`)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("cap overflow status = %d, want 409", rec.Code)
+	}
+	conflict := decodeErrorEnvelope(t, rec)
+	if got, _ := conflict.Details["max_services"].(float64); int(got) != 2 {
+		t.Errorf("409 details max_services = %v, want 2", conflict.Details["max_services"])
+	}
+
+	// Invalid JSON is a plain 400.
+	if rec := postJSON(t, hs.handleHeartbeat, `{"services":`); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid JSON status = %d, want 400", rec.Code)
+	}
+}
+
+func TestHeartbeat_NoTornSnapshots(t *testing.T) {
+	hs := New(WithVersion("test"))
+	names := []string{"alpha", "beta", "gamma", "delta"}
+	hs.ApplyHeartbeat(map[string]bool{"alpha": true, "beta": true, "gamma": true, "delta": true})
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	// Writers flip the WHOLE set between all-true and all-false in single
+	// batches. Because batches are atomic, every snapshot must show a uniform
+	// value across the four services — a mixed snapshot is a torn heartbeat.
+	for w := 0; w < 2; w++ {
+		wg.Add(1)
+		go func(healthy bool) {
+			defer wg.Done()
+			batch := make(map[string]bool, len(names))
+			for _, n := range names {
+				batch[n] = healthy
+			}
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					hs.ApplyHeartbeat(batch)
+				}
+			}
+		}(w == 0)
+	}
+
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				status := hs.GetStatus()
+				first := status.Services[names[0]]
+				for _, n := range names[1:] {
+					if status.Services[n] != first {
+						t.Errorf("torn snapshot: %v", status.Services)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	// Let readers finish, then stop the writers.
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("goroutines did not finish")
+	}
+}
+
+func TestSetServiceStatusUpdate(t *testing.T) {
+	hs := New(WithVersion("test"))
+	hs.SetServiceStatus("bot", true)
+	hs.SetServiceStatus("bot", false) // update existing
+
+	hs.mu.RLock()
+	healthy := hs.services["bot"]
+	hs.mu.RUnlock()
+
+	if healthy {
+		t.Error("expected bot to be unhealthy after update")
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Service status messages: one sanitizer, every sink inert
+// ---------------------------------------------------------------------------
+
+func TestSanitizeServiceMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain text untouched", "reconnecting, attempt 3", "reconnecting, attempt 3"},
+		{"ansi escapes stripped", "\x1b[31malert\x1b[0m", "[31malert[0m"},
+		{"newlines and tabs stripped", "line1\nline2\tend", "line1line2end"},
+		{"everyone neutralized", "fire! @everyone look", "fire! @\u200beveryone look"},
+		{"here neutralized", "@here now", "@\u200bhere now"},
+		{"role mention broken", "ping <@&123456> please", "ping <@\u200b&123456> please"},
+		{"user mention broken", "<@987654>", "<@\u200b987654>"},
+		{"trimmed", "  padded  ", "padded"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := sanitizeServiceMessage(tc.in); got != tc.want {
+				t.Errorf("sanitizeServiceMessage(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+
+	// Rune cap: 300 runes of Thai text (multi-byte) cut to exactly 256 runes.
+	long := strings.Repeat("ก", 300)
+	if got := []rune(sanitizeServiceMessage(long)); len(got) != maxServiceMessageRunes {
+		t.Errorf("cap = %d runes, want %d", len(got), maxServiceMessageRunes)
+	}
+}
+
+func TestServiceMessage_SinksAreInert(t *testing.T) {
+	hs := New(WithVersion("test"))
+	payload := `{"name":"bot","healthy":false,` +
+		`"message":"<script>alert(1)</script> @everyone \u001b[2Jwiped"}`
+	if rec := postJSON(t, hs.handleServiceStatus, payload); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+
+	stored := hs.ServiceMessages()["bot"]
+	// Log/terminal sink: no control bytes survive ingestion.
+	if strings.ContainsRune(stored, '\x1b') {
+		t.Errorf("stored message still carries ESC: %q", stored)
+	}
+	// Discord sink: the mass mention can no longer parse.
+	if strings.Contains(stored, "@everyone") {
+		t.Errorf("stored message still carries a live @everyone: %q", stored)
+	}
+
+	// JSON sink: the raw /health/services body must not contain a live
+	// mention either (encoding/json handles the quoting itself).
+	hs.setAuthToken("")
+	rec := doReq(t, hs.Routes(), http.MethodGet, "/health/services", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list status = %d, want 200", rec.Code)
+	}
+	if body := rec.Body.String(); strings.Contains(body, "@everyone") || strings.Contains(body, "\x1b") {
+		t.Errorf("list body leaks a live payload: %s", body)
+	}
+	var list struct {
+		Items []serviceEntry `json:"items"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list.Items) != 1 {
+		t.Fatalf("list decode: %v (items=%d)", err, len(list.Items))
+	}
+	if list.Items[0].Message != stored {
+		t.Errorf("list message = %q, want stored %q", list.Items[0].Message, stored)
+	}
+
+	// HTML sink contract: stored text is neutral, so the one transformation an
+	// HTML page owes is html.EscapeString — after it, no tag survives.
+	if escaped := html.EscapeString(stored); strings.Contains(escaped, "<script>") {
+		t.Errorf("html-escaped message still contains a live tag: %q", escaped)
+	}
+
+	// Clearing: omitted message wipes the stale note.
+	if rec := postJSON(t, hs.handleServiceStatus, `{"name":"bot","healthy":true}`); rec.Code != http.StatusOK {
+		t.Fatalf("clear status = %d, want 200", rec.Code)
+	}
+	if msg, ok := hs.ServiceMessages()["bot"]; ok {
+		t.Errorf("message not cleared: %q", msg)
+	}
+}
+
+func TestHealthStatusJSON(t *testing.T) {
+	hs := New(WithVersion("v1"))
+	hs.SetServiceStatus("bot", true)
+
+	status := hs.GetStatus()
+	data, err := json.Marshal(status)
+	if err != nil {
+		t.Fatalf("failed to marshal HealthStatus: %v", err)
+	}
+
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	if parsed["status"] != "healthy" {
+		t.Errorf("expected status 'healthy' in JSON, got %v", parsed["status"])
+	}
+	if parsed["version"] != "v1" {
+		t.Errorf("expected version 'v1' in JSON, got %v", parsed["version"])
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Clock seam: fake clock + injection via WithClock
+// ---------------------------------------------------------------------------
+
+// fakeClock is a manual test clock: Advance moves time forward and fires any
+// due After waiters and tickers, so time-driven logic is tested without
+// sleeping. Satisfies Clock.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+type fakeWaiter struct {
+	ch       chan time.Time
+	deadline time.Time
+	interval time.Duration // 0 => one-shot After; >0 => repeating ticker
+	stopped  bool
+}
+
+func newFakeClock(start time.Time) *fakeClock { return &fakeClock{now: start} }
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := &fakeWaiter{ch: make(chan time.Time, 1), deadline: f.now.Add(d)}
+	f.waiters = append(f.waiters, w)
+	return w.ch
+}
+
+func (f *fakeClock) NewTicker(d time.Duration) Ticker {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := &fakeWaiter{ch: make(chan time.Time, 1), deadline: f.now.Add(d), interval: d}
+	f.waiters = append(f.waiters, w)
+	return &fakeTicker{clock: f, w: w}
+}
+
+type fakeTicker struct {
+	clock *fakeClock
+	w     *fakeWaiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.w.ch }
+
+// Stop takes the clock lock: the probe loop calls it from its own goroutine
+// while the test goroutine may be inside Advance reading the same waiter.
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.w.stopped = true
+}
+
+// Advance moves the clock and delivers (non-blocking, like the real ticker's
+// 1-buffered channel) to every waiter whose deadline has passed.
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	var keep []*fakeWaiter
+	for _, w := range f.waiters {
+		for !w.stopped && !w.deadline.After(f.now) {
+			select {
+			case w.ch <- f.now:
+			default:
+			}
+			if w.interval == 0 {
+				w.stopped = true
+				break
+			}
+			w.deadline = w.deadline.Add(w.interval)
+		}
+		if !w.stopped {
+			keep = append(keep, w)
+		}
+	}
+	f.waiters = keep
+}
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	fc := newFakeClock(start)
+
+	if !fc.Now().Equal(start) {
+		t.Errorf("Now() = %v, want %v", fc.Now(), start)
+	}
+
+	after := fc.After(5 * time.Second)
+	tick := fc.NewTicker(2 * time.Second)
+
+	fc.Advance(1 * time.Second)
+	select {
+	case <-after:
+		t.Error("After fired before its deadline")
+	case <-tick.C():
+		t.Error("ticker fired before its interval")
+	default:
+	}
+
+	fc.Advance(4 * time.Second) // now +5s: After due; ticker due (1-buffered)
+	select {
+	case <-after:
+	default:
+		t.Error("After did not fire at its deadline")
+	}
+	select {
+	case <-tick.C():
+	default:
+		t.Error("ticker did not fire")
+	}
+
+	tick.Stop()
+	fc.Advance(10 * time.Second)
+	select {
+	case <-tick.C():
+		t.Error("stopped ticker must not fire")
+	default:
+	}
+}
+
+func TestWithClockDrivesUptime(t *testing.T) {
+	fc := newFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(fc))
+	hs.SetServiceStatus("bot", true)
+
+	fc.Advance(90 * time.Second)
+	status := hs.GetStatus()
+	if status.Uptime != "1m30s" {
+		t.Errorf("Uptime = %q, want \"1m30s\"", status.Uptime)
+	}
+	if status.Timestamp != "2026-01-01T00:01:30.000Z" {
+		t.Errorf("Timestamp = %q, want fake-clock time", status.Timestamp)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// sanitizeLabel / safeLabel
+// ---------------------------------------------------------------------------
+
+func TestSanitizeLabel(t *testing.T) {
+	short := sanitizeLabel("ok")
+	if short != "ok" {
+		t.Errorf("expected 'ok', got '%s'", short)
+	}
+
+	long := "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" // >64
+	result := sanitizeLabel(long)
+	if len(result) > maxLabelLength {
+		t.Errorf("sanitizeLabel should truncate to %d, got %d", maxLabelLength, len(result))
+	}
+}
+
+func TestSafeLabelAllowed(t *testing.T) {
+	// "status" key with "success" value is in the allowlist
+	result := safeLabel("status", "success")
+	if result != "success" {
+		t.Errorf("expected 'success', got '%s'", result)
+	}
+}
+
+func TestSafeLabelDisallowed(t *testing.T) {
+	// unknown key/value should return "other"
+	result := safeLabel("unknown_key", "unknown_value")
+	if result != "other" {
+		t.Errorf("expected 'other', got '%s'", result)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// requireBearerToken auth middleware (fail-closed)
+// ---------------------------------------------------------------------------
+
+func TestRequireBearerToken(t *testing.T) {
+	const token = "s3cret-token"
+	nextCalled := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nextCalled = true
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		expected   string
+		authHeader string
+		wantStatus int
+		wantNext   bool
+	}{
+		// Empty configured token => fail CLOSED with 503, never reach next.
+		{"empty token fails closed", "", "Bearer anything", http.StatusServiceUnavailable, false},
+		{"empty token no header", "", "", http.StatusServiceUnavailable, false},
+		{"missing header", token, "", http.StatusUnauthorized, false},
+		{"missing bearer prefix", token, token, http.StatusUnauthorized, false},
+		{"wrong-length token", token, "Bearer short", http.StatusUnauthorized, false},
+		{"wrong-value same-length", token, "Bearer s3cret-toleN", http.StatusUnauthorized, false},
+		{"correct token", token, "Bearer " + token, http.StatusOK, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			nextCalled = false
+			mw := requireBearerToken(tc.expected)(next)
+			req := httptest.NewRequest(http.MethodPost, "/metrics/push", nil)
+			if tc.authHeader != "" {
+				req.Header.Set("Authorization", tc.authHeader)
+			}
+			rec := httptest.NewRecorder()
+			mw.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+			if nextCalled != tc.wantNext {
+				t.Errorf("next called = %v, want %v", nextCalled, tc.wantNext)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// handleMetricsPush input validation
+// ---------------------------------------------------------------------------
+
+// buildRouter wires hs's routes with the given auth token — several tests
+// exercise the same Service under different token configurations, which the
+// construction-time WithAuthToken option can't express.
+func buildRouter(hs *Service, token string) http.Handler {
+	hs.setAuthToken(token)
+	return hs.Routes()
+}
+
+func postJSON(t *testing.T, handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// postGzipJSON is postJSON with the body gzip-compressed and the
+// Content-Encoding header set, exercising the transparent-decompression path.
+func postGzipJSON(t *testing.T, handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(body)); err != nil {
+		t.Fatalf("gzip write: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestGzipBody_PushBatchServiceStatus(t *testing.T) {
+	hs := New(WithVersion("test"))
+
+	// Gzipped and plain bodies must behave identically on all three writers.
+	rec := postGzipJSON(t, hs.handleMetricsPush,
+		`{"type":"counter","name":"requests","value":2,"labels":{"status":"success","endpoint":"ai"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("gzipped push status = %d, want 200 (body=%s)", rec.Code, rec.Body.String())
+	}
+	if got := testutil.ToFloat64(hs.metrics.requestsTotal.WithLabelValues("ai", "success")); got != 2 {
+		t.Errorf("requests{ai,success} = %v, want 2 after gzipped push", got)
+	}
+
+	rec = postGzipJSON(t, hs.handleMetricsBatch,
+		`[{"type":"gauge","name":"active_connections","value":9}]`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("gzipped batch status = %d, want 200", rec.Code)
+	}
+	var resp batchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Processed != 1 {
+		t.Errorf("gzipped batch processed = %d (err=%v), want 1", resp.Processed, err)
+	}
+
+	rec = postGzipJSON(t, hs.handleServiceStatus, `{"name":"worker","healthy":true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("gzipped service status = %d, want 200", rec.Code)
+	}
+
+	// Plain bodies keep working with no header.
+	if rec := postJSON(t, hs.handleMetricsPush,
+		`{"type":"gauge","name":"active_connections","value":3}`); rec.Code != http.StatusOK {
+		t.Errorf("plain push status = %d, want 200", rec.Code)
+	}
+}
+
+func TestGzipBody_Corrupt(t *testing.T) {
+	hs := New(WithVersion("test"))
+
+	// Garbage with the gzip header claim: rejected at the gzip header.
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("definitely not gzip"))
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	hs.handleMetricsPush(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("corrupt gzip status = %d, want 400", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "gzip") {
+		t.Errorf("corrupt gzip body = %q, want a message naming gzip", rec.Body.String())
+	}
+
+	// Unsupported encodings are an explicit 400, not silently-misparsed JSON.
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}"))
+	req.Header.Set("Content-Encoding", "br")
+	rec = httptest.NewRecorder()
+	hs.handleMetricsPush(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unsupported encoding status = %d, want 400", rec.Code)
+	}
+}
+
+func TestGzipBody_DecompressedOverLimit(t *testing.T) {
+	hs := New(WithVersion("test"))
+
+	// ~80KB decompressed (push limit is 64KB) but tiny on the wire — the
+	// gzip-bomb shape. The limit must bite on the DECOMPRESSED stream: 413,
+	// nothing applied.
+	body := `{"type":"counter","name":"requests","value":1,"labels":{"status":"` +
+		strings.Repeat("a", 80*1024) + `"}}`
+	rec := postGzipJSON(t, hs.handleMetricsPush, body)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413 for over-limit decompressed body", rec.Code)
+	}
+
+	// Boundary semantics of the limiter itself: exactly limit bytes read
+	// cleanly (budget is limit+1 so the EOF still comes through), limit+1
+	// errors instead of silently truncating.
+	atLimit := &limitedBody{r: strings.NewReader(strings.Repeat("x", 64)), remaining: 65}
+	if data, err := io.ReadAll(atLimit); err != nil || len(data) != 64 {
+		t.Errorf("at-limit read = %d bytes, err %v; want 64 and nil", len(data), err)
+	}
+	overLimit := &limitedBody{r: strings.NewReader(strings.Repeat("x", 65)), remaining: 65}
+	if _, err := io.ReadAll(overLimit); !errors.Is(err, errBodyTooLarge) {
+		t.Errorf("over-limit read err = %v, want errBodyTooLarge", err)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Write-path protection: token bucket + in-flight cap
+// ---------------------------------------------------------------------------
+
+func TestRateLimitWrites_BurstThen429(t *testing.T) {
+	// Near-zero refill so the bucket cannot recover mid-test: exactly the
+	// burst passes, everything after is 429.
+	hs := New(WithVersion("test"), WithWriteRateLimit(0.0001, 2))
+	r := buildRouter(hs, "tok")
+	body := `{"type":"gauge","name":"active_connections","value":1}`
+
+	for i := 0; i < 2; i++ {
+		if rec := doReq(t, r, http.MethodPost, "/metrics/push", "tok", body); rec.Code != http.StatusOK {
+			t.Fatalf("request %d inside burst: status = %d, want 200", i, rec.Code)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		rec := doReq(t, r, http.MethodPost, "/metrics/push", "tok", body)
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("request %d past burst: status = %d, want 429", i, rec.Code)
+		}
+		if rec.Header().Get("Retry-After") == "" {
+			t.Error("429 response missing Retry-After")
+		}
+	}
+	if got := testutil.ToFloat64(hs.metrics.writesThrottled); got != 3 {
+		t.Errorf("write_rate_limited_total = %v, want 3", got)
+	}
+
+	// The probes must stay answerable with the bucket fully drained.
+	for _, p := range []string{"/health", "/health/live", "/health/ready"} {
+		if rec := doReq(t, r, http.MethodGet, p, "", ""); rec.Code != http.StatusOK {
+			t.Errorf("GET %s with drained bucket: status = %d, want 200", p, rec.Code)
+		}
+	}
+}
+
+func TestShedWrites_InFlightCap(t *testing.T) {
+	hs := New(WithVersion("test"), WithMaxInFlight(1))
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	blocked := hs.shedWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+
+	// Occupy the single slot with a request parked inside the handler.
+	firstDone := make(chan struct{})
+	go func() {
+		defer close(firstDone)
+		blocked.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	}()
+	<-started
+
+	// Second concurrent request: shed, not queued.
+	rec := httptest.NewRecorder()
+	blocked.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("over-cap status = %d, want 503", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("503 response missing Retry-After")
+	}
+	if got := testutil.ToFloat64(hs.metrics.writesShed); got != 1 {
+		t.Errorf("write_load_shed_total = %v, want 1", got)
+	}
+
+	// Slot freed → next request goes through again.
+	close(release)
+	<-firstDone
+	rec = httptest.NewRecorder()
+	blocked.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+	if got := testutil.ToFloat64(hs.metrics.writesShed); got != 1 {
+		t.Errorf("freed slot still shed: write_load_shed_total = %v, want 1", got)
+	}
+}
+
+func TestWriteProtectionFromEnv(t *testing.T) {
+	t.Setenv("WRITE_RATE_RPS", "12.5")
+	t.Setenv("WRITE_RATE_BURST", "7")
+	t.Setenv("WRITE_MAX_INFLIGHT", "3")
+	rps, burst := writeRateFromEnv()
+	if rps != 12.5 || burst != 7 {
+		t.Errorf("writeRateFromEnv() = %v, %d; want 12.5, 7", rps, burst)
+	}
+	if got := maxInFlightFromEnv(); got != 3 {
+		t.Errorf("maxInFlightFromEnv() = %d, want 3", got)
+	}
+
+	// Fail-safe: garbage and non-positive values keep the defaults.
+	t.Setenv("WRITE_RATE_RPS", "fast")
+	t.Setenv("WRITE_RATE_BURST", "0")
+	t.Setenv("WRITE_MAX_INFLIGHT", "-1")
+	rps, burst = writeRateFromEnv()
+	if rps != defaultWriteRPS || burst != defaultWriteBurst {
+		t.Errorf("writeRateFromEnv() fail-safe = %v, %d; want defaults %v, %d",
+			rps, burst, float64(defaultWriteRPS), defaultWriteBurst)
+	}
+	if got := maxInFlightFromEnv(); got != defaultMaxInFlight {
+		t.Errorf("maxInFlightFromEnv() fail-safe = %d, want default %d", got, defaultMaxInFlight)
+	}
+}
+
+func TestHandleMetricsPush_Validation(t *testing.T) {
+	hs := New(WithVersion("test"))
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"valid counter", `{"type":"counter","name":"requests","value":1,"labels":{"status":"success","endpoint":"ai"}}`, http.StatusOK},
+		{"valid gauge circuit_breaker", `{"type":"gauge","name":"circuit_breaker","value":2,"labels":{"service":"gemini"}}`, http.StatusOK},
+		{"invalid JSON", `{not json`, http.StatusBadRequest},
+		{"unknown name", `{"type":"counter","name":"bogus","value":1}`, http.StatusBadRequest},
+		{"unknown type", `{"type":"guage","name":"requests","value":1}`, http.StatusBadRequest},
+		{"name/type mismatch", `{"type":"counter","name":"active_connections","value":1}`, http.StatusBadRequest},
+		// go-health-3: these two assert that encoding/json REJECTS a quoted,
+		// non-numeric value (-> 400 "invalid JSON") *before* the switch runs —
+		// NOT that the math.IsNaN/IsInf guard fired (it is unreachable from
+		// JSON; see TestNaNInfGuardLogic for the guard predicate itself).
+		{"counter rejects quoted non-number (decode 400)", `{"type":"counter","name":"requests","value":"NaN"}`, http.StatusBadRequest},
+		{"counter negative", `{"type":"counter","name":"requests","value":-5}`, http.StatusBadRequest},
+		{"histogram negative", `{"type":"histogram","name":"ai_response_time","value":-1}`, http.StatusBadRequest},
+		{"gauge rejects quoted non-number (decode 400)", `{"type":"gauge","name":"active_connections","value":"Inf"}`, http.StatusBadRequest},
+		// go-health-3 regressions:
+		{"circuit_breaker out of range high", `{"type":"gauge","name":"circuit_breaker","value":999,"labels":{"service":"gemini"}}`, http.StatusBadRequest},
+		{"circuit_breaker negative", `{"type":"gauge","name":"circuit_breaker","value":-5,"labels":{"service":"gemini"}}`, http.StatusBadRequest},
+		{"active_connections negative", `{"type":"gauge","name":"active_connections","value":-1}`, http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := postJSON(t, hs.handleMetricsPush, tc.body)
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d (body=%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// safeLabel wiring: junk label values must land on the "other" series, never
+// mint a new one (the cardinality explosion the helper exists to prevent).
+// Assert on before/after deltas of the service's own counters.
+// ---------------------------------------------------------------------------
+
+func TestHandleMetricsPush_JunkLabelsCollapseToOther(t *testing.T) {
+	hs := New(WithVersion("test"))
+	tests := []struct {
+		name  string
+		body  string
+		gauge prometheus.Counter // the "other" series the junk must land on
+	}{
+		{
+			"requests junk status+endpoint",
+			`{"type":"counter","name":"requests","value":1,"labels":{"status":"weird-9000","endpoint":"/../../etc"}}`,
+			hs.metrics.requestsTotal.WithLabelValues("other", "other"),
+		},
+		{
+			"rate_limit junk type",
+			`{"type":"counter","name":"rate_limit","value":1,"labels":{"type":"user-1234567890"}}`,
+			hs.metrics.rateLimitHits.WithLabelValues("other"),
+		},
+		{
+			"cache junk result",
+			`{"type":"counter","name":"cache","value":1,"labels":{"result":"HIT!!!"}}`,
+			hs.metrics.cacheHits.WithLabelValues("other"),
+		},
+		{
+			"tokens junk type",
+			`{"type":"counter","name":"tokens","value":1,"labels":{"type":"` + strings.Repeat("x", 200) + `"}}`,
+			hs.metrics.tokensUsed.WithLabelValues("other", "unknown"),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			before := testutil.ToFloat64(tc.gauge)
+			rec := postJSON(t, hs.handleMetricsPush, tc.body)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200 (body=%s)", rec.Code, rec.Body.String())
+			}
+			after := testutil.ToFloat64(tc.gauge)
+			if after != before+1 {
+				t.Errorf(`"other" series = %v, want %v (junk label must collapse, not mint a series)`, after, before+1)
+			}
+		})
+	}
+}
+
+func TestHandleMetricsBatch_JunkLabelsCollapseToOther(t *testing.T) {
+	hs := New(WithVersion("test"))
+	other := hs.metrics.requestsTotal.WithLabelValues("other", "other")
+	before := testutil.ToFloat64(other)
+	body := `[{"type":"counter","name":"requests","value":1,"labels":{"status":"junk-val","endpoint":"junk-ep"}}]`
+	rec := postJSON(t, hs.handleMetricsBatch, body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body=%s)", rec.Code, rec.Body.String())
+	}
+	if after := testutil.ToFloat64(other); after != before+1 {
+		t.Errorf(`batch junk labels: "other" series = %v, want %v`, after, before+1)
+	}
+}
+
+func TestHandleMetricsPush_UnknownNameRejected(t *testing.T) {
+	hs := New(WithVersion("test"))
+	rec := postJSON(t, hs.handleMetricsPush, `{"type":"counter","name":"totally_new_metric","value":1}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown metric name: status = %d, want 400", rec.Code)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Per-model token/latency metrics: `model` label allowlist (ALLOWED_MODELS)
+// ---------------------------------------------------------------------------
+
+// withAllowedModels builds the model allowlist option for New (the allowlist
+// is normally assembled from env by OptionsFromEnv).
+func withAllowedModels(models ...string) Option {
+	m := map[string]bool{}
+	for _, name := range models {
+		m[name] = true
+	}
+	return WithAllowedModels(m)
+}
+
+func TestSafeModelLabel(t *testing.T) {
+	hs := New(withAllowedModels("gemini-2.5-flash", "gemini-2.5-pro"))
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", "unknown"}, // pre-label payloads keep working mid-deploy
+		{"gemini-2.5-flash", "gemini-2.5-flash"},
+		{"gemini-2.5-pro", "gemini-2.5-pro"},
+		{"gpt-9-experimental", "other"}, // not allowlisted — collapse
+		{strings.Repeat("m", 200), "other"},
+	}
+	for _, tt := range tests {
+		if got := hs.safeModelLabel(tt.in); got != tt.want {
+			t.Errorf("safeModelLabel(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAllowedModelsFromEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want []string
+	}{
+		{"unset", "", nil},
+		{"single", "gemini-2.5-flash", []string{"gemini-2.5-flash"}},
+		{"list with spaces and empties", " gemini-2.5-flash , gemini-2.5-pro ,,", []string{"gemini-2.5-flash", "gemini-2.5-pro"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ALLOWED_MODELS", tt.env)
+			got := allowedModelsFromEnv()
+			if len(got) != len(tt.want) {
+				t.Fatalf("allowedModelsFromEnv() = %v, want %v", got, tt.want)
+			}
+			for _, m := range tt.want {
+				if !got[m] {
+					t.Errorf("allowedModelsFromEnv() missing %q (got %v)", m, got)
+				}
+			}
+		})
+	}
+}
+
+func TestTokensPush_ModelLabel(t *testing.T) {
+	hs := New(WithVersion("test"), withAllowedModels("gemini-2.5-flash"))
+	tests := []struct {
+		name   string
+		body   string
+		series prometheus.Counter
+	}{
+		{
+			"allowlisted model lands on its own series",
+			`{"type":"counter","name":"tokens","value":3,"labels":{"type":"input","model":"gemini-2.5-flash"}}`,
+			hs.metrics.tokensUsed.WithLabelValues("input", "gemini-2.5-flash"),
+		},
+		{
+			"legacy payload without model defaults to unknown",
+			`{"type":"counter","name":"tokens","value":3,"labels":{"type":"output"}}`,
+			hs.metrics.tokensUsed.WithLabelValues("output", "unknown"),
+		},
+		{
+			"unlisted model collapses to other",
+			`{"type":"counter","name":"tokens","value":3,"labels":{"type":"input","model":"shadow-model-v2"}}`,
+			hs.metrics.tokensUsed.WithLabelValues("input", "other"),
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			before := testutil.ToFloat64(tc.series)
+			rec := postJSON(t, hs.handleMetricsPush, tc.body)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200 (body=%s)", rec.Code, rec.Body.String())
+			}
+			if after := testutil.ToFloat64(tc.series); after != before+3 {
+				t.Errorf("series = %v, want %v", after, before+3)
+			}
+		})
+	}
+}
+
+func TestAIResponseTimePush_ModelLabel(t *testing.T) {
+	hs := New(WithVersion("test"), withAllowedModels("gemini-2.5-pro"))
+	// HistogramVec values aren't readable via testutil.ToFloat64; assert the
+	// label routing by counting child series before/after.
+	seed := []string{
+		`{"type":"histogram","name":"ai_response_time","value":1.5,"labels":{"model":"gemini-2.5-pro"}}`,
+		`{"type":"histogram","name":"ai_response_time","value":0.5}`,                                  // legacy → unknown
+		`{"type":"histogram","name":"ai_response_time","value":2.5,"labels":{"model":"not-a-model"}}`, // → other
+	}
+	for _, body := range seed {
+		if rec := postJSON(t, hs.handleMetricsPush, body); rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200 (body=%s)", rec.Code, rec.Body.String())
+		}
+	}
+	// Exactly the three bounded series may exist, no matter how many distinct
+	// junk model names were pushed.
+	if got := testutil.CollectAndCount(hs.metrics.aiResponseTime); got != 3 {
+		t.Errorf("aiResponseTime series count = %d, want 3 (pro/unknown/other)", got)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// /stats/cost: token cost estimation + reset
+// ---------------------------------------------------------------------------
+
+func TestTokenPriceFromEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want float64
+	}{
+		{"unset", "", 0},
+		{"valid", "0.35", 0.35},
+		{"integer", "2", 2},
+		{"negative ignored", "-1", 0},
+		{"garbage ignored", "cheap", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TOKEN_PRICE_INPUT", tt.env)
+			if got := tokenPriceFromEnv("TOKEN_PRICE_INPUT"); got != tt.want {
+				t.Errorf("tokenPriceFromEnv(%q) = %v, want %v", tt.env, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatsCost_ComputeAndReset(t *testing.T) {
+	fc := newFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(fc),
+		withAllowedModels("gemini-2.5-flash"),
+		WithTokenPrices(0.5, 1.5)) // per 1k tokens
+
+	pushes := []string{
+		`{"type":"counter","name":"tokens","value":2000,"labels":{"type":"input","model":"gemini-2.5-flash"}}`,
+		`{"type":"counter","name":"tokens","value":1000,"labels":{"type":"output"}}`,
+	}
+	for _, body := range pushes {
+		if rec := postJSON(t, hs.handleMetricsPush, body); rec.Code != http.StatusOK {
+			t.Fatalf("push status = %d (body=%s)", rec.Code, rec.Body.String())
+		}
+	}
+
+	getCost := func(query string) costReport {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		hs.handleStatsCost(rec, httptest.NewRequest("GET", "/stats/cost"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("cost status = %d (body=%s)", rec.Code, rec.Body.String())
+		}
+		var report costReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatalf("invalid cost JSON: %v", err)
+		}
+		return report
+	}
+
+	report := getCost("")
+	// 2000 input @ 0.5/1k = 1.0 ; 1000 output @ 1.5/1k = 1.5
+	if report.EstimatedCost != 2.5 {
+		t.Errorf("total cost = %v, want 2.5", report.EstimatedCost)
+	}
+	if report.Since != "2026-01-01T00:00:00.000Z" {
+		t.Errorf("since = %q, want process start", report.Since)
+	}
+	if len(report.Breakdown) != 2 {
+		t.Fatalf("breakdown rows = %d, want 2 (%+v)", len(report.Breakdown), report.Breakdown)
+	}
+	// Sorted by model: gemini-2.5-flash before unknown.
+	if r0 := report.Breakdown[0]; r0.Model != "gemini-2.5-flash" || r0.InputTokens != 2000 || r0.EstimatedCost != 1.0 {
+		t.Errorf("row 0 = %+v, want gemini-2.5-flash input=2000 cost=1.0", r0)
+	}
+	if r1 := report.Breakdown[1]; r1.Model != "unknown" || r1.OutputTokens != 1000 || r1.EstimatedCost != 1.5 {
+		t.Errorf("row 1 = %+v, want unknown output=1000 cost=1.5", r1)
+	}
+
+	// reset=true returns the closing report for the window, then zeroes it.
+	fc.Advance(90 * time.Second)
+	closing := getCost("?reset=true")
+	if !closing.Reset || closing.EstimatedCost != 2.5 {
+		t.Errorf("closing report = %+v, want reset=true with pre-reset totals", closing)
+	}
+	after := getCost("")
+	if after.EstimatedCost != 0 || len(after.Breakdown) != 0 {
+		t.Errorf("post-reset report = %+v, want empty", after)
+	}
+	if after.Since != "2026-01-01T00:01:30.000Z" {
+		t.Errorf("post-reset since = %q, want the reset time", after.Since)
+	}
+}
+
+func TestStatsCost_ResetAuth(t *testing.T) {
+	hs := New(WithVersion("test"), WithTokenPrices(1, 1))
+
+	// Token configured: plain read needs the (read) token; reset needs it too.
+	r := buildRouter(hs, "sekrit")
+	req := httptest.NewRequest("GET", "/stats/cost?reset=true", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("reset without token: status = %d, want 401", rec.Code)
+	}
+	req = httptest.NewRequest("GET", "/stats/cost?reset=true", nil)
+	req.Header.Set("Authorization", "Bearer sekrit")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("reset with token: status = %d, want 200 (body=%s)", rec.Code, rec.Body.String())
+	}
+
+	// No token configured: reads stay anonymous but the reset write fails
+	// CLOSED like every other write endpoint.
+	r = buildRouter(hs, "")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/stats/cost", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("anonymous read with no token configured: status = %d, want 200", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/stats/cost?reset=true", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("reset with no token configured: status = %d, want 503 (fail closed)", rec.Code)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Prometheus text ingestion (/metrics/ingest)
+// ---------------------------------------------------------------------------
+
+const sampleExposition = `# HELP bot_commands_total Commands handled.
+# TYPE bot_commands_total counter
+bot_commands_total{command="play"} 41
+bot_commands_total{command="ask"} 7
+# HELP bot_queue_depth Current queue depth.
+# TYPE bot_queue_depth gauge
+bot_queue_depth 3
+# HELP bot_reply_seconds Reply latency.
+# TYPE bot_reply_seconds histogram
+bot_reply_seconds_bucket{le="0.5"} 2
+bot_reply_seconds_bucket{le="1"} 5
+bot_reply_seconds_bucket{le="+Inf"} 6
+bot_reply_seconds_sum 4.2
+bot_reply_seconds_count 6
+# HELP bot_percentiles A summary we cannot re-export.
+# TYPE bot_percentiles summary
+bot_percentiles{quantile="0.5"} 0.2
+bot_percentiles_sum 10
+bot_percentiles_count 50
+# HELP other_process_metric Not ours.
+# TYPE other_process_metric counter
+other_process_metric 1
+`
+
+func TestMetricsIngest_RoundTrip(t *testing.T) {
+	fc := newFakeClock(time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(fc))
+	router := buildRouter(hs, "")
+
+	rec := postJSON(t, hs.handleMetricsIngest, sampleExposition)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ingest status = %d (body=%s)", rec.Code, rec.Body.String())
+	}
+	var resp ingestResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid ingest JSON: %v", err)
+	}
+	if resp.Ingested != 3 || resp.Skipped != 2 {
+		t.Errorf("ingested/skipped = %d/%d, want 3/2", resp.Ingested, resp.Skipped)
+	}
+	wantErrs := []ingestFamilyError{
+		{Family: "bot_percentiles", Reason: "unsupported_type"},
+		{Family: "other_process_metric", Reason: "name_not_allowed"},
+	}
+	if len(resp.Errors) != 2 || resp.Errors[0] != wantErrs[0] || resp.Errors[1] != wantErrs[1] {
+		t.Errorf("errors = %+v, want %+v", resp.Errors, wantErrs)
+	}
+
+	// The merged /metrics output must now carry the re-exported families
+	// under the pushed_ namespace, alongside the service's own metrics.
+	scrape := httptest.NewRecorder()
+	router.ServeHTTP(scrape, httptest.NewRequest("GET", "/metrics", nil))
+	if scrape.Code != http.StatusOK {
+		t.Fatalf("scrape status = %d", scrape.Code)
+	}
+	body := scrape.Body.String()
+	for _, want := range []string{
+		`pushed_bot_commands_total{command="play"} 41`,
+		`pushed_bot_commands_total{command="ask"} 7`,
+		`pushed_bot_queue_depth 3`,
+		`pushed_bot_reply_seconds_bucket{le="1"} 5`,
+		`pushed_bot_reply_seconds_count 6`,
+		"discord_bot_goroutines", // the service's own metrics still there
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("merged /metrics missing %q", want)
+		}
+	}
+	for _, reject := range []string{"pushed_bot_percentiles", "pushed_other_process_metric", "other_process_metric 1"} {
+		if strings.Contains(body, reject) {
+			t.Errorf("merged /metrics must not contain %q", reject)
+		}
+	}
+}
+
+func TestMetricsIngest_StaleFamiliesDropAfterTTL(t *testing.T) {
+	fc := newFakeClock(time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(fc))
+
+	if rec := postJSON(t, hs.handleMetricsIngest, "# TYPE bot_live gauge\nbot_live 1\n"); rec.Code != http.StatusOK {
+		t.Fatalf("ingest status = %d", rec.Code)
+	}
+	if got := testutil.CollectAndCount(hs.pushed); got != 1 {
+		t.Fatalf("series before TTL = %d, want 1", got)
+	}
+
+	// Within the TTL the family survives; past it, the next collect drops it.
+	fc.Advance(ingestTTL)
+	if got := testutil.CollectAndCount(hs.pushed); got != 1 {
+		t.Errorf("series at exactly TTL = %d, want 1 (TTL is exclusive)", got)
+	}
+	fc.Advance(time.Second)
+	if got := testutil.CollectAndCount(hs.pushed); got != 0 {
+		t.Errorf("series after TTL = %d, want 0 (stale family must drop)", got)
+	}
+
+	// A re-push resets the freshness stamp.
+	if rec := postJSON(t, hs.handleMetricsIngest, "# TYPE bot_live gauge\nbot_live 1\n"); rec.Code != http.StatusOK {
+		t.Fatalf("re-ingest status = %d", rec.Code)
+	}
+	if got := testutil.CollectAndCount(hs.pushed); got != 1 {
+		t.Errorf("series after re-push = %d, want 1", got)
+	}
+}
+
+func TestMetricsIngest_InvalidBody(t *testing.T) {
+	hs := New(WithVersion("test"))
+	rec := postJSON(t, hs.handleMetricsIngest, "bot_broken{ 1\n")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid exposition: status = %d, want 400", rec.Code)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Daily rollup (/stats/daily)
+// ---------------------------------------------------------------------------
+
+func TestDailyRollup_AccumulateAndMidnightRollover(t *testing.T) {
+	fc := newFakeClock(time.Date(2026, 3, 1, 23, 50, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(fc))
+
+	day1 := []string{
+		`{"type":"counter","name":"tokens","value":100,"labels":{"type":"input"}}`,
+		`{"type":"counter","name":"tokens","value":40,"labels":{"type":"output"}}`,
+		`{"type":"counter","name":"requests","value":5,"labels":{"status":"success","endpoint":"ai"}}`,
+		`{"type":"counter","name":"requests","value":1,"labels":{"status":"error","endpoint":"ai"}}`,
+		`{"type":"counter","name":"cache","value":3,"labels":{"result":"hit"}}`,
+		`{"type":"counter","name":"cache","value":1,"labels":{"result":"miss"}}`,
+	}
+	for _, body := range day1 {
+		if rec := postJSON(t, hs.handleMetricsPush, body); rec.Code != http.StatusOK {
+			t.Fatalf("push status = %d (body=%s)", rec.Code, rec.Body.String())
+		}
+	}
+
+	// Cross midnight: the next push must land in a NEW bucket.
+	fc.Advance(20 * time.Minute)
+	if rec := postJSON(t, hs.handleMetricsPush,
+		`{"type":"counter","name":"tokens","value":7,"labels":{"type":"input"}}`); rec.Code != http.StatusOK {
+		t.Fatalf("push status = %d", rec.Code)
+	}
+
+	days := hs.rollup.snapshot()
+	if len(days) != 2 {
+		t.Fatalf("snapshot days = %d, want 2 (%+v)", len(days), days)
+	}
+	d1, d2 := days[0], days[1]
+	if d1.Date != "2026-03-01" || d2.Date != "2026-03-02" {
+		t.Fatalf("dates = %s, %s — want 2026-03-01 then 2026-03-02", d1.Date, d2.Date)
+	}
+	if d1.TokensInput != 100 || d1.TokensOutput != 40 {
+		t.Errorf("day1 tokens = %v/%v, want 100/40", d1.TokensInput, d1.TokensOutput)
+	}
+	if d1.RequestsByStatus["success"] != 5 || d1.RequestsByStatus["error"] != 1 {
+		t.Errorf("day1 requests = %v", d1.RequestsByStatus)
+	}
+	if d1.CacheHits != 3 || d1.CacheMisses != 1 || d1.CacheHitRatio != 0.75 {
+		t.Errorf("day1 cache = %v/%v ratio %v, want 3/1 ratio 0.75", d1.CacheHits, d1.CacheMisses, d1.CacheHitRatio)
+	}
+	if d2.TokensInput != 7 || d2.TokensOutput != 0 {
+		t.Errorf("day2 tokens = %v/%v, want 7/0", d2.TokensInput, d2.TokensOutput)
+	}
+}
+
+func TestDailyRollup_Retention(t *testing.T) {
+	fc := newFakeClock(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	r := newDailyRollup(3, fc)
+	for i := 0; i < 5; i++ {
+		r.recordTokens("input", 1)
+		fc.Advance(24 * time.Hour)
+	}
+	days := r.snapshot()
+	if len(days) != 3 {
+		t.Fatalf("retained days = %d, want 3", len(days))
+	}
+	if days[0].Date != "2026-03-03" || days[2].Date != "2026-03-05" {
+		t.Errorf("retained window = %s..%s, want 2026-03-03..2026-03-05", days[0].Date, days[2].Date)
+	}
+}
+
+func TestDailyRollup_ConcurrentPushes(t *testing.T) {
+	fc := newFakeClock(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	r := newDailyRollup(30, fc)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.recordTokens("input", 2)
+			r.recordRequest("success", 1)
+			r.recordCache("hit", 1)
+		}()
+	}
+	wg.Wait()
+	days := r.snapshot()
+	if len(days) != 1 {
+		t.Fatalf("days = %d, want 1", len(days))
+	}
+	if d := days[0]; d.TokensInput != 100 || d.RequestsByStatus["success"] != 50 || d.CacheHits != 50 {
+		t.Errorf("concurrent totals = %+v, want input=100 success=50 hits=50", d)
+	}
+}
+
+func TestDailyRollup_SaveLoadRoundTrip(t *testing.T) {
+	fc := newFakeClock(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	r := newDailyRollup(30, fc)
+	r.recordTokens("input", 11)
+	r.recordRequest("error", 2)
+	r.recordCache("miss", 4)
+
+	path := t.TempDir() + "/rollup.json"
+	if err := r.saveToFile(path); err != nil {
+		t.Fatalf("saveToFile: %v", err)
+	}
+
+	restored := newDailyRollup(30, fc)
+	if err := restored.loadFromFile(path); err != nil {
+		t.Fatalf("loadFromFile: %v", err)
+	}
+	got, want := restored.snapshot(), r.snapshot()
+	if len(got) != 1 || got[0].TokensInput != want[0].TokensInput ||
+		got[0].RequestsByStatus["error"] != want[0].RequestsByStatus["error"] ||
+		got[0].CacheMisses != want[0].CacheMisses {
+		t.Errorf("restored = %+v, want %+v", got, want)
+	}
+
+	// Corrupt file: load fails with an error (main logs and starts empty).
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := newDailyRollup(30, fc).loadFromFile(path); err == nil {
+		t.Error("loadFromFile on corrupt file: error = nil, want non-nil")
+	}
+}
+
+func TestHandleStatsDaily(t *testing.T) {
+	fc := newFakeClock(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(fc))
+	hs.rollup.recordTokens("output", 9)
+
+	rec := httptest.NewRecorder()
+	hs.handleStatsDaily(rec, httptest.NewRequest("GET", "/stats/daily", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var days []dayStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &days); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(days) != 1 || days[0].Date != "2026-03-01" || days[0].TokensOutput != 9 {
+		t.Errorf("days = %+v, want one 2026-03-01 bucket with 9 output tokens", days)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Pagination helper + /health/services
+// ---------------------------------------------------------------------------
+
+func TestParsePageParams(t *testing.T) {
+	tests := []struct {
+		query string
+		want  pageParams
+	}{
+		{"", pageParams{Limit: defaultPageLimit}},
+		{"limit=10&offset=20", pageParams{Limit: 10, Offset: 20}},
+		{"limit=9999", pageParams{Limit: maxPageLimit}},       // capped
+		{"limit=0", pageParams{Limit: defaultPageLimit}},      // non-positive ignored
+		{"limit=-5", pageParams{Limit: defaultPageLimit}},     // non-positive ignored
+		{"limit=abc", pageParams{Limit: defaultPageLimit}},    // garbage ignored
+		{"offset=-3", pageParams{Limit: defaultPageLimit}},    // negative offset ignored
+		{"offset=xyz", pageParams{Limit: defaultPageLimit}},   // garbage ignored
+		{"limit=1&offset=0", pageParams{Limit: 1, Offset: 0}}, // boundary
+	}
+	for _, tc := range tests {
+		q, _ := url.ParseQuery(tc.query)
+		if got := parsePageParams(q); got != tc.want {
+			t.Errorf("parsePageParams(%q) = %+v, want %+v", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestPaginateBoundaries(t *testing.T) {
+	tests := []struct {
+		name      string
+		total     int
+		p         pageParams
+		wantStart int
+		wantEnd   int
+	}{
+		{"first page", 10, pageParams{Limit: 3, Offset: 0}, 0, 3},
+		{"middle page", 10, pageParams{Limit: 3, Offset: 3}, 3, 6},
+		{"partial last page", 10, pageParams{Limit: 3, Offset: 9}, 9, 10},
+		{"offset at total", 10, pageParams{Limit: 3, Offset: 10}, 10, 10},
+		{"offset beyond total", 10, pageParams{Limit: 3, Offset: 99}, 10, 10},
+		{"empty collection", 0, pageParams{Limit: 3, Offset: 0}, 0, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			start, end := paginate(tc.total, tc.p)
+			if start != tc.wantStart || end != tc.wantEnd {
+				t.Errorf("paginate(%d, %+v) = [%d,%d), want [%d,%d)",
+					tc.total, tc.p, start, end, tc.wantStart, tc.wantEnd)
+			}
+		})
+	}
+}
+
+func TestHealthServicesPagination(t *testing.T) {
+	hs := New(WithVersion("test"))
+	for i := 0; i < 7; i++ {
+		hs.SetServiceStatus(fmt.Sprintf("svc-%d", i), true)
+	}
+	r := buildRouter(hs, "")
+
+	rec := doReq(t, r, http.MethodGet, "/health/services?limit=3&offset=3", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var resp struct {
+		Items []serviceEntry `json:"items"`
+		Total int            `json:"total"`
+		Next  string         `json:"next"`
+		Prev  string         `json:"prev"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Total != 7 {
+		t.Errorf("total = %d, want 7", resp.Total)
+	}
+	if len(resp.Items) != 3 || resp.Items[0].Name != "svc-3" {
+		t.Errorf("items = %+v, want svc-3..svc-5 (sorted, offset 3)", resp.Items)
+	}
+	if !strings.Contains(resp.Next, "offset=6") {
+		t.Errorf("next = %q, want an offset=6 hint", resp.Next)
+	}
+	if !strings.Contains(resp.Prev, "offset=0") {
+		t.Errorf("prev = %q, want an offset=0 hint", resp.Prev)
+	}
+
+	// Offset past the end: empty page, total intact, no next.
+	rec = doReq(t, r, http.MethodGet, "/health/services?limit=3&offset=100", "", "")
+	resp.Next, resp.Prev = "", "" // omitempty fields don't overwrite on decode
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Items) != 0 || resp.Total != 7 || resp.Next != "" {
+		t.Errorf("past-end page = %+v, want empty items, total 7, no next", resp)
+	}
+}
+
+func TestWriteListResponseByteCeiling(t *testing.T) {
+	const maxBytes = 300 // force the ceiling with a small budget
+
+	items := make([]serviceEntry, 20)
+	for i := range items {
+		items[i] = serviceEntry{Name: strings.Repeat("x", 30), Healthy: true}
+	}
+	rec := httptest.NewRecorder()
+	u, _ := url.Parse("/health/services?limit=20")
+	writeListResponse(rec, u, len(items), pageParams{Limit: 20}, items, maxBytes)
+
+	if rec.Body.Len() > maxBytes {
+		t.Errorf("body = %d bytes, want <= ceiling %d", rec.Body.Len(), maxBytes)
+	}
+	var resp listResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !resp.Truncated {
+		t.Error("truncated = false, want true when the ceiling forced a cut")
+	}
+	if resp.Total != 20 {
+		t.Errorf("total = %d, want the honest 20 despite truncation", resp.Total)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Gauge op (set/inc/dec) support
+// ---------------------------------------------------------------------------
+
+func TestGaugeOps_Validation(t *testing.T) {
+	hs := New(WithVersion("test"))
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"inc", `{"type":"gauge","name":"active_connections","value":3,"op":"inc"}`, http.StatusOK},
+		{"dec", `{"type":"gauge","name":"active_connections","value":3,"op":"dec"}`, http.StatusOK},
+		{"explicit set", `{"type":"gauge","name":"active_connections","value":7,"op":"set"}`, http.StatusOK},
+		{"unknown op", `{"type":"gauge","name":"active_connections","value":1,"op":"increment"}`, http.StatusBadRequest},
+		{"op on counter", `{"type":"counter","name":"requests","value":1,"op":"inc","labels":{"status":"success","endpoint":"ai"}}`, http.StatusBadRequest},
+		{"op on histogram", `{"type":"histogram","name":"ai_response_time","value":1,"op":"inc"}`, http.StatusBadRequest},
+		{"inc on circuit_breaker enum", `{"type":"gauge","name":"circuit_breaker","value":1,"op":"inc","labels":{"service":"gemini"}}`, http.StatusBadRequest},
+		{"negative delta", `{"type":"gauge","name":"active_connections","value":-2,"op":"inc"}`, http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := postJSON(t, hs.handleMetricsPush, tc.body)
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d (body=%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestGaugeOps_ConcurrentIncDec(t *testing.T) {
+	hs := New(WithVersion("test"))
+	// Anchor to a known value, then fire concurrent deltas: 100 inc(1) and
+	// 40 dec(1) must land on exactly +60 regardless of interleaving.
+	rec := postJSON(t, hs.handleMetricsPush, `{"type":"gauge","name":"active_connections","value":0,"op":"set"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("seed set failed: %d", rec.Code)
+	}
+
+	var wg sync.WaitGroup
+	fire := func(body string, n int) {
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				postJSON(t, hs.handleMetricsPush, body)
+			}()
+		}
+	}
+	fire(`{"type":"gauge","name":"active_connections","value":1,"op":"inc"}`, 100)
+	fire(`{"type":"gauge","name":"active_connections","value":1,"op":"dec"}`, 40)
+	wg.Wait()
+
+	if got := testutil.ToFloat64(hs.metrics.activeConnections); got != 60 {
+		t.Errorf("active_connections = %v, want 60 after 100 inc / 40 dec", got)
+	}
+}
+
+func TestGaugeOps_BatchUnknownOpSkipped(t *testing.T) {
+	hs := New(WithVersion("test"))
+	body := `[
+		{"type":"gauge","name":"active_connections","value":1,"op":"inc"},
+		{"type":"gauge","name":"active_connections","value":1,"op":"bogus"}
+	]`
+	rec := postJSON(t, hs.handleMetricsBatch, body)
+	var resp batchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Processed != 1 || resp.Skipped != 1 {
+		t.Errorf("processed/skipped = %d/%d, want 1/1", resp.Processed, resp.Skipped)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].Reason != "unknown_op" {
+		t.Errorf("errors = %+v, want one unknown_op at index 1", resp.Errors)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// summary_set: pushed quantile pre-aggregates with lazy GaugeVec registration
+// ---------------------------------------------------------------------------
+
+func TestSummarySet_PushAndValidation(t *testing.T) {
+	hs := New(WithVersion("test"))
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"valid p95", `{"type":"summary_set","name":"gemini_latency_seconds","value":1.25,"labels":{"quantile":"0.95"}}`, http.StatusOK},
+		{"valid p50 same family", `{"type":"summary_set","name":"gemini_latency_seconds","value":0.4,"labels":{"quantile":"0.5"}}`, http.StatusOK},
+		{"bad quantile", `{"type":"summary_set","name":"gemini_latency_seconds","value":1,"labels":{"quantile":"0.77"}}`, http.StatusBadRequest},
+		{"missing quantile", `{"type":"summary_set","name":"gemini_latency_seconds","value":1}`, http.StatusBadRequest},
+		{"bad name uppercase", `{"type":"summary_set","name":"Gemini","value":1,"labels":{"quantile":"0.5"}}`, http.StatusBadRequest},
+		{"bad name leading digit", `{"type":"summary_set","name":"9lives","value":1,"labels":{"quantile":"0.5"}}`, http.StatusBadRequest},
+		{"bad name too long", `{"type":"summary_set","name":"` + strings.Repeat("a", 65) + `","value":1,"labels":{"quantile":"0.5"}}`, http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := postJSON(t, hs.handleMetricsPush, tc.body)
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d (body=%s)", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+		})
+	}
+
+	// The accepted pushes above must have landed on the lazily registered
+	// family with the right quantile labels.
+	g, err := hs.getSummaryGauge("gemini_latency_seconds")
+	if err != nil {
+		t.Fatalf("getSummaryGauge: %v", err)
+	}
+	if got := testutil.ToFloat64(g.WithLabelValues("0.95")); got != 1.25 {
+		t.Errorf("quantile 0.95 = %v, want 1.25", got)
+	}
+	if got := testutil.ToFloat64(g.WithLabelValues("0.5")); got != 0.4 {
+		t.Errorf("quantile 0.5 = %v, want 0.4", got)
+	}
+}
+
+func TestSummarySet_LazyRegistrationOnceConcurrent(t *testing.T) {
+	const workers = 32
+	hs := New(WithVersion("test"))
+	var wg sync.WaitGroup
+	gauges := make([]*prometheus.GaugeVec, workers)
+	errs := make([]error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			gauges[idx], errs[idx] = hs.getSummaryGauge("concurrent_reg_probe")
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < workers; i++ {
+		if errs[i] != nil {
+			t.Fatalf("worker %d: unexpected registration error: %v", i, errs[i])
+		}
+		if gauges[i] != gauges[0] {
+			t.Fatalf("worker %d got a different GaugeVec — registration ran more than once", i)
+		}
+	}
+}
+
+func TestSummarySet_NameCollision(t *testing.T) {
+	// "tokens_total" derives discord_bot_tokens_total_quantile — fine. But a
+	// name whose derived form already exists must be rejected, not panic.
+	// Manufacture the collision by pre-registering the derived name.
+	hs := New(WithVersion("test"))
+	pre := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "discord_bot_collision_probe_quantile",
+		Help: "occupies the derived name",
+	})
+	if err := hs.registry.Register(pre); err != nil {
+		t.Fatalf("pre-register: %v", err)
+	}
+	if reason := hs.applySummarySet(MetricsPayload{
+		Type: "summary_set", Name: "collision_probe", Value: 1,
+		Labels: map[string]string{"quantile": "0.5"},
+	}); reason != reasonNameCollision {
+		t.Errorf("reason = %q, want %q", reason, reasonNameCollision)
+	}
+}
+
+func TestHandleServiceStatus_Validation(t *testing.T) {
+	hs := New(WithVersion("test"))
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"valid", `{"name":"gemini","healthy":true}`, http.StatusOK},
+		{"invalid JSON", `nope`, http.StatusBadRequest},
+		{"empty name", `{"name":"","healthy":true}`, http.StatusBadRequest},
+		{"name too long", `{"name":"` + strings.Repeat("a", 101) + `","healthy":true}`, http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := postJSON(t, hs.handleServiceStatus, tc.body)
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// handleMetricsBatch: processed/skipped accounting + unknown-type consistency
+// ---------------------------------------------------------------------------
+
+func TestHandleMetricsBatch_ProcessedSkipped(t *testing.T) {
+	hs := New(WithVersion("test"))
+	// 2 valid, then: unknown name, unknown type, name/type-mismatch (no inner
+	// case), out-of-range circuit_breaker, negative counter => all skipped.
+	body := `[
+		{"type":"counter","name":"requests","value":1,"labels":{"status":"success","endpoint":"ai"}},
+		{"type":"gauge","name":"circuit_breaker","value":1,"labels":{"service":"gemini"}},
+		{"type":"counter","name":"bogus","value":1},
+		{"type":"guage","name":"requests","value":1},
+		{"type":"counter","name":"active_connections","value":1},
+		{"type":"gauge","name":"circuit_breaker","value":999,"labels":{"service":"gemini"}},
+		{"type":"counter","name":"requests","value":-1}
+	]`
+	rec := postJSON(t, hs.handleMetricsBatch, body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body=%s)", rec.Code, rec.Body.String())
+	}
+	var resp batchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Processed != 2 {
+		t.Errorf("processed = %d, want 2", resp.Processed)
+	}
+	if resp.Skipped != 5 {
+		t.Errorf("skipped = %d, want 5", resp.Skipped)
+	}
+}
+
+func TestHandleMetricsBatch_PerIndexReasons(t *testing.T) {
+	hs := New(WithVersion("test"))
+	body := `[
+		{"type":"counter","name":"requests","value":1,"labels":{"status":"success","endpoint":"ai"}},
+		{"type":"counter","name":"bogus","value":1},
+		{"type":"guage","name":"requests","value":1},
+		{"type":"counter","name":"requests","value":-1},
+		{"type":"counter","name":"active_connections","value":1},
+		{"type":"gauge","name":"circuit_breaker","value":999,"labels":{"service":"gemini"}}
+	]`
+	rec := postJSON(t, hs.handleMetricsBatch, body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (partial failures keep 200)", rec.Code)
+	}
+	var resp struct {
+		Processed int `json:"processed"`
+		Skipped   int `json:"skipped"`
+		Errors    []struct {
+			Index  int    `json:"index"`
+			Reason string `json:"reason"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Processed != 1 || resp.Skipped != 5 {
+		t.Errorf("processed/skipped = %d/%d, want 1/5", resp.Processed, resp.Skipped)
+	}
+	wantReasons := map[int]string{
+		1: "unknown_name",
+		2: "unknown_type",
+		3: "negative_counter",
+		4: "name_type_mismatch",
+		5: "invalid_enum_value",
+	}
+	if len(resp.Errors) != len(wantReasons) {
+		t.Fatalf("errors = %+v, want %d entries", resp.Errors, len(wantReasons))
+	}
+	for _, e := range resp.Errors {
+		if wantReasons[e.Index] != e.Reason {
+			t.Errorf("errors[index=%d] reason = %q, want %q", e.Index, e.Reason, wantReasons[e.Index])
+		}
+	}
+}
+
+func TestHandleMetricsBatch_ErrorDetailsCapped(t *testing.T) {
+	hs := New(WithVersion("test"))
+	var sb strings.Builder
+	sb.WriteByte('[')
+	for i := 0; i < maxBatchErrorDetails+10; i++ {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(`{"type":"counter","name":"bogus","value":1}`)
+	}
+	sb.WriteByte(']')
+	rec := postJSON(t, hs.handleMetricsBatch, sb.String())
+	var resp batchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Skipped != maxBatchErrorDetails+10 {
+		t.Errorf("skipped = %d, want %d (cap must not hide the true count)", resp.Skipped, maxBatchErrorDetails+10)
+	}
+	if len(resp.Errors) != maxBatchErrorDetails {
+		t.Errorf("len(errors) = %d, want cap %d", len(resp.Errors), maxBatchErrorDetails)
+	}
+}
+
+func TestHandleMetricsBatch_TooLarge(t *testing.T) {
+	hs := New(WithVersion("test"))
+	var sb strings.Builder
+	sb.WriteByte('[')
+	for i := 0; i < 1001; i++ {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(`{"type":"counter","name":"requests","value":1}`)
+	}
+	sb.WriteByte(']')
+	rec := postJSON(t, hs.handleMetricsBatch, sb.String())
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400 for >1000 batch", rec.Code)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// NDJSON streaming ingestion (/metrics/stream)
+// ---------------------------------------------------------------------------
+
+func TestHandleMetricsStream_SeveralThousandLines(t *testing.T) {
+	hs := New(WithVersion("test"))
+
+	// 3000 valid counter lines interleaved with malformed JSON, unknown names
+	// and blank lines. Malformed/invalid lines are skipped and counted; they
+	// must never abort the rest of the stream.
+	const valid = 3000
+	var sb strings.Builder
+	for i := 0; i < valid; i++ {
+		sb.WriteString(`{"type":"counter","name":"requests","value":1,"labels":{"status":"success","endpoint":"ai"}}` + "\n")
+		switch i % 500 {
+		case 0:
+			sb.WriteString("{not json at all\n")
+		case 1:
+			sb.WriteString(`{"type":"counter","name":"bogus","value":1}` + "\n")
+		case 2:
+			sb.WriteString("\n") // blank lines are not items
+		}
+	}
+	rec := postJSON(t, hs.handleMetricsStream, sb.String())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body=%s)", rec.Code, rec.Body.String())
+	}
+
+	var resp batchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response is not JSON: %v", err)
+	}
+	if resp.Processed != valid {
+		t.Errorf("processed = %d, want %d", resp.Processed, valid)
+	}
+	if resp.Skipped != 12 { // 6 malformed + 6 unknown-name (i%500 hits 0..2 six times)
+		t.Errorf("skipped = %d, want 12", resp.Skipped)
+	}
+	if len(resp.Errors) == 0 || len(resp.Errors) > maxBatchErrorDetails {
+		t.Fatalf("errors len = %d, want 1..%d", len(resp.Errors), maxBatchErrorDetails)
+	}
+	if resp.Errors[0].Reason != reasonMalformedLine {
+		t.Errorf("first error reason = %q, want %q", resp.Errors[0].Reason, reasonMalformedLine)
+	}
+
+	if got := testutil.ToFloat64(hs.metrics.requestsTotal.WithLabelValues("ai", "success")); got != valid {
+		t.Errorf("requests{ai,success} = %v, want %d", got, valid)
+	}
+}
+
+func TestHandleMetricsStream_ItemCeiling(t *testing.T) {
+	hs := New(WithVersion("test"), WithStreamMaxItems(10))
+	var sb strings.Builder
+	for i := 0; i < 11; i++ {
+		sb.WriteString(`{"type":"counter","name":"requests","value":1}` + "\n")
+	}
+	rec := postJSON(t, hs.handleMetricsStream, sb.String())
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400 past the item ceiling", rec.Code)
+	}
+}
+
+func TestHandleMetricsStream_OversizedLine(t *testing.T) {
+	hs := New(WithVersion("test"))
+	line := `{"type":"counter","name":"requests","value":1,"labels":{"status":"` +
+		strings.Repeat("x", maxStreamLineBytes) + `"}}`
+	rec := postJSON(t, hs.handleMetricsStream, line+"\n")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400 for a line over the per-line cap", rec.Code)
+	}
+}
+
+func TestStreamMaxItemsFromEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want int
+	}{
+		{"unset uses default", "", defaultStreamMaxItems},
+		{"valid override", "100000", 100000},
+		{"zero rejected", "0", defaultStreamMaxItems},
+		{"negative rejected", "-1", defaultStreamMaxItems},
+		{"garbage rejected", "many", defaultStreamMaxItems},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("STREAM_MAX_ITEMS", tc.env)
+			if got := streamMaxItemsFromEnv(); got != tc.want {
+				t.Errorf("streamMaxItemsFromEnv() with %q = %d, want %d", tc.env, got, tc.want)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// go-health-2: GetStatus reads the cached MemStats snapshot (no inline STW read)
+// ---------------------------------------------------------------------------
+
+func TestGetStatusUsesCachedMemStats(t *testing.T) {
+	// Prime the cache the way the binary does, then assert GetStatus surfaces it.
+	hs := New(WithVersion("test"))
+	hs.CollectSystemMetrics()
+	status := hs.GetStatus()
+	if _, ok := status.Metrics["memory_alloc_mb"]; !ok {
+		t.Error("expected memory_alloc_mb in metrics")
+	}
+	// A live Go process always has a non-zero heap; the cached snapshot must
+	// reflect that rather than the zero value.
+	if alloc, _ := status.Metrics["memory_alloc_mb"].(float64); alloc <= 0 {
+		t.Errorf("memory_alloc_mb should be > 0 after priming, got %v", status.Metrics["memory_alloc_mb"])
+	}
+}
+
+// ---------------------------------------------------------------------------
+// go-health-3: exercise the NaN/Inf guard PREDICATE directly.
+//
+// The math.IsNaN/IsInf arms in handleMetricsPush/handleMetricsBatch are
+// unreachable through the HTTP/JSON boundary (encoding/json rejects
+// NaN/Infinity/quoted-number bodies first), so the existing handler tests
+// only prove JSON-decode rejection. This test feeds float64 values the JSON
+// decoder can never deliver straight into the same boolean condition the
+// guards use, locking the intended "reject NaN, +/-Inf, and negatives"
+// semantics so a regression that loosened the predicate would fail here.
+// ---------------------------------------------------------------------------
+
+func TestNaNInfGuardLogic(t *testing.T) {
+	// counterOrHistogramRejects mirrors the guard used by the counter and
+	// histogram arms: NaN || Inf || value < 0.
+	counterOrHistogramRejects := func(v float64) bool {
+		return math.IsNaN(v) || math.IsInf(v, 0) || v < 0
+	}
+	// gaugeRejects mirrors the gauge arm's top-level guard: NaN || Inf
+	// (the per-name negative/enum checks are layered on top of this).
+	gaugeRejects := func(v float64) bool {
+		return math.IsNaN(v) || math.IsInf(v, 0)
+	}
+
+	tests := []struct {
+		name             string
+		value            float64
+		wantCounterRej   bool
+		wantGaugeTopReje bool
+	}{
+		{"NaN", math.NaN(), true, true},
+		{"+Inf", math.Inf(1), true, true},
+		{"-Inf", math.Inf(-1), true, true},
+		{"negative", -1.0, true, false}, // gauge top-level allows; per-name check handles it
+		{"zero", 0.0, false, false},
+		{"positive", 42.0, false, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := counterOrHistogramRejects(tc.value); got != tc.wantCounterRej {
+				t.Errorf("counter/histogram guard(%v) = %v, want %v", tc.value, got, tc.wantCounterRej)
+			}
+			if got := gaugeRejects(tc.value); got != tc.wantGaugeTopReje {
+				t.Errorf("gauge top-level guard(%v) = %v, want %v", tc.value, got, tc.wantGaugeTopReje)
+			}
+		})
+	}
+}
+
+func TestGetReadinessReport(t *testing.T) {
+	hs := New(WithVersion("test"))
+	hs.SetServiceStatus("bot", true)
+	hs.SetServiceStatus("database", true)
+
+	report := hs.GetReadinessReport()
+	if !report.Ready || report.Status != "healthy" {
+		t.Errorf("report = %+v, want ready/healthy", report)
+	}
+	if len(report.Reasons) != 0 {
+		t.Errorf("healthy report should carry no reasons, got %v", report.Reasons)
+	}
+
+	hs.SetServiceStatus("database", false)
+	hs.SetServiceStatus("bot", false)
+	report = hs.GetReadinessReport()
+	if report.Ready || report.Status != "degraded" {
+		t.Errorf("report = %+v, want not-ready/degraded", report)
+	}
+	// Reasons are sorted, stable, machine-parsable strings per unhealthy service.
+	want := []string{"service_unhealthy:bot", "service_unhealthy:database"}
+	if len(report.Reasons) != len(want) {
+		t.Fatalf("reasons = %v, want %v", report.Reasons, want)
+	}
+	for i := range want {
+		if report.Reasons[i] != want[i] {
+			t.Errorf("reasons[%d] = %q, want %q", i, report.Reasons[i], want[i])
+		}
+	}
+}
+
+func TestWantsPlainText(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false}, // default is JSON
+		{"application/json", false},
+		{"text/plain", true},
+		{"text/plain; charset=utf-8", true},
+		{"TEXT/PLAIN", true},
+		{"application/json, text/plain", false}, // first recognized wins
+		{"text/plain, application/json", true},
+		{"*/*", false},
+	}
+	for _, tc := range tests {
+		if got := wantsPlainText(tc.accept); got != tc.want {
+			t.Errorf("wantsPlainText(%q) = %v, want %v", tc.accept, got, tc.want)
+		}
+	}
+}
+
+func TestReadinessEndpointNegotiation(t *testing.T) {
+	hs := New(WithVersion("test"))
+	hs.SetServiceStatus("bot", true)
+	hs.SetServiceStatus("database", false)
+	r := buildRouter(hs, "")
+
+	// Default: JSON body with per-service reasons, 503 while degraded.
+	rec := doReq(t, r, http.MethodGet, "/health/ready", "", "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+	var report ReadinessReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("readiness body is not JSON: %v (body=%s)", err, rec.Body.String())
+	}
+	if report.Ready || report.Services["database"] {
+		t.Errorf("report = %+v, want not-ready with database unhealthy", report)
+	}
+	if len(report.Reasons) != 1 || report.Reasons[0] != "service_unhealthy:database" {
+		t.Errorf("reasons = %v, want [service_unhealthy:database]", report.Reasons)
+	}
+
+	// Accept: text/plain keeps the old probe strings and status codes.
+	req := httptest.NewRequest(http.MethodGet, "/health/ready", nil)
+	req.Header.Set("Accept", "text/plain")
+	rec2 := httptest.NewRecorder()
+	r.ServeHTTP(rec2, req)
+	if rec2.Code != http.StatusServiceUnavailable || rec2.Body.String() != "NOT READY" {
+		t.Errorf("text/plain = %d %q, want 503 NOT READY", rec2.Code, rec2.Body.String())
+	}
+
+	hs.SetServiceStatus("database", true)
+	req = httptest.NewRequest(http.MethodGet, "/health/ready", nil)
+	req.Header.Set("Accept", "text/plain")
+	rec3 := httptest.NewRecorder()
+	r.ServeHTTP(rec3, req)
+	if rec3.Code != http.StatusOK || rec3.Body.String() != "READY" {
+		t.Errorf("text/plain healthy = %d %q, want 200 READY", rec3.Code, rec3.Body.String())
+	}
+}
+
+// ---------------------------------------------------------------------------
+// go-health-2: requireReadToken — anonymous when no token, enforced when set
+// ---------------------------------------------------------------------------
+
+func TestRequireReadToken(t *testing.T) {
+	const token = "read-token"
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		expected   string
+		authHeader string
+		wantStatus int
+	}{
+		// No token configured => reads are anonymous (loopback-only via the
+		// bind gate); the handler is reached without any Authorization header.
+		{"no token configured -> anonymous", "", "", http.StatusOK},
+		{"no token configured ignores header", "", "Bearer whatever", http.StatusOK},
+		// Token configured => the SAME bearer enforcement as writes (but reads
+		// must NOT fail-closed-to-503; they require the token instead).
+		{"token set, missing header -> 401", token, "", http.StatusUnauthorized},
+		{"token set, wrong token -> 401", token, "Bearer nope-wrong-len", http.StatusUnauthorized},
+		{"token set, correct token -> 200", token, "Bearer " + token, http.StatusOK},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mw := requireReadToken(tc.expected)(next)
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tc.authHeader != "" {
+				req.Header.Set("Authorization", tc.authHeader)
+			}
+			rec := httptest.NewRecorder()
+			mw.ServeHTTP(rec, req)
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tc.wantStatus)
+			}
+		})
+	}
+}
+
+// ---------------------------------------------------------------------------
+// go-health-4: integration test wiring the REAL chi router (buildRouter), so
+// the security-critical middleware-to-route binding is a tested invariant:
+//   - writes require the bearer token (401 without, 200 with);
+//   - with NO token writes fail CLOSED (503);
+//   - read policy matches the go-health-2 decision (probes always anonymous;
+//     /metrics and /stats anonymous when no token, token-gated when set).
+// ---------------------------------------------------------------------------
+
+func doReq(t *testing.T, r http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	var rdr *bytes.Reader
+	if body != "" {
+		rdr = bytes.NewReader([]byte(body))
+	} else {
+		rdr = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, rdr)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRouterAuthWiring_TokenConfigured(t *testing.T) {
+	const token = "wiring-token"
+	hs := New(WithVersion("test"))
+	hs.SetServiceStatus("bot", true)
+	r := buildRouter(hs, token)
+
+	validPush := `{"type":"counter","name":"requests","value":1,"labels":{"status":"success","endpoint":"ai"}}`
+
+	// --- Write routes: token enforced ---
+	if rec := doReq(t, r, http.MethodPost, "/metrics/push", "", validPush); rec.Code != http.StatusUnauthorized {
+		t.Errorf("POST /metrics/push without token = %d, want 401", rec.Code)
+	}
+	if rec := doReq(t, r, http.MethodPost, "/metrics/push", token, validPush); rec.Code != http.StatusOK {
+		t.Errorf("POST /metrics/push with token = %d, want 200 (body=%s)", rec.Code, "ok")
+	}
+	for _, p := range []string{"/health/service", "/health/heartbeat", "/metrics/batch", "/metrics/ingest", "/metrics/stream"} {
+		body := `{"name":"x","healthy":true}`
+		if p == "/metrics/batch" {
+			body = "[]"
+		}
+		if rec := doReq(t, r, http.MethodPost, p, "", body); rec.Code != http.StatusUnauthorized {
+			t.Errorf("POST %s without token = %d, want 401", p, rec.Code)
+		}
+	}
+
+	// --- Read routes: probes ALWAYS anonymous ---
+	for _, p := range []string{"/health", "/health/live", "/health/ready"} {
+		if rec := doReq(t, r, http.MethodGet, p, "", ""); rec.Code == http.StatusUnauthorized {
+			t.Errorf("GET %s anonymous = 401, want it to succeed (probes must be anonymous)", p)
+		}
+	}
+
+	// --- /metrics and /stats: token-gated when a token is configured ---
+	for _, p := range []string{"/metrics", "/stats"} {
+		if rec := doReq(t, r, http.MethodGet, p, "", ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("GET %s without token (token configured) = %d, want 401", p, rec.Code)
+		}
+		if rec := doReq(t, r, http.MethodGet, p, token, ""); rec.Code != http.StatusOK {
+			t.Errorf("GET %s with token = %d, want 200", p, rec.Code)
+		}
+	}
+
+	// --- Method binding: GET on a write route is not registered as a write ---
+	if rec := doReq(t, r, http.MethodGet, "/metrics/push", token, ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /metrics/push = %d, want 405", rec.Code)
+	}
+}
+
+func TestRouterAuthWiring_NoToken(t *testing.T) {
+	hs := New(WithVersion("test"))
+	hs.SetServiceStatus("bot", true)
+	r := buildRouter(hs, "") // no token configured
+
+	// Writes fail CLOSED (503) regardless of any header — unchanged posture.
+	validPush := `{"type":"counter","name":"requests","value":1,"labels":{"status":"success","endpoint":"ai"}}`
+	if rec := doReq(t, r, http.MethodPost, "/metrics/push", "anything", validPush); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("POST /metrics/push (no token configured) = %d, want 503 (fail-closed)", rec.Code)
+	}
+
+	// Reads are anonymous so the default tokenless Prometheus scrape works.
+	for _, p := range []string{"/health", "/health/live", "/health/ready", "/metrics", "/stats"} {
+		rec := doReq(t, r, http.MethodGet, p, "", "")
+		if rec.Code == http.StatusUnauthorized || rec.Code == http.StatusServiceUnavailable {
+			t.Errorf("GET %s (no token configured) = %d, want anonymous success", p, rec.Code)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Registration-mode heartbeat tests
+// ---------------------------------------------------------------------------
+
+func TestRecordHeartbeat_Validation(t *testing.T) {
+	hs := New(WithVersion("test"))
+	tests := []struct {
+		name       string
+		svc        string
+		interval   int
+		wantReason string
+	}{
+		{"valid", "worker", 30, ""},
+		{"empty name", "", 30, heartbeatReasonInvalidName},
+		{"overlong name", strings.Repeat("n", 101), 30, heartbeatReasonInvalidName},
+		{"zero interval", "worker", 0, heartbeatReasonInvalidInterval},
+		{"negative interval", "worker", -5, heartbeatReasonInvalidInterval},
+		{"interval too long", "worker", maxHeartbeatIntervalSeconds + 1, heartbeatReasonInvalidInterval},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := hs.RecordHeartbeat(tc.svc, tc.interval); got != tc.wantReason {
+				t.Errorf("RecordHeartbeat = %q, want %q", got, tc.wantReason)
+			}
+		})
+	}
+}
+
+func TestHeartbeatSweep_OnTimeLateRecovered(t *testing.T) {
+	fc := newFakeClock(time.Unix(1000, 0))
+	hs := New(WithVersion("test"), WithClock(fc))
+
+	if reason := hs.RecordHeartbeat("worker", 10); reason != "" {
+		t.Fatalf("register: %s", reason)
+	}
+	if !hs.GetStatus().Services["worker"] {
+		t.Fatal("registered worker should start healthy")
+	}
+
+	// On time: 15s elapsed is inside the 20s (2x interval) deadline.
+	fc.Advance(15 * time.Second)
+	hs.sweepMissedHeartbeats()
+	if !hs.GetStatus().Services["worker"] {
+		t.Fatal("worker within its deadline must stay healthy")
+	}
+
+	// A fresh ping resets the deadline.
+	if reason := hs.RecordHeartbeat("worker", 10); reason != "" {
+		t.Fatalf("re-ping: %s", reason)
+	}
+	fc.Advance(15 * time.Second)
+	hs.sweepMissedHeartbeats()
+	if !hs.GetStatus().Services["worker"] {
+		t.Fatal("re-ping should have reset the deadline")
+	}
+
+	// Late: 6 more seconds puts it past 20s since the last ping.
+	fc.Advance(6 * time.Second)
+	hs.sweepMissedHeartbeats()
+	if hs.GetStatus().Services["worker"] {
+		t.Fatal("worker past its deadline must flip unhealthy")
+	}
+	if msg := hs.ServiceMessages()["worker"]; msg != missedHeartbeatMessage {
+		t.Errorf("message = %q, want %q", msg, missedHeartbeatMessage)
+	}
+
+	// Recovered: the next ping restores health and clears the reason.
+	if reason := hs.RecordHeartbeat("worker", 10); reason != "" {
+		t.Fatalf("recovery ping: %s", reason)
+	}
+	if !hs.GetStatus().Services["worker"] {
+		t.Fatal("recovered worker should be healthy again")
+	}
+	if msg, ok := hs.ServiceMessages()["worker"]; ok {
+		t.Errorf("missed-heartbeat message not cleared on recovery: %q", msg)
+	}
+
+	// /health exposes the registration.
+	info, ok := hs.GetStatus().Heartbeats["worker"]
+	if !ok {
+		t.Fatal("heartbeat registration missing from /health")
+	}
+	if info.IntervalSeconds != 10 || info.LastSeen == "" {
+		t.Errorf("heartbeat info = %+v, want interval 10 and a last_seen time", info)
+	}
+}
+
+func TestHandleHeartbeat_RegistrationMode(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+
+	w := doReq(t, r, http.MethodPost, "/health/heartbeat", "tok",
+		`{"name":"worker","interval_seconds":5}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("registration ping: HTTP %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response not JSON: %v", err)
+	}
+	if resp["deadline_seconds"] != float64(10) {
+		t.Errorf("deadline_seconds = %v, want 10 (2x interval)", resp["deadline_seconds"])
+	}
+	if !hs.GetStatus().Services["worker"] {
+		t.Error("registration ping should mark the worker healthy")
+	}
+
+	// Interval present but name missing: registration mode with a bad name.
+	w = doReq(t, r, http.MethodPost, "/health/heartbeat", "tok", `{"interval_seconds":5}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), heartbeatReasonInvalidName) {
+		t.Errorf("nameless ping: HTTP %d %s, want 400 %s", w.Code, w.Body.String(), heartbeatReasonInvalidName)
+	}
+
+	// Name present but interval missing/invalid.
+	w = doReq(t, r, http.MethodPost, "/health/heartbeat", "tok", `{"name":"worker"}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), heartbeatReasonInvalidInterval) {
+		t.Errorf("intervalless ping: HTTP %d %s, want 400 %s", w.Code, w.Body.String(), heartbeatReasonInvalidInterval)
+	}
+
+	// Batch mode is untouched by the new shape.
+	w = doReq(t, r, http.MethodPost, "/health/heartbeat", "tok", `{"services":{"a":true}}`)
+	if w.Code != http.StatusOK {
+		t.Errorf("batch heartbeat: HTTP %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestStartHeartbeatSweeper_Lifecycle(t *testing.T) {
+	fc := newFakeClock(time.Unix(1000, 0))
+	hs := New(WithVersion("test"), WithClock(fc))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if reason := hs.RecordHeartbeat("worker", 1); reason != "" {
+		t.Fatalf("register: %s", reason)
+	}
+	go hs.StartHeartbeatSweeper(ctx)
+
+	// Past the 2s deadline; the ticker-driven sweep must flip the worker.
+	fc.Advance(3 * time.Second)
+	fc.Advance(time.Second)
+	deadline := time.Now().Add(2 * time.Second)
+	for hs.GetStatus().Services["worker"] {
+		if time.Now().After(deadline) {
+			t.Fatal("sweeper did not flip the quiet worker")
+		}
+		time.Sleep(2 * time.Millisecond)
+		fc.Advance(time.Second)
+	}
+	cancel()
+}
+
+// ---------------------------------------------------------------------------
+// Label normalization (normalizeLabels — shared by every ingestion path)
+// ---------------------------------------------------------------------------
+
+func TestNormalizeLabels(t *testing.T) {
+	tests := []struct {
+		name       string
+		metric     string
+		typ        string
+		labels     map[string]string
+		want       map[string]string
+		wantReason string
+	}{
+		{
+			name:   "nil labels take defaults",
+			metric: "requests",
+			want:   map[string]string{"status": "success", "endpoint": "other"},
+		},
+		{
+			name:   "empty value falls back to default",
+			metric: "requests",
+			labels: map[string]string{"endpoint": "", "status": "error"},
+			want:   map[string]string{"status": "error", "endpoint": "other"},
+		},
+		{
+			name:   "whitespace-only value is absent",
+			metric: "requests",
+			labels: map[string]string{"status": "  \t "},
+			want:   map[string]string{"status": "success", "endpoint": "other"},
+		},
+		{
+			name:   "keys lowercased and trimmed",
+			metric: "requests",
+			labels: map[string]string{"Status": "error", " ENDPOINT ": "ai"},
+			want:   map[string]string{"status": "error", "endpoint": "ai"},
+		},
+		{
+			name:   "case-duplicate keys with equal values collapse",
+			metric: "requests",
+			labels: map[string]string{"Status": "error", "status": "error"},
+			want:   map[string]string{"status": "error", "endpoint": "other"},
+		},
+		{
+			name:       "case-duplicate keys with conflicting values rejected",
+			metric:     "requests",
+			labels:     map[string]string{"Status": "error", "status": "success"},
+			wantReason: reasonDuplicateLabel,
+		},
+		{
+			name:       "key outside the schema rejected",
+			metric:     "requests",
+			labels:     map[string]string{"status": "error", "guild": "123"},
+			wantReason: reasonUnknownLabel,
+		},
+		{
+			name:       "unlabeled metric accepts no keys",
+			metric:     "active_connections",
+			labels:     map[string]string{"shard": "0"},
+			wantReason: reasonUnknownLabel,
+		},
+		{
+			name:   "model has no default — safeModelLabel owns empty",
+			metric: "tokens",
+			labels: map[string]string{"model": " "},
+			want:   map[string]string{"type": "other"},
+		},
+		{
+			name:   "summary_set uses the shared quantile schema",
+			metric: "anything_dynamic",
+			typ:    "summary_set",
+			labels: map[string]string{"Quantile": "0.95"},
+			want:   map[string]string{"quantile": "0.95"},
+		},
+		{
+			name:       "summary_set rejects non-quantile keys",
+			metric:     "anything_dynamic",
+			typ:        "summary_set",
+			labels:     map[string]string{"endpoint": "ai"},
+			wantReason: reasonUnknownLabel,
+		},
+		{
+			name:   "unknown metric passes through for applyMetric's unknown_name",
+			metric: "totally_new_metric",
+			labels: map[string]string{"Whatever": ""},
+			want:   map[string]string{"Whatever": ""},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, reason := normalizeLabels(tc.metric, tc.typ, tc.labels)
+			if reason != tc.wantReason {
+				t.Fatalf("reason = %q, want %q", reason, tc.wantReason)
+			}
+			if tc.wantReason != "" {
+				return
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("labels = %v, want %v", got, tc.want)
+			}
+			for k, v := range tc.want {
+				if got[k] != v {
+					t.Errorf("labels[%q] = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeLabels_TooMany(t *testing.T) {
+	labels := map[string]string{}
+	for i := 0; i <= maxLabelsPerPayload; i++ {
+		labels[fmt.Sprintf("k%d", i)] = "v"
+	}
+	if _, reason := normalizeLabels("requests", "", labels); reason != reasonTooManyLabels {
+		t.Errorf("reason = %q, want %q", reason, reasonTooManyLabels)
+	}
+}
+
+func TestHandleMetricsPush_LabelNormalization(t *testing.T) {
+	hs := New(WithVersion("test"))
+
+	// Empty endpoint + cased status key: one "ai"-less success series, not an
+	// empty-string series. The same body via batch must land identically.
+	body := `{"type":"counter","name":"requests","value":1,"labels":{"Status":"","endpoint":""}}`
+	series := hs.metrics.requestsTotal.WithLabelValues("other", "success")
+	if rec := postJSON(t, hs.handleMetricsPush, body); rec.Code != http.StatusOK {
+		t.Fatalf("push: status = %d (body=%s)", rec.Code, rec.Body.String())
+	}
+	if got := testutil.ToFloat64(series); got != 1 {
+		t.Errorf("push default series = %v, want 1", got)
+	}
+	if rec := postJSON(t, hs.handleMetricsBatch, "["+body+"]"); rec.Code != http.StatusOK {
+		t.Fatalf("batch: status = %d (body=%s)", rec.Code, rec.Body.String())
+	}
+	if got := testutil.ToFloat64(series); got != 2 {
+		t.Errorf("batch default series = %v, want 2 (same normalization as push)", got)
+	}
+
+	// Unknown keys are a 400 with the stable reason, not silently dropped.
+	rec := postJSON(t, hs.handleMetricsPush,
+		`{"type":"counter","name":"requests","value":1,"labels":{"guild":"123"}}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), reasonUnknownLabel) {
+		t.Errorf("unknown label key: status = %d body = %q, want 400 %s", rec.Code, rec.Body.String(), reasonUnknownLabel)
+	}
+}
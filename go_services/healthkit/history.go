@@ -0,0 +1,215 @@
+package healthkit
+
+// Retention-bounded /stats history. The smallest deployment has no Grafana —
+// when someone asks "what did memory do over the last hour?" the only answer
+// used to be "whatever Prometheus scraped, if Prometheus is even running".
+// The collector tick already reads MemStats on a cadence, so each tick also
+// appends one compact point (timestamp, alloc, sys, goroutines, GC cycles,
+// aggregate status as 0/1/2) into a fixed-size ring buffer, and
+// GET /stats/history serves a downsampled window of it as columnar JSON
+// arrays a dashboard can feed straight into a sparkline.
+//
+// Memory is strictly bounded on both sides: the ring never grows past its
+// capacity (default 720 points — 2 hours at the 10s tick, ~40 bytes each),
+// and a query can never materialize more than maxHistoryBuckets output
+// buckets no matter what minutes/step combination the client asks for.
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultHistoryCapacity is 2 hours of points at the default 10s
+	// collector tick. Overridable via STATS_HISTORY_CAPACITY.
+	defaultHistoryCapacity = 720
+
+	// maxHistoryBuckets caps the downsampled output size regardless of the
+	// requested window and step.
+	maxHistoryBuckets = 2000
+)
+
+// Numeric aggregate-status encoding used in history points: smaller is
+// better, so a sparkline of it reads like a traffic light.
+const (
+	historyStatusHealthy  = 0
+	historyStatusDegraded = 1
+	historyStatusOther    = 2 // maintenance, unhealthy, anything else
+)
+
+// statPoint is one collector sample. Fields are fixed-width so the ring's
+// footprint is capacity * sizeof(statPoint), nothing more.
+type statPoint struct {
+	at         time.Time
+	alloc      uint64
+	sys        uint64
+	goroutines int32
+	gcCycles   uint32
+	status     uint8
+}
+
+// statsRing is a fixed-size ring buffer of statPoints. Its own mutex, same
+// pattern as the incident and breaker stores: record is called from the
+// collector goroutine, snapshot from request handlers.
+type statsRing struct {
+	mu   sync.Mutex
+	buf  []statPoint
+	next int
+	full bool
+}
+
+func newStatsRing(capacity int) *statsRing {
+	if capacity <= 0 {
+		capacity = defaultHistoryCapacity
+	}
+	return &statsRing{buf: make([]statPoint, capacity)}
+}
+
+func (r *statsRing) record(p statPoint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf[r.next] = p
+	r.next++
+	if r.next == len(r.buf) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// snapshot returns the stored points oldest-first.
+func (r *statsRing) snapshot() []statPoint {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]statPoint(nil), r.buf[:r.next]...)
+	}
+	out := make([]statPoint, 0, len(r.buf))
+	out = append(out, r.buf[r.next:]...)
+	return append(out, r.buf[:r.next]...)
+}
+
+// historyStatusCode maps an aggregate status string to its numeric encoding.
+func historyStatusCode(status string) uint8 {
+	switch status {
+	case "healthy":
+		return historyStatusHealthy
+	case "degraded":
+		return historyStatusDegraded
+	default:
+		return historyStatusOther
+	}
+}
+
+// historyResponse is the columnar GET /stats/history body: index i of every
+// array describes the same bucket, which is exactly the shape a sparkline
+// library wants. Memory and goroutines downsample with max (a spike must not
+// average away), status and GC cycles with last.
+type historyResponse struct {
+	StepSeconds int      `json:"step_seconds"`
+	Timestamps  []string `json:"timestamps"`
+	AllocBytes  []uint64 `json:"alloc_bytes"`
+	SysBytes    []uint64 `json:"sys_bytes"`
+	Goroutines  []int32  `json:"goroutines"`
+	GCCycles    []uint32 `json:"gc_cycles"`
+	Status      []uint8  `json:"status"`
+}
+
+// handleStatsHistory serves GET /stats/history?minutes=60&step=30s.
+func (h *Service) handleStatsHistory(w http.ResponseWriter, r *http.Request) {
+	minutes := 60
+	if raw := r.URL.Query().Get("minutes"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			writeParamError(w, "minutes", "invalid minutes (must be a positive integer)")
+			return
+		}
+		minutes = n
+	}
+	step := 30 * time.Second
+	if raw := r.URL.Query().Get("step"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < time.Second {
+			writeParamError(w, "step", "invalid step (must be a duration of at least 1s)")
+			return
+		}
+		step = d
+	}
+	window := time.Duration(minutes) * time.Minute
+	if int(window/step) > maxHistoryBuckets {
+		writeParamError(w, "step", "window/step would exceed the bucket cap")
+		return
+	}
+
+	now := h.clock.Now()
+	since := now.Add(-window)
+	resp := historyResponse{StepSeconds: int(step / time.Second)}
+	// One pass over the chronological snapshot: points sharing a bucket fold
+	// into it, empty buckets are simply never emitted, so the arrays stay
+	// aligned and dense.
+	currentBucket := time.Time{}
+	last := -1
+	for _, p := range h.history.snapshot() {
+		if p.at.Before(since) || p.at.After(now) {
+			continue
+		}
+		bucket := p.at.Truncate(step)
+		if last < 0 || !bucket.Equal(currentBucket) {
+			currentBucket = bucket
+			resp.Timestamps = append(resp.Timestamps, formatTimestamp(bucket))
+			resp.AllocBytes = append(resp.AllocBytes, p.alloc)
+			resp.SysBytes = append(resp.SysBytes, p.sys)
+			resp.Goroutines = append(resp.Goroutines, p.goroutines)
+			resp.GCCycles = append(resp.GCCycles, p.gcCycles)
+			resp.Status = append(resp.Status, p.status)
+			last++
+			continue
+		}
+		if p.alloc > resp.AllocBytes[last] {
+			resp.AllocBytes[last] = p.alloc
+		}
+		if p.sys > resp.SysBytes[last] {
+			resp.SysBytes[last] = p.sys
+		}
+		if p.goroutines > resp.Goroutines[last] {
+			resp.Goroutines[last] = p.goroutines
+		}
+		resp.GCCycles[last] = p.gcCycles
+		resp.Status[last] = p.status
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode history response: %v", err)
+	}
+}
+
+// WithHistoryCapacity overrides the ring size; non-positive values are
+// ignored.
+func WithHistoryCapacity(n int) Option {
+	return func(h *Service) {
+		if n > 0 {
+			h.historyCapacity = n
+		}
+	}
+}
+
+// historyCapacityFromEnv reads the STATS_HISTORY_CAPACITY override with the
+// usual fail-safe posture.
+func historyCapacityFromEnv() int {
+	raw := strings.TrimSpace(os.Getenv("STATS_HISTORY_CAPACITY"))
+	if raw == "" {
+		return defaultHistoryCapacity
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("WARNING: invalid STATS_HISTORY_CAPACITY %q (must be a positive integer) — using default %d", raw, defaultHistoryCapacity)
+		return defaultHistoryCapacity
+	}
+	return n
+}
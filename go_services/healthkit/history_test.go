@@ -0,0 +1,177 @@
+package healthkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStatsRingWraparound(t *testing.T) {
+	r := newStatsRing(5)
+	base := time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 8; i++ {
+		r.record(statPoint{at: base.Add(time.Duration(i) * time.Second), alloc: uint64(i)})
+	}
+	points := r.snapshot()
+	if len(points) != 5 {
+		t.Fatalf("snapshot len = %d, want the capacity 5", len(points))
+	}
+	// Oldest-first: samples 3..7 survive, 0..2 were overwritten.
+	for i, p := range points {
+		if want := uint64(i + 3); p.alloc != want {
+			t.Errorf("points[%d].alloc = %d, want %d", i, p.alloc, want)
+		}
+	}
+	// The ring never grows past capacity no matter how much is recorded.
+	for i := 0; i < 100; i++ {
+		r.record(statPoint{at: base.Add(time.Duration(i) * time.Minute)})
+	}
+	if got := len(r.snapshot()); got != 5 {
+		t.Errorf("snapshot len after 100 more records = %d, want 5", got)
+	}
+}
+
+func TestStatsHistoryDownsampling(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk))
+	r := buildRouter(hs, "tok")
+
+	// Six samples at 10s spacing starting on a 30s boundary: two full 30s
+	// buckets of three samples each.
+	base := clk.Now()
+	for i, p := range []statPoint{
+		{alloc: 100, sys: 500, goroutines: 10, gcCycles: 1, status: historyStatusHealthy},
+		{alloc: 300, sys: 500, goroutines: 12, gcCycles: 1, status: historyStatusHealthy},
+		{alloc: 200, sys: 600, goroutines: 11, gcCycles: 2, status: historyStatusDegraded},
+		{alloc: 150, sys: 550, goroutines: 9, gcCycles: 2, status: historyStatusDegraded},
+		{alloc: 400, sys: 550, goroutines: 14, gcCycles: 3, status: historyStatusDegraded},
+		{alloc: 120, sys: 540, goroutines: 8, gcCycles: 3, status: historyStatusHealthy},
+	} {
+		p.at = base.Add(time.Duration(i) * 10 * time.Second)
+		hs.history.record(p)
+	}
+	clk.Advance(50 * time.Second) // "now" = the last sample's timestamp
+
+	rec := doReq(t, r, http.MethodGet, "/stats/history?minutes=10&step=30s", "tok", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("history = %d, want 200; body %s", rec.Code, rec.Body.String())
+	}
+	var resp historyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.StepSeconds != 30 {
+		t.Errorf("step_seconds = %d, want 30", resp.StepSeconds)
+	}
+	wantTimes := []string{formatTimestamp(base), formatTimestamp(base.Add(30 * time.Second))}
+	if !reflect.DeepEqual(resp.Timestamps, wantTimes) {
+		t.Fatalf("timestamps = %v, want %v", resp.Timestamps, wantTimes)
+	}
+	// Memory and goroutines take the bucket max; status and GC take the last.
+	if !reflect.DeepEqual(resp.AllocBytes, []uint64{300, 400}) {
+		t.Errorf("alloc_bytes = %v, want [300 400]", resp.AllocBytes)
+	}
+	if !reflect.DeepEqual(resp.SysBytes, []uint64{600, 550}) {
+		t.Errorf("sys_bytes = %v, want [600 550]", resp.SysBytes)
+	}
+	if !reflect.DeepEqual(resp.Goroutines, []int32{12, 14}) {
+		t.Errorf("goroutines = %v, want [12 14]", resp.Goroutines)
+	}
+	if !reflect.DeepEqual(resp.GCCycles, []uint32{2, 3}) {
+		t.Errorf("gc_cycles = %v, want [2 3]", resp.GCCycles)
+	}
+	if !reflect.DeepEqual(resp.Status, []uint8{historyStatusDegraded, historyStatusHealthy}) {
+		t.Errorf("status = %v, want [degraded healthy]", resp.Status)
+	}
+}
+
+func TestStatsHistoryWindowFiltersOldPoints(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk))
+	r := buildRouter(hs, "tok")
+
+	hs.history.record(statPoint{at: clk.Now(), alloc: 1})
+	clk.Advance(2 * time.Hour)
+	hs.history.record(statPoint{at: clk.Now(), alloc: 2})
+
+	rec := doReq(t, r, http.MethodGet, "/stats/history?minutes=60&step=60s", "tok", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("history = %d, want 200", rec.Code)
+	}
+	var resp historyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !reflect.DeepEqual(resp.AllocBytes, []uint64{2}) {
+		t.Errorf("alloc_bytes = %v, want only the in-window point [2]", resp.AllocBytes)
+	}
+}
+
+func TestStatsHistoryValidation(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+
+	if rec := doReq(t, r, http.MethodGet, "/stats/history", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated = %d, want 401", rec.Code)
+	}
+	for _, q := range []string{
+		"?minutes=0", "?minutes=-5", "?minutes=soon",
+		"?step=500ms", "?step=nope",
+		"?minutes=1440&step=1s", // 86400 buckets > cap
+	} {
+		if rec := doReq(t, r, http.MethodGet, "/stats/history"+q, "tok", ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("query %q = %d, want 400", q, rec.Code)
+		}
+	}
+	// Defaults (minutes=60, step=30s) are valid with an empty ring.
+	if rec := doReq(t, r, http.MethodGet, "/stats/history", "tok", ""); rec.Code != http.StatusOK {
+		t.Errorf("defaults = %d, want 200", rec.Code)
+	}
+}
+
+func TestCollectorFeedsHistory(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk), WithCollectorInterval(10*time.Second))
+	hs.SetServiceStatus("database", false)
+
+	hs.CollectSystemMetrics()
+	points := hs.history.snapshot()
+	if len(points) != 1 {
+		t.Fatalf("history len = %d, want 1 point per collector sample", len(points))
+	}
+	p := points[0]
+	if p.alloc == 0 || p.sys == 0 || p.goroutines == 0 {
+		t.Errorf("point = %+v, want live runtime figures", p)
+	}
+	if p.status != historyStatusDegraded {
+		t.Errorf("status = %d, want %d (degraded)", p.status, historyStatusDegraded)
+	}
+	// A second call inside the sampling floor is dropped, so the ring does
+	// not double-record.
+	hs.CollectSystemMetrics()
+	if got := len(hs.history.snapshot()); got != 1 {
+		t.Errorf("history len after throttled call = %d, want 1", got)
+	}
+}
+
+func TestHistoryCapacityFromEnv(t *testing.T) {
+	tests := []struct {
+		name, raw string
+		want      int
+	}{
+		{"empty uses default", "", defaultHistoryCapacity},
+		{"valid", "120", 120},
+		{"zero invalid", "0", defaultHistoryCapacity},
+		{"junk invalid", "lots", defaultHistoryCapacity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("STATS_HISTORY_CAPACITY", tt.raw)
+			if got := historyCapacityFromEnv(); got != tt.want {
+				t.Errorf("historyCapacityFromEnv() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
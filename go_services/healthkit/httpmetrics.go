@@ -0,0 +1,168 @@
+package healthkit
+
+// Per-route HTTP metrics for the Go services' OWN handlers. The bot's request
+// metrics arrive via pushes, but nothing scraped the services' handler
+// latencies or status codes (chi's Logger prints them and they vanish). This
+// middleware is shared: healthkit mounts it on its routes and url_fetcher
+// mounts the same type on its router under its own namespace.
+//
+// Labels are the chi ROUTE PATTERN ("/widgets/{id}"), never the raw path —
+// raw paths are attacker-controlled and would let a URL scanner mint
+// unbounded series. Requests that match no route collapse into the single
+// "not_found" pattern for the same reason. Method and status code are bounded
+// by what the routers actually serve, so they are safe as labels. The
+// /metrics endpoint itself is NOT recorded: every scrape would otherwise
+// append one more sample to the very series being scraped, which is pure
+// feedback noise.
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// notFoundRoute is the pattern label for requests that matched no route.
+const notFoundRoute = "not_found"
+
+// metricsRoute is the scrape endpoint, excluded from self-instrumentation
+// (see the package comment on scrape feedback).
+const metricsRoute = "/metrics"
+
+// HTTPMetrics holds the per-route collectors. Build one per process with
+// NewHTTPMetrics and mount Middleware early in the chain — before any
+// timeout middleware, so timed-out requests are attributed to their route.
+type HTTPMetrics struct {
+	duration     *prometheus.HistogramVec
+	responses    *prometheus.CounterVec
+	inFlight     prometheus.Gauge
+	requestSize  *prometheus.HistogramVec
+	bodyTooLarge *prometheus.CounterVec
+}
+
+// NewHTTPMetrics registers the collector set on reg under namespace (e.g.
+// "discord_bot", "url_fetcher").
+func NewHTTPMetrics(reg prometheus.Registerer, namespace string) *HTTPMetrics {
+	f := promauto.With(reg)
+	return &HTTPMetrics{
+		duration: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "http_request_duration_seconds",
+				Help:      "Handler duration in seconds by chi route pattern",
+				Buckets:   prometheus.DefBuckets,
+			},
+			[]string{"route"},
+		),
+		responses: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "http_responses_total",
+				Help:      "Responses by chi route pattern, method and status code",
+			},
+			[]string{"route", "method", "code"},
+		),
+		inFlight: f.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Name:      "http_in_flight_requests",
+				Help:      "HTTP requests currently being handled",
+			},
+		),
+		requestSize: f.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "http_request_size_bytes",
+				Help:      "Request body size in bytes by chi route pattern (Content-Length, or counted bytes for chunked bodies)",
+				// The write endpoints cap at 1MB decompressed; buckets span a
+				// tiny gauge push up to past that cap.
+				Buckets: prometheus.ExponentialBuckets(64, 4, 10), // 64B .. ~16MB
+			},
+			[]string{"route"},
+		),
+		bodyTooLarge: f.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "http_body_too_large_total",
+				Help:      "Request bodies rejected for exceeding the endpoint size limit",
+			},
+			[]string{"route"},
+		),
+	}
+}
+
+// ObserveBodyTooLarge counts one oversized-body rejection against its route.
+func (m *HTTPMetrics) ObserveBodyTooLarge(route string) {
+	m.bodyTooLarge.WithLabelValues(route).Inc()
+}
+
+// countingBody counts the bytes a handler actually read — the only size
+// signal a chunked request gives us (Content-Length is -1 there).
+type countingBody struct {
+	rc io.ReadCloser
+	n  int64
+}
+
+func (c *countingBody) Read(p []byte) (int, error) {
+	n, err := c.rc.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingBody) Close() error { return c.rc.Close() }
+
+// statusCode renders the code label; an unwritten status (handler never
+// called WriteHeader) counts as an implicit 200.
+func statusCode(code int) string {
+	if code == 0 {
+		code = http.StatusOK
+	}
+	return strconv.Itoa(code)
+}
+
+// Middleware is the chi middleware. The route pattern is read AFTER the
+// handler ran — chi only resolves it during routing, so reading it up front
+// would always see the parent router's partial pattern.
+func (m *HTTPMetrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		// Declared sizes come straight from the header; chunked bodies
+		// (ContentLength -1) are counted as the handler reads them.
+		var counted *countingBody
+		if r.ContentLength < 0 && r.Body != nil {
+			counted = &countingBody{rc: r.Body}
+			r.Body = counted
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		next.ServeHTTP(ww, r)
+		elapsed := time.Since(start)
+
+		route := notFoundRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				route = pattern
+			}
+		}
+		if route == metricsRoute {
+			return
+		}
+		size := r.ContentLength
+		if counted != nil {
+			size = counted.n
+		}
+		if size >= 0 {
+			m.requestSize.WithLabelValues(route).Observe(float64(size))
+		}
+		m.duration.WithLabelValues(route).Observe(elapsed.Seconds())
+		m.responses.WithLabelValues(route, r.Method, statusCode(ww.Status())).Inc()
+	})
+}
@@ -0,0 +1,248 @@
+package healthkit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func newTestHTTPMetrics() (*HTTPMetrics, chi.Router) {
+	m := NewHTTPMetrics(prometheus.NewRegistry(), "test")
+	r := chi.NewRouter()
+	r.Use(m.Middleware)
+	return m, r
+}
+
+func TestHTTPMetrics_ParameterizedRoutesCollapse(t *testing.T) {
+	m, r := newTestHTTPMetrics()
+	r.Get("/widgets/{id}", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, path := range []string{"/widgets/1", "/widgets/2", "/widgets/deadbeef"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: HTTP %d", path, w.Code)
+		}
+	}
+
+	// Three distinct raw paths, ONE label value — the route pattern.
+	if got := testutil.ToFloat64(m.responses.WithLabelValues("/widgets/{id}", http.MethodGet, "200")); got != 3 {
+		t.Errorf("pattern counter = %v, want 3", got)
+	}
+	if got := testutil.CollectAndCount(m.responses); got != 1 {
+		t.Errorf("response series = %d, want 1 (raw paths must not mint series)", got)
+	}
+	if got := testutil.CollectAndCount(m.duration); got != 1 {
+		t.Errorf("duration series = %d, want 1", got)
+	}
+}
+
+func TestHTTPMetrics_NotFoundBucketsUnderOnePattern(t *testing.T) {
+	m, r := newTestHTTPMetrics()
+	r.Get("/known", func(w http.ResponseWriter, _ *http.Request) {})
+
+	for _, path := range []string{"/nope", "/also/missing", "/scan/../../etc/passwd"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("GET %s: HTTP %d, want 404", path, w.Code)
+		}
+	}
+
+	if got := testutil.ToFloat64(m.responses.WithLabelValues(notFoundRoute, http.MethodGet, "404")); got != 3 {
+		t.Errorf("not_found counter = %v, want 3", got)
+	}
+	if got := testutil.CollectAndCount(m.responses); got != 1 {
+		t.Errorf("response series = %d, want 1 — scanned paths must all collapse", got)
+	}
+}
+
+func TestHTTPMetrics_StatusCodesAndImplicit200(t *testing.T) {
+	m, r := newTestHTTPMetrics()
+	r.Get("/implicit", func(_ http.ResponseWriter, _ *http.Request) {}) // never calls WriteHeader
+	r.Get("/boom", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/implicit", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/boom", nil))
+
+	if got := testutil.ToFloat64(m.responses.WithLabelValues("/implicit", http.MethodGet, "200")); got != 1 {
+		t.Errorf("implicit-200 counter = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.responses.WithLabelValues("/boom", http.MethodGet, "500")); got != 1 {
+		t.Errorf("500 counter = %v, want 1", got)
+	}
+}
+
+func TestHTTPMetrics_MethodLabel(t *testing.T) {
+	m, r := newTestHTTPMetrics()
+	r.Get("/thing", func(_ http.ResponseWriter, _ *http.Request) {})
+	r.Post("/thing", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/thing", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/thing", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/thing", nil))
+
+	if got := testutil.ToFloat64(m.responses.WithLabelValues("/thing", http.MethodGet, "200")); got != 1 {
+		t.Errorf("GET counter = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.responses.WithLabelValues("/thing", http.MethodPost, "201")); got != 2 {
+		t.Errorf("POST counter = %v, want 2", got)
+	}
+}
+
+func TestHTTPMetrics_MetricsEndpointExcluded(t *testing.T) {
+	m, r := newTestHTTPMetrics()
+	r.Get("/metrics", func(_ http.ResponseWriter, _ *http.Request) {})
+	r.Get("/health", func(_ http.ResponseWriter, _ *http.Request) {})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	// Only the /health request may appear: a scrape of /metrics must not feed
+	// back into the series it is scraping.
+	if got := testutil.CollectAndCount(m.responses); got != 1 {
+		t.Errorf("response series = %d, want 1 (/metrics must be excluded)", got)
+	}
+	if got := testutil.ToFloat64(m.responses.WithLabelValues("/health", http.MethodGet, "200")); got != 1 {
+		t.Errorf("/health counter = %v, want 1", got)
+	}
+}
+
+func TestHTTPMetrics_InFlightGauge(t *testing.T) {
+	m, r := newTestHTTPMetrics()
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	r.Get("/slow", func(w http.ResponseWriter, _ *http.Request) {
+		close(entered)
+		<-release
+	})
+
+	done := make(chan struct{})
+	go func() {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+		close(done)
+	}()
+	<-entered
+	if got := testutil.ToFloat64(m.inFlight); got != 1 {
+		t.Errorf("in-flight = %v during a request, want 1", got)
+	}
+	close(release)
+	<-done
+	if got := testutil.ToFloat64(m.inFlight); got != 0 {
+		t.Errorf("in-flight = %v after the request, want 0", got)
+	}
+}
+
+func TestHTTPMetrics_MountedOnServiceRoutes(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "")
+
+	w := doReq(t, r, http.MethodGet, "/health", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("/health: HTTP %d", w.Code)
+	}
+	if got := testutil.ToFloat64(hs.httpMetrics.responses.WithLabelValues("/health", http.MethodGet, "200")); got != 1 {
+		t.Errorf("/health counter = %v, want 1", got)
+	}
+}
+
+func TestHTTPMetrics_RequestSizeHistogram(t *testing.T) {
+	m, r := newTestHTTPMetrics()
+	r.Post("/ingest", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+	})
+
+	// Declared size: Content-Length feeds the histogram directly.
+	body := strings.Repeat("x", 500)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(body)))
+
+	// Chunked: no Content-Length, so the middleware counts what the handler
+	// actually read.
+	req := httptest.NewRequest(http.MethodPost, "/ingest", io.NopCloser(strings.NewReader(body)))
+	req.ContentLength = -1
+	req.TransferEncoding = []string{"chunked"}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	hist := m.requestSize.WithLabelValues("/ingest").(prometheus.Histogram)
+	var metric dto.Metric
+	if err := hist.Write(&metric); err != nil {
+		t.Fatalf("read histogram: %v", err)
+	}
+	if got := metric.GetHistogram().GetSampleCount(); got != 2 {
+		t.Fatalf("size samples = %d, want 2 (declared + chunked)", got)
+	}
+	if got := metric.GetHistogram().GetSampleSum(); got != 1000 {
+		t.Errorf("size sum = %v, want 1000 (both bodies counted at 500B)", got)
+	}
+}
+
+func TestPushBodyTooLargeIs413WithCounter(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+
+	// Just over the 64KB /metrics/push cap: valid JSON so the only failure
+	// is the size limit tripping mid-decode.
+	pad := strings.Repeat("a", 1<<16)
+	body := `{"type":"gauge","name":"active_connections","value":1,"pad":"` + pad + `"}`
+	rec := doReq(t, r, http.MethodPost, "/metrics/push", "tok", body)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized push = %d, want 413 (not a generic 400)", rec.Code)
+	}
+	if env := decodeErrorEnvelope(t, rec); env.Code != errCodeBodyTooLarge {
+		t.Errorf("413 body = %+v, want code %q", env, errCodeBodyTooLarge)
+	}
+
+	mf := findMetric(t, hs, "discord_bot_http_body_too_large_total")
+	if mf == nil {
+		t.Fatal("body-too-large counter not registered")
+	}
+	found := false
+	for _, metric := range mf.GetMetric() {
+		for _, lp := range metric.GetLabel() {
+			if lp.GetName() == "route" && lp.GetValue() == "/metrics/push" {
+				found = true
+				if metric.GetCounter().GetValue() != 1 {
+					t.Errorf("counter = %v, want 1", metric.GetCounter().GetValue())
+				}
+			}
+		}
+	}
+	if !found {
+		t.Error("no counter sample for route /metrics/push")
+	}
+
+	// A gzip body over the decompressed limit lands on the same counter.
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/metrics/push", &buf)
+	req.Header.Set("Authorization", "Bearer tok")
+	req.Header.Set("Content-Encoding", "gzip")
+	rec2 := httptest.NewRecorder()
+	r.ServeHTTP(rec2, req)
+	if rec2.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized gzip push = %d, want 413", rec2.Code)
+	}
+}
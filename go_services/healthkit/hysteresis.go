@@ -0,0 +1,157 @@
+package healthkit
+
+// Readiness hysteresis. One failed push marking a service unhealthy used to
+// flip /health/ready to 503 on the next probe; the orchestrator yanked the
+// pod, the service recovered two seconds later, and the churn cost more than
+// the blip. With hysteresis configured, readiness consults an EFFECTIVE
+// per-service state that lags the instantaneous one: a service must stay
+// reported-unhealthy for READINESS_DOWN_SECONDS continuous seconds (or
+// READINESS_DOWN_REPORTS consecutive unhealthy reports — either threshold
+// trips it) before it degrades readiness, and must then stay healthy for
+// READINESS_COOLDOWN_SECONDS before readiness recovers. /health keeps
+// showing the raw reported states, with the effective view alongside as
+// effective_services, so both truths stay visible during an incident.
+//
+// All knobs default to zero, which is exactly the historical instant
+// behavior — deployments that never set the env vars see no change, and the
+// effective_services key stays absent to preserve the response shape.
+//
+// The effective state is materialized only on report events (under mu, in
+// SetServiceStatus); reads evaluate the pending transition as a pure
+// function of (reported state, time in state, consecutive reports), so a
+// service that goes quiet after one unhealthy report still trips the
+// time-based threshold without another write.
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hystConfig is the hysteresis configuration; the zero value disables it.
+type hystConfig struct {
+	downFor     time.Duration // continuous unhealthy time before effective-down
+	downReports int           // consecutive unhealthy reports before effective-down
+	cooldown    time.Duration // continuous healthy time before effective-up
+}
+
+func (c hystConfig) enabled() bool {
+	return c.downFor > 0 || c.downReports > 0 || c.cooldown > 0
+}
+
+// hystState tracks one service's reported state and its lagging effective
+// state. effective holds the value materialized at the last report; when the
+// two disagree, effectiveOf decides whether the pending transition has
+// happened yet.
+type hystState struct {
+	reported  bool
+	since     time.Time // when the reported state was entered
+	reports   int       // consecutive reports of the current state
+	effective bool
+}
+
+// effectiveOf evaluates the effective state at now. Pure — callers under
+// RLock must not write through s.
+func (c hystConfig) effectiveOf(s *hystState, now time.Time) bool {
+	if s.reported == s.effective {
+		return s.effective
+	}
+	elapsed := now.Sub(s.since)
+	if !s.reported {
+		// Pending down: an unconfigured pair of down-thresholds means the
+		// historical instant flip.
+		if c.downFor <= 0 && c.downReports <= 0 {
+			return false
+		}
+		if c.downFor > 0 && elapsed >= c.downFor {
+			return false
+		}
+		if c.downReports > 0 && s.reports >= c.downReports {
+			return false
+		}
+		return true
+	}
+	// Pending up: healthy again, but only effective after the cool-down.
+	return c.cooldown <= 0 || elapsed >= c.cooldown
+}
+
+// recordHysteresisLocked applies one report. Caller holds mu (write). The
+// effective value is materialized first, so "was unhealthy 2s out of a 10s
+// threshold, then recovered" correctly never counts as effectively down —
+// and therefore skips the recovery cool-down too.
+func (h *Service) recordHysteresisLocked(name string, healthy bool, now time.Time) {
+	s, ok := h.hyst[name]
+	if !ok {
+		s = &hystState{reported: healthy, since: now, reports: 1, effective: true}
+		s.effective = h.hystCfg.effectiveOf(s, now)
+		h.hyst[name] = s
+		return
+	}
+	s.effective = h.hystCfg.effectiveOf(s, now)
+	if s.reported == healthy {
+		s.reports++
+		return
+	}
+	s.reported = healthy
+	s.since = now
+	s.reports = 1
+	s.effective = h.hystCfg.effectiveOf(s, now)
+}
+
+// effectiveServicesLocked returns the effective per-service view and whether
+// any service is effectively down. Caller holds mu (read or write).
+func (h *Service) effectiveServicesLocked(now time.Time) (map[string]bool, bool) {
+	eff := make(map[string]bool, len(h.services))
+	anyDown := false
+	for name, reported := range h.services {
+		v := reported
+		if s, ok := h.hyst[name]; ok {
+			v = h.hystCfg.effectiveOf(s, now)
+		}
+		eff[name] = v
+		if !v {
+			anyDown = true
+		}
+	}
+	return eff, anyDown
+}
+
+// WithReadinessHysteresis configures the thresholds; zero values keep the
+// instant behavior for that edge.
+func WithReadinessHysteresis(downFor time.Duration, downReports int, cooldown time.Duration) Option {
+	return func(h *Service) {
+		if downFor > 0 {
+			h.hystCfg.downFor = downFor
+		}
+		if downReports > 0 {
+			h.hystCfg.downReports = downReports
+		}
+		if cooldown > 0 {
+			h.hystCfg.cooldown = cooldown
+		}
+	}
+}
+
+// hysteresisFromEnv reads READINESS_DOWN_SECONDS, READINESS_DOWN_REPORTS and
+// READINESS_COOLDOWN_SECONDS. Same fail-safe posture as the other *FromEnv
+// helpers: garbage keeps that knob at zero (instant) with a warning.
+func hysteresisFromEnv() (downFor time.Duration, downReports int, cooldown time.Duration) {
+	return time.Duration(hystIntFromEnv("READINESS_DOWN_SECONDS")) * time.Second,
+		hystIntFromEnv("READINESS_DOWN_REPORTS"),
+		time.Duration(hystIntFromEnv("READINESS_COOLDOWN_SECONDS")) * time.Second
+}
+
+func hystIntFromEnv(key string) int {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Printf("WARNING: invalid %s %q (must be a non-negative integer) — keeping instant readiness for this edge", key, raw)
+		return 0
+	}
+	return n
+}
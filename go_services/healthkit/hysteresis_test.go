@@ -0,0 +1,177 @@
+package healthkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHysteresisDefaultsKeepInstantBehavior(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk))
+	hs.SetServiceStatus("database", true)
+	hs.SetServiceStatus("database", false)
+	if got := hs.AggregateStatus(); got != "degraded" {
+		t.Fatalf("status without hysteresis = %s, want instant degraded", got)
+	}
+	if hs.GetStatus().EffectiveServices != nil {
+		t.Error("effective_services must stay absent when no thresholds are set")
+	}
+	hs.SetServiceStatus("database", true)
+	if got := hs.AggregateStatus(); got != "healthy" {
+		t.Fatalf("status after instant recovery = %s, want healthy", got)
+	}
+}
+
+func TestHysteresisTimeThreshold(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk),
+		WithReadinessHysteresis(10*time.Second, 0, 0))
+	hs.SetServiceStatus("database", true)
+
+	hs.SetServiceStatus("database", false)
+	if got := hs.AggregateStatus(); got != "healthy" {
+		t.Fatalf("status right after one unhealthy report = %s, want healthy", got)
+	}
+	clk.Advance(9 * time.Second)
+	if got := hs.AggregateStatus(); got != "healthy" {
+		t.Fatalf("status at 9s of a 10s threshold = %s, want healthy", got)
+	}
+	// The threshold trips on time alone — no further report required.
+	clk.Advance(1 * time.Second)
+	if got := hs.AggregateStatus(); got != "degraded" {
+		t.Fatalf("status at the 10s threshold = %s, want degraded", got)
+	}
+	report := hs.GetReadinessReport()
+	if report.Ready {
+		t.Error("ready = true while effectively down")
+	}
+	if len(report.Reasons) != 1 || report.Reasons[0] != "service_unhealthy:database" {
+		t.Errorf("reasons = %v, want [service_unhealthy:database]", report.Reasons)
+	}
+}
+
+func TestHysteresisShortBlipNeverTrips(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk),
+		WithReadinessHysteresis(10*time.Second, 0, 30*time.Second))
+	hs.SetServiceStatus("database", true)
+
+	// 2s of a 10s threshold never counts as effectively down, so the 30s
+	// recovery cool-down must not apply either.
+	hs.SetServiceStatus("database", false)
+	clk.Advance(2 * time.Second)
+	hs.SetServiceStatus("database", true)
+	if got := hs.AggregateStatus(); got != "healthy" {
+		t.Fatalf("status after a 2s blip = %s, want healthy with no cooldown", got)
+	}
+}
+
+func TestHysteresisReportThreshold(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk),
+		WithReadinessHysteresis(0, 3, 0))
+	hs.SetServiceStatus("gemini", true)
+
+	for i := 1; i <= 2; i++ {
+		hs.SetServiceStatus("gemini", false)
+		if got := hs.AggregateStatus(); got != "healthy" {
+			t.Fatalf("status after %d unhealthy reports = %s, want healthy", i, got)
+		}
+	}
+	hs.SetServiceStatus("gemini", false)
+	if got := hs.AggregateStatus(); got != "degraded" {
+		t.Fatalf("status after 3 consecutive unhealthy reports = %s, want degraded", got)
+	}
+	// A healthy report in between resets the consecutive count.
+	hs.SetServiceStatus("gemini", true)
+	hs.SetServiceStatus("gemini", false)
+	hs.SetServiceStatus("gemini", false)
+	if got := hs.AggregateStatus(); got != "healthy" {
+		t.Fatalf("status after a reset + 2 reports = %s, want healthy", got)
+	}
+}
+
+func TestHysteresisRecoveryCooldown(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk),
+		WithReadinessHysteresis(5*time.Second, 0, 10*time.Second))
+	hs.SetServiceStatus("database", true)
+
+	hs.SetServiceStatus("database", false)
+	clk.Advance(5 * time.Second)
+	if got := hs.AggregateStatus(); got != "degraded" {
+		t.Fatalf("status after sustained outage = %s, want degraded", got)
+	}
+	hs.SetServiceStatus("database", true)
+	if got := hs.AggregateStatus(); got != "degraded" {
+		t.Fatalf("status right after recovery = %s, want degraded during cooldown", got)
+	}
+	clk.Advance(9 * time.Second)
+	if got := hs.AggregateStatus(); got != "degraded" {
+		t.Fatalf("status at 9s of a 10s cooldown = %s, want degraded", got)
+	}
+	clk.Advance(1 * time.Second)
+	if got := hs.AggregateStatus(); got != "healthy" {
+		t.Fatalf("status after the cooldown = %s, want healthy", got)
+	}
+}
+
+func TestHealthShowsBothViewsDuringPendingDown(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk),
+		WithReadinessHysteresis(10*time.Second, 0, 0))
+	r := buildRouter(hs, "tok")
+	hs.SetServiceStatus("database", true)
+	hs.SetServiceStatus("database", false)
+	clk.Advance(2 * time.Second)
+
+	rec := doReq(t, r, http.MethodGet, "/health", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /health = %d, want 200", rec.Code)
+	}
+	var body struct {
+		Status            string          `json:"status"`
+		Services          map[string]bool `json:"services"`
+		EffectiveServices map[string]bool `json:"effective_services"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode /health: %v", err)
+	}
+	if body.Services["database"] {
+		t.Error("services.database = true, want the raw reported false")
+	}
+	if !body.EffectiveServices["database"] {
+		t.Error("effective_services.database = false, want still true at 2s of 10s")
+	}
+	if body.Status != "healthy" {
+		t.Errorf("status = %s, want healthy while the transition is pending", body.Status)
+	}
+}
+
+func TestHysteresisFromEnv(t *testing.T) {
+	tests := []struct {
+		name                      string
+		downSecs, reports, cdSecs string
+		wantDownFor               time.Duration
+		wantReports               int
+		wantCooldown              time.Duration
+	}{
+		{"unset keeps instant", "", "", "", 0, 0, 0},
+		{"all set", "10", "3", "30", 10 * time.Second, 3, 30 * time.Second},
+		{"junk keeps that knob instant", "soon", "3", "-5", 0, 3, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("READINESS_DOWN_SECONDS", tt.downSecs)
+			t.Setenv("READINESS_DOWN_REPORTS", tt.reports)
+			t.Setenv("READINESS_COOLDOWN_SECONDS", tt.cdSecs)
+			downFor, reports, cooldown := hysteresisFromEnv()
+			if downFor != tt.wantDownFor || reports != tt.wantReports || cooldown != tt.wantCooldown {
+				t.Errorf("hysteresisFromEnv() = (%v, %d, %v), want (%v, %d, %v)",
+					downFor, reports, cooldown, tt.wantDownFor, tt.wantReports, tt.wantCooldown)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package healthkit
+
+// Incident tracking layered on health transitions. The service map answers
+// "is X healthy NOW"; reconstructing "when did X break, for how long, and
+// what did we do about it" from logs after the fact is exactly the archaeology
+// this store removes. Every healthy→unhealthy edge in SetServiceStatus opens
+// an incident (id, service, start time); the recovery edge closes it, at
+// which point the total downtime is fixed. Operators can attach notes while
+// triaging (POST /incidents/{id}/notes) and query the log (GET /incidents,
+// optionally ?open=true).
+//
+// Flap handling: a recovery followed by another failure within the debounce
+// window reopens the SAME incident instead of minting a new one, so one
+// continuous outage with blips reads as one incident — the downtime recorded
+// at the final close spans the whole outage, blips included. The store is
+// capped (oldest evicted) so a flapping service can't grow it unbounded.
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// defaultIncidentCap bounds the stored incident log (oldest evicted).
+	defaultIncidentCap = 200
+	// defaultIncidentDebounce is the recovery gap under which a re-failure
+	// continues the previous incident instead of opening a new one.
+	defaultIncidentDebounce = 60 * time.Second
+	// maxIncidentNotes bounds the notes per incident — notes are operator
+	// input over an authenticated endpoint, but a runaway script shouldn't
+	// be able to balloon one record.
+	maxIncidentNotes = 50
+)
+
+// IncidentNote is one operator annotation. Text is stored already sanitized,
+// like service messages — it flows into the same JSON/log/dashboard sinks.
+type IncidentNote struct {
+	At   string `json:"at"` // RFC3339 UTC
+	Text string `json:"text"`
+}
+
+// Incident is the JSON view of one outage record.
+type Incident struct {
+	ID        string `json:"id"`
+	Service   string `json:"service"`
+	StartedAt string `json:"started_at"` // RFC3339 UTC
+	EndedAt   string `json:"ended_at,omitempty"`
+	Open      bool   `json:"open"`
+	// DowntimeSeconds is fixed at close: end minus start, debounced blips
+	// included. Zero while the incident is open.
+	DowntimeSeconds float64        `json:"downtime_seconds,omitempty"`
+	Notes           []IncidentNote `json:"notes,omitempty"`
+}
+
+// incident is the internal record; times stay time.Time until rendering.
+type incident struct {
+	id      string
+	service string
+	started time.Time
+	ended   time.Time // zero while open
+	notes   []IncidentNote
+}
+
+func (inc *incident) render() Incident {
+	out := Incident{
+		ID:        inc.id,
+		Service:   inc.service,
+		StartedAt: formatTimestamp(inc.started),
+		Open:      inc.ended.IsZero(),
+	}
+	if !inc.ended.IsZero() {
+		out.EndedAt = formatTimestamp(inc.ended)
+		out.DowntimeSeconds = inc.ended.Sub(inc.started).Seconds()
+	}
+	if len(inc.notes) > 0 {
+		out.Notes = append([]IncidentNote(nil), inc.notes...)
+	}
+	return out
+}
+
+// incidentStore holds the capped incident log. Its own mutex, deliberately
+// not h.mu: SetServiceStatus calls in while holding h.mu, and the read
+// handlers must not contend with the hot status path.
+type incidentStore struct {
+	mu       sync.Mutex
+	seq      int
+	cap      int
+	debounce time.Duration
+	items    []*incident // oldest first
+	open     map[string]*incident
+}
+
+func newIncidentStore(cap int, debounce time.Duration) *incidentStore {
+	if cap < 1 {
+		cap = 1
+	}
+	return &incidentStore{cap: cap, debounce: debounce, open: make(map[string]*incident)}
+}
+
+// openIncident records a healthy→unhealthy edge. A re-failure within the
+// debounce window of the service's last close reopens that incident.
+func (s *incidentStore) openIncident(service string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.open[service] != nil {
+		return
+	}
+	// Walk back to the service's most recent incident; only that one can be
+	// reopened — an older closed record is history, not a flap.
+	for i := len(s.items) - 1; i >= 0; i-- {
+		if s.items[i].service != service {
+			continue
+		}
+		if prev := s.items[i]; !prev.ended.IsZero() && now.Sub(prev.ended) <= s.debounce {
+			prev.ended = time.Time{}
+			s.open[service] = prev
+			return
+		}
+		break
+	}
+
+	s.seq++
+	inc := &incident{id: "inc-" + strconv.Itoa(s.seq), service: service, started: now}
+	s.items = append(s.items, inc)
+	s.open[service] = inc
+	if len(s.items) > s.cap {
+		evicted := s.items[0]
+		s.items = s.items[1:]
+		if s.open[evicted.service] == evicted {
+			delete(s.open, evicted.service)
+		}
+	}
+}
+
+// resolve records the recovery edge. The downtime becomes final here —
+// unless the debounce window reopens the incident first.
+func (s *incidentStore) resolve(service string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inc := s.open[service]
+	if inc == nil {
+		return
+	}
+	inc.ended = now
+	delete(s.open, service)
+}
+
+// get renders one incident by id.
+func (s *incidentStore) get(id string) (Incident, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, inc := range s.items {
+		if inc.id == id {
+			return inc.render(), true
+		}
+	}
+	return Incident{}, false
+}
+
+// list renders the log newest first (triage order), optionally open only.
+func (s *incidentStore) list(openOnly bool) []Incident {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Incident, 0, len(s.items))
+	for i := len(s.items) - 1; i >= 0; i-- {
+		if openOnly && !s.items[i].ended.IsZero() {
+			continue
+		}
+		out = append(out, s.items[i].render())
+	}
+	return out
+}
+
+// addNote appends one sanitized note. The non-"" second return is the stable
+// rejection reason.
+func (s *incidentStore) addNote(id, text string, now time.Time) (Incident, string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return Incident{}, "empty_note"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, inc := range s.items {
+		if inc.id != id {
+			continue
+		}
+		if len(inc.notes) >= maxIncidentNotes {
+			return Incident{}, "too_many_notes"
+		}
+		inc.notes = append(inc.notes, IncidentNote{
+			At:   formatTimestamp(now),
+			Text: sanitizeServiceMessage(text),
+		})
+		return inc.render(), ""
+	}
+	return Incident{}, "not_found"
+}
+
+// WithIncidentCap overrides how many incidents the log retains.
+func WithIncidentCap(n int) Option {
+	return func(h *Service) {
+		if n > 0 {
+			h.incidentCap = n
+		}
+	}
+}
+
+// WithIncidentDebounce overrides the flap window (0 = every recovery closes
+// for good, even a one-tick blip).
+func WithIncidentDebounce(d time.Duration) Option {
+	return func(h *Service) {
+		if d >= 0 {
+			h.incidentDebounce = d
+		}
+	}
+}
+
+// maxIncidentsFromEnv reads the MAX_INCIDENTS cap with the usual fail-safe
+// posture.
+func maxIncidentsFromEnv() int {
+	raw := strings.TrimSpace(os.Getenv("MAX_INCIDENTS"))
+	if raw == "" {
+		return defaultIncidentCap
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("WARNING: invalid MAX_INCIDENTS %q (must be a positive integer) — using default %d", raw, defaultIncidentCap)
+		return defaultIncidentCap
+	}
+	return n
+}
+
+// incidentDebounceFromEnv reads INCIDENT_DEBOUNCE_SECONDS (0 is valid: no
+// flap suppression).
+func incidentDebounceFromEnv() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("INCIDENT_DEBOUNCE_SECONDS"))
+	if raw == "" {
+		return defaultIncidentDebounce
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Printf("WARNING: invalid INCIDENT_DEBOUNCE_SECONDS %q (must be a non-negative integer) — using default %s", raw, defaultIncidentDebounce)
+		return defaultIncidentDebounce
+	}
+	return time.Duration(n) * time.Second
+}
+
+// handleIncidentList is GET /incidents: the paginated log, newest first;
+// ?open=true narrows to ongoing outages.
+func (h *Service) handleIncidentList(w http.ResponseWriter, r *http.Request) {
+	entries := h.incidentLog.list(r.URL.Query().Get("open") == "true")
+	p := parsePageParams(r.URL.Query())
+	start, end := paginate(len(entries), p)
+	writeListResponse(w, r.URL, len(entries), p, entries[start:end], h.listMaxBytes)
+}
+
+// handleIncidentGet is GET /incidents/{id}.
+func (h *Service) handleIncidentGet(w http.ResponseWriter, r *http.Request) {
+	inc, ok := h.incidentLog.get(chi.URLParam(r, "id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errCodeNotFound, "incident not found", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(inc); err != nil {
+		log.Printf("Failed to encode incident response: %v", err)
+	}
+}
+
+// handleIncidentNote is POST /incidents/{id}/notes with {"text": "..."}.
+func (h *Service) handleIncidentNote(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidJSON, "invalid JSON body", nil)
+		return
+	}
+	inc, reason := h.incidentLog.addNote(chi.URLParam(r, "id"), body.Text, h.clock.Now())
+	switch reason {
+	case "":
+	case "not_found":
+		writeError(w, http.StatusNotFound, errCodeNotFound, "incident not found", nil)
+		return
+	default:
+		writeError(w, http.StatusBadRequest, reason, "note rejected", nil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(inc); err != nil {
+		log.Printf("Failed to encode incident response: %v", err)
+	}
+}
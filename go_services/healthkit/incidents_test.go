@@ -0,0 +1,258 @@
+package healthkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// incidentList decodes the paginated /incidents envelope's items.
+func incidentList(t *testing.T, body []byte) []Incident {
+	t.Helper()
+	var resp struct {
+		Items []Incident `json:"items"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("incident list is not JSON: %v", err)
+	}
+	return resp.Items
+}
+
+func TestIncidentOpensAndClosesWithDowntime(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk))
+
+	hs.SetServiceStatus("database", true)
+	clk.Advance(time.Minute)
+	hs.SetServiceStatus("database", false)
+
+	open := hs.incidentLog.list(true)
+	if len(open) != 1 {
+		t.Fatalf("open incidents = %d, want 1", len(open))
+	}
+	if open[0].Service != "database" || !open[0].Open || open[0].EndedAt != "" {
+		t.Fatalf("open incident = %+v, want open database record", open[0])
+	}
+
+	clk.Advance(2 * time.Minute)
+	hs.SetServiceStatus("database", true)
+
+	all := hs.incidentLog.list(false)
+	if len(all) != 1 {
+		t.Fatalf("incidents = %d, want 1", len(all))
+	}
+	closed := all[0]
+	if closed.Open || closed.EndedAt == "" {
+		t.Fatalf("incident = %+v, want closed", closed)
+	}
+	if closed.DowntimeSeconds != 120 {
+		t.Errorf("downtime = %v seconds, want 120", closed.DowntimeSeconds)
+	}
+	if len(hs.incidentLog.list(true)) != 0 {
+		t.Error("open filter still returns the resolved incident")
+	}
+}
+
+func TestIncidentFlappingWithinDebounceIsOneIncident(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk), WithIncidentDebounce(30*time.Second))
+
+	// One continuous outage with two short recovery blips.
+	hs.SetServiceStatus("gateway", true)
+	hs.SetServiceStatus("gateway", false)
+	for i := 0; i < 2; i++ {
+		clk.Advance(time.Minute)
+		hs.SetServiceStatus("gateway", true)
+		clk.Advance(10 * time.Second) // blip shorter than the debounce
+		hs.SetServiceStatus("gateway", false)
+	}
+	clk.Advance(time.Minute)
+	hs.SetServiceStatus("gateway", true)
+
+	all := hs.incidentLog.list(false)
+	if len(all) != 1 {
+		t.Fatalf("incidents after flapping = %d, want 1 per continuous outage", len(all))
+	}
+	// Downtime spans the whole outage, blips included: 3×60s + 2×10s.
+	if all[0].DowntimeSeconds != 200 {
+		t.Errorf("downtime = %v seconds, want 200 (blips included)", all[0].DowntimeSeconds)
+	}
+}
+
+func TestIncidentRecoveryBeyondDebounceStartsNewIncident(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk), WithIncidentDebounce(30*time.Second))
+
+	hs.SetServiceStatus("gateway", true)
+	hs.SetServiceStatus("gateway", false)
+	clk.Advance(time.Minute)
+	hs.SetServiceStatus("gateway", true)
+	clk.Advance(5 * time.Minute) // a real recovery, not a blip
+	hs.SetServiceStatus("gateway", false)
+	clk.Advance(time.Minute)
+	hs.SetServiceStatus("gateway", true)
+
+	all := hs.incidentLog.list(false)
+	if len(all) != 2 {
+		t.Fatalf("incidents = %d, want 2 separate outages", len(all))
+	}
+	// Newest first: the second outage leads.
+	if all[0].DowntimeSeconds != 60 || all[1].DowntimeSeconds != 60 {
+		t.Errorf("downtimes = %v/%v seconds, want 60/60", all[0].DowntimeSeconds, all[1].DowntimeSeconds)
+	}
+}
+
+func TestIncidentUnknownServiceStartingUnhealthyOpens(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk))
+
+	// First-ever report is unhealthy: still an outage worth a record.
+	hs.SetServiceStatus("voice", false)
+	if len(hs.incidentLog.list(true)) != 1 {
+		t.Fatal("no incident for a service that registered unhealthy")
+	}
+	// Repeated unhealthy reports don't open duplicates.
+	hs.SetServiceStatus("voice", false)
+	hs.SetServiceStatus("voice", false)
+	if got := len(hs.incidentLog.list(false)); got != 1 {
+		t.Errorf("incidents after repeated unhealthy reports = %d, want 1", got)
+	}
+}
+
+func TestIncidentCapEvictsOldest(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk), WithIncidentCap(3), WithIncidentDebounce(0))
+
+	for i := 0; i < 4; i++ {
+		hs.SetServiceStatus("database", false)
+		clk.Advance(time.Minute)
+		hs.SetServiceStatus("database", true)
+		clk.Advance(time.Hour)
+	}
+
+	all := hs.incidentLog.list(false)
+	if len(all) != 3 {
+		t.Fatalf("incidents = %d, want capped at 3", len(all))
+	}
+	if _, ok := hs.incidentLog.get("inc-1"); ok {
+		t.Error("oldest incident survived eviction")
+	}
+	if _, ok := hs.incidentLog.get("inc-4"); !ok {
+		t.Error("newest incident missing after eviction")
+	}
+}
+
+func TestIncidentEndpoints(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk))
+	r := buildRouter(hs, "tok")
+
+	hs.SetServiceStatus("database", false)
+	clk.Advance(time.Minute)
+	hs.SetServiceStatus("database", true)
+	hs.SetServiceStatus("gateway", false) // still open
+
+	// Reads are token-gated like /health/services.
+	if rec := doReq(t, r, http.MethodGet, "/incidents", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated /incidents = %d, want 401", rec.Code)
+	}
+
+	rec := doReq(t, r, http.MethodGet, "/incidents", "tok", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/incidents = %d, want 200", rec.Code)
+	}
+	if items := incidentList(t, rec.Body.Bytes()); len(items) != 2 {
+		t.Fatalf("/incidents items = %d, want 2", len(items))
+	}
+
+	rec = doReq(t, r, http.MethodGet, "/incidents?open=true", "tok", "")
+	items := incidentList(t, rec.Body.Bytes())
+	if len(items) != 1 || items[0].Service != "gateway" {
+		t.Fatalf("/incidents?open=true = %+v, want only the open gateway incident", items)
+	}
+
+	rec = doReq(t, r, http.MethodGet, "/incidents/inc-1", "tok", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/incidents/inc-1 = %d, want 200", rec.Code)
+	}
+	var inc Incident
+	if err := json.Unmarshal(rec.Body.Bytes(), &inc); err != nil {
+		t.Fatalf("incident body is not JSON: %v", err)
+	}
+	if inc.Service != "database" || inc.DowntimeSeconds != 60 {
+		t.Errorf("inc-1 = %+v, want closed database incident with 60s downtime", inc)
+	}
+
+	if rec := doReq(t, r, http.MethodGet, "/incidents/inc-99", "tok", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown incident id = %d, want 404", rec.Code)
+	}
+}
+
+func TestIncidentNotes(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk))
+	r := buildRouter(hs, "tok")
+
+	hs.SetServiceStatus("database", false)
+
+	// Notes are writes: full token gate.
+	if rec := doReq(t, r, http.MethodPost, "/incidents/inc-1/notes", "", `{"text":"x"}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated note = %d, want 401", rec.Code)
+	}
+
+	rec := doReq(t, r, http.MethodPost, "/incidents/inc-1/notes", "tok", `{"text":"restarted the pod\nline2"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("note = %d, want 200", rec.Code)
+	}
+	var inc Incident
+	if err := json.Unmarshal(rec.Body.Bytes(), &inc); err != nil {
+		t.Fatalf("note response is not JSON: %v", err)
+	}
+	if len(inc.Notes) != 1 {
+		t.Fatalf("notes = %d, want 1", len(inc.Notes))
+	}
+	// Note text goes through the service-message sanitizer (no raw newlines).
+	if inc.Notes[0].Text == "restarted the pod\nline2" {
+		t.Error("note text stored unsanitized")
+	}
+	if inc.Notes[0].At == "" {
+		t.Error("note timestamp missing")
+	}
+
+	if rec := doReq(t, r, http.MethodPost, "/incidents/inc-99/notes", "tok", `{"text":"x"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("note on unknown incident = %d, want 404", rec.Code)
+	}
+	if rec := doReq(t, r, http.MethodPost, "/incidents/inc-1/notes", "tok", `{"text":"  "}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("blank note = %d, want 400", rec.Code)
+	}
+	if rec := doReq(t, r, http.MethodPost, "/incidents/inc-1/notes", "tok", `{"text":`); rec.Code != http.StatusBadRequest {
+		t.Errorf("malformed note body = %d, want 400", rec.Code)
+	}
+}
+
+func TestIncidentEnvParsing(t *testing.T) {
+	tests := []struct {
+		name, cap, debounce string
+		wantCap             int
+		wantDebounce        time.Duration
+	}{
+		{"defaults", "", "", defaultIncidentCap, defaultIncidentDebounce},
+		{"valid", "50", "120", 50, 120 * time.Second},
+		{"zero debounce valid", "50", "0", 50, 0},
+		{"invalid falls back", "0", "-5", defaultIncidentCap, defaultIncidentDebounce},
+		{"garbage falls back", "many", "soon", defaultIncidentCap, defaultIncidentDebounce},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_INCIDENTS", tt.cap)
+			t.Setenv("INCIDENT_DEBOUNCE_SECONDS", tt.debounce)
+			if got := maxIncidentsFromEnv(); got != tt.wantCap {
+				t.Errorf("maxIncidentsFromEnv() = %d, want %d", got, tt.wantCap)
+			}
+			if got := incidentDebounceFromEnv(); got != tt.wantDebounce {
+				t.Errorf("incidentDebounceFromEnv() = %s, want %s", got, tt.wantDebounce)
+			}
+		})
+	}
+}
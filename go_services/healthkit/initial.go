@@ -0,0 +1,183 @@
+package healthkit
+
+// Configurable initial service map with an explicit "unknown" state. The
+// health_api binary used to hardcode bot/database/gemini_api as healthy at
+// startup, which was wrong twice over: deployments without Gemini showed a
+// green gemini_api that nothing ever updated, and every seeded service
+// claimed "healthy" before anything had actually reported. INITIAL_SERVICES
+// (comma-separated names, each optionally suffixed ":unknown") or
+// INITIAL_SERVICES_FILE (same syntax, newlines allowed, # comments) replaces
+// the hardcoded list; the binary's historical trio survives only as the
+// fallback when neither is configured.
+//
+// "unknown" is a third state alongside healthy/unhealthy: the service is
+// expected but has not reported yet. Unknown does NOT count as unhealthy —
+// the aggregate stays healthy and the services map simply omits the name —
+// but it renders distinctly as unknown_services in /health, and a service
+// still unknown past UNKNOWN_SERVICE_GRACE_SECONDS degrades readiness with a
+// "service_unknown:<name>" reason: at that point "hasn't reported" has
+// stopped meaning "still starting" and started meaning "never wired up". The
+// first real report (any path — POST, batch, heartbeat) promotes the service
+// out of unknown permanently.
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// initialService is one parsed INITIAL_SERVICES entry.
+type initialService struct {
+	name    string
+	unknown bool
+}
+
+// parseInitialServices parses the comma/newline-separated list. Invalid
+// entries (bad suffix, out-of-bounds name) are dropped with a warning rather
+// than failing the whole list — the usual fail-safe env posture.
+func parseInitialServices(raw string) []initialService {
+	var specs []initialService
+	for _, entry := range strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == '\n'
+	}) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		spec := initialService{name: entry}
+		if name, suffix, found := strings.Cut(entry, ":"); found {
+			if suffix != "unknown" {
+				log.Printf("WARNING: invalid INITIAL_SERVICES entry %q (suffix must be :unknown) — skipping", entry)
+				continue
+			}
+			spec = initialService{name: name, unknown: true}
+		}
+		if len(spec.name) == 0 || len(spec.name) > 100 {
+			log.Printf("WARNING: invalid INITIAL_SERVICES entry %q (name must be 1-100 characters) — skipping", entry)
+			continue
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// initialServicesFromEnv resolves the configured initial service list.
+// INITIAL_SERVICES wins when set (even set-to-empty, which deliberately
+// seeds nothing); INITIAL_SERVICES_FILE is the fallback. configured reports
+// whether either source was present, so the caller can tell "no config" from
+// "explicitly empty".
+func initialServicesFromEnv() (specs []initialService, configured bool) {
+	if raw, ok := os.LookupEnv("INITIAL_SERVICES"); ok {
+		return parseInitialServices(raw), true
+	}
+	path := strings.TrimSpace(os.Getenv("INITIAL_SERVICES_FILE"))
+	if path == "" {
+		return nil, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("WARNING: could not read INITIAL_SERVICES_FILE %s: %v — seeding defaults", path, err)
+		return nil, false
+	}
+	return parseInitialServices(string(data)), true
+}
+
+// unknownGraceFromEnv reads the UNKNOWN_SERVICE_GRACE_SECONDS startup window.
+// 0 (the default) disables the readiness gate — unknown services then stay
+// visible but never block.
+func unknownGraceFromEnv() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("UNKNOWN_SERVICE_GRACE_SECONDS"))
+	if raw == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Printf("WARNING: invalid UNKNOWN_SERVICE_GRACE_SECONDS %q (must be a non-negative integer) — ignoring", raw)
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+// WithUnknownGrace sets the startup window after which a still-unknown
+// service degrades readiness; non-positive disables the gate.
+func WithUnknownGrace(grace time.Duration) Option {
+	return func(h *Service) {
+		if grace > 0 {
+			h.unknownGrace = grace
+		}
+	}
+}
+
+// SeedInitialServices seeds the service map from the environment, falling
+// back to the given defaults (seeded healthy, the historical behavior) when
+// no INITIAL_SERVICES config is present. Binaries call this once after New,
+// passing whatever their hardcoded list used to be.
+func (h *Service) SeedInitialServices(defaults ...string) {
+	specs, configured := initialServicesFromEnv()
+	if !configured {
+		for _, name := range defaults {
+			specs = append(specs, initialService{name: name})
+		}
+	}
+	for _, spec := range specs {
+		if spec.unknown {
+			h.MarkServiceUnknown(spec.name)
+		} else {
+			h.SetServiceStatus(spec.name, true)
+		}
+	}
+}
+
+// MarkServiceUnknown declares a service as expected-but-unreported. A
+// service that has already reported keeps its real state — unknown never
+// overwrites truth. Counts against the same map cap as real services.
+func (h *Service) MarkServiceUnknown(name string) bool {
+	if len(name) == 0 || len(name) > 100 {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, exists := h.services[name]; exists {
+		return false
+	}
+	if _, exists := h.unknownServices[name]; !exists &&
+		len(h.services)+len(h.unknownServices) >= h.maxServices {
+		log.Printf("WARNING: service map full (%d), rejecting unknown service: %s", h.maxServices, name)
+		h.metrics.serviceRegistrationsRejected.Inc()
+		return false
+	}
+	h.unknownServices[name] = h.clock.Now()
+	return true
+}
+
+// unknownNamesLocked returns the sorted unknown set. Caller holds mu.
+func (h *Service) unknownNamesLocked() []string {
+	if len(h.unknownServices) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(h.unknownServices))
+	for name := range h.unknownServices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// staleUnknownLocked returns the sorted services unknown for longer than the
+// configured grace; empty when the gate is disabled. Caller holds mu.
+func (h *Service) staleUnknownLocked(now time.Time) []string {
+	if h.unknownGrace <= 0 {
+		return nil
+	}
+	var stale []string
+	for name, since := range h.unknownServices {
+		if !now.Before(since.Add(h.unknownGrace)) {
+			stale = append(stale, name)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
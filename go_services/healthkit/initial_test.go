@@ -0,0 +1,234 @@
+package healthkit
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseInitialServices(t *testing.T) {
+	tests := []struct {
+		name, raw string
+		want      []initialService
+	}{
+		{"empty", "", nil},
+		{"plain list", "bot,database", []initialService{{name: "bot"}, {name: "database"}}},
+		{"unknown suffix", "bot,redis:unknown", []initialService{{name: "bot"}, {name: "redis", unknown: true}}},
+		{"whitespace and blanks", " bot , ,database ", []initialService{{name: "bot"}, {name: "database"}}},
+		{"newline separated with comment", "bot\n# optional\nredis:unknown\n", []initialService{{name: "bot"}, {name: "redis", unknown: true}}},
+		{"bad suffix skipped", "bot,redis:maybe,database", []initialService{{name: "bot"}, {name: "database"}}},
+		{"empty name skipped", ":unknown,bot", []initialService{{name: "bot"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseInitialServices(tt.raw)
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseInitialServices(%q) = %v, want %v", tt.raw, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("entry %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSeedInitialServices(t *testing.T) {
+	t.Run("defaults when unconfigured", func(t *testing.T) {
+		hs := New(WithVersion("test"))
+		hs.SeedInitialServices("bot", "database")
+		status := hs.GetStatus()
+		if !status.Services["bot"] || !status.Services["database"] || len(status.Services) != 2 {
+			t.Errorf("services = %v, want the two defaults healthy", status.Services)
+		}
+	})
+
+	t.Run("env list with unknown", func(t *testing.T) {
+		t.Setenv("INITIAL_SERVICES", "bot,redis:unknown")
+		hs := New(WithVersion("test"))
+		hs.SeedInitialServices("bot", "database", "gemini_api")
+		status := hs.GetStatus()
+		if len(status.Services) != 1 || !status.Services["bot"] {
+			t.Errorf("services = %v, want only bot", status.Services)
+		}
+		if len(status.UnknownServices) != 1 || status.UnknownServices[0] != "redis" {
+			t.Errorf("unknown = %v, want [redis]", status.UnknownServices)
+		}
+		if status.Status != "healthy" {
+			t.Errorf("status = %q — unknown must not count as unhealthy", status.Status)
+		}
+	})
+
+	t.Run("explicitly empty seeds nothing", func(t *testing.T) {
+		t.Setenv("INITIAL_SERVICES", "")
+		hs := New(WithVersion("test"))
+		hs.SeedInitialServices("bot", "database", "gemini_api")
+		status := hs.GetStatus()
+		if len(status.Services) != 0 || len(status.UnknownServices) != 0 {
+			t.Errorf("services = %v unknown = %v, want both empty", status.Services, status.UnknownServices)
+		}
+	})
+
+	t.Run("file fallback", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "services.conf")
+		if err := os.WriteFile(path, []byte("# seeded\nbot\nredis:unknown\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("INITIAL_SERVICES_FILE", path)
+		hs := New(WithVersion("test"))
+		hs.SeedInitialServices("gemini_api")
+		status := hs.GetStatus()
+		if !status.Services["bot"] || len(status.UnknownServices) != 1 {
+			t.Errorf("services = %v unknown = %v, want the file's entries", status.Services, status.UnknownServices)
+		}
+	})
+
+	t.Run("env wins over file", func(t *testing.T) {
+		t.Setenv("INITIAL_SERVICES", "bot")
+		t.Setenv("INITIAL_SERVICES_FILE", filepath.Join(t.TempDir(), "missing.conf"))
+		hs := New(WithVersion("test"))
+		hs.SeedInitialServices()
+		if status := hs.GetStatus(); len(status.Services) != 1 || !status.Services["bot"] {
+			t.Errorf("services = %v, want only the env's bot", status.Services)
+		}
+	})
+
+	t.Run("unreadable file falls back to defaults", func(t *testing.T) {
+		t.Setenv("INITIAL_SERVICES_FILE", filepath.Join(t.TempDir(), "missing.conf"))
+		hs := New(WithVersion("test"))
+		hs.SeedInitialServices("bot")
+		if status := hs.GetStatus(); !status.Services["bot"] {
+			t.Errorf("services = %v, want the default bot", status.Services)
+		}
+	})
+}
+
+func TestUnknownPromotionAndRendering(t *testing.T) {
+	hs := New(WithVersion("test"))
+	hs.MarkServiceUnknown("redis")
+	hs.SetServiceStatus("bot", true)
+
+	// Unknown renders distinctly and changes the ETag.
+	before := healthStatusETag(hs.GetStatus())
+	if got := hs.GetStatus().UnknownServices; len(got) != 1 || got[0] != "redis" {
+		t.Fatalf("unknown = %v, want [redis]", got)
+	}
+
+	// The first real report — even an unhealthy one — promotes permanently.
+	hs.SetServiceStatus("redis", false)
+	status := hs.GetStatus()
+	if len(status.UnknownServices) != 0 {
+		t.Errorf("unknown after report = %v, want empty", status.UnknownServices)
+	}
+	if v, ok := status.Services["redis"]; !ok || v {
+		t.Errorf("services = %v, want redis present and false", status.Services)
+	}
+	if status.Status != "degraded" {
+		t.Errorf("status = %q, want degraded once redis actually reported unhealthy", status.Status)
+	}
+	if after := healthStatusETag(status); after == before {
+		t.Error("ETag unchanged across the unknown→reported transition")
+	}
+
+	// Unknown never overwrites a reported state.
+	if hs.MarkServiceUnknown("redis") {
+		t.Error("MarkServiceUnknown succeeded on an already-reported service")
+	}
+}
+
+func TestUnknownStartupWindow(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk), WithUnknownGrace(2*time.Minute))
+	hs.SetServiceStatus("bot", true)
+	hs.MarkServiceUnknown("redis")
+
+	// Inside the window: visible but not gating.
+	report := hs.GetReadinessReport()
+	if !report.Ready || len(report.Reasons) != 0 {
+		t.Fatalf("readiness inside window = %v %v, want ready", report.Ready, report.Reasons)
+	}
+
+	// Past the window: readiness degrades with the stable reason, while the
+	// aggregate stays healthy — nothing actually reported unhealthy.
+	clk.Advance(2 * time.Minute)
+	report = hs.GetReadinessReport()
+	if report.Ready {
+		t.Error("readiness past window = ready, want not ready")
+	}
+	if len(report.Reasons) != 1 || report.Reasons[0] != "service_unknown:redis" {
+		t.Errorf("reasons = %v, want [service_unknown:redis]", report.Reasons)
+	}
+	if got := hs.AggregateStatus(); got != "healthy" {
+		t.Errorf("aggregate = %q, want healthy", got)
+	}
+
+	// A late report clears the gate.
+	hs.SetServiceStatus("redis", true)
+	if report := hs.GetReadinessReport(); !report.Ready {
+		t.Errorf("readiness after report = not ready (%v)", report.Reasons)
+	}
+}
+
+func TestUnknownGraceDisabledByDefault(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk))
+	hs.MarkServiceUnknown("redis")
+	clk.Advance(24 * time.Hour)
+	if report := hs.GetReadinessReport(); !report.Ready {
+		t.Errorf("readiness with no grace configured = not ready (%v)", report.Reasons)
+	}
+}
+
+func TestUnknownCountsAgainstServiceCap(t *testing.T) {
+	hs := New(WithVersion("test"), WithMaxServices(1))
+	if !hs.MarkServiceUnknown("redis") {
+		t.Fatal("first unknown seed rejected under cap 1")
+	}
+	if hs.SetServiceStatus("bot", true) {
+		t.Error("new service accepted with the only slot held by an unknown seed")
+	}
+	// Promoting the unknown itself is never rejected — it already holds the
+	// slot.
+	if !hs.SetServiceStatus("redis", true) {
+		t.Error("promotion of the seeded unknown rejected at cap")
+	}
+}
+
+func TestUnknownGraceFromEnv(t *testing.T) {
+	tests := []struct {
+		name, raw string
+		want      time.Duration
+	}{
+		{"unset", "", 0},
+		{"valid", "90", 90 * time.Second},
+		{"zero", "0", 0},
+		{"negative", "-5", 0},
+		{"junk", "soon", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("UNKNOWN_SERVICE_GRACE_SECONDS", tt.raw)
+			if got := unknownGraceFromEnv(); got != tt.want {
+				t.Errorf("unknownGraceFromEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnknownSeedViaHeartbeatPromotes(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+	hs.MarkServiceUnknown("redis")
+
+	rec := doReq(t, r, http.MethodPost, "/health/heartbeat", "tok", `{"services":{"redis":true}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("heartbeat = %d, want 200 (body %s)", rec.Code, rec.Body.String())
+	}
+	status := hs.GetStatus()
+	if len(status.UnknownServices) != 0 || !status.Services["redis"] {
+		t.Errorf("unknown = %v services = %v, want heartbeat promotion", status.UnknownServices, status.Services)
+	}
+}
@@ -0,0 +1,120 @@
+package healthkit
+
+// Source-IP allowlisting for the write endpoints, as a second factor beside
+// the bearer token (or a stopgap where tokens aren't rolled out yet). With
+// TRUSTED_PUSH_CIDRS unset every source is allowed, exactly as before;
+// configured, POSTs from outside the listed networks get a 403 before the
+// body is even read, logged with the offending IP and counted on
+// discord_bot_push_ip_rejected_total (no per-IP label — an internet scanner
+// would turn an IP label into a cardinality bomb; the log line carries the
+// address).
+//
+// X-Forwarded-For is only consulted when TRUST_PROXY=true, and then only the
+// RIGHTMOST entry is used — that's the hop our own proxy appended. The
+// leftmost entries are whatever the client sent and are attacker-controlled;
+// honoring them would let anyone spoof their way into the allowlist with one
+// header. Without TRUST_PROXY the header is ignored entirely and the TCP
+// peer address decides.
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// parseTrustedCIDRs parses a comma-separated CIDR list. Invalid entries are
+// dropped with a warning — dropping can only narrow the allowlist, never
+// widen it, so a typo fails closed.
+func parseTrustedCIDRs(raw string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("WARNING: ignoring invalid TRUSTED_PUSH_CIDRS entry %q: %v", entry, err)
+			continue
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets
+}
+
+// trustedCIDRsFromEnv reads TRUSTED_PUSH_CIDRS; nil disables the check.
+func trustedCIDRsFromEnv() []*net.IPNet {
+	raw := strings.TrimSpace(os.Getenv("TRUSTED_PUSH_CIDRS"))
+	if raw == "" {
+		return nil
+	}
+	nets := parseTrustedCIDRs(raw)
+	if len(nets) == 0 {
+		// Set but nothing parsed: the operator asked for an allowlist and got
+		// none. Warn loudly — every write will now be refused.
+		log.Printf("WARNING: TRUSTED_PUSH_CIDRS is set but contains no valid CIDRs — all write-endpoint sources will be rejected")
+		return []*net.IPNet{}
+	}
+	return nets
+}
+
+// trustProxyFromEnv reads TRUST_PROXY. Anything but exactly "true" means the
+// proxy headers stay untrusted — the fail-safe direction.
+func trustProxyFromEnv() bool {
+	return strings.TrimSpace(os.Getenv("TRUST_PROXY")) == "true"
+}
+
+// WithTrustedPushCIDRs sets the write-endpoint source allowlist; nil keeps
+// the check disabled.
+func WithTrustedPushCIDRs(nets []*net.IPNet, trustProxy bool) Option {
+	return func(h *Service) {
+		h.trustedPushNets = nets
+		h.trustProxy = trustProxy
+	}
+}
+
+// clientIP resolves the source address for allowlisting. The rightmost
+// X-Forwarded-For entry only when the proxy is trusted; the TCP peer
+// otherwise.
+func clientIP(r *http.Request, trustProxy bool) net.IP {
+	if trustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			parts := strings.Split(xff, ",")
+			if ip := net.ParseIP(strings.TrimSpace(parts[len(parts)-1])); ip != nil {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// RemoteAddr without a port (some tests, unix sockets): try as-is.
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// ipAllowMiddleware enforces the allowlist. Installed only on the write
+// group; no-op when unconfigured.
+func (h *Service) ipAllowMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.trustedPushNets == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ip := clientIP(r, h.trustProxy)
+		if ip != nil {
+			for _, ipnet := range h.trustedPushNets {
+				if ipnet.Contains(ip) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+		// Unparseable source counts as outside every network: fail closed.
+		h.metrics.pushIPRejected.Inc()
+		log.Printf("WARNING: write request to %s rejected by IP allowlist (source %v, remote %s)", r.URL.Path, ip, r.RemoteAddr)
+		writeError(w, http.StatusForbidden, errCodeForbidden, "source address not allowed", nil)
+	})
+}
@@ -0,0 +1,135 @@
+package healthkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// doPushFrom posts a valid gauge from a crafted source address.
+func doPushFrom(t *testing.T, r http.Handler, remoteAddr, xff string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/metrics/push",
+		strings.NewReader(`{"type":"gauge","name":"active_connections","value":1}`))
+	req.Header.Set("Authorization", "Bearer tok")
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = remoteAddr
+	if xff != "" {
+		req.Header.Set("X-Forwarded-For", xff)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIPAllowlist(t *testing.T) {
+	tests := []struct {
+		name       string
+		cidrs      string
+		trustProxy bool
+		remoteAddr string
+		xff        string
+		wantCode   int
+	}{
+		{"unconfigured allows anyone", "", false, "203.0.113.9:1234", "", http.StatusOK},
+		{"loopback allowed", "127.0.0.1/32,10.0.3.0/24", false, "127.0.0.1:5000", "", http.StatusOK},
+		{"subnet allowed", "127.0.0.1/32,10.0.3.0/24", false, "10.0.3.77:5000", "", http.StatusOK},
+		{"outside subnet rejected", "127.0.0.1/32,10.0.3.0/24", false, "10.0.4.1:5000", "", http.StatusForbidden},
+		{"public source rejected", "127.0.0.1/32,10.0.3.0/24", false, "203.0.113.9:1234", "", http.StatusForbidden},
+		{"ipv6 cidr works", "fd00::/8", false, "[fd12:3456::1]:9000", "", http.StatusOK},
+		{"ipv6 outside rejected", "fd00::/8", false, "[2001:db8::1]:9000", "", http.StatusForbidden},
+		// Spoofing: XFF is ignored without TRUST_PROXY, so a forged header
+		// can't launder a bad TCP peer...
+		{"xff spoof ignored untrusted", "10.0.3.0/24", false, "203.0.113.9:1234", "10.0.3.5", http.StatusForbidden},
+		// ...and with TRUST_PROXY only the RIGHTMOST hop (appended by our
+		// proxy) counts — the attacker-controlled leftmost entry is noise.
+		{"trusted proxy rightmost hop allowed", "10.0.3.0/24", true, "127.0.0.1:1234", "203.0.113.9, 10.0.3.5", http.StatusOK},
+		{"trusted proxy leftmost spoof rejected", "10.0.3.0/24", true, "127.0.0.1:1234", "10.0.3.5, 203.0.113.9", http.StatusForbidden},
+		{"trusted proxy no header falls back to peer", "127.0.0.0/8", true, "127.0.0.1:1234", "", http.StatusOK},
+		{"garbage xff fails closed", "10.0.3.0/24", true, "127.0.0.1:1234", "not-an-ip", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []Option
+			opts = append(opts, WithVersion("test"))
+			if tt.cidrs != "" {
+				opts = append(opts, WithTrustedPushCIDRs(parseTrustedCIDRs(tt.cidrs), tt.trustProxy))
+			}
+			hs := New(opts...)
+			r := buildRouter(hs, "tok")
+			if rec := doPushFrom(t, r, tt.remoteAddr, tt.xff); rec.Code != tt.wantCode {
+				t.Errorf("push from %s (xff %q) = %d, want %d", tt.remoteAddr, tt.xff, rec.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestIPAllowlistRejectionCounted(t *testing.T) {
+	hs := New(WithVersion("test"), WithTrustedPushCIDRs(parseTrustedCIDRs("127.0.0.1/32"), false))
+	r := buildRouter(hs, "tok")
+
+	doPushFrom(t, r, "203.0.113.9:1234", "")
+	doPushFrom(t, r, "203.0.113.10:1234", "")
+
+	mf := findMetric(t, hs, "discord_bot_push_ip_rejected_total")
+	if mf == nil {
+		t.Fatal("rejection counter not registered")
+	}
+	if got := mf.GetMetric()[0].GetCounter().GetValue(); got != 2 {
+		t.Errorf("rejection counter = %v, want 2", got)
+	}
+	// No per-IP label: the offending address must not become a label value.
+	var metric *dto.Metric = mf.GetMetric()[0]
+	if len(metric.GetLabel()) != 0 {
+		t.Errorf("rejection counter carries labels %v, want none (cardinality)", metric.GetLabel())
+	}
+}
+
+func TestIPAllowlistDoesNotGateReads(t *testing.T) {
+	hs := New(WithVersion("test"), WithTrustedPushCIDRs(parseTrustedCIDRs("127.0.0.1/32"), false))
+	r := buildRouter(hs, "tok")
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.RemoteAddr = "203.0.113.9:1234" // outside the allowlist
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("/health from outside the push allowlist = %d, want 200 (reads unaffected)", rec.Code)
+	}
+}
+
+func TestParseTrustedCIDRs(t *testing.T) {
+	nets := parseTrustedCIDRs("127.0.0.1/32, bogus, 10.0.3.0/24, fd00::/8")
+	if len(nets) != 3 {
+		t.Fatalf("parsed %d CIDRs, want 3 (invalid entry dropped)", len(nets))
+	}
+}
+
+func TestTrustedCIDRsFromEnv(t *testing.T) {
+	t.Setenv("TRUSTED_PUSH_CIDRS", "")
+	if trustedCIDRsFromEnv() != nil {
+		t.Error("unset env did not disable the check")
+	}
+	t.Setenv("TRUSTED_PUSH_CIDRS", "10.0.3.0/24")
+	if nets := trustedCIDRsFromEnv(); len(nets) != 1 {
+		t.Errorf("valid env parsed to %d nets, want 1", len(nets))
+	}
+	// Set-but-garbage must fail CLOSED: non-nil empty list rejects everyone
+	// rather than silently disabling the allowlist the operator asked for.
+	t.Setenv("TRUSTED_PUSH_CIDRS", "not-a-cidr")
+	if nets := trustedCIDRsFromEnv(); nets == nil || len(nets) != 0 {
+		t.Errorf("garbage env = %v, want a non-nil empty list (reject all)", nets)
+	}
+
+	t.Setenv("TRUST_PROXY", "TRUE")
+	if trustProxyFromEnv() {
+		t.Error(`TRUST_PROXY only enables on exactly "true"`)
+	}
+	t.Setenv("TRUST_PROXY", "true")
+	if !trustProxyFromEnv() {
+		t.Error("TRUST_PROXY=true not honored")
+	}
+}
@@ -0,0 +1,172 @@
+package healthkit
+
+// Whole-router load shedding. The write-path shed (shedWrites) only guards
+// the POST endpoints, and http.Server's timeouts only bound individual
+// requests — nothing stopped hundreds of reads from piling up under pressure
+// and failing together when the server finally keeled over. This limiter
+// caps in-flight requests across the router: excess requests queue for a
+// bounded wait and are then shed with 503 + Retry-After, so overload turns
+// into quick, honest rejections instead of a synchronized timeout avalanche.
+// Liveness/readiness probes bypass the limiter entirely — an orchestrator
+// must be able to see "alive but overloaded" rather than killing the pod.
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// defaultMaxConcurrent is the in-flight cap (MAX_INFLIGHT).
+	defaultMaxConcurrent = 256
+	// defaultQueueWait bounds how long an excess request may wait for a slot
+	// before it is shed (MAX_INFLIGHT_WAIT_MS).
+	defaultQueueWait = 2 * time.Second
+)
+
+// ConcurrencyLimiter is the reusable middleware core: a semaphore, a bounded
+// queue wait, and the gauges that make both observable. Build one per process
+// with NewConcurrencyLimiter; healthkit mounts it on its routers and
+// url_fetcher mounts its own under the "url_fetcher" namespace.
+type ConcurrencyLimiter struct {
+	sem      chan struct{}
+	maxWait  time.Duration
+	bypass   map[string]bool
+	inFlight prometheus.Gauge
+	queued   prometheus.Gauge
+	shed     prometheus.Counter
+}
+
+// NewConcurrencyLimiter builds a limiter admitting max concurrent requests,
+// queueing excess ones for at most maxWait. bypassPaths (exact-match URL
+// paths) skip the limiter entirely.
+func NewConcurrencyLimiter(reg prometheus.Registerer, namespace string, max int, maxWait time.Duration, bypassPaths ...string) *ConcurrencyLimiter {
+	f := promauto.With(reg)
+	l := &ConcurrencyLimiter{
+		sem:     make(chan struct{}, max),
+		maxWait: maxWait,
+		bypass:  make(map[string]bool, len(bypassPaths)),
+		inFlight: f.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "concurrency_in_flight",
+			Help:      "Requests currently holding a concurrency slot",
+		}),
+		queued: f.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "concurrency_queued",
+			Help:      "Requests waiting for a concurrency slot",
+		}),
+		shed: f.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "concurrency_shed_total",
+			Help:      "Requests shed after the queue wait expired",
+		}),
+	}
+	for _, p := range bypassPaths {
+		l.bypass[p] = true
+	}
+	return l
+}
+
+// Middleware applies the limiter. The 503 body mirrors the sunset/error
+// envelope convention: machine-readable "reason" plus a human line, and
+// Retry-After tells well-behaved clients when a slot is plausibly free.
+func (l *ConcurrencyLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.bypass[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case l.sem <- struct{}{}:
+			// Fast path: a slot was free.
+		default:
+			// Queue, bounded by maxWait and the client's own context.
+			l.queued.Inc()
+			timer := time.NewTimer(l.maxWait)
+			select {
+			case l.sem <- struct{}{}:
+				l.queued.Dec()
+				timer.Stop()
+			case <-timer.C:
+				l.queued.Dec()
+				l.reject(w)
+				return
+			case <-r.Context().Done():
+				// The client is gone — don't count it as shed load.
+				l.queued.Dec()
+				timer.Stop()
+				return
+			}
+		}
+		defer func() {
+			<-l.sem
+			l.inFlight.Dec()
+		}()
+		l.inFlight.Inc()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reject writes the shed response.
+func (l *ConcurrencyLimiter) reject(w http.ResponseWriter) {
+	l.shed.Inc()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(int((l.maxWait+time.Second-1)/time.Second)))
+	writeError(w, http.StatusServiceUnavailable, "overloaded",
+		"server overloaded, request shed after queue wait", nil)
+}
+
+// WithMaxConcurrent overrides the router-wide in-flight cap.
+func WithMaxConcurrent(n int) Option {
+	return func(h *Service) { h.maxConcurrent = n }
+}
+
+// WithQueueWait overrides how long excess requests wait for a slot.
+func WithQueueWait(d time.Duration) Option {
+	return func(h *Service) { h.queueWait = d }
+}
+
+// ConcurrencyLimiterFromEnv builds a limiter from the MAX_INFLIGHT /
+// MAX_INFLIGHT_WAIT_MS env contract. Exported for the url_fetcher binary,
+// which mounts the same middleware on its own router and registry.
+func ConcurrencyLimiterFromEnv(reg prometheus.Registerer, namespace string, bypassPaths ...string) *ConcurrencyLimiter {
+	return NewConcurrencyLimiter(reg, namespace, maxConcurrentFromEnv(), queueWaitFromEnv(), bypassPaths...)
+}
+
+// maxConcurrentFromEnv reads MAX_INFLIGHT (distinct from WRITE_MAX_INFLIGHT,
+// which caps only the POST shed).
+func maxConcurrentFromEnv() int {
+	raw := strings.TrimSpace(os.Getenv("MAX_INFLIGHT"))
+	if raw == "" {
+		return defaultMaxConcurrent
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("WARNING: invalid MAX_INFLIGHT %q (must be a positive integer) — using default %d", raw, defaultMaxConcurrent)
+		return defaultMaxConcurrent
+	}
+	return n
+}
+
+// queueWaitFromEnv reads MAX_INFLIGHT_WAIT_MS.
+func queueWaitFromEnv() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("MAX_INFLIGHT_WAIT_MS"))
+	if raw == "" {
+		return defaultQueueWait
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("WARNING: invalid MAX_INFLIGHT_WAIT_MS %q (must be a positive integer) — using default %s", raw, defaultQueueWait)
+		return defaultQueueWait
+	}
+	return time.Duration(n) * time.Millisecond
+}
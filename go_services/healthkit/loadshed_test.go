@@ -0,0 +1,173 @@
+package healthkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// shedFixture mounts a limiter over one slow route and one probe route. The
+// slow handler blocks until release is closed; entered receives once per
+// request that made it into the handler.
+func shedFixture(maxConcurrent int, wait time.Duration) (l *ConcurrencyLimiter, r chi.Router, entered chan struct{}, release chan struct{}) {
+	l = NewConcurrencyLimiter(prometheus.NewRegistry(), "test", maxConcurrent, wait, "/health/live")
+	r = chi.NewRouter()
+	r.Use(l.Middleware)
+	entered = make(chan struct{}, 16)
+	release = make(chan struct{})
+	r.Get("/slow", func(w http.ResponseWriter, _ *http.Request) {
+		entered <- struct{}{}
+		<-release
+	})
+	r.Get("/health/live", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("OK"))
+	})
+	return l, r, entered, release
+}
+
+func TestConcurrencyLimiter_ShedsWithRetryAfter(t *testing.T) {
+	l, r, entered, release := shedFixture(2, 50*time.Millisecond)
+	defer close(release)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+		}()
+	}
+	<-entered
+	<-entered
+	if got := testutil.ToFloat64(l.inFlight); got != 2 {
+		t.Errorf("in-flight gauge = %v, want 2", got)
+	}
+
+	// Third request: queues for 50ms, then shed.
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("saturated request = %d, want 503", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want %q (50ms wait rounded up)", got, "1")
+	}
+	if env := decodeErrorEnvelope(t, rec); env.Code != "overloaded" {
+		t.Errorf("code = %q, want overloaded", env.Code)
+	}
+	if got := testutil.ToFloat64(l.shed); got != 1 {
+		t.Errorf("shed counter = %v, want 1", got)
+	}
+}
+
+func TestConcurrencyLimiter_QueueAdmitsWhenSlotFrees(t *testing.T) {
+	l, r, entered, release := shedFixture(1, 2*time.Second)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	}()
+	<-entered
+
+	// Second request queues behind the first.
+	secondDone := make(chan int, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		secondDone <- rec.Code
+	}()
+
+	// Wait until it is visibly queued, then free the slot.
+	deadline := time.After(time.Second)
+	for testutil.ToFloat64(l.queued) != 1 {
+		select {
+		case <-deadline:
+			t.Fatal("second request never appeared in the queued gauge")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	close(release)
+	<-entered
+	if code := <-secondDone; code != http.StatusOK {
+		t.Errorf("queued request = %d, want 200 after a slot freed", code)
+	}
+	wg.Wait()
+	if got := testutil.ToFloat64(l.queued); got != 0 {
+		t.Errorf("queued gauge = %v after drain, want 0", got)
+	}
+	if got := testutil.ToFloat64(l.inFlight); got != 0 {
+		t.Errorf("in-flight gauge = %v after drain, want 0", got)
+	}
+}
+
+func TestConcurrencyLimiter_ProbesBypass(t *testing.T) {
+	_, r, entered, release := shedFixture(1, 10*time.Millisecond)
+	defer close(release)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	}()
+	<-entered
+
+	// Saturated — but the probe answers immediately.
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "OK" {
+		t.Errorf("probe during saturation = %d %q, want 200 OK", rec.Code, rec.Body.String())
+	}
+}
+
+func TestServiceRoutes_ProbeBypassWiring(t *testing.T) {
+	hs := New(WithVersion("test"), WithMaxConcurrent(1), WithQueueWait(10*time.Millisecond))
+	r := hs.Routes()
+
+	// Occupy the only slot directly, as a stuck handler would.
+	hs.limiter.sem <- struct{}{}
+	defer func() { <-hs.limiter.sem }()
+
+	if rec := doReq(t, r, http.MethodGet, "/health/live", "", ""); rec.Code != http.StatusOK {
+		t.Errorf("/health/live under saturation = %d, want 200 (bypass)", rec.Code)
+	}
+	rec := doReq(t, r, http.MethodGet, "/health", "", "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("/health under saturation = %d, want 503 (shed)", rec.Code)
+	}
+}
+
+func TestConcurrencyEnvParsing(t *testing.T) {
+	tests := []struct {
+		name     string
+		max      string
+		wait     string
+		wantMax  int
+		wantWait time.Duration
+	}{
+		{"defaults", "", "", defaultMaxConcurrent, defaultQueueWait},
+		{"valid overrides", "32", "500", 32, 500 * time.Millisecond},
+		{"garbage falls back", "lots", "soon", defaultMaxConcurrent, defaultQueueWait},
+		{"non-positive falls back", "0", "-1", defaultMaxConcurrent, defaultQueueWait},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_INFLIGHT", tt.max)
+			t.Setenv("MAX_INFLIGHT_WAIT_MS", tt.wait)
+			if got := maxConcurrentFromEnv(); got != tt.wantMax {
+				t.Errorf("maxConcurrentFromEnv() = %d, want %d", got, tt.wantMax)
+			}
+			if got := queueWaitFromEnv(); got != tt.wantWait {
+				t.Errorf("queueWaitFromEnv() = %v, want %v", got, tt.wantWait)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package healthkit
+
+// Structured request logging. chi's middleware.Logger writes human-oriented
+// lines the log pipeline can't parse, and nothing correlated a request here
+// with the Python caller that made it. RequestLogger emits exactly one
+// slog record per request — method, path, status, duration_ms, bytes,
+// remote_addr, request_id — honoring an incoming X-Request-ID (so the Python
+// side's ID flows through) or generating one, and echoing it back in the
+// response header either way. LOG_LEVEL / LOG_FORMAT pick the level and the
+// json/text rendering, with the usual fail-safe env posture.
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// requestIDHeader carries the correlation ID in both directions.
+const requestIDHeader = "X-Request-ID"
+
+// validRequestIDRe bounds what we accept from the wire: an unconstrained
+// echo of attacker-controlled bytes into logs and response headers is a
+// log-injection lever. Anything failing this gets a generated ID instead.
+var validRequestIDRe = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type requestIDContextKey struct{}
+
+// newRequestID returns a 16-hex-char random ID. crypto/rand failure is
+// next to impossible; degrade to a constant marker rather than panicking in
+// the middleware path.
+func newRequestID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "unavailable"
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// RequestIDFromContext returns the request's correlation ID, or "" outside a
+// RequestLogger-wrapped request.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// parseLogLevel maps LOG_LEVEL to a slog level; unknown values warn and keep
+// info (fail-safe — a typo must not silence the logs).
+func parseLogLevel(raw string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "", "info":
+		return slog.LevelInfo
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		log.Printf("WARNING: invalid LOG_LEVEL %q (must be debug, info, warn, or error) — using info", raw)
+		return slog.LevelInfo
+	}
+}
+
+// newLogger builds the slog logger for a sink, level and format. format
+// "text" gets the human-readable handler; everything else (including the
+// empty default) is JSON, the shape the log pipeline ingests.
+func newLogger(w io.Writer, level slog.Level, format string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts))
+	case "", "json":
+		return slog.New(slog.NewJSONHandler(w, opts))
+	default:
+		log.Printf("WARNING: invalid LOG_FORMAT %q (must be json or text) — using json", format)
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+}
+
+// loggerFromEnv builds the logger from LOG_LEVEL / LOG_FORMAT.
+func loggerFromEnv() *slog.Logger {
+	return newLogger(os.Stderr, parseLogLevel(os.Getenv("LOG_LEVEL")), os.Getenv("LOG_FORMAT"))
+}
+
+// WithLogger sets the structured logger used by the request middleware and
+// the handlers' rejection logs; nil is ignored.
+func WithLogger(logger *slog.Logger) Option {
+	return func(h *Service) {
+		if logger != nil {
+			h.logger = logger
+		}
+	}
+}
+
+// RequestLogger is the chi middleware replacing middleware.Logger: one
+// structured record per request, with the correlation ID resolved first so
+// handlers (and their own log lines) can read it from the context.
+func RequestLogger(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := r.Header.Get(requestIDHeader)
+			if !validRequestIDRe.MatchString(requestID) {
+				requestID = newRequestID()
+			}
+			w.Header().Set(requestIDHeader, requestID)
+			ctx := context.WithValue(r.Context(), requestIDContextKey{}, requestID)
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			start := time.Now()
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			logger.LogAttrs(ctx, slog.LevelInfo, "request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", ww.Status()),
+				slog.Int64("duration_ms", time.Since(start).Milliseconds()),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.String("remote_addr", r.RemoteAddr),
+				slog.String("request_id", requestID),
+			)
+		})
+	}
+}
+
+// logPushRejection records a rejected metrics push at warn level with its
+// stable reason, correlated to the request that carried it.
+func (h *Service) logPushRejection(ctx context.Context, endpoint, reason string) {
+	h.config().Logger.LogAttrs(ctx, slog.LevelWarn, "metrics push rejected",
+		slog.String("endpoint", endpoint),
+		slog.String("reason", reason),
+		slog.String("request_id", RequestIDFromContext(ctx)),
+	)
+}
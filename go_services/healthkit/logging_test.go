@@ -0,0 +1,209 @@
+package healthkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// captureLogger returns a Service logging JSON records into the buffer.
+func captureLogger(t *testing.T) (*Service, *bytes.Buffer) {
+	t.Helper()
+	var buf bytes.Buffer
+	hs := New(WithVersion("test"),
+		WithLogger(slog.New(slog.NewJSONHandler(&buf, nil))))
+	return hs, &buf
+}
+
+// logRecords decodes every JSON record the buffer captured.
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("non-JSON log line %q: %v", line, err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestRequestLogger_EmitsStructuredRecord(t *testing.T) {
+	hs, buf := captureLogger(t)
+	r := hs.Routes()
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set(requestIDHeader, "py-abc.123")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(requestIDHeader); got != "py-abc.123" {
+		t.Errorf("response %s = %q, want the inbound ID echoed", requestIDHeader, got)
+	}
+
+	records := logRecords(t, buf)
+	if len(records) != 1 {
+		t.Fatalf("got %d log records, want exactly 1 per request", len(records))
+	}
+	entry := records[0]
+	for _, field := range []string{"method", "path", "status", "duration_ms", "bytes", "remote_addr", "request_id"} {
+		if _, ok := entry[field]; !ok {
+			t.Errorf("log record missing %q: %v", field, entry)
+		}
+	}
+	if entry["method"] != "GET" || entry["path"] != "/health" {
+		t.Errorf("method/path = %v/%v", entry["method"], entry["path"])
+	}
+	if entry["status"] != float64(http.StatusOK) {
+		t.Errorf("status = %v, want 200", entry["status"])
+	}
+	if entry["request_id"] != "py-abc.123" {
+		t.Errorf("request_id = %v, want the inbound ID", entry["request_id"])
+	}
+	if entry["bytes"] == float64(0) {
+		t.Error("bytes = 0 for a JSON body response")
+	}
+}
+
+func TestRequestLogger_GeneratesAndRejectsIDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		inbound string
+	}{
+		{"absent header", ""},
+		{"oversized", strings.Repeat("a", 65)},
+		{"unsafe characters", "id with\nnewline"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hs, buf := captureLogger(t)
+			r := hs.Routes()
+			req := httptest.NewRequest(http.MethodGet, "/health/live", nil)
+			if tt.inbound != "" {
+				req.Header.Set(requestIDHeader, strings.ReplaceAll(tt.inbound, "\n", "_")) // net/http rejects raw newlines; the regexp still must
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			got := rec.Header().Get(requestIDHeader)
+			if tt.name == "oversized" && got == tt.inbound {
+				t.Error("oversized inbound ID echoed instead of replaced")
+			}
+			if !validRequestIDRe.MatchString(got) {
+				t.Errorf("response ID %q is not a valid generated ID", got)
+			}
+			records := logRecords(t, buf)
+			if len(records) != 1 || records[0]["request_id"] != got {
+				t.Errorf("log request_id %v does not match header %q", records[0]["request_id"], got)
+			}
+		})
+	}
+}
+
+func TestPushRejection_LoggedAtWarn(t *testing.T) {
+	hs, buf := captureLogger(t)
+	r := buildRouter(hs, "push-token")
+
+	rec := doReq(t, r, http.MethodPost, "/metrics/push", "push-token",
+		`{"name":"no_such_metric","type":"counter_inc","labels":{}}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("push: code = %d, want 400", rec.Code)
+	}
+
+	var warn map[string]any
+	for _, entry := range logRecords(t, buf) {
+		if entry["level"] == "WARN" {
+			warn = entry
+			break
+		}
+	}
+	if warn == nil {
+		t.Fatal("no WARN record for the rejected push")
+	}
+	if warn["reason"] != reasonUnknownName {
+		t.Errorf("warn reason = %v, want %q", warn["reason"], reasonUnknownName)
+	}
+	if warn["endpoint"] != "/metrics/push" {
+		t.Errorf("warn endpoint = %v", warn["endpoint"])
+	}
+}
+
+func TestBatchRejection_OneWarnPerReason(t *testing.T) {
+	hs, buf := captureLogger(t)
+	r := buildRouter(hs, "push-token")
+
+	body := `[{"name":"bad_one","type":"counter_inc","labels":{}},` +
+		`{"name":"bad_two","type":"counter_inc","labels":{}},` +
+		`{"name":"requests","type":"bogus_type","labels":{}}]`
+	rec := doReq(t, r, http.MethodPost, "/metrics/batch", "push-token", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("batch: code = %d", rec.Code)
+	}
+
+	reasons := make(map[string]int)
+	for _, entry := range logRecords(t, buf) {
+		if entry["level"] == "WARN" {
+			reasons[entry["reason"].(string)]++
+		}
+	}
+	if reasons[reasonUnknownName] != 1 {
+		t.Errorf("unknown_name warned %d times, want 1 (deduplicated)", reasons[reasonUnknownName])
+	}
+	if reasons[reasonUnknownType] != 1 {
+		t.Errorf("unknown_type warned %d times, want 1", reasons[reasonUnknownType])
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want slog.Level
+	}{
+		{"", slog.LevelInfo},
+		{"debug", slog.LevelDebug},
+		{"INFO", slog.LevelInfo},
+		{"warn", slog.LevelWarn},
+		{"warning", slog.LevelWarn},
+		{"error", slog.LevelError},
+		{"verbose", slog.LevelInfo},
+	}
+	for _, tt := range tests {
+		if got := parseLogLevel(tt.raw); got != tt.want {
+			t.Errorf("parseLogLevel(%q) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestNewLogger_Formats(t *testing.T) {
+	var buf bytes.Buffer
+	newLogger(&buf, slog.LevelInfo, "json").Info("hello")
+	if !strings.HasPrefix(buf.String(), "{") {
+		t.Errorf("json format produced %q", buf.String())
+	}
+
+	buf.Reset()
+	newLogger(&buf, slog.LevelInfo, "text").Info("hello")
+	if strings.HasPrefix(buf.String(), "{") {
+		t.Errorf("text format produced JSON: %q", buf.String())
+	}
+
+	buf.Reset()
+	newLogger(&buf, slog.LevelWarn, "json").Info("suppressed")
+	if buf.Len() != 0 {
+		t.Errorf("info record emitted at warn level: %q", buf.String())
+	}
+
+	buf.Reset()
+	newLogger(&buf, slog.LevelInfo, "yaml").Info("fallback")
+	if !strings.HasPrefix(buf.String(), "{") {
+		t.Errorf("unknown format should fall back to json, got %q", buf.String())
+	}
+}
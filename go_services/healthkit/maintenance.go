@@ -0,0 +1,144 @@
+package healthkit
+
+// Maintenance mode: during a planned deploy the operator wants /health/ready
+// to answer 503 ON PURPOSE so the load balancer drains the instance, without
+// faking a service failure (which would page someone). While enabled,
+// /health reports status "maintenance" and readiness fails with a stable
+// reason; /health/live stays 200 — the process is alive, it is just asking
+// not to receive traffic. An optional `until` timestamp auto-expires the
+// window, so a forgotten toggle can't drain an instance forever.
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// maintenanceStatus is the /health status string while maintenance is on.
+const maintenanceStatus = "maintenance"
+
+// MaintenanceInfo is the maintenance state as shown in /health and echoed by
+// POST /admin/maintenance.
+type MaintenanceInfo struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason,omitempty"`
+	Until   string `json:"until,omitempty"` // RFC3339 UTC; empty = manual disable only
+}
+
+// SetMaintenance enables or disables maintenance mode. reason is sanitized
+// like every operator-supplied note; a zero until means the mode holds until
+// explicitly disabled.
+func (h *Service) SetMaintenance(enabled bool, reason string, until time.Time) {
+	h.mu.Lock()
+	h.maintEnabled = enabled
+	h.maintReason = sanitizeServiceMessage(reason)
+	h.maintUntil = until
+	if !enabled {
+		h.maintReason = ""
+		h.maintUntil = time.Time{}
+	}
+	h.mu.Unlock()
+	if enabled {
+		h.metrics.maintenanceMode.Set(1)
+	} else {
+		h.metrics.maintenanceMode.Set(0)
+	}
+}
+
+// expireMaintenance lazily ends an expired maintenance window. Called on the
+// status read path rather than from a sweeper: expiry only matters at the
+// moment somebody asks, and the read-first check keeps the unauthenticated
+// /health hot path on the RLock except for the single expiring read.
+func (h *Service) expireMaintenance() {
+	now := h.clock.Now()
+	h.mu.RLock()
+	expired := h.maintEnabled && !h.maintUntil.IsZero() && now.After(h.maintUntil)
+	h.mu.RUnlock()
+	if !expired {
+		return
+	}
+	h.mu.Lock()
+	// Re-check under the write lock — a concurrent toggle may have raced us.
+	if h.maintEnabled && !h.maintUntil.IsZero() && now.After(h.maintUntil) {
+		h.maintEnabled = false
+		h.maintReason = ""
+		h.maintUntil = time.Time{}
+		h.mu.Unlock()
+		h.metrics.maintenanceMode.Set(0)
+		log.Printf("Maintenance window expired — readiness gating lifted")
+		return
+	}
+	h.mu.Unlock()
+}
+
+// maintenanceInfoLocked builds the /health view; caller holds mu (read or
+// write). nil when maintenance is off, so the field stays out of the JSON.
+func (h *Service) maintenanceInfoLocked() *MaintenanceInfo {
+	if !h.maintEnabled {
+		return nil
+	}
+	info := &MaintenanceInfo{Enabled: true, Reason: h.maintReason}
+	if !h.maintUntil.IsZero() {
+		info.Until = formatTimestamp(h.maintUntil)
+	}
+	return info
+}
+
+// handleMaintenance serves POST /admin/maintenance: {enabled, reason, until}.
+// until, when present, must be RFC3339 and in the future — an already-past
+// window would enable and instantly expire, which is always a client bug.
+func (h *Service) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	body, err := requestBody(w, r, 1<<14) // 16KB
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, err.Error(), nil)
+		return
+	}
+
+	var payload struct {
+		Enabled bool   `json:"enabled"`
+		Reason  string `json:"reason"`
+		Until   string `json:"until"`
+	}
+	if err := json.NewDecoder(body).Decode(&payload); err != nil {
+		h.decodeBodyError(w, r, err)
+		return
+	}
+
+	var until time.Time
+	if payload.Enabled && payload.Until != "" {
+		until, err = time.Parse(time.RFC3339, payload.Until)
+		if err != nil || !until.After(h.clock.Now()) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			if err := json.NewEncoder(w).Encode(map[string]any{
+				"error":  "until must be RFC3339 and in the future",
+				"reason": "invalid_until",
+			}); err != nil {
+				log.Printf("Failed to encode maintenance rejection: %v", err)
+			}
+			return
+		}
+	}
+
+	h.SetMaintenance(payload.Enabled, payload.Reason, until)
+	if payload.Enabled {
+		log.Printf("Maintenance mode ENABLED (reason: %q, until: %q) — readiness now fails on purpose",
+			payload.Reason, payload.Until)
+	} else {
+		log.Printf("Maintenance mode disabled")
+	}
+
+	// Echo the applied state so the caller sees the sanitized reason and
+	// normalized timestamp it will find in /health.
+	h.mu.RLock()
+	info := h.maintenanceInfoLocked()
+	h.mu.RUnlock()
+	if info == nil {
+		info = &MaintenanceInfo{Enabled: false}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		log.Printf("Failed to encode maintenance response: %v", err)
+	}
+}
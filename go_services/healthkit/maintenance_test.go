@@ -0,0 +1,126 @@
+package healthkit
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMaintenance_EnableDisable(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+
+	w := doReq(t, r, http.MethodPost, "/admin/maintenance", "tok",
+		`{"enabled":true,"reason":"deploying v3.6"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("enable: HTTP %d: %s", w.Code, w.Body.String())
+	}
+
+	st := hs.GetStatus()
+	if st.Status != maintenanceStatus {
+		t.Errorf("status = %q, want %q", st.Status, maintenanceStatus)
+	}
+	if st.Maintenance == nil || !st.Maintenance.Enabled || st.Maintenance.Reason != "deploying v3.6" {
+		t.Errorf("maintenance info = %+v", st.Maintenance)
+	}
+	if got := testutil.ToFloat64(hs.metrics.maintenanceMode); got != 1 {
+		t.Errorf("gauge = %v, want 1", got)
+	}
+
+	// Readiness fails with the stable reason; liveness stays 200.
+	w = doReq(t, r, http.MethodGet, "/health/ready", "", "")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("/health/ready: HTTP %d, want 503", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "maintenance:deploying v3.6") {
+		t.Errorf("readiness body %q lacks the maintenance reason", w.Body.String())
+	}
+	w = doReq(t, r, http.MethodGet, "/health/live", "", "")
+	if w.Code != http.StatusOK {
+		t.Errorf("/health/live: HTTP %d, want 200 — liveness must be unaffected", w.Code)
+	}
+
+	// Disable restores normal readiness.
+	w = doReq(t, r, http.MethodPost, "/admin/maintenance", "tok", `{"enabled":false}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("disable: HTTP %d: %s", w.Code, w.Body.String())
+	}
+	if st := hs.GetStatus(); st.Status != "healthy" || st.Maintenance != nil {
+		t.Errorf("after disable: status=%q maintenance=%+v", st.Status, st.Maintenance)
+	}
+	if w := doReq(t, r, http.MethodGet, "/health/ready", "", ""); w.Code != http.StatusOK {
+		t.Errorf("/health/ready after disable: HTTP %d, want 200", w.Code)
+	}
+	if got := testutil.ToFloat64(hs.metrics.maintenanceMode); got != 0 {
+		t.Errorf("gauge = %v, want 0", got)
+	}
+}
+
+func TestMaintenance_AutoExpiry(t *testing.T) {
+	fc := newFakeClock(time.Unix(1000, 0))
+	hs := New(WithVersion("test"), WithClock(fc))
+
+	hs.SetMaintenance(true, "window", fc.Now().Add(10*time.Minute))
+	if st := hs.GetStatus(); st.Status != maintenanceStatus {
+		t.Fatalf("status = %q, want %q", st.Status, maintenanceStatus)
+	}
+	if st := hs.GetStatus(); st.Maintenance.Until == "" {
+		t.Error("until missing from maintenance info")
+	}
+
+	// Still inside the window.
+	fc.Advance(9 * time.Minute)
+	if st := hs.GetStatus(); st.Status != maintenanceStatus {
+		t.Fatal("maintenance ended before its window")
+	}
+
+	// Past the window: the next status read expires it.
+	fc.Advance(2 * time.Minute)
+	if st := hs.GetStatus(); st.Status != "healthy" || st.Maintenance != nil {
+		t.Errorf("after expiry: status=%q maintenance=%+v", st.Status, st.Maintenance)
+	}
+	if got := testutil.ToFloat64(hs.metrics.maintenanceMode); got != 0 {
+		t.Errorf("gauge = %v after expiry, want 0", got)
+	}
+	if !hs.GetReadinessReport().Ready {
+		t.Error("readiness should recover after expiry")
+	}
+}
+
+func TestMaintenance_InvalidUntil(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+
+	for _, body := range []string{
+		`{"enabled":true,"until":"not-a-time"}`,
+		`{"enabled":true,"until":"2001-01-01T00:00:00Z"}`, // already past
+	} {
+		w := doReq(t, r, http.MethodPost, "/admin/maintenance", "tok", body)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_until") {
+			t.Errorf("body %s: HTTP %d %s, want 400 invalid_until", body, w.Code, w.Body.String())
+		}
+	}
+	if hs.GetStatus().Status != "healthy" {
+		t.Error("rejected toggles must not enable maintenance")
+	}
+}
+
+func TestMaintenance_RequiresAuth(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+
+	w := doReq(t, r, http.MethodPost, "/admin/maintenance", "", `{"enabled":true}`)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated toggle: HTTP %d, want 401", w.Code)
+	}
+	w = doReq(t, r, http.MethodPost, "/admin/maintenance", "wrong", `{"enabled":true}`)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong-token toggle: HTTP %d, want 401", w.Code)
+	}
+	if hs.GetStatus().Status != "healthy" {
+		t.Error("unauthorized toggles must not enable maintenance")
+	}
+}
@@ -0,0 +1,208 @@
+package healthkit
+
+// Memory-leak trend detection. The runtime threshold check (selfhealth.go)
+// only fires once the heap is already over the limit — a slow leak sails
+// under it for days and takes the process down at 3am. This check watches the
+// DIRECTION instead: the collector feeds each m.Alloc sample into a sliding
+// window, a linear regression over the window yields a growth rate in
+// bytes/minute, and when that slope stays above the configured threshold for
+// K consecutive windows the internal "memory_trend" service flips unhealthy
+// with the computed rate in its message. One under-threshold window clears
+// the streak, so a deliberate allocation burst (cache warm-up, big batch)
+// recovers on its own once the heap plateaus.
+//
+// The math and the window bookkeeping live in memTrendTracker, which is pure
+// (feed samples, read results) so tests can drive synthetic series without a
+// collector goroutine. Like the threshold latches, the tracker is owned by
+// the single collector goroutine and needs no lock.
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// memTrendServiceName is the internal pseudo-service the trend check drives,
+// alongside "runtime" (selfhealth.go) and "persistence" (persistence.go).
+const memTrendServiceName = "memory_trend"
+
+// Trend defaults: 60 samples at the 10s collector tick is a 10-minute
+// window; 3 consecutive over-threshold windows ride out a single noisy
+// regression. The threshold itself has no default — the check is opt-in.
+const (
+	defaultMemTrendWindow      = 60
+	defaultMemTrendConsecutive = 3
+)
+
+type memTrendSample struct {
+	at    time.Time
+	alloc uint64
+}
+
+// memTrendResult is one window evaluation.
+type memTrendResult struct {
+	// Evaluated is false until the window has filled; Slope and Unhealthy
+	// are meaningless before that.
+	Evaluated bool
+	// Slope is the regression slope in bytes per minute (negative while the
+	// heap shrinks).
+	Slope float64
+	// Unhealthy is true once the slope has exceeded the threshold for the
+	// configured number of consecutive windows.
+	Unhealthy bool
+}
+
+// memTrendTracker keeps the sliding sample window and the consecutive-window
+// streak. Pure bookkeeping — no goroutines, no locks, no metrics.
+type memTrendTracker struct {
+	threshold   float64 // bytes per minute
+	window      int
+	consecutive int
+	samples     []memTrendSample // oldest first, at most window entries
+	streak      int
+}
+
+func newMemTrendTracker(threshold float64, window, consecutive int) *memTrendTracker {
+	if window < 2 {
+		window = 2 // a slope needs two points
+	}
+	if consecutive < 1 {
+		consecutive = 1
+	}
+	return &memTrendTracker{threshold: threshold, window: window, consecutive: consecutive}
+}
+
+// observe records one sample and, once the window is full, evaluates it.
+func (t *memTrendTracker) observe(at time.Time, alloc uint64) memTrendResult {
+	t.samples = append(t.samples, memTrendSample{at: at, alloc: alloc})
+	if len(t.samples) > t.window {
+		t.samples = t.samples[1:]
+	}
+	if len(t.samples) < t.window {
+		return memTrendResult{}
+	}
+
+	slope := t.slopeBytesPerMinute()
+	if slope > t.threshold {
+		t.streak++
+	} else {
+		t.streak = 0
+	}
+	return memTrendResult{
+		Evaluated: true,
+		Slope:     slope,
+		Unhealthy: t.streak >= t.consecutive,
+	}
+}
+
+// slopeBytesPerMinute is the least-squares slope over the current window:
+// sum((x-x̄)(y-ȳ)) / sum((x-x̄)²) with x in minutes since the oldest sample.
+func (t *memTrendTracker) slopeBytesPerMinute() float64 {
+	base := t.samples[0].at
+	var sumX, sumY float64
+	for _, s := range t.samples {
+		sumX += s.at.Sub(base).Minutes()
+		sumY += float64(s.alloc)
+	}
+	n := float64(len(t.samples))
+	meanX, meanY := sumX/n, sumY/n
+
+	var num, den float64
+	for _, s := range t.samples {
+		dx := s.at.Sub(base).Minutes() - meanX
+		num += dx * (float64(s.alloc) - meanY)
+		den += dx * dx
+	}
+	if den == 0 {
+		// All samples share one timestamp (a stopped clock) — no trend.
+		return 0
+	}
+	return num / den
+}
+
+// WithMemoryTrend enables the leak check: threshold in bytes/minute (<=0
+// keeps it disabled), window in samples, and the consecutive-window count.
+func WithMemoryTrend(thresholdBytesPerMin float64, window, consecutive int) Option {
+	return func(h *Service) {
+		if thresholdBytesPerMin <= 0 {
+			return
+		}
+		h.memTrend = newMemTrendTracker(thresholdBytesPerMin, window, consecutive)
+	}
+}
+
+// memTrendFromEnv reads the MEMORY_GROWTH_* trio. The threshold
+// (MEMORY_GROWTH_WARN_MB_PER_MIN, fractional MB allowed) opts the check in;
+// window and streak tune it. Usual fail-safe posture throughout.
+func memTrendFromEnv() (threshold float64, window, consecutive int) {
+	window, consecutive = defaultMemTrendWindow, defaultMemTrendConsecutive
+
+	raw := strings.TrimSpace(os.Getenv("MEMORY_GROWTH_WARN_MB_PER_MIN"))
+	if raw != "" {
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil || v <= 0 {
+			log.Printf("WARNING: invalid MEMORY_GROWTH_WARN_MB_PER_MIN %q (must be a positive number) — memory trend check disabled", raw)
+		} else {
+			threshold = v * 1024 * 1024
+		}
+	}
+	if raw := strings.TrimSpace(os.Getenv("MEMORY_GROWTH_WINDOW_SAMPLES")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 2 {
+			log.Printf("WARNING: invalid MEMORY_GROWTH_WINDOW_SAMPLES %q (must be an integer >= 2) — using default %d", raw, defaultMemTrendWindow)
+		} else {
+			window = n
+		}
+	}
+	if raw := strings.TrimSpace(os.Getenv("MEMORY_GROWTH_CONSECUTIVE")); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			log.Printf("WARNING: invalid MEMORY_GROWTH_CONSECUTIVE %q (must be a positive integer) — using default %d", raw, defaultMemTrendConsecutive)
+		} else {
+			consecutive = n
+		}
+	}
+	return threshold, window, consecutive
+}
+
+// checkMemoryTrend feeds one collector sample through the tracker and drives
+// the "memory_trend" pseudo-service plus the growth-rate gauge. Runs only on
+// the collector tick, same ownership model as checkRuntimeThresholds.
+func (h *Service) checkMemoryTrend(memAlloc uint64) {
+	if h.memTrend == nil {
+		return
+	}
+	res := h.memTrend.observe(h.clock.Now(), memAlloc)
+	if !res.Evaluated {
+		return
+	}
+	h.metrics.memoryGrowth.Set(res.Slope)
+
+	h.mu.RLock()
+	prevHealthy, known := h.services[memTrendServiceName]
+	h.mu.RUnlock()
+
+	if res.Unhealthy {
+		message := fmt.Sprintf("heap growing %.2f MB/min (threshold %.2f MB/min)",
+			res.Slope/1024/1024, h.memTrend.threshold/1024/1024)
+		if h.SetServiceStatus(memTrendServiceName, false) {
+			h.SetServiceMessage(memTrendServiceName, message)
+			if !known || prevHealthy {
+				log.Printf("WARNING: memory trend check tripped: %s", message)
+			}
+		}
+		return
+	}
+	// Under threshold again: recover, but only if the service was ever
+	// registered — same rule as the runtime check.
+	if known {
+		h.SetServiceStatus(memTrendServiceName, true)
+		h.SetServiceMessage(memTrendServiceName, "")
+		if !prevHealthy {
+			log.Printf("Memory trend recovered (%.2f MB/min under threshold)", res.Slope/1024/1024)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package healthkit
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// feedTrend pushes n samples 10s apart, growing by step bytes each, starting
+// at base, and returns the last result.
+func feedTrend(tr *memTrendTracker, start time.Time, base uint64, step int64, n int) memTrendResult {
+	var res memTrendResult
+	for i := 0; i < n; i++ {
+		at := start.Add(time.Duration(i) * 10 * time.Second)
+		res = tr.observe(at, uint64(int64(base)+step*int64(i)))
+	}
+	return res
+}
+
+func TestMemTrendTracker_TriggersOnMonotonicGrowth(t *testing.T) {
+	// 1 MB every 10s = 6 MB/min, threshold 1 MB/min, window 6, 3 windows.
+	tr := newMemTrendTracker(1024*1024, 6, 3)
+	start := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	// Window fills at sample 6 (streak 1); two more over-threshold windows
+	// reach the streak of 3.
+	if res := feedTrend(tr, start, 100<<20, 1<<20, 7); res.Unhealthy {
+		t.Fatal("unhealthy after 2 over-threshold windows, want 3 required")
+	}
+	res := tr.observe(start.Add(7*10*time.Second), 100<<20+7<<20)
+	if !res.Evaluated || !res.Unhealthy {
+		t.Fatalf("result = %+v, want evaluated and unhealthy on the 3rd window", res)
+	}
+	wantSlope := 6.0 * 1024 * 1024 // bytes per minute
+	if math.Abs(res.Slope-wantSlope) > wantSlope*0.01 {
+		t.Errorf("slope = %.0f bytes/min, want ~%.0f", res.Slope, wantSlope)
+	}
+}
+
+func TestMemTrendTracker_FlatHeapNeverTrips(t *testing.T) {
+	tr := newMemTrendTracker(1024*1024, 6, 1)
+	start := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	res := feedTrend(tr, start, 100<<20, 0, 20)
+	if !res.Evaluated {
+		t.Fatal("window never filled")
+	}
+	if res.Unhealthy || res.Slope != 0 {
+		t.Errorf("flat heap: slope = %v, unhealthy = %v; want 0, false", res.Slope, res.Unhealthy)
+	}
+}
+
+func TestMemTrendTracker_PlateauClearsStreak(t *testing.T) {
+	// K=5 exceeds what the decaying windows can accumulate after a plateau,
+	// so the check never fires for a burst that stops growing.
+	tr := newMemTrendTracker(3*1024*1024, 4, 5)
+	start := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	// Growth fills the window and starts a streak...
+	feedTrend(tr, start, 100<<20, 1<<20, 6)
+	if tr.streak == 0 {
+		t.Fatal("growth phase never started a streak")
+	}
+	// ...then the heap plateaus: windows still containing growth samples keep
+	// the streak briefly, but a fully flat window resets it to zero.
+	for i := 6; i < 14; i++ {
+		if res := tr.observe(start.Add(time.Duration(i)*10*time.Second), 100<<20+5<<20); res.Unhealthy {
+			t.Fatalf("unhealthy at plateau sample %d, want the streak to clear first", i)
+		}
+	}
+	if tr.streak != 0 {
+		t.Errorf("streak = %d after plateau, want 0", tr.streak)
+	}
+}
+
+func TestMemTrendTracker_WindowSlides(t *testing.T) {
+	tr := newMemTrendTracker(1024*1024, 5, 1)
+	start := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	feedTrend(tr, start, 100<<20, 1<<20, 50)
+	if len(tr.samples) != 5 {
+		t.Errorf("window holds %d samples, want capped at 5", len(tr.samples))
+	}
+	if tr.samples[0].alloc != 100<<20+45<<20 {
+		t.Errorf("oldest sample = %d, want the 46th (window slid)", tr.samples[0].alloc)
+	}
+}
+
+func TestCheckMemoryTrend_ServiceFlipAndGauge(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC))
+	// 1 MB/min threshold, 3-sample window, 2 consecutive windows.
+	hs := New(WithVersion("test"), WithClock(clk), WithMemoryTrend(1024*1024, 3, 2))
+
+	// 2 MB per 10s tick = 12 MB/min: trips after the window fills plus one.
+	alloc := uint64(100 << 20)
+	for i := 0; i < 4; i++ {
+		hs.checkMemoryTrend(alloc)
+		alloc += 2 << 20
+		clk.Advance(10 * time.Second)
+	}
+
+	status := hs.GetStatus()
+	if healthy, ok := status.Services[memTrendServiceName]; !ok || healthy {
+		t.Fatalf("memory_trend service = %v (present %v), want unhealthy", healthy, ok)
+	}
+	msg := hs.ServiceMessages()[memTrendServiceName]
+	if !strings.Contains(msg, "MB/min") {
+		t.Errorf("message = %q, want the growth rate in MB/min", msg)
+	}
+	mf := findMetric(t, hs, "discord_bot_memory_growth_bytes_per_minute")
+	if mf == nil {
+		t.Fatal("growth gauge not registered")
+	}
+	if v := mf.GetMetric()[0].GetGauge().GetValue(); v <= 0 {
+		t.Errorf("growth gauge = %v, want positive while leaking", v)
+	}
+
+	// Plateau: the streak clears and the service recovers.
+	for i := 0; i < 4; i++ {
+		hs.checkMemoryTrend(alloc)
+		clk.Advance(10 * time.Second)
+	}
+	if healthy := hs.GetStatus().Services[memTrendServiceName]; !healthy {
+		t.Error("memory_trend still unhealthy after the heap plateaued")
+	}
+}
+
+func TestCheckMemoryTrend_DisabledIsNoop(t *testing.T) {
+	hs := New(WithVersion("test"))
+	hs.checkMemoryTrend(100 << 20)
+	if _, ok := hs.GetStatus().Services[memTrendServiceName]; ok {
+		t.Error("memory_trend service registered with the check disabled")
+	}
+}
+
+func TestMemTrendFromEnv(t *testing.T) {
+	tests := []struct {
+		name                  string
+		threshold, window, ks string
+		wantThreshold         float64
+		wantWindow, wantK     int
+	}{
+		{"all unset (disabled)", "", "", "", 0, defaultMemTrendWindow, defaultMemTrendConsecutive},
+		{"valid combo", "2.5", "30", "5", 2.5 * 1024 * 1024, 30, 5},
+		{"bad threshold disables", "fast", "30", "5", 0, 30, 5},
+		{"bad tuning falls back", "1", "1", "0", 1024 * 1024, defaultMemTrendWindow, defaultMemTrendConsecutive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MEMORY_GROWTH_WARN_MB_PER_MIN", tt.threshold)
+			t.Setenv("MEMORY_GROWTH_WINDOW_SAMPLES", tt.window)
+			t.Setenv("MEMORY_GROWTH_CONSECUTIVE", tt.ks)
+			threshold, window, consecutive := memTrendFromEnv()
+			if threshold != tt.wantThreshold {
+				t.Errorf("threshold = %v, want %v", threshold, tt.wantThreshold)
+			}
+			if window != tt.wantWindow || consecutive != tt.wantK {
+				t.Errorf("window/consecutive = %d/%d, want %d/%d", window, consecutive, tt.wantWindow, tt.wantK)
+			}
+		})
+	}
+}
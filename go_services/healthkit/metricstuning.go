@@ -0,0 +1,102 @@
+package healthkit
+
+// Startup tuning for the metric surface itself. The default aiResponseTime
+// buckets top out at 60s, so AI calls that routinely run longer all collapse
+// into +Inf and the histogram says nothing about them; and a fleet running
+// several environments against one Prometheus needs a per-environment prefix
+// to keep their series apart. Both are configured via env and — unlike the
+// usual fail-safe env posture — a bad value here FAILS STARTUP: a histogram
+// registered with broken buckets or a mistyped prefix would silently record
+// garbage for the process's whole lifetime, and the operator is present at
+// startup to fix it.
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// defaultAIResponseBuckets is the historical bucket set for
+// discord_bot_ai_response_seconds.
+var defaultAIResponseBuckets = []float64{0.5, 1, 2, 5, 10, 30, 60}
+
+// metricNameRe is the Prometheus metric-name alphabet; a prefix must satisfy
+// it or every registration in the process would panic.
+var metricNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// WithMetricsNamespace prepends namespace+"_" to every metric this Service
+// registers (service metrics, HTTP self-instrumentation, pushed-metric
+// gauges, deprecation counters). The standard Go/process collectors keep
+// their canonical names — dashboards expect go_* and process_* verbatim.
+func WithMetricsNamespace(namespace string) Option {
+	return func(h *Service) { h.metricsPrefix = namespace }
+}
+
+// WithRequestDurationBuckets overrides the discord_bot_request_duration_seconds
+// bucket set. Values must be strictly ascending (see parseBuckets for the env
+// path, which validates; direct callers are trusted like prometheus itself
+// trusts them).
+func WithRequestDurationBuckets(buckets []float64) Option {
+	return func(h *Service) { h.requestDurationBuckets = buckets }
+}
+
+// WithAIResponseBuckets overrides the discord_bot_ai_response_seconds bucket
+// set.
+func WithAIResponseBuckets(buckets []float64) Option {
+	return func(h *Service) { h.aiResponseBuckets = buckets }
+}
+
+// parseBuckets parses a comma-separated float list ("0.5,1,5,30,120") into a
+// bucket set, requiring at least one value and a strictly ascending order —
+// Prometheus would accept equal adjacent bounds and simply waste a bucket,
+// but an operator writing one almost certainly made a typo.
+func parseBuckets(raw string) ([]float64, error) {
+	parts := strings.Split(raw, ",")
+	buckets := make([]float64, 0, len(parts))
+	for _, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("bucket %q is not a number", strings.TrimSpace(part))
+		}
+		buckets = append(buckets, v)
+	}
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return nil, fmt.Errorf("buckets must be strictly ascending (%v <= %v at position %d)",
+				buckets[i], buckets[i-1], i)
+		}
+	}
+	return buckets, nil
+}
+
+// MetricsTuningFromEnv reads METRICS_NAMESPACE, REQUEST_DURATION_BUCKETS and
+// AI_RESPONSE_BUCKETS. Invalid values are a startup error, not a warning —
+// see the package comment at the top of this file for why this inverts the
+// usual env posture.
+func MetricsTuningFromEnv() ([]Option, error) {
+	var opts []Option
+
+	if ns := strings.TrimSpace(os.Getenv("METRICS_NAMESPACE")); ns != "" {
+		if !metricNameRe.MatchString(ns) {
+			return nil, fmt.Errorf("METRICS_NAMESPACE %q is not a valid metric-name prefix ([a-zA-Z_][a-zA-Z0-9_]*)", ns)
+		}
+		opts = append(opts, WithMetricsNamespace(ns))
+	}
+	if raw := strings.TrimSpace(os.Getenv("REQUEST_DURATION_BUCKETS")); raw != "" {
+		buckets, err := parseBuckets(raw)
+		if err != nil {
+			return nil, fmt.Errorf("REQUEST_DURATION_BUCKETS: %w", err)
+		}
+		opts = append(opts, WithRequestDurationBuckets(buckets))
+	}
+	if raw := strings.TrimSpace(os.Getenv("AI_RESPONSE_BUCKETS")); raw != "" {
+		buckets, err := parseBuckets(raw)
+		if err != nil {
+			return nil, fmt.Errorf("AI_RESPONSE_BUCKETS: %w", err)
+		}
+		opts = append(opts, WithAIResponseBuckets(buckets))
+	}
+	return opts, nil
+}
@@ -0,0 +1,172 @@
+package healthkit
+
+import (
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestParseBuckets(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    []float64
+		wantErr string
+	}{
+		{name: "valid", raw: "0.5,1,5,30,120", want: []float64{0.5, 1, 5, 30, 120}},
+		{name: "spaces tolerated", raw: " 1 , 2 , 3 ", want: []float64{1, 2, 3}},
+		{name: "single bucket", raw: "60", want: []float64{60}},
+		{name: "not a number", raw: "1,fast,3", wantErr: "not a number"},
+		{name: "empty element", raw: "1,,3", wantErr: "not a number"},
+		{name: "descending", raw: "5,1", wantErr: "strictly ascending"},
+		{name: "equal adjacent", raw: "1,1,2", wantErr: "strictly ascending"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBuckets(tt.raw)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseBuckets(%q) err = %v, want containing %q", tt.raw, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseBuckets(%q): %v", tt.raw, err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseBuckets(%q) = %v, want %v", tt.raw, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("bucket[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMetricsTuningFromEnv(t *testing.T) {
+	tests := []struct {
+		name               string
+		namespace, req, ai string
+		wantOpts           int
+		wantErr            string
+	}{
+		{name: "all unset", wantOpts: 0},
+		{name: "valid combo", namespace: "staging", req: "0.1,1,10", ai: "1,60,300", wantOpts: 3},
+		{name: "bad namespace", namespace: "1-staging", wantErr: "METRICS_NAMESPACE"},
+		{name: "bad request buckets", req: "a,b", wantErr: "REQUEST_DURATION_BUCKETS"},
+		{name: "bad ai buckets", ai: "5,1", wantErr: "AI_RESPONSE_BUCKETS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("METRICS_NAMESPACE", tt.namespace)
+			t.Setenv("REQUEST_DURATION_BUCKETS", tt.req)
+			t.Setenv("AI_RESPONSE_BUCKETS", tt.ai)
+			opts, err := MetricsTuningFromEnv()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MetricsTuningFromEnv: %v", err)
+			}
+			if len(opts) != tt.wantOpts {
+				t.Errorf("got %d options, want %d", len(opts), tt.wantOpts)
+			}
+		})
+	}
+}
+
+// findMetric gathers the Service's registry and returns the family with the
+// given name, or nil.
+func findMetric(t *testing.T, hs *Service, name string) *dto.MetricFamily {
+	t.Helper()
+	families, err := hs.registry.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, mf := range families {
+		if mf.GetName() == name {
+			return mf
+		}
+	}
+	return nil
+}
+
+func TestCustomAIResponseBuckets(t *testing.T) {
+	hs := New(WithVersion("test"), WithAIResponseBuckets([]float64{1, 60, 120, 300}))
+
+	// A 90-second response: beyond the historical 60s ceiling, inside the
+	// configured 120s bound.
+	hs.metrics.aiResponseTime.WithLabelValues("unknown").Observe(90)
+
+	mf := findMetric(t, hs, "discord_bot_ai_response_seconds")
+	if mf == nil {
+		t.Fatal("histogram not registered")
+	}
+	hist := mf.GetMetric()[0].GetHistogram()
+	wantCumulative := map[float64]uint64{1: 0, 60: 0, 120: 1, 300: 1}
+	if len(hist.GetBucket()) != len(wantCumulative) {
+		t.Fatalf("got %d buckets, want %d", len(hist.GetBucket()), len(wantCumulative))
+	}
+	for _, b := range hist.GetBucket() {
+		if want, ok := wantCumulative[b.GetUpperBound()]; !ok {
+			t.Errorf("unexpected bucket bound %v", b.GetUpperBound())
+		} else if b.GetCumulativeCount() != want {
+			t.Errorf("bucket le=%v count = %d, want %d", b.GetUpperBound(), b.GetCumulativeCount(), want)
+		}
+	}
+}
+
+func TestCustomRequestDurationBuckets(t *testing.T) {
+	hs := New(WithVersion("test"), WithRequestDurationBuckets([]float64{0.1, 1, 10}))
+	hs.metrics.requestDuration.WithLabelValues("chat").Observe(0.5)
+
+	mf := findMetric(t, hs, "discord_bot_request_duration_seconds")
+	if mf == nil {
+		t.Fatal("histogram not registered")
+	}
+	hist := mf.GetMetric()[0].GetHistogram()
+	for _, b := range hist.GetBucket() {
+		want := uint64(0)
+		if b.GetUpperBound() >= 1 {
+			want = 1
+		}
+		if b.GetCumulativeCount() != want {
+			t.Errorf("bucket le=%v count = %d, want %d", b.GetUpperBound(), b.GetCumulativeCount(), want)
+		}
+	}
+}
+
+func TestMetricsNamespacePrefix(t *testing.T) {
+	hs := New(WithVersion("test"), WithMetricsNamespace("staging"))
+	hs.metrics.requestsTotal.WithLabelValues("chat", "success").Inc()
+
+	if findMetric(t, hs, "staging_discord_bot_requests_total") == nil {
+		t.Error("prefixed counter not found in registry")
+	}
+	if findMetric(t, hs, "discord_bot_requests_total") != nil {
+		t.Error("unprefixed name still registered alongside the prefixed one")
+	}
+	// Standard runtime collectors keep canonical names.
+	if findMetric(t, hs, "go_goroutines") == nil {
+		t.Error("go_goroutines lost its canonical name under the prefix")
+	}
+}
+
+func TestMetricsNamespaceAppliesToLazyGauges(t *testing.T) {
+	hs := New(WithVersion("test"), WithMetricsNamespace("staging"))
+	g, err := hs.getSummaryGauge("latency")
+	if err != nil {
+		t.Fatalf("getSummaryGauge: %v", err)
+	}
+	g.WithLabelValues("0.5").Set(1.25)
+
+	if findMetric(t, hs, "staging_discord_bot_latency_quantile") == nil {
+		t.Error("lazily registered gauge did not pick up the prefix")
+	}
+}
@@ -0,0 +1,73 @@
+package healthkit
+
+// Monotonicity handling for counters pushed by restarting Python workers.
+// The push contract has always been deltas, but a worker that restarts
+// mid-flight sometimes replays its cumulative totals, and Add()ing a total on
+// top of the increments it already sent double-counts everything since boot.
+// The optional payload field `mode` lets a client opt a counter push into
+// "absolute" semantics: the service remembers the last total it saw per
+// (name, sanitized labelset) and adds only the positive difference. A total
+// that went DOWN means the worker restarted and its in-process counter reset,
+// so the new total is itself the whole delta — same recovery rule Prometheus
+// applies to scraped counters. An absent or "delta" mode keeps the historical
+// pass-through behavior everywhere, batch items included.
+//
+// The last-value map is bounded by the same cardinality guard that budgets
+// endpoint series: a new series may enter absolute tracking only while its
+// "absolute_<name>" family has budget (MAX_SERIES_PER_METRIC per family), so
+// the map cannot outgrow the scrape output it shadows. Past the budget the
+// push is rejected with a stable reason rather than silently treated as a
+// delta — mis-applying an absolute total as an increment is exactly the
+// double-count this exists to stop.
+//
+// Mixing modes on one series is self-consistent rather than forbidden: delta
+// pushes never touch the absolute baseline, and an absolute push diffs
+// against the last absolute total regardless of deltas in between.
+
+import "sync"
+
+// Counter push modes. Absent means modeDelta.
+const (
+	modeDelta    = "delta"
+	modeAbsolute = "absolute"
+)
+
+// absCounterStore remembers the last absolute total per tracked series.
+// Boundedness is enforced by the caller's cardinality-guard admission, not
+// here.
+type absCounterStore struct {
+	mu   sync.Mutex
+	last map[string]float64
+}
+
+// delta returns how much of value is new since the previous absolute total
+// for key: the positive difference, or the full value on first sight and
+// after a reset (value below the previous total).
+func (s *absCounterStore) delta(key string, value float64) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, seen := s.last[key]
+	s.last[key] = value
+	if !seen || value < prev {
+		return value
+	}
+	return value - prev
+}
+
+// counterDelta resolves how much one counter payload should Add. labelValues
+// are the final sanitized values in the collector's label order, so the
+// tracking key corresponds one-to-one with a stored series. Returns the
+// amount and "" on success, or 0 and a stable reason.
+func (h *Service) counterDelta(p MetricsPayload, labelValues ...string) (float64, string) {
+	if p.Mode == "" || p.Mode == modeDelta {
+		return p.Value, ""
+	}
+	key := p.Name
+	for _, v := range labelValues {
+		key += "\x00" + v
+	}
+	if !h.cardGuard.admit("absolute_"+p.Name, key) {
+		return 0, reasonTooManySeries
+	}
+	return h.absCounters.delta(key, p.Value), ""
+}
@@ -0,0 +1,199 @@
+package healthkit
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// pushRequests posts one requests-counter payload with the given value and
+// mode ("" = field omitted) and asserts the expected status.
+func pushRequests(t *testing.T, hs *Service, value float64, mode string, wantCode int) {
+	t.Helper()
+	body := fmt.Sprintf(`{"type":"counter","name":"requests","value":%v,"labels":{"status":"success","endpoint":"ai"}`, value)
+	if mode != "" {
+		body += fmt.Sprintf(`,"mode":%q`, mode)
+	}
+	body += "}"
+	rec := postJSON(t, hs.handleMetricsPush, body)
+	if rec.Code != wantCode {
+		t.Fatalf("push(value=%v, mode=%q) = %d (%s), want %d", value, mode, rec.Code, rec.Body.String(), wantCode)
+	}
+}
+
+func TestAbsoluteModeAddsPositiveDifference(t *testing.T) {
+	hs := New(WithVersion("test"))
+	series := hs.metrics.requestsTotal.WithLabelValues("ai", "success")
+
+	// First absolute total counts in full, later totals only their growth.
+	pushRequests(t, hs, 10, "absolute", http.StatusOK)
+	pushRequests(t, hs, 25, "absolute", http.StatusOK)
+	pushRequests(t, hs, 25, "absolute", http.StatusOK) // no growth, no double count
+	if got := testutil.ToFloat64(series); got != 25 {
+		t.Fatalf("after absolute 10,25,25: counter = %v, want 25", got)
+	}
+}
+
+func TestAbsoluteModeTreatsDecreaseAsReset(t *testing.T) {
+	hs := New(WithVersion("test"))
+	series := hs.metrics.requestsTotal.WithLabelValues("ai", "success")
+
+	pushRequests(t, hs, 100, "absolute", http.StatusOK)
+	// The worker restarted: its total fell to 3, which is all new work.
+	pushRequests(t, hs, 3, "absolute", http.StatusOK)
+	pushRequests(t, hs, 8, "absolute", http.StatusOK)
+	if got := testutil.ToFloat64(series); got != 108 {
+		t.Errorf("after reset: counter = %v, want 100+3+5=108", got)
+	}
+}
+
+func TestInterleavedDeltaAndAbsolutePushes(t *testing.T) {
+	hs := New(WithVersion("test"))
+	series := hs.metrics.requestsTotal.WithLabelValues("ai", "success")
+
+	// Deltas never move the absolute baseline: the worker's own total is 20
+	// throughout, even though deltas landed in between.
+	pushRequests(t, hs, 20, "absolute", http.StatusOK)
+	pushRequests(t, hs, 5, "", http.StatusOK)          // bare delta (default mode)
+	pushRequests(t, hs, 2, "delta", http.StatusOK)     // explicit delta
+	pushRequests(t, hs, 30, "absolute", http.StatusOK) // grew 20→30
+	if got := testutil.ToFloat64(series); got != 37 {
+		t.Errorf("interleaved: counter = %v, want 20+5+2+10=37", got)
+	}
+}
+
+func TestAbsoluteModeTracksSeriesIndependently(t *testing.T) {
+	hs := New(WithVersion("test"))
+	for _, push := range []string{
+		`{"type":"counter","name":"requests","value":50,"mode":"absolute","labels":{"status":"success","endpoint":"ai"}}`,
+		`{"type":"counter","name":"requests","value":4,"mode":"absolute","labels":{"status":"error","endpoint":"ai"}}`,
+		`{"type":"counter","name":"requests","value":60,"mode":"absolute","labels":{"status":"success","endpoint":"ai"}}`,
+	} {
+		if rec := postJSON(t, hs.handleMetricsPush, push); rec.Code != http.StatusOK {
+			t.Fatalf("push = %d (%s), want 200", rec.Code, rec.Body.String())
+		}
+	}
+	if got := testutil.ToFloat64(hs.metrics.requestsTotal.WithLabelValues("ai", "success")); got != 60 {
+		t.Errorf("success series = %v, want 60", got)
+	}
+	if got := testutil.ToFloat64(hs.metrics.requestsTotal.WithLabelValues("ai", "error")); got != 4 {
+		t.Errorf("error series = %v, want 4 (must not share the success baseline)", got)
+	}
+}
+
+func TestAbsoluteModeMirrorsResolvedDelta(t *testing.T) {
+	// The rollup and /stats/cost mirrors must see the resolved difference,
+	// not the raw absolute total — otherwise they drift from the counter.
+	hs := New(WithVersion("test"))
+	for _, push := range []string{
+		`{"type":"counter","name":"tokens","value":1000,"mode":"absolute","labels":{"type":"input"}}`,
+		`{"type":"counter","name":"tokens","value":1500,"mode":"absolute","labels":{"type":"input"}}`,
+	} {
+		if rec := postJSON(t, hs.handleMetricsPush, push); rec.Code != http.StatusOK {
+			t.Fatalf("push = %d (%s), want 200", rec.Code, rec.Body.String())
+		}
+	}
+	if got := testutil.ToFloat64(hs.metrics.tokensUsed.WithLabelValues("input", "unknown")); got != 1500 {
+		t.Errorf("tokens counter = %v, want 1500", got)
+	}
+	hs.tokenCosts.mu.Lock()
+	total := 0.0
+	for _, v := range hs.tokenCosts.counts {
+		total += v
+	}
+	hs.tokenCosts.mu.Unlock()
+	if total != 1500 {
+		t.Errorf("cost accumulator = %v, want 1500 (mirrors must not double count)", total)
+	}
+}
+
+func TestModeValidation(t *testing.T) {
+	tests := []struct {
+		name, body, wantReason string
+	}{
+		{
+			"unknown mode",
+			`{"type":"counter","name":"requests","value":1,"mode":"cumulative","labels":{"status":"success","endpoint":"ai"}}`,
+			reasonUnknownMode,
+		},
+		{
+			"mode on histogram",
+			`{"type":"histogram","name":"request_duration","value":0.1,"mode":"absolute","labels":{"endpoint":"ai"}}`,
+			reasonUnsupportedMode,
+		},
+		{
+			"mode on gauge",
+			`{"type":"gauge","name":"active_connections","value":1,"mode":"delta"}`,
+			reasonUnsupportedMode,
+		},
+		{
+			"mode on summary_set",
+			`{"type":"summary_set","name":"my_timing","value":0.2,"mode":"absolute","labels":{"quantile":"0.5"}}`,
+			reasonUnsupportedMode,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hs := New(WithVersion("test"))
+			rec := postJSON(t, hs.handleMetricsPush, tt.body)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400", rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantReason) {
+				t.Errorf("body = %q, want reason %q", rec.Body.String(), tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestAbsoluteModeSeriesBudgetShared(t *testing.T) {
+	hs := New(WithVersion("test"), WithSeriesLimit(2))
+
+	// Two distinct label combinations enter absolute tracking; the third is
+	// refused outright rather than guessed at as a delta.
+	for i, push := range []string{
+		`{"type":"counter","name":"requests","value":1,"mode":"absolute","labels":{"status":"success","endpoint":"ai"}}`,
+		`{"type":"counter","name":"requests","value":1,"mode":"absolute","labels":{"status":"error","endpoint":"ai"}}`,
+	} {
+		if rec := postJSON(t, hs.handleMetricsPush, push); rec.Code != http.StatusOK {
+			t.Fatalf("push %d = %d, want 200", i, rec.Code)
+		}
+	}
+	rec := postJSON(t, hs.handleMetricsPush,
+		`{"type":"counter","name":"requests","value":1,"mode":"absolute","labels":{"status":"timeout","endpoint":"ai"}}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), reasonTooManySeries) {
+		t.Errorf("over-budget absolute push = %d (%s), want 400 %s", rec.Code, rec.Body.String(), reasonTooManySeries)
+	}
+	// The tracked families show up in the shared cardinality report.
+	if _, counts := hs.cardGuard.snapshot(); counts["absolute_requests"] != 2 {
+		t.Errorf("absolute_requests tracked = %d, want 2", counts["absolute_requests"])
+	}
+	// Delta pushes for the refused series still work — only absolute
+	// tracking is budgeted.
+	rec = postJSON(t, hs.handleMetricsPush,
+		`{"type":"counter","name":"requests","value":1,"labels":{"status":"timeout","endpoint":"ai"}}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("delta push after budget = %d, want 200", rec.Code)
+	}
+}
+
+func TestBatchItemsDefaultToDeltaMode(t *testing.T) {
+	hs := New(WithVersion("test"))
+	series := hs.metrics.requestsTotal.WithLabelValues("ai", "success")
+
+	// Batch items without a mode are deltas (historical behavior); one item
+	// can still opt into absolute.
+	body := `[{"type":"counter","name":"requests","value":2,"labels":{"status":"success","endpoint":"ai"}},` +
+		`{"type":"counter","name":"requests","value":2,"labels":{"status":"success","endpoint":"ai"}},` +
+		`{"type":"counter","name":"requests","value":10,"mode":"absolute","labels":{"status":"success","endpoint":"ai"}}]`
+	rec := postJSON(t, hs.handleMetricsBatch, body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("batch = %d (%s), want 200", rec.Code, rec.Body.String())
+	}
+	if got := testutil.ToFloat64(series); got != 14 {
+		t.Errorf("batch mixed modes: counter = %v, want 2+2+10=14", got)
+	}
+}
@@ -0,0 +1,320 @@
+package healthkit
+
+// Machine-readable API contract. The Python side kept reverse-engineering
+// payload shapes from 400s (the 1000-item batch cap was discovered in
+// production, not in a document), so both Go services now serve an OpenAPI 3
+// description of their full route surface at GET /openapi.json. The spec is
+// handwritten JSON embedded in the binary — there is no code generator to
+// drift from — and kept honest by tests instead: each service's openapi_test
+// walks its real chi router and fails when the route set and the spec's path
+// set differ in either direction, and validates live handler responses
+// against the documented schemas. Adding a route without documenting it (or
+// documenting one that doesn't exist) breaks the build.
+//
+// A minimal Swagger UI page at GET /docs renders the spec in a browser. It is
+// off by default and gated behind ENABLE_DOCS_UI=true: the page pulls the
+// swagger-ui assets from a CDN, which is fine on a developer's machine and
+// unwanted on the production loopback deployment.
+//
+// The validation helpers (ParseOpenAPI, ValidateResponse) live here rather
+// than in a _test.go file because url_fetcher's tests need them too, and the
+// repo has no OpenAPI validator dependency to lean on — the subset they check
+// (type, required, properties, items, enum, $ref) is exactly the subset the
+// specs use.
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//go:embed openapi.json
+var healthAPISpecJSON []byte
+
+// HealthAPISpec returns the embedded OpenAPI document for the health API.
+func HealthAPISpec() []byte { return healthAPISpecJSON }
+
+// DocsUIEnabled reports whether the Swagger UI page should be served
+// (ENABLE_DOCS_UI=true). Off by default — see the package comment above.
+func DocsUIEnabled() bool {
+	return strings.TrimSpace(os.Getenv("ENABLE_DOCS_UI")) == "true"
+}
+
+// OpenAPIHandler serves an embedded OpenAPI document. The spec is static for
+// the life of the binary, so it gets long-lived caching headers.
+func OpenAPIHandler(spec []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		_, _ = w.Write(spec)
+	}
+}
+
+// SwaggerUIHandler serves a minimal Swagger UI page rendering the spec at
+// specURL. The page itself carries no data — everything it shows comes from
+// /openapi.json — but it loads the UI assets from a CDN, which is why the
+// route is gated behind DocsUIEnabled.
+func SwaggerUIHandler(title, specURL string) http.HandlerFunc {
+	page := `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>` + title + ` — API docs</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    SwaggerUIBundle({url: ` + strconv.Quote(specURL) + `, dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(page))
+	}
+}
+
+// --- spec model + response validation --------------------------------------
+
+// OpenAPIDoc is the parsed subset of an OpenAPI 3 document the conformance
+// tests consume: the path/method/response/schema skeleton.
+type OpenAPIDoc struct {
+	OpenAPI string                               `json:"openapi"`
+	Paths   map[string]map[string]openAPIOp      `json:"paths"`
+	Schemas map[string]map[string]*openAPISchema `json:"-"`
+}
+
+type openAPIOp struct {
+	Responses map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIResponse struct {
+	Content map[string]struct {
+		Schema *openAPISchema `json:"schema"`
+	} `json:"content"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref"`
+	Type                 string                    `json:"type"`
+	Required             []string                  `json:"required"`
+	Properties           map[string]*openAPISchema `json:"properties"`
+	Items                *openAPISchema            `json:"items"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties"`
+	Enum                 []any                     `json:"enum"`
+}
+
+// ParseOpenAPI decodes a spec and resolves that it is structurally usable:
+// version 3, a non-empty path map, and every $ref pointing at a declared
+// component schema.
+func ParseOpenAPI(spec []byte) (*OpenAPIDoc, error) {
+	var raw struct {
+		OpenAPI    string                          `json:"openapi"`
+		Paths      map[string]map[string]openAPIOp `json:"paths"`
+		Components struct {
+			Schemas map[string]*openAPISchema `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(spec, &raw); err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+	if !strings.HasPrefix(raw.OpenAPI, "3.") {
+		return nil, fmt.Errorf("openapi: version %q, want 3.x", raw.OpenAPI)
+	}
+	if len(raw.Paths) == 0 {
+		return nil, fmt.Errorf("openapi: no paths")
+	}
+	doc := &OpenAPIDoc{
+		OpenAPI: raw.OpenAPI,
+		Paths:   raw.Paths,
+		Schemas: map[string]map[string]*openAPISchema{"schemas": raw.Components.Schemas},
+	}
+	for path, ops := range raw.Paths {
+		for method, op := range ops {
+			for status, resp := range op.Responses {
+				for mediaType, content := range resp.Content {
+					if err := doc.checkRefs(content.Schema); err != nil {
+						return nil, fmt.Errorf("openapi: %s %s %s %s: %w", method, path, status, mediaType, err)
+					}
+				}
+			}
+		}
+	}
+	for name, schema := range raw.Components.Schemas {
+		if err := doc.checkRefs(schema); err != nil {
+			return nil, fmt.Errorf("openapi: components.schemas.%s: %w", name, err)
+		}
+	}
+	return doc, nil
+}
+
+// Operations returns every documented path → sorted-free method set, the shape
+// the router-coverage tests diff against chi.Walk output. Methods come back
+// uppercased to match net/http constants.
+func (d *OpenAPIDoc) Operations() map[string][]string {
+	ops := make(map[string][]string, len(d.Paths))
+	for path, methods := range d.Paths {
+		for method := range methods {
+			ops[path] = append(ops[path], strings.ToUpper(method))
+		}
+	}
+	return ops
+}
+
+func (d *OpenAPIDoc) resolve(s *openAPISchema) (*openAPISchema, error) {
+	for s != nil && s.Ref != "" {
+		name, ok := strings.CutPrefix(s.Ref, "#/components/schemas/")
+		if !ok {
+			return nil, fmt.Errorf("unsupported $ref %q", s.Ref)
+		}
+		target, ok := d.Schemas["schemas"][name]
+		if !ok {
+			return nil, fmt.Errorf("$ref %q: no such component schema", s.Ref)
+		}
+		s = target
+	}
+	return s, nil
+}
+
+func (d *OpenAPIDoc) checkRefs(s *openAPISchema) error {
+	if s == nil {
+		return nil
+	}
+	if _, err := d.resolve(s); err != nil {
+		return err
+	}
+	for _, p := range s.Properties {
+		if err := d.checkRefs(p); err != nil {
+			return err
+		}
+	}
+	if err := d.checkRefs(s.Items); err != nil {
+		return err
+	}
+	return d.checkRefs(s.AdditionalProperties)
+}
+
+// ValidateResponse checks one real handler response against the spec: the
+// status must be documented for the operation, the Content-Type must match a
+// documented media type, and a JSON body must conform to the documented
+// schema. An empty contentType is allowed only when the documented response
+// declares no content (204s, 304s).
+func (d *OpenAPIDoc) ValidateResponse(path, method string, status int, contentType string, body []byte) error {
+	ops, ok := d.Paths[path]
+	if !ok {
+		return fmt.Errorf("path %s not documented", path)
+	}
+	op, ok := ops[strings.ToLower(method)]
+	if !ok {
+		return fmt.Errorf("%s %s not documented", method, path)
+	}
+	resp, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		resp, ok = op.Responses["default"]
+	}
+	if !ok {
+		return fmt.Errorf("%s %s: status %d not documented", method, path, status)
+	}
+	if len(resp.Content) == 0 {
+		return nil // documented as bodyless
+	}
+	mediaType := contentType
+	if i := strings.Index(mediaType, ";"); i >= 0 {
+		mediaType = strings.TrimSpace(mediaType[:i])
+	}
+	content, ok := resp.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("%s %s %d: content type %q not documented", method, path, status, mediaType)
+	}
+	if mediaType != "application/json" || content.Schema == nil {
+		return nil // non-JSON bodies are documented, not schema-checked
+	}
+	var decoded any
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return fmt.Errorf("%s %s %d: body is not valid JSON: %w", method, path, status, err)
+	}
+	if err := d.validateValue(content.Schema, decoded); err != nil {
+		return fmt.Errorf("%s %s %d: %w", method, path, status, err)
+	}
+	return nil
+}
+
+func (d *OpenAPIDoc) validateValue(schema *openAPISchema, value any) error {
+	schema, err := d.resolve(schema)
+	if err != nil {
+		return err
+	}
+	if schema == nil {
+		return nil
+	}
+	if len(schema.Enum) > 0 {
+		found := false
+		for _, allowed := range schema.Enum {
+			if allowed == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("value %v not in enum %v", value, schema.Enum)
+		}
+	}
+	switch schema.Type {
+	case "", "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			if schema.Type == "" {
+				return nil // untyped schema accepts anything
+			}
+			return fmt.Errorf("got %T, want object", value)
+		}
+		for _, name := range schema.Required {
+			if _, present := obj[name]; !present {
+				return fmt.Errorf("missing required property %q", name)
+			}
+		}
+		for name, v := range obj {
+			if prop, ok := schema.Properties[name]; ok {
+				if err := d.validateValue(prop, v); err != nil {
+					return fmt.Errorf("property %q: %w", name, err)
+				}
+			} else if schema.AdditionalProperties != nil {
+				if err := d.validateValue(schema.AdditionalProperties, v); err != nil {
+					return fmt.Errorf("property %q: %w", name, err)
+				}
+			}
+		}
+	case "array":
+		arr, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("got %T, want array", value)
+		}
+		for i, item := range arr {
+			if err := d.validateValue(schema.Items, item); err != nil {
+				return fmt.Errorf("item %d: %w", i, err)
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("got %T, want string", value)
+		}
+	case "number", "integer":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("got %T, want %s", value, schema.Type)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("got %T, want boolean", value)
+		}
+	default:
+		return fmt.Errorf("unsupported schema type %q", schema.Type)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package healthkit
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// walkRoutes collects the router's route set as "METHOD path" strings.
+// Routes mounted with Handle() answer every HTTP method, which chi's walk
+// reports as nine separate entries; those collapse to the GET the spec
+// documents.
+func walkRoutes(t *testing.T, r chi.Router) map[string]bool {
+	t.Helper()
+	methodsByRoute := make(map[string][]string)
+	err := chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		methodsByRoute[route] = append(methodsByRoute[route], method)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+	routes := make(map[string]bool)
+	for route, methods := range methodsByRoute {
+		if len(methods) >= 8 {
+			methods = []string{http.MethodGet}
+		}
+		for _, method := range methods {
+			routes[method+" "+route] = true
+		}
+	}
+	return routes
+}
+
+func specRoutes(t *testing.T, spec []byte) (*OpenAPIDoc, map[string]bool) {
+	t.Helper()
+	doc, err := ParseOpenAPI(spec)
+	if err != nil {
+		t.Fatalf("ParseOpenAPI: %v", err)
+	}
+	routes := make(map[string]bool)
+	for path, methods := range doc.Operations() {
+		for _, method := range methods {
+			routes[method+" "+path] = true
+		}
+	}
+	return doc, routes
+}
+
+func diffRouteSets(got, want map[string]bool) (missing, extra []string) {
+	for route := range got {
+		if !want[route] {
+			extra = append(extra, route)
+		}
+	}
+	for route := range want {
+		if !got[route] {
+			missing = append(missing, route)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	return missing, extra
+}
+
+// TestOpenAPISpecCoversRouter is the drift gate: the embedded spec's path set
+// must equal the real router's route set in both directions, so adding a
+// route without documenting it (or documenting a route that doesn't exist)
+// fails here.
+func TestOpenAPISpecCoversRouter(t *testing.T) {
+	t.Setenv("ENABLE_DOCS_UI", "true") // /docs is documented, so mount it
+	hs := New(WithVersion("test"))
+	_, documented := specRoutes(t, HealthAPISpec())
+	served := walkRoutes(t, hs.Routes())
+
+	missing, extra := diffRouteSets(served, documented)
+	if len(missing) > 0 {
+		t.Errorf("documented but not served: %v", missing)
+	}
+	if len(extra) > 0 {
+		t.Errorf("served but not documented (add them to openapi.json): %v", extra)
+	}
+}
+
+// TestOpenAPIResponsesConform exercises documented routes against the live
+// router and validates every real response — status, content type and body —
+// against the spec.
+func TestOpenAPIResponsesConform(t *testing.T) {
+	const token = "spec-token"
+	hs := New(WithVersion("test"))
+	hs.SetServiceStatus("bot", true)
+	r := buildRouter(hs, token)
+	doc, _ := specRoutes(t, HealthAPISpec())
+
+	tests := []struct {
+		method, path, token, body string
+		specPath                  string
+		wantStatus                int
+	}{
+		{http.MethodGet, "/health", "", "", "/health", http.StatusOK},
+		{http.MethodGet, "/health/live", "", "", "/health/live", http.StatusOK},
+		{http.MethodGet, "/health/ready", "", "", "/health/ready", http.StatusOK},
+		{http.MethodGet, "/version", "", "", "/version", http.StatusOK},
+		{http.MethodGet, "/openapi.json", "", "", "/openapi.json", http.StatusOK},
+		{http.MethodGet, "/stats", token, "", "/stats", http.StatusOK},
+		{http.MethodGet, "/health/services", token, "", "/health/services", http.StatusOK},
+		{http.MethodGet, "/health/services", "", "", "/health/services", http.StatusUnauthorized},
+		{http.MethodPost, "/metrics/push", token, `{"type":"counter","name":"requests","value":1}`, "/metrics/push", http.StatusOK},
+		{http.MethodPost, "/metrics/push", token, `{"type":"counter","name":"mystery","value":1}`, "/metrics/push", http.StatusBadRequest},
+		{http.MethodPost, "/metrics/push", "", `{"type":"counter","name":"requests","value":1}`, "/metrics/push", http.StatusUnauthorized},
+		{http.MethodGet, "/admin/downtime", token, "", "/admin/downtime", http.StatusOK},
+		{http.MethodGet, "/incidents", token, "", "/incidents", http.StatusOK},
+	}
+	for _, tt := range tests {
+		name := fmt.Sprintf("%s %s %d", tt.method, tt.path, tt.wantStatus)
+		t.Run(name, func(t *testing.T) {
+			rec := doReq(t, r, tt.method, tt.path, tt.token, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			err := doc.ValidateResponse(tt.specPath, tt.method, rec.Code, rec.Header().Get("Content-Type"), rec.Body.Bytes())
+			if err != nil {
+				t.Errorf("response does not conform to spec: %v", err)
+			}
+		})
+	}
+}
+
+// TestValidateResponseRejects proves the validator actually bites: wrong
+// paths, undocumented statuses and malformed bodies must all error, or the
+// conformance test above is a rubber stamp.
+func TestValidateResponseRejects(t *testing.T) {
+	doc, _ := specRoutes(t, HealthAPISpec())
+	jsonCT := "application/json"
+
+	if err := doc.ValidateResponse("/nope", http.MethodGet, 200, jsonCT, []byte("{}")); err == nil {
+		t.Error("undocumented path passed validation")
+	}
+	if err := doc.ValidateResponse("/health", http.MethodGet, 418, jsonCT, []byte("{}")); err == nil {
+		t.Error("undocumented status passed validation")
+	}
+	if err := doc.ValidateResponse("/health", http.MethodGet, 200, jsonCT, []byte(`{"status":"healthy"}`)); err == nil {
+		t.Error("body missing required fields passed validation")
+	}
+	if err := doc.ValidateResponse("/health", http.MethodGet, 200, jsonCT, []byte("not json")); err == nil {
+		t.Error("non-JSON body passed validation")
+	}
+	if err := doc.ValidateResponse("/health", http.MethodGet, 200, "text/html", []byte("{}")); err == nil {
+		t.Error("undocumented content type passed validation")
+	}
+	// The error envelope schema rejects envelopes without a code.
+	if err := doc.ValidateResponse("/metrics/push", http.MethodPost, 400, jsonCT, []byte(`{"error":{"message":"x"}}`)); err == nil {
+		t.Error("envelope without code passed validation")
+	}
+}
+
+func TestParseOpenAPIRejectsBadSpecs(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{"not json", `{`},
+		{"wrong version", `{"openapi":"2.0","paths":{"/x":{"get":{"responses":{"200":{"description":"ok"}}}}}}`},
+		{"no paths", `{"openapi":"3.0.3","paths":{}}`},
+		{"dangling ref", `{"openapi":"3.0.3","paths":{"/x":{"get":{"responses":{"200":{"description":"ok","content":{"application/json":{"schema":{"$ref":"#/components/schemas/Nope"}}}}}}}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseOpenAPI([]byte(tt.spec)); err == nil {
+				t.Error("ParseOpenAPI accepted a broken spec")
+			}
+		})
+	}
+}
+
+// TestDocsUIGate: /docs exists only when ENABLE_DOCS_UI=true, and the page it
+// serves points at the spec route.
+func TestDocsUIGate(t *testing.T) {
+	t.Setenv("ENABLE_DOCS_UI", "")
+	hs := New(WithVersion("test"))
+	rec := doReq(t, hs.Routes(), http.MethodGet, "/docs", "", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("/docs without the flag: status = %d, want 404", rec.Code)
+	}
+
+	t.Setenv("ENABLE_DOCS_UI", "true")
+	hs2 := New(WithVersion("test"))
+	rec = doReq(t, hs2.Routes(), http.MethodGet, "/docs", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/docs with the flag: status = %d, want 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want text/html", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "/openapi.json") {
+		t.Error("docs page does not reference /openapi.json")
+	}
+}
@@ -0,0 +1,85 @@
+package healthkit
+
+// Persistence-subsystem health: snapshot writes (the daily rollup today, any
+// future state snapshots) must not fail silently. A read-only volume or full
+// disk would otherwise go unnoticed until a restart loses data. Every write
+// is metered (success/failure counter + duration histogram), consecutive
+// failures flip an internal "persistence" pseudo-service to unhealthy in the
+// same service map every consumer already reads, and binaries can verify the
+// snapshot path is writable at startup before reporting ready.
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// persistenceServiceName is the pseudo-service in the /health service map
+	// that carries the snapshot subsystem's state. Only this file writes it.
+	persistenceServiceName = "persistence"
+	// persistFailureThreshold is how many CONSECUTIVE snapshot-write failures
+	// flip the persistence service to unhealthy. One transient failure (e.g.
+	// a momentary disk stall) should not page anyone; a streak means the
+	// volume is actually broken.
+	persistFailureThreshold = 3
+)
+
+// recordSnapshotWrite feeds one snapshot-write outcome into the metrics and
+// the failure-streak logic. Any success resets the streak and restores the
+// persistence service; reaching the threshold flips it to unhealthy with the
+// latest error as the status message.
+func (h *Service) recordSnapshotWrite(elapsed time.Duration, err error) {
+	h.metrics.snapshotWriteDuration.Observe(elapsed.Seconds())
+	if err == nil {
+		h.metrics.snapshotWrites.WithLabelValues("success").Inc()
+		h.mu.Lock()
+		h.persistFailStreak = 0
+		h.mu.Unlock()
+		h.SetServiceStatus(persistenceServiceName, true)
+		h.SetServiceMessage(persistenceServiceName, "")
+		return
+	}
+	h.metrics.snapshotWrites.WithLabelValues("failure").Inc()
+	h.mu.Lock()
+	h.persistFailStreak++
+	streak := h.persistFailStreak
+	h.mu.Unlock()
+	log.Printf("WARNING: snapshot write failed (%d consecutive): %v", streak, err)
+	if streak >= persistFailureThreshold {
+		h.SetServiceStatus(persistenceServiceName, false)
+		h.SetServiceMessage(persistenceServiceName,
+			fmt.Sprintf("snapshot writes failing (%d consecutive): %v", streak, err))
+	}
+}
+
+// VerifySnapshotPath checks at startup that the directory holding path is
+// actually writable, using the same write+rename sequence real snapshot saves
+// use (os.WriteFile alone would miss a filesystem where create works but
+// rename does not). A failure marks the persistence service unhealthy — so
+// the condition shows up in /health immediately, not on the first shutdown
+// save hours later — and returns the error for the caller to log prominently.
+func (h *Service) VerifySnapshotPath(path string) error {
+	dir := filepath.Dir(path)
+	probe := filepath.Join(dir, ".snapshot_probe.tmp")
+	final := filepath.Join(dir, ".snapshot_probe")
+	err := os.WriteFile(probe, []byte("probe"), 0o600)
+	if err == nil {
+		err = os.Rename(probe, final)
+		if err != nil {
+			_ = os.Remove(probe)
+		}
+	}
+	_ = os.Remove(final)
+	if err != nil {
+		h.SetServiceStatus(persistenceServiceName, false)
+		h.SetServiceMessage(persistenceServiceName,
+			fmt.Sprintf("snapshot path not writable: %v", err))
+		return fmt.Errorf("snapshot path %s not writable: %w", dir, err)
+	}
+	h.SetServiceStatus(persistenceServiceName, true)
+	h.SetServiceMessage(persistenceServiceName, "")
+	return nil
+}
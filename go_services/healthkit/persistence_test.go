@@ -0,0 +1,112 @@
+package healthkit
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestVerifySnapshotPath_Writable(t *testing.T) {
+	hs := New(WithVersion("test"))
+	path := filepath.Join(t.TempDir(), "rollup.json")
+	if err := hs.VerifySnapshotPath(path); err != nil {
+		t.Fatalf("VerifySnapshotPath on a writable dir: %v", err)
+	}
+	if !hs.GetStatus().Services[persistenceServiceName] {
+		t.Error("persistence service should be healthy after successful verification")
+	}
+	// Probe files must not be left behind.
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".snapshot_probe*"))
+	if len(matches) != 0 {
+		t.Errorf("probe files left behind: %v", matches)
+	}
+}
+
+func TestVerifySnapshotPath_Unwritable(t *testing.T) {
+	hs := New(WithVersion("test"))
+	// A directory that does not exist: the probe write fails the same way a
+	// read-only or missing volume would (os.Chmod is unreliable here — tests
+	// may run as root, which ignores permission bits).
+	path := filepath.Join(t.TempDir(), "missing", "rollup.json")
+	if err := hs.VerifySnapshotPath(path); err == nil {
+		t.Fatal("VerifySnapshotPath on a missing dir should fail")
+	}
+	if hs.GetStatus().Services[persistenceServiceName] {
+		t.Error("persistence service should be unhealthy after failed verification")
+	}
+	if msg := hs.ServiceMessages()[persistenceServiceName]; !strings.Contains(msg, "not writable") {
+		t.Errorf("message = %q, want a not-writable note", msg)
+	}
+}
+
+func TestSaveRollup_FailureStreak(t *testing.T) {
+	hs := New(WithVersion("test"))
+	goodPath := filepath.Join(t.TempDir(), "rollup.json")
+	badPath := filepath.Join(t.TempDir(), "missing", "rollup.json")
+
+	// Establish a healthy baseline so we can see that a short streak does
+	// NOT flip the service.
+	if err := hs.SaveRollup(goodPath); err != nil {
+		t.Fatalf("baseline save: %v", err)
+	}
+	if !hs.GetStatus().Services[persistenceServiceName] {
+		t.Fatal("persistence should be healthy after a successful save")
+	}
+
+	// Two failures: below the threshold, still healthy.
+	for i := 0; i < persistFailureThreshold-1; i++ {
+		if err := hs.SaveRollup(badPath); err == nil {
+			t.Fatal("save to a missing dir should fail")
+		}
+	}
+	if !hs.GetStatus().Services[persistenceServiceName] {
+		t.Fatalf("persistence flipped before %d consecutive failures", persistFailureThreshold)
+	}
+
+	// Third consecutive failure crosses the threshold.
+	if err := hs.SaveRollup(badPath); err == nil {
+		t.Fatal("save to a missing dir should fail")
+	}
+	if hs.GetStatus().Services[persistenceServiceName] {
+		t.Fatalf("persistence should be unhealthy after %d consecutive failures", persistFailureThreshold)
+	}
+	if msg := hs.ServiceMessages()[persistenceServiceName]; !strings.Contains(msg, "snapshot writes failing") {
+		t.Errorf("message = %q, want a failing-streak note", msg)
+	}
+
+	// One success resets the streak and restores the service.
+	if err := hs.SaveRollup(goodPath); err != nil {
+		t.Fatalf("recovery save: %v", err)
+	}
+	if !hs.GetStatus().Services[persistenceServiceName] {
+		t.Error("persistence should recover on the next successful save")
+	}
+	if msg, ok := hs.ServiceMessages()[persistenceServiceName]; ok {
+		t.Errorf("failure message not cleared on recovery: %q", msg)
+	}
+
+	if got := testutil.ToFloat64(hs.metrics.snapshotWrites.WithLabelValues("failure")); got != float64(persistFailureThreshold) {
+		t.Errorf("failure counter = %v, want %d", got, persistFailureThreshold)
+	}
+	if got := testutil.ToFloat64(hs.metrics.snapshotWrites.WithLabelValues("success")); got != 2 {
+		t.Errorf("success counter = %v, want 2", got)
+	}
+}
+
+func TestSaveRollup_AtomicReplace(t *testing.T) {
+	hs := New(WithVersion("test"))
+	path := filepath.Join(t.TempDir(), "rollup.json")
+	if err := hs.SaveRollup(path); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	// The temp file from the write+rename sequence must not survive.
+	matches, _ := filepath.Glob(path + ".tmp")
+	if len(matches) != 0 {
+		t.Errorf("temp file left behind: %v", matches)
+	}
+	if err := hs.LoadRollup(path); err != nil {
+		t.Fatalf("reload of saved snapshot: %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package healthkit
+
+// Active health probes (HTTP, TCP connect, exec): instead of only accepting
+// statuses pushed by the Python side, the service can probe named
+// dependencies itself and feed the
+// results into the same service map (SetServiceStatus + SetServiceMessage).
+// Probe outcomes are therefore indistinguishable from pushed statuses to
+// every consumer — /health, readiness, the paginated list — which is the
+// point: one model, two feeders. The first production use case is probing the
+// url_fetcher sibling at http://127.0.0.1:8081/health.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Probe timing/validation bounds. Fail-safe like every other env knob: an
+// out-of-range value falls back to the default with a warning rather than
+// creating a pathological probe (a 0s interval is a self-inflicted DoS).
+const (
+	defaultProbeIntervalSeconds = 30
+	defaultProbeTimeoutSeconds  = 5
+	maxProbeIntervalSeconds     = 3600
+	maxProbeTimeoutSeconds      = 60
+)
+
+// Probe types. HTTP is the default; tcp covers dependencies that don't speak
+// HTTP (Postgres, Redis — healthy means the port accepts a connection), and
+// exec runs an arbitrary check command (healthy means exit 0), for anything
+// a socket can't answer.
+const (
+	probeTypeHTTP = "http"
+	probeTypeTCP  = "tcp"
+	probeTypeExec = "exec"
+)
+
+// ProbeConfig describes one active probe target. Which fields apply depends
+// on Type: http uses URL (+ ExpectStatus), tcp uses Address, exec uses
+// Command. Name, interval and timeout are shared.
+type ProbeConfig struct {
+	Name            string   `json:"name"`
+	Type            string   `json:"type,omitempty"` // "http" (default), "tcp" or "exec"
+	URL             string   `json:"url,omitempty"`
+	Address         string   `json:"address,omitempty"`          // tcp: host:port
+	Command         []string `json:"command,omitempty"`          // exec: argv, Command[0] is the binary
+	IntervalSeconds int      `json:"interval_seconds,omitempty"` // default 30
+	TimeoutSeconds  int      `json:"timeout_seconds,omitempty"`  // default 5
+	ExpectStatus    int      `json:"expect_status,omitempty"`    // http only, default 200
+}
+
+// normalizeProbe validates one config entry, applying defaults. A non-""
+// second return is the stable reason the entry was rejected.
+func normalizeProbe(p ProbeConfig) (ProbeConfig, string) {
+	if len(p.Name) == 0 || len(p.Name) > 100 {
+		return p, "invalid_name"
+	}
+	if p.Type == "" {
+		p.Type = probeTypeHTTP
+	}
+	switch p.Type {
+	case probeTypeHTTP:
+		u, err := url.Parse(p.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return p, "invalid_url"
+		}
+	case probeTypeTCP:
+		if _, _, err := net.SplitHostPort(p.Address); err != nil {
+			return p, "invalid_address"
+		}
+	case probeTypeExec:
+		if len(p.Command) == 0 || strings.TrimSpace(p.Command[0]) == "" {
+			return p, "invalid_command"
+		}
+	default:
+		return p, "invalid_type"
+	}
+	if p.IntervalSeconds == 0 {
+		p.IntervalSeconds = defaultProbeIntervalSeconds
+	}
+	if p.IntervalSeconds < 1 || p.IntervalSeconds > maxProbeIntervalSeconds {
+		return p, "invalid_interval"
+	}
+	if p.TimeoutSeconds == 0 {
+		p.TimeoutSeconds = defaultProbeTimeoutSeconds
+	}
+	if p.TimeoutSeconds < 1 || p.TimeoutSeconds > maxProbeTimeoutSeconds {
+		return p, "invalid_timeout"
+	}
+	if p.ExpectStatus == 0 {
+		p.ExpectStatus = http.StatusOK
+	}
+	if p.ExpectStatus < 100 || p.ExpectStatus > 599 {
+		return p, "invalid_expect_status"
+	}
+	return p, ""
+}
+
+// ProbesFromEnv reads the HEALTH_PROBES JSON array, e.g.:
+//
+//	HEALTH_PROBES='[{"name":"url_fetcher","url":"http://127.0.0.1:8081/health"}]'
+//
+// Unparsable JSON disables probing with a warning; individually invalid
+// entries are skipped with a warning so one typo doesn't silence the rest.
+func ProbesFromEnv() []ProbeConfig {
+	raw := strings.TrimSpace(os.Getenv("HEALTH_PROBES"))
+	if raw == "" {
+		return nil
+	}
+	var configs []ProbeConfig
+	if err := json.Unmarshal([]byte(raw), &configs); err != nil {
+		log.Printf("WARNING: invalid HEALTH_PROBES JSON (%v) — active probing disabled", err)
+		return nil
+	}
+	out := make([]ProbeConfig, 0, len(configs))
+	for i, p := range configs {
+		normalized, reason := normalizeProbe(p)
+		if reason != "" {
+			log.Printf("WARNING: skipping HEALTH_PROBES entry %d (%q): %s", i, p.Name, reason)
+			continue
+		}
+		out = append(out, normalized)
+	}
+	return out
+}
+
+// runProbe executes one probe round and feeds the outcome into the service
+// map. Failures carry the error as the service's status message (sanitized
+// like every message); a success clears any previous failure note. Every
+// round, healthy or not, records its latency into probeDuration — probe
+// slowness is often the first symptom of a degrading dependency.
+func (h *Service) runProbe(ctx context.Context, client *http.Client, p ProbeConfig) {
+	reqCtx, cancel := context.WithTimeout(ctx, time.Duration(p.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	start := h.clock.Now()
+	var healthy bool
+	var note string
+	switch p.Type {
+	case probeTypeTCP:
+		healthy, note = probeTCP(reqCtx, p)
+	case probeTypeExec:
+		healthy, note = probeExec(reqCtx, p)
+	default:
+		healthy, note = probeHTTP(reqCtx, client, p)
+	}
+	h.metrics.probeDuration.WithLabelValues(p.Name).Observe(h.clock.Now().Sub(start).Seconds())
+
+	h.SetServiceStatus(p.Name, healthy)
+	h.SetServiceMessage(p.Name, note)
+}
+
+// probeHTTP reports healthy when GET p.URL answers p.ExpectStatus within the
+// context deadline.
+func probeHTTP(ctx context.Context, client *http.Client, p ProbeConfig) (bool, string) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		// normalizeProbe vetted the URL, so this is effectively unreachable —
+		// but a probe must never crash the service over it.
+		return false, fmt.Sprintf("probe request error: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Sprintf("probe failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != p.ExpectStatus {
+		return false, fmt.Sprintf("probe: HTTP %d (want %d)", resp.StatusCode, p.ExpectStatus)
+	}
+	return true, ""
+}
+
+// probeTCP reports healthy when p.Address accepts a TCP connection within the
+// context deadline. Enough for Postgres/Redis liveness — a refused or timed-
+// out connect is exactly the condition we want to surface.
+func probeTCP(ctx context.Context, p ProbeConfig) (bool, string) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", p.Address)
+	if err != nil {
+		return false, fmt.Sprintf("probe failed: %v", err)
+	}
+	_ = conn.Close()
+	return true, ""
+}
+
+// probeExec reports healthy when the command exits 0 within the context
+// deadline. The command runs in its own process group (see configureExecProbe)
+// so a timeout kills the whole tree, not just the direct child — otherwise a
+// check script that shells out would leak zombies on every timed-out round.
+func probeExec(ctx context.Context, p ProbeConfig) (bool, string) {
+	cmd := exec.CommandContext(ctx, p.Command[0], p.Command[1:]...)
+	configureExecProbe(cmd)
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return false, fmt.Sprintf("probe timed out: %v", ctx.Err())
+		}
+		return false, fmt.Sprintf("probe failed: %v", err)
+	}
+	return true, ""
+}
+
+// RunProbes starts one goroutine per probe and returns immediately; all
+// goroutines stop when ctx is cancelled (pass the same context that drives
+// StartCollector so one shutdown stops everything). Each probe runs
+// SYNCHRONOUSLY inside its own loop — a round that outlasts the interval
+// simply delays the next tick rather than overlapping with itself, so a
+// wedged dependency can never stack up probe goroutines.
+func (h *Service) RunProbes(ctx context.Context, probes []ProbeConfig) {
+	h.reloadMu.Lock()
+	defer h.reloadMu.Unlock()
+	// Remember the parent and run under a cancellable child so a config
+	// reload can stop this probe set and start the replacement under the
+	// same parent lifetime (see restartProbesLocked in reload.go).
+	h.probeParent = ctx
+	probeCtx, cancel := context.WithCancel(ctx)
+	h.probeCancel = cancel
+	h.startProbes(probeCtx, probes)
+	// Publish the running set into the Config snapshot so a reload can tell
+	// an actually-changed HEALTH_PROBES from a byte-identical restart.
+	cfg := *h.config()
+	cfg.Probes = probes
+	h.liveCfg.Store(&cfg)
+}
+
+// startProbes spawns the per-probe goroutines. Callers own ctx cancellation.
+func (h *Service) startProbes(ctx context.Context, probes []ProbeConfig) {
+	for _, p := range probes {
+		go func(p ProbeConfig) {
+			var client *http.Client
+			if p.Type == probeTypeHTTP || p.Type == "" {
+				client = &http.Client{Timeout: time.Duration(p.TimeoutSeconds) * time.Second}
+			}
+			// First round immediately: /health should reflect reality at
+			// startup, not interval seconds later.
+			h.runProbe(ctx, client, p)
+
+			ticker := h.clock.NewTicker(time.Duration(p.IntervalSeconds) * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C():
+					h.runProbe(ctx, client, p)
+				}
+			}
+		}(p)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package healthkit
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// configureExecProbe puts the probe command in its own process group and
+// makes context cancellation kill that whole group. The default
+// CommandContext cancel only signals the direct child — a check script that
+// shelled out would leave its children running (and zombied) after every
+// timed-out round.
+func configureExecProbe(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		if cmd.Process == nil {
+			return nil
+		}
+		// Negative pid = the whole process group.
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package healthkit
+
+import "os/exec"
+
+// configureExecProbe is a no-op on Windows: there are no Unix process groups
+// to manage, and CommandContext's default TerminateProcess on cancellation is
+// the best available behavior.
+func configureExecProbe(_ *exec.Cmd) {}
@@ -0,0 +1,292 @@
+package healthkit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNormalizeProbe(t *testing.T) {
+	tests := []struct {
+		name       string
+		in         ProbeConfig
+		wantReason string
+	}{
+		{"defaults applied", ProbeConfig{Name: "x", URL: "http://127.0.0.1:8081/health"}, ""},
+		{"empty name", ProbeConfig{URL: "http://h/"}, "invalid_name"},
+		{"overlong name", ProbeConfig{Name: strings.Repeat("n", 101), URL: "http://h/"}, "invalid_name"},
+		{"bad scheme", ProbeConfig{Name: "x", URL: "ftp://h/"}, "invalid_url"},
+		{"no host", ProbeConfig{Name: "x", URL: "http://"}, "invalid_url"},
+		{"negative interval", ProbeConfig{Name: "x", URL: "http://h/", IntervalSeconds: -1}, "invalid_interval"},
+		{"interval too long", ProbeConfig{Name: "x", URL: "http://h/", IntervalSeconds: 7200}, "invalid_interval"},
+		{"timeout too long", ProbeConfig{Name: "x", URL: "http://h/", TimeoutSeconds: 120}, "invalid_timeout"},
+		{"bad expect status", ProbeConfig{Name: "x", URL: "http://h/", ExpectStatus: 600}, "invalid_expect_status"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, reason := normalizeProbe(tc.in)
+			if reason != tc.wantReason {
+				t.Fatalf("reason = %q, want %q", reason, tc.wantReason)
+			}
+			if reason == "" {
+				if got.IntervalSeconds != defaultProbeIntervalSeconds ||
+					got.TimeoutSeconds != defaultProbeTimeoutSeconds ||
+					got.ExpectStatus != http.StatusOK {
+					t.Errorf("defaults not applied: %+v", got)
+				}
+			}
+		})
+	}
+}
+
+func TestProbesFromEnv(t *testing.T) {
+	t.Setenv("HEALTH_PROBES",
+		`[{"name":"url_fetcher","url":"http://127.0.0.1:8081/health"},{"name":"","url":"http://h/"}]`)
+	probes := ProbesFromEnv()
+	if len(probes) != 1 || probes[0].Name != "url_fetcher" {
+		t.Fatalf("probes = %+v, want only the valid url_fetcher entry", probes)
+	}
+
+	t.Setenv("HEALTH_PROBES", "{not json")
+	if got := ProbesFromEnv(); got != nil {
+		t.Errorf("invalid JSON should disable probing, got %+v", got)
+	}
+
+	t.Setenv("HEALTH_PROBES", "")
+	if got := ProbesFromEnv(); got != nil {
+		t.Errorf("unset should return nil, got %+v", got)
+	}
+}
+
+func TestRunProbe_StatusTransitions(t *testing.T) {
+	// The upstream flips between 200 and 500; each probe round must move the
+	// service map to match, with the failure note appearing and clearing.
+	var status atomic.Int64
+	status.Store(http.StatusOK)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer ts.Close()
+
+	hs := New(WithVersion("test"))
+	probe, reason := normalizeProbe(ProbeConfig{Name: "dep", URL: ts.URL})
+	if reason != "" {
+		t.Fatalf("setup: %s", reason)
+	}
+	client := ts.Client()
+
+	hs.runProbe(context.Background(), client, probe)
+	if st := hs.GetStatus(); !st.Services["dep"] {
+		t.Fatal("200 round should mark dep healthy")
+	}
+
+	status.Store(http.StatusInternalServerError)
+	hs.runProbe(context.Background(), client, probe)
+	st := hs.GetStatus()
+	if st.Services["dep"] {
+		t.Fatal("500 round should mark dep unhealthy")
+	}
+	if msg := hs.ServiceMessages()["dep"]; !strings.Contains(msg, "HTTP 500") {
+		t.Errorf("failure message = %q, want one naming HTTP 500", msg)
+	}
+
+	status.Store(http.StatusOK)
+	hs.runProbe(context.Background(), client, probe)
+	if st := hs.GetStatus(); !st.Services["dep"] {
+		t.Fatal("recovery round should mark dep healthy again")
+	}
+	if msg, ok := hs.ServiceMessages()["dep"]; ok {
+		t.Errorf("failure message not cleared on recovery: %q", msg)
+	}
+
+	// Connection-level failure (server closed): unhealthy with an error note.
+	ts.Close()
+	hs.runProbe(context.Background(), client, probe)
+	if st := hs.GetStatus(); st.Services["dep"] {
+		t.Fatal("connection failure should mark dep unhealthy")
+	}
+	if msg := hs.ServiceMessages()["dep"]; !strings.Contains(msg, "probe failed") {
+		t.Errorf("failure message = %q, want a probe-failed note", msg)
+	}
+}
+
+func TestRunProbes_TickerAndShutdown(t *testing.T) {
+	var rounds atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rounds.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	fc := newFakeClock(time.Unix(1000, 0))
+	hs := New(WithVersion("test"), WithClock(fc))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hs.RunProbes(ctx, []ProbeConfig{{
+		Name: "dep", URL: ts.URL, IntervalSeconds: 30, TimeoutSeconds: 5, ExpectStatus: 200,
+	}})
+
+	// The immediate first round lands without any tick.
+	waitFor(t, func() bool { return rounds.Load() == 1 })
+	if st := hs.GetStatus(); !st.Services["dep"] {
+		t.Fatal("first round should have registered dep healthy")
+	}
+
+	// Each interval tick drives exactly one more round.
+	fc.Advance(30 * time.Second)
+	waitFor(t, func() bool { return rounds.Load() == 2 })
+
+	// Cancellation stops the loop: no further rounds after more ticks.
+	cancel()
+	time.Sleep(20 * time.Millisecond) // let the goroutine observe ctx.Done
+	fc.Advance(30 * time.Second)
+	time.Sleep(20 * time.Millisecond)
+	if got := rounds.Load(); got != 2 {
+		t.Errorf("rounds after cancel = %d, want 2", got)
+	}
+}
+
+// waitFor polls cond with a deadline — probe rounds land on their own
+// goroutine, so assertions must wait rather than race.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func TestNormalizeProbe_Types(t *testing.T) {
+	tests := []struct {
+		name       string
+		in         ProbeConfig
+		wantReason string
+	}{
+		{"tcp valid", ProbeConfig{Name: "pg", Type: "tcp", Address: "127.0.0.1:5432"}, ""},
+		{"tcp missing port", ProbeConfig{Name: "pg", Type: "tcp", Address: "127.0.0.1"}, "invalid_address"},
+		{"tcp empty address", ProbeConfig{Name: "pg", Type: "tcp"}, "invalid_address"},
+		{"exec valid", ProbeConfig{Name: "disk", Type: "exec", Command: []string{"true"}}, ""},
+		{"exec empty command", ProbeConfig{Name: "disk", Type: "exec"}, "invalid_command"},
+		{"exec blank binary", ProbeConfig{Name: "disk", Type: "exec", Command: []string{"  "}}, "invalid_command"},
+		{"unknown type", ProbeConfig{Name: "x", Type: "udp", Address: "127.0.0.1:53"}, "invalid_type"},
+		{"empty type defaults to http", ProbeConfig{Name: "x", URL: "http://127.0.0.1:8081/health"}, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, reason := normalizeProbe(tc.in)
+			if reason != tc.wantReason {
+				t.Fatalf("reason = %q, want %q", reason, tc.wantReason)
+			}
+			if reason == "" && tc.in.Type == "" && got.Type != probeTypeHTTP {
+				t.Errorf("Type = %q, want default %q", got.Type, probeTypeHTTP)
+			}
+		})
+	}
+}
+
+func TestRunProbe_TCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	hs := New(WithVersion("test"))
+	probe, reason := normalizeProbe(ProbeConfig{Name: "pg", Type: "tcp", Address: addr})
+	if reason != "" {
+		t.Fatalf("setup: %s", reason)
+	}
+
+	hs.runProbe(context.Background(), nil, probe)
+	if !hs.GetStatus().Services["pg"] {
+		t.Fatal("open port should probe healthy")
+	}
+
+	_ = ln.Close()
+	hs.runProbe(context.Background(), nil, probe)
+	if hs.GetStatus().Services["pg"] {
+		t.Fatal("closed port should probe unhealthy")
+	}
+	if msg := hs.ServiceMessages()["pg"]; !strings.Contains(msg, "probe failed") {
+		t.Errorf("message = %q, want a probe-failed note", msg)
+	}
+
+	// Latency landed in the histogram under the probe's name.
+	if got := testutil.CollectAndCount(hs.metrics.probeDuration); got != 1 {
+		t.Errorf("probe_duration series = %d, want 1", got)
+	}
+}
+
+func TestRunProbe_Exec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("relies on POSIX true/false/sh")
+	}
+	hs := New(WithVersion("test"))
+
+	ok, reason := normalizeProbe(ProbeConfig{Name: "chk", Type: "exec", Command: []string{"true"}})
+	if reason != "" {
+		t.Fatalf("setup: %s", reason)
+	}
+	hs.runProbe(context.Background(), nil, ok)
+	if !hs.GetStatus().Services["chk"] {
+		t.Fatal("exit 0 should probe healthy")
+	}
+
+	bad, _ := normalizeProbe(ProbeConfig{Name: "chk", Type: "exec", Command: []string{"false"}})
+	hs.runProbe(context.Background(), nil, bad)
+	if hs.GetStatus().Services["chk"] {
+		t.Fatal("exit 1 should probe unhealthy")
+	}
+	if msg := hs.ServiceMessages()["chk"]; !strings.Contains(msg, "probe failed") {
+		t.Errorf("message = %q, want a probe-failed note", msg)
+	}
+}
+
+func TestRunProbe_ExecTimeoutKillsProcessGroup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process groups are POSIX-only")
+	}
+	hs := New(WithVersion("test"))
+	// The shell spawns a grandchild sleep; on timeout the whole group must
+	// die, and Run must return promptly rather than waiting out the sleep.
+	probe, reason := normalizeProbe(ProbeConfig{
+		Name: "slow", Type: "exec", TimeoutSeconds: 1,
+		Command: []string{"sh", "-c", "sleep 30 & wait"},
+	})
+	if reason != "" {
+		t.Fatalf("setup: %s", reason)
+	}
+
+	start := time.Now()
+	hs.runProbe(context.Background(), nil, probe)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("probe round took %v — the process group was not killed on timeout", elapsed)
+	}
+	if hs.GetStatus().Services["slow"] {
+		t.Fatal("timed-out probe should be unhealthy")
+	}
+	if msg := hs.ServiceMessages()["slow"]; !strings.Contains(msg, "timed out") {
+		t.Errorf("message = %q, want a timed-out note", msg)
+	}
+}
@@ -0,0 +1,133 @@
+package healthkit
+
+// /stats content negotiation. Some of the surrounding tooling only speaks
+// Prometheus text exposition (version 0.0.4), while /stats has always been
+// JSON. The handler keeps JSON as the default and renders a small hand-rolled
+// exposition on request — deliberately separate from the main registry, which
+// already serves /metrics: this is the HealthStatus summary (uptime, per-
+// service up/down, memory, goroutines, GC) under its own discord_bot_stats_*
+// namespace, not a second scrape of the real metrics.
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statsPromContentType is the exposition content type the Prometheus text
+// parser expects.
+const statsPromContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// statsWantsPrometheus decides the /stats representation. ?format=prometheus
+// wins outright (curl convenience); otherwise the Accept header is scanned in
+// order and the first recognized media type decides — text/plain selects the
+// exposition, application/json and */* keep JSON. Anything unrecognized falls
+// back to JSON, the historical behavior.
+func statsWantsPrometheus(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "prometheus" {
+		return true
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(part, ";", 2)[0]))
+		switch mediaType {
+		case "text/plain":
+			return true
+		case "application/json", "*/*":
+			return false
+		}
+	}
+	return false
+}
+
+// escapePromLabel escapes a label VALUE per the text exposition rules:
+// backslash, double quote and line feed must be escaped; everything else is
+// emitted verbatim.
+func escapePromLabel(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	return v
+}
+
+// promFloat renders a sample value the way the exposition expects (shortest
+// round-trippable decimal form).
+func promFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// writeStatsPromText renders status as Prometheus text exposition. Service
+// names are sorted so consecutive scrapes diff cleanly.
+func (h *Service) writeStatsPromText(w http.ResponseWriter, status HealthStatus) {
+	var b strings.Builder
+
+	// Uptime round-trips through the JSON field's duration string, which
+	// time.Duration.String() guarantees is parseable.
+	if uptime, err := time.ParseDuration(status.Uptime); err == nil {
+		b.WriteString("# HELP discord_bot_stats_uptime_seconds Process uptime in seconds.\n")
+		b.WriteString("# TYPE discord_bot_stats_uptime_seconds gauge\n")
+		fmt.Fprintf(&b, "discord_bot_stats_uptime_seconds %s\n", promFloat(uptime.Seconds()))
+	}
+
+	if len(status.Services) > 0 {
+		names := make([]string, 0, len(status.Services))
+		for name := range status.Services {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		b.WriteString("# HELP discord_bot_stats_service_up Per-service health from /stats (1 healthy, 0 unhealthy).\n")
+		b.WriteString("# TYPE discord_bot_stats_service_up gauge\n")
+		for _, name := range names {
+			up := 0
+			if status.Services[name] {
+				up = 1
+			}
+			fmt.Fprintf(&b, "discord_bot_stats_service_up{service=%q} %d\n", escapePromLabel(name), up)
+		}
+	}
+
+	// The runtime figures mirror the JSON metrics map; MB keys convert back
+	// to base units per Prometheus naming conventions.
+	type sample struct {
+		jsonKey string
+		name    string
+		typ     string
+		help    string
+		scale   float64
+	}
+	for _, s := range []sample{
+		{"memory_alloc_mb", "discord_bot_stats_memory_alloc_bytes", "gauge", "Heap bytes allocated and in use.", 1024 * 1024},
+		{"memory_sys_mb", "discord_bot_stats_memory_sys_bytes", "gauge", "Bytes obtained from the OS.", 1024 * 1024},
+		{"goroutines", "discord_bot_stats_goroutines", "gauge", "Current goroutine count.", 1},
+		{"gc_cycles", "discord_bot_stats_gc_cycles_total", "counter", "Completed GC cycles.", 1},
+	} {
+		v, ok := statsMetricFloat(status.Metrics[s.jsonKey])
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s %s\n",
+			s.name, s.help, s.name, s.typ, s.name, promFloat(v*s.scale))
+	}
+
+	w.Header().Set("Content-Type", statsPromContentType)
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// statsMetricFloat coerces a metrics-map value (float64, int or uint64
+// depending on the key) to float64.
+func statsMetricFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
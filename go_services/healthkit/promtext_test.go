@@ -0,0 +1,145 @@
+package healthkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestStatsWantsPrometheus(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		query  string
+		want   bool
+	}{
+		{"no accept defaults to json", "", "", false},
+		{"explicit json", "application/json", "", false},
+		{"wildcard stays json", "*/*", "", false},
+		{"text/plain selects prometheus", "text/plain", "", true},
+		{"exposition content type", "text/plain; version=0.0.4", "", true},
+		{"first recognized type wins", "application/json, text/plain", "", false},
+		{"text/plain before json", "text/plain, application/json", "", true},
+		{"unrecognized falls back to json", "text/html", "", false},
+		{"format override", "", "format=prometheus", true},
+		{"format override beats accept", "application/json", "format=prometheus", true},
+		{"other format value ignored", "", "format=xml", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/stats?"+tt.query, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			if got := statsWantsPrometheus(req); got != tt.want {
+				t.Errorf("statsWantsPrometheus() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapePromLabel(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"bot", "bot"},
+		{`back\slash`, `back\\slash`},
+		{`quo"te`, `quo\"te`},
+		{"line\nfeed", `line\nfeed`},
+		{`all"three` + "\n" + `\`, `all\"three\n\\`},
+	}
+	for _, tt := range tests {
+		if got := escapePromLabel(tt.in); got != tt.want {
+			t.Errorf("escapePromLabel(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// promSampleRe matches one exposition sample line: name, optional label set,
+// value. Tests below run every non-comment line through it so a malformed
+// render cannot sneak past the content checks.
+var promSampleRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*(\{[a-zA-Z_]+="(?:[^"\\]|\\.)*"(,[a-zA-Z_]+="(?:[^"\\]|\\.)*")*\})? -?[0-9.e+-]+$`)
+
+func statsPromBody(t *testing.T, hs *Service, accept, query string) string {
+	t.Helper()
+	r := hs.Routes()
+	req := httptest.NewRequest(http.MethodGet, "/stats"+query, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/stats: code = %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != statsPromContentType {
+		t.Fatalf("Content-Type = %q, want %q", ct, statsPromContentType)
+	}
+	return rec.Body.String()
+}
+
+func TestHandleStats_PrometheusAccept(t *testing.T) {
+	hs := New(WithVersion("test"))
+	hs.SetServiceStatus("bot", true)
+	hs.SetServiceStatus("rag_engine", false)
+	hs.CollectSystemMetrics()
+
+	body := statsPromBody(t, hs, "text/plain; version=0.0.4", "")
+
+	for _, line := range strings.Split(strings.TrimRight(body, "\n"), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !promSampleRe.MatchString(line) {
+			t.Errorf("malformed exposition line: %q", line)
+		}
+	}
+	for _, want := range []string{
+		"# TYPE discord_bot_stats_uptime_seconds gauge",
+		`discord_bot_stats_service_up{service="bot"} 1`,
+		`discord_bot_stats_service_up{service="rag_engine"} 0`,
+		"# TYPE discord_bot_stats_memory_alloc_bytes gauge",
+		"# TYPE discord_bot_stats_goroutines gauge",
+		"# TYPE discord_bot_stats_gc_cycles_total counter",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("exposition missing %q\n%s", want, body)
+		}
+	}
+	// Sorted label output: bot before rag_engine.
+	if strings.Index(body, `service="bot"`) > strings.Index(body, `service="rag_engine"`) {
+		t.Error("service samples not sorted by name")
+	}
+}
+
+func TestHandleStats_FormatOverride(t *testing.T) {
+	hs := New(WithVersion("test"))
+	hs.SetServiceStatus("bot", true)
+	body := statsPromBody(t, hs, "", "?format=prometheus")
+	if !strings.Contains(body, `discord_bot_stats_service_up{service="bot"} 1`) {
+		t.Errorf("format=prometheus did not render exposition:\n%s", body)
+	}
+}
+
+func TestHandleStats_JSONDefaultUnchanged(t *testing.T) {
+	hs := New(WithVersion("test"))
+	hs.SetServiceStatus("bot", true)
+	r := hs.Routes()
+
+	for _, accept := range []string{"", "application/json", "*/*"} {
+		req := httptest.NewRequest(http.MethodGet, "/stats", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Accept %q: Content-Type = %q, want application/json", accept, ct)
+		}
+		if !strings.HasPrefix(rec.Body.String(), "{") {
+			t.Errorf("Accept %q: body is not JSON", accept)
+		}
+	}
+}
@@ -0,0 +1,562 @@
+// HealthMetrics: the gRPC mirror of the health_api push/read surface.
+//
+// The Python bot already speaks grpc.aio for other integrations, and at our
+// batch sizes JSON-over-HTTP adds measurable encode/decode overhead per
+// push. This contract exposes the same three operations the HTTP surface
+// serves — streaming metric push, service status writes, and the health
+// snapshot — so a client can switch transports without changing semantics:
+//
+//   - PushMetrics streams MetricPoint messages and answers one PushSummary.
+//     Every point goes through the SAME validation as POST /metrics/push
+//     (metric-name allowlist, label sanitization, negative-counter
+//     rejection); rejected points are counted per stable reason string, the
+//     same vocabulary the HTTP error envelope uses, and never abort the
+//     stream.
+//   - SetServiceStatus mirrors POST /health/service, including the service
+//     map cap and name bounds.
+//   - GetHealth mirrors GET /health's semantic fields (the memory/goroutine
+//     metrics map stays HTTP-only — scrape /metrics for numbers).
+//
+// The Go server lives in healthkit/grpcserver.go, backed by the existing
+// healthkit.Service methods (applyMetric, SetServiceStatus, GetStatus) so
+// the two transports cannot drift; health_api starts the listener when
+// GRPC_PORT is set and drains it alongside the HTTP servers. Regenerate the
+// Go code with buf (see buf.gen.yaml in this directory).
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: healthmetrics.proto
+
+package healthmetricspb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// MetricPoint is one pushed sample — the streaming equivalent of a
+// POST /metrics/push body.
+type MetricPoint struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// type selects the metric family: "counter", "gauge", "histogram" or
+	// "summary_set", exactly as the HTTP push path accepts.
+	Type string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	// name must be on the server's metric-name allowlist (or registered
+	// dynamically via the HTTP surface); unknown names are rejected with
+	// reason "unknown_name".
+	Name  string  `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Value float64 `protobuf:"fixed64,3,opt,name=value,proto3" json:"value,omitempty"`
+	// labels are sanitized against the server's per-label allowlists; values
+	// off the list collapse to "other", never reject.
+	Labels map[string]string `protobuf:"bytes,4,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// op applies to gauges only: "set" (default), "inc" or "dec".
+	Op            string `protobuf:"bytes,5,opt,name=op,proto3" json:"op,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetricPoint) Reset() {
+	*x = MetricPoint{}
+	mi := &file_healthmetrics_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricPoint) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricPoint) ProtoMessage() {}
+
+func (x *MetricPoint) ProtoReflect() protoreflect.Message {
+	mi := &file_healthmetrics_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricPoint.ProtoReflect.Descriptor instead.
+func (*MetricPoint) Descriptor() ([]byte, []int) {
+	return file_healthmetrics_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *MetricPoint) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *MetricPoint) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *MetricPoint) GetValue() float64 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+func (x *MetricPoint) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+func (x *MetricPoint) GetOp() string {
+	if x != nil {
+		return x.Op
+	}
+	return ""
+}
+
+// PushSummary closes a PushMetrics stream.
+type PushSummary struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Accepted uint64                 `protobuf:"varint,1,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	Rejected uint64                 `protobuf:"varint,2,opt,name=rejected,proto3" json:"rejected,omitempty"`
+	// rejected_by_reason counts rejections per stable reason string
+	// ("unknown_name", "negative_counter", ...), the same vocabulary as the
+	// HTTP error envelope codes.
+	RejectedByReason map[string]uint64 `protobuf:"bytes,3,rep,name=rejected_by_reason,json=rejectedByReason,proto3" json:"rejected_by_reason,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *PushSummary) Reset() {
+	*x = PushSummary{}
+	mi := &file_healthmetrics_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PushSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PushSummary) ProtoMessage() {}
+
+func (x *PushSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_healthmetrics_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PushSummary.ProtoReflect.Descriptor instead.
+func (*PushSummary) Descriptor() ([]byte, []int) {
+	return file_healthmetrics_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PushSummary) GetAccepted() uint64 {
+	if x != nil {
+		return x.Accepted
+	}
+	return 0
+}
+
+func (x *PushSummary) GetRejected() uint64 {
+	if x != nil {
+		return x.Rejected
+	}
+	return 0
+}
+
+func (x *PushSummary) GetRejectedByReason() map[string]uint64 {
+	if x != nil {
+		return x.RejectedByReason
+	}
+	return nil
+}
+
+// ServiceStatusRequest mirrors POST /health/service.
+type ServiceStatusRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Name    string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Healthy bool                   `protobuf:"varint,2,opt,name=healthy,proto3" json:"healthy,omitempty"`
+	// message is the optional status note; sanitized server-side like the
+	// HTTP path.
+	Message       string `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ServiceStatusRequest) Reset() {
+	*x = ServiceStatusRequest{}
+	mi := &file_healthmetrics_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServiceStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServiceStatusRequest) ProtoMessage() {}
+
+func (x *ServiceStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_healthmetrics_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServiceStatusRequest.ProtoReflect.Descriptor instead.
+func (*ServiceStatusRequest) Descriptor() ([]byte, []int) {
+	return file_healthmetrics_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ServiceStatusRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ServiceStatusRequest) GetHealthy() bool {
+	if x != nil {
+		return x.Healthy
+	}
+	return false
+}
+
+func (x *ServiceStatusRequest) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type ServiceStatusReply struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Accepted bool                   `protobuf:"varint,1,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	// reason is the stable rejection reason when accepted is false
+	// ("invalid_name", "service_map_full", ...).
+	Reason        string `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ServiceStatusReply) Reset() {
+	*x = ServiceStatusReply{}
+	mi := &file_healthmetrics_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServiceStatusReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServiceStatusReply) ProtoMessage() {}
+
+func (x *ServiceStatusReply) ProtoReflect() protoreflect.Message {
+	mi := &file_healthmetrics_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServiceStatusReply.ProtoReflect.Descriptor instead.
+func (*ServiceStatusReply) Descriptor() ([]byte, []int) {
+	return file_healthmetrics_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ServiceStatusReply) GetAccepted() bool {
+	if x != nil {
+		return x.Accepted
+	}
+	return false
+}
+
+func (x *ServiceStatusReply) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type Empty struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Empty) Reset() {
+	*x = Empty{}
+	mi := &file_healthmetrics_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Empty) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Empty) ProtoMessage() {}
+
+func (x *Empty) ProtoReflect() protoreflect.Message {
+	mi := &file_healthmetrics_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Empty.ProtoReflect.Descriptor instead.
+func (*Empty) Descriptor() ([]byte, []int) {
+	return file_healthmetrics_proto_rawDescGZIP(), []int{4}
+}
+
+// HealthSnapshot carries the semantic fields of GET /health.
+type HealthSnapshot struct {
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	Status              string                 `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"` // "healthy", "degraded" or "maintenance"
+	Version             string                 `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+	Timestamp           string                 `protobuf:"bytes,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"` // RFC3339 UTC
+	Services            map[string]bool        `protobuf:"bytes,4,rep,name=services,proto3" json:"services,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	UnknownServices     []string               `protobuf:"bytes,5,rep,name=unknown_services,json=unknownServices,proto3" json:"unknown_services,omitempty"`
+	SuppressedServices  []string               `protobuf:"bytes,6,rep,name=suppressed_services,json=suppressedServices,proto3" json:"suppressed_services,omitempty"`
+	OpenBreakers        []string               `protobuf:"bytes,7,rep,name=open_breakers,json=openBreakers,proto3" json:"open_breakers,omitempty"`
+	HeartbeatGeneration uint64                 `protobuf:"varint,8,opt,name=heartbeat_generation,json=heartbeatGeneration,proto3" json:"heartbeat_generation,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *HealthSnapshot) Reset() {
+	*x = HealthSnapshot{}
+	mi := &file_healthmetrics_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HealthSnapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HealthSnapshot) ProtoMessage() {}
+
+func (x *HealthSnapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_healthmetrics_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HealthSnapshot.ProtoReflect.Descriptor instead.
+func (*HealthSnapshot) Descriptor() ([]byte, []int) {
+	return file_healthmetrics_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *HealthSnapshot) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *HealthSnapshot) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *HealthSnapshot) GetTimestamp() string {
+	if x != nil {
+		return x.Timestamp
+	}
+	return ""
+}
+
+func (x *HealthSnapshot) GetServices() map[string]bool {
+	if x != nil {
+		return x.Services
+	}
+	return nil
+}
+
+func (x *HealthSnapshot) GetUnknownServices() []string {
+	if x != nil {
+		return x.UnknownServices
+	}
+	return nil
+}
+
+func (x *HealthSnapshot) GetSuppressedServices() []string {
+	if x != nil {
+		return x.SuppressedServices
+	}
+	return nil
+}
+
+func (x *HealthSnapshot) GetOpenBreakers() []string {
+	if x != nil {
+		return x.OpenBreakers
+	}
+	return nil
+}
+
+func (x *HealthSnapshot) GetHeartbeatGeneration() uint64 {
+	if x != nil {
+		return x.HeartbeatGeneration
+	}
+	return 0
+}
+
+var File_healthmetrics_proto protoreflect.FileDescriptor
+
+const file_healthmetrics_proto_rawDesc = "" +
+	"\n" +
+	"\x13healthmetrics.proto\x12\x10healthmetrics.v1\"\xd9\x01\n" +
+	"\vMetricPoint\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\x01R\x05value\x12A\n" +
+	"\x06labels\x18\x04 \x03(\v2).healthmetrics.v1.MetricPoint.LabelsEntryR\x06labels\x12\x0e\n" +
+	"\x02op\x18\x05 \x01(\tR\x02op\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xed\x01\n" +
+	"\vPushSummary\x12\x1a\n" +
+	"\baccepted\x18\x01 \x01(\x04R\baccepted\x12\x1a\n" +
+	"\brejected\x18\x02 \x01(\x04R\brejected\x12a\n" +
+	"\x12rejected_by_reason\x18\x03 \x03(\v23.healthmetrics.v1.PushSummary.RejectedByReasonEntryR\x10rejectedByReason\x1aC\n" +
+	"\x15RejectedByReasonEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x04R\x05value:\x028\x01\"^\n" +
+	"\x14ServiceStatusRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x18\n" +
+	"\ahealthy\x18\x02 \x01(\bR\ahealthy\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\"H\n" +
+	"\x12ServiceStatusReply\x12\x1a\n" +
+	"\baccepted\x18\x01 \x01(\bR\baccepted\x12\x16\n" +
+	"\x06reason\x18\x02 \x01(\tR\x06reason\"\a\n" +
+	"\x05Empty\"\x9d\x03\n" +
+	"\x0eHealthSnapshot\x12\x16\n" +
+	"\x06status\x18\x01 \x01(\tR\x06status\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\tR\aversion\x12\x1c\n" +
+	"\ttimestamp\x18\x03 \x01(\tR\ttimestamp\x12J\n" +
+	"\bservices\x18\x04 \x03(\v2..healthmetrics.v1.HealthSnapshot.ServicesEntryR\bservices\x12)\n" +
+	"\x10unknown_services\x18\x05 \x03(\tR\x0funknownServices\x12/\n" +
+	"\x13suppressed_services\x18\x06 \x03(\tR\x12suppressedServices\x12#\n" +
+	"\ropen_breakers\x18\a \x03(\tR\fopenBreakers\x121\n" +
+	"\x14heartbeat_generation\x18\b \x01(\x04R\x13heartbeatGeneration\x1a;\n" +
+	"\rServicesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\bR\x05value:\x028\x012\x88\x02\n" +
+	"\rHealthMetrics\x12M\n" +
+	"\vPushMetrics\x12\x1d.healthmetrics.v1.MetricPoint\x1a\x1d.healthmetrics.v1.PushSummary(\x01\x12`\n" +
+	"\x10SetServiceStatus\x12&.healthmetrics.v1.ServiceStatusRequest\x1a$.healthmetrics.v1.ServiceStatusReply\x12F\n" +
+	"\tGetHealth\x12\x17.healthmetrics.v1.Empty\x1a .healthmetrics.v1.HealthSnapshotBUZSgithub.com/voraehita25-star/discord-bot/go_services/healthkit/proto;healthmetricspbb\x06proto3"
+
+var (
+	file_healthmetrics_proto_rawDescOnce sync.Once
+	file_healthmetrics_proto_rawDescData []byte
+)
+
+func file_healthmetrics_proto_rawDescGZIP() []byte {
+	file_healthmetrics_proto_rawDescOnce.Do(func() {
+		file_healthmetrics_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_healthmetrics_proto_rawDesc), len(file_healthmetrics_proto_rawDesc)))
+	})
+	return file_healthmetrics_proto_rawDescData
+}
+
+var file_healthmetrics_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_healthmetrics_proto_goTypes = []any{
+	(*MetricPoint)(nil),          // 0: healthmetrics.v1.MetricPoint
+	(*PushSummary)(nil),          // 1: healthmetrics.v1.PushSummary
+	(*ServiceStatusRequest)(nil), // 2: healthmetrics.v1.ServiceStatusRequest
+	(*ServiceStatusReply)(nil),   // 3: healthmetrics.v1.ServiceStatusReply
+	(*Empty)(nil),                // 4: healthmetrics.v1.Empty
+	(*HealthSnapshot)(nil),       // 5: healthmetrics.v1.HealthSnapshot
+	nil,                          // 6: healthmetrics.v1.MetricPoint.LabelsEntry
+	nil,                          // 7: healthmetrics.v1.PushSummary.RejectedByReasonEntry
+	nil,                          // 8: healthmetrics.v1.HealthSnapshot.ServicesEntry
+}
+var file_healthmetrics_proto_depIdxs = []int32{
+	6, // 0: healthmetrics.v1.MetricPoint.labels:type_name -> healthmetrics.v1.MetricPoint.LabelsEntry
+	7, // 1: healthmetrics.v1.PushSummary.rejected_by_reason:type_name -> healthmetrics.v1.PushSummary.RejectedByReasonEntry
+	8, // 2: healthmetrics.v1.HealthSnapshot.services:type_name -> healthmetrics.v1.HealthSnapshot.ServicesEntry
+	0, // 3: healthmetrics.v1.HealthMetrics.PushMetrics:input_type -> healthmetrics.v1.MetricPoint
+	2, // 4: healthmetrics.v1.HealthMetrics.SetServiceStatus:input_type -> healthmetrics.v1.ServiceStatusRequest
+	4, // 5: healthmetrics.v1.HealthMetrics.GetHealth:input_type -> healthmetrics.v1.Empty
+	1, // 6: healthmetrics.v1.HealthMetrics.PushMetrics:output_type -> healthmetrics.v1.PushSummary
+	3, // 7: healthmetrics.v1.HealthMetrics.SetServiceStatus:output_type -> healthmetrics.v1.ServiceStatusReply
+	5, // 8: healthmetrics.v1.HealthMetrics.GetHealth:output_type -> healthmetrics.v1.HealthSnapshot
+	6, // [6:9] is the sub-list for method output_type
+	3, // [3:6] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_healthmetrics_proto_init() }
+func file_healthmetrics_proto_init() {
+	if File_healthmetrics_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_healthmetrics_proto_rawDesc), len(file_healthmetrics_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_healthmetrics_proto_goTypes,
+		DependencyIndexes: file_healthmetrics_proto_depIdxs,
+		MessageInfos:      file_healthmetrics_proto_msgTypes,
+	}.Build()
+	File_healthmetrics_proto = out.File
+	file_healthmetrics_proto_goTypes = nil
+	file_healthmetrics_proto_depIdxs = nil
+}
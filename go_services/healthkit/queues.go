@@ -0,0 +1,132 @@
+package healthkit
+
+// Queue depth and background-job metrics. The Python bot runs internal
+// asyncio queues (message processing, the AI request queue, the webhook retry
+// queue) whose backlog used to be invisible until users noticed replies
+// arriving minutes late. Three push names make them observable: gauges
+// "queue_depth" and "queue_oldest_age_seconds" and counter "queue_dropped",
+// each carrying a `queue` label validated against the usual bounded
+// allowlist (junk collapses to "other" — see safeLabel). They flow through
+// every ingestion path applyMetric serves: push, batch, stream and statsd.
+//
+// Depth is also watched: when any queue stays above QUEUE_DEPTH_THRESHOLD for
+// longer than QUEUE_DEPTH_GRACE_SECONDS, /health marks a synthetic "queues"
+// pseudo-service unhealthy and degrades the aggregate — a deep-but-momentary
+// spike during a burst is normal, a deep queue that stays deep means the
+// consumer is stuck. The threshold defaults to 0 (watching disabled), so
+// deployments that never push queue metrics see no change.
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// queueWatch tracks the last-seen depth per queue and how long each has been
+// over the threshold. Its own mutex, same pattern as the other stores: writes
+// come from applyMetric, reads from GetStatus/AggregateStatus.
+type queueWatch struct {
+	mu        sync.Mutex
+	threshold float64 // 0 disables the watch
+	grace     time.Duration
+	depths    map[string]float64
+	overSince map[string]time.Time
+}
+
+// observe applies one queue_depth update (op follows the gauge semantics:
+// set/inc/dec) and re-evaluates the threshold for that queue.
+func (q *queueWatch) observe(queue, op string, value float64, now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	switch op {
+	case "inc":
+		q.depths[queue] += value
+	case "dec":
+		q.depths[queue] -= value
+	default: // "set"
+		q.depths[queue] = value
+	}
+	if q.threshold <= 0 {
+		return
+	}
+	if q.depths[queue] > q.threshold {
+		if _, ok := q.overSince[queue]; !ok {
+			q.overSince[queue] = now
+		}
+	} else {
+		delete(q.overSince, queue)
+	}
+}
+
+// depth returns the last observed depth for a queue (0 if never pushed).
+func (q *queueWatch) depth(queue string) float64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.depths[queue]
+}
+
+// overdue returns the queues that have been over the threshold for at least
+// the grace period, sorted for deterministic output.
+func (q *queueWatch) overdue(now time.Time) []string {
+	if q.threshold <= 0 {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var out []string
+	for queue, since := range q.overSince {
+		if now.Sub(since) >= q.grace {
+			out = append(out, queue)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// WithQueueBacklogThreshold configures the queue watch: depth above threshold
+// for at least grace degrades /health. A non-positive threshold keeps the
+// watch disabled; a negative grace is ignored.
+func WithQueueBacklogThreshold(threshold int, grace time.Duration) Option {
+	return func(h *Service) {
+		if threshold > 0 {
+			h.queues.threshold = float64(threshold)
+		}
+		if grace > 0 {
+			h.queues.grace = grace
+		}
+	}
+}
+
+// queueThresholdFromEnv reads QUEUE_DEPTH_THRESHOLD; 0/unset keeps the watch
+// disabled, garbage warns and disables.
+func queueThresholdFromEnv() int {
+	raw := strings.TrimSpace(os.Getenv("QUEUE_DEPTH_THRESHOLD"))
+	if raw == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Printf("WARNING: invalid QUEUE_DEPTH_THRESHOLD %q (must be a non-negative integer) — queue watching disabled", raw)
+		return 0
+	}
+	return n
+}
+
+// queueGraceFromEnv reads QUEUE_DEPTH_GRACE_SECONDS; 0 means an instant trip
+// once the threshold is exceeded.
+func queueGraceFromEnv() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("QUEUE_DEPTH_GRACE_SECONDS"))
+	if raw == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Printf("WARNING: invalid QUEUE_DEPTH_GRACE_SECONDS %q (must be a non-negative integer) — using 0 (instant)", raw)
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
@@ -0,0 +1,178 @@
+package healthkit
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pushQueueDepth pushes one queue_depth gauge payload with op "set".
+func pushQueueDepth(t *testing.T, r http.Handler, token, queue string, depth float64) {
+	t.Helper()
+	body := fmt.Sprintf(`{"type":"gauge","name":"queue_depth","value":%g,"labels":{"queue":%q}}`, depth, queue)
+	rec := doReq(t, r, http.MethodPost, "/metrics/push", token, body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("push queue_depth %q = %d, want 200; body %s", queue, rec.Code, rec.Body.String())
+	}
+}
+
+func TestQueueLabelAllowlist(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+
+	pushQueueDepth(t, r, "tok", "ai_request", 12)
+	pushQueueDepth(t, r, "tok", "definitely_not_a_queue", 7) // collapses
+
+	mf := findMetric(t, hs, "discord_bot_queue_depth")
+	got := map[string]float64{}
+	for _, m := range mf.GetMetric() {
+		for _, lp := range m.GetLabel() {
+			if lp.GetName() != "queue" {
+				t.Errorf("unexpected label %s", lp.GetName())
+			}
+			got[lp.GetValue()] = m.GetGauge().GetValue()
+		}
+	}
+	if got["ai_request"] != 12 || got["other"] != 7 {
+		t.Errorf("series = %v, want ai_request=12 and other=7", got)
+	}
+	if len(got) != 2 {
+		t.Errorf("series count = %d, want 2 — junk labels must collapse", len(got))
+	}
+
+	// Negative depths are nonsense regardless of op.
+	rec := doReq(t, r, http.MethodPost, "/metrics/push", "tok",
+		`{"type":"gauge","name":"queue_depth","value":-1,"labels":{"queue":"ai_request"}}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), reasonNegativeValue) {
+		t.Errorf("negative depth = %d %q, want 400 with %s", rec.Code, rec.Body.String(), reasonNegativeValue)
+	}
+}
+
+func TestQueueDroppedCounterViaBatch(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+
+	body := `[
+		{"type":"counter","name":"queue_dropped","value":3,"labels":{"queue":"webhook_retry"}},
+		{"type":"counter","name":"queue_dropped","value":2,"labels":{"queue":"webhook_retry"}},
+		{"type":"gauge","name":"queue_oldest_age_seconds","value":42.5,"labels":{"queue":"message_processing"}}
+	]`
+	rec := doReq(t, r, http.MethodPost, "/metrics/batch", "tok", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("batch = %d, want 200; body %s", rec.Code, rec.Body.String())
+	}
+
+	mf := findMetric(t, hs, "discord_bot_queue_dropped_total")
+	if got := mf.GetMetric()[0].GetCounter().GetValue(); got != 5 {
+		t.Errorf("queue_dropped = %v, want 5", got)
+	}
+	mf = findMetric(t, hs, "discord_bot_queue_oldest_age_seconds")
+	if got := mf.GetMetric()[0].GetGauge().GetValue(); got != 42.5 {
+		t.Errorf("queue_oldest_age_seconds = %v, want 42.5", got)
+	}
+}
+
+func TestQueueBacklogDegradesAfterGrace(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk),
+		WithQueueBacklogThreshold(100, 30*time.Second))
+	r := buildRouter(hs, "tok")
+	hs.SetServiceStatus("bot", true)
+
+	// Over threshold but within grace: a burst is normal, stay healthy.
+	pushQueueDepth(t, r, "tok", "ai_request", 150)
+	if got := hs.AggregateStatus(); got != "healthy" {
+		t.Fatalf("status within grace = %q, want healthy", got)
+	}
+
+	// Still over once the grace elapses: the consumer is stuck.
+	clk.Advance(30 * time.Second)
+	if got := hs.AggregateStatus(); got != "degraded" {
+		t.Fatalf("status past grace = %q, want degraded", got)
+	}
+	status := hs.GetStatus()
+	if healthy, ok := status.Services["queues"]; !ok || healthy {
+		t.Errorf("Services[queues] = %v,%v, want the pseudo-service reported false", healthy, ok)
+	}
+	report := hs.GetReadinessReport()
+	found := false
+	for _, reason := range report.Reasons {
+		if reason == "queue_backlog:ai_request" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("readiness reasons = %v, want queue_backlog:ai_request", report.Reasons)
+	}
+
+	// Recovery: depth back under the threshold clears everything at once.
+	pushQueueDepth(t, r, "tok", "ai_request", 10)
+	if got := hs.AggregateStatus(); got != "healthy" {
+		t.Errorf("status after drain = %q, want healthy", got)
+	}
+	if _, ok := hs.GetStatus().Services["queues"]; ok {
+		t.Errorf("Services still carries the queues pseudo-service after drain")
+	}
+}
+
+func TestQueueBacklogInstantWithZeroGrace(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk), WithQueueBacklogThreshold(10, 0))
+	r := buildRouter(hs, "tok")
+
+	pushQueueDepth(t, r, "tok", "message_processing", 11)
+	if got := hs.AggregateStatus(); got != "degraded" {
+		t.Errorf("status = %q, want degraded immediately with zero grace", got)
+	}
+}
+
+func TestQueueWatchDisabledByDefault(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+
+	pushQueueDepth(t, r, "tok", "ai_request", 1e9)
+	if got := hs.AggregateStatus(); got != "healthy" {
+		t.Errorf("status = %q, want healthy — no threshold means no watch", got)
+	}
+}
+
+func TestQueueThresholdFromEnv(t *testing.T) {
+	tests := []struct {
+		name, raw string
+		want      int
+	}{
+		{"empty disables", "", 0},
+		{"valid", "500", 500},
+		{"negative invalid", "-3", 0},
+		{"junk invalid", "deep", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("QUEUE_DEPTH_THRESHOLD", tt.raw)
+			if got := queueThresholdFromEnv(); got != tt.want {
+				t.Errorf("queueThresholdFromEnv() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueGraceFromEnv(t *testing.T) {
+	tests := []struct {
+		name, raw string
+		want      time.Duration
+	}{
+		{"empty is instant", "", 0},
+		{"valid", "45", 45 * time.Second},
+		{"junk invalid", "soon", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("QUEUE_DEPTH_GRACE_SECONDS", tt.raw)
+			if got := queueGraceFromEnv(); got != tt.want {
+				t.Errorf("queueGraceFromEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package healthkit
+
+// Optional Redis pub/sub ingestion. In the docker-compose deployment the
+// Python bot already holds a Redis connection for its event bus, while every
+// metrics flush opened a fresh HTTP connection to this service — the single
+// biggest source of connection churn on the box. With REDIS_URL set, the
+// health API subscribes to METRICS_CHANNEL and decodes each published
+// message as one MetricsPayload (or a JSON array of them), funnelling every
+// payload through applyMetric — the SAME validation path as /metrics/push —
+// so Redis input gets the identical allowlist/label/cardinality treatment
+// and can never mint series the HTTP surface couldn't.
+//
+// Like the StatsD listener (statsd.go), the protocol is hand-rolled rather
+// than pulled in as a client dependency: a subscriber needs exactly AUTH,
+// SUBSCRIBE and the RESP push frames, and a full client library is a lot of
+// supply-chain surface for three commands. The subscription reconnects with
+// exponential backoff when Redis drops, and every failure — dial errors,
+// undecodable messages, rejected metrics — counts on
+// discord_bot_redis_ingest_errors_total so a silently broken pipeline shows
+// up on the scrape.
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reconnect backoff bounds; overridable per config for tests.
+const (
+	defaultRedisMinBackoff = time.Second
+	defaultRedisMaxBackoff = 30 * time.Second
+	defaultRedisDialWait   = 5 * time.Second
+)
+
+// maxRedisPayloadItems mirrors the /metrics/batch cap: one published array
+// may carry at most this many payloads.
+const maxRedisPayloadItems = 1000
+
+// maxRedisBulkBytes bounds one RESP bulk string — a malicious or confused
+// publisher cannot make the subscriber buffer an arbitrarily large frame.
+const maxRedisBulkBytes = 1 << 20
+
+// RedisIngestConfig describes one subscription.
+type RedisIngestConfig struct {
+	Addr     string // host:port
+	Password string // empty = no AUTH
+	Channel  string
+
+	// Unexported knobs so tests can shrink the waits; zero values take the
+	// defaults above.
+	dialTimeout time.Duration
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+}
+
+// RedisIngestFromEnv resolves the subscription from REDIS_URL and
+// METRICS_CHANNEL. Unset REDIS_URL disables the mode; an unparseable one
+// disables it with a warning — the HTTP push path keeps working either way.
+func RedisIngestFromEnv() (RedisIngestConfig, bool) {
+	raw := strings.TrimSpace(os.Getenv("REDIS_URL"))
+	if raw == "" {
+		return RedisIngestConfig{}, false
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "redis" || u.Hostname() == "" {
+		log.Printf("WARNING: invalid REDIS_URL %q (want redis://[:password@]host[:port]) — Redis ingestion disabled", raw)
+		return RedisIngestConfig{}, false
+	}
+	cfg := RedisIngestConfig{Addr: u.Host, Channel: "metrics"}
+	if u.Port() == "" {
+		cfg.Addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		if pw, ok := u.User.Password(); ok {
+			cfg.Password = pw
+		}
+	}
+	if ch := strings.TrimSpace(os.Getenv("METRICS_CHANNEL")); ch != "" {
+		cfg.Channel = ch
+	}
+	return cfg, true
+}
+
+// --- minimal RESP2 ---------------------------------------------------------
+
+// writeRedisCommand sends one command as a RESP array of bulk strings.
+func writeRedisCommand(w *bufio.Writer, args ...string) error {
+	if _, err := fmt.Fprintf(w, "*%d\r\n", len(args)); err != nil {
+		return err
+	}
+	for _, arg := range args {
+		if _, err := fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// respReader decodes RESP2 values: simple strings, errors, integers, bulk
+// strings and arrays — everything a subscriber can be sent.
+type respReader struct {
+	r *bufio.Reader
+}
+
+func (rr *respReader) readLine() (string, error) {
+	line, err := rr.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (rr *respReader) readValue() (any, error) {
+	line, err := rr.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, errors.New("empty RESP line")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, errors.New("redis: " + line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n > maxRedisBulkBytes {
+			return nil, fmt.Errorf("bad bulk length %q", line[1:])
+		}
+		if n < 0 {
+			return nil, nil // null bulk
+		}
+		buf := make([]byte, n+2) // payload + CRLF
+		if _, err := io.ReadFull(rr.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n > 64 {
+			return nil, fmt.Errorf("bad array length %q", line[1:])
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		values := make([]any, 0, n)
+		for i := 0; i < n; i++ {
+			v, err := rr.readValue()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unknown RESP type %q", line[0])
+	}
+}
+
+// --- ingestion -------------------------------------------------------------
+
+// handleRedisPayload decodes one published message and applies its payloads.
+// Failures count on the ingest-error counter and never abort the
+// subscription — one bad publisher must not take the pipeline down.
+func (h *Service) handleRedisPayload(data []byte) {
+	trimmed := bytes.TrimSpace(data)
+	var payloads []MetricsPayload
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &payloads); err != nil {
+			h.metrics.redisIngestErrors.Inc()
+			return
+		}
+		if len(payloads) > maxRedisPayloadItems {
+			h.metrics.redisIngestErrors.Inc()
+			return
+		}
+	} else {
+		var p MetricsPayload
+		if err := json.Unmarshal(trimmed, &p); err != nil {
+			h.metrics.redisIngestErrors.Inc()
+			return
+		}
+		payloads = append(payloads, p)
+	}
+	for _, p := range payloads {
+		if reason := h.applyMetric(p); reason != "" {
+			h.metrics.redisIngestErrors.Inc()
+		}
+	}
+}
+
+// redisSubscribeOnce runs one connection lifetime: dial, AUTH, SUBSCRIBE,
+// then consume push frames until the connection breaks or ctx cancels.
+// onReady fires after the subscribe confirmation so the caller can reset its
+// backoff only once the subscription is actually live.
+func (h *Service) redisSubscribeOnce(ctx context.Context, cfg RedisIngestConfig, onReady func()) error {
+	dialTimeout := cfg.dialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = defaultRedisDialWait
+	}
+	conn, err := net.DialTimeout("tcp", cfg.Addr, dialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// Closing the socket is what unblocks the blocked read below, same
+	// cancellation shape as the StatsD listener.
+	watchDone := make(chan struct{})
+	defer close(watchDone)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-watchDone:
+		}
+	}()
+
+	w := bufio.NewWriter(conn)
+	rr := &respReader{r: bufio.NewReader(conn)}
+
+	if cfg.Password != "" {
+		if err := writeRedisCommand(w, "AUTH", cfg.Password); err != nil {
+			return err
+		}
+		if _, err := rr.readValue(); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+	if err := writeRedisCommand(w, "SUBSCRIBE", cfg.Channel); err != nil {
+		return err
+	}
+
+	for {
+		v, err := rr.readValue()
+		if err != nil {
+			return err
+		}
+		frame, ok := v.([]any)
+		if !ok || len(frame) == 0 {
+			return fmt.Errorf("unexpected RESP frame %T", v)
+		}
+		kind, _ := frame[0].(string)
+		switch kind {
+		case "subscribe":
+			onReady()
+		case "message":
+			if len(frame) == 3 {
+				if payload, ok := frame[2].(string); ok {
+					h.handleRedisPayload([]byte(payload))
+				}
+			}
+		default:
+			// pong, unsubscribe, ... — nothing a passive subscriber acts on.
+		}
+	}
+}
+
+// ServeRedisIngest subscribes and keeps resubscribing with exponential
+// backoff until ctx is cancelled. Run it as a goroutine with the same
+// context as StartCollector so both stop together on shutdown.
+func (h *Service) ServeRedisIngest(ctx context.Context, cfg RedisIngestConfig) {
+	minBackoff := cfg.minBackoff
+	if minBackoff <= 0 {
+		minBackoff = defaultRedisMinBackoff
+	}
+	maxBackoff := cfg.maxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRedisMaxBackoff
+	}
+	backoff := minBackoff
+	for {
+		err := h.redisSubscribeOnce(ctx, cfg, func() { backoff = minBackoff })
+		if ctx.Err() != nil {
+			log.Println("Redis ingest stopped")
+			return
+		}
+		h.metrics.redisIngestErrors.Inc()
+		log.Printf("WARNING: Redis ingest on %s: %v — retrying in %s", cfg.Addr, err, backoff)
+		select {
+		case <-ctx.Done():
+			log.Println("Redis ingest stopped")
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
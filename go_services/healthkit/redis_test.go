@@ -0,0 +1,284 @@
+package healthkit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a minimal RESP2 pub/sub server: it accepts connections, reads
+// commands, acknowledges AUTH/SUBSCRIBE, and lets the test push message
+// frames. Standing in for miniredis with ~60 lines keeps the test honest
+// about the wire format the hand-rolled subscriber actually speaks.
+type fakeRedis struct {
+	t  *testing.T
+	ln net.Listener
+
+	mu       sync.Mutex
+	conns    []net.Conn
+	accepted int
+	commands [][]string
+	ready    chan struct{} // one receive per completed SUBSCRIBE
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	f := &fakeRedis{t: t, ln: ln, ready: make(chan struct{}, 16)}
+	go f.acceptLoop()
+	t.Cleanup(func() {
+		_ = ln.Close()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for _, c := range f.conns {
+			_ = c.Close()
+		}
+	})
+	return f
+}
+
+func (f *fakeRedis) addr() string { return f.ln.Addr().String() }
+
+func (f *fakeRedis) acceptLoop() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.conns = append(f.conns, conn)
+		f.accepted++
+		f.mu.Unlock()
+		go f.serveConn(conn)
+	}
+}
+
+// serveConn reads RESP command arrays and acknowledges them.
+func (f *fakeRedis) serveConn(conn net.Conn) {
+	rr := &respReader{r: bufio.NewReader(conn)}
+	for {
+		v, err := rr.readValue()
+		if err != nil {
+			return
+		}
+		parts, ok := v.([]any)
+		if !ok || len(parts) == 0 {
+			return
+		}
+		cmd := make([]string, 0, len(parts))
+		for _, p := range parts {
+			s, _ := p.(string)
+			cmd = append(cmd, s)
+		}
+		f.mu.Lock()
+		f.commands = append(f.commands, cmd)
+		f.mu.Unlock()
+		switch cmd[0] {
+		case "AUTH":
+			fmt.Fprintf(conn, "+OK\r\n")
+		case "SUBSCRIBE":
+			fmt.Fprintf(conn, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(cmd[1]), cmd[1])
+			f.ready <- struct{}{}
+		}
+	}
+}
+
+// publish pushes one message frame to every live connection.
+func (f *fakeRedis) publish(channel, payload string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range f.conns {
+		fmt.Fprintf(conn, "*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n",
+			len(channel), channel, len(payload), payload)
+	}
+}
+
+// dropConnections closes every live connection, forcing the subscriber to
+// reconnect.
+func (f *fakeRedis) dropConnections() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range f.conns {
+		_ = conn.Close()
+	}
+	f.conns = nil
+}
+
+func (f *fakeRedis) awaitSubscribe(t *testing.T) {
+	t.Helper()
+	select {
+	case <-f.ready:
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscriber never subscribed")
+	}
+}
+
+// startRedisIngest runs the subscription against the fake server with
+// test-speed backoff, stopping it at cleanup.
+func startRedisIngest(t *testing.T, hs *Service, f *fakeRedis, password string) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		hs.ServeRedisIngest(ctx, RedisIngestConfig{
+			Addr:        f.addr(),
+			Password:    password,
+			Channel:     "metrics",
+			dialTimeout: time.Second,
+			minBackoff:  5 * time.Millisecond,
+			maxBackoff:  20 * time.Millisecond,
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Error("Redis ingest goroutine did not stop")
+		}
+	})
+}
+
+// counterValue polls one registered counter until it reaches want or the
+// deadline passes — ingestion is asynchronous to the publish call.
+func counterValue(t *testing.T, hs *Service, name string, want float64) float64 {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	var last float64
+	for time.Now().Before(deadline) {
+		last = 0
+		if mf := findMetric(t, hs, name); mf != nil {
+			for _, m := range mf.GetMetric() {
+				last += m.GetCounter().GetValue()
+			}
+		}
+		if last >= want {
+			return last
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return last
+}
+
+func TestRedisIngestAppliesMetrics(t *testing.T) {
+	f := newFakeRedis(t)
+	hs := New(WithVersion("test"))
+	startRedisIngest(t, hs, f, "")
+	f.awaitSubscribe(t)
+
+	// One single payload and one array, same shapes /metrics/push and
+	// /metrics/batch accept.
+	f.publish("metrics", `{"type":"counter","name":"requests","value":2,"labels":{"status":"success","endpoint":"api"}}`)
+	f.publish("metrics", `[{"type":"counter","name":"requests","value":1},{"type":"gauge","name":"active_connections","value":7}]`)
+
+	if got := counterValue(t, hs, "discord_bot_requests_total", 3); got != 3 {
+		t.Errorf("requests total = %v, want 3", got)
+	}
+	if got := counterValue(t, hs, "discord_bot_redis_ingest_errors_total", 0); got != 0 {
+		t.Errorf("ingest errors = %v, want 0", got)
+	}
+}
+
+func TestRedisIngestCountsBadPayloads(t *testing.T) {
+	f := newFakeRedis(t)
+	hs := New(WithVersion("test"))
+	startRedisIngest(t, hs, f, "")
+	f.awaitSubscribe(t)
+
+	// Undecodable JSON and a validation rejection both count; neither kills
+	// the subscription.
+	f.publish("metrics", `{not json`)
+	f.publish("metrics", `{"type":"counter","name":"mystery","value":1}`)
+	if got := counterValue(t, hs, "discord_bot_redis_ingest_errors_total", 2); got != 2 {
+		t.Errorf("ingest errors = %v, want 2", got)
+	}
+
+	// The pipeline still works afterwards.
+	f.publish("metrics", `{"type":"counter","name":"requests","value":1}`)
+	if got := counterValue(t, hs, "discord_bot_requests_total", 1); got != 1 {
+		t.Errorf("requests total after bad payloads = %v, want 1", got)
+	}
+}
+
+func TestRedisIngestReconnects(t *testing.T) {
+	f := newFakeRedis(t)
+	hs := New(WithVersion("test"))
+	startRedisIngest(t, hs, f, "")
+	f.awaitSubscribe(t)
+
+	f.dropConnections()
+	// The subscriber must come back with a fresh SUBSCRIBE after backoff.
+	f.awaitSubscribe(t)
+
+	f.publish("metrics", `{"type":"counter","name":"requests","value":1}`)
+	if got := counterValue(t, hs, "discord_bot_requests_total", 1); got != 1 {
+		t.Errorf("requests total after reconnect = %v, want 1", got)
+	}
+	f.mu.Lock()
+	accepted := f.accepted
+	f.mu.Unlock()
+	if accepted < 2 {
+		t.Errorf("connections accepted = %d, want a reconnect", accepted)
+	}
+	// The drop itself is a counted error.
+	if got := counterValue(t, hs, "discord_bot_redis_ingest_errors_total", 1); got < 1 {
+		t.Errorf("ingest errors = %v, want at least the dropped connection", got)
+	}
+}
+
+func TestRedisIngestAuth(t *testing.T) {
+	f := newFakeRedis(t)
+	hs := New(WithVersion("test"))
+	startRedisIngest(t, hs, f, "hunter2")
+	f.awaitSubscribe(t)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.commands) < 2 || f.commands[0][0] != "AUTH" || f.commands[0][1] != "hunter2" {
+		t.Errorf("commands = %v, want AUTH before SUBSCRIBE", f.commands)
+	}
+	if f.commands[1][0] != "SUBSCRIBE" || f.commands[1][1] != "metrics" {
+		t.Errorf("commands = %v, want SUBSCRIBE metrics", f.commands)
+	}
+}
+
+func TestRedisIngestFromEnv(t *testing.T) {
+	tests := []struct {
+		name, url, channel string
+		wantOK             bool
+		wantAddr           string
+		wantPassword       string
+		wantChannel        string
+	}{
+		{"unset", "", "", false, "", "", ""},
+		{"plain", "redis://cache.internal:6380", "", true, "cache.internal:6380", "", "metrics"},
+		{"default port", "redis://cache.internal", "", true, "cache.internal:6379", "", "metrics"},
+		{"password and channel", "redis://:s3cret@localhost:6379", "bot.metrics", true, "localhost:6379", "s3cret", "bot.metrics"},
+		{"wrong scheme", "http://cache.internal:6379", "", false, "", "", ""},
+		{"garbage", "redis://", "", false, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("REDIS_URL", tt.url)
+			t.Setenv("METRICS_CHANNEL", tt.channel)
+			cfg, ok := RedisIngestFromEnv()
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if cfg.Addr != tt.wantAddr || cfg.Password != tt.wantPassword || cfg.Channel != tt.wantChannel {
+				t.Errorf("cfg = %+v, want %s %q %s", cfg, tt.wantAddr, tt.wantPassword, tt.wantChannel)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package healthkit
+
+// Live configuration reload. The env contract has always been read exactly
+// once at startup (OptionsFromEnv), which is the right default for a daemon —
+// but rotating the bearer token or tightening a self-health threshold should
+// not require a restart and the readiness blip that comes with it. This file
+// adds a Config snapshot held in an atomic.Pointer: every request-path reader
+// (the token gates, the threshold checks, the request logger) loads the
+// pointer once and sees a consistent snapshot, and a reload swaps in a new
+// snapshot without any reader-side locking.
+//
+// Only the fields that are safe to change under traffic are live: the auth
+// token, the runtime/self-health thresholds, the clock-skew warning
+// threshold, the logger (LOG_LEVEL/LOG_FORMAT) and the active probe set.
+// Structural settings — bind address, ports, TLS material paths, metric
+// registration (namespace, buckets) — cannot change after the listeners and
+// the registry exist; a reload detects edits to those variables and reports
+// them as "requires restart" instead of half-applying them.
+//
+// Reloads trigger two ways: SIGHUP (WatchSIGHUP, coexisting with the TLS
+// certReloader's own SIGHUP watcher — signal.Notify fans out to every
+// registered channel) and POST /admin/reload, which is auth-gated like the
+// maintenance toggle and returns the ReloadResult so the operator sees what
+// actually happened.
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Config is the live-reloadable configuration snapshot. Readers obtain it via
+// Service.config() and must treat it as immutable; ReloadFromEnv replaces the
+// whole snapshot rather than mutating it in place.
+type Config struct {
+	// AuthToken gates the write endpoints and the richer reads (see
+	// requireBearerToken / requireReadToken for the exact posture).
+	AuthToken string
+	// MaxMemoryBytes / MaxGoroutines are the self-health thresholds
+	// (selfhealth.go); zero disables the corresponding check.
+	MaxMemoryBytes uint64
+	MaxGoroutines  int
+	// SkewWarnThreshold is the client clock-skew warning bound (clockskew.go).
+	SkewWarnThreshold time.Duration
+	// Logger backs the request middleware and rejection/skew logs.
+	Logger *slog.Logger
+	// Probes is the active probe set currently running (probes.go).
+	Probes []ProbeConfig
+
+	// logEnv records the LOG_LEVEL/LOG_FORMAT values the Logger was built
+	// from, so a reload only rebuilds the logger when they actually changed —
+	// an injected WithLogger survives reloads that don't touch the log env.
+	logEnv string
+}
+
+// immutableEnvKeys are the env variables a reload can detect but not apply:
+// they shape listeners, TLS material or metric registration, all of which are
+// fixed once the process is serving. Edits show up in RequiresRestart.
+var immutableEnvKeys = []string{
+	"HEALTH_API_HOST",
+	"GO_HEALTH_API_PORT",
+	"HEALTH_API_PORT",
+	"ADMIN_HOST",
+	"ADMIN_PORT",
+	"HEALTH_API_TLS_CERT",
+	"HEALTH_API_TLS_KEY",
+	"HEALTH_API_CLIENT_CA",
+	"METRICS_NAMESPACE",
+	"REQUEST_DURATION_BUCKETS",
+	"AI_RESPONSE_BUCKETS",
+}
+
+// ReloadResult reports one reload: which live fields changed, which edited
+// variables cannot be applied without a restart, and any validation errors
+// (which keep the previous value in place — a reload never half-applies).
+type ReloadResult struct {
+	Applied         []string `json:"applied"`
+	RequiresRestart []string `json:"requires_restart"`
+	Errors          []string `json:"errors,omitempty"`
+	Timestamp       string   `json:"timestamp"`
+}
+
+// config returns the current live snapshot. Never nil after New.
+func (h *Service) config() *Config {
+	return h.liveCfg.Load()
+}
+
+// setAuthToken swaps the live auth token, keeping the construction-time field
+// and the snapshot in step. Used by tests that rebuild routers mid-test.
+func (h *Service) setAuthToken(token string) {
+	h.authToken = token
+	cfg := *h.config()
+	cfg.AuthToken = token
+	h.liveCfg.Store(&cfg)
+}
+
+// captureImmutableEnv snapshots the restart-only variables at construction so
+// later reloads can diff against what the process actually started with.
+func captureImmutableEnv() map[string]string {
+	snap := make(map[string]string, len(immutableEnvKeys))
+	for _, k := range immutableEnvKeys {
+		snap[k] = os.Getenv(k)
+	}
+	return snap
+}
+
+// logEnvString is the change-detection key for the logger fields.
+func logEnvString() string {
+	return os.Getenv("LOG_LEVEL") + "\x00" + os.Getenv("LOG_FORMAT")
+}
+
+// ReloadFromEnv re-reads the live-reloadable env variables and swaps in a new
+// Config snapshot. An UNSET variable leaves the current value in place —
+// reload applies changes, it does not reset fields to defaults, so
+// programmatic configuration (options) survives reloads that never mention
+// it. Set-but-invalid values go through the same fail-safe parsers as
+// startup (warning + fallback), except HEALTH_PROBES, whose parse errors are
+// returned in Errors with the previous probe set kept running — the reload
+// caller is interactive, so it gets told instead of silently losing probes.
+func (h *Service) ReloadFromEnv() ReloadResult {
+	h.reloadMu.Lock()
+	defer h.reloadMu.Unlock()
+
+	res := ReloadResult{
+		Applied:         []string{},
+		RequiresRestart: []string{},
+		Timestamp:       h.clock.Now().UTC().Format(time.RFC3339),
+	}
+	old := h.config()
+	next := *old
+
+	if tok, set := os.LookupEnv("HEALTH_API_TOKEN"); set && tok != old.AuthToken {
+		next.AuthToken = tok
+		h.authToken = tok
+		res.Applied = append(res.Applied, "auth_token")
+	}
+	if os.Getenv("MAX_MEMORY_MB") != "" {
+		if v := maxMemoryFromEnv(); v != old.MaxMemoryBytes {
+			next.MaxMemoryBytes = v
+			res.Applied = append(res.Applied, "max_memory_bytes")
+		}
+	}
+	if os.Getenv("MAX_GOROUTINES") != "" {
+		if v := maxGoroutinesFromEnv(); v != old.MaxGoroutines {
+			next.MaxGoroutines = v
+			res.Applied = append(res.Applied, "max_goroutines")
+		}
+	}
+	if os.Getenv("CLOCK_SKEW_WARN_SECONDS") != "" {
+		if v := skewWarnFromEnv(); v != old.SkewWarnThreshold {
+			next.SkewWarnThreshold = v
+			res.Applied = append(res.Applied, "clock_skew_warn_threshold")
+		}
+	}
+	if cur := logEnvString(); cur != old.logEnv {
+		next.Logger = loggerFromEnv()
+		next.logEnv = cur
+		res.Applied = append(res.Applied, "logger")
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("HEALTH_PROBES")); raw != "" {
+		var configs []ProbeConfig
+		if err := json.Unmarshal([]byte(raw), &configs); err != nil {
+			res.Errors = append(res.Errors,
+				"invalid HEALTH_PROBES JSON: "+err.Error()+" — keeping the previous probe set")
+		} else {
+			probes := make([]ProbeConfig, 0, len(configs))
+			for i, p := range configs {
+				normalized, reason := normalizeProbe(p)
+				if reason != "" {
+					res.Errors = append(res.Errors,
+						"invalid HEALTH_PROBES entry "+strconv.Itoa(i)+" ("+p.Name+"): "+reason)
+					continue
+				}
+				probes = append(probes, normalized)
+			}
+			if !reflect.DeepEqual(probes, old.Probes) {
+				next.Probes = probes
+				res.Applied = append(res.Applied, "probes")
+				h.restartProbesLocked(probes)
+			}
+		}
+	}
+
+	// The command allowlist FILE is the reloadable part; the path itself is
+	// construction-time (see commands.go).
+	if changed, errMsg := h.reloadCommandAllowlist(); errMsg != "" {
+		res.Errors = append(res.Errors, errMsg)
+	} else if changed {
+		res.Applied = append(res.Applied, "command_allowlist")
+	}
+
+	for _, k := range immutableEnvKeys {
+		if os.Getenv(k) != h.immutableEnv[k] {
+			res.RequiresRestart = append(res.RequiresRestart, k)
+		}
+	}
+
+	h.liveCfg.Store(&next)
+	log.Printf("Config reload: applied=%v requires_restart=%v errors=%d",
+		res.Applied, res.RequiresRestart, len(res.Errors))
+	return res
+}
+
+// restartProbesLocked cancels the running probe goroutines and starts the new
+// set under the same parent context RunProbes was given (Background if probes
+// were never started at boot). Caller holds reloadMu.
+func (h *Service) restartProbesLocked(probes []ProbeConfig) {
+	if h.probeCancel != nil {
+		h.probeCancel()
+	}
+	parent := h.probeParent
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	h.probeCancel = cancel
+	h.startProbes(ctx, probes)
+}
+
+// WatchSIGHUP reloads the configuration on each SIGHUP. Runs for the process
+// lifetime, like the TLS certReloader's watcher — both receive the signal.
+func (h *Service) WatchSIGHUP() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	for range sigCh {
+		h.ReloadFromEnv()
+	}
+}
+
+// handleReload is POST /admin/reload: run a reload and return its result, so
+// the operator sees applied/requires-restart/errors instead of grepping logs.
+func (h *Service) handleReload(w http.ResponseWriter, r *http.Request) {
+	res := h.ReloadFromEnv()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		log.Printf("Failed to encode reload result: %v", err)
+	}
+}
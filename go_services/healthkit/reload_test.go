@@ -0,0 +1,189 @@
+package healthkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReloadFromEnv_AppliesSafeFields(t *testing.T) {
+	t.Setenv("HEALTH_API_TOKEN", "")
+	hs := New(WithVersion("test"), WithAuthToken("old-token"))
+
+	t.Setenv("HEALTH_API_TOKEN", "new-token")
+	t.Setenv("MAX_MEMORY_MB", "512")
+	t.Setenv("MAX_GOROUTINES", "2000")
+	t.Setenv("CLOCK_SKEW_WARN_SECONDS", "45")
+
+	res := hs.ReloadFromEnv()
+	for _, field := range []string{"auth_token", "max_memory_bytes", "max_goroutines", "clock_skew_warn_threshold"} {
+		if !slices.Contains(res.Applied, field) {
+			t.Errorf("Applied = %v, missing %q", res.Applied, field)
+		}
+	}
+	if len(res.Errors) != 0 {
+		t.Errorf("Errors = %v, want none", res.Errors)
+	}
+	if len(res.RequiresRestart) != 0 {
+		t.Errorf("RequiresRestart = %v, want none", res.RequiresRestart)
+	}
+	if res.Timestamp == "" {
+		t.Error("Timestamp is empty")
+	}
+
+	cfg := hs.config()
+	if cfg.AuthToken != "new-token" {
+		t.Errorf("AuthToken = %q, want new-token", cfg.AuthToken)
+	}
+	if cfg.MaxMemoryBytes != 512*1024*1024 {
+		t.Errorf("MaxMemoryBytes = %d, want 512MB", cfg.MaxMemoryBytes)
+	}
+	if cfg.MaxGoroutines != 2000 {
+		t.Errorf("MaxGoroutines = %d, want 2000", cfg.MaxGoroutines)
+	}
+	if cfg.SkewWarnThreshold != 45*time.Second {
+		t.Errorf("SkewWarnThreshold = %v, want 45s", cfg.SkewWarnThreshold)
+	}
+}
+
+func TestReloadFromEnv_UnsetLeavesCurrentValues(t *testing.T) {
+	// t.Setenv registers the restore; Unsetenv makes the variable truly
+	// ABSENT (an empty-but-set HEALTH_API_TOKEN is a deliberate clear).
+	t.Setenv("HEALTH_API_TOKEN", "")
+	os.Unsetenv("HEALTH_API_TOKEN")
+	t.Setenv("MAX_MEMORY_MB", "")
+	t.Setenv("MAX_GOROUTINES", "")
+	hs := New(WithVersion("test"),
+		WithAuthToken("keep-me"),
+		WithRuntimeThresholds(256*1024*1024, 1500))
+
+	// HEALTH_API_TOKEN stays unset: reload applies changes, it does not reset
+	// programmatic configuration to defaults.
+	res := hs.ReloadFromEnv()
+	if len(res.Applied) != 0 {
+		t.Errorf("Applied = %v, want none with the env unset", res.Applied)
+	}
+	cfg := hs.config()
+	if cfg.AuthToken != "keep-me" || cfg.MaxMemoryBytes != 256*1024*1024 || cfg.MaxGoroutines != 1500 {
+		t.Errorf("config mutated by a no-op reload: %+v", cfg)
+	}
+}
+
+func TestReloadFromEnv_NewTokenTakesEffectOnLiveRouter(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "old-token")
+	body := `{"type":"gauge","name":"active_connections","value":1}`
+
+	if rec := doReq(t, r, http.MethodPost, "/metrics/push", "old-token", body); rec.Code != http.StatusOK {
+		t.Fatalf("push with initial token = %d, want 200", rec.Code)
+	}
+
+	t.Setenv("HEALTH_API_TOKEN", "new-token")
+	hs.ReloadFromEnv()
+
+	// Same router instance: the old token is dead, the new one works.
+	if rec := doReq(t, r, http.MethodPost, "/metrics/push", "old-token", body); rec.Code != http.StatusUnauthorized {
+		t.Errorf("push with rotated-out token = %d, want 401", rec.Code)
+	}
+	if rec := doReq(t, r, http.MethodPost, "/metrics/push", "new-token", body); rec.Code != http.StatusOK {
+		t.Errorf("push with reloaded token = %d, want 200", rec.Code)
+	}
+}
+
+func TestReloadFromEnv_ImmutableChangeRequiresRestart(t *testing.T) {
+	t.Setenv("GO_HEALTH_API_PORT", "8082")
+	hs := New(WithVersion("test"))
+
+	t.Setenv("GO_HEALTH_API_PORT", "9999")
+	res := hs.ReloadFromEnv()
+	if !slices.Contains(res.RequiresRestart, "GO_HEALTH_API_PORT") {
+		t.Errorf("RequiresRestart = %v, want GO_HEALTH_API_PORT listed", res.RequiresRestart)
+	}
+	if slices.Contains(res.Applied, "GO_HEALTH_API_PORT") {
+		t.Errorf("immutable variable reported as applied: %v", res.Applied)
+	}
+}
+
+func TestReloadFromEnv_InvalidProbesJSONKeepsPrevious(t *testing.T) {
+	hs := New(WithVersion("test"))
+
+	t.Setenv("HEALTH_PROBES", "not-json")
+	res := hs.ReloadFromEnv()
+	if len(res.Errors) == 0 {
+		t.Fatal("expected a validation error for bad HEALTH_PROBES JSON")
+	}
+	if slices.Contains(res.Applied, "probes") {
+		t.Errorf("probes applied despite invalid JSON: %v", res.Applied)
+	}
+}
+
+func TestReloadFromEnv_StartsNewProbes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	hs := New(WithVersion("test"))
+	t.Setenv("HEALTH_PROBES", `[{"name":"reload_dep","url":"`+ts.URL+`"}]`)
+
+	res := hs.ReloadFromEnv()
+	if !slices.Contains(res.Applied, "probes") {
+		t.Fatalf("Applied = %v, want probes", res.Applied)
+	}
+
+	// The first probe round fires immediately; poll the service map for it.
+	deadline := time.After(2 * time.Second)
+	for {
+		if healthy, ok := hs.GetStatus().Services["reload_dep"]; ok && healthy {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("reloaded probe never reported into the service map")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+func TestAdminReloadEndpoint(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+
+	// Unauthenticated: rejected like every other admin write.
+	if rec := doReq(t, r, http.MethodPost, "/admin/reload", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated reload = %d, want 401", rec.Code)
+	}
+
+	t.Setenv("HEALTH_API_TOKEN", "rotated")
+	rec := doReq(t, r, http.MethodPost, "/admin/reload", "tok", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("authenticated reload = %d, want 200", rec.Code)
+	}
+	var res ReloadResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("reload body is not JSON: %v", err)
+	}
+	if !slices.Contains(res.Applied, "auth_token") {
+		t.Errorf("Applied = %v, want auth_token", res.Applied)
+	}
+
+	// The rotation it reported really happened: the old token is now invalid.
+	if rec := doReq(t, r, http.MethodPost, "/admin/reload", "tok", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("reload with pre-rotation token = %d, want 401", rec.Code)
+	}
+	if rec := doReq(t, r, http.MethodPost, "/admin/reload", "rotated", ""); rec.Code != http.StatusOK {
+		t.Errorf("reload with rotated token = %d, want 200", rec.Code)
+	}
+}
+
+func TestSetAuthTokenKeepsFieldAndSnapshotInStep(t *testing.T) {
+	hs := New(WithVersion("test"), WithAuthToken("a"))
+	hs.setAuthToken("b")
+	if hs.authToken != "b" || hs.config().AuthToken != "b" {
+		t.Errorf("field = %q, snapshot = %q, want both b", hs.authToken, hs.config().AuthToken)
+	}
+}
@@ -0,0 +1,286 @@
+package healthkit
+
+// Prometheus remote-write receive path for edge boxes that have an agent but
+// no Prometheus server: POST /api/v1/write takes a snappy-compressed
+// protobuf WriteRequest and mirrors an allowlisted set of series into
+// dynamically registered gauges named remote_<series>, which then ride the
+// normal /metrics scrape. Everything else is dropped and counted on
+// discord_bot_remote_write_dropped_total — an edge agent's full series set
+// would otherwise mint unbounded collectors here, which is the same
+// cardinality attack the push endpoints defend against.
+//
+// The WriteRequest is decoded by hand with protowire rather than importing
+// github.com/prometheus/prometheus for its prompb types: that module drags in
+// a very large dependency tree for what is, on the receive side, three nested
+// messages with stable field numbers (WriteRequest.timeseries=1;
+// TimeSeries.labels=1, samples=2; Label.name=1, value=2; Sample.value=1,
+// timestamp=2). The wire format is a published compatibility contract, so
+// decoding it directly is no more fragile than vendoring the generated code.
+//
+// Size limits apply on BOTH sides of the compression boundary: the request
+// body is capped before reading, and the snappy header's declared decoded
+// length is checked before decompressing, so a tiny body that inflates to
+// gigabytes is refused without allocating.
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// maxRemoteWriteBody caps the compressed request body.
+	maxRemoteWriteBody = 1 << 20 // 1MB
+	// maxRemoteWriteDecoded caps the decompressed WriteRequest — checked
+	// against the snappy header before any decompression happens.
+	maxRemoteWriteDecoded = 4 << 20 // 4MB
+)
+
+// rwSample is one (value, timestamp-ms) pair from a TimeSeries.
+type rwSample struct {
+	value float64
+	ts    int64
+}
+
+// rwSeries is one decoded TimeSeries: its __name__ and the samples.
+type rwSeries struct {
+	name    string
+	samples []rwSample
+}
+
+// parseWriteRequest decodes the remote-write protobuf. Unknown fields are
+// skipped (forward compatibility); malformed wire data is an error.
+func parseWriteRequest(data []byte) ([]rwSeries, error) {
+	var series []rwSeries
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, fmt.Errorf("invalid WriteRequest tag")
+		}
+		data = data[n:]
+		if num == 1 && typ == protowire.BytesType {
+			raw, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, fmt.Errorf("invalid TimeSeries field")
+			}
+			data = data[n:]
+			ts, err := parseTimeSeries(raw)
+			if err != nil {
+				return nil, err
+			}
+			series = append(series, ts)
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return nil, fmt.Errorf("invalid WriteRequest field %d", num)
+		}
+		data = data[n:]
+	}
+	return series, nil
+}
+
+func parseTimeSeries(data []byte) (rwSeries, error) {
+	var out rwSeries
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return out, fmt.Errorf("invalid TimeSeries tag")
+		}
+		data = data[n:]
+		switch {
+		case num == 1 && typ == protowire.BytesType: // Label
+			raw, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return out, fmt.Errorf("invalid Label field")
+			}
+			data = data[n:]
+			name, value, err := parseLabel(raw)
+			if err != nil {
+				return out, err
+			}
+			if name == "__name__" {
+				out.name = value
+			}
+		case num == 2 && typ == protowire.BytesType: // Sample
+			raw, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return out, fmt.Errorf("invalid Sample field")
+			}
+			data = data[n:]
+			sample, err := parseSample(raw)
+			if err != nil {
+				return out, err
+			}
+			out.samples = append(out.samples, sample)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return out, fmt.Errorf("invalid TimeSeries field %d", num)
+			}
+			data = data[n:]
+		}
+	}
+	return out, nil
+}
+
+func parseLabel(data []byte) (name, value string, err error) {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return "", "", fmt.Errorf("invalid Label tag")
+		}
+		data = data[n:]
+		if typ == protowire.BytesType && (num == 1 || num == 2) {
+			raw, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return "", "", fmt.Errorf("invalid Label string")
+			}
+			data = data[n:]
+			if num == 1 {
+				name = string(raw)
+			} else {
+				value = string(raw)
+			}
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return "", "", fmt.Errorf("invalid Label field %d", num)
+		}
+		data = data[n:]
+	}
+	return name, value, nil
+}
+
+func parseSample(data []byte) (rwSample, error) {
+	var out rwSample
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return out, fmt.Errorf("invalid Sample tag")
+		}
+		data = data[n:]
+		switch {
+		case num == 1 && typ == protowire.Fixed64Type:
+			bits, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return out, fmt.Errorf("invalid Sample value")
+			}
+			data = data[n:]
+			out.value = math.Float64frombits(bits)
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return out, fmt.Errorf("invalid Sample timestamp")
+			}
+			data = data[n:]
+			out.ts = int64(v)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return out, fmt.Errorf("invalid Sample field %d", num)
+			}
+			data = data[n:]
+		}
+	}
+	return out, nil
+}
+
+// WithRemoteWriteAllowlist sets which series names /api/v1/write mirrors;
+// empty means everything is dropped (the endpoint still answers, so an agent
+// misconfiguration shows as a climbing dropped counter, not connection
+// errors).
+func WithRemoteWriteAllowlist(names []string) Option {
+	return func(h *Service) {
+		h.rwAllowed = make(map[string]bool, len(names))
+		for _, name := range names {
+			if name = strings.TrimSpace(name); name != "" {
+				h.rwAllowed[name] = true
+			}
+		}
+	}
+}
+
+// remoteWriteAllowlistFromEnv reads REMOTE_WRITE_ALLOWED_SERIES
+// (comma-separated series names).
+func remoteWriteAllowlistFromEnv() []string {
+	raw := strings.TrimSpace(os.Getenv("REMOTE_WRITE_ALLOWED_SERIES"))
+	if raw == "" {
+		return nil
+	}
+	return strings.Split(raw, ",")
+}
+
+// remoteGauge returns (registering on first use) the mirror gauge for an
+// allowlisted series. The allowlist bounds how many can ever exist.
+func (h *Service) remoteGauge(name string) prometheus.Gauge {
+	h.rwMu.Lock()
+	defer h.rwMu.Unlock()
+	if g, ok := h.rwGauges[name]; ok {
+		return g
+	}
+	g := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "remote_" + name,
+		Help: "Mirrored from remote-write series " + name,
+	})
+	h.registerer.MustRegister(g)
+	h.rwGauges[name] = g
+	return g
+}
+
+// handleRemoteWrite is POST /api/v1/write (write group: IP allowlist, auth,
+// shed, rate limit — same gauntlet as the other push surfaces).
+func (h *Service) handleRemoteWrite(w http.ResponseWriter, r *http.Request) {
+	compressed, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRemoteWriteBody))
+	if err != nil {
+		h.decodeBodyError(w, r, err)
+		return
+	}
+	// Bomb check before decompression: the snappy header declares the decoded
+	// length up front.
+	if decoded, err := snappy.DecodedLen(compressed); err != nil || decoded > maxRemoteWriteDecoded {
+		h.decodeBodyError(w, r, errBodyTooLarge)
+		return
+	}
+	raw, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "invalid snappy body", nil)
+		return
+	}
+	series, err := parseWriteRequest(raw)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, "invalid WriteRequest", nil)
+		return
+	}
+
+	dropped := 0
+	for _, ts := range series {
+		// The allowlist admits, then the name must still be a well-formed
+		// metric name (it becomes part of a registered collector's name) —
+		// the same regex the summary-tuning path uses.
+		if ts.name == "" || len(ts.name) > 128 || !h.rwAllowed[ts.name] ||
+			!metricNameRe.MatchString(ts.name) || len(ts.samples) == 0 {
+			dropped++
+			continue
+		}
+		// Latest sample wins — a gauge has no history to backfill.
+		sort.Slice(ts.samples, func(i, j int) bool { return ts.samples[i].ts < ts.samples[j].ts })
+		h.remoteGauge(ts.name).Set(ts.samples[len(ts.samples)-1].value)
+	}
+	if dropped > 0 {
+		h.metrics.remoteWriteDropped.Add(float64(dropped))
+		log.Printf("remote-write: dropped %d of %d series (not on REMOTE_WRITE_ALLOWED_SERIES)", dropped, len(series))
+	}
+	// The remote-write spec expects 2xx with no body on success.
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,188 @@
+package healthkit
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// encodeWriteRequest builds a WriteRequest on the wire the same way prompb
+// would, from (name, samples) pairs — the test-side mirror of the
+// protowire decoder.
+func encodeWriteRequest(series map[string][]rwSample) []byte {
+	var req []byte
+	for name, samples := range series {
+		var label []byte
+		label = protowire.AppendTag(label, 1, protowire.BytesType)
+		label = protowire.AppendBytes(label, []byte("__name__"))
+		label = protowire.AppendTag(label, 2, protowire.BytesType)
+		label = protowire.AppendBytes(label, []byte(name))
+
+		var ts []byte
+		ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, label)
+		// A second, non-__name__ label the decoder must skip over.
+		var extra []byte
+		extra = protowire.AppendTag(extra, 1, protowire.BytesType)
+		extra = protowire.AppendBytes(extra, []byte("instance"))
+		extra = protowire.AppendTag(extra, 2, protowire.BytesType)
+		extra = protowire.AppendBytes(extra, []byte("edge-1"))
+		ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, extra)
+
+		for _, s := range samples {
+			var sample []byte
+			sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+			sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+			sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+			sample = protowire.AppendVarint(sample, uint64(s.ts))
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, sample)
+		}
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	return req
+}
+
+// doRemoteWrite posts a snappy-compressed WriteRequest with the write token.
+func doRemoteWrite(t *testing.T, r http.Handler, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/write",
+		strings.NewReader(string(snappy.Encode(nil, body))))
+	req.Header.Set("Authorization", "Bearer tok")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRemoteWriteMirrorsAllowlistedSeries(t *testing.T) {
+	hs := New(WithVersion("test"),
+		WithRemoteWriteAllowlist([]string{"edge_cpu_usage", "edge_queue_depth"}))
+	r := buildRouter(hs, "tok")
+
+	body := encodeWriteRequest(map[string][]rwSample{
+		// Samples out of order: the latest timestamp must win.
+		"edge_cpu_usage": {{value: 0.75, ts: 2000}, {value: 0.20, ts: 1000}},
+		"edge_secret":    {{value: 42, ts: 1000}}, // not allowlisted
+	})
+	rec := doRemoteWrite(t, r, body)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("/api/v1/write = %d, want 204", rec.Code)
+	}
+
+	mf := findMetric(t, hs, "remote_edge_cpu_usage")
+	if mf == nil {
+		t.Fatal("allowlisted series not mirrored")
+	}
+	if got := mf.GetMetric()[0].GetGauge().GetValue(); got != 0.75 {
+		t.Errorf("mirrored value = %v, want the latest sample 0.75", got)
+	}
+	if findMetric(t, hs, "remote_edge_secret") != nil {
+		t.Error("non-allowlisted series was mirrored")
+	}
+	if mf := findMetric(t, hs, "discord_bot_remote_write_dropped_total"); mf == nil {
+		t.Fatal("dropped counter not registered")
+	} else if got := mf.GetMetric()[0].GetCounter().GetValue(); got != 1 {
+		t.Errorf("dropped counter = %v, want 1", got)
+	}
+
+	// A second write updates the existing gauge rather than re-registering.
+	rec = doRemoteWrite(t, r, encodeWriteRequest(map[string][]rwSample{
+		"edge_cpu_usage": {{value: 0.5, ts: 3000}},
+	}))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("second write = %d, want 204", rec.Code)
+	}
+	if got := findMetric(t, hs, "remote_edge_cpu_usage").GetMetric()[0].GetGauge().GetValue(); got != 0.5 {
+		t.Errorf("updated value = %v, want 0.5", got)
+	}
+}
+
+func TestRemoteWriteRejectsBadInput(t *testing.T) {
+	hs := New(WithVersion("test"), WithRemoteWriteAllowlist([]string{"edge_cpu_usage"}))
+	r := buildRouter(hs, "tok")
+
+	// Unauthenticated: same gate as every write.
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/write", strings.NewReader("x"))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated write = %d, want 401", rec.Code)
+	}
+
+	// Not snappy at all.
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/write", strings.NewReader("definitely not snappy"))
+	req.Header.Set("Authorization", "Bearer tok")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("garbage body = %d, want 400", rec.Code)
+	}
+
+	// Valid snappy wrapping garbage protobuf.
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/write",
+		strings.NewReader(string(snappy.Encode(nil, []byte{0xff, 0xff, 0xff}))))
+	req.Header.Set("Authorization", "Bearer tok")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("garbage protobuf = %d, want 400", rec.Code)
+	}
+}
+
+func TestRemoteWriteDecompressionBombRefused(t *testing.T) {
+	hs := New(WithVersion("test"), WithRemoteWriteAllowlist([]string{"edge_cpu_usage"}))
+	r := buildRouter(hs, "tok")
+
+	// 16MB of zeros compresses into well under the body cap, but the snappy
+	// header declares the decoded length — the 413 must come from that check,
+	// before any decompression.
+	bomb := snappy.Encode(nil, make([]byte, 16<<20))
+	if len(bomb) > maxRemoteWriteBody {
+		t.Fatalf("test bomb is %d bytes compressed; expected it under the body cap", len(bomb))
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/write", strings.NewReader(string(bomb)))
+	req.Header.Set("Authorization", "Bearer tok")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("bomb = %d, want 413", rec.Code)
+	}
+}
+
+func TestParseWriteRequestSkipsUnknownFields(t *testing.T) {
+	// A WriteRequest with an unknown top-level field (e.g. metadata=3) must
+	// decode cleanly — forward compatibility with newer senders.
+	body := encodeWriteRequest(map[string][]rwSample{
+		"edge_cpu_usage": {{value: 1, ts: 1}},
+	})
+	body = protowire.AppendTag(body, 3, protowire.BytesType)
+	body = protowire.AppendBytes(body, []byte("future"))
+
+	series, err := parseWriteRequest(body)
+	if err != nil {
+		t.Fatalf("parse with unknown field: %v", err)
+	}
+	if len(series) != 1 || series[0].name != "edge_cpu_usage" {
+		t.Fatalf("series = %+v, want the one known series", series)
+	}
+}
+
+func TestRemoteWriteAllowlistFromEnv(t *testing.T) {
+	t.Setenv("REMOTE_WRITE_ALLOWED_SERIES", "")
+	if got := remoteWriteAllowlistFromEnv(); got != nil {
+		t.Errorf("unset env = %v, want nil", got)
+	}
+	t.Setenv("REMOTE_WRITE_ALLOWED_SERIES", "edge_cpu_usage, edge_queue_depth")
+	hs := New(WithRemoteWriteAllowlist(remoteWriteAllowlistFromEnv()))
+	if !hs.rwAllowed["edge_cpu_usage"] || !hs.rwAllowed["edge_queue_depth"] {
+		t.Errorf("allowlist = %v, want both trimmed names", hs.rwAllowed)
+	}
+}
@@ -0,0 +1,108 @@
+package healthkit
+
+// JSON Schema for the /health document, generated from the Go structs by
+// reflection and served at GET /health/schema. Downstream consumers (the
+// dashboard, the Python bot, external uptime checks) kept breaking when
+// HealthStatus grew fields; publishing the schema derived from the SAME
+// struct the handler encodes makes the contract discoverable, and the
+// round-trip test in schema_test.go fails in this package the moment a
+// struct change would produce a document the schema can't describe.
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// healthSchemaVersion identifies the health document contract. Aligned with
+// the v1 surface the services expose today; bump alongside any future v2
+// negotiation of the health endpoints.
+const healthSchemaVersion = "v1"
+
+// HealthSchema returns the JSON Schema (draft 2020-12) describing the
+// document GET /health serves, regenerated from HealthStatus on each call so
+// it can never drift from the struct.
+func HealthSchema() map[string]any {
+	schema := schemaForType(reflect.TypeOf(HealthStatus{}))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "HealthStatus"
+	schema["version"] = healthSchemaVersion
+	return schema
+}
+
+// schemaForType maps one Go type onto its JSON Schema fragment. Only the
+// shapes the health document actually uses are supported; an unsupported
+// kind panics, which the schema round-trip test turns into a build-time
+// (well, test-time) failure for whoever adds such a field.
+func schemaForType(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaForType(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaForType(t.Elem())}
+	case reflect.Map:
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": schemaForType(t.Elem()),
+		}
+	case reflect.Interface:
+		// map[string]any metrics values: anything goes.
+		return map[string]any{}
+	case reflect.Struct:
+		properties := map[string]any{}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if name == "" {
+				name = f.Name
+			}
+			properties[name] = schemaForType(f.Type)
+			// omitempty (and pointer) fields may be absent; everything else
+			// is part of every document.
+			if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+				required = append(required, name)
+			}
+		}
+		schema := map[string]any{
+			"type":       "object",
+			"properties": properties,
+			// Closed object: a consumer validating a response against this
+			// schema finds out about NEW fields too, not just removed ones.
+			"additionalProperties": false,
+		}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	default:
+		panic("healthkit: no JSON Schema mapping for Go kind " + t.Kind().String())
+	}
+}
+
+// handleHealthSchema serves GET /health/schema. Anonymous like /health
+// itself — it describes the shape of an endpoint that is already open.
+func (h *Service) handleHealthSchema(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(HealthSchema()); err != nil {
+		log.Printf("Failed to encode health schema: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package healthkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// validateSchema checks value against the subset of JSON Schema the generator
+// emits (type, properties, required, additionalProperties, items). Returns
+// every violation so a failing test names all drift at once.
+func validateSchema(schema map[string]any, value any, path string) []string {
+	var errs []string
+	typ, hasType := schema["type"].(string)
+	if !hasType {
+		return nil // {} — anything goes
+	}
+	switch typ {
+	case "string":
+		if _, ok := value.(string); !ok {
+			errs = append(errs, fmt.Sprintf("%s: want string, got %T", path, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			errs = append(errs, fmt.Sprintf("%s: want boolean, got %T", path, value))
+		}
+	case "integer", "number":
+		n, ok := value.(float64) // encoding/json decodes every number here
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s: want %s, got %T", path, typ, value))
+		} else if typ == "integer" && n != float64(int64(n)) {
+			errs = append(errs, fmt.Sprintf("%s: want integer, got %v", path, n))
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s: want array, got %T", path, value))
+			break
+		}
+		itemSchema, _ := schema["items"].(map[string]any)
+		for i, item := range items {
+			errs = append(errs, validateSchema(itemSchema, item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s: want object, got %T", path, value))
+			break
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		if required, ok := schema["required"].([]string); ok {
+			for _, name := range required {
+				if _, present := obj[name]; !present {
+					errs = append(errs, fmt.Sprintf("%s: missing required field %q", path, name))
+				}
+			}
+		}
+		additional, _ := schema["additionalProperties"].(map[string]any)
+		closed := properties != nil && schema["additionalProperties"] == false
+		for name, v := range obj {
+			if prop, ok := properties[name].(map[string]any); ok {
+				errs = append(errs, validateSchema(prop, v, path+"."+name)...)
+				continue
+			}
+			if closed {
+				errs = append(errs, fmt.Sprintf("%s: field %q not in schema", path, name))
+				continue
+			}
+			errs = append(errs, validateSchema(additional, v, path+"."+name)...)
+		}
+	}
+	return errs
+}
+
+// TestHealthSchema_DescribesActualResponses is the contract gate: a fully
+// populated /health document (services, messages, heartbeats, maintenance)
+// must validate against the generated schema. A HealthStatus change the
+// generator can't describe — or a document shape the schema rejects — fails
+// here before any downstream consumer sees it.
+func TestHealthSchema_DescribesActualResponses(t *testing.T) {
+	fc := newFakeClock(time.Unix(1000, 0))
+	hs := New(WithVersion("test"), WithClock(fc))
+	r := buildRouter(hs, "")
+
+	// Exercise every optional branch of the document.
+	hs.SetServiceStatus("bot", true)
+	hs.SetServiceStatus("database", false)
+	hs.SetServiceMessage("database", "reconnecting")
+	if reason := hs.RecordHeartbeat("worker", 30); reason != "" {
+		t.Fatalf("heartbeat: %s", reason)
+	}
+	if _, reason := hs.ApplyHeartbeat(map[string]bool{"batch": true}); reason != "" {
+		t.Fatalf("batch heartbeat: %s", reason)
+	}
+	hs.SetMaintenance(true, "deploy", fc.Now().Add(time.Hour))
+
+	w := doReq(t, r, http.MethodGet, "/health", "", "")
+	var doc any
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("/health not JSON: %v", err)
+	}
+
+	for _, violation := range validateSchema(HealthSchema(), doc, "$") {
+		t.Error(violation)
+	}
+}
+
+func TestHandleHealthSchema(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+
+	// Anonymous, like /health itself.
+	w := doReq(t, r, http.MethodGet, "/health/schema", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("/health/schema: HTTP %d", w.Code)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &schema); err != nil {
+		t.Fatalf("schema not JSON: %v", err)
+	}
+	if schema["version"] != healthSchemaVersion {
+		t.Errorf("version = %v, want %q", schema["version"], healthSchemaVersion)
+	}
+	if schema["title"] != "HealthStatus" || schema["type"] != "object" {
+		t.Errorf("schema header fields wrong: title=%v type=%v", schema["title"], schema["type"])
+	}
+	props, ok := schema["properties"].(map[string]any)
+	if !ok {
+		t.Fatal("schema has no properties object")
+	}
+	for _, field := range []string{"status", "services", "metrics", "heartbeat_generation", "maintenance"} {
+		if _, present := props[field]; !present {
+			t.Errorf("schema missing property %q", field)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package healthkit
+
+// Threshold-based self-health. The collector has always READ MemStats and the
+// goroutine count, but nothing acted on them: a goroutine leak or a runaway
+// heap only showed up if someone happened to be watching Grafana. With
+// MAX_MEMORY_MB / MAX_GOROUTINES set, the collector tick compares the live
+// values against the thresholds and flips an internal "runtime" service
+// unhealthy — degrading /health and /health/ready through the normal service
+// machinery, no external alerting required. Recovery uses a hysteresis
+// margin: the service only clears once the value drops back under 90% of its
+// threshold, so a process hovering exactly at the limit degrades once instead
+// of flapping on every 10s tick.
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// runtimeServiceName is the internal pseudo-service the thresholds drive,
+// alongside "persistence" (see persistence.go).
+const runtimeServiceName = "runtime"
+
+// runtimeClearPercent is the hysteresis margin: a tripped threshold clears
+// only when the value is back under this percentage of the limit.
+const runtimeClearPercent = 90
+
+// WithRuntimeThresholds sets the self-health limits checked on each collector
+// tick. Zero disables the corresponding check; both default to disabled.
+func WithRuntimeThresholds(maxMemoryBytes uint64, maxGoroutines int) Option {
+	return func(h *Service) {
+		h.maxMemoryBytes = maxMemoryBytes
+		h.maxGoroutines = maxGoroutines
+	}
+}
+
+// maxMemoryFromEnv reads the MAX_MEMORY_MB threshold (0 = disabled). Same
+// fail-safe posture as the other *FromEnv helpers: a non-positive or
+// unparsable value is rejected with a warning and the check stays disabled.
+func maxMemoryFromEnv() uint64 {
+	raw := strings.TrimSpace(os.Getenv("MAX_MEMORY_MB"))
+	if raw == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("WARNING: invalid MAX_MEMORY_MB %q (must be a positive integer) — memory self-check disabled", raw)
+		return 0
+	}
+	return uint64(n) * 1024 * 1024
+}
+
+// maxGoroutinesFromEnv reads the MAX_GOROUTINES threshold (0 = disabled).
+func maxGoroutinesFromEnv() int {
+	raw := strings.TrimSpace(os.Getenv("MAX_GOROUTINES"))
+	if raw == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("WARNING: invalid MAX_GOROUTINES %q (must be a positive integer) — goroutine self-check disabled", raw)
+		return 0
+	}
+	return n
+}
+
+// checkRuntimeThresholds applies the self-health thresholds to one observed
+// sample. Split out of CollectSystemMetrics so tests can inject heap sizes
+// without allocating them. No-op when both thresholds are disabled — the
+// "runtime" service then never exists, keeping /health unchanged for
+// operators who never opted in.
+func (h *Service) checkRuntimeThresholds(memAlloc uint64, goroutines int) {
+	// Thresholds come from the live Config snapshot (see reload.go), so a
+	// reload tightening or relaxing them applies on the next tick.
+	cfg := h.config()
+	if cfg.MaxMemoryBytes == 0 && cfg.MaxGoroutines == 0 {
+		return
+	}
+
+	var tripped []string
+	if cfg.MaxMemoryBytes > 0 {
+		switch {
+		case memAlloc > cfg.MaxMemoryBytes:
+			h.runtimeMemTripped = true
+		case memAlloc < cfg.MaxMemoryBytes/100*runtimeClearPercent:
+			h.runtimeMemTripped = false
+		}
+		if h.runtimeMemTripped {
+			tripped = append(tripped, fmt.Sprintf("memory %dMB over threshold %dMB",
+				memAlloc/1024/1024, cfg.MaxMemoryBytes/1024/1024))
+		}
+	}
+	if cfg.MaxGoroutines > 0 {
+		switch {
+		case goroutines > cfg.MaxGoroutines:
+			h.runtimeGoroutinesTripped = true
+		case goroutines < cfg.MaxGoroutines*runtimeClearPercent/100:
+			h.runtimeGoroutinesTripped = false
+		}
+		if h.runtimeGoroutinesTripped {
+			tripped = append(tripped, fmt.Sprintf("goroutines %d over threshold %d",
+				goroutines, cfg.MaxGoroutines))
+		}
+	}
+
+	h.mu.RLock()
+	prevHealthy, known := h.services[runtimeServiceName]
+	h.mu.RUnlock()
+
+	if len(tripped) > 0 {
+		message := strings.Join(tripped, "; ")
+		if h.SetServiceStatus(runtimeServiceName, false) {
+			h.SetServiceMessage(runtimeServiceName, message)
+			// Log on the healthy→unhealthy transition only; while tripped the
+			// message (with current values) keeps updating every tick anyway.
+			if !known || prevHealthy {
+				log.Printf("WARNING: runtime self-check tripped: %s", message)
+			}
+		}
+		return
+	}
+	// Every enabled check is under its clear margin: recover, but only if the
+	// service was ever registered — a process that never tripped shouldn't
+	// suddenly grow a "runtime" entry.
+	if known {
+		h.SetServiceStatus(runtimeServiceName, true)
+		h.SetServiceMessage(runtimeServiceName, "")
+		if !prevHealthy {
+			log.Printf("Runtime self-check recovered (under %d%% of thresholds)", runtimeClearPercent)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package healthkit
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const mb = 1024 * 1024
+
+func TestCheckRuntimeThresholds_MemoryTripAndHysteresis(t *testing.T) {
+	hs := New(WithVersion("test"), WithRuntimeThresholds(512*mb, 0))
+
+	// Under the threshold: the "runtime" service never appears.
+	hs.checkRuntimeThresholds(100*mb, 50)
+	if _, exists := hs.GetStatus().Services[runtimeServiceName]; exists {
+		t.Fatal("runtime service registered without a trip")
+	}
+
+	// Over: degraded, with the tripped threshold in the message.
+	hs.checkRuntimeThresholds(600*mb, 50)
+	st := hs.GetStatus()
+	if st.Status != "degraded" || st.Services[runtimeServiceName] {
+		t.Fatalf("over threshold: status=%q services=%v, want degraded runtime", st.Status, st.Services)
+	}
+	if msg := hs.ServiceMessages()[runtimeServiceName]; !strings.Contains(msg, "memory 600MB over threshold 512MB") {
+		t.Errorf("message = %q, want the tripped memory threshold", msg)
+	}
+
+	// Inside the hysteresis band (90%–100% of the threshold = 460–512MB):
+	// stays tripped, so a heap hovering at the limit can't flap.
+	hs.checkRuntimeThresholds(500*mb, 50)
+	if hs.GetStatus().Services[runtimeServiceName] {
+		t.Error("inside the hysteresis band the trip must hold")
+	}
+
+	// Under 90%: clears, message removed.
+	hs.checkRuntimeThresholds(400*mb, 50)
+	st = hs.GetStatus()
+	if st.Status != "healthy" || !st.Services[runtimeServiceName] {
+		t.Errorf("under the clear margin: status=%q services=%v, want healthy runtime", st.Status, st.Services)
+	}
+	if msg, ok := hs.ServiceMessages()[runtimeServiceName]; ok {
+		t.Errorf("message %q should be cleared on recovery", msg)
+	}
+}
+
+func TestCheckRuntimeThresholds_Goroutines(t *testing.T) {
+	hs := New(WithVersion("test"), WithRuntimeThresholds(0, 1000))
+
+	hs.checkRuntimeThresholds(10*mb, 1500)
+	if hs.GetStatus().Services[runtimeServiceName] {
+		t.Fatal("goroutine threshold should have tripped")
+	}
+	if msg := hs.ServiceMessages()[runtimeServiceName]; !strings.Contains(msg, "goroutines 1500 over threshold 1000") {
+		t.Errorf("message = %q, want the tripped goroutine threshold", msg)
+	}
+
+	// 950 is inside the band (clear line is 900); 850 clears.
+	hs.checkRuntimeThresholds(10*mb, 950)
+	if hs.GetStatus().Services[runtimeServiceName] {
+		t.Error("950 goroutines is inside the hysteresis band — must stay tripped")
+	}
+	hs.checkRuntimeThresholds(10*mb, 850)
+	if !hs.GetStatus().Services[runtimeServiceName] {
+		t.Error("850 goroutines is under the clear margin — must recover")
+	}
+}
+
+func TestCheckRuntimeThresholds_BothTrippedMessage(t *testing.T) {
+	hs := New(WithVersion("test"), WithRuntimeThresholds(512*mb, 1000))
+	hs.checkRuntimeThresholds(600*mb, 1500)
+	msg := hs.ServiceMessages()[runtimeServiceName]
+	if !strings.Contains(msg, "memory") || !strings.Contains(msg, "goroutines") {
+		t.Errorf("message = %q, want both tripped thresholds named", msg)
+	}
+
+	// One recovers, the other holds: still unhealthy, message narrows.
+	hs.checkRuntimeThresholds(100*mb, 1500)
+	msg = hs.ServiceMessages()[runtimeServiceName]
+	if strings.Contains(msg, "memory") || !strings.Contains(msg, "goroutines") {
+		t.Errorf("message = %q, want only the goroutine threshold", msg)
+	}
+	if hs.GetStatus().Services[runtimeServiceName] {
+		t.Error("runtime must stay unhealthy while any threshold is tripped")
+	}
+}
+
+func TestCheckRuntimeThresholds_DisabledByDefault(t *testing.T) {
+	hs := New(WithVersion("test"))
+	// Absurd values with no thresholds configured: nothing happens.
+	hs.checkRuntimeThresholds(1<<40, 1_000_000)
+	if _, exists := hs.GetStatus().Services[runtimeServiceName]; exists {
+		t.Error("self-checks must be inert when no threshold is configured")
+	}
+}
+
+func TestRuntimeThresholdsFromEnv(t *testing.T) {
+	t.Setenv("MAX_MEMORY_MB", "512")
+	t.Setenv("MAX_GOROUTINES", "2000")
+	if got := maxMemoryFromEnv(); got != 512*mb {
+		t.Errorf("maxMemoryFromEnv = %d, want %d", got, 512*mb)
+	}
+	if got := maxGoroutinesFromEnv(); got != 2000 {
+		t.Errorf("maxGoroutinesFromEnv = %d, want 2000", got)
+	}
+
+	// Invalid values disable the check rather than failing startup.
+	for _, raw := range []string{"0", "-5", "lots", "1.5"} {
+		t.Setenv("MAX_MEMORY_MB", raw)
+		t.Setenv("MAX_GOROUTINES", raw)
+		if got := maxMemoryFromEnv(); got != 0 {
+			t.Errorf("maxMemoryFromEnv(%q) = %d, want 0", raw, got)
+		}
+		if got := maxGoroutinesFromEnv(); got != 0 {
+			t.Errorf("maxGoroutinesFromEnv(%q) = %d, want 0", raw, got)
+		}
+	}
+}
+
+func TestCollectSystemMetrics_FeedsThresholds(t *testing.T) {
+	// A 1-byte memory threshold any real process exceeds: one collector pass
+	// must trip the runtime service through the live MemStats path.
+	hs := New(WithVersion("test"), WithClock(newFakeClock(time.Unix(1000, 0))),
+		WithRuntimeThresholds(1, 0))
+	hs.CollectSystemMetrics()
+	if healthy, exists := hs.GetStatus().Services[runtimeServiceName]; !exists || healthy {
+		t.Error("CollectSystemMetrics must feed the threshold check")
+	}
+}
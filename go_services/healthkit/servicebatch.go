@@ -0,0 +1,137 @@
+package healthkit
+
+// Atomic service-status batches (POST /health/services). The Python
+// supervisor reports ~15 components per cycle and used to make 15 sequential
+// POSTs to /health/service — slow, and racy: a /health read landing between
+// POST 7 and POST 8 showed half the components at their new status and half
+// at the old one, the same torn picture the heartbeat batch (see
+// ApplyHeartbeat) was built to remove. A batch applies every valid item under
+// ONE lock acquisition and publishes the status snapshot once at the end, so
+// a reader sees either the pre-batch or the post-batch picture, never a mix.
+//
+// Unlike heartbeats, items here are validated individually: this endpoint
+// carries richer per-service updates (status plus message), and a supervisor
+// with one misnamed component should not lose the other fourteen. Skipped
+// items come back with their index and a stable reason, mirroring the
+// /metrics/batch response shape. The single-item /health/service endpoint
+// stays unchanged for compatibility.
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// ServiceStatusUpdate is one item of a POST /health/services batch — the same
+// shape the single-item endpoint accepts.
+type ServiceStatusUpdate struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+}
+
+// ApplyServiceStatuses applies a batch of status updates under one lock
+// acquisition. Invalid items (bad name, or a new name past the service cap)
+// are skipped with a stable reason while the rest still land; the snapshot is
+// published once after the loop, so no reader observes a partially applied
+// batch. Returns the applied count and the per-item errors in input order.
+func (h *Service) ApplyServiceStatuses(updates []ServiceStatusUpdate) (int, []batchItemError) {
+	// Sanitize messages before taking the lock: all message ingestion funnels
+	// through the sanitizer (see SetServiceMessage), and rune-walking user
+	// text has no business holding mu.
+	messages := make([]string, len(updates))
+	for i, u := range updates {
+		messages[i] = sanitizeServiceMessage(u.Message)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.clock.Now()
+	applied := 0
+	var itemErrors []batchItemError
+	for i, u := range updates {
+		// Same name bounds as the single-item endpoint.
+		if len(u.Name) == 0 || len(u.Name) > 100 {
+			itemErrors = append(itemErrors, batchItemError{Index: i, Reason: heartbeatReasonInvalidName})
+			continue
+		}
+		if _, exists := h.services[u.Name]; !exists && len(h.services) >= h.maxServices {
+			h.metrics.serviceRegistrationsRejected.Inc()
+			itemErrors = append(itemErrors, batchItemError{Index: i, Reason: heartbeatReasonMapFull})
+			continue
+		}
+		h.setServiceStatusLocked(u.Name, u.Healthy, now)
+		// Same clearing semantics as the single-item endpoint: an omitted or
+		// sanitized-to-empty message removes the old note.
+		if messages[i] == "" {
+			delete(h.serviceMessages, u.Name)
+		} else {
+			h.serviceMessages[u.Name] = messages[i]
+		}
+		applied++
+	}
+	if applied > 0 {
+		h.publishStatusSnapshotLocked()
+	}
+	return applied, itemErrors
+}
+
+// handleServiceBatch ingests one atomic service-status batch (called from
+// Python).
+func (h *Service) handleServiceBatch(w http.ResponseWriter, r *http.Request) {
+	// Limit request body size (decompressed, when gzipped) — same cap as the
+	// single-item endpoint; a status batch is small.
+	body, err := requestBody(w, r, 1<<16) // 64KB
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, err.Error(), nil)
+		return
+	}
+
+	var updates []ServiceStatusUpdate
+	if err := json.NewDecoder(body).Decode(&updates); err != nil {
+		h.decodeBodyError(w, r, err)
+		return
+	}
+
+	if len(updates) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode(map[string]any{
+			"error":  "service batch rejected",
+			"reason": heartbeatReasonEmpty,
+		}); err != nil {
+			log.Printf("Failed to encode service batch rejection: %v", err)
+		}
+		return
+	}
+	// A batch larger than the whole service map could never fully apply, so
+	// reject it outright instead of reporting most of it as per-item errors.
+	if len(updates) > h.maxServices {
+		writeError(w, http.StatusBadRequest, errCodeBatchTooLarge, "service batch too large",
+			map[string]any{"max_services": h.maxServices})
+		return
+	}
+
+	applied, itemErrors := h.ApplyServiceStatuses(updates)
+	// One warn per distinct reason (not per item), matching /metrics/batch.
+	seen := make(map[string]bool, len(itemErrors))
+	for _, ie := range itemErrors {
+		if !seen[ie.Reason] {
+			seen[ie.Reason] = true
+			log.Printf("WARNING: service batch item rejected: %s", ie.Reason)
+		}
+	}
+	if len(itemErrors) > maxBatchErrorDetails {
+		itemErrors = itemErrors[:maxBatchErrorDetails]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(batchResponse{
+		Processed: applied,
+		Skipped:   len(updates) - applied,
+		Errors:    itemErrors,
+	}); err != nil {
+		log.Printf("Failed to encode service batch response: %v", err)
+	}
+}
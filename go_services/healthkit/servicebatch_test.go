@@ -0,0 +1,208 @@
+package healthkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestServiceBatchAppliesAllItems(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "tok")
+
+	items := make([]string, 0, 15)
+	for i := 0; i < 15; i++ {
+		items = append(items, fmt.Sprintf(`{"name":"svc_%02d","healthy":true,"message":"up"}`, i))
+	}
+	rec := doReq(t, r, http.MethodPost, "/health/services", "tok", "["+strings.Join(items, ",")+"]")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("batch = %d, want 200; body %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Processed int `json:"processed"`
+		Skipped   int `json:"skipped"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Processed != 15 || resp.Skipped != 0 {
+		t.Errorf("processed/skipped = %d/%d, want 15/0", resp.Processed, resp.Skipped)
+	}
+	status := hs.GetStatus()
+	if len(status.Services) != 15 {
+		t.Fatalf("services = %d, want 15", len(status.Services))
+	}
+	for name, healthy := range status.Services {
+		if !healthy {
+			t.Errorf("service %s = unhealthy, want healthy", name)
+		}
+	}
+	if got := hs.ServiceMessages()["svc_00"]; got != "up" {
+		t.Errorf("message for svc_00 = %q, want %q", got, "up")
+	}
+}
+
+func TestServiceBatchPerItemErrors(t *testing.T) {
+	hs := New(WithVersion("test"), WithMaxServices(4))
+	r := buildRouter(hs, "tok")
+	hs.SetServiceStatus("alpha", true)
+	hs.SetServiceStatus("beta", true)
+	hs.SetServiceStatus("gamma", true)
+
+	// Item 1 has an invalid name; item 3 is a new name once delta has filled
+	// the map. Both are skipped with stable reasons while the rest land.
+	body := `[{"name":"alpha","healthy":false},` +
+		`{"name":"","healthy":true},` +
+		`{"name":"delta","healthy":true},` +
+		`{"name":"epsilon","healthy":true}]`
+	rec := doReq(t, r, http.MethodPost, "/health/services", "tok", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("batch = %d, want 200; body %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Processed int `json:"processed"`
+		Skipped   int `json:"skipped"`
+		Errors    []struct {
+			Index  int    `json:"index"`
+			Reason string `json:"reason"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Processed != 2 || resp.Skipped != 2 {
+		t.Errorf("processed/skipped = %d/%d, want 2/2", resp.Processed, resp.Skipped)
+	}
+	if len(resp.Errors) != 2 {
+		t.Fatalf("errors = %+v, want 2 entries", resp.Errors)
+	}
+	if resp.Errors[0].Index != 1 || resp.Errors[0].Reason != heartbeatReasonInvalidName {
+		t.Errorf("errors[0] = %+v, want index 1 reason %s", resp.Errors[0], heartbeatReasonInvalidName)
+	}
+	if resp.Errors[1].Index != 3 || resp.Errors[1].Reason != heartbeatReasonMapFull {
+		t.Errorf("errors[1] = %+v, want index 3 reason %s", resp.Errors[1], heartbeatReasonMapFull)
+	}
+	status := hs.GetStatus()
+	if len(status.Services) != 4 {
+		t.Fatalf("services = %v, want 4 names", status.Services)
+	}
+	if status.Services["alpha"] {
+		t.Error("alpha = healthy, want the reported false")
+	}
+	if !status.Services["delta"] {
+		t.Error("delta missing, want applied")
+	}
+}
+
+func TestServiceBatchUpdatesExistingAtCap(t *testing.T) {
+	hs := New(WithVersion("test"), WithMaxServices(2))
+	hs.SetServiceStatus("alpha", true)
+	hs.SetServiceStatus("beta", true)
+
+	// Updates to existing names are always allowed at the cap, same as the
+	// single-item endpoint.
+	applied, itemErrors := hs.ApplyServiceStatuses([]ServiceStatusUpdate{
+		{Name: "alpha", Healthy: false},
+		{Name: "beta", Healthy: false},
+	})
+	if applied != 2 || len(itemErrors) != 0 {
+		t.Fatalf("applied = %d, errors = %v; want 2 applied", applied, itemErrors)
+	}
+	if hs.AggregateStatus() != "degraded" {
+		t.Error("status = healthy, want degraded after the batch flipped both")
+	}
+}
+
+func TestServiceBatchRejectsEmptyAndOversized(t *testing.T) {
+	hs := New(WithVersion("test"), WithMaxServices(5))
+	r := buildRouter(hs, "tok")
+
+	rec := doReq(t, r, http.MethodPost, "/health/services", "tok", `[]`)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("empty batch = %d, want 400", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), heartbeatReasonEmpty) {
+		t.Errorf("empty batch body = %s, want reason %s", rec.Body.String(), heartbeatReasonEmpty)
+	}
+
+	items := make([]string, 0, 6)
+	for i := 0; i < 6; i++ {
+		items = append(items, fmt.Sprintf(`{"name":"svc_%d","healthy":true}`, i))
+	}
+	rec = doReq(t, r, http.MethodPost, "/health/services", "tok", "["+strings.Join(items, ",")+"]")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("oversized batch = %d, want 400; body %s", rec.Code, rec.Body.String())
+	}
+	if len(hs.GetStatus().Services) != 0 {
+		t.Error("oversized batch must not apply any item")
+	}
+}
+
+func TestServiceBatchMessageSanitizedAndCleared(t *testing.T) {
+	hs := New(WithVersion("test"))
+	hs.ApplyServiceStatuses([]ServiceStatusUpdate{
+		{Name: "gemini", Healthy: false, Message: "down — ping @everyone"},
+	})
+	if got := hs.ServiceMessages()["gemini"]; strings.Contains(got, "@everyone") {
+		t.Errorf("message = %q, want the mention neutralized", got)
+	}
+	// A follow-up item without a message clears the stale note.
+	hs.ApplyServiceStatuses([]ServiceStatusUpdate{{Name: "gemini", Healthy: true}})
+	if got, ok := hs.ServiceMessages()["gemini"]; ok {
+		t.Errorf("message = %q, want cleared", got)
+	}
+}
+
+func TestServiceBatchAtomicity(t *testing.T) {
+	hs := New(WithVersion("test"))
+	const n = 20
+	mkBatch := func(healthy bool) []ServiceStatusUpdate {
+		updates := make([]ServiceStatusUpdate, 0, n)
+		for i := 0; i < n; i++ {
+			updates = append(updates, ServiceStatusUpdate{Name: fmt.Sprintf("svc_%02d", i), Healthy: healthy})
+		}
+		return updates
+	}
+	hs.ApplyServiceStatuses(mkBatch(true))
+
+	// Every batch flips ALL services at once, so any snapshot mixing healthy
+	// and unhealthy is a torn read — exactly what single-lock application
+	// must rule out.
+	var mixed atomic.Bool
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			healthy := 0
+			services := hs.GetStatus().Services
+			for _, v := range services {
+				if v {
+					healthy++
+				}
+			}
+			if healthy != 0 && healthy != n {
+				mixed.Store(true)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		hs.ApplyServiceStatuses(mkBatch(i%2 == 1))
+	}
+	close(stop)
+	wg.Wait()
+	if mixed.Load() {
+		t.Fatal("observed a snapshot with a partially applied batch")
+	}
+}
@@ -0,0 +1,189 @@
+package healthkit
+
+// Per-shard gateway visibility. The bot runs multiple Discord gateway shards,
+// and "degraded" at the service level never said WHICH shard dropped or how
+// its latency looked. POST /health/shard takes one shard's self-report,
+// /health exposes the map under "shards", and two GaugeVecs make the same
+// data alertable. A disconnected shard only degrades aggregate status after
+// a grace period (SHARD_DISCONNECT_GRACE_SECONDS) — gateway reconnects are
+// routine and usually resolve in seconds, and paging on every resume would
+// train everyone to ignore the page.
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxTotalShards bounds the shard map: total_shards (and with it every
+// shard_id) must stay under this, so a bad payload can't grow the map or the
+// gauge label space without limit.
+const maxTotalShards = 1024
+
+// defaultShardDisconnectGrace is how long a shard may report disconnected
+// before it degrades aggregate status.
+const defaultShardDisconnectGrace = 60 * time.Second
+
+// Stable reasons for rejected shard reports, same contract as the metric
+// push reasons.
+const (
+	shardReasonInvalidID      = "invalid_shard_id"
+	shardReasonInvalidTotal   = "invalid_total_shards"
+	shardReasonInvalidLatency = "invalid_latency"
+	shardReasonInvalidGuilds  = "invalid_guilds"
+)
+
+// ShardReport is the POST /health/shard payload: one gateway shard's
+// self-report.
+type ShardReport struct {
+	ShardID     int     `json:"shard_id"`
+	TotalShards int     `json:"total_shards"`
+	Connected   bool    `json:"connected"`
+	LatencyMs   float64 `json:"latency_ms"`
+	Guilds      int     `json:"guilds"`
+}
+
+// ShardInfo is one shard's entry in the /health document.
+type ShardInfo struct {
+	Connected   bool    `json:"connected"`
+	LatencyMs   float64 `json:"latency_ms"`
+	Guilds      int     `json:"guilds"`
+	TotalShards int     `json:"total_shards"`
+	LastReport  string  `json:"last_report"`
+}
+
+// shardState is the stored per-shard record; guarded by Service.mu.
+type shardState struct {
+	report     ShardReport
+	lastReport time.Time
+	// disconnectedAt anchors the grace window: set when a report flips the
+	// shard to disconnected, zeroed on reconnect.
+	disconnectedAt time.Time
+}
+
+// WithShardDisconnectGrace sets how long a shard may stay disconnected
+// before aggregate status degrades.
+func WithShardDisconnectGrace(grace time.Duration) Option {
+	return func(h *Service) {
+		if grace > 0 {
+			h.shardGrace = grace
+		}
+	}
+}
+
+// shardGraceFromEnv reads the SHARD_DISCONNECT_GRACE_SECONDS override with
+// the usual fail-safe posture.
+func shardGraceFromEnv() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("SHARD_DISCONNECT_GRACE_SECONDS"))
+	if raw == "" {
+		return defaultShardDisconnectGrace
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("WARNING: invalid SHARD_DISCONNECT_GRACE_SECONDS %q (must be a positive integer) — using default %s", raw, defaultShardDisconnectGrace)
+		return defaultShardDisconnectGrace
+	}
+	return time.Duration(n) * time.Second
+}
+
+// ApplyShardReport validates and stores one shard report, updating the
+// per-shard gauges. Returns "" on success or a stable reason string.
+func (h *Service) ApplyShardReport(rep ShardReport) string {
+	if rep.TotalShards <= 0 || rep.TotalShards > maxTotalShards {
+		return shardReasonInvalidTotal
+	}
+	if rep.ShardID < 0 || rep.ShardID >= rep.TotalShards {
+		return shardReasonInvalidID
+	}
+	if rep.LatencyMs < 0 || math.IsNaN(rep.LatencyMs) || math.IsInf(rep.LatencyMs, 0) {
+		return shardReasonInvalidLatency
+	}
+	if rep.Guilds < 0 {
+		return shardReasonInvalidGuilds
+	}
+
+	now := h.clock.Now()
+	h.mu.Lock()
+	state, ok := h.shards[rep.ShardID]
+	if !ok {
+		state = &shardState{}
+		h.shards[rep.ShardID] = state
+	}
+	if rep.Connected {
+		state.disconnectedAt = time.Time{}
+	} else if state.disconnectedAt.IsZero() {
+		// Entering disconnected starts the grace window; repeated
+		// disconnected reports keep the original anchor.
+		state.disconnectedAt = now
+	}
+	state.report = rep
+	state.lastReport = now
+	h.mu.Unlock()
+
+	shard := strconv.Itoa(rep.ShardID)
+	connected := 0.0
+	if rep.Connected {
+		connected = 1
+	}
+	h.metrics.shardConnected.WithLabelValues(shard).Set(connected)
+	h.metrics.shardLatency.WithLabelValues(shard).Set(rep.LatencyMs / 1000)
+	return ""
+}
+
+// shardsOverdueLocked reports whether any shard has been disconnected past
+// the grace window. Caller holds mu (read).
+func (h *Service) shardsOverdueLocked(now time.Time) bool {
+	for _, state := range h.shards {
+		if !state.report.Connected && !state.disconnectedAt.IsZero() &&
+			now.Sub(state.disconnectedAt) > h.shardGrace {
+			return true
+		}
+	}
+	return false
+}
+
+// shardsLocked builds the /health shards map and reports whether any shard
+// has been disconnected past the grace window. Caller holds mu (read).
+func (h *Service) shardsLocked(now time.Time) (map[string]ShardInfo, bool) {
+	if len(h.shards) == 0 {
+		return nil, false
+	}
+	shards := make(map[string]ShardInfo, len(h.shards))
+	for id, state := range h.shards {
+		shards[strconv.Itoa(id)] = ShardInfo{
+			Connected:   state.report.Connected,
+			LatencyMs:   state.report.LatencyMs,
+			Guilds:      state.report.Guilds,
+			TotalShards: state.report.TotalShards,
+			LastReport:  formatTimestamp(state.lastReport),
+		}
+	}
+	return shards, h.shardsOverdueLocked(now)
+}
+
+// handleShard serves POST /health/shard (write group: auth + shed + rate
+// limit, like the other push surfaces).
+func (h *Service) handleShard(w http.ResponseWriter, r *http.Request) {
+	body, err := requestBody(w, r, 1<<16) // 64KB
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errCodeInvalidBody, err.Error(), nil)
+		return
+	}
+
+	var rep ShardReport
+	if err := json.NewDecoder(body).Decode(&rep); err != nil {
+		h.decodeBodyError(w, r, err)
+		return
+	}
+
+	if reason := h.ApplyShardReport(rep); reason != "" {
+		writeError(w, http.StatusBadRequest, reason, "invalid shard report", nil)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,223 @@
+package healthkit
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestApplyShardReport_Validation(t *testing.T) {
+	tests := []struct {
+		name       string
+		rep        ShardReport
+		wantReason string
+	}{
+		{
+			name:       "valid connected report",
+			rep:        ShardReport{ShardID: 0, TotalShards: 2, Connected: true, LatencyMs: 45.5, Guilds: 120},
+			wantReason: "",
+		},
+		{
+			name:       "valid disconnected report",
+			rep:        ShardReport{ShardID: 1, TotalShards: 2, Connected: false, Guilds: 0},
+			wantReason: "",
+		},
+		{
+			name:       "negative shard id",
+			rep:        ShardReport{ShardID: -1, TotalShards: 2, Connected: true},
+			wantReason: shardReasonInvalidID,
+		},
+		{
+			name:       "shard id at total",
+			rep:        ShardReport{ShardID: 2, TotalShards: 2, Connected: true},
+			wantReason: shardReasonInvalidID,
+		},
+		{
+			name:       "zero total shards",
+			rep:        ShardReport{ShardID: 0, TotalShards: 0, Connected: true},
+			wantReason: shardReasonInvalidTotal,
+		},
+		{
+			name:       "negative total shards",
+			rep:        ShardReport{ShardID: 0, TotalShards: -3, Connected: true},
+			wantReason: shardReasonInvalidTotal,
+		},
+		{
+			name:       "total above cap",
+			rep:        ShardReport{ShardID: 0, TotalShards: maxTotalShards + 1, Connected: true},
+			wantReason: shardReasonInvalidTotal,
+		},
+		{
+			name:       "negative latency",
+			rep:        ShardReport{ShardID: 0, TotalShards: 1, Connected: true, LatencyMs: -1},
+			wantReason: shardReasonInvalidLatency,
+		},
+		{
+			name:       "NaN latency",
+			rep:        ShardReport{ShardID: 0, TotalShards: 1, Connected: true, LatencyMs: math.NaN()},
+			wantReason: shardReasonInvalidLatency,
+		},
+		{
+			name:       "infinite latency",
+			rep:        ShardReport{ShardID: 0, TotalShards: 1, Connected: true, LatencyMs: math.Inf(1)},
+			wantReason: shardReasonInvalidLatency,
+		},
+		{
+			name:       "negative guilds",
+			rep:        ShardReport{ShardID: 0, TotalShards: 1, Connected: true, Guilds: -1},
+			wantReason: shardReasonInvalidGuilds,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hs := New(WithVersion("test"))
+			if got := hs.ApplyShardReport(tt.rep); got != tt.wantReason {
+				t.Errorf("ApplyShardReport() reason = %q, want %q", got, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestApplyShardReport_RejectedReportNotStored(t *testing.T) {
+	hs := New(WithVersion("test"))
+	hs.ApplyShardReport(ShardReport{ShardID: -1, TotalShards: 2, Connected: true})
+	if shards := hs.GetStatus().Shards; shards != nil {
+		t.Errorf("rejected report must not appear on /health, got %v", shards)
+	}
+}
+
+func TestApplyShardReport_Gauges(t *testing.T) {
+	hs := New(WithVersion("test"))
+
+	hs.ApplyShardReport(ShardReport{ShardID: 0, TotalShards: 2, Connected: true, LatencyMs: 250, Guilds: 10})
+	if got := testutil.ToFloat64(hs.metrics.shardConnected.WithLabelValues("0")); got != 1 {
+		t.Errorf("shard_connected{shard=0} = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(hs.metrics.shardLatency.WithLabelValues("0")); got != 0.25 {
+		t.Errorf("shard_latency{shard=0} = %v, want 0.25 (seconds)", got)
+	}
+
+	hs.ApplyShardReport(ShardReport{ShardID: 0, TotalShards: 2, Connected: false, LatencyMs: 0, Guilds: 10})
+	if got := testutil.ToFloat64(hs.metrics.shardConnected.WithLabelValues("0")); got != 0 {
+		t.Errorf("shard_connected{shard=0} after disconnect = %v, want 0", got)
+	}
+}
+
+func TestShardDisconnectGrace(t *testing.T) {
+	clock := newFakeClock(time.Unix(1000, 0))
+	hs := New(WithVersion("test"), WithClock(clock),
+		WithShardDisconnectGrace(30*time.Second))
+	hs.SetServiceStatus("bot", true)
+
+	hs.ApplyShardReport(ShardReport{ShardID: 0, TotalShards: 1, Connected: false})
+
+	// Inside the grace window a reconnecting shard doesn't page anyone.
+	clock.Advance(29 * time.Second)
+	if got := hs.GetStatus().Status; got != "healthy" {
+		t.Errorf("status inside grace = %q, want healthy", got)
+	}
+
+	// Past the window the disconnect is real.
+	clock.Advance(2 * time.Second)
+	if got := hs.GetStatus().Status; got != "degraded" {
+		t.Errorf("status past grace = %q, want degraded", got)
+	}
+
+	// Repeated disconnected reports keep the original anchor — they must not
+	// reset the window and hide a shard that never comes back.
+	hs.ApplyShardReport(ShardReport{ShardID: 0, TotalShards: 1, Connected: false})
+	if got := hs.GetStatus().Status; got != "degraded" {
+		t.Errorf("status after repeat disconnect report = %q, want degraded", got)
+	}
+
+	// Reconnecting clears it immediately.
+	hs.ApplyShardReport(ShardReport{ShardID: 0, TotalShards: 1, Connected: true, LatencyMs: 50})
+	if got := hs.GetStatus().Status; got != "healthy" {
+		t.Errorf("status after reconnect = %q, want healthy", got)
+	}
+}
+
+func TestShardDisconnect_DoesNotUpgradeStatus(t *testing.T) {
+	clock := newFakeClock(time.Unix(1000, 0))
+	hs := New(WithVersion("test"), WithClock(clock))
+	hs.SetServiceStatus("bot", false)
+	hs.ApplyShardReport(ShardReport{ShardID: 0, TotalShards: 1, Connected: true})
+	if got := hs.GetStatus().Status; got != "degraded" {
+		t.Errorf("a connected shard must not mask an unhealthy service, got %q", got)
+	}
+}
+
+func TestHandleShard_EndToEnd(t *testing.T) {
+	const token = "shard-token"
+	clock := newFakeClock(time.Unix(1000, 0))
+	hs := New(WithVersion("test"), WithClock(clock))
+	hs.SetServiceStatus("bot", true)
+	r := buildRouter(hs, token)
+
+	// Write surface: no token, no entry.
+	if rec := doReq(t, r, http.MethodPost, "/health/shard", "",
+		`{"shard_id":0,"total_shards":2,"connected":true}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated shard report: code = %d, want 401", rec.Code)
+	}
+
+	rec := doReq(t, r, http.MethodPost, "/health/shard", token,
+		`{"shard_id":0,"total_shards":2,"connected":true,"latency_ms":45.5,"guilds":120}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("valid shard report: code = %d, body %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doReq(t, r, http.MethodPost, "/health/shard", token,
+		`{"shard_id":5,"total_shards":2,"connected":true}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("out-of-range shard id: code = %d, want 400", rec.Code)
+	}
+	if env := decodeErrorEnvelope(t, rec); env.Code != shardReasonInvalidID {
+		t.Errorf("rejection code = %q, want %q", env.Code, shardReasonInvalidID)
+	}
+
+	rec = doReq(t, r, http.MethodGet, "/health", "", "")
+	var status HealthStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("/health body not JSON: %v", err)
+	}
+	info, ok := status.Shards["0"]
+	if !ok {
+		t.Fatalf("/health shards missing shard 0: %v", status.Shards)
+	}
+	if !info.Connected || info.LatencyMs != 45.5 || info.Guilds != 120 || info.TotalShards != 2 {
+		t.Errorf("shard 0 info = %+v", info)
+	}
+	if info.LastReport != formatTimestamp(clock.Now()) {
+		t.Errorf("shard 0 last_report = %q, want the report time", info.LastReport)
+	}
+	if _, ok := status.Shards["5"]; ok {
+		t.Error("rejected shard id must not appear on /health")
+	}
+}
+
+func TestShardGraceFromEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want time.Duration
+	}{
+		{"unset uses default", "", defaultShardDisconnectGrace},
+		{"valid override", "120", 120 * time.Second},
+		{"zero falls back", "0", defaultShardDisconnectGrace},
+		{"negative falls back", "-5", defaultShardDisconnectGrace},
+		{"garbage falls back", "soon", defaultShardDisconnectGrace},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SHARD_DISCONNECT_GRACE_SECONDS", tt.env)
+			if got := shardGraceFromEnv(); got != tt.want {
+				t.Errorf("shardGraceFromEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package healthkit
+
+// Graceful shutdown sequencing. server.Shutdown alone is not graceful from
+// the load balancer's point of view: the listener closes immediately, so
+// upstreams keep routing here until connections start failing. The ordered
+// sequence both binaries follow instead:
+//
+//  1. BeginShutdown — /health/ready flips to 503 at once, while every other
+//     endpoint keeps serving, so orchestrators stop routing new traffic.
+//  2. Drain delay (SHUTDOWN_DRAIN_SECONDS) — long enough for upstreams to
+//     observe the failed readiness probe before the listener goes away.
+//  3. DrainAndShutdown — server.Shutdown under SHUTDOWN_TIMEOUT_SECONDS, so
+//     in-flight pushes finish instead of dying mid-write.
+//  4. The caller exits non-zero when the drain was cut short — a forced
+//     close is a deploy-visible event, not a silent log line.
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultShutdownDrain is deliberately zero: single-instance deployments
+	// without a balancer in front gain nothing from waiting.
+	defaultShutdownDrain = 0
+	// defaultShutdownTimeout preserves the historical hardcoded drain budget.
+	defaultShutdownTimeout = 10 * time.Second
+)
+
+// BeginShutdown marks the Service as draining: /health/ready answers 503
+// (reason "shutting_down") from the next probe onward, while every other
+// endpoint keeps working so in-flight work can complete.
+func (h *Service) BeginShutdown() {
+	h.shuttingDown.Store(true)
+}
+
+// ShuttingDown reports whether BeginShutdown has been called.
+func (h *Service) ShuttingDown() bool {
+	return h.shuttingDown.Load()
+}
+
+// DrainAndShutdown sleeps the drain delay, then shuts every non-nil server
+// down concurrently under one timeout. Returns false when any server was
+// force-closed (the deadline expired with connections still in flight) — the
+// caller should exit non-zero in that case.
+func DrainAndShutdown(drain, timeout time.Duration, servers map[string]*http.Server) bool {
+	if drain > 0 {
+		log.Printf("Draining for %s before closing listeners", drain)
+		time.Sleep(drain)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	clean := true
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, s := range servers {
+		if s == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, s *http.Server) {
+			defer wg.Done()
+			if err := s.Shutdown(ctx); err != nil {
+				log.Printf("%s server shutdown error: %v — remaining connections force-closed", name, err)
+				mu.Lock()
+				clean = false
+				mu.Unlock()
+			}
+		}(name, s)
+	}
+	wg.Wait()
+
+	if clean {
+		log.Println("Shutdown complete: all in-flight requests drained")
+	} else {
+		log.Printf("Shutdown timed out after %s", timeout)
+	}
+	return clean
+}
+
+// ShutdownDrainFromEnv reads SHUTDOWN_DRAIN_SECONDS (0 = no delay, the
+// default). Fail-safe like the other env knobs: invalid values warn and keep
+// the default rather than stalling or rushing the shutdown.
+func ShutdownDrainFromEnv() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("SHUTDOWN_DRAIN_SECONDS"))
+	if raw == "" {
+		return defaultShutdownDrain
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Printf("WARNING: invalid SHUTDOWN_DRAIN_SECONDS %q (must be a non-negative integer) — using default %d", raw, defaultShutdownDrain)
+		return defaultShutdownDrain
+	}
+	return time.Duration(n) * time.Second
+}
+
+// ShutdownTimeoutFromEnv reads SHUTDOWN_TIMEOUT_SECONDS (the server.Shutdown
+// deadline; default 10).
+func ShutdownTimeoutFromEnv() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("SHUTDOWN_TIMEOUT_SECONDS"))
+	if raw == "" {
+		return defaultShutdownTimeout
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("WARNING: invalid SHUTDOWN_TIMEOUT_SECONDS %q (must be a positive integer) — using default %s", raw, defaultShutdownTimeout)
+		return defaultShutdownTimeout
+	}
+	return time.Duration(n) * time.Second
+}
@@ -0,0 +1,133 @@
+package healthkit
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBeginShutdownFlipsReadiness(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := hs.Routes()
+
+	if rec := doReq(t, r, http.MethodGet, "/health/ready", "", ""); rec.Code != http.StatusOK {
+		t.Fatalf("readiness before shutdown = %d, want 200", rec.Code)
+	}
+
+	hs.BeginShutdown()
+	rec := doReq(t, r, http.MethodGet, "/health/ready", "", "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("readiness during shutdown = %d, want 503", rec.Code)
+	}
+	var report ReadinessReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("readiness body is not JSON: %v", err)
+	}
+	if report.Ready {
+		t.Error("report.Ready = true during shutdown")
+	}
+	if !slices.Contains(report.Reasons, "shutting_down") {
+		t.Errorf("Reasons = %v, want shutting_down listed", report.Reasons)
+	}
+
+	// Everything else keeps serving: in-flight work must still complete.
+	if rec := doReq(t, r, http.MethodGet, "/health/live", "", ""); rec.Code != http.StatusOK {
+		t.Errorf("liveness during shutdown = %d, want 200", rec.Code)
+	}
+	if rec := doReq(t, r, http.MethodGet, "/health", "", ""); rec.Code != http.StatusOK {
+		t.Errorf("/health during shutdown = %d, want 200", rec.Code)
+	}
+}
+
+// startShutdownServer serves handler on a loopback listener and returns the
+// server plus its base URL.
+func startShutdownServer(t *testing.T, handler http.Handler) (*http.Server, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &http.Server{Handler: handler}
+	go func() { _ = srv.Serve(ln) }()
+	return srv, "http://" + ln.Addr().String()
+}
+
+func TestDrainAndShutdown_CleanDrain(t *testing.T) {
+	srv, _ := startShutdownServer(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	if !DrainAndShutdown(0, 2*time.Second, map[string]*http.Server{"test": srv, "absent": nil}) {
+		t.Error("DrainAndShutdown = false for an idle server, want clean true")
+	}
+}
+
+func TestDrainAndShutdown_ForcedCloseReportsUnclean(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	srv, base := startShutdownServer(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		close(entered)
+		<-release
+	}))
+
+	// Park one request inside the handler so the drain cannot finish.
+	go func() {
+		resp, err := http.Get(base + "/slow")
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+	}()
+	select {
+	case <-entered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("request never entered the handler")
+	}
+
+	if DrainAndShutdown(0, 50*time.Millisecond, map[string]*http.Server{"test": srv}) {
+		t.Error("DrainAndShutdown = true with a stuck in-flight request, want forced-close false")
+	}
+	_ = srv.Close()
+}
+
+func TestDrainAndShutdown_DrainDelayObserved(t *testing.T) {
+	srv, _ := startShutdownServer(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+
+	start := time.Now()
+	DrainAndShutdown(50*time.Millisecond, time.Second, map[string]*http.Server{"test": srv})
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("shutdown returned after %v, want at least the 50ms drain delay", elapsed)
+	}
+	_ = srv.Shutdown(context.Background())
+}
+
+func TestShutdownEnvParsing(t *testing.T) {
+	tests := []struct {
+		name        string
+		drain, to   string
+		wantDrain   time.Duration
+		wantTimeout time.Duration
+	}{
+		{"defaults", "", "", defaultShutdownDrain, defaultShutdownTimeout},
+		{"valid overrides", "3", "5", 3 * time.Second, 5 * time.Second},
+		{"zero drain is valid, zero timeout is not", "0", "0", 0, defaultShutdownTimeout},
+		{"garbage falls back", "soon", "later", defaultShutdownDrain, defaultShutdownTimeout},
+		{"negative falls back", "-1", "-5", defaultShutdownDrain, defaultShutdownTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SHUTDOWN_DRAIN_SECONDS", tt.drain)
+			t.Setenv("SHUTDOWN_TIMEOUT_SECONDS", tt.to)
+			if got := ShutdownDrainFromEnv(); got != tt.wantDrain {
+				t.Errorf("ShutdownDrainFromEnv() = %v, want %v", got, tt.wantDrain)
+			}
+			if got := ShutdownTimeoutFromEnv(); got != tt.wantTimeout {
+				t.Errorf("ShutdownTimeoutFromEnv() = %v, want %v", got, tt.wantTimeout)
+			}
+		})
+	}
+}
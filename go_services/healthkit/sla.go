@@ -0,0 +1,153 @@
+package healthkit
+
+// Availability accounting for "what was our uptime last week". Every service
+// gets a running tally — cumulative unhealthy duration, outage count, and
+// when it was first seen — accrued on SetServiceStatus transitions under the
+// same mu that guards the service map. A service that is down AT QUERY TIME
+// has its open stretch added at read time without mutating the tally, so two
+// concurrent reads agree and the accounting stays transition-driven.
+//
+// The aggregate row treats overlap correctly: it counts wall-clock time when
+// AT LEAST ONE service was unhealthy (tracked as its own 0↔N unhealthy-count
+// edge), not the sum of per-service downtimes — two services down for the
+// same five minutes is five minutes of degraded service, not ten.
+//
+// All arithmetic is time.Time subtraction on values from the injected Clock;
+// with the real clock those carry Go's monotonic reading, so an NTP step
+// can't produce negative downtime. Numbers are process-lifetime: they reset
+// on restart (the persistence snapshot does not carry them — worth revisiting
+// if management wants cross-restart windows).
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// slaState is one service's availability tally. Guarded by h.mu.
+type slaState struct {
+	firstSeen time.Time
+	downSince time.Time // zero while healthy
+	downTotal time.Duration
+	outages   int
+}
+
+// downAsOf returns the cumulative downtime including any open stretch.
+func (s *slaState) downAsOf(now time.Time) time.Duration {
+	total := s.downTotal
+	if !s.downSince.IsZero() {
+		total += now.Sub(s.downSince)
+	}
+	return total
+}
+
+// SLAEntry is one row of the /stats/sla response.
+type SLAEntry struct {
+	Service         string  `json:"service"`
+	UptimePercent   float64 `json:"uptime_percent"`
+	DowntimeSeconds float64 `json:"downtime_seconds"`
+	Outages         int     `json:"outages"`
+	CurrentlyDown   bool    `json:"currently_down"`
+	// ObservedSeconds is the denominator: time since the service first
+	// reported, not process start, so a late joiner isn't credited with
+	// uptime from before it existed.
+	ObservedSeconds float64 `json:"observed_seconds"`
+}
+
+// SLAReport is the /stats/sla body.
+type SLAReport struct {
+	Since string `json:"since"` // process start, RFC3339 UTC
+	// Aggregate counts time when at least one service was unhealthy —
+	// overlapping outages are not double-counted.
+	Aggregate SLAEntry   `json:"aggregate"`
+	Services  []SLAEntry `json:"services"`
+}
+
+// recordSLATransitionLocked accrues availability on one status report.
+// Caller holds h.mu; prev/exists describe the map before the write.
+func (h *Service) recordSLATransitionLocked(name string, healthy, prev, exists bool, now time.Time) {
+	st := h.sla[name]
+	if st == nil {
+		st = &slaState{firstSeen: now}
+		h.sla[name] = st
+	}
+	wasDown := exists && !prev
+	switch {
+	case !healthy && !wasDown:
+		st.downSince = now
+		st.outages++
+		// Aggregate edge: 0 → ≥1 unhealthy.
+		h.slaUnhealthy++
+		if h.slaUnhealthy == 1 {
+			h.slaAgg.downSince = now
+			h.slaAgg.outages++
+		}
+	case healthy && wasDown:
+		st.downTotal += now.Sub(st.downSince)
+		st.downSince = time.Time{}
+		h.slaUnhealthy--
+		if h.slaUnhealthy == 0 {
+			h.slaAgg.downTotal += now.Sub(h.slaAgg.downSince)
+			h.slaAgg.downSince = time.Time{}
+		}
+	}
+}
+
+// slaEntryFrom renders one tally against its observation window.
+func slaEntryFrom(name string, st *slaState, now time.Time) SLAEntry {
+	observed := now.Sub(st.firstSeen)
+	down := st.downAsOf(now)
+	entry := SLAEntry{
+		Service:         name,
+		DowntimeSeconds: down.Seconds(),
+		Outages:         st.outages,
+		CurrentlyDown:   !st.downSince.IsZero(),
+		ObservedSeconds: observed.Seconds(),
+		UptimePercent:   100,
+	}
+	if observed > 0 {
+		entry.UptimePercent = 100 * (observed - down).Seconds() / observed.Seconds()
+		if entry.UptimePercent < 0 {
+			entry.UptimePercent = 0
+		}
+	} else if !st.downSince.IsZero() {
+		// Registered unhealthy this very instant: zero window, zero uptime.
+		entry.UptimePercent = 0
+	}
+	return entry
+}
+
+// SLAReportNow snapshots availability as of the injected clock.
+func (h *Service) SLAReportNow() SLAReport {
+	now := h.clock.Now()
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	report := SLAReport{
+		Since:    formatTimestamp(h.startTime),
+		Services: make([]SLAEntry, 0, len(h.sla)),
+	}
+	for name, st := range h.sla {
+		report.Services = append(report.Services, slaEntryFrom(name, st, now))
+	}
+	sort.Slice(report.Services, func(i, j int) bool {
+		return report.Services[i].Service < report.Services[j].Service
+	})
+	// The aggregate window is the whole process lifetime: "the system" exists
+	// from start even before the first service registers.
+	agg := h.slaAgg
+	agg.firstSeen = h.startTime
+	report.Aggregate = slaEntryFrom("aggregate", &agg, now)
+	return report
+}
+
+// handleSLA is GET /stats/sla. Token-gated like /stats — it lists every
+// service name.
+func (h *Service) handleSLA(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.SLAReportNow()); err != nil {
+		log.Printf("Failed to encode sla response: %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package healthkit
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// slaFor plucks one service's row out of a report.
+func slaFor(t *testing.T, report SLAReport, name string) SLAEntry {
+	t.Helper()
+	for _, e := range report.Services {
+		if e.Service == name {
+			return e
+		}
+	}
+	t.Fatalf("no SLA entry for %q in %+v", name, report.Services)
+	return SLAEntry{}
+}
+
+func TestSLAAccruesAcrossTransitions(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk))
+
+	hs.SetServiceStatus("database", true)
+	clk.Advance(9 * time.Minute)
+	hs.SetServiceStatus("database", false)
+	clk.Advance(time.Minute)
+	hs.SetServiceStatus("database", true)
+
+	entry := slaFor(t, hs.SLAReportNow(), "database")
+	if entry.DowntimeSeconds != 60 {
+		t.Errorf("downtime = %v seconds, want 60", entry.DowntimeSeconds)
+	}
+	if entry.Outages != 1 {
+		t.Errorf("outages = %d, want 1", entry.Outages)
+	}
+	if entry.CurrentlyDown {
+		t.Error("currently_down = true after recovery")
+	}
+	// 1 minute down out of 10 observed = 90%.
+	if math.Abs(entry.UptimePercent-90) > 0.01 {
+		t.Errorf("uptime = %v%%, want 90%%", entry.UptimePercent)
+	}
+}
+
+func TestSLACountsOpenOutageAtQueryTime(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk))
+
+	hs.SetServiceStatus("gateway", true)
+	clk.Advance(time.Minute)
+	hs.SetServiceStatus("gateway", false)
+	clk.Advance(3 * time.Minute) // still down at query time
+
+	entry := slaFor(t, hs.SLAReportNow(), "gateway")
+	if !entry.CurrentlyDown {
+		t.Fatal("currently_down = false while the service is down")
+	}
+	if entry.DowntimeSeconds != 180 {
+		t.Errorf("downtime = %v seconds, want the open stretch counted (180)", entry.DowntimeSeconds)
+	}
+	// Reading must not mutate the tally: a later read sees a larger stretch,
+	// not a double-counted one.
+	clk.Advance(time.Minute)
+	if entry := slaFor(t, hs.SLAReportNow(), "gateway"); entry.DowntimeSeconds != 240 {
+		t.Errorf("downtime after another minute = %v seconds, want 240", entry.DowntimeSeconds)
+	}
+}
+
+func TestSLAAggregateDoesNotDoubleCountOverlap(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk))
+
+	hs.SetServiceStatus("database", true)
+	hs.SetServiceStatus("gateway", true)
+	clk.Advance(5 * time.Minute)
+
+	// Both down for the same 2 minutes.
+	hs.SetServiceStatus("database", false)
+	hs.SetServiceStatus("gateway", false)
+	clk.Advance(2 * time.Minute)
+	hs.SetServiceStatus("database", true)
+	hs.SetServiceStatus("gateway", true)
+	clk.Advance(3 * time.Minute)
+
+	report := hs.SLAReportNow()
+	if got := report.Aggregate.DowntimeSeconds; got != 120 {
+		t.Errorf("aggregate downtime = %v seconds, want 120 (overlap counted once)", got)
+	}
+	if report.Aggregate.Outages != 1 {
+		t.Errorf("aggregate outages = %d, want 1 (one degraded stretch)", report.Aggregate.Outages)
+	}
+	// Per-service rows still carry 2 minutes each.
+	if slaFor(t, report, "database").DowntimeSeconds != 120 || slaFor(t, report, "gateway").DowntimeSeconds != 120 {
+		t.Error("per-service downtimes changed by the aggregate accounting")
+	}
+}
+
+func TestSLAObservedWindowStartsAtFirstReport(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk))
+
+	hs.SetServiceStatus("database", true)
+	clk.Advance(time.Hour)
+	// Late joiner: immediately down for its whole (short) life.
+	hs.SetServiceStatus("voice", false)
+	clk.Advance(time.Minute)
+
+	report := hs.SLAReportNow()
+	voice := slaFor(t, report, "voice")
+	if voice.ObservedSeconds != 60 {
+		t.Errorf("late joiner observed = %v seconds, want 60 (since first report)", voice.ObservedSeconds)
+	}
+	if voice.UptimePercent != 0 {
+		t.Errorf("late joiner uptime = %v%%, want 0%% (down for its whole window)", voice.UptimePercent)
+	}
+	if db := slaFor(t, report, "database"); db.UptimePercent != 100 {
+		t.Errorf("database uptime = %v%%, want 100%%", db.UptimePercent)
+	}
+}
+
+func TestSLAEndpoint(t *testing.T) {
+	clk := newFakeClock(time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC))
+	hs := New(WithVersion("test"), WithClock(clk))
+	r := buildRouter(hs, "tok")
+
+	hs.SetServiceStatus("database", true)
+	clk.Advance(time.Minute)
+
+	// Token-gated like /stats.
+	if rec := doReq(t, r, http.MethodGet, "/stats/sla", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated /stats/sla = %d, want 401", rec.Code)
+	}
+
+	rec := doReq(t, r, http.MethodGet, "/stats/sla", "tok", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/stats/sla = %d, want 200", rec.Code)
+	}
+	var report SLAReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("sla body is not JSON: %v", err)
+	}
+	if report.Since == "" {
+		t.Error("since timestamp missing")
+	}
+	if len(report.Services) != 1 || report.Services[0].Service != "database" {
+		t.Fatalf("services = %+v, want the single database row", report.Services)
+	}
+	if report.Aggregate.UptimePercent != 100 {
+		t.Errorf("aggregate uptime = %v%%, want 100%%", report.Aggregate.UptimePercent)
+	}
+}
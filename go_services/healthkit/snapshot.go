@@ -0,0 +1,65 @@
+package healthkit
+
+// Immutable status snapshots. GetStatus used to copy the services map under
+// RLock on every call; with several readers coming (SSE broadcaster, badge
+// endpoint, status page, alert evaluator) that copy and the lock traffic
+// multiply per request. Instead, writers — the rare path — build a fresh
+// snapshot of the service map, its messages and the computed aggregate, and
+// publish it through an atomic.Pointer; readers grab the pointer without
+// taking mu at all. Published maps are never mutated again (copy-on-write),
+// so handing them to a reader is safe by construction — but they are shared,
+// so readers must treat them as read-only.
+
+// statusSnapshot is one immutable published view. status carries only the
+// service-derived aggregate ("healthy"/"degraded"); maintenance and the shard
+// disconnect grace are separate state and still override it in GetStatus.
+type statusSnapshot struct {
+	services map[string]bool
+	messages map[string]string
+	status   string
+	// generation increments on every publish, so a change-driven consumer
+	// (e.g. an SSE broadcaster) can cheaply detect "something changed"
+	// without diffing maps.
+	generation uint64
+}
+
+// emptyStatusSnapshot serves reads that land before the first publish.
+var emptyStatusSnapshot = &statusSnapshot{
+	services: map[string]bool{},
+	messages: map[string]string{},
+	status:   "healthy",
+}
+
+// publishStatusSnapshotLocked rebuilds and publishes the snapshot from the
+// master maps. Caller holds mu (write); every mutation of h.services or
+// h.serviceMessages must call this before releasing the lock, or readers
+// keep seeing the previous state.
+func (h *Service) publishStatusSnapshotLocked() {
+	services := make(map[string]bool, len(h.services))
+	status := "healthy"
+	for name, healthy := range h.services {
+		services[name] = healthy
+		if !healthy {
+			status = "degraded"
+		}
+	}
+	messages := make(map[string]string, len(h.serviceMessages))
+	for name, msg := range h.serviceMessages {
+		messages[name] = msg
+	}
+	h.snapshotGeneration++
+	h.statusSnapshot.Store(&statusSnapshot{
+		services:   services,
+		messages:   messages,
+		status:     status,
+		generation: h.snapshotGeneration,
+	})
+}
+
+// loadStatusSnapshot returns the current published snapshot, never nil.
+func (h *Service) loadStatusSnapshot() *statusSnapshot {
+	if snap := h.statusSnapshot.Load(); snap != nil {
+		return snap
+	}
+	return emptyStatusSnapshot
+}
@@ -0,0 +1,161 @@
+package healthkit
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestStatusSnapshot_ImmutableAcrossWrites(t *testing.T) {
+	hs := New(WithVersion("test"))
+	hs.SetServiceStatus("bot", true)
+
+	before := hs.GetStatus()
+	if before.Status != "healthy" || !before.Services["bot"] {
+		t.Fatalf("unexpected baseline: %+v", before)
+	}
+
+	// A later write must publish a NEW snapshot; the map already handed out
+	// stays exactly as it was.
+	hs.SetServiceStatus("bot", false)
+	hs.SetServiceStatus("database", true)
+	if !before.Services["bot"] {
+		t.Error("earlier snapshot mutated by a later write")
+	}
+	if _, ok := before.Services["database"]; ok {
+		t.Error("earlier snapshot grew a service added after it was taken")
+	}
+
+	after := hs.GetStatus()
+	if after.Status != "degraded" || after.Services["bot"] {
+		t.Errorf("new snapshot missing the write: %+v", after)
+	}
+}
+
+func TestStatusSnapshot_MessagesFollowWrites(t *testing.T) {
+	hs := New(WithVersion("test"))
+	hs.SetServiceStatus("bot", false)
+	hs.SetServiceMessage("bot", "reconnecting")
+
+	if got := hs.ServiceMessages()["bot"]; got != "reconnecting" {
+		t.Errorf("message = %q, want %q", got, "reconnecting")
+	}
+	held := hs.ServiceMessages()
+
+	hs.SetServiceMessage("bot", "")
+	if _, ok := hs.ServiceMessages()["bot"]; ok {
+		t.Error("cleared message still visible in a fresh snapshot")
+	}
+	if held["bot"] != "reconnecting" {
+		t.Error("earlier messages snapshot mutated by the clear")
+	}
+}
+
+func TestStatusSnapshot_GenerationAdvances(t *testing.T) {
+	hs := New(WithVersion("test"))
+	g0 := hs.loadStatusSnapshot().generation
+	hs.SetServiceStatus("bot", true)
+	g1 := hs.loadStatusSnapshot().generation
+	hs.SetServiceMessage("bot", "note")
+	g2 := hs.loadStatusSnapshot().generation
+	if !(g0 < g1 && g1 < g2) {
+		t.Errorf("generations did not advance: %d, %d, %d", g0, g1, g2)
+	}
+}
+
+func TestStatusSnapshot_ReadBeforeFirstWrite(t *testing.T) {
+	hs := New(WithVersion("test"))
+	status := hs.GetStatus()
+	if status.Status != "healthy" || len(status.Services) != 0 {
+		t.Errorf("pre-publish read: %+v", status)
+	}
+	if msgs := hs.ServiceMessages(); len(msgs) != 0 {
+		t.Errorf("pre-publish messages: %v", msgs)
+	}
+}
+
+// TestStatusSnapshot_RaceReadersWriters exists for the race detector (the CI
+// gate runs -race): many concurrent readers over GetStatus/ServiceMessages
+// while writers churn the service map must produce no data race — readers
+// only ever touch published immutable maps.
+func TestStatusSnapshot_RaceReadersWriters(t *testing.T) {
+	hs := New(WithVersion("test"))
+	const (
+		writers    = 4
+		readers    = 8
+		iterations = 200
+	)
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			name := fmt.Sprintf("service-%d", w)
+			for i := 0; i < iterations; i++ {
+				hs.SetServiceStatus(name, i%2 == 0)
+				hs.SetServiceMessage(name, fmt.Sprintf("iteration %d", i))
+			}
+		}(w)
+	}
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				status := hs.GetStatus()
+				for name, healthy := range status.Services {
+					_ = name
+					_ = healthy
+				}
+				for _, msg := range hs.ServiceMessages() {
+					_ = msg
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(hs.GetStatus().Services); got != writers {
+		t.Errorf("final snapshot has %d services, want %d", got, writers)
+	}
+}
+
+// BenchmarkGetStatus_ParallelReaders measures read throughput under a
+// concurrent writer — the scenario the snapshot model optimizes. The
+// pre-snapshot implementation (map copy under RLock per call) sat around the
+// writer's lock; with the atomic.Pointer the readers never contend on mu for
+// the services view.
+func BenchmarkGetStatus_ParallelReaders(b *testing.B) {
+	hs := New(WithVersion("bench"))
+	for i := 0; i < 50; i++ {
+		hs.SetServiceStatus(fmt.Sprintf("service-%d", i), true)
+	}
+
+	stop := make(chan struct{})
+	var writerDone sync.WaitGroup
+	writerDone.Add(1)
+	go func() {
+		defer writerDone.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				hs.SetServiceStatus(fmt.Sprintf("service-%d", i%50), i%2 == 0)
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if status := hs.GetStatus(); status.Services == nil {
+				b.Fatal("nil services")
+			}
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	writerDone.Wait()
+}
@@ -0,0 +1,108 @@
+package healthkit
+
+// Kubernetes startupProbe support. /health/ready flips READY as soon as the
+// default service map is seeded, long before the Python bot has actually
+// connected to Discord — so a startupProbe pointed at it passes instantly and
+// the kubelet starts counting liveness failures against a pod that is still
+// warming up. GET /health/startup stays 503 until either every required
+// service (STARTUP_REQUIRED_SERVICES) has reported healthy at least once, or
+// the grace deadline (STARTUP_GRACE_SECONDS after process start) passes.
+// Either way the answer then latches to 200 permanently: a startup probe that
+// regresses after first success would make the kubelet treat a running pod as
+// never-started, which is exactly the restart loop this endpoint exists to
+// prevent. Later flapping is readiness's problem, not startup's.
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WithStartupRequirements sets the services that must each report healthy at
+// least once — and the grace period after which startup passes regardless —
+// before /health/startup answers 200. An empty list means startup completes
+// immediately.
+func WithStartupRequirements(services []string, grace time.Duration) Option {
+	return func(h *Service) {
+		h.startupRequired = services
+		h.startupGrace = grace
+	}
+}
+
+// startupRequiredFromEnv parses STARTUP_REQUIRED_SERVICES, a comma-separated
+// list of service names. Empty entries are dropped; an empty result means no
+// service gates startup.
+func startupRequiredFromEnv() []string {
+	var required []string
+	for _, name := range strings.Split(os.Getenv("STARTUP_REQUIRED_SERVICES"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			required = append(required, name)
+		}
+	}
+	return required
+}
+
+// startupGraceFromEnv reads the STARTUP_GRACE_SECONDS deadline. Anything that
+// isn't a non-negative integer is rejected with a warning and the default (0 —
+// no deadline gating beyond the required services) is kept.
+func startupGraceFromEnv() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("STARTUP_GRACE_SECONDS"))
+	if raw == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Printf("WARNING: invalid STARTUP_GRACE_SECONDS %q (must be a non-negative integer) — ignoring", raw)
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+// StartupReport is the /health/startup document: whether startup has
+// completed, and — while it hasn't — which required services are still
+// missing their first healthy report.
+type StartupReport struct {
+	Started    bool     `json:"started"`
+	WaitingFor []string `json:"waiting_for,omitempty"`
+}
+
+// GetStartupReport evaluates (and, on success, latches) startup completion.
+func (h *Service) GetStartupReport() StartupReport {
+	now := h.clock.Now()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.startupDone {
+		return StartupReport{Started: true}
+	}
+
+	var waiting []string
+	for _, name := range h.startupRequired {
+		if !h.everHealthy[name] {
+			waiting = append(waiting, name)
+		}
+	}
+	graceExpired := h.startupGrace > 0 && !now.Before(h.startTime.Add(h.startupGrace))
+	if len(waiting) == 0 || graceExpired {
+		h.startupDone = true
+		return StartupReport{Started: true}
+	}
+	return StartupReport{Started: false, WaitingFor: waiting}
+}
+
+// handleStartup serves GET /health/startup. Anonymous like the other probes —
+// the kubelet sends no Authorization header.
+func (h *Service) handleStartup(w http.ResponseWriter, _ *http.Request) {
+	report := h.GetStartupReport()
+	w.Header().Set("Content-Type", "application/json")
+	if !report.Started {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("Failed to encode startup response: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package healthkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func startupReport(t *testing.T, r http.Handler) (int, StartupReport) {
+	t.Helper()
+	w := doReq(t, r, http.MethodGet, "/health/startup", "", "")
+	var report StartupReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("/health/startup body not JSON: %v", err)
+	}
+	return w.Code, report
+}
+
+func TestStartup_ServiceDriven(t *testing.T) {
+	hs := New(WithVersion("test"),
+		WithStartupRequirements([]string{"bot", "database"}, 0))
+	r := buildRouter(hs, "")
+
+	code, report := startupReport(t, r)
+	if code != http.StatusServiceUnavailable || report.Started {
+		t.Fatalf("before any report: HTTP %d %+v, want 503 not-started", code, report)
+	}
+	if len(report.WaitingFor) != 2 {
+		t.Errorf("waiting_for = %v, want both required services", report.WaitingFor)
+	}
+
+	// One of two required services is not enough.
+	hs.SetServiceStatus("bot", true)
+	if code, report = startupReport(t, r); code != http.StatusServiceUnavailable {
+		t.Fatalf("with bot only: HTTP %d, want 503", code)
+	}
+	if len(report.WaitingFor) != 1 || report.WaitingFor[0] != "database" {
+		t.Errorf("waiting_for = %v, want [database]", report.WaitingFor)
+	}
+
+	// An unhealthy report does not count as "has been healthy once".
+	hs.SetServiceStatus("database", false)
+	if code, _ = startupReport(t, r); code != http.StatusServiceUnavailable {
+		t.Fatal("unhealthy report must not satisfy the startup requirement")
+	}
+
+	hs.SetServiceStatus("database", true)
+	if code, report = startupReport(t, r); code != http.StatusOK || !report.Started {
+		t.Fatalf("all required healthy: HTTP %d %+v, want 200 started", code, report)
+	}
+}
+
+func TestStartup_GraceDeadline(t *testing.T) {
+	fc := newFakeClock(time.Unix(1000, 0))
+	hs := New(WithVersion("test"), WithClock(fc),
+		WithStartupRequirements([]string{"bot"}, 30*time.Second))
+	r := buildRouter(hs, "")
+
+	if code, _ := startupReport(t, r); code != http.StatusServiceUnavailable {
+		t.Fatal("inside the grace window with no reports: want 503")
+	}
+	fc.Advance(29 * time.Second)
+	if code, _ := startupReport(t, r); code != http.StatusServiceUnavailable {
+		t.Fatal("still inside the grace window: want 503")
+	}
+
+	// The deadline passes 200 even though "bot" never reported.
+	fc.Advance(2 * time.Second)
+	if code, report := startupReport(t, r); code != http.StatusOK || !report.Started {
+		t.Fatalf("past the grace deadline: HTTP %d %+v, want 200 started", code, report)
+	}
+}
+
+func TestStartup_PermanentAfterFirstSuccess(t *testing.T) {
+	hs := New(WithVersion("test"),
+		WithStartupRequirements([]string{"bot"}, 0))
+	r := buildRouter(hs, "")
+
+	hs.SetServiceStatus("bot", true)
+	if code, _ := startupReport(t, r); code != http.StatusOK {
+		t.Fatal("required service healthy: want 200")
+	}
+
+	// Startup never regresses — later failures are readiness's problem.
+	hs.SetServiceStatus("bot", false)
+	if code, report := startupReport(t, r); code != http.StatusOK || !report.Started {
+		t.Errorf("after bot went unhealthy: HTTP %d %+v, want the 200 latch to hold", code, report)
+	}
+}
+
+func TestStartup_NoRequirementsCompletesImmediately(t *testing.T) {
+	hs := New(WithVersion("test"))
+	r := buildRouter(hs, "")
+	if code, report := startupReport(t, r); code != http.StatusOK || !report.Started {
+		t.Errorf("unconfigured startup probe: HTTP %d %+v, want 200 started", code, report)
+	}
+}
+
+func TestStartupFromEnv(t *testing.T) {
+	t.Setenv("STARTUP_REQUIRED_SERVICES", " bot , ,database ")
+	t.Setenv("STARTUP_GRACE_SECONDS", "45")
+	required := startupRequiredFromEnv()
+	if len(required) != 2 || required[0] != "bot" || required[1] != "database" {
+		t.Errorf("required = %v, want [bot database]", required)
+	}
+	if got := startupGraceFromEnv(); got != 45*time.Second {
+		t.Errorf("grace = %v, want 45s", got)
+	}
+
+	// Invalid values fall back with a warning rather than failing startup.
+	for _, raw := range []string{"-1", "abc", "1.5"} {
+		t.Setenv("STARTUP_GRACE_SECONDS", raw)
+		if got := startupGraceFromEnv(); got != 0 {
+			t.Errorf("grace(%q) = %v, want 0", raw, got)
+		}
+	}
+}
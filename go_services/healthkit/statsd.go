@@ -0,0 +1,163 @@
+package healthkit
+
+// Optional StatsD ingestion: some sidecar scripts can only emit the StatsD
+// line protocol, not JSON pushes or Prometheus expositions. The listener
+// translates each line into a MetricsPayload and funnels it through
+// applyMetric — the SAME validation path as /metrics/push — so StatsD input
+// gets the identical allowlist/label/cardinality treatment and can never mint
+// series the HTTP surface couldn't. Lines that fail to parse or validate are
+// counted on discord_bot_statsd_dropped_total instead of being half-applied.
+//
+// Supported: `name:value|c` (counter, with optional `|@rate` sampling),
+// `name:value|g` (gauge; a +/- sign prefix means inc/dec, StatsD delta
+// semantics), `name:value|ms` (timer, milliseconds — converted to seconds for
+// the histograms), each with optional DogStatsD tags (`|#key:value,...`)
+// mapped onto payload labels.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// maxStatsDPacket bounds one read. 64KB is the UDP maximum; real StatsD
+// packets are far smaller, but a short buffer would silently truncate lines.
+const maxStatsDPacket = 65535
+
+var errStatsDMalformed = errors.New("malformed statsd line")
+
+// parseStatsDLine parses one StatsD line into the push-payload form. The
+// returned payload has NOT been validated — callers run it through
+// applyMetric, which owns the name/label/value rules.
+func parseStatsDLine(line string) (MetricsPayload, error) {
+	var p MetricsPayload
+
+	parts := strings.Split(line, "|")
+	if len(parts) < 2 {
+		return p, fmt.Errorf("%w: missing type section in %q", errStatsDMalformed, line)
+	}
+
+	name, rawValue, ok := strings.Cut(parts[0], ":")
+	if !ok || name == "" || rawValue == "" {
+		return p, fmt.Errorf("%w: want name:value, got %q", errStatsDMalformed, parts[0])
+	}
+	p.Name = name
+
+	// Gauge deltas: a leading sign means inc/dec of the magnitude (classic
+	// StatsD semantics). Recorded here, applied only if the type is g.
+	deltaOp := ""
+	switch rawValue[0] {
+	case '+':
+		deltaOp = "inc"
+		rawValue = rawValue[1:]
+	case '-':
+		deltaOp = "dec"
+		rawValue = rawValue[1:]
+	}
+	value, err := strconv.ParseFloat(rawValue, 64)
+	if err != nil {
+		return p, fmt.Errorf("%w: bad value %q", errStatsDMalformed, rawValue)
+	}
+	p.Value = value
+
+	// Optional sections after the type: |@rate (sampling) and |#tags.
+	sampleRate := 1.0
+	for _, extra := range parts[2:] {
+		switch {
+		case strings.HasPrefix(extra, "@"):
+			rate, err := strconv.ParseFloat(extra[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return p, fmt.Errorf("%w: bad sample rate %q", errStatsDMalformed, extra)
+			}
+			sampleRate = rate
+		case strings.HasPrefix(extra, "#"):
+			// DogStatsD tags → payload labels. Tags without a value carry no
+			// label information for us and are skipped.
+			for _, tag := range strings.Split(extra[1:], ",") {
+				if k, v, ok := strings.Cut(tag, ":"); ok && k != "" {
+					if p.Labels == nil {
+						p.Labels = make(map[string]string)
+					}
+					p.Labels[k] = v
+				}
+			}
+		default:
+			return p, fmt.Errorf("%w: unknown section %q", errStatsDMalformed, extra)
+		}
+	}
+
+	switch parts[1] {
+	case "c":
+		p.Type = "counter"
+		// A sampled counter stands in for 1/rate unsampled increments.
+		p.Value /= sampleRate
+	case "g":
+		p.Type = "gauge"
+		p.Op = deltaOp // empty → applyMetric's default "set"
+	case "ms":
+		// Timers are milliseconds on the wire; the histograms are seconds.
+		p.Type = "histogram"
+		p.Value /= 1000
+	default:
+		return p, fmt.Errorf("%w: unsupported type %q", errStatsDMalformed, parts[1])
+	}
+	if deltaOp != "" && parts[1] != "g" {
+		return p, fmt.Errorf("%w: signed value on non-gauge type %q", errStatsDMalformed, parts[1])
+	}
+
+	return p, nil
+}
+
+// handleStatsDPacket applies every line of one datagram (lines are
+// newline-separated, per the multi-metric packet convention). Bad lines bump
+// the dropped counter and never abort the rest of the packet.
+func (h *Service) handleStatsDPacket(buf []byte) {
+	for _, line := range strings.Split(string(buf), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		p, err := parseStatsDLine(line)
+		if err != nil {
+			h.metrics.statsdDropped.Inc()
+			continue
+		}
+		if reason := h.applyMetric(p); reason != "" {
+			// Unknown names land here too (reasonUnknownName) — counted, not
+			// minted as new series, exactly like the HTTP push path.
+			h.metrics.statsdDropped.Inc()
+		}
+	}
+}
+
+// ServeStatsD reads StatsD datagrams from conn until ctx is cancelled, then
+// closes the socket and returns. Run it as a goroutine with the same context
+// as StartCollector so both stop together on shutdown.
+func (h *Service) ServeStatsD(ctx context.Context, conn net.PacketConn) {
+	// Closing the socket is what unblocks the ReadFrom below; do it from a
+	// watcher so cancellation doesn't race a blocked read.
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+
+	buf := make([]byte, maxStatsDPacket)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				log.Println("StatsD listener stopped")
+				return
+			}
+			// UDP reads only fail for socket-level problems, not bad peers —
+			// keep the process up, lose the listener.
+			log.Printf("StatsD read error: %v — listener stopping", err)
+			return
+		}
+		h.handleStatsDPacket(buf[:n])
+	}
+}
@@ -0,0 +1,174 @@
+package healthkit
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseStatsDLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    MetricsPayload
+		wantErr bool
+	}{
+		{
+			"counter",
+			"requests:1|c",
+			MetricsPayload{Type: "counter", Name: "requests", Value: 1},
+			false,
+		},
+		{
+			"counter with tags",
+			"requests:2|c|#status:success,endpoint:ai",
+			MetricsPayload{Type: "counter", Name: "requests", Value: 2,
+				Labels: map[string]string{"status": "success", "endpoint": "ai"}},
+			false,
+		},
+		{
+			"sampled counter scales by 1/rate",
+			"cache:1|c|@0.25|#result:hit",
+			MetricsPayload{Type: "counter", Name: "cache", Value: 4,
+				Labels: map[string]string{"result": "hit"}},
+			false,
+		},
+		{
+			"gauge set",
+			"active_connections:12|g",
+			MetricsPayload{Type: "gauge", Name: "active_connections", Value: 12},
+			false,
+		},
+		{
+			"gauge inc",
+			"active_connections:+5|g",
+			MetricsPayload{Type: "gauge", Name: "active_connections", Value: 5, Op: "inc"},
+			false,
+		},
+		{
+			"gauge dec",
+			"active_connections:-3|g",
+			MetricsPayload{Type: "gauge", Name: "active_connections", Value: 3, Op: "dec"},
+			false,
+		},
+		{
+			"timer ms converts to seconds",
+			"request_duration:250|ms|#endpoint:ai",
+			MetricsPayload{Type: "histogram", Name: "request_duration", Value: 0.25,
+				Labels: map[string]string{"endpoint": "ai"}},
+			false,
+		},
+		{"no type section", "requests:1", MetricsPayload{}, true},
+		{"no colon", "requests|c", MetricsPayload{}, true},
+		{"empty value", "requests:|c", MetricsPayload{}, true},
+		{"bad value", "requests:lots|c", MetricsPayload{}, true},
+		{"unsupported type (set)", "uniques:1|s", MetricsPayload{}, true},
+		{"signed counter rejected", "requests:+1|c", MetricsPayload{}, true},
+		{"bad sample rate", "requests:1|c|@0", MetricsPayload{}, true},
+		{"sample rate above 1", "requests:1|c|@1.5", MetricsPayload{}, true},
+		{"unknown extra section", "requests:1|c|%wat", MetricsPayload{}, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseStatsDLine(tc.line)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("parseStatsDLine(%q) error = nil, want non-nil", tc.line)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseStatsDLine(%q) error = %v", tc.line, err)
+			}
+			if got.Type != tc.want.Type || got.Name != tc.want.Name ||
+				got.Value != tc.want.Value || got.Op != tc.want.Op {
+				t.Errorf("parseStatsDLine(%q) = %+v, want %+v", tc.line, got, tc.want)
+			}
+			if len(got.Labels) != len(tc.want.Labels) {
+				t.Fatalf("labels = %v, want %v", got.Labels, tc.want.Labels)
+			}
+			for k, v := range tc.want.Labels {
+				if got.Labels[k] != v {
+					t.Errorf("label %q = %q, want %q", k, got.Labels[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleStatsDPacket(t *testing.T) {
+	hs := New(WithVersion("test"))
+
+	// One multi-metric packet: two good lines, one unknown name, one
+	// unparseable line. The good lines apply, the bad ones only bump the
+	// dropped counter — never abort the rest of the packet.
+	packet := "requests:3|c|#status:success,endpoint:ai\n" +
+		"active_connections:7|g\n" +
+		"sidecar_只pecial:1|c\n" +
+		"broken line\n"
+	hs.handleStatsDPacket([]byte(packet))
+
+	if got := testutil.ToFloat64(hs.metrics.requestsTotal.WithLabelValues("ai", "success")); got != 3 {
+		t.Errorf("requests{ai,success} = %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(hs.metrics.activeConnections); got != 7 {
+		t.Errorf("active_connections = %v, want 7", got)
+	}
+	if got := testutil.ToFloat64(hs.metrics.statsdDropped); got != 2 {
+		t.Errorf("statsd_dropped = %v, want 2 (unknown name + unparseable)", got)
+	}
+
+	// Junk labels collapse to "other" through the shared applyMetric path —
+	// StatsD input gets no cardinality privileges over HTTP pushes.
+	hs.handleStatsDPacket([]byte("requests:1|c|#status:weird-9000,endpoint:NOPE!"))
+	if got := testutil.ToFloat64(hs.metrics.requestsTotal.WithLabelValues("other", "other")); got != 1 {
+		t.Errorf(`requests{other,other} = %v, want 1`, got)
+	}
+}
+
+func TestServeStatsD_EndToEnd(t *testing.T) {
+	hs := New(WithVersion("test"))
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		hs.ServeStatsD(ctx, conn)
+	}()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+	if _, err := client.Write([]byte("rate_limit:5|c|#type:user")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	// UDP delivery is async; poll the metric with a deadline instead of a
+	// fixed sleep.
+	series := hs.metrics.rateLimitHits.WithLabelValues("user")
+	deadline := time.Now().Add(2 * time.Second)
+	for testutil.ToFloat64(series) != 5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("rate_limit{user} = %v, want 5 before deadline", testutil.ToFloat64(series))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Cancelling the context must stop the listener (the same contract the
+	// collector goroutine has — one shutdown context stops both).
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("ServeStatsD did not return after context cancellation")
+	}
+}
@@ -0,0 +1,80 @@
+package healthkit
+
+// Extended process/host metrics for the collector tick. Memory and goroutines
+// alone missed two real incidents: an fd leak that exhausted the rlimit and a
+// full data volume — neither surfaced anywhere until the process fell over.
+// readSysStats (per-platform, build-tagged) reads process CPU seconds, the
+// open-fd count and its rlimit, and free bytes on the data volume (DISK_PATH,
+// default "/"). CollectSystemMetrics exports them as gauges and mirrors them
+// into the /health Metrics map via the same cached-atomics pattern as
+// MemStats. Non-Linux platforms degrade gracefully: one log line, no gauges
+// touched, /health simply lacks the extra keys.
+
+import (
+	"log"
+	"math"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// atomicFloat64 is a float64 behind an atomic bit pattern, so the collector
+// can publish CPU seconds the same lock-free way as the cachedMem* counters.
+type atomicFloat64 struct{ bits atomic.Uint64 }
+
+func (a *atomicFloat64) Store(v float64) { a.bits.Store(math.Float64bits(v)) }
+func (a *atomicFloat64) Load() float64   { return math.Float64frombits(a.bits.Load()) }
+
+// sysStats is one sample of the extended process/host statistics.
+type sysStats struct {
+	// CPUSeconds is cumulative user+system CPU time consumed by the process.
+	CPUSeconds float64
+	// OpenFDs / MaxFDs are the current open-descriptor count and its rlimit.
+	OpenFDs uint64
+	MaxFDs  uint64
+	// DiskFreeBytes is the space available to unprivileged writes on the
+	// configured data volume.
+	DiskFreeBytes uint64
+}
+
+// defaultDiskPath is the volume whose free space is tracked when DISK_PATH
+// is not set.
+const defaultDiskPath = "/"
+
+// WithDiskPath sets the volume readSysStats reports free space for.
+func WithDiskPath(path string) Option {
+	return func(h *Service) {
+		if path != "" {
+			h.diskPath = path
+		}
+	}
+}
+
+// diskPathFromEnv reads the DISK_PATH override for the tracked volume.
+func diskPathFromEnv() string {
+	return strings.TrimSpace(os.Getenv("DISK_PATH"))
+}
+
+// collectSysStats runs one extended sample: gauges, cached atomics for
+// /health, and the one-time unavailability log. Called from
+// CollectSystemMetrics on the collector tick.
+func (h *Service) collectSysStats() {
+	stats, err := readSysStats(h.diskPath)
+	if err != nil {
+		// One line, once — on a non-Linux host this is permanent, and on a
+		// broken DISK_PATH a warning per 10s tick would drown the log.
+		h.sysStatsWarnOnce.Do(func() {
+			log.Printf("WARNING: extended system metrics unavailable: %v", err)
+		})
+		return
+	}
+	h.metrics.cpuSeconds.Set(stats.CPUSeconds)
+	h.metrics.openFDs.Set(float64(stats.OpenFDs))
+	h.metrics.maxFDs.Set(float64(stats.MaxFDs))
+	h.metrics.diskFreeBytes.Set(float64(stats.DiskFreeBytes))
+	h.cachedCPUSeconds.Store(stats.CPUSeconds)
+	h.cachedOpenFDs.Store(stats.OpenFDs)
+	h.cachedMaxFDs.Store(stats.MaxFDs)
+	h.cachedDiskFree.Store(stats.DiskFreeBytes)
+	h.sysStatsOK.Store(true)
+}
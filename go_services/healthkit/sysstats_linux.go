@@ -0,0 +1,54 @@
+//go:build linux
+
+package healthkit
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// readSysStats samples the extended process/host statistics on Linux:
+// Getrusage for CPU time, /proc/self/fd for the open-descriptor count,
+// RLIMIT_NOFILE for its ceiling, and Statfs on diskPath for free space.
+// Any sub-read failing fails the sample — a partial sample would publish
+// zeros that look like a full disk or a descriptor leak fixing itself.
+func readSysStats(diskPath string) (sysStats, error) {
+	var stats sysStats
+
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return sysStats{}, fmt.Errorf("getrusage: %w", err)
+	}
+	stats.CPUSeconds = rusageSeconds(ru.Utime) + rusageSeconds(ru.Stime)
+
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return sysStats{}, fmt.Errorf("reading /proc/self/fd: %w", err)
+	}
+	// ReadDir itself held one descriptor open for the listing.
+	stats.OpenFDs = uint64(len(entries)) - 1
+
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil {
+		return sysStats{}, fmt.Errorf("getrlimit: %w", err)
+	}
+	stats.MaxFDs = rl.Cur
+
+	if diskPath == "" {
+		diskPath = defaultDiskPath
+	}
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(diskPath, &fs); err != nil {
+		return sysStats{}, fmt.Errorf("statfs %s: %w", diskPath, err)
+	}
+	// Bavail, not Bfree: what an unprivileged write can actually use.
+	stats.DiskFreeBytes = fs.Bavail * uint64(fs.Bsize)
+
+	return stats, nil
+}
+
+// rusageSeconds converts one rusage timeval to seconds.
+func rusageSeconds(tv syscall.Timeval) float64 {
+	return float64(tv.Sec) + float64(tv.Usec)/1e6
+}
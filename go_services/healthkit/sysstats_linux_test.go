@@ -0,0 +1,89 @@
+//go:build linux
+
+package healthkit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReadSysStats(t *testing.T) {
+	stats, err := readSysStats(t.TempDir())
+	if err != nil {
+		t.Fatalf("readSysStats: %v", err)
+	}
+	if stats.CPUSeconds < 0 {
+		t.Errorf("CPUSeconds = %v, want >= 0", stats.CPUSeconds)
+	}
+	if stats.OpenFDs == 0 {
+		t.Error("OpenFDs = 0 — a running test binary holds descriptors")
+	}
+	if stats.MaxFDs < stats.OpenFDs {
+		t.Errorf("MaxFDs (%d) < OpenFDs (%d)", stats.MaxFDs, stats.OpenFDs)
+	}
+	if stats.DiskFreeBytes == 0 {
+		t.Error("DiskFreeBytes = 0 on a tmpdir we just wrote to")
+	}
+}
+
+func TestReadSysStats_CountsOpenedDescriptor(t *testing.T) {
+	before, err := readSysStats("/")
+	if err != nil {
+		t.Fatalf("readSysStats: %v", err)
+	}
+	f, err := os.CreateTemp(t.TempDir(), "fd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	after, err := readSysStats("/")
+	if err != nil {
+		t.Fatalf("readSysStats: %v", err)
+	}
+	if after.OpenFDs <= before.OpenFDs {
+		t.Errorf("OpenFDs %d -> %d, want an increase after opening a file", before.OpenFDs, after.OpenFDs)
+	}
+}
+
+func TestReadSysStats_BadDiskPath(t *testing.T) {
+	if _, err := readSysStats(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("want an error for a nonexistent DISK_PATH, not a zero free-space sample")
+	}
+}
+
+func TestCollectSystemMetrics_ExtendedStats(t *testing.T) {
+	hs := New(WithVersion("test"), WithClock(newFakeClock(time.Unix(1000, 0))),
+		WithDiskPath(t.TempDir()))
+	hs.CollectSystemMetrics()
+
+	if got := testutil.ToFloat64(hs.metrics.openFDs); got == 0 {
+		t.Error("open-fds gauge not populated by the collector")
+	}
+	if got := testutil.ToFloat64(hs.metrics.diskFreeBytes); got == 0 {
+		t.Error("disk-free gauge not populated by the collector")
+	}
+	if max, open := testutil.ToFloat64(hs.metrics.maxFDs), testutil.ToFloat64(hs.metrics.openFDs); max < open {
+		t.Errorf("max-fds gauge (%v) < open-fds gauge (%v)", max, open)
+	}
+
+	// The same sample is mirrored into the /health metrics map.
+	metrics := hs.GetStatus().Metrics
+	for _, key := range []string{"cpu_seconds", "open_fds", "max_fds", "disk_free_mb"} {
+		if _, ok := metrics[key]; !ok {
+			t.Errorf("/health metrics missing %q", key)
+		}
+	}
+}
+
+func TestCollectSysStats_BadPathKeepsHealthKeysAbsent(t *testing.T) {
+	hs := New(WithVersion("test"), WithClock(newFakeClock(time.Unix(1000, 0))),
+		WithDiskPath(filepath.Join(t.TempDir(), "missing")))
+	hs.CollectSystemMetrics()
+	if _, ok := hs.GetStatus().Metrics["disk_free_mb"]; ok {
+		t.Error("a failing sample must not surface extended keys on /health")
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package healthkit
+
+import "errors"
+
+// errSysStatsUnsupported marks platforms without an extended-stats reader.
+var errSysStatsUnsupported = errors.New("extended system metrics are only implemented on linux")
+
+// readSysStats degrades gracefully off Linux: the caller logs once and the
+// extended gauges / health keys simply never appear.
+func readSysStats(string) (sysStats, error) {
+	return sysStats{}, errSysStatsUnsupported
+}
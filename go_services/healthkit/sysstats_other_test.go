@@ -0,0 +1,21 @@
+//go:build !linux
+
+package healthkit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReadSysStats_UnsupportedPlatform(t *testing.T) {
+	if _, err := readSysStats("/"); err == nil {
+		t.Fatal("non-Linux readSysStats must report unsupported, not fake zeros")
+	}
+
+	// The collector degrades gracefully: no extended keys, no panic.
+	hs := New(WithVersion("test"), WithClock(newFakeClock(time.Unix(1000, 0))))
+	hs.CollectSystemMetrics()
+	if _, ok := hs.GetStatus().Metrics["cpu_seconds"]; ok {
+		t.Error("extended keys must stay absent on unsupported platforms")
+	}
+}
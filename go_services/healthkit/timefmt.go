@@ -0,0 +1,22 @@
+package healthkit
+
+// Canonical timestamp rendering. Every server-generated timestamp the two Go
+// services emit — /health's Timestamp, heartbeat LastSeen, shard LastReport,
+// maintenance Until, /stats/cost Since — goes through formatTimestamp so they
+// all read as UTC RFC3339 with millisecond precision. Second-granularity
+// stamps made cross-referencing against the Python side's logs (which carry
+// milliseconds) a guessing game; a single helper keeps the precision and the
+// UTC normalization from drifting apart per call site.
+
+import "time"
+
+// rfc3339Milli is time.RFC3339 with exactly three fractional digits. The
+// fixed width matters: Go's ".999" trims trailing zeros, which would make the
+// field width wobble and break naive lexicographic sorting in log tooling.
+const rfc3339Milli = "2006-01-02T15:04:05.000Z07:00"
+
+// formatTimestamp renders t as UTC RFC3339 with milliseconds — the one
+// timestamp format the services emit.
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(rfc3339Milli)
+}
@@ -0,0 +1,140 @@
+package healthkit
+
+// Per-route handler timeouts. A single blanket timeout can't fit this
+// surface: /health/live answers in microseconds while a /metrics scrape of a
+// big registry legitimately takes seconds, so any one number either cuts
+// scrapes off mid-body or lets a wedged probe hold a connection for half a
+// minute. Each route class gets its own budget — probes 2s, /metrics 15s,
+// push endpoints 10s, /stats reads 5s — each overridable via
+// *_TIMEOUT_SECONDS (0 disables that class).
+//
+// The wrapper runs the handler on its own goroutine against a buffered
+// response writer, which is what makes it safe where chi's
+// middleware.Timeout is not: a handler that ignores its context and writes
+// after the deadline writes into the abandoned buffer, never racing a
+// "superfluous WriteHeader" against the timeout response. When a timeout
+// fires the client gets the structured JSON error envelope (code "timeout")
+// instead of a plain-text body, and health_api_handler_timeouts_total{route}
+// increments so a route that starts missing its budget shows up on the
+// scrape before users report hangs.
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default per-class budgets; see timeoutFromEnv for the overrides.
+const (
+	defaultProbeTimeout   = 2 * time.Second
+	defaultMetricsTimeout = 15 * time.Second
+	defaultPushTimeout    = 10 * time.Second
+	defaultStatsTimeout   = 5 * time.Second
+)
+
+// timeoutFromEnv reads one per-class budget from the named env var (whole
+// seconds; 0 disables the class). The usual fail-safe posture: anything
+// invalid keeps the default with a warning.
+func timeoutFromEnv(name string, fallback time.Duration) time.Duration {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Printf("WARNING: invalid %s %q (must be a non-negative integer) — using %s", name, raw, fallback)
+		return fallback
+	}
+	return time.Duration(n) * time.Second
+}
+
+// WithHandlerTimeouts overrides the per-class budgets. Negative values keep
+// the defaults; zero disables the class.
+func WithHandlerTimeouts(probes, metrics, push, stats time.Duration) Option {
+	return func(h *Service) {
+		if probes >= 0 {
+			h.probeTimeout = probes
+		}
+		if metrics >= 0 {
+			h.metricsTimeout = metrics
+		}
+		if push >= 0 {
+			h.pushTimeout = push
+		}
+		if stats >= 0 {
+			h.statsTimeout = stats
+		}
+	}
+}
+
+// timeoutWriter buffers everything the handler writes so nothing reaches the
+// real connection until the handler finishes inside its budget. Only the
+// handler goroutine touches it; the wrapper reads it back strictly after the
+// done channel closes.
+type timeoutWriter struct {
+	hdr  http.Header
+	buf  bytes.Buffer
+	code int
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.hdr }
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) { return tw.buf.Write(b) }
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	if tw.code == 0 {
+		tw.code = code
+	}
+}
+
+// timeoutMiddleware bounds every wrapped handler to d, answering 503 with
+// the JSON error envelope and counting the event when the budget is missed.
+// d <= 0 disables the wrapper entirely.
+func (h *Service) timeoutMiddleware(route string, d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if d <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			tw := &timeoutWriter{hdr: make(http.Header)}
+			done := make(chan any, 1)
+			go func() {
+				defer func() {
+					// Recover only to carry the panic back; re-panicking on
+					// the request goroutine hands it to the recoverer
+					// middleware like any other handler panic.
+					done <- recover()
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+			}()
+			select {
+			case p := <-done:
+				if p != nil {
+					panic(p)
+				}
+				dst := w.Header()
+				for k, v := range tw.hdr {
+					dst[k] = v
+				}
+				if tw.code != 0 {
+					w.WriteHeader(tw.code)
+				}
+				if _, err := w.Write(tw.buf.Bytes()); err != nil {
+					log.Printf("Failed to write buffered response: %v", err)
+				}
+			case <-ctx.Done():
+				h.metrics.handlerTimeouts.WithLabelValues(route).Inc()
+				log.Printf("WARNING: %s %s exceeded the %s route budget (%s)", r.Method, r.URL.Path, route, d)
+				writeError(w, http.StatusServiceUnavailable, errCodeTimeout, "handler timed out",
+					map[string]any{"route": route, "timeout": d.String()})
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package healthkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// slowHandler blocks until the request context is cancelled or d elapses,
+// then writes OK. Respecting ctx keeps the test goroutine from outliving the
+// test; the wrapper's buffered writer is what keeps the late write harmless.
+func slowHandler(d time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(d):
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("late"))
+	})
+}
+
+func TestTimeoutMiddlewareFires(t *testing.T) {
+	hs := New(WithVersion("test"))
+	wrapped := hs.timeoutMiddleware("probes", 5*time.Millisecond)(slowHandler(time.Second))
+
+	rec := httptest.NewRecorder()
+	wrapped.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+	env := decodeErrorEnvelope(t, rec)
+	if env.Code != errCodeTimeout {
+		t.Errorf("code = %q, want %q", env.Code, errCodeTimeout)
+	}
+	if env.Details["route"] != "probes" {
+		t.Errorf("details = %v, want route probes", env.Details)
+	}
+
+	mf := findMetric(t, hs, "health_api_handler_timeouts_total")
+	if mf == nil {
+		t.Fatal("health_api_handler_timeouts_total not registered")
+	}
+	m := mf.GetMetric()
+	if len(m) != 1 || m[0].GetCounter().GetValue() != 1 {
+		t.Fatalf("timeout counter = %v, want one series at 1", m)
+	}
+	if got := m[0].GetLabel()[0]; got.GetName() != "route" || got.GetValue() != "probes" {
+		t.Errorf("counter labels = %v, want route=probes", m[0].GetLabel())
+	}
+}
+
+func TestTimeoutMiddlewarePassthrough(t *testing.T) {
+	hs := New(WithVersion("test"))
+	wrapped := hs.timeoutMiddleware("stats", time.Second)(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Custom", "yes")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte("body"))
+		}))
+
+	rec := httptest.NewRecorder()
+	wrapped.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+
+	// The buffered writer must replay status, headers and body untouched.
+	if rec.Code != http.StatusCreated || rec.Body.String() != "body" || rec.Header().Get("X-Custom") != "yes" {
+		t.Errorf("replayed response = %d %q %q, want 201 body yes", rec.Code, rec.Body.String(), rec.Header().Get("X-Custom"))
+	}
+	if mf := findMetric(t, hs, "health_api_handler_timeouts_total"); mf != nil && len(mf.GetMetric()) > 0 {
+		t.Errorf("timeout counter incremented on a fast handler: %v", mf.GetMetric())
+	}
+}
+
+func TestTimeoutMiddlewareDisabled(t *testing.T) {
+	hs := New(WithVersion("test"))
+	wrapped := hs.timeoutMiddleware("metrics", 0)(slowHandler(20 * time.Millisecond))
+
+	rec := httptest.NewRecorder()
+	wrapped.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	// A zero budget disables the class entirely — the slow handler finishes.
+	if rec.Code != http.StatusOK || rec.Body.String() != "late" {
+		t.Errorf("response = %d %q, want the handler's own 200", rec.Code, rec.Body.String())
+	}
+	if mf := findMetric(t, hs, "health_api_handler_timeouts_total"); mf != nil && len(mf.GetMetric()) > 0 {
+		t.Errorf("timeout counter incremented with the class disabled: %v", mf.GetMetric())
+	}
+}
+
+func TestTimeoutMiddlewarePanicPropagates(t *testing.T) {
+	hs := New(WithVersion("test"))
+	// recoverer outside, timeout inside — the same nesting Routes builds.
+	wrapped := recoverer(hs.timeoutMiddleware("push", time.Second)(http.HandlerFunc(
+		func(http.ResponseWriter, *http.Request) {
+			panic("boom")
+		})))
+
+	rec := httptest.NewRecorder()
+	wrapped.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/metrics/push", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	if env := decodeErrorEnvelope(t, rec); env.Code != errCodeInternal {
+		t.Errorf("code = %q, want internal", env.Code)
+	}
+}
+
+func TestTimeoutRouteBudgets(t *testing.T) {
+	// Mount a slow handler behind each class's real budget, shrunk to
+	// milliseconds via the option, and confirm each fires independently.
+	hs := New(WithVersion("test"),
+		WithHandlerTimeouts(time.Millisecond, time.Millisecond, time.Millisecond, time.Millisecond))
+
+	routes := []struct {
+		route string
+		mw    func(http.Handler) http.Handler
+	}{
+		{"probes", hs.timeoutMiddleware("probes", hs.probeTimeout)},
+		{"metrics", hs.timeoutMiddleware("metrics", hs.metricsTimeout)},
+		{"push", hs.timeoutMiddleware("push", hs.pushTimeout)},
+		{"stats", hs.timeoutMiddleware("stats", hs.statsTimeout)},
+	}
+	for _, tt := range routes {
+		t.Run(tt.route, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.mw(slowHandler(time.Second)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != http.StatusServiceUnavailable {
+				t.Fatalf("status = %d, want 503", rec.Code)
+			}
+			if env := decodeErrorEnvelope(t, rec); env.Details["route"] != tt.route {
+				t.Errorf("details = %v, want route %s", env.Details, tt.route)
+			}
+		})
+	}
+
+	mf := findMetric(t, hs, "health_api_handler_timeouts_total")
+	if mf == nil || len(mf.GetMetric()) != 4 {
+		t.Fatalf("timeout counter series = %v, want one per route class", mf)
+	}
+}
+
+func TestTimeoutFromEnv(t *testing.T) {
+	tests := []struct {
+		name, raw string
+		want      time.Duration
+	}{
+		{"unset", "", defaultStatsTimeout},
+		{"valid", "30", 30 * time.Second},
+		{"zero disables", "0", 0},
+		{"negative", "-1", defaultStatsTimeout},
+		{"junk", "fast", defaultStatsTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("STATS_TIMEOUT_SECONDS", tt.raw)
+			if got := timeoutFromEnv("STATS_TIMEOUT_SECONDS", defaultStatsTimeout); got != tt.want {
+				t.Errorf("timeoutFromEnv = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
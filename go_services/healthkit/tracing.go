@@ -0,0 +1,411 @@
+package healthkit
+
+// Distributed-trace export for the push surface. The Python bot emits OTel
+// traces; setting OTEL_EXPORTER_OTLP_ENDPOINT makes this service join them:
+// incoming W3C traceparent headers are honored, every routed request becomes
+// a server span named "<METHOD> <route pattern>", the batch-processing loop
+// gets a child span carrying item/rejected counts, and rejected payloads are
+// recorded as span events with their stable reason strings. Spans are
+// buffered and shipped as OTLP/HTTP JSON to <endpoint>/v1/traces in
+// background batches; FlushTraces drains the tail inside the graceful
+// shutdown window.
+//
+// Like the remote-write receiver (remotewrite.go), this speaks the published
+// wire format directly instead of importing the OTel SDK: the SDK plus
+// otelhttp plus the OTLP exporter is a dependency tree larger than this whole
+// module, and the slice this service needs — propagate one header, emit
+// server spans with a handful of attributes — is two small message shapes
+// with a stability guarantee (the OTLP JSON mapping and the traceparent
+// grammar are both versioned specs). When the env var is unset the tracer is
+// nil and the middleware is never installed, so the disabled path costs
+// nothing at all.
+//
+// Buffering is bounded: past maxTraceBuffer queued spans, new ones are
+// dropped (and counted in the logs) rather than growing without limit when
+// the collector is down — losing traces is fine, losing the pod is not.
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	// traceBatchSize triggers a background export once this many spans queue.
+	traceBatchSize = 64
+	// maxTraceBuffer bounds the queue when the collector is unreachable.
+	maxTraceBuffer = 2048
+	// traceExportTimeout bounds one export POST.
+	traceExportTimeout = 5 * time.Second
+)
+
+// spanContext identifies the active span, carried on the request context and
+// in traceparent headers.
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+}
+
+// traceCtxKey keys the active spanContext on a context.
+type traceCtxKey struct{}
+
+// activeSpanKey keys the live *traceSpan so handlers can annotate the
+// request's server span (events, error status) before the middleware
+// finishes it.
+type activeSpanKey struct{}
+
+// spanFromContext returns the request's server span, or nil when tracing is
+// off.
+func spanFromContext(ctx context.Context) *traceSpan {
+	s, _ := ctx.Value(activeSpanKey{}).(*traceSpan)
+	return s
+}
+
+// parseTraceparent decodes a W3C "00-<trace-id>-<parent-id>-<flags>" header.
+// All-zero IDs are invalid per the spec.
+func parseTraceparent(header string) (spanContext, bool) {
+	var sc spanContext
+	parts := strings.Split(header, "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.traceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.spanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	if sc.traceID == [16]byte{} || sc.spanID == [8]byte{} {
+		return sc, false
+	}
+	return sc, true
+}
+
+// spanAttr is one exported attribute; exactly one of str/num is used.
+type spanAttr struct {
+	key   string
+	str   string
+	num   int64
+	isNum bool
+}
+
+// spanEvent is one timestamped event on a span.
+type spanEvent struct {
+	name  string
+	at    time.Time
+	attrs []spanAttr
+}
+
+// traceSpan is one finished (or in-progress) span.
+type traceSpan struct {
+	traceID   [16]byte
+	spanID    [8]byte
+	parent    [8]byte
+	hasParent bool
+	name      string
+	kind      int // OTLP SpanKind: 2=server, 1=internal
+	start     time.Time
+	end       time.Time
+	attrs     []spanAttr
+	events    []spanEvent
+	errMsg    string
+	hasErr    bool
+}
+
+func (s *traceSpan) setAttr(key, value string) {
+	s.attrs = append(s.attrs, spanAttr{key: key, str: value})
+}
+
+func (s *traceSpan) setAttrInt(key string, value int64) {
+	s.attrs = append(s.attrs, spanAttr{key: key, num: value, isNum: true})
+}
+
+func (s *traceSpan) addEvent(name string, at time.Time, attrs ...spanAttr) {
+	s.events = append(s.events, spanEvent{name: name, at: at, attrs: attrs})
+}
+
+func (s *traceSpan) setError(msg string) {
+	s.hasErr = true
+	s.errMsg = msg
+}
+
+// tracer buffers finished spans and exports them as OTLP/HTTP JSON.
+type tracer struct {
+	endpoint string // full /v1/traces URL
+	service  string
+	client   *http.Client
+
+	mu      sync.Mutex
+	buf     []*traceSpan
+	dropped int64
+}
+
+// newTracer builds a tracer for the OTLP base endpoint (the spec's
+// OTEL_EXPORTER_OTLP_ENDPOINT, with /v1/traces appended unless already
+// present).
+func newTracer(endpoint, service string) *tracer {
+	endpoint = strings.TrimRight(endpoint, "/")
+	if !strings.HasSuffix(endpoint, "/v1/traces") {
+		endpoint += "/v1/traces"
+	}
+	return &tracer{
+		endpoint: endpoint,
+		service:  service,
+		client:   &http.Client{Timeout: traceExportTimeout},
+	}
+}
+
+// startSpan opens a span as a child of the context's active span (or a new
+// root) and returns a context carrying the new span as the active one.
+func (t *tracer) startSpan(ctx context.Context, name string, kind int) (*traceSpan, context.Context) {
+	s := &traceSpan{name: name, kind: kind, start: time.Now()}
+	if parent, ok := ctx.Value(traceCtxKey{}).(spanContext); ok {
+		s.traceID = parent.traceID
+		s.parent = parent.spanID
+		s.hasParent = true
+	} else if _, err := rand.Read(s.traceID[:]); err != nil {
+		return s, ctx // unreachable in practice; crypto/rand does not fail
+	}
+	if _, err := rand.Read(s.spanID[:]); err != nil {
+		return s, ctx
+	}
+	return s, context.WithValue(ctx, traceCtxKey{}, spanContext{traceID: s.traceID, spanID: s.spanID})
+}
+
+// endSpan finishes the span and queues it; a full buffer drops the span, a
+// full batch kicks off a background export.
+func (t *tracer) endSpan(s *traceSpan) {
+	s.end = time.Now()
+	t.mu.Lock()
+	if len(t.buf) >= maxTraceBuffer {
+		t.dropped++
+		if t.dropped == 1 || t.dropped%1000 == 0 {
+			log.Printf("WARNING: trace buffer full — %d spans dropped so far (is the OTLP collector reachable?)", t.dropped)
+		}
+		t.mu.Unlock()
+		return
+	}
+	t.buf = append(t.buf, s)
+	var batch []*traceSpan
+	if len(t.buf) >= traceBatchSize {
+		batch = t.buf
+		t.buf = nil
+	}
+	t.mu.Unlock()
+	if batch != nil {
+		go t.export(batch)
+	}
+}
+
+// flush exports everything still queued, synchronously. Used by FlushTraces
+// during shutdown and by tests.
+func (t *tracer) flush() {
+	t.mu.Lock()
+	batch := t.buf
+	t.buf = nil
+	t.mu.Unlock()
+	if len(batch) > 0 {
+		t.export(batch)
+	}
+}
+
+// --- OTLP/HTTP JSON shapes (trace service, stable JSON mapping) ------------
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"` // int64 is a JSON string in OTLP
+}
+
+type otlpKV struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"` // 2 = error
+	Message string `json:"message,omitempty"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string   `json:"timeUnixNano"`
+	Name         string   `json:"name"`
+	Attributes   []otlpKV `json:"attributes,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              int         `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []otlpKV    `json:"attributes,omitempty"`
+	Events            []otlpEvent `json:"events,omitempty"`
+	Status            *otlpStatus `json:"status,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpKV `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpExportRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func otlpAttrs(attrs []spanAttr) []otlpKV {
+	out := make([]otlpKV, 0, len(attrs))
+	for _, a := range attrs {
+		kv := otlpKV{Key: a.key}
+		if a.isNum {
+			v := strconv.FormatInt(a.num, 10)
+			kv.Value.IntValue = &v
+		} else {
+			v := a.str
+			kv.Value.StringValue = &v
+		}
+		out = append(out, kv)
+	}
+	return out
+}
+
+// export ships one batch. Failures are logged and the batch is dropped —
+// tracing is advisory and must never back-pressure the handlers.
+func (t *tracer) export(batch []*traceSpan) {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, s := range batch {
+		sp := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        otlpAttrs(s.attrs),
+		}
+		if s.hasParent {
+			sp.ParentSpanID = hex.EncodeToString(s.parent[:])
+		}
+		for _, e := range s.events {
+			sp.Events = append(sp.Events, otlpEvent{
+				TimeUnixNano: strconv.FormatInt(e.at.UnixNano(), 10),
+				Name:         e.name,
+				Attributes:   otlpAttrs(e.attrs),
+			})
+		}
+		if s.hasErr {
+			sp.Status = &otlpStatus{Code: 2, Message: s.errMsg}
+		}
+		spans = append(spans, sp)
+	}
+	var req otlpExportRequest
+	var rs otlpResourceSpans
+	service := t.service
+	rs.Resource.Attributes = []otlpKV{{Key: "service.name", Value: otlpValue{StringValue: &service}}}
+	var ss otlpScopeSpans
+	ss.Scope.Name = "healthkit"
+	ss.Spans = spans
+	rs.ScopeSpans = []otlpScopeSpans{ss}
+	req.ResourceSpans = []otlpResourceSpans{rs}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		log.Printf("trace export: marshal failed: %v", err)
+		return
+	}
+	resp, err := t.client.Post(t.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("trace export: %v (%d spans dropped)", err, len(batch))
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("trace export: collector answered %d (%d spans dropped)", resp.StatusCode, len(batch))
+	}
+}
+
+// traceMiddleware wraps every routed request in a server span. Only
+// installed when tracing is enabled (see baseRouter), so the disabled path
+// never even sees it.
+func (h *Service) traceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if parent, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+			ctx = context.WithValue(ctx, traceCtxKey{}, parent)
+		}
+		span, ctx := h.tracer.startSpan(ctx, r.Method, 2)
+		ctx = context.WithValue(ctx, activeSpanKey{}, span)
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		route := notFoundRoute
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				route = pattern
+			}
+		}
+		span.name = r.Method + " " + route
+		span.setAttr("http.method", r.Method)
+		span.setAttr("http.route", route)
+		span.setAttrInt("http.status_code", int64(ww.Status()))
+		if ww.Status() >= 500 {
+			span.setError(http.StatusText(ww.Status()))
+		}
+		h.tracer.endSpan(span)
+	})
+}
+
+// startSpan opens an internal child span when tracing is enabled; the
+// returned finish func is a no-op otherwise, so call sites stay branch-free.
+func (h *Service) startSpan(ctx context.Context, name string) (*traceSpan, context.Context, func()) {
+	if h.tracer == nil {
+		return nil, ctx, func() {}
+	}
+	span, ctx := h.tracer.startSpan(ctx, name, 1)
+	return span, ctx, func() { h.tracer.endSpan(span) }
+}
+
+// FlushTraces synchronously exports any spans still buffered. Call during
+// graceful shutdown, after the listeners drain; a no-op when tracing is
+// disabled.
+func (h *Service) FlushTraces() {
+	if h.tracer != nil {
+		h.tracer.flush()
+	}
+}
+
+// WithTraceEndpoint enables OTLP trace export to the given base endpoint;
+// empty leaves tracing disabled.
+func WithTraceEndpoint(endpoint string) Option {
+	return func(h *Service) {
+		h.traceEndpoint = strings.TrimSpace(endpoint)
+	}
+}
+
+// traceEndpointFromEnv reads OTEL_EXPORTER_OTLP_ENDPOINT (the standard OTel
+// variable; unset means tracing stays off).
+func traceEndpointFromEnv() string {
+	return strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"))
+}
@@ -0,0 +1,243 @@
+package healthkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// traceCollector is a fake OTLP/HTTP collector capturing export requests.
+type traceCollector struct {
+	mu   sync.Mutex
+	reqs []otlpExportRequest
+	srv  *httptest.Server
+}
+
+func newTraceCollector(t *testing.T) *traceCollector {
+	t.Helper()
+	c := &traceCollector{}
+	c.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("export path = %s, want /v1/traces", r.URL.Path)
+		}
+		var req otlpExportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode export: %v", err)
+		}
+		c.mu.Lock()
+		c.reqs = append(c.reqs, req)
+		c.mu.Unlock()
+	}))
+	t.Cleanup(c.srv.Close)
+	return c
+}
+
+// spans flattens every captured export into one span list.
+func (c *traceCollector) spans() []otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []otlpSpan
+	for _, req := range c.reqs {
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				out = append(out, ss.Spans...)
+			}
+		}
+	}
+	return out
+}
+
+func (c *traceCollector) findSpan(name string) *otlpSpan {
+	for _, s := range c.spans() {
+		if s.Name == name {
+			sp := s
+			return &sp
+		}
+	}
+	return nil
+}
+
+func attrString(s *otlpSpan, key string) string {
+	for _, kv := range s.Attributes {
+		if kv.Key == key {
+			if kv.Value.StringValue != nil {
+				return *kv.Value.StringValue
+			}
+			if kv.Value.IntValue != nil {
+				return *kv.Value.IntValue
+			}
+		}
+	}
+	return ""
+}
+
+func TestTracingDisabledByDefault(t *testing.T) {
+	hs := New(WithVersion("test"))
+	if hs.tracer != nil {
+		t.Fatal("tracer must stay nil without OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	// The request path works identically with tracing off.
+	r := buildRouter(hs, "tok")
+	rec := doReq(t, r, http.MethodPost, "/metrics/push", "tok",
+		`{"type":"counter","name":"requests","value":1,"labels":{"status":"success","endpoint":"ai"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("push with tracing off = %d, want 200", rec.Code)
+	}
+}
+
+func TestServerSpanWithParentPropagation(t *testing.T) {
+	c := newTraceCollector(t)
+	hs := New(WithVersion("test"), WithTraceEndpoint(c.srv.URL))
+	r := buildRouter(hs, "tok")
+
+	const (
+		traceID  = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentID = "00f067aa0ba902b7"
+	)
+	req := httptest.NewRequest(http.MethodPost, "/metrics/push",
+		strings.NewReader(`{"type":"counter","name":"requests","value":1,"labels":{"status":"success","endpoint":"ai"}}`))
+	req.Header.Set("Authorization", "Bearer tok")
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("push = %d, want 200", rec.Code)
+	}
+	hs.FlushTraces()
+
+	span := c.findSpan("POST /metrics/push")
+	if span == nil {
+		t.Fatalf("server span missing; have %+v", c.spans())
+	}
+	if span.TraceID != traceID {
+		t.Errorf("traceId = %s, want the propagated %s", span.TraceID, traceID)
+	}
+	if span.ParentSpanID != parentID {
+		t.Errorf("parentSpanId = %s, want the caller's %s", span.ParentSpanID, parentID)
+	}
+	if span.Kind != 2 {
+		t.Errorf("kind = %d, want 2 (server)", span.Kind)
+	}
+	if got := attrString(span, "http.status_code"); got != "200" {
+		t.Errorf("http.status_code = %s, want 200", got)
+	}
+	if got := attrString(span, "http.route"); got != "/metrics/push" {
+		t.Errorf("http.route = %s, want /metrics/push", got)
+	}
+	if span.Status != nil {
+		t.Errorf("status = %+v, want unset on success", span.Status)
+	}
+}
+
+func TestRejectedPushRecordsErrorOnSpan(t *testing.T) {
+	c := newTraceCollector(t)
+	hs := New(WithVersion("test"), WithTraceEndpoint(c.srv.URL))
+	r := buildRouter(hs, "tok")
+
+	rec := doReq(t, r, http.MethodPost, "/metrics/push", "tok",
+		`{"type":"counter","name":"nope_not_a_metric","value":1}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("push = %d, want 400", rec.Code)
+	}
+	hs.FlushTraces()
+
+	span := c.findSpan("POST /metrics/push")
+	if span == nil {
+		t.Fatal("server span missing")
+	}
+	if span.Status == nil || span.Status.Code != 2 {
+		t.Fatalf("status = %+v, want error (code 2)", span.Status)
+	}
+	if len(span.Events) != 1 || span.Events[0].Name != "payload_rejected" {
+		t.Fatalf("events = %+v, want one payload_rejected", span.Events)
+	}
+	found := false
+	for _, kv := range span.Events[0].Attributes {
+		if kv.Key == "reason" && kv.Value.StringValue != nil && *kv.Value.StringValue == reasonUnknownName {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("event attributes = %+v, want reason=%s", span.Events[0].Attributes, reasonUnknownName)
+	}
+}
+
+func TestBatchChildSpan(t *testing.T) {
+	c := newTraceCollector(t)
+	hs := New(WithVersion("test"), WithTraceEndpoint(c.srv.URL))
+	r := buildRouter(hs, "tok")
+
+	body := `[{"type":"counter","name":"requests","value":1,"labels":{"status":"success","endpoint":"ai"}},` +
+		`{"type":"counter","name":"requests","value":1,"labels":{"status":"success","endpoint":"ai"}},` +
+		`{"type":"counter","name":"bogus_name","value":1}]`
+	rec := doReq(t, r, http.MethodPost, "/metrics/batch", "tok", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("batch = %d, want 200", rec.Code)
+	}
+	hs.FlushTraces()
+
+	server := c.findSpan("POST /metrics/batch")
+	child := c.findSpan("metrics.batch.apply")
+	if server == nil || child == nil {
+		t.Fatalf("spans missing; have %+v", c.spans())
+	}
+	if child.ParentSpanID != server.SpanID || child.TraceID != server.TraceID {
+		t.Errorf("child parent = %s/%s, want the server span %s/%s",
+			child.TraceID, child.ParentSpanID, server.TraceID, server.SpanID)
+	}
+	if child.Kind != 1 {
+		t.Errorf("child kind = %d, want 1 (internal)", child.Kind)
+	}
+	for key, want := range map[string]string{
+		"batch.item_count": "3", "batch.processed": "2", "batch.rejected": "1",
+	} {
+		if got := attrString(child, key); got != want {
+			t.Errorf("%s = %s, want %s", key, got, want)
+		}
+	}
+	if len(child.Events) != 1 || child.Events[0].Name != "payload_rejected" {
+		t.Errorf("child events = %+v, want one payload_rejected", child.Events)
+	}
+	if child.Status == nil || child.Status.Code != 2 {
+		t.Errorf("child status = %+v, want error for the rejected item", child.Status)
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name, header string
+		ok           bool
+	}{
+		{"valid", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"unsampled flag still parses", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true},
+		{"empty", "", false},
+		{"wrong version", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"short trace id", "00-4bf92f-00f067aa0ba902b7-01", false},
+		{"all-zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"all-zero span id", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"non-hex", "00-zzzzzzzzzzzzzzzzzzzzzzzzzzzzzzzz-00f067aa0ba902b7-01", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := parseTraceparent(tt.header); ok != tt.ok {
+				t.Errorf("parseTraceparent(%q) ok = %v, want %v", tt.header, ok, tt.ok)
+			}
+		})
+	}
+}
+
+func TestTracerEndpointNormalization(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"http://otel:4318", "http://otel:4318/v1/traces"},
+		{"http://otel:4318/", "http://otel:4318/v1/traces"},
+		{"http://otel:4318/v1/traces", "http://otel:4318/v1/traces"},
+	}
+	for _, tt := range tests {
+		if got := newTracer(tt.in, "health_api").endpoint; got != tt.want {
+			t.Errorf("newTracer(%q).endpoint = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
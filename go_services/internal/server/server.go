@@ -0,0 +1,202 @@
+// Package server is the shared HTTP bootstrap for the Go services. Both
+// binaries used to carry their own copy of the same ~100 lines — http.Server
+// construction, signal handling, the drain-then-shutdown sequence, the
+// forced-close exit — and the copies had started to drift in the details
+// (timeout values, log wording, what happened on an unclean drain). Run owns
+// that lifecycle once: it standardizes the server timeouts, waits for
+// SIGINT/SIGTERM, runs the BeginShutdown → drain delay → bounded Shutdown
+// sequence from healthkit/shutdown.go across every listener, and reports an
+// unclean drain as ErrForcedClose so main can exit non-zero.
+//
+// Everything that legitimately differs per service — bind address, port
+// resolution, per-route timeout budgets, what "begin shutdown" means — stays
+// in the caller via Config. The signal source is injectable so the lifecycle
+// tests drive shutdown without real signals.
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/voraehita25-star/discord-bot/go_services/healthkit"
+)
+
+// Default server timeouts, shared by both services. url_fetcher overrides
+// WriteTimeout upward because its batch handler's budget exceeds it.
+const (
+	defaultReadTimeout       = 15 * time.Second
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultWriteTimeout      = 30 * time.Second
+	defaultIdleTimeout       = 60 * time.Second
+)
+
+// ErrForcedClose reports that the shutdown deadline expired with connections
+// still in flight. Callers exit non-zero on it: a cut-short drain is a
+// deploy-visible failure, not a log line.
+var ErrForcedClose = errors.New("shutdown timed out; remaining connections force-closed")
+
+// Config carries the per-service knobs for Run.
+type Config struct {
+	// Name labels this listener in logs and the drain report.
+	Name string
+	// Addr is the resolved listen address (host:port). Address resolution —
+	// env parsing, loopback gating, legacy-port fallbacks — stays with the
+	// caller; Run just binds what it is given.
+	Addr string
+
+	// Handler, when set, serves requests directly and the routes argument to
+	// Run is ignored; health_api passes its prebuilt router here. When nil,
+	// Run builds a fresh chi router and hands it to routes.
+	Handler http.Handler
+
+	// Server timeouts; zero values take the shared defaults above.
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// TLSConfig, when set, serves the primary listener over TLS. Extra
+	// listeners carry their own (see Extra).
+	TLSConfig *tls.Config
+
+	// Extra listeners (the health API's split admin server) that start with
+	// the primary and join the same drain. Keys label them in logs.
+	Extra map[string]*http.Server
+
+	// DrainDelay and ShutdownTimeout feed healthkit.DrainAndShutdown; a zero
+	// ShutdownTimeout takes the healthkit default.
+	DrainDelay      time.Duration
+	ShutdownTimeout time.Duration
+
+	// OnShutdownBegin runs as soon as the shutdown signal arrives, before the
+	// drain delay — flip readiness probes and cancel collectors here.
+	// OnDrained runs after every listener has shut down (cleanly or not) —
+	// flush buffers and persist state here.
+	OnShutdownBegin func()
+	OnDrained       func()
+
+	// Signals, when set, replaces the real SIGINT/SIGTERM subscription — the
+	// lifecycle tests send on it instead of raising signals. Leave nil in
+	// production.
+	Signals <-chan os.Signal
+
+	// OnReady, when set, fires once the listener is bound, with the actual
+	// address — tests bind :0 and learn the port here.
+	OnReady func(addr net.Addr)
+}
+
+// Run serves cfg until a shutdown signal arrives, then drains and returns.
+// It returns nil after a clean shutdown, ErrForcedClose after a cut-short
+// drain, and the underlying error when binding or serving fails — the caller
+// decides how loudly to die.
+func Run(cfg Config, routes func(chi.Router)) error {
+	handler := cfg.Handler
+	if handler == nil {
+		r := chi.NewRouter()
+		if routes != nil {
+			routes(r)
+		}
+		handler = r
+	}
+
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		ReadTimeout:       orDefault(cfg.ReadTimeout, defaultReadTimeout),
+		ReadHeaderTimeout: orDefault(cfg.ReadHeaderTimeout, defaultReadHeaderTimeout),
+		WriteTimeout:      orDefault(cfg.WriteTimeout, defaultWriteTimeout),
+		IdleTimeout:       orDefault(cfg.IdleTimeout, defaultIdleTimeout),
+		TLSConfig:         cfg.TLSConfig,
+	}
+
+	ln, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("%s listener: %w", cfg.Name, err)
+	}
+	if cfg.OnReady != nil {
+		cfg.OnReady(ln.Addr())
+	}
+
+	signals := cfg.Signals
+	if signals == nil {
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		signals = sigCh
+	}
+
+	// Every listener joins one drain so a slow extra listener can't eat the
+	// primary's shutdown budget (or vice versa).
+	servers := map[string]*http.Server{cfg.Name: srv}
+	errCh := make(chan error, 1+len(cfg.Extra))
+	for name, extra := range cfg.Extra {
+		servers[name] = extra
+		go func(name string, s *http.Server) {
+			if err := listenAndServe(s); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errCh <- fmt.Errorf("%s listener: %w", name, err)
+			}
+		}(name, extra)
+	}
+
+	done := make(chan bool, 1)
+	go func() {
+		<-signals
+		log.Println("Shutting down...")
+		if cfg.OnShutdownBegin != nil {
+			cfg.OnShutdownBegin()
+		}
+		clean := healthkit.DrainAndShutdown(
+			cfg.DrainDelay, orDefault(cfg.ShutdownTimeout, 10*time.Second), servers)
+		if cfg.OnDrained != nil {
+			cfg.OnDrained()
+		}
+		done <- clean
+	}()
+
+	go func() {
+		var serveErr error
+		if srv.TLSConfig != nil {
+			serveErr = srv.ServeTLS(ln, "", "")
+		} else {
+			serveErr = srv.Serve(ln)
+		}
+		if serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) {
+			errCh <- fmt.Errorf("%s listener: %w", cfg.Name, serveErr)
+		}
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case clean := <-done:
+		if !clean {
+			return ErrForcedClose
+		}
+		return nil
+	}
+}
+
+// listenAndServe starts one extra listener, choosing TLS when its server
+// carries a tls.Config — the health API's split listeners share one.
+func listenAndServe(s *http.Server) error {
+	if s.TLSConfig != nil {
+		return s.ListenAndServeTLS("", "")
+	}
+	return s.ListenAndServe()
+}
+
+func orDefault(d, fallback time.Duration) time.Duration {
+	if d <= 0 {
+		return fallback
+	}
+	return d
+}
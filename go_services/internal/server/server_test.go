@@ -0,0 +1,203 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// startRun launches Run on 127.0.0.1:0 and returns the bound base URL, the
+// injected signal channel and the channel Run's result lands on.
+func startRun(t *testing.T, cfg Config, routes func(chi.Router)) (string, chan os.Signal, chan error) {
+	t.Helper()
+	sigCh := make(chan os.Signal, 1)
+	readyCh := make(chan net.Addr, 1)
+	cfg.Addr = "127.0.0.1:0"
+	cfg.Signals = sigCh
+	cfg.OnReady = func(addr net.Addr) { readyCh <- addr }
+	if cfg.Name == "" {
+		cfg.Name = "test"
+	}
+	result := make(chan error, 1)
+	go func() { result <- Run(cfg, routes) }()
+	select {
+	case addr := <-readyCh:
+		return "http://" + addr.String(), sigCh, result
+	case err := <-result:
+		t.Fatalf("Run exited before binding: %v", err)
+		return "", nil, nil
+	}
+}
+
+func awaitResult(t *testing.T, result chan error) error {
+	t.Helper()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after shutdown signal")
+		return nil
+	}
+}
+
+func TestRunServesAndShutsDownCleanly(t *testing.T) {
+	var began, drained atomic.Int32
+	cfg := Config{
+		ShutdownTimeout: time.Second,
+		OnShutdownBegin: func() { began.Add(1) },
+		OnDrained: func() {
+			if began.Load() == 0 {
+				t.Error("OnDrained ran before OnShutdownBegin")
+			}
+			drained.Add(1)
+		},
+	}
+	base, sigCh, result := startRun(t, cfg, func(r chi.Router) {
+		r.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "pong")
+		})
+	})
+
+	resp, err := http.Get(base + "/ping")
+	if err != nil {
+		t.Fatalf("GET /ping: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "pong" {
+		t.Fatalf("GET /ping = %d %q, want 200 pong", resp.StatusCode, body)
+	}
+
+	sigCh <- syscall.SIGTERM
+	if err := awaitResult(t, result); err != nil {
+		t.Errorf("Run = %v, want clean nil", err)
+	}
+	if began.Load() != 1 || drained.Load() != 1 {
+		t.Errorf("hooks ran %d/%d times, want 1/1", began.Load(), drained.Load())
+	}
+
+	// The listener is actually gone after Run returns.
+	if _, err := http.Get(base + "/ping"); err == nil {
+		t.Error("listener still serving after shutdown")
+	}
+}
+
+func TestRunBindFailure(t *testing.T) {
+	// Occupy a port, then ask Run to bind it.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	err = Run(Config{Name: "test", Addr: ln.Addr().String()}, nil)
+	if err == nil {
+		t.Fatal("Run bound an occupied port")
+	}
+}
+
+func TestRunShutdownTimeoutEscalation(t *testing.T) {
+	inHandler := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	cfg := Config{ShutdownTimeout: 50 * time.Millisecond}
+	base, sigCh, result := startRun(t, cfg, func(r chi.Router) {
+		r.Get("/stuck", func(w http.ResponseWriter, r *http.Request) {
+			close(inHandler)
+			<-release
+		})
+	})
+
+	go func() {
+		resp, err := http.Get(base + "/stuck")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-inHandler
+
+	sigCh <- syscall.SIGTERM
+	if err := awaitResult(t, result); !errors.Is(err, ErrForcedClose) {
+		t.Errorf("Run = %v, want ErrForcedClose", err)
+	}
+}
+
+func TestRunExtraListenerJoinsDrain(t *testing.T) {
+	// The extra listener binds its own port up front so the test can reach it.
+	extraLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	extraAddr := extraLn.Addr().String()
+	extraLn.Close()
+
+	extra := &http.Server{
+		Addr: extraAddr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "admin")
+		}),
+	}
+	cfg := Config{
+		ShutdownTimeout: time.Second,
+		Extra:           map[string]*http.Server{"admin": extra},
+	}
+	_, sigCh, result := startRun(t, cfg, func(r chi.Router) {})
+
+	// Wait for the extra listener to come up, then confirm it serves.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err := http.Get("http://" + extraAddr + "/")
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("extra listener never came up: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	sigCh <- syscall.SIGTERM
+	if err := awaitResult(t, result); err != nil {
+		t.Errorf("Run = %v, want clean nil", err)
+	}
+	if _, err := http.Get("http://" + extraAddr + "/"); err == nil {
+		t.Error("extra listener still serving after shutdown")
+	}
+}
+
+// TestRunPrebuiltHandler covers the health_api shape: a prebuilt handler
+// passed via Config, routes argument nil.
+func TestRunPrebuiltHandler(t *testing.T) {
+	cfg := Config{
+		ShutdownTimeout: time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}),
+	}
+	base, sigCh, result := startRun(t, cfg, nil)
+
+	resp, err := http.Get(base + "/anything")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTeapot {
+		t.Errorf("status = %d, want 418 from the prebuilt handler", resp.StatusCode)
+	}
+
+	sigCh <- syscall.SIGTERM
+	if err := awaitResult(t, result); err != nil {
+		t.Errorf("Run = %v, want clean nil", err)
+	}
+}
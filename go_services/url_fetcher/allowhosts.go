@@ -0,0 +1,132 @@
+package urlfetcher
+
+// Per-host SSRF allowlist. Some deployments legitimately need ONE internal
+// target — e.g. a corp wiki on http://wiki.corp.internal:8080 — without
+// opening private address space in general. FETCH_ALLOW_HOSTS (comma-
+// separated hostnames or CIDRs) grants exactly that: an allowlisted hostname
+// may resolve to a private IP, and an IP inside an allowlisted CIDR may be
+// fetched, while every other private target stays blocked.
+//
+// Scope is deliberately narrow:
+//   - The hard denylist (denyhosts.go) is consulted FIRST at every
+//     enforcement point, so the allowlist can never re-enable metadata
+//     endpoints or localhost aliases.
+//   - The check runs AFTER DNS resolution, at the same points that vet
+//     resolved IPs (isPrivateURL, the dial guard, checkRedirect) — the
+//     allowlist relaxes the private-IP verdict, never the resolution itself,
+//     so DNS failure still fails closed even for allowlisted hosts.
+//   - checkRedirect judges every hop's target on its own: a redirect FROM an
+//     allowlisted host to a non-allowlisted private IP is still blocked,
+//     because no "allowed" state is carried between hops.
+//
+// Every grant is audit-visible: an "SSRF audit" log line and the
+// url_fetcher_allowlisted_total{match} counter (bounded cardinality — only
+// configured entries can appear as labels).
+
+import (
+	"log"
+	"net"
+	"os"
+	"strings"
+)
+
+// hostAllowList holds the parsed FETCH_ALLOW_HOSTS entries: exact hostnames
+// (normalized like the denylist) and CIDR ranges.
+type hostAllowList struct {
+	hosts map[string]bool
+	nets  []*net.IPNet
+}
+
+// allowHosts is the active allowlist; empty by default (nothing bypasses the
+// private-IP block). Run() replaces it with the env-parsed one. Package-level
+// like denyHosts: the hot paths read it without threading config through.
+var allowHosts = &hostAllowList{}
+
+// allowHostsFromEnv parses FETCH_ALLOW_HOSTS. Entries containing "/" are
+// CIDRs; anything else is a hostname, normalized the same way denylist
+// entries are (see normalizeDenyHost) so "Wiki.Corp.Internal." in the env
+// matches at request time. An unparseable CIDR warns and is skipped — skipping
+// means NOT allowed, so a typo fails closed rather than opening a range.
+func allowHostsFromEnv() *hostAllowList {
+	list := &hostAllowList{hosts: map[string]bool{}}
+	raw := strings.TrimSpace(os.Getenv("FETCH_ALLOW_HOSTS"))
+	if raw == "" {
+		return list
+	}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				log.Printf("⚠️ Invalid FETCH_ALLOW_HOSTS CIDR %q, skipping (stays blocked): %v", entry, err)
+				continue
+			}
+			list.nets = append(list.nets, network)
+			continue
+		}
+		if normalized := normalizeDenyHost(entry); normalized != "" {
+			list.hosts[normalized] = true
+		}
+	}
+	if len(list.hosts) > 0 || len(list.nets) > 0 {
+		log.Printf("SSRF allowlist active: %d host(s), %d CIDR(s) from FETCH_ALLOW_HOSTS",
+			len(list.hosts), len(list.nets))
+	}
+	return list
+}
+
+// matchHost reports whether host (in any spelling) is an allowlisted
+// hostname, returning the matched entry for the audit trail.
+func (a *hostAllowList) matchHost(host string) (string, bool) {
+	normalized := normalizeDenyHost(host)
+	if normalized != "" && a.hosts[normalized] {
+		return normalized, true
+	}
+	return "", false
+}
+
+// matchIP reports whether ip falls inside an allowlisted CIDR, returning the
+// matched range for the audit trail.
+func (a *hostAllowList) matchIP(ip net.IP) (string, bool) {
+	for _, network := range a.nets {
+		if network.Contains(ip) {
+			return network.String(), true
+		}
+	}
+	return "", false
+}
+
+// allowPrivate decides whether a host whose resolution failed the private-IP
+// vet may proceed anyway: yes if the hostname itself is allowlisted, or if
+// EVERY private address in the answer set sits inside an allowlisted CIDR.
+// One private IP outside the allowed ranges keeps the block — a partial
+// match must not drag unvetted addresses along.
+func (a *hostAllowList) allowPrivate(host string, ips []net.IPAddr) (string, bool) {
+	if match, ok := a.matchHost(host); ok {
+		return match, true
+	}
+	match := ""
+	for _, addr := range ips {
+		if !isPrivateIP(addr.IP) {
+			continue
+		}
+		m, ok := a.matchIP(addr.IP)
+		if !ok {
+			return "", false
+		}
+		match = m
+	}
+	return match, match != ""
+}
+
+// allowAudit records one allowlist grant: a log line in the SSRF-audit
+// register plus the labeled counter, so audits can enumerate every private
+// fetch the allowlist permitted. where marks the enforcement point that
+// would otherwise have blocked ("URL", "dial" or "redirect").
+func allowAudit(where, host, match string) {
+	allowlistedTotal.WithLabelValues(match).Inc()
+	log.Printf("⚠️ SSRF audit: %s host %q permitted by allowlist (matches %q)", where, host, match)
+}
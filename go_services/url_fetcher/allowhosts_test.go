@@ -0,0 +1,140 @@
+package urlfetcher
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// withAllowList swaps the active allowlist for one parsed from csv, restored
+// on cleanup — same shape as withRedirectDNS for the DNS seam.
+func withAllowList(t *testing.T, csv string) {
+	t.Helper()
+	t.Setenv("FETCH_ALLOW_HOSTS", csv)
+	prev := allowHosts
+	allowHosts = allowHostsFromEnv()
+	t.Cleanup(func() { allowHosts = prev })
+}
+
+func TestAllowHostsFromEnv(t *testing.T) {
+	withAllowList(t, " Wiki.Corp.Internal. ,10.1.0.0/16, not/a/cidr ,, ")
+	if _, ok := allowHosts.matchHost("wiki.corp.internal"); !ok {
+		t.Error("hostname entry should match (normalized on load)")
+	}
+	if _, ok := allowHosts.matchIP(net.ParseIP("10.1.2.3")); !ok {
+		t.Error("10.1.2.3 should match the 10.1.0.0/16 entry")
+	}
+	if len(allowHosts.nets) != 1 {
+		t.Errorf("invalid CIDR must be skipped (stays blocked), got %d nets", len(allowHosts.nets))
+	}
+
+	withAllowList(t, "")
+	if len(allowHosts.hosts) != 0 || len(allowHosts.nets) != 0 {
+		t.Error("empty env must yield an empty allowlist")
+	}
+}
+
+func TestAllowListMatching(t *testing.T) {
+	withAllowList(t, "wiki.corp.internal,10.1.0.0/16")
+	private := func(s string) net.IPAddr { return net.IPAddr{IP: net.ParseIP(s)} }
+	tests := []struct {
+		name      string
+		host      string
+		ips       []net.IPAddr
+		wantMatch string
+		wantOK    bool
+	}{
+		{"hostname match any spelling", "Wiki.Corp.Internal.", []net.IPAddr{private("10.99.0.1")}, "wiki.corp.internal", true},
+		{"cidr covers whole answer set", "db.internal", []net.IPAddr{private("10.1.2.3"), private("10.1.9.9")}, "10.1.0.0/16", true},
+		{"partial cidr coverage denied", "db.internal", []net.IPAddr{private("10.1.2.3"), private("192.168.1.1")}, "", false},
+		{"unlisted host denied", "other.internal", []net.IPAddr{private("10.99.0.1")}, "", false},
+		{"all-public set grants nothing", "public.example", []net.IPAddr{private("203.0.113.7")}, "", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			match, ok := allowHosts.allowPrivate(tc.host, tc.ips)
+			if ok != tc.wantOK || match != tc.wantMatch {
+				t.Errorf("allowPrivate(%q) = (%q, %v), want (%q, %v)", tc.host, match, ok, tc.wantMatch, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestIsPrivateURL_Allowlist(t *testing.T) {
+	withAllowList(t, "10.1.0.0/16,169.254.0.0/16,127.0.0.0/8")
+	before := counterValue(t, "url_fetcher_allowlisted_total", map[string]string{"match": "10.1.0.0/16"})
+
+	// CIDR match on an IP-literal URL: allowed and counted.
+	isPrivate, err := isPrivateURL(context.Background(), &net.Resolver{}, "http://10.1.2.3:8080/wiki")
+	if isPrivate || err != nil {
+		t.Errorf("allowlisted CIDR literal should pass, got blocked=%v err=%v", isPrivate, err)
+	}
+	if got := counterValue(t, "url_fetcher_allowlisted_total", map[string]string{"match": "10.1.0.0/16"}); got != before+1 {
+		t.Errorf("allowlisted_total{10.1.0.0/16} = %v, want %v", got, before+1)
+	}
+
+	// Outside the allowed ranges: still blocked.
+	if isPrivate, _ := isPrivateURL(context.Background(), &net.Resolver{}, "http://192.168.1.1/"); !isPrivate {
+		t.Error("private IP outside the allowlist must stay blocked")
+	}
+
+	// The hard denylist wins even when a covering CIDR is allowlisted:
+	// metadata and localhost cannot be re-enabled via FETCH_ALLOW_HOSTS.
+	for _, raw := range []string{"http://169.254.169.254/latest/meta-data/", "http://127.0.0.1/"} {
+		isPrivate, err := isPrivateURL(context.Background(), &net.Resolver{}, raw)
+		if !isPrivate || err == nil || !strings.Contains(err.Error(), "deny list") {
+			t.Errorf("isPrivateURL(%q) = (%v, %v), want the denylist block", raw, isPrivate, err)
+		}
+	}
+}
+
+// TestSSRFSafeDialContext_Allowlist: both vetting sites must agree — an
+// allowlisted hostname that resolves private passes the dial guard too, and
+// the guard still dials the vetted IP literal, not the hostname.
+func TestSSRFSafeDialContext_Allowlist(t *testing.T) {
+	withAllowList(t, "wiki.corp.internal")
+	resolver := fakeIPResolver{"wiki.corp.internal": {{IP: net.ParseIP("10.0.0.8")}}}
+
+	rec := &recordingDial{}
+	conn, err := ssrfSafeDialContextWith(resolver, rec.dial)(context.Background(), "tcp", "wiki.corp.internal:8080")
+	if err != nil {
+		t.Fatalf("allowlisted host should dial, got: %v", err)
+	}
+	_ = conn.Close()
+	if got := rec.dialed(); len(got) != 1 || got[0] != "10.0.0.8:8080" {
+		t.Errorf("dialed %v, want the pinned [10.0.0.8:8080]", got)
+	}
+
+	// Same resolution without the allowlist entry: blocked as before.
+	withAllowList(t, "")
+	if _, err := ssrfSafeDialContextWith(resolver, (&recordingDial{}).dial)(context.Background(), "tcp", "wiki.corp.internal:8080"); err == nil || !strings.Contains(err.Error(), "SSRF blocked") {
+		t.Errorf("non-allowlisted private resolution must stay blocked, got: %v", err)
+	}
+}
+
+// TestCheckRedirect_AllowlistPerHop: redirect hops judge their own target.
+// A hop TO an allowlisted private host passes; a redirect FROM an allowlisted
+// host to a non-allowlisted private IP is still blocked — the allowlist must
+// not disable the redirect check.
+func TestCheckRedirect_AllowlistPerHop(t *testing.T) {
+	withAllowList(t, "wiki.corp.internal")
+	withRedirectDNS(t, map[string][]net.IPAddr{
+		"wiki.corp.internal": {{IP: net.ParseIP("10.0.0.8")}},
+		"internal.test":      {{IP: net.ParseIP("10.0.0.5")}},
+	})
+	check := NewFetcher().client.CheckRedirect
+	via := []*http.Request{newRedirectReq(t, "http://wiki.corp.internal:8080/start")}
+
+	if err := check(newRedirectReq(t, "http://wiki.corp.internal:8080/page"), via); err != nil {
+		t.Errorf("redirect to the allowlisted host should pass, got: %v", err)
+	}
+	// Escape attempt: allowlisted origin, private non-allowlisted target.
+	for _, raw := range []string{"http://internal.test/admin", "http://10.0.0.5/admin"} {
+		err := check(newRedirectReq(t, raw), via)
+		if err == nil || !strings.Contains(err.Error(), "redirect to private address blocked") {
+			t.Errorf("redirect %q from an allowlisted host must stay blocked, got: %v", raw, err)
+		}
+	}
+}
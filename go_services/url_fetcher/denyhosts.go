@@ -0,0 +1,176 @@
+package urlfetcher
+
+// Hard host denylist. isPrivateIP covers the private/link-local/ULA ranges,
+// but the well-known metadata targets deserve blocks that hold regardless of
+// how they are reached or spelled: trailing-dot forms ("localhost."),
+// bracketed IPv6 ("[::1]"), IPv4-mapped IPv6 (::ffff:169.254.169.254), and
+// the integer/octal/hex IPv4 encodings some stacks accept (http://2130706433/
+// is 127.0.0.1). Every candidate host is normalized — lowercased, trailing
+// dot stripped, obfuscated IPv4 forms decoded, IPv6 unmapped — BEFORE the
+// comparison, so the denylist matches what the host means, not how it is
+// written. Operators extend the list with FETCH_DENY_HOSTS (comma-separated,
+// normalized the same way on load).
+//
+// A denylist hit produces a distinct error naming the matched entry and
+// increments url_fetcher_denied_host_total with that entry as the label —
+// bounded cardinality, since only listed entries can ever appear.
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// baseDenyHosts are the always-on entries: cloud metadata endpoints (AWS,
+// GCP, Azure, Alibaba), the IMDSv2 IPv6 address, and the localhost/0.0.0.0
+// aliases. Stored in normalized form.
+func baseDenyHosts() map[string]bool {
+	return map[string]bool{
+		"169.254.169.254":          true, // AWS/GCP instance metadata
+		"metadata.google.internal": true,
+		"metadata.internal":        true,
+		"metadata.azure.com":       true,
+		"instance-data":            true, // AWS alternative
+		"100.100.100.200":          true, // Alibaba Cloud metadata
+		"fd00:ec2::254":            true, // AWS IMDSv2 IPv6
+		"localhost":                true,
+		"0.0.0.0":                  true,
+		"::1":                      true,
+		"127.0.0.1":                true,
+	}
+}
+
+// denyHosts is the active set; Run() replaces it with the env-extended one.
+// Package-level like siteRules: the hot paths (isPrivateURL, checkRedirect)
+// read it without threading config through.
+var denyHosts = baseDenyHosts()
+
+// denyHostsFromEnv returns the base set plus FETCH_DENY_HOSTS entries.
+// Entries are normalized on load so "Evil.Example." in the env matches
+// "evil.example" at request time; empties are skipped silently, which makes
+// trailing commas harmless.
+func denyHostsFromEnv() map[string]bool {
+	hosts := baseDenyHosts()
+	raw := strings.TrimSpace(os.Getenv("FETCH_DENY_HOSTS"))
+	if raw == "" {
+		return hosts
+	}
+	added := 0
+	for _, entry := range strings.Split(raw, ",") {
+		if normalized := normalizeDenyHost(entry); normalized != "" {
+			hosts[normalized] = true
+			added++
+		}
+	}
+	if added > 0 {
+		log.Printf("Host denylist extended with %d FETCH_DENY_HOSTS entries", added)
+	}
+	return hosts
+}
+
+// normalizeDenyHost canonicalizes one host for denylist comparison:
+// lowercase, surrounding whitespace and brackets gone, trailing dot
+// stripped, obfuscated IPv4 encodings decoded to dotted-quad, and IP
+// literals rendered in netip's canonical form (which unmaps ::ffff: IPv4-
+// mapped addresses). Returns "" for an empty host.
+func normalizeDenyHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	host = strings.TrimPrefix(host, "[")
+	host = strings.TrimSuffix(host, "]")
+	host = strings.TrimSuffix(host, ".")
+	if host == "" {
+		return ""
+	}
+	if ip, ok := parseObfuscatedIPv4(host); ok {
+		return ip.String()
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.Unmap().String()
+	}
+	return host
+}
+
+// parseObfuscatedIPv4 decodes the non-dotted-decimal IPv4 spellings the
+// classic SSRF bypass lists use: a single 32-bit integer in decimal, octal
+// (leading 0) or hex (0x), and dotted forms whose octets use those bases
+// (0177.0.0.1, 0x7f.0.0.1). Plain dotted-decimal is left to netip — this
+// only handles what netip (correctly) refuses.
+func parseObfuscatedIPv4(host string) (netip.Addr, bool) {
+	parts := strings.Split(host, ".")
+	switch len(parts) {
+	case 1:
+		n, ok := parseIPv4Component(parts[0], 1<<32-1)
+		if !ok {
+			return netip.Addr{}, false
+		}
+		return netip.AddrFrom4([4]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}), true
+	case 4:
+		// Only the obfuscated bases: all-plain-decimal dotted quads parse
+		// via netip and must not take this path (strconv would accept
+		// leading zeros differently than netip does).
+		obfuscated := false
+		var quad [4]byte
+		for i, part := range parts {
+			if strings.HasPrefix(part, "0x") || (len(part) > 1 && strings.HasPrefix(part, "0")) {
+				obfuscated = true
+			}
+			n, ok := parseIPv4Component(part, 255)
+			if !ok {
+				return netip.Addr{}, false
+			}
+			quad[i] = byte(n)
+		}
+		if !obfuscated {
+			return netip.Addr{}, false
+		}
+		return netip.AddrFrom4(quad), true
+	default:
+		return netip.Addr{}, false
+	}
+}
+
+// parseIPv4Component parses one integer component with C-style base
+// detection (0x hex, leading-0 octal, else decimal), bounded by max.
+func parseIPv4Component(s string, max uint64) (uint64, bool) {
+	if s == "" {
+		return 0, false
+	}
+	base := 10
+	switch {
+	case strings.HasPrefix(s, "0x"):
+		base, s = 16, s[2:]
+		if s == "" {
+			return 0, false
+		}
+	case len(s) > 1 && s[0] == '0':
+		base, s = 8, s[1:]
+	}
+	n, err := strconv.ParseUint(s, base, 64)
+	if err != nil || n > max {
+		return 0, false
+	}
+	return n, true
+}
+
+// deniedHost reports whether host (in any spelling) is on the denylist,
+// returning the matched canonical entry for the error message and the
+// metric label.
+func deniedHost(host string) (string, bool) {
+	normalized := normalizeDenyHost(host)
+	if normalized != "" && denyHosts[normalized] {
+		return normalized, true
+	}
+	return "", false
+}
+
+// denyHostError is the distinct, greppable block error; where marks the
+// enforcement point ("URL" or "redirect") so logs show which layer fired.
+// Callers own the "SSRF blocked:" prefix — isPrivateURL's caller adds it to
+// every returned error, so baking it in here would double it.
+func denyHostError(where, host, match string) error {
+	deniedHostTotal.WithLabelValues(match).Inc()
+	return fmt.Errorf("%s host %q is on the deny list (matches %q)", where, host, match)
+}
@@ -0,0 +1,135 @@
+package urlfetcher
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeDenyHost(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"lowercase", "Metadata.Google.INTERNAL", "metadata.google.internal"},
+		{"trailing dot stripped", "localhost.", "localhost"},
+		{"whitespace trimmed", "  localhost  ", "localhost"},
+		{"ipv6 brackets stripped", "[::1]", "::1"},
+		{"decimal ip decoded", "2130706433", "127.0.0.1"},
+		{"decimal metadata ip decoded", "2852039166", "169.254.169.254"},
+		{"octal integer decoded", "017700000001", "127.0.0.1"},
+		{"hex integer decoded", "0x7f000001", "127.0.0.1"},
+		{"dotted octal decoded", "0177.0.0.1", "127.0.0.1"},
+		{"dotted hex decoded", "0x7f.0.0.1", "127.0.0.1"},
+		{"ipv4-mapped ipv6 unmapped", "::ffff:169.254.169.254", "169.254.169.254"},
+		{"plain dotted quad unchanged", "203.0.113.7", "203.0.113.7"},
+		{"plain hostname unchanged", "example.com", "example.com"},
+		{"not an ip stays a hostname", "12345abc", "12345abc"},
+		{"empty", "", ""},
+		{"lone dot", ".", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := normalizeDenyHost(tc.in); got != tc.want {
+				t.Errorf("normalizeDenyHost(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDeniedHostObfuscatedEncodings(t *testing.T) {
+	// Every spelling of a denylisted target must match, whatever the
+	// encoding. The canonical entry comes back for the error/metric label.
+	tests := []struct {
+		host, wantMatch string
+	}{
+		{"169.254.169.254", "169.254.169.254"},
+		{"169.254.169.254.", "169.254.169.254"},
+		{"2852039166", "169.254.169.254"},             // decimal
+		{"0xa9fea9fe", "169.254.169.254"},             // hex
+		{"0251.0376.0251.0376", "169.254.169.254"},    // dotted octal
+		{"::ffff:169.254.169.254", "169.254.169.254"}, // IPv4-mapped IPv6
+		{"[::ffff:169.254.169.254]", "169.254.169.254"},
+		{"METADATA.GOOGLE.INTERNAL", "metadata.google.internal"},
+		{"metadata.google.internal.", "metadata.google.internal"},
+		{"metadata.azure.com", "metadata.azure.com"},
+		{"fd00:ec2::254", "fd00:ec2::254"},
+		{"[FD00:EC2::254]", "fd00:ec2::254"},
+		{"localhost", "localhost"},
+		{"Localhost.", "localhost"},
+		{"0.0.0.0", "0.0.0.0"},
+		{"::1", "::1"},
+		{"[::1]", "::1"},
+		{"127.0.0.1", "127.0.0.1"},
+		{"2130706433", "127.0.0.1"},
+		{"0x7f.0.0.1", "127.0.0.1"},
+		{"100.100.100.200", "100.100.100.200"},
+		{"instance-data", "instance-data"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.host, func(t *testing.T) {
+			match, denied := deniedHost(tc.host)
+			if !denied {
+				t.Fatalf("deniedHost(%q) = allowed, want a denylist match", tc.host)
+			}
+			if match != tc.wantMatch {
+				t.Errorf("deniedHost(%q) matched %q, want %q", tc.host, match, tc.wantMatch)
+			}
+		})
+	}
+
+	for _, host := range []string{"example.com", "203.0.113.7", "3405803777" /* 203.0.113.1 */} {
+		if match, denied := deniedHost(host); denied {
+			t.Errorf("deniedHost(%q) matched %q, want allowed", host, match)
+		}
+	}
+}
+
+func TestDenyHostsFromEnv(t *testing.T) {
+	t.Setenv("FETCH_DENY_HOSTS", " Evil.Example. ,2130706433,, ")
+	hosts := denyHostsFromEnv()
+	for _, want := range []string{"evil.example", "127.0.0.1", "metadata.google.internal"} {
+		if !hosts[want] {
+			t.Errorf("denylist missing %q", want)
+		}
+	}
+
+	t.Setenv("FETCH_DENY_HOSTS", "")
+	if got, want := len(denyHostsFromEnv()), len(baseDenyHosts()); got != want {
+		t.Errorf("empty env: %d entries, want the %d base entries", got, want)
+	}
+}
+
+func TestDenyHostErrorAndCounter(t *testing.T) {
+	before := counterValue(t, "url_fetcher_denied_host_total", map[string]string{"match": "169.254.169.254"})
+	err := denyHostError("URL", "2852039166", "169.254.169.254")
+	if !strings.Contains(err.Error(), `"2852039166"`) || !strings.Contains(err.Error(), `"169.254.169.254"`) {
+		t.Errorf("error %q should name both the spelling used and the matched entry", err)
+	}
+	if got := counterValue(t, "url_fetcher_denied_host_total", map[string]string{"match": "169.254.169.254"}); got != before+1 {
+		t.Errorf("denied_host_total{169.254.169.254} = %v, want %v", got, before+1)
+	}
+}
+
+// TestIsPrivateURLDeniesObfuscatedHosts drives the denylist through the real
+// URL validation, where the obfuscated spellings previously fell through to
+// DNS behavior instead of an explicit block.
+func TestIsPrivateURLDeniesObfuscatedHosts(t *testing.T) {
+	for _, raw := range []string{
+		"http://2130706433/",
+		"http://0x7f000001/x",
+		"http://169.254.169.254./latest/meta-data/",
+		"http://[::ffff:169.254.169.254]/",
+		"http://localhost./admin",
+	} {
+		t.Run(raw, func(t *testing.T) {
+			isPrivate, err := isPrivateURL(context.Background(), &net.Resolver{}, raw)
+			if !isPrivate {
+				t.Fatalf("isPrivateURL(%q) = allowed, want denied", raw)
+			}
+			if err == nil || !strings.Contains(err.Error(), "deny list") {
+				t.Errorf("err = %v, want the denylist block", err)
+			}
+		})
+	}
+}
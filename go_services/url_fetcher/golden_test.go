@@ -0,0 +1,146 @@
+package urlfetcher
+
+// Golden regression net for the extraction pipeline. Every fixture under
+// testdata/golden/ is a saved HTML page; its .json sibling is the expected
+// FetchResult-shaped extraction. The test runs the real fetch pipeline (stub
+// transport, TEST-NET-3 origin — see stubTransport) over each page at the
+// thorough level and diffs against the golden, so any change to selectors,
+// whitespace handling, JSON-LD parsing or language detection that alters
+// output for a page we care about fails loudly with a readable diff.
+// Intentional changes regenerate the corpus with:
+//
+//	go test -run TestGoldenExtraction -update
+//
+// Volatile fields (timings, per-fetch resource accounting) are normalized
+// away before comparison — the goldens pin WHAT was extracted, not how long
+// it took.
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden extraction fixtures from current pipeline output")
+
+const goldenDir = "testdata/golden"
+
+// goldenNormalize blanks the fields that vary run to run so the goldens stay
+// byte-stable: wall-clock timings and the resource accounting derived from
+// them. Everything content-shaped (title, description, content, language,
+// status, bytes downloaded) is kept and pinned.
+func goldenNormalize(r *FetchResult) {
+	r.FetchTimeMs = 0
+	r.PhaseMs = nil
+	r.Resources = nil
+}
+
+// goldenJSON renders a result the way the goldens store it.
+func goldenJSON(t *testing.T, r *FetchResult) []byte {
+	t.Helper()
+	out, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		t.Fatalf("marshaling result: %v", err)
+	}
+	return append(out, '\n')
+}
+
+// goldenDiff produces a line-oriented report of the first divergence plus
+// every differing line, which is far easier to act on than two JSON blobs.
+func goldenDiff(want, got []byte) string {
+	wantLines := strings.Split(string(want), "\n")
+	gotLines := strings.Split(string(got), "\n")
+	var b strings.Builder
+	n := len(wantLines)
+	if len(gotLines) > n {
+		n = len(gotLines)
+	}
+	for i := 0; i < n; i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			fmt.Fprintf(&b, "line %d:\n  golden: %s\n  got:    %s\n", i+1, w, g)
+		}
+	}
+	return b.String()
+}
+
+func TestGoldenExtraction(t *testing.T) {
+	pages, err := filepath.Glob(filepath.Join(goldenDir, "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) == 0 {
+		t.Fatalf("no fixtures under %s — the corpus is the regression net, it must not silently vanish", goldenDir)
+	}
+
+	for _, page := range pages {
+		name := strings.TrimSuffix(filepath.Base(page), ".html")
+		t.Run(name, func(t *testing.T) {
+			body, err := os.ReadFile(page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := newStubFetcher("text/html; charset=utf-8", map[string]string{"/" + name: string(body)})
+			result := f.fetchOnce(context.Background(), stubOrigin+"/"+name, levelThorough)
+			goldenNormalize(&result)
+			got := goldenJSON(t, &result)
+
+			goldenFile := filepath.Join(goldenDir, name+".json")
+			if *updateGolden {
+				if err := os.WriteFile(goldenFile, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(goldenFile)
+			if err != nil {
+				t.Fatalf("missing golden for %s (run with -update to create it): %v", name, err)
+			}
+			if string(want) != string(got) {
+				t.Errorf("extraction output changed for %s (intentional? rerun with -update):\n%s", name, goldenDiff(want, got))
+			}
+		})
+	}
+}
+
+// TestGoldenCorpusComplete pins that every golden has its page and vice
+// versa, so a half-deleted fixture pair can't quietly shrink the net.
+func TestGoldenCorpusComplete(t *testing.T) {
+	entries, err := os.ReadDir(goldenDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string][2]bool{}
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case strings.HasSuffix(name, ".html"):
+			pair := seen[strings.TrimSuffix(name, ".html")]
+			pair[0] = true
+			seen[strings.TrimSuffix(name, ".html")] = pair
+		case strings.HasSuffix(name, ".json"):
+			pair := seen[strings.TrimSuffix(name, ".json")]
+			pair[1] = true
+			seen[strings.TrimSuffix(name, ".json")] = pair
+		}
+	}
+	for name, pair := range seen {
+		if !pair[0] {
+			t.Errorf("golden %s.json has no %s.html page", name, name)
+		}
+		if !pair[1] {
+			t.Errorf("page %s.html has no golden (run with -update)", name)
+		}
+	}
+}
@@ -1,29 +1,43 @@
-package main
+package urlfetcher
 
 import (
 	"bytes"
+	"container/heap"
 	"context"
+	"crypto/subtle"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
-	"os/signal"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
-	"syscall"
+	"sync/atomic"
 	"time"
+	"unicode"
 	"unicode/utf8"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"golang.org/x/net/html/charset"
 	"golang.org/x/time/rate"
+
+	"github.com/voraehita25-star/discord-bot/go_services/healthkit"
+	"github.com/voraehita25-star/discord-bot/go_services/internal/server"
 )
 
 const (
@@ -42,19 +56,6 @@ type traceIDContextKey struct{}
 // Initialized once to avoid repeated parsing.
 var privateNetworks []*net.IPNet
 
-// dangerousHosts is the denylist of known dangerous hostnames (cloud metadata
-// endpoints). Shared between isPrivateURL (initial URL) and the client's
-// CheckRedirect (every redirect hop) so the blocklist is enforced on all hops.
-var dangerousHosts = []string{
-	"metadata.google.internal",
-	"metadata.internal",
-	"169.254.169.254",           // AWS/GCP instance metadata
-	"metadata.google.internal.", // trailing dot variant
-	"instance-data",             // AWS alternative
-	"100.100.100.200",           // Alibaba Cloud metadata
-	"fd00:ec2::254",             // AWS IMDSv2 IPv6
-}
-
 func init() {
 	ranges := []string{
 		"127.0.0.0/8",            // Loopback
@@ -71,6 +72,7 @@ func init() {
 		"::1/128",                // IPv6 loopback
 		"fc00::/7",               // IPv6 unique local
 		"fe80::/10",              // IPv6 link-local
+		"fec0::/10",              // IPv6 site-local (deprecated, RFC 3879). Must be explicit: Go's IsGlobalUnicast() treats site-local as global unicast, so the non-global-unicast fallback below does NOT catch it.
 		"64:ff9b::/96",           // NAT64 well-known prefix (embeds IPv4; e.g. 127.0.0.1/metadata)
 		"64:ff9b:1::/48",         // NAT64 local-use prefix (RFC 8215; also embeds IPv4 — parity with Python is_reserved)
 		"2002::/16",              // 6to4 (embeds IPv4; parity with Python is_private)
@@ -131,7 +133,7 @@ func isPrivateIP(ip net.IP) bool {
 // (req.Timeout) — same as the dial-time ssrfSafeDialContext guard. A context-less
 // net.LookupIP here would block the worker for the full OS resolver timeout against
 // a tarpit/hanging DNS server, ignoring the request context.
-func isPrivateURL(ctx context.Context, rawURL string) (bool, error) {
+func isPrivateURL(ctx context.Context, resolver *net.Resolver, rawURL string) (bool, error) {
 	parsed, err := url.Parse(rawURL)
 	if err != nil {
 		return true, fmt.Errorf("invalid URL: %v", err)
@@ -141,11 +143,11 @@ func isPrivateURL(ctx context.Context, rawURL string) (bool, error) {
 		return true, fmt.Errorf("empty hostname")
 	}
 
-	// Block known dangerous hostnames (cloud metadata endpoints)
-	for _, h := range dangerousHosts {
-		if strings.EqualFold(hostname, h) {
-			return true, nil
-		}
+	// Hard denylist first (cloud metadata endpoints, localhost aliases,
+	// obfuscated IP encodings — see denyhosts.go): normalization means the
+	// spelling doesn't matter, and the distinct error names the match.
+	if match, denied := deniedHost(hostname); denied {
+		return true, denyHostError("URL", hostname, match)
 	}
 
 	// If the host is an IP literal, check it directly before resolving.
@@ -154,12 +156,16 @@ func isPrivateURL(ctx context.Context, rawURL string) (bool, error) {
 	// keeps the string layer no weaker than the dial-time IP guard and mirrors
 	// Python's _ip_is_blocked, which unwraps such forms.
 	if ip := net.ParseIP(hostname); ip != nil && isPrivateIP(ip) {
+		if match, ok := allowHosts.matchIP(ip); ok {
+			allowAudit("URL", hostname, match)
+			return false, nil
+		}
 		return true, nil
 	}
 
 	// Resolve hostname to IP and check. Use a context-aware resolver so this
 	// pre-check respects req.Timeout/cancellation, mirroring ssrfSafeDialContext.
-	ipAddrs, err := (&net.Resolver{}).LookupIPAddr(ctx, hostname)
+	ipAddrs, err := resolver.LookupIPAddr(ctx, hostname)
 	if err != nil {
 		// Fail CLOSED on DNS failure (block), matching the Python guard in
 		// utils/web/url_fetcher.py. Relying only on the dial-time check is
@@ -168,10 +174,20 @@ func isPrivateURL(ctx context.Context, rawURL string) (bool, error) {
 		// can't be fetched anyway, so blocking here loses nothing.
 		return true, fmt.Errorf("DNS resolution failed (blocked): %v", err)
 	}
-	for _, ipAddr := range ipAddrs {
-		if isPrivateIP(ipAddr.IP) {
-			return true, nil
+	// Same mixed-resolution policy as the dial-time guard: all-private (or
+	// strict-mode mixed) answer sets are blocked here before any dial; a
+	// permissive-mode mixed set passes and the dialer restricts itself to
+	// the public addresses.
+	if _, err := vetResolvedIPs(hostname, ipAddrs, strictMixedResolution); err != nil {
+		// The allowlist (FETCH_ALLOW_HOSTS) relaxes the private-IP verdict
+		// only, and only after resolution succeeded: an allowlisted hostname
+		// may resolve private, and fully-CIDR-covered private answers pass.
+		// The denylist above already had its say, so metadata stays blocked.
+		if match, ok := allowHosts.allowPrivate(hostname, ipAddrs); ok {
+			allowAudit("URL", hostname, match)
+			return false, nil
 		}
+		return true, err
 	}
 	return false, nil
 }
@@ -180,38 +196,492 @@ func isPrivateURL(ctx context.Context, rawURL string) (bool, error) {
 type FetchRequest struct {
 	URLs    []string `json:"urls"`
 	Timeout int      `json:"timeout,omitempty"` // seconds
+	// Level selects the extraction level for every URL in the batch
+	// (fast/standard/thorough; empty = standard).
+	Level string `json:"level,omitempty"`
+	// Strict restores the historical all-or-nothing behavior: any URL
+	// failing validation 400s the whole batch instead of producing a
+	// per-item validation_failed result.
+	Strict bool `json:"strict,omitempty"`
 }
 
 // FetchResult represents the result of fetching a URL
 type FetchResult struct {
-	URL         string `json:"url"`
-	Title       string `json:"title,omitempty"`
-	Content     string `json:"content,omitempty"`
-	Description string `json:"description,omitempty"`
-	Error       string `json:"error,omitempty"`
-	StatusCode  int    `json:"status_code,omitempty"`
-	ContentType string `json:"content_type,omitempty"`
-	FetchTimeMs int64  `json:"fetch_time_ms"`
+	URL             string `json:"url"`
+	Title           string `json:"title,omitempty"`
+	Content         string `json:"content,omitempty"`
+	Description     string `json:"description,omitempty"`
+	Error           string `json:"error,omitempty"`
+	ErrorCode       string `json:"error_code,omitempty"` // stable machine-readable code ("mixed_resolution", "validation_failed", "too_large")
+	StatusCode      int    `json:"status_code,omitempty"`
+	ContentType     string `json:"content_type,omitempty"`
+	FetchTimeMs     int64  `json:"fetch_time_ms"`
+	BytesDownloaded int64  `json:"bytes_downloaded,omitempty"`
+	// WrapperHop is the original wrapper URL when this result came from
+	// following a frame/JS-redirect wrapper page (see detectWrapperTarget);
+	// empty for direct fetches.
+	WrapperHop string `json:"wrapper_hop,omitempty"`
+	// PhaseMs breaks FetchTimeMs into coarse phases measured at the fetch
+	// pipeline's own boundaries (precheck = SSRF vetting + limiter wait,
+	// request = connect through response headers, read = body download,
+	// process = charset + extraction). Coarse on purpose: these are the
+	// boundaries the Clock seam can observe, which keeps them testable.
+	PhaseMs map[string]int64 `json:"phase_ms,omitempty"`
+	// Resumed marks a body that was completed via a Range-request resumption
+	// after the first connection died mid-download (see tryResumeBody).
+	Resumed bool `json:"resumed,omitempty"`
+	// ExtractionLevel echoes the level actually applied to this result (see
+	// the extraction-levels section); Language is the thorough-level detected
+	// document language.
+	ExtractionLevel string `json:"extraction_level,omitempty"`
+	Language        string `json:"language,omitempty"`
+	// CacheHit marks a result served from the response cache (see fetchCache)
+	// instead of an outbound request.
+	CacheHit bool `json:"cache_hit,omitempty"`
+	// Resources itemizes what this fetch cost (see ResourceUsage); absent on
+	// results that failed before a body was read.
+	Resources *ResourceUsage `json:"resources,omitempty"`
+
+	// wrapperTarget is the detected frame/JS-redirect target awaiting the
+	// single follow-up hop in Fetch. Unexported: it's pipeline state, not part
+	// of the response contract.
+	wrapperTarget string
+	// etag/lastModified are the response validators, kept for the cache's
+	// conditional-GET revalidation (see revalidateEntry). Unexported like
+	// wrapperTarget — cache state, not response contract.
+	etag         string
+	lastModified string
+}
+
+// Source values for ResourceUsage attribution.
+const (
+	resourceSourceNetwork = "network"
+	resourceSourceCache   = "cache"
+)
+
+// ResourceUsage itemizes what one fetch actually cost, for capacity planning.
+// WireBytes is the body as it came off the socket (same figure as
+// BytesDownloaded); when the transport transparently gunzipped the response
+// the original on-wire count is unrecoverable (Go strips Content-Length on
+// decompression), so WireBytes then reports the post-gunzip size and
+// overstates. DecompressedBytes is what the parser actually consumed, after
+// charset transcoding to UTF-8. ParseTimeMs is a wall-clock proxy for parse
+// CPU — deliberately time-based so it is cheap enough to always be on
+// (per-fetch ReadMemStats stalls every goroutine). These are also the figures
+// the fetcher's metrics export will feed into histograms once it has one.
+type ResourceUsage struct {
+	WallTimeMs        int64 `json:"wall_time_ms"`
+	WireBytes         int64 `json:"wire_bytes"`
+	DecompressedBytes int64 `json:"decompressed_bytes"`
+	ParseTimeMs       int64 `json:"parse_time_ms"`
+	// Source attributes the cost: "network" for a real outbound fetch,
+	// "cache" for a response-cache hit. On a hit the byte counts still
+	// describe the original fetch (that is the data volume the caller got),
+	// while wall/parse are this call's — effectively zero.
+	Source string `json:"source,omitempty"`
+}
+
+// TimingStats holds nearest-rank distribution figures over one dimension of a
+// batch (fetch times or bytes). Zero value when the batch had no successes.
+type TimingStats struct {
+	Min    int64 `json:"min"`
+	Median int64 `json:"median"`
+	P95    int64 `json:"p95"`
+	Max    int64 `json:"max"`
+}
+
+// TimingSummary gives the Python side a quick sense of a batch's distribution
+// without post-processing every result: percentile stats over the SUCCESSFUL
+// results, plus counts per error category for the failed ones.
+type TimingSummary struct {
+	FetchTimeMs TimingStats    `json:"fetch_time_ms"`
+	Bytes       TimingStats    `json:"bytes"`
+	ErrorCounts map[string]int `json:"error_counts,omitempty"`
 }
 
 // FetchResponse is the response for batch fetch
 type FetchResponse struct {
-	Results      []FetchResult `json:"results"`
-	TotalTimeMs  int64         `json:"total_time_ms"`
-	SuccessCount int           `json:"success_count"`
-	ErrorCount   int           `json:"error_count"`
+	Results       []FetchResult  `json:"results"`
+	TotalTimeMs   int64          `json:"total_time_ms"`
+	SuccessCount  int            `json:"success_count"`
+	ErrorCount    int            `json:"error_count"`
+	TimingSummary *TimingSummary `json:"timing_summary,omitempty"`
+	// ResourceTotals sums the per-result ResourceUsage figures (Source is
+	// meaningless for an aggregate and left empty); absent when no result
+	// carried accounting.
+	ResourceTotals *ResourceUsage `json:"resource_totals,omitempty"`
+}
+
+// nearestRank returns the p-th percentile of ascending-sorted values using the
+// nearest-rank method: the value at 1-based index ceil(p/100*N). Chosen over
+// interpolation because it stays meaningful at the tiny Ns a 20-URL batch
+// produces (N=1 returns the single value for every p).
+func nearestRank(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// summarizeInt64 computes min/median/p95/max over values (unsorted input).
+func summarizeInt64(values []int64) TimingStats {
+	if len(values) == 0 {
+		return TimingStats{}
+	}
+	sorted := make([]int64, len(values))
+	copy(sorted, values)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return TimingStats{
+		Min:    sorted[0],
+		Median: nearestRank(sorted, 50),
+		P95:    nearestRank(sorted, 95),
+		Max:    sorted[len(sorted)-1],
+	}
+}
+
+// classifyFetchError maps a FetchResult.Error string onto a stable category
+// for the batch summary's error counts. Categories, not raw strings, so the
+// Python side can aggregate without parsing our error prose.
+func classifyFetchError(msg string) string {
+	switch {
+	case strings.HasPrefix(msg, "SSRF blocked"):
+		return "ssrf_blocked"
+	case strings.HasPrefix(msg, "HTTP "):
+		return "http_status"
+	case strings.HasPrefix(msg, "aborted before fetch"), msg == "context cancelled":
+		return "cancelled"
+	case strings.HasPrefix(msg, "invalid URL"):
+		return "invalid_url"
+	case strings.HasPrefix(msg, "read error"):
+		return "read_error"
+	case strings.HasPrefix(msg, "attachment too large"):
+		return "too_large"
+	case strings.HasPrefix(msg, "panic during fetch"):
+		return "panic"
+	case strings.HasPrefix(msg, "fetch error"):
+		return "fetch_error"
+	default:
+		return "other"
+	}
+}
+
+// Clock abstracts time so tests can drive fetch timing logic without
+// sleeping. Production code always uses realClock; tests inject a fake via
+// WithClock. Keep the surface minimal — only what the fetcher uses.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker mirrors the subset of *time.Ticker the fetcher consumes.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct{ t *time.Ticker }
+
+func (r realTicker) C() <-chan time.Time { return r.t.C }
+func (r realTicker) Stop()               { r.t.Stop() }
+
+// --- adaptive outbound rate limiting ---------------------------------------
+//
+// The fixed outbound limit was either too aggressive (healthy upstreams,
+// batches queueing for nothing) or too lax (an erroring upstream kept getting
+// hammered). aimdController runs a classic AIMD loop over fixed observation
+// intervals: additive increase toward the ceiling while the interval's error
+// rate stays under the threshold, multiplicative cut when infrastructure
+// errors or 429s exceed it. Pure component — the Fetcher feeds it classified
+// outcomes and applies its rate to the limiter on each tick.
+
+const (
+	aimdInterval      = 10 * time.Second
+	defaultRateFloor  = 5.0
+	defaultRateCeil   = 50.0 // matches the previous fixed limit
+	defaultRateStep   = 2.0  // additive increase per healthy interval
+	defaultRateCut    = 0.5  // multiplicative factor on an unhealthy interval
+	defaultErrorRatio = 0.3  // interval error-rate threshold
+)
+
+type aimdController struct {
+	mu        sync.Mutex
+	rate      float64
+	floor     float64
+	ceiling   float64
+	step      float64
+	cut       float64
+	threshold float64
+	pinned    bool
+	total     int
+	errors    int
+}
+
+func newAIMDController(floor, ceiling, step, cut, threshold float64) *aimdController {
+	return &aimdController{
+		// Start at the ceiling (the previous fixed behavior); errors will cut
+		// it down and healthy intervals bring it back up.
+		rate:      ceiling,
+		floor:     floor,
+		ceiling:   ceiling,
+		step:      step,
+		cut:       cut,
+		threshold: threshold,
+	}
+}
+
+// record feeds one classified fetch outcome into the current interval.
+// infraError means an infrastructure-level failure (dial/timeout) or HTTP 429
+// — the signals that mean "back off"; application-level 4xx/5xx are upstream
+// semantics, not our sending rate.
+func (c *aimdController) record(infraError bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.total++
+	if infraError {
+		c.errors++
+	}
+}
+
+// tick closes the observation interval and returns the (possibly adjusted)
+// rate. Intervals with no traffic leave the rate unchanged so an idle service
+// doesn't creep to the ceiling on zero evidence.
+func (c *aimdController) tick() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	total, errors := c.total, c.errors
+	c.total, c.errors = 0, 0
+	if c.pinned || total == 0 {
+		return c.rate
+	}
+	if float64(errors)/float64(total) > c.threshold {
+		c.rate = math.Max(c.rate*c.cut, c.floor)
+	} else {
+		c.rate = math.Min(c.rate+c.step, c.ceiling)
+	}
+	return c.rate
+}
+
+func (c *aimdController) currentRate() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rate
+}
+
+// pin fixes the rate and disables adaptation (manual operator override).
+func (c *aimdController) pin(rate float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rate = rate
+	c.pinned = true
+}
+
+// capacityReport is the /fetch/capacity response body.
+type capacityReport struct {
+	EffectiveRateRPS float64 `json:"effective_rate_rps"`
+	FloorRPS         float64 `json:"floor_rps"`
+	CeilingRPS       float64 `json:"ceiling_rps"`
+	Pinned           bool    `json:"pinned"`
+	IntervalSeconds  float64 `json:"interval_seconds"`
+}
+
+func (c *aimdController) report() capacityReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return capacityReport{
+		EffectiveRateRPS: c.rate,
+		FloorRPS:         c.floor,
+		CeilingRPS:       c.ceiling,
+		Pinned:           c.pinned,
+		IntervalSeconds:  aimdInterval.Seconds(),
+	}
+}
+
+// outboundRateGauge exposes the effective outbound rate for dashboards.
+var outboundRateGauge = promauto.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "url_fetcher_outbound_rate_limit_rps",
+		Help: "Current effective outbound rate limit in requests/second (AIMD-adjusted)",
+	},
+)
+
+// buildInfoGauge is the standard build-identity join gauge, mirroring
+// healthkit's discord_bot_build_info so both services annotate alerts the
+// same way. Labels are set once at startup from healthkit.ResolveBuildInfo.
+var buildInfoGauge = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "url_fetcher_build_info",
+		Help: "Build identity of the running binary (constant 1; join on the labels)",
+	},
+	[]string{"version", "commit", "go_version"},
+)
+
+// serviceVersionFromEnv reads BOT_VERSION with the same "dev" fallback the
+// health API uses, so the two /version endpoints agree on the deploy.
+func serviceVersionFromEnv() string {
+	if v := os.Getenv("BOT_VERSION"); v != "" {
+		return v
+	}
+	return "dev"
+}
+
+// shuttingDown flips on the shutdown signal so /health (this service's
+// readiness probe) answers 503 while in-flight fetches drain — same sequence
+// as the health API (see healthkit/shutdown.go).
+var shuttingDown atomic.Bool
+
+// healthHandler answers /health: 200 healthy in steady state, 503
+// shutting_down once the drain has begun.
+func healthHandler(version string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		status := "healthy"
+		if shuttingDown.Load() {
+			status = "shutting_down"
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(map[string]string{"status": status, "version": version}); err != nil {
+			log.Printf("Failed to encode health response: %v", err)
+		}
+	}
 }
 
 // Fetcher handles URL fetching with rate limiting
 type Fetcher struct {
-	client  *http.Client
-	limiter *rate.Limiter
+	client     *http.Client
+	limiter    *rate.Limiter
+	clock      Clock
+	resolver   *net.Resolver
+	controller *aimdController
+	usage      *usageStats
+	slow       *slowTracker
+	cache      *fetchCache
+	robots     *robotsVerdicts
+	prewarm    *prewarmStore
+	// deadLetters retains batch items rejected by validation (see the
+	// dead-letter section) for GET /fetch/deadletter.
+	deadLetters *deadLetterRing
+	// health is the self-diagnosis feeding the health API registration (see
+	// selfreport.go).
+	health *healthTracker
+}
+
+// FetcherOption customizes NewFetcher — test seams only; the defaults are
+// always the production SSRF-safe client, real clock and real resolver.
+type FetcherOption func(*Fetcher)
+
+// WithClock injects a test clock (see Clock).
+func WithClock(c Clock) FetcherOption {
+	return func(f *Fetcher) { f.clock = c }
+}
+
+// WithHTTPClient replaces the outbound client. Test-only: the default client
+// carries the SSRF-safe transport and redirect guard — swapping it in
+// production would bypass those.
+func WithHTTPClient(c *http.Client) FetcherOption {
+	return func(f *Fetcher) { f.client = c }
+}
+
+// WithResolver replaces the resolver used by the pre-fetch isPrivateURL
+// check (the dial-time guard builds its own — see ssrfSafeDialContext).
+func WithResolver(r *net.Resolver) FetcherOption {
+	return func(f *Fetcher) { f.resolver = r }
 }
 
 // ssrfSafeDialContext returns a DialContext function that checks resolved IPs
 // against private ranges at connect time, preventing DNS rebinding attacks.
-func ssrfSafeDialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
-	resolver := &net.Resolver{}
+// --- mixed public/private resolution policy ---------------------------------
+//
+// A known SSRF bypass registers a hostname with BOTH a public and a private
+// A record and relies on resolver round-robin to slip past single-lookup
+// checks. Every vetting step here partitions the FULL answer set instead:
+// strict mode (the default) refuses mixed sets outright; permissive mode
+// (SSRF_MIXED_RESOLUTION=permissive) dials only the public addresses and
+// never the private ones. Either way the decision and the complete resolved
+// set are written to the log for audit.
+
+// errMixedResolution marks a mixed public/private answer set; Fetch maps it
+// to ErrorCode "mixed_resolution" via errors.Is so the Python side can react
+// without string matching.
+var errMixedResolution = errors.New("mixed public/private DNS resolution")
+
+// strictMixedResolution is the process-wide mode, set from env in main().
+// Defaults to strict — the permissive mode is an explicit operator opt-in.
+var strictMixedResolution = true
+
+// strictMixedFromEnv reads SSRF_MIXED_RESOLUTION: "permissive" opts out of
+// strict mode, anything else (including unset or garbage) stays strict.
+func strictMixedFromEnv() bool {
+	raw := strings.ToLower(strings.TrimSpace(os.Getenv("SSRF_MIXED_RESOLUTION")))
+	switch raw {
+	case "", "strict":
+		return true
+	case "permissive":
+		return false
+	default:
+		log.Printf("⚠️ Invalid SSRF_MIXED_RESOLUTION %q (want strict|permissive) — staying strict", raw)
+		return true
+	}
+}
+
+// vetResolvedIPs applies the mixed-resolution policy to one DNS answer set
+// and returns the addresses that may be dialed. Pure so both vetting sites
+// (the pre-check and the dialer) share it and tests can feed stub answer
+// sets without a resolver.
+func vetResolvedIPs(host string, ips []net.IPAddr, strict bool) ([]net.IPAddr, error) {
+	var public, private []net.IPAddr
+	for _, ip := range ips {
+		if isPrivateIP(ip.IP) {
+			private = append(private, ip)
+		} else {
+			public = append(public, ip)
+		}
+	}
+	if len(private) == 0 {
+		return public, nil
+	}
+	if len(public) == 0 {
+		return nil, fmt.Errorf("%q resolves to private IP %s", host, private[0].IP)
+	}
+	// Mixed set: audit the full resolution and the decision either way.
+	if strict {
+		log.Printf("⚠️ SSRF audit: %q resolved to mixed public/private set %v — rejected (strict mode)", host, ips)
+		return nil, fmt.Errorf("%w: %q resolved to %v", errMixedResolution, host, ips)
+	}
+	log.Printf("⚠️ SSRF audit: %q resolved to mixed public/private set %v — dialing public addresses only (permissive mode)", host, ips)
+	return public, nil
+}
+
+// ipResolver is the one net.Resolver method the dial guard consumes.
+// An interface so tests inject stub answer sets without a DNS server.
+type ipResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// dialFunc matches net.Dialer.DialContext — the second seam, so tests can
+// observe exactly which address the guard dials (the pin under test).
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func ssrfSafeDialContext(dialer *net.Dialer) dialFunc {
+	return ssrfSafeDialContextWith(&net.Resolver{}, dialer.DialContext)
+}
+
+// ssrfSafeDialContextWith is ssrfSafeDialContext with the resolver and the
+// underlying dial injectable; production always passes the real pair.
+func ssrfSafeDialContextWith(resolver ipResolver, dial dialFunc) dialFunc {
 	return func(ctx context.Context, network, addr string) (net.Conn, error) {
 		host, port, err := net.SplitHostPort(addr)
 		if err != nil {
@@ -228,11 +698,23 @@ func ssrfSafeDialContext(dialer *net.Dialer) func(ctx context.Context, network,
 			return nil, fmt.Errorf("SSRF blocked: DNS returned no IPs for %q", host)
 		}
 
-		for _, ip := range ips {
-			if isPrivateIP(ip.IP) {
-				return nil, fmt.Errorf("SSRF blocked: %q resolves to private IP %s", host, ip.IP)
+		// Vet the FULL answer set under the mixed-resolution policy (see
+		// vetResolvedIPs): all-private always rejects, mixed rejects in
+		// strict mode and yields only the public addresses in permissive.
+		dialable, err := vetResolvedIPs(host, ips, strictMixedResolution)
+		if err != nil {
+			// Same allowlist relaxation as the isPrivateURL pre-check: both
+			// vetting sites must agree, or an allowlisted fetch would pass
+			// the pre-check only to be refused here at dial time. On a grant
+			// the full vetted-by-allowlist answer set is dialable.
+			match, ok := allowHosts.allowPrivate(host, ips)
+			if !ok {
+				return nil, fmt.Errorf("SSRF blocked: %w", err)
 			}
+			allowAudit("dial", host, match)
+			dialable = ips
 		}
+		ips = dialable
 
 		// Dial the IPs we just validated instead of re-resolving the hostname.
 		// Passing the original host to DialContext triggers a SECOND DNS
@@ -244,7 +726,7 @@ func ssrfSafeDialContext(dialer *net.Dialer) func(ctx context.Context, network,
 		// failover.
 		var lastErr error
 		for _, ip := range ips {
-			conn, derr := dialer.DialContext(ctx, network, net.JoinHostPort(ip.IP.String(), port))
+			conn, derr := dial(ctx, network, net.JoinHostPort(ip.IP.String(), port))
 			if derr == nil {
 				return conn, nil
 			}
@@ -257,8 +739,657 @@ func ssrfSafeDialContext(dialer *net.Dialer) func(ctx context.Context, network,
 	}
 }
 
+// --- usage report (/fetch/report) ------------------------------------------
+//
+// Admins want a "what did the bot fetch" report without log spelunking. The
+// stats are maintained INCREMENTALLY per UTC day and host as fetches complete
+// (never recomputed from raw events — raw events aren't kept), bounded to
+// usageRetentionDays. The report aggregates a requested window into top hosts
+// by volume and bytes, error-rate leaders, policy (SSRF) block counts and a
+// daily trend, as JSON for the Python bot to format into an embed, or CSV
+// via format=csv.
+
+// usageRetentionDays bounds the bucket map: the 30-day max window plus today.
+const usageRetentionDays = 31
+
+// hostUsage is one host's accumulated numbers inside one day bucket.
+type hostUsage struct {
+	Requests     int64
+	Bytes        int64
+	Errors       int64 // upstream/transport failures (excludes policy blocks)
+	PolicyBlocks int64 // SSRF/policy refusals — we never contacted the host
+}
+
+type usageDay struct {
+	hosts map[string]*hostUsage
+}
+
+type usageStats struct {
+	mu        sync.Mutex
+	days      map[string]*usageDay // key: "2006-01-02" (UTC)
+	retention int
+	clock     Clock
+}
+
+func newUsageStats(retention int, clock Clock) *usageStats {
+	return &usageStats{
+		days:      make(map[string]*usageDay),
+		retention: retention,
+		clock:     clock,
+	}
+}
+
+// hostOfURL extracts the lowercase hostname for bucketing; unparseable URLs
+// group under "invalid" so they stay visible instead of vanishing.
+func hostOfURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return "invalid"
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// record folds one completed fetch into today's bucket.
+func (u *usageStats) record(result FetchResult) {
+	host := hostOfURL(result.URL)
+	class := classifyFetchError(result.Error)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	key := u.clock.Now().UTC().Format("2006-01-02")
+	day, ok := u.days[key]
+	if !ok {
+		day = &usageDay{hosts: make(map[string]*hostUsage)}
+		u.days[key] = day
+		u.prune()
+	}
+	h, ok := day.hosts[host]
+	if !ok {
+		h = &hostUsage{}
+		day.hosts[host] = h
+	}
+	h.Requests++
+	h.Bytes += result.BytesDownloaded
+	switch {
+	case class == "ssrf_blocked":
+		h.PolicyBlocks++
+	case result.Error != "":
+		h.Errors++
+	}
+}
+
+// prune drops buckets beyond retention (date keys sort chronologically).
+// Callers hold u.mu.
+func (u *usageStats) prune() {
+	if len(u.days) <= u.retention {
+		return
+	}
+	keys := make([]string, 0, len(u.days))
+	for k := range u.days {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys[:len(keys)-u.retention] {
+		delete(u.days, k)
+	}
+}
+
+// reportHostRow is one host's aggregate across the report window.
+type reportHostRow struct {
+	Host         string  `json:"host"`
+	Requests     int64   `json:"requests"`
+	Bytes        int64   `json:"bytes"`
+	Errors       int64   `json:"errors"`
+	ErrorRate    float64 `json:"error_rate"`
+	PolicyBlocks int64   `json:"policy_blocks"`
+}
+
+// reportTrendRow is one day of the window's trend.
+type reportTrendRow struct {
+	Date         string `json:"date"`
+	Requests     int64  `json:"requests"`
+	Bytes        int64  `json:"bytes"`
+	Errors       int64  `json:"errors"`
+	PolicyBlocks int64  `json:"policy_blocks"`
+}
+
+// usageReport is the /fetch/report JSON body.
+type usageReport struct {
+	WindowDays         int              `json:"window_days"`
+	Since              string           `json:"since"`
+	TopHostsByRequests []reportHostRow  `json:"top_hosts_by_requests"`
+	TopHostsByBytes    []reportHostRow  `json:"top_hosts_by_bytes"`
+	ErrorRateLeaders   []reportHostRow  `json:"error_rate_leaders"`
+	PolicyBlocks       int64            `json:"policy_blocks"`
+	Daily              []reportTrendRow `json:"daily"`
+}
+
+// reportTopN caps every leaderboard so a wide crawl can't bloat the body.
+const reportTopN = 10
+
+// errorRateMinRequests keeps one-off failures (1/1 = 100%) off the
+// error-rate leaderboard; a leader needs a meaningful sample.
+const errorRateMinRequests = 5
+
+// parseReportWindow turns the window query param ("7d", "48h", ...) into a
+// whole number of days, clamped to [1, 30]. Fail-safe: garbage gets the
+// 7-day default rather than a 400 — the report is for humans in a hurry.
+func parseReportWindow(raw string) int {
+	const def = 7
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return def
+	}
+	var days float64
+	if strings.HasSuffix(raw, "d") {
+		n, err := strconv.ParseFloat(strings.TrimSuffix(raw, "d"), 64)
+		if err != nil {
+			return def
+		}
+		days = n
+	} else {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return def
+		}
+		days = d.Hours() / 24
+	}
+	n := int(math.Ceil(days))
+	if n < 1 {
+		return def
+	}
+	if n > 30 {
+		return 30
+	}
+	return n
+}
+
+// buildReport aggregates the last windowDays of buckets (today inclusive).
+func (u *usageStats) buildReport(windowDays int) usageReport {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := u.clock.Now().UTC()
+	since := now.AddDate(0, 0, -(windowDays - 1)).Format("2006-01-02")
+	report := usageReport{
+		WindowDays:         windowDays,
+		Since:              since,
+		TopHostsByRequests: []reportHostRow{},
+		TopHostsByBytes:    []reportHostRow{},
+		ErrorRateLeaders:   []reportHostRow{},
+		Daily:              []reportTrendRow{},
+	}
+
+	hosts := map[string]*reportHostRow{}
+	for date, day := range u.days {
+		if date < since {
+			continue
+		}
+		trend := reportTrendRow{Date: date}
+		for host, h := range day.hosts {
+			row, ok := hosts[host]
+			if !ok {
+				row = &reportHostRow{Host: host}
+				hosts[host] = row
+			}
+			row.Requests += h.Requests
+			row.Bytes += h.Bytes
+			row.Errors += h.Errors
+			row.PolicyBlocks += h.PolicyBlocks
+			trend.Requests += h.Requests
+			trend.Bytes += h.Bytes
+			trend.Errors += h.Errors
+			trend.PolicyBlocks += h.PolicyBlocks
+		}
+		report.Daily = append(report.Daily, trend)
+		report.PolicyBlocks += trend.PolicyBlocks
+	}
+	sort.Slice(report.Daily, func(i, j int) bool { return report.Daily[i].Date < report.Daily[j].Date })
+
+	rows := make([]reportHostRow, 0, len(hosts))
+	for _, row := range hosts {
+		if row.Requests > 0 {
+			row.ErrorRate = float64(row.Errors) / float64(row.Requests)
+		}
+		rows = append(rows, *row)
+	}
+
+	topBy := func(less func(a, b reportHostRow) bool) []reportHostRow {
+		sorted := make([]reportHostRow, len(rows))
+		copy(sorted, rows)
+		sort.Slice(sorted, func(i, j int) bool {
+			if less(sorted[i], sorted[j]) {
+				return true
+			}
+			if less(sorted[j], sorted[i]) {
+				return false
+			}
+			return sorted[i].Host < sorted[j].Host // deterministic ties
+		})
+		if len(sorted) > reportTopN {
+			sorted = sorted[:reportTopN]
+		}
+		return sorted
+	}
+	report.TopHostsByRequests = topBy(func(a, b reportHostRow) bool { return a.Requests > b.Requests })
+	report.TopHostsByBytes = topBy(func(a, b reportHostRow) bool { return a.Bytes > b.Bytes })
+
+	leaders := make([]reportHostRow, 0, len(rows))
+	for _, row := range rows {
+		if row.Requests >= errorRateMinRequests && row.ErrorRate > 0 {
+			leaders = append(leaders, row)
+		}
+	}
+	sort.Slice(leaders, func(i, j int) bool {
+		if leaders[i].ErrorRate != leaders[j].ErrorRate {
+			return leaders[i].ErrorRate > leaders[j].ErrorRate
+		}
+		return leaders[i].Host < leaders[j].Host
+	})
+	if len(leaders) > reportTopN {
+		leaders = leaders[:reportTopN]
+	}
+	report.ErrorRateLeaders = leaders
+
+	return report
+}
+
+// writeReportCSV renders the report as two CSV sections distinguished by the
+// first column: "daily" rows keyed by date, "host" rows keyed by hostname.
+func writeReportCSV(w io.Writer, report usageReport) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"section", "key", "requests", "bytes", "errors", "policy_blocks", "error_rate"}); err != nil {
+		return err
+	}
+	for _, d := range report.Daily {
+		if err := cw.Write([]string{
+			"daily", d.Date,
+			strconv.FormatInt(d.Requests, 10), strconv.FormatInt(d.Bytes, 10),
+			strconv.FormatInt(d.Errors, 10), strconv.FormatInt(d.PolicyBlocks, 10), "",
+		}); err != nil {
+			return err
+		}
+	}
+	for _, h := range report.TopHostsByRequests {
+		if err := cw.Write([]string{
+			"host", h.Host,
+			strconv.FormatInt(h.Requests, 10), strconv.FormatInt(h.Bytes, 10),
+			strconv.FormatInt(h.Errors, 10), strconv.FormatInt(h.PolicyBlocks, 10),
+			strconv.FormatFloat(h.ErrorRate, 'f', 4, 64),
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// handleReport serves GET /fetch/report?window=7d[&format=csv].
+func (f *Fetcher) handleReport(w http.ResponseWriter, r *http.Request) {
+	report := f.usage.buildReport(parseReportWindow(r.URL.Query().Get("window")))
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		if err := writeReportCSV(w, report); err != nil {
+			log.Printf("Failed to write report CSV: %v", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("Failed to encode report response: %v", err)
+	}
+}
+
+// --- slow fetch tracking (/fetch/slow) --------------------------------------
+//
+// When p95 fetch latency spikes, the question is "WHICH URLs were slow", and
+// full audit logging is too heavy an answer. The tracker keeps a bounded set
+// of the slowest fetches of the last hour as a min-heap keyed by duration:
+// once full, a new fetch only enters by beating the current fastest member,
+// so maintenance is O(log n) per fetch and the memory ceiling is hard.
+// Query parameters are redacted from stored URLs — they carry tokens and
+// search terms, and host + path is enough to identify the slow endpoint.
+
+const (
+	// defaultSlowFetchCap bounds the tracked set.
+	defaultSlowFetchCap = 50
+	// slowFetchWindow is the age past which an entry expires — yesterday's
+	// slow fetch is noise when debugging a spike happening now.
+	slowFetchWindow = time.Hour
+)
+
+// slowFetchEntry is one tracked fetch as served by /fetch/slow.
+type slowFetchEntry struct {
+	URL        string           `json:"url"` // query/fragment/userinfo redacted
+	Host       string           `json:"host"`
+	TotalMs    int64            `json:"total_ms"`
+	PhaseMs    map[string]int64 `json:"phase_ms,omitempty"`
+	StatusCode int              `json:"status_code,omitempty"`
+	Bytes      int64            `json:"bytes,omitempty"`
+	// ErrorClass is the stable failure fingerprint (classifyFetchError) when
+	// the slow fetch also errored — slow+failing and slow+succeeding point at
+	// different problems.
+	ErrorClass string `json:"error_class,omitempty"`
+	Timestamp  string `json:"timestamp"`
+
+	at time.Time // expiry key; Timestamp is its RFC3339 rendering
+}
+
+// rfc3339Milli renders server-generated timestamps as UTC RFC3339 with
+// milliseconds, matching healthkit's format so the two services' timestamps
+// (and the Python side's millisecond log lines) cross-reference cleanly.
+const rfc3339Milli = "2006-01-02T15:04:05.000Z07:00"
+
+// redactFetchURL strips query, fragment and userinfo, keeping
+// scheme://host/path — enough to see which endpoint was slow without storing
+// the tokens and search terms query strings carry.
+func redactFetchURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "invalid"
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	u.User = nil
+	return u.String()
+}
+
+// slowHeap is a min-heap over TotalMs: entries[0] is the FASTEST tracked
+// fetch, i.e. the one a new candidate must beat to enter a full set.
+type slowHeap []slowFetchEntry
+
+func (s slowHeap) Len() int           { return len(s) }
+func (s slowHeap) Less(i, j int) bool { return s[i].TotalMs < s[j].TotalMs }
+func (s slowHeap) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s *slowHeap) Push(x any)        { *s = append(*s, x.(slowFetchEntry)) }
+func (s *slowHeap) Pop() any          { old := *s; n := len(old); e := old[n-1]; *s = old[:n-1]; return e }
+
+type slowTracker struct {
+	mu      sync.Mutex
+	cap     int
+	window  time.Duration
+	clock   Clock
+	entries slowHeap
+}
+
+func newSlowTracker(capacity int, window time.Duration, clock Clock) *slowTracker {
+	return &slowTracker{cap: capacity, window: window, clock: clock}
+}
+
+// expireLocked drops entries older than the window. The heap is keyed by
+// duration, not age, so expiry is a filter-and-reheap — fine at cap 50.
+// Callers hold s.mu.
+func (s *slowTracker) expireLocked() {
+	cutoff := s.clock.Now().Add(-s.window)
+	kept := s.entries[:0]
+	for _, e := range s.entries {
+		if e.at.After(cutoff) {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) != len(s.entries) {
+		s.entries = kept
+		heap.Init(&s.entries)
+	}
+}
+
+// record folds one completed fetch in. SSRF blocks and pre-fetch aborts are
+// excluded — they never contacted the upstream, so their duration says
+// nothing about fetch latency.
+func (s *slowTracker) record(result FetchResult) {
+	switch classifyFetchError(result.Error) {
+	case "ssrf_blocked", "invalid_url", "cancelled":
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLocked()
+
+	entry := slowFetchEntry{
+		URL:        redactFetchURL(result.URL),
+		Host:       hostOfURL(result.URL),
+		TotalMs:    result.FetchTimeMs,
+		PhaseMs:    result.PhaseMs,
+		StatusCode: result.StatusCode,
+		Bytes:      result.BytesDownloaded,
+		at:         s.clock.Now(),
+	}
+	entry.Timestamp = entry.at.UTC().Format(rfc3339Milli)
+	if result.Error != "" {
+		entry.ErrorClass = classifyFetchError(result.Error)
+	}
+
+	if len(s.entries) < s.cap {
+		heap.Push(&s.entries, entry)
+		return
+	}
+	if entry.TotalMs > s.entries[0].TotalMs {
+		s.entries[0] = entry
+		heap.Fix(&s.entries, 0)
+	}
+}
+
+// snapshot returns the live entries slowest-first.
+func (s *slowTracker) snapshot() []slowFetchEntry {
+	s.mu.Lock()
+	s.expireLocked()
+	out := make([]slowFetchEntry, len(s.entries))
+	copy(out, s.entries)
+	s.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].TotalMs > out[j].TotalMs })
+	return out
+}
+
+// slowFetchReport is the /fetch/slow JSON body.
+type slowFetchReport struct {
+	WindowSeconds int              `json:"window_seconds"`
+	Capacity      int              `json:"capacity"`
+	Entries       []slowFetchEntry `json:"entries"`
+}
+
+// handleSlowFetches serves GET /fetch/slow (debug group, token-gated).
+func (f *Fetcher) handleSlowFetches(w http.ResponseWriter, r *http.Request) {
+	report := slowFetchReport{
+		WindowSeconds: int(f.slow.window / time.Second),
+		Capacity:      f.slow.cap,
+		Entries:       f.slow.snapshot(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("Failed to encode slow-fetch response: %v", err)
+	}
+}
+
+// requireDebugToken gates the debug route group with a bearer token
+// (FETCH_DEBUG_TOKEN). Fail-closed like the health API's write gate: an empty
+// token refuses everything with 503 rather than silently opening the group,
+// and the comparison is constant-time.
+func requireDebugToken(expected string) func(http.Handler) http.Handler {
+	return requireBearer(expected, "debug endpoints disabled (FETCH_DEBUG_TOKEN not set)")
+}
+
+// requirePrewarmToken gates the prewarm routes (FETCH_PREWARM_TOKEN), same
+// fail-closed contract: without a token the group is off, not open.
+func requirePrewarmToken(expected string) func(http.Handler) http.Handler {
+	return requireBearer(expected, "prewarm endpoints disabled (FETCH_PREWARM_TOKEN not set)")
+}
+
+// requireBearer is the shared bearer-token middleware behind the two gates
+// above: 503 with disabledMsg when no token is configured, 401 on a missing
+// or mismatched token (constant-time compare).
+func requireBearer(expected, disabledMsg string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if expected == "" {
+				http.Error(w, disabledMsg, http.StatusServiceUnavailable)
+				return
+			}
+			auth := r.Header.Get("Authorization")
+			const prefix = "Bearer "
+			if !strings.HasPrefix(auth, prefix) ||
+				subtle.ConstantTimeCompare([]byte(auth[len(prefix):]), []byte(expected)) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// --- outbound header fingerprint -------------------------------------------
+//
+// Some sites block requests whose headers don't look like a browser's. Two
+// separate problems hide in that: (1) Go's http.Client does NOT carry custom
+// headers across cross-host redirects, so hop 2+ went out with the default Go
+// User-Agent — a dead giveaway; (2) a few hosts additionally want the
+// Sec-Fetch-*/Upgrade-Insecure-Requests set a real browser sends. (1) is
+// fixed unconditionally by re-applying our header set in checkRedirect; (2)
+// is opt-in per host via the site rules (BROWSER_LIKE_HOSTS env).
+
+// siteRule holds per-host fetch behavior overrides.
+type siteRule struct {
+	BrowserLike bool
+}
+
+// siteRules maps a lowercase hostname to its rule. Populated from env in
+// main(); empty by default so behavior only changes where an operator asks.
+var siteRules = map[string]siteRule{}
+
+// siteRulesFromEnv parses BROWSER_LIKE_HOSTS, a comma-separated list of
+// hostnames that should receive browser-like headers. Subdomains inherit the
+// rule (see ruleForHost). Empty entries are dropped.
+func siteRulesFromEnv() map[string]siteRule {
+	rules := map[string]siteRule{}
+	for _, h := range strings.Split(os.Getenv("BROWSER_LIKE_HOSTS"), ",") {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h != "" {
+			rules[h] = siteRule{BrowserLike: true}
+		}
+	}
+	return rules
+}
+
+// ruleForHost returns the site rule for a hostname, walking up the domain
+// (api.example.com → example.com → com) so a rule for example.com covers its
+// subdomains. Unknown hosts get the zero rule, i.e. current default behavior.
+func ruleForHost(host string) siteRule {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for host != "" {
+		if rule, ok := siteRules[host]; ok {
+			return rule
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			break
+		}
+		host = host[i+1:]
+	}
+	return siteRule{}
+}
+
+// applyFetchHeaders sets the outbound header set on a request. Called for the
+// initial request AND from checkRedirect on every hop, because Go strips
+// custom headers on cross-host redirects. browserLike additionally sends the
+// navigation headers a real browser would; Accept-Encoding is deliberately
+// left to the transport so its automatic gzip handling stays intact.
+func applyFetchHeaders(h http.Header, browserLike bool) {
+	h.Set("User-Agent", "Mozilla/5.0 (compatible; DiscordBot/1.0)")
+	h.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	h.Set("Accept-Language", "en-US,en;q=0.5")
+	if browserLike {
+		h.Set("Sec-Fetch-Dest", "document")
+		h.Set("Sec-Fetch-Mode", "navigate")
+		h.Set("Sec-Fetch-Site", "none")
+		h.Set("Sec-Fetch-User", "?1")
+		h.Set("Upgrade-Insecure-Requests", "1")
+	}
+}
+
+// lookupRedirectHost resolves redirect-target hostnames for checkRedirect.
+// A package-level seam (not a Fetcher field) because checkRedirect must keep
+// the http.Client CheckRedirect signature; tests stub it for deterministic
+// DNS, production always uses the default-config resolver.
+var lookupRedirectHost = (&net.Resolver{}).LookupIPAddr
+
+// checkRedirect is the client's per-hop redirect policy: hop cap, SSRF
+// re-enforcement, and header re-application.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 5 {
+		return fmt.Errorf("too many redirects")
+	}
+	// Re-enforce the http/https scheme allowlist on every redirect
+	// hop, matching the Python guard (_is_private_url re-checks the
+	// scheme on each hop). Go's transport already rejects non-http(s)
+	// schemes before dialing, but this makes the invariant explicit
+	// instead of relying on that implicit stdlib behavior.
+	if s := strings.ToLower(req.URL.Scheme); s != "http" && s != "https" {
+		return fmt.Errorf("SSRF blocked: redirect to disallowed scheme %q", req.URL.Scheme)
+	}
+	// Redirect target IP is validated by ssrfSafeDialContext, but the host
+	// denylist (see denyhosts.go) is only applied to the initial URL —
+	// re-enforce it on every hop so a redirect can't reach a metadata
+	// hostname or an obfuscated localhost spelling.
+	host := req.URL.Hostname()
+	if match, denied := deniedHost(host); denied {
+		return fmt.Errorf("SSRF blocked: %w", denyHostError("redirect", host, match))
+	}
+	// Defense-in-depth: if the host is an IP literal (incl. non-
+	// canonical encodings of metadata IPs like ::ffff:169.254.169.254),
+	// run it through isPrivateIP so the string denylist above is no
+	// weaker than the dial-time IP guard. Mirrors Python's
+	// _ip_is_blocked, which unwraps such forms.
+	if ip := net.ParseIP(host); ip != nil && isPrivateIP(ip) {
+		// Each hop's target is judged on its own against the allowlist — no
+		// "allowed" state carries over from the previous hop, so a redirect
+		// FROM an allowlisted host cannot smuggle in a private target.
+		if match, ok := allowHosts.matchIP(ip); ok {
+			allowAudit("redirect", host, match)
+		} else {
+			redirectPrivateBlockedTotal.Inc()
+			return fmt.Errorf("SSRF blocked: redirect to private address blocked (%q)", host)
+		}
+	}
+	// Hostname targets get resolved and vetted HERE, not just at dial time:
+	// the dial-time guard re-validates whatever is eventually dialed, but
+	// rejecting the hop before any connection attempt yields a distinct,
+	// greppable error — and protects configurations running with an injected
+	// transport that lacks the dial guard. Relative Location headers are
+	// already resolved against the previous URL by http.Client before
+	// CheckRedirect runs, so req.URL is always absolute by this point. DNS
+	// failure fails closed, same rationale as the isPrivateURL pre-check.
+	if net.ParseIP(host) == nil {
+		ips, err := lookupRedirectHost(req.Context(), host)
+		if err != nil {
+			return fmt.Errorf("SSRF blocked: DNS resolution failed for redirect target %q: %v", host, err)
+		}
+		for _, addr := range ips {
+			if isPrivateIP(addr.IP) {
+				// Allowlist judged per hop, same as the literal branch above.
+				if match, ok := allowHosts.allowPrivate(host, ips); ok {
+					allowAudit("redirect", host, match)
+					break
+				}
+				redirectPrivateBlockedTotal.Inc()
+				return fmt.Errorf("SSRF blocked: redirect to private address blocked (%q resolved to %s)", host, addr.IP)
+			}
+		}
+	}
+	// Go drops custom headers when following a cross-host redirect, so
+	// without this the later hops went out with the default Go User-Agent.
+	// Re-apply the full set on every hop, under the HOP's site rule.
+	// (http.Client always populates Header; the nil guard covers hand-built
+	// requests in tests.)
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	applyFetchHeaders(req.Header, ruleForHost(host).BrowserLike)
+	return nil
+}
+
 // NewFetcher creates a new Fetcher with SSRF-safe transport
-func NewFetcher() *Fetcher {
+func NewFetcher(opts ...FetcherOption) *Fetcher {
 	dialer := &net.Dialer{Timeout: 10 * time.Second}
 	transport := &http.Transport{
 		DialContext: ssrfSafeDialContext(dialer),
@@ -278,61 +1409,752 @@ func NewFetcher() *Fetcher {
 		ReadBufferSize:        64 * 1024, // 64KB
 	}
 
-	return &Fetcher{
+	f := &Fetcher{
+		clock:    realClock{},
+		resolver: &net.Resolver{},
 		client: &http.Client{
-			Timeout:   requestTimeout,
-			Transport: transport,
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				if len(via) >= 5 {
-					return fmt.Errorf("too many redirects")
-				}
-				// Re-enforce the http/https scheme allowlist on every redirect
-				// hop, matching the Python guard (_is_private_url re-checks the
-				// scheme on each hop). Go's transport already rejects non-http(s)
-				// schemes before dialing, but this makes the invariant explicit
-				// instead of relying on that implicit stdlib behavior.
-				if s := strings.ToLower(req.URL.Scheme); s != "http" && s != "https" {
-					return fmt.Errorf("SSRF blocked: redirect to disallowed scheme %q", req.URL.Scheme)
-				}
-				// Redirect target IP is validated by ssrfSafeDialContext, but
-				// the dangerousHosts metadata denylist (isPrivateURL) is only
-				// applied to the initial URL — re-enforce it on every hop so a
-				// redirect can't reach a metadata hostname.
-				host := req.URL.Hostname()
-				for _, h := range dangerousHosts {
-					if strings.EqualFold(host, h) {
-						return fmt.Errorf("SSRF blocked: redirect to dangerous host %q", host)
-					}
-				}
-				// Defense-in-depth: if the host is an IP literal (incl. non-
-				// canonical encodings of metadata IPs like ::ffff:169.254.169.254),
-				// run it through isPrivateIP so the string denylist above is no
-				// weaker than the dial-time IP guard. Mirrors Python's
-				// _ip_is_blocked, which unwraps such forms.
-				if ip := net.ParseIP(host); ip != nil && isPrivateIP(ip) {
-					return fmt.Errorf("SSRF blocked: redirect to private IP %q", host)
-				}
-				return nil
-			},
+			Timeout:       requestTimeout,
+			Transport:     transport,
+			CheckRedirect: checkRedirect,
 		},
-		limiter: rate.NewLimiter(rate.Limit(50), 100), // 50 requests/sec, burst 100 (R7 9800X3D)
+		limiter:    rate.NewLimiter(rate.Limit(defaultRateCeil), 100), // starts at the ceiling, burst 100 (R7 9800X3D)
+		controller: newAIMDController(defaultRateFloor, defaultRateCeil, defaultRateStep, defaultRateCut, defaultErrorRatio),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	// Built after the options so an injected clock (WithClock) drives the
+	// usage buckets' day rollover and the slow-fetch expiry too.
+	f.usage = newUsageStats(usageRetentionDays, f.clock)
+	f.slow = newSlowTracker(defaultSlowFetchCap, slowFetchWindow, f.clock)
+	f.cache = newFetchCache(fetchCacheCap, f.clock)
+	f.robots = newRobotsVerdicts(f.clock)
+	f.prewarm = newPrewarmStore()
+	f.deadLetters = newDeadLetterRing(deadLetterCapFromEnv(), f.clock)
+	f.health = newHealthTracker(f.clock)
+	return f
+}
+
+// recordOutcome feeds one fetch result into the adaptive controller. SSRF
+// blocks, invalid URLs and pre-fetch cancellations never reached the upstream,
+// so they carry no signal about our sending rate and are excluded entirely.
+// Application-level HTTP errors count as traffic but only infrastructure
+// failures and 429s count against the error budget.
+func (f *Fetcher) recordOutcome(result FetchResult) {
+	switch classifyFetchError(result.Error) {
+	case "ssrf_blocked", "invalid_url", "cancelled":
+		return
+	}
+	infra := classifyFetchError(result.Error) == "fetch_error" ||
+		result.StatusCode == http.StatusTooManyRequests
+	f.controller.record(infra)
+	f.health.noteOutcome(infra)
+}
+
+// adjustRate closes the controller's observation interval and applies the
+// resulting rate to the limiter and the exported gauge. Driven by the AIMD
+// ticker goroutine in main().
+func (f *Fetcher) adjustRate() float64 {
+	r := f.controller.tick()
+	f.limiter.SetLimit(rate.Limit(r))
+	outboundRateGauge.Set(r)
+	return r
+}
+
+// pinRate applies a manual operator override: fixed rate, adaptation off.
+func (f *Fetcher) pinRate(rps float64) {
+	f.controller.pin(rps)
+	f.limiter.SetLimit(rate.Limit(rps))
+	outboundRateGauge.Set(rps)
+}
+
+// --- response cache & coordinated prewarming --------------------------------
+//
+// Every morning the bot posts a digest of ~15 known URLs and users then click
+// and re-ask about them, producing a burst of cold fetches. The response
+// cache serves repeat fetches of the same URL without an outbound request,
+// and POST /fetch/prewarm lets the digest job populate it ahead of the burst.
+// Prewarm traffic is strictly background-class: it checks robots.txt (the
+// fetch wasn't user-requested, so politeness rules apply), goes through the
+// same SSRF/rate-limit pipeline as everything else, and stores results at a
+// priority that can never evict a cache entry hotter than itself.
+
+const (
+	fetchCacheCap = 128
+	fetchCacheTTL = 15 * time.Minute
+	// Cache priorities: an insert may only evict entries whose hit count is
+	// at or below its priority. Prewarm (0) can only displace never-hit
+	// entries; interactive (1) can also displace single-hit ones.
+	cachePriorityPrewarm     = 0
+	cachePriorityInteractive = 1
+
+	maxPrewarmURLs  = 50
+	prewarmJobsKept = 32
+	robotsTTL       = time.Hour
+	maxRobotsBytes  = 64 * 1024
+)
+
+// cacheEntry is one cached fetch result plus its eviction/revalidation state.
+type cacheEntry struct {
+	result   FetchResult
+	storedAt time.Time
+	hits     int
+}
+
+// fetchCache is the response cache: URL → last successful result. Eviction is
+// by hit count, not recency — the digest URLs are warmed at priority 0 and
+// only become hot once users actually click them.
+type fetchCache struct {
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	cap     int
+	clock   Clock
+}
+
+func newFetchCache(capacity int, clock Clock) *fetchCache {
+	return &fetchCache{
+		entries: make(map[string]*cacheEntry, capacity),
+		cap:     capacity,
+		clock:   clock,
+	}
+}
+
+// get returns a copy of the fresh cached result for rawURL, counting the hit.
+// Stale entries miss (they stay in place for revalidation or eviction), and
+// so do entries extracted at a poorer level than the caller wants — richness
+// only ever substitutes downward (see fetchCached).
+func (c *fetchCache) get(rawURL, level string) (FetchResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[rawURL]
+	if !ok || c.clock.Now().Sub(entry.storedAt) > fetchCacheTTL {
+		return FetchResult{}, false
+	}
+	if levelRank(entry.result.ExtractionLevel) < levelRank(level) {
+		return FetchResult{}, false
+	}
+	entry.hits++
+	return entry.result, true
+}
+
+// peek reports whether rawURL is cached and fresh WITHOUT counting a hit —
+// the prewarm worker uses it so checking warmth doesn't fake popularity.
+func (c *fetchCache) peek(rawURL string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[rawURL]
+	return ok && c.clock.Now().Sub(entry.storedAt) <= fetchCacheTTL
+}
+
+// put stores a successful result at the given priority. Updating an existing
+// URL keeps its hit count (refreshing a hot entry must not reset its heat).
+// When the cache is full, the coldest entry is evicted only if its hit count
+// is at or below the insert's priority; otherwise the insert is refused —
+// background prewarms must never push out entries users are actually hitting.
+func (c *fetchCache) put(rawURL string, result FetchResult, priority int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+
+	if entry, ok := c.entries[rawURL]; ok {
+		entry.result = result
+		entry.storedAt = now
+		return true
+	}
+	if len(c.entries) >= c.cap {
+		victim := ""
+		victimHits := 0
+		for u, entry := range c.entries {
+			// Stale entries are free wins regardless of their old heat.
+			if now.Sub(entry.storedAt) > fetchCacheTTL {
+				victim, victimHits = u, 0
+				break
+			}
+			if victim == "" || entry.hits < victimHits {
+				victim, victimHits = u, entry.hits
+			}
+		}
+		if victimHits > priority {
+			return false
+		}
+		delete(c.entries, victim)
+	}
+	c.entries[rawURL] = &cacheEntry{result: result, storedAt: now}
+	return true
+}
+
+// revalidateEntry refreshes a stale cache entry via a conditional GET when
+// validators were captured; a 304 renews the entry without re-downloading the
+// body. Returns true when the entry is fresh again.
+func (f *Fetcher) revalidateEntry(ctx context.Context, rawURL string) bool {
+	f.cache.mu.Lock()
+	entry, ok := f.cache.entries[rawURL]
+	var etag, lastModified string
+	if ok {
+		etag, lastModified = entry.result.etag, entry.result.lastModified
+	}
+	f.cache.mu.Unlock()
+	if !ok || (etag == "" && lastModified == "") {
+		return false
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return false
+	}
+	applyFetchHeaders(req.Header, ruleForHost(req.URL.Hostname()).BrowserLike)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusNotModified {
+		return false
+	}
+
+	f.cache.mu.Lock()
+	if entry, ok := f.cache.entries[rawURL]; ok {
+		entry.storedAt = f.clock.Now()
+	}
+	f.cache.mu.Unlock()
+	return true
+}
+
+// --- robots.txt (prewarm only) ---------------------------------------------
+//
+// Interactive fetches act on a user's explicit request, like a browser, and
+// skip robots. Prewarm fetches are autonomous background traffic, so they
+// honor the User-agent: * Disallow rules. Verdict granularity is the prefix
+// list per scheme://host, cached for an hour.
+
+// robotsRules is the parsed Disallow prefix list for one origin.
+type robotsRules struct {
+	disallow  []string
+	fetchedAt time.Time
+}
+
+type robotsVerdicts struct {
+	mu      sync.Mutex
+	origins map[string]robotsRules
+	clock   Clock
+}
+
+func newRobotsVerdicts(clock Clock) *robotsVerdicts {
+	return &robotsVerdicts{origins: make(map[string]robotsRules), clock: clock}
+}
+
+// parseRobots extracts the Disallow prefixes that apply to User-agent: *.
+// Deliberately minimal: no Allow overrides, no wildcards — a prefix match on
+// Disallow is the conservative reading (we skip MORE than a full parser
+// would, never less).
+func parseRobots(body []byte) []string {
+	var disallow []string
+	inStarGroup := false
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			inStarGroup = value == "*"
+		case "disallow":
+			if inStarGroup && value != "" {
+				disallow = append(disallow, value)
+			}
+		}
+	}
+	return disallow
+}
+
+// rules returns the (possibly cached) Disallow prefixes for origin, fetching
+// origin/robots.txt through client on a cold or expired cache. Fetch errors
+// and non-200s yield no rules — the absence of a retrievable robots.txt is
+// the standard "no restrictions" signal, and the SSRF pipeline has already
+// vetted anything we would actually prewarm.
+func (v *robotsVerdicts) rules(ctx context.Context, client *http.Client, origin string) []string {
+	v.mu.Lock()
+	cached, ok := v.origins[origin]
+	fresh := ok && v.clock.Now().Sub(cached.fetchedAt) <= robotsTTL
+	v.mu.Unlock()
+	if fresh {
+		return cached.disallow
+	}
+
+	var disallow []string
+	req, err := http.NewRequestWithContext(ctx, "GET", origin+"/robots.txt", nil)
+	if err == nil {
+		if resp, err := client.Do(req); err == nil {
+			if resp.StatusCode == http.StatusOK {
+				if body, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsBytes)); err == nil {
+					disallow = parseRobots(body)
+				}
+			}
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			_ = resp.Body.Close()
+		}
+	}
+
+	v.mu.Lock()
+	v.origins[origin] = robotsRules{disallow: disallow, fetchedAt: v.clock.Now()}
+	v.mu.Unlock()
+	return disallow
+}
+
+// allowedByRobots reports whether prewarming rawURL is permitted by its
+// origin's robots.txt. Unparsable URLs are refused — they would fail the
+// fetch anyway.
+func (f *Fetcher) allowedByRobots(ctx context.Context, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	// CDN attachments are user-shared uploads: robots.txt there governs
+	// crawlers, not a bot reading a file its own users handed it.
+	if isDiscordCDNHost(u.Hostname()) {
+		return true
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	for _, prefix := range f.robots.rules(ctx, f.client, u.Scheme+"://"+u.Host) {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// --- prewarm jobs -----------------------------------------------------------
+
+// prewarmJob is the pollable progress record for one prewarm request.
+type prewarmJob struct {
+	ID            string `json:"id"`
+	Total         int    `json:"total"`
+	Completed     int    `json:"completed"`
+	Cached        int    `json:"cached"`
+	RobotsBlocked int    `json:"robots_blocked"`
+	Failed        int    `json:"failed"`
+	Done          bool   `json:"done"`
+}
+
+// prewarmStore keeps the last prewarmJobsKept jobs for polling.
+type prewarmStore struct {
+	mu    sync.Mutex
+	jobs  map[string]*prewarmJob
+	order []string
+	seq   int
+}
+
+func newPrewarmStore() *prewarmStore {
+	return &prewarmStore{jobs: make(map[string]*prewarmJob)}
+}
+
+// create registers a new job, dropping the oldest beyond the retention cap.
+func (s *prewarmStore) create(total int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	id := fmt.Sprintf("prewarm-%d", s.seq)
+	s.jobs[id] = &prewarmJob{ID: id, Total: total}
+	s.order = append(s.order, id)
+	for len(s.order) > prewarmJobsKept {
+		delete(s.jobs, s.order[0])
+		s.order = s.order[1:]
+	}
+	return id
+}
+
+// snapshot returns a copy of the job for polling.
+func (s *prewarmStore) snapshot(id string) (prewarmJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return prewarmJob{}, false
+	}
+	return *job, true
+}
+
+// update applies fn to the job under the store lock.
+func (s *prewarmStore) update(id string, fn func(*prewarmJob)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job, ok := s.jobs[id]; ok {
+		fn(job)
+	}
+}
+
+// runPrewarm works through one job's URLs serially — background traffic has
+// no business fanning out like /fetch/batch; the shared limiter paces it
+// alongside interactive fetches either way.
+func (f *Fetcher) runPrewarm(id string, urls []string) {
+	ctx := context.Background()
+	for _, rawURL := range urls {
+		switch {
+		case !f.allowedByRobots(ctx, rawURL):
+			f.prewarm.update(id, func(j *prewarmJob) { j.RobotsBlocked++ })
+		case f.cache.peek(rawURL) || f.revalidateEntry(ctx, rawURL):
+			// Already warm (or renewed by a cheap conditional GET).
+			f.prewarm.update(id, func(j *prewarmJob) { j.Cached++ })
+		default:
+			reqCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+			// Background indexing wants the best extraction, so prewarmed
+			// entries default to thorough — which also lets them satisfy any
+			// later interactive level (see fetchCached).
+			result := f.fetchCached(reqCtx, rawURL, cachePriorityPrewarm, levelThorough)
+			cancel()
+			if result.Error == "" {
+				f.prewarm.update(id, func(j *prewarmJob) { j.Cached++ })
+			} else {
+				f.prewarm.update(id, func(j *prewarmJob) { j.Failed++ })
+			}
+		}
+		f.prewarm.update(id, func(j *prewarmJob) { j.Completed++ })
+	}
+	f.prewarm.update(id, func(j *prewarmJob) { j.Done = true })
+}
+
+// handlePrewarm serves POST /fetch/prewarm: accept up to maxPrewarmURLs,
+// answer 202 with a job ID immediately, and warm the cache in the background.
+func (f *Fetcher) handlePrewarm(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	var req struct {
+		URLs []string `json:"urls"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.URLs) == 0 {
+		http.Error(w, "urls required", http.StatusBadRequest)
+		return
+	}
+	if len(req.URLs) > maxPrewarmURLs {
+		http.Error(w, fmt.Sprintf("max %d URLs per prewarm", maxPrewarmURLs), http.StatusBadRequest)
+		return
+	}
+	// Same pre-validation as /fetch/batch; the full SSRF pipeline still vets
+	// every URL at fetch time.
+	for _, u := range req.URLs {
+		if len(u) > 8192 {
+			http.Error(w, "url too long (max 8192 bytes)", http.StatusBadRequest)
+			return
+		}
+		if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+			http.Error(w, "all URLs must use http or https scheme", http.StatusBadRequest)
+			return
+		}
+	}
+
+	id := f.prewarm.create(len(req.URLs))
+	go f.runPrewarm(id, req.URLs)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(map[string]string{"id": id}); err != nil {
+		log.Printf("Failed to encode prewarm response: %v", err)
+	}
+}
+
+// handlePrewarmStatus serves GET /fetch/prewarm/{id}: the job-polling side.
+func (f *Fetcher) handlePrewarmStatus(w http.ResponseWriter, r *http.Request) {
+	job, ok := f.prewarm.snapshot(chi.URLParam(r, "id"))
+	if !ok {
+		http.Error(w, "unknown prewarm job", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		log.Printf("Failed to encode prewarm status: %v", err)
+	}
+}
+
+// --- range-request resumption ----------------------------------------------
+//
+// Large plain-text resources (logs, data dumps) sometimes die at 8MB of 9MB
+// to a transient reset; restarting from zero on retry wastes the bytes we
+// already buffered. When the first response advertised byte ranges, ONE
+// follow-up request with Range: bytes=<offset>- stitches the body together.
+// If-Range carries the first response's validator so a resource that changed
+// between the two requests can never be stitched across versions — per RFC
+// 9110 the server answers 200 with the full new body in that case, which
+// replaces the stale buffer wholesale.
+
+// resumeValidator picks the If-Range validator from the first response: a
+// strong ETag if present, else Last-Modified. Weak ETags (W/...) are not
+// valid for ranges. Empty means no safe validator — no resumption.
+func resumeValidator(h http.Header) string {
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return h.Get("Last-Modified")
+}
+
+// tryResumeBody makes the single resumption attempt after a mid-body read
+// error. buffered is what the first read collected before dying; first is the
+// original response (headers only — its body is already dead). Returns the
+// complete body and true on success; (nil, false) means give up and surface
+// the original read error. Strictly one attempt: a failure inside the resume
+// request itself is never retried.
+func tryResumeBody(ctx context.Context, client *http.Client, rawURL string, first *http.Response, buffered []byte) ([]byte, bool) {
+	if len(buffered) == 0 || int64(len(buffered)) >= maxContentLength {
+		return nil, false
+	}
+	if !strings.EqualFold(strings.TrimSpace(first.Header.Get("Accept-Ranges")), "bytes") {
+		return nil, false
+	}
+	validator := resumeValidator(first.Header)
+	if validator == "" {
+		return nil, false
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, false
+	}
+	applyFetchHeaders(req.Header, ruleForHost(req.URL.Hostname()).BrowserLike)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", len(buffered)))
+	req.Header.Set("If-Range", validator)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, false
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// Accept only a range that continues exactly at our offset — anything
+		// else would silently corrupt the stitch.
+		wantPrefix := fmt.Sprintf("bytes %d-", len(buffered))
+		if !strings.HasPrefix(strings.TrimSpace(resp.Header.Get("Content-Range")), wantPrefix) {
+			return nil, false
+		}
+		rest, err := io.ReadAll(io.LimitReader(resp.Body, maxContentLength-int64(len(buffered))))
+		if err != nil {
+			return nil, false
+		}
+		return append(buffered, rest...), true
+	case http.StatusOK:
+		// If-Range validator mismatch (resource changed) or the server ignored
+		// the Range header: a full fresh body replaces the stale buffer.
+		full, err := io.ReadAll(io.LimitReader(resp.Body, maxContentLength))
+		if err != nil {
+			return nil, false
+		}
+		return full, true
+	default:
+		return nil, false
+	}
+}
+
+// Fetch retrieves content from a URL at the standard extraction level,
+// serving fresh cached results without an outbound request (see fetchCache).
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) FetchResult {
+	return f.FetchWithLevel(ctx, rawURL, levelStandard)
+}
+
+// FetchWithLevel is Fetch with an explicit extraction level (see the
+// extraction-levels section for what each level does).
+func (f *Fetcher) FetchWithLevel(ctx context.Context, rawURL, level string) FetchResult {
+	return f.fetchCached(ctx, rawURL, cachePriorityInteractive, level)
+}
+
+// fetchCached is the cache-aware pipeline entry with an explicit cache
+// priority — prewarm traffic stores its results at background priority so it
+// can never evict entries hotter than itself. A cached result is served when
+// its extraction level is at least as rich as the one requested: the richer
+// levels are additive, so a thorough result answers a standard request, but
+// a fast result must not masquerade as one.
+func (f *Fetcher) fetchCached(ctx context.Context, rawURL string, priority int, level string) FetchResult {
+	if cached, ok := f.cache.get(rawURL, level); ok {
+		cached.CacheHit = true
+		// Re-attribute the accounting to the cache on a COPY — the stored
+		// entry keeps its network attribution for the next revalidation.
+		if cached.Resources != nil {
+			usage := *cached.Resources
+			usage.Source = resourceSourceCache
+			usage.WallTimeMs = 0
+			usage.ParseTimeMs = 0
+			cached.Resources = &usage
+		}
+		return cached
+	}
+	result := f.fetchUncached(ctx, rawURL, level)
+	if result.Error == "" {
+		f.cache.put(rawURL, result, priority)
+	}
+	return result
+}
+
+// fetchUncached is the full outbound pipeline: SSRF vetting, the fetch
+// itself, the single wrapper-page hop, and outcome accounting.
+func (f *Fetcher) fetchUncached(ctx context.Context, rawURL, level string) FetchResult {
+	result := f.fetchOnce(ctx, rawURL, level)
+	if target := result.wrapperTarget; target != "" {
+		// Wrapper page: account for the shell fetch, then follow exactly ONE
+		// hop. The follow-up goes through fetchOnce, i.e. the full SSRF
+		// pre-check, dial-time guard and redirect budget apply to the target
+		// as if it had been requested directly. A wrapper pointing at another
+		// wrapper is NOT chained — clearing wrapperTarget below ends it.
+		f.recordOutcome(result)
+		f.usage.record(result)
+		f.slow.record(result)
+		observeFetchMetrics(result)
+
+		followed := f.fetchOnce(ctx, target, level)
+		followed.wrapperTarget = ""
+		followed.WrapperHop = rawURL
+		result = followed
+	}
+	f.recordOutcome(result)
+	f.usage.record(result)
+	f.slow.record(result)
+	observeFetchMetrics(result)
+	return result
+}
+
+// --- Discord CDN attachments -------------------------------------------------
+//
+// Users constantly link cdn.discordapp.com attachments (logs, JSON dumps,
+// saved pages) and ask the bot to read them. They are public, often large,
+// reliably carry Content-Length — and the CDN serves most of them as
+// application/octet-stream no matter what the file is, which made the generic
+// pipeline hand back "[Binary content]" for perfectly readable text. The
+// exact-match CDN hosts get a narrow special case: a HEAD size pre-check
+// before committing to the download, a filename-extension fallback when the
+// declared type is the generic octet-stream, and a higher plain-text
+// extraction cap (FETCH_CDN_TEXT_CAP). Matching is EXACT by design — a
+// suffix match would let cdn.discordapp.com.evil.example into the relaxed
+// path.
+
+// discordCDNHosts are the attachment hosts the special case applies to.
+var discordCDNHosts = map[string]bool{
+	"cdn.discordapp.com":   true,
+	"media.discordapp.net": true,
+}
+
+// isDiscordCDNHost reports whether host is one of the known CDN domains
+// (exact match, case-insensitive).
+func isDiscordCDNHost(host string) bool {
+	return discordCDNHosts[strings.ToLower(host)]
+}
+
+// defaultCDNTextCap is the plain-text extraction cap for CDN attachments:
+// 4x the general maxExtractedLength, because the attachment use case is
+// "read this log file", where a 50KB truncation usually drops exactly the
+// part the user asked about.
+const defaultCDNTextCap = 4 * maxExtractedLength
+
+// cdnTextCap is process-wide, set from env in main() like the site rules.
+var cdnTextCap = defaultCDNTextCap
+
+// cdnTextCapFromEnv reads the FETCH_CDN_TEXT_CAP override (bytes). Fail-safe:
+// anything outside 1..maxContentLength keeps the default with a warning.
+func cdnTextCapFromEnv() int {
+	raw := strings.TrimSpace(os.Getenv("FETCH_CDN_TEXT_CAP"))
+	if raw == "" {
+		return defaultCDNTextCap
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 || n > maxContentLength {
+		log.Printf("⚠️ Invalid FETCH_CDN_TEXT_CAP %q (must be 1..%d) — using default %d", raw, maxContentLength, defaultCDNTextCap)
+		return defaultCDNTextCap
+	}
+	return n
+}
+
+// cdnContentTypesByExt maps attachment filename extensions to the type the
+// pipeline should assume when the CDN declares only the generic octet-stream.
+var cdnContentTypesByExt = map[string]string{
+	".txt":  "text/plain",
+	".log":  "text/plain",
+	".md":   "text/plain",
+	".json": "application/json",
+	".html": "text/html",
+	".htm":  "text/html",
+}
+
+// cdnInferContentType returns the content type fetchOnce routes on for a CDN
+// attachment: the declared header when it is specific, otherwise the type
+// implied by the filename extension. Unknown extensions keep the header.
+func cdnInferContentType(header, urlPath string) string {
+	primary := strings.ToLower(strings.TrimSpace(strings.SplitN(header, ";", 2)[0]))
+	if primary != "" && primary != "application/octet-stream" {
+		return header
+	}
+	if inferred, ok := cdnContentTypesByExt[strings.ToLower(path.Ext(urlPath))]; ok {
+		return inferred
+	}
+	return header
+}
+
+// cdnPrecheckSize HEADs a CDN attachment so an over-cap Content-Length is
+// rejected before any body bytes move. HEAD failures and absent lengths
+// return 0 — the GET's own read cap still bounds the download, so the
+// pre-check only ever saves work, never gates the fetch.
+func (f *Fetcher) cdnPrecheckSize(ctx context.Context, rawURL string) int64 {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+	if err != nil {
+		return 0
+	}
+	applyFetchHeaders(req.Header, ruleForHost(req.URL.Hostname()).BrowserLike)
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return 0
+	}
+	_ = resp.Body.Close()
+	if resp.ContentLength > 0 {
+		return resp.ContentLength
 	}
+	return 0
 }
 
-// Fetch retrieves content from a URL
-func (f *Fetcher) Fetch(ctx context.Context, rawURL string) FetchResult {
-	start := time.Now()
+func (f *Fetcher) fetchOnce(ctx context.Context, rawURL, level string) FetchResult {
+	start := f.clock.Now()
 	result := FetchResult{URL: rawURL}
 
+	// Phase marks for result.PhaseMs: each call closes the phase that began at
+	// the previous mark. Only recorded once the fetch is really going to
+	// happen — SSRF blocks and pre-fetch aborts have nothing to break down.
+	mark := start
+	phase := func(name string) {
+		now := f.clock.Now()
+		if result.PhaseMs == nil {
+			result.PhaseMs = make(map[string]int64, 4)
+		}
+		result.PhaseMs[name] = now.Sub(mark).Milliseconds()
+		mark = now
+	}
+
 	// SSRF Protection: Block private/internal IPs. Pass ctx so the pre-check
 	// DNS lookup honors the request deadline/cancellation.
-	if isPrivate, err := isPrivateURL(ctx, rawURL); isPrivate {
+	if isPrivate, err := isPrivateURL(ctx, f.resolver, rawURL); isPrivate {
 		errMsg := "SSRF blocked: URL resolves to private/internal address"
 		if err != nil {
 			errMsg = fmt.Sprintf("SSRF blocked: %v", err)
 		}
+		if errors.Is(err, errMixedResolution) {
+			result.ErrorCode = "mixed_resolution"
+		}
 		result.Error = errMsg
-		result.FetchTimeMs = time.Since(start).Milliseconds()
+		result.FetchTimeMs = f.clock.Now().Sub(start).Milliseconds()
 		log.Printf("⚠️ SSRF blocked: %s", rawURL)
 		return result
 	}
@@ -341,42 +2163,71 @@ func (f *Fetcher) Fetch(ctx context.Context, rawURL string) FetchResult {
 	// cancellation/deadline, not a rate-limit condition — labeling every
 	// failure "rate limited" hid real timeouts/cancellations. Surface the
 	// actual cause.
+	limiterStart := f.clock.Now()
 	if err := f.limiter.Wait(ctx); err != nil {
 		result.Error = fmt.Sprintf("aborted before fetch (timeout/cancelled): %v", err)
-		result.FetchTimeMs = time.Since(start).Milliseconds()
+		result.FetchTimeMs = f.clock.Now().Sub(start).Milliseconds()
 		return result
 	}
+	// Feed the saturation signal (see selfreport.go) with how long this
+	// fetch queued behind the limiter.
+	f.health.noteLimiterWait(f.clock.Now().Sub(limiterStart))
 
 	// Create request
 	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
 	if err != nil {
 		result.Error = fmt.Sprintf("invalid URL: %v", err)
-		result.FetchTimeMs = time.Since(start).Milliseconds()
+		result.FetchTimeMs = f.clock.Now().Sub(start).Milliseconds()
 		return result
 	}
 
-	// Set headers
-	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; DiscordBot/1.0)")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.5")
+	// Set headers (re-applied on every redirect hop by checkRedirect)
+	applyFetchHeaders(req.Header, ruleForHost(req.URL.Hostname()).BrowserLike)
+
+	// Discord CDN attachments declare reliable sizes: reject an over-cap
+	// Content-Length via HEAD before downloading a byte (see the CDN section).
+	isCDN := isDiscordCDNHost(req.URL.Hostname())
+	if isCDN {
+		if size := f.cdnPrecheckSize(ctx, rawURL); size > maxContentLength {
+			result.Error = fmt.Sprintf("attachment too large: Content-Length %d exceeds %d", size, maxContentLength)
+			result.ErrorCode = "too_large"
+			result.FetchTimeMs = f.clock.Now().Sub(start).Milliseconds()
+			return result
+		}
+	}
 
 	// Execute request
+	phase("precheck")
 	resp, err := f.client.Do(req)
+	phase("request")
 	if err != nil {
+		// The dial-time guard can also hit a mixed answer set (DNS changed
+		// between pre-check and dial); surface the same stable code.
+		if errors.Is(err, errMixedResolution) {
+			result.ErrorCode = "mixed_resolution"
+		}
 		result.Error = fmt.Sprintf("fetch error: %v", err)
-		result.FetchTimeMs = time.Since(start).Milliseconds()
+		result.FetchTimeMs = f.clock.Now().Sub(start).Milliseconds()
 		return result
 	}
 	defer func() { _ = resp.Body.Close() }()
 
 	result.StatusCode = resp.StatusCode
 	result.ContentType = resp.Header.Get("Content-Type")
+	if isCDN {
+		// The CDN's generic octet-stream says nothing; the attachment's
+		// filename extension usually does. Final response URL, so the name
+		// survives redirects.
+		result.ContentType = cdnInferContentType(result.ContentType, resp.Request.URL.Path)
+	}
+	result.etag = resp.Header.Get("ETag")
+	result.lastModified = resp.Header.Get("Last-Modified")
 
 	if resp.StatusCode != http.StatusOK {
 		// Drain body to allow TCP connection reuse
 		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
 		result.Error = fmt.Sprintf("HTTP %d", resp.StatusCode)
-		result.FetchTimeMs = time.Since(start).Milliseconds()
+		result.FetchTimeMs = f.clock.Now().Sub(start).Milliseconds()
 		return result
 	}
 
@@ -385,12 +2236,27 @@ func (f *Fetcher) Fetch(ctx context.Context, rawURL string) FetchResult {
 
 	// Read raw body first to avoid consuming bytes on charset detection failure
 	rawBody, err := io.ReadAll(limitedReader)
+	if err != nil {
+		// Mid-body connection death with partial bytes buffered: one
+		// Range-request resumption attempt before giving up (the resume
+		// request goes through f.client, so the dial-time SSRF guard and
+		// redirect budget apply to it like any other request).
+		if stitched, ok := tryResumeBody(ctx, f.client, rawURL, resp, rawBody); ok {
+			rawBody, err = stitched, nil
+			result.Resumed = true
+		}
+	}
+	phase("read")
 	if err != nil {
 		result.Error = fmt.Sprintf("read error: %v", err)
-		result.FetchTimeMs = time.Since(start).Milliseconds()
+		result.FetchTimeMs = f.clock.Now().Sub(start).Milliseconds()
 		return result
 	}
 
+	// Bytes as they came off the wire (pre-transcode) — what "downloaded" means.
+	result.BytesDownloaded = int64(len(rawBody))
+	usage := &ResourceUsage{Source: resourceSourceNetwork, WireBytes: int64(len(rawBody))}
+
 	// Handle charset conversion
 	body := rawBody
 	utf8Reader, err := charset.NewReader(bytes.NewReader(rawBody), result.ContentType)
@@ -418,25 +2284,62 @@ func (f *Fetcher) Fetch(ctx context.Context, rawURL string) FetchResult {
 	// "application/x-text/html-evil" route as HTML; comparing the trimmed,
 	// lowercased primary type closes that and matches the Python implementation.
 	primary := strings.ToLower(strings.TrimSpace(strings.SplitN(result.ContentType, ";", 2)[0]))
+	result.ExtractionLevel = level
+	usage.DecompressedBytes = int64(len(body))
+	// CDN attachments get the raised text cap — "read this log file" is the
+	// whole point of fetching one.
+	textCap := maxExtractedLength
+	if isCDN {
+		textCap = cdnTextCap
+	}
+	parseStart := f.clock.Now()
 	switch primary {
 	case "text/html":
-		title, description, content := extractHTMLContent(body)
-		result.Title = truncateString(title, 500)
-		result.Description = truncateString(description, 2000)
-		result.Content = truncateString(content, maxExtractedLength)
+		ex := extractHTML(body, level)
+		result.Title = truncateString(ex.Title, 500)
+		result.Description = truncateString(ex.Description, 2000)
+		result.Content = truncateString(ex.Content, maxExtractedLength)
+		result.Language = ex.Language
+		// Trivial wrapper shells (single dominant iframe / JS location
+		// one-liner) yield an empty extraction; flag the real target for the
+		// single follow-up hop in Fetch. Base is the FINAL response URL so
+		// relative targets resolve correctly after HTTP redirects.
+		if target := detectWrapperTarget(body, resp.Request.URL); target != "" {
+			result.wrapperTarget = target
+		}
 	case "text/plain":
-		result.Content = truncateString(string(body), maxExtractedLength)
+		result.Content = truncateString(string(body), textCap)
+	case "application/json":
+		// Only CDN attachments route JSON to text extraction (usually an
+		// exported config or log the user wants read back); elsewhere the
+		// historical binary placeholder stands.
+		if isCDN {
+			result.Content = truncateString(string(body), textCap)
+		} else {
+			result.Content = "[Binary content]"
+		}
 	default:
 		result.Content = "[Binary content]"
 	}
 
-	result.FetchTimeMs = time.Since(start).Milliseconds()
+	usage.ParseTimeMs = f.clock.Now().Sub(parseStart).Milliseconds()
+
+	phase("process")
+	result.FetchTimeMs = f.clock.Now().Sub(start).Milliseconds()
+	usage.WallTimeMs = result.FetchTimeMs
+	result.Resources = usage
 	return result
 }
 
 // FetchBatch fetches multiple URLs concurrently
 func (f *Fetcher) FetchBatch(ctx context.Context, urls []string) FetchResponse {
-	start := time.Now()
+	return f.FetchBatchWithLevel(ctx, urls, levelStandard)
+}
+
+// FetchBatchWithLevel is FetchBatch with an explicit extraction level applied
+// to every URL in the batch.
+func (f *Fetcher) FetchBatchWithLevel(ctx context.Context, urls []string, level string) FetchResponse {
+	start := f.clock.Now()
 	response := FetchResponse{
 		Results: make([]FetchResult, len(urls)),
 	}
@@ -460,7 +2363,7 @@ func (f *Fetcher) FetchBatch(ctx context.Context, urls []string) FetchResponse {
 					response.Results[idx] = FetchResult{
 						URL:         u,
 						Error:       fmt.Sprintf("panic during fetch: %v", rec),
-						FetchTimeMs: time.Since(start).Milliseconds(),
+						FetchTimeMs: f.clock.Now().Sub(start).Milliseconds(),
 					}
 				}
 			}()
@@ -471,14 +2374,14 @@ func (f *Fetcher) FetchBatch(ctx context.Context, urls []string) FetchResponse {
 				response.Results[idx] = FetchResult{
 					URL:         u,
 					Error:       "context cancelled",
-					FetchTimeMs: time.Since(start).Milliseconds(),
+					FetchTimeMs: f.clock.Now().Sub(start).Milliseconds(),
 				}
 				return
 			case semaphore <- struct{}{}:
 				defer func() { <-semaphore }()
 			}
 
-			response.Results[idx] = f.Fetch(ctx, u)
+			response.Results[idx] = f.FetchWithLevel(ctx, u, level)
 		}(i, url)
 	}
 
@@ -492,38 +2395,446 @@ func (f *Fetcher) FetchBatch(ctx context.Context, urls []string) FetchResponse {
 	}()
 	<-done
 
-	// Count results (safe: all writers have returned).
+	// Count results and collect the summary inputs (safe: all writers have
+	// returned). For a batch of one the percentile stats all collapse to the
+	// single result's values, so the summary simply mirrors it.
+	var fetchTimes, byteCounts []int64
+	var totals ResourceUsage
+	var sawUsage bool
+	errorCounts := make(map[string]int)
 	for _, r := range response.Results {
 		if r.Error == "" {
 			response.SuccessCount++
+			fetchTimes = append(fetchTimes, r.FetchTimeMs)
+			byteCounts = append(byteCounts, r.BytesDownloaded)
 		} else {
 			response.ErrorCount++
+			errorCounts[classifyFetchError(r.Error)]++
 		}
+		if r.Resources != nil {
+			sawUsage = true
+			totals.WallTimeMs += r.Resources.WallTimeMs
+			totals.WireBytes += r.Resources.WireBytes
+			totals.DecompressedBytes += r.Resources.DecompressedBytes
+			totals.ParseTimeMs += r.Resources.ParseTimeMs
+		}
+	}
+	if sawUsage {
+		response.ResourceTotals = &totals
 	}
+	summary := &TimingSummary{
+		FetchTimeMs: summarizeInt64(fetchTimes),
+		Bytes:       summarizeInt64(byteCounts),
+	}
+	if len(errorCounts) > 0 {
+		summary.ErrorCounts = errorCounts
+	}
+	response.TimingSummary = summary
 
-	response.TotalTimeMs = time.Since(start).Milliseconds()
+	response.TotalTimeMs = f.clock.Now().Sub(start).Milliseconds()
 	return response
 }
 
-// extractHTMLContent extracts meaningful content from HTML
-func extractHTMLContent(body []byte) (title, description, content string) {
+// --- dead-letter capture of invalid batch items ------------------------------
+//
+// /fetch/batch used to 400 the whole request when ANY URL failed validation,
+// and the Python side just dropped the rejected batch. Mixed batches now get
+// per-item validation_failed results while the valid items proceed, and the
+// rejected raw inputs land in a bounded ring buffer for inspection at
+// GET /fetch/deadletter — token-gated like the other debug surfaces, with
+// query/fragment/userinfo redacted and the stored string truncated (rejects
+// are attacker-shaped input by definition). A strict:true request flag
+// restores the historical all-or-nothing 400.
+
+const (
+	// defaultDeadLetterCap bounds the ring buffer; FETCH_DEADLETTER_CAP
+	// overrides it.
+	defaultDeadLetterCap = 100
+	// deadLetterMaxStoredRunes truncates stored inputs — an oversized reject
+	// (the url_too_long case is 8KB+ by definition) must not pin kilobytes
+	// in the ring until eviction.
+	deadLetterMaxStoredRunes = 200
+)
+
+// Stable per-item validation reasons, mirroring the /fetch pre-checks.
+const (
+	validationReasonEmpty   = "empty_url"
+	validationReasonTooLong = "url_too_long"
+	validationReasonScheme  = "invalid_scheme"
+)
+
+// validationFailedCode is the FetchResult.ErrorCode for items rejected before
+// the fetch pipeline ever saw them.
+const validationFailedCode = "validation_failed"
+
+// validateBatchURL runs the same pre-checks /fetch applies to its url query
+// parameter; "" means the URL may proceed to the fetch pipeline (which still
+// runs the full SSRF vetting on it).
+func validateBatchURL(u string) string {
+	if strings.TrimSpace(u) == "" {
+		return validationReasonEmpty
+	}
+	if len(u) > 8192 {
+		return validationReasonTooLong
+	}
+	if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		return validationReasonScheme
+	}
+	return ""
+}
+
+// strictValidationMessage maps a reason to the historical all-or-nothing 400
+// body, so strict mode keeps the exact messages existing callers match on.
+func strictValidationMessage(reason string) string {
+	switch reason {
+	case validationReasonTooLong:
+		return "url too long (max 8192 bytes)"
+	default:
+		return "all URLs must use http or https scheme"
+	}
+}
+
+// deadLetterEntry is one retained reject.
+type deadLetterEntry struct {
+	URL    string `json:"url"` // redacted and truncated — see deadLetterRing.add
+	Reason string `json:"reason"`
+	At     string `json:"at"`
+}
+
+// deadLetterRing retains the most recent rejects up to a fixed capacity,
+// evicting oldest-first. dropped counts evictions so the inspection endpoint
+// can say how much history it lost.
+type deadLetterRing struct {
+	mu      sync.Mutex
+	entries []deadLetterEntry
+	cap     int
+	dropped uint64
+	clock   Clock
+}
+
+func newDeadLetterRing(capacity int, clock Clock) *deadLetterRing {
+	return &deadLetterRing{cap: capacity, clock: clock}
+}
+
+// add records one reject. The stored URL goes through the same redaction as
+// the slow-fetch log (query/fragment/userinfo stripped) and is then rune-
+// truncated; empty input stores an "(empty)" marker.
+func (d *deadLetterRing) add(rawURL, reason string) {
+	stored := redactFetchURL(rawURL)
+	if stored == "" {
+		stored = "(empty)"
+	}
+	if runes := []rune(stored); len(runes) > deadLetterMaxStoredRunes {
+		stored = string(runes[:deadLetterMaxStoredRunes])
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries = append(d.entries, deadLetterEntry{
+		URL:    stored,
+		Reason: reason,
+		At:     d.clock.Now().UTC().Format(rfc3339Milli),
+	})
+	if len(d.entries) > d.cap {
+		over := len(d.entries) - d.cap
+		d.entries = append(d.entries[:0:0], d.entries[over:]...)
+		d.dropped += uint64(over)
+	}
+}
+
+// snapshot returns the retained entries (oldest first) and the eviction count.
+func (d *deadLetterRing) snapshot() ([]deadLetterEntry, uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]deadLetterEntry, len(d.entries))
+	copy(out, d.entries)
+	return out, d.dropped
+}
+
+// deadLetterCapFromEnv reads the FETCH_DEADLETTER_CAP override with the usual
+// fail-safe posture.
+func deadLetterCapFromEnv() int {
+	raw := strings.TrimSpace(os.Getenv("FETCH_DEADLETTER_CAP"))
+	if raw == "" {
+		return defaultDeadLetterCap
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("WARNING: invalid FETCH_DEADLETTER_CAP %q (must be a positive integer) — using default %d", raw, defaultDeadLetterCap)
+		return defaultDeadLetterCap
+	}
+	return n
+}
+
+// handleDeadLetters serves GET /fetch/deadletter (debug group).
+func (f *Fetcher) handleDeadLetters(w http.ResponseWriter, _ *http.Request) {
+	entries, dropped := f.deadLetters.snapshot()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"entries": entries,
+		"dropped": dropped,
+	}); err != nil {
+		log.Printf("Failed to encode dead-letter response: %v", err)
+	}
+}
+
+// fetchMixedBatch runs a batch whose items at the invalid indices (index →
+// stable reason) were rejected by validation: the remaining URLs go through
+// the normal concurrent pipeline, the rejects become per-item
+// validation_failed results at their original positions, and each reject is
+// retained in the dead-letter ring. The response counters and error summary
+// cover both populations.
+func (f *Fetcher) fetchMixedBatch(ctx context.Context, urls []string, level string, invalid map[int]string) FetchResponse {
+	if len(invalid) == 0 {
+		return f.FetchBatchWithLevel(ctx, urls, level)
+	}
+
+	valid := make([]string, 0, len(urls)-len(invalid))
+	for i, u := range urls {
+		if _, rejected := invalid[i]; !rejected {
+			valid = append(valid, u)
+		}
+	}
+	fetched := f.FetchBatchWithLevel(ctx, valid, level)
+
+	response := FetchResponse{
+		Results:        make([]FetchResult, len(urls)),
+		TotalTimeMs:    fetched.TotalTimeMs,
+		SuccessCount:   fetched.SuccessCount,
+		ErrorCount:     fetched.ErrorCount + len(invalid),
+		TimingSummary:  fetched.TimingSummary,
+		ResourceTotals: fetched.ResourceTotals,
+	}
+	next := 0
+	for i, u := range urls {
+		if reason, rejected := invalid[i]; rejected {
+			f.deadLetters.add(u, reason)
+			response.Results[i] = FetchResult{
+				URL:       u,
+				Error:     fmt.Sprintf("validation failed: %s", reason),
+				ErrorCode: validationFailedCode,
+			}
+			continue
+		}
+		response.Results[i] = fetched.Results[next]
+		next++
+	}
+	// Fold the rejects into the error summary under their own category so
+	// the Python side sees them alongside the fetch-time failures.
+	if response.TimingSummary != nil {
+		if response.TimingSummary.ErrorCounts == nil {
+			response.TimingSummary.ErrorCounts = make(map[string]int)
+		}
+		response.TimingSummary.ErrorCounts[validationFailedCode] += len(invalid)
+	}
+	return response
+}
+
+// --- wrapper page detection --------------------------------------------------
+//
+// Link shorteners and some forums serve a full-page wrapper — a single
+// dominant <iframe src=...> or a JS location one-liner — and we used to
+// extract the empty shell. detectWrapperTarget spots ONLY those two trivial
+// shapes; anything with real visible content, several frames, or non-trivial
+// script is left alone (a heuristic that guesses harder would start following
+// links the page never intended as its canonical target). The follow itself
+// happens in Fetch: exactly one hop, through the full SSRF/policy chain
+// (fetchOnce re-runs the pre-check and the dial-time guard on the target, and
+// the target's own HTTP redirects spend the normal checkRedirect budget).
+
+const (
+	// wrapperMaxVisibleRunes: a wrapper shell has at most a stray "click here
+	// if you are not redirected" — real articles blow far past this.
+	wrapperMaxVisibleRunes = 120
+	// wrapperMaxDocBytes bounds the JS-redirect shape: the one-liner wrappers
+	// are a few hundred bytes; running a redirect regex over a full app bundle
+	// would invite false positives.
+	wrapperMaxDocBytes = 4096
+)
+
+// jsRedirectRe matches the two trivially parseable redirect forms:
+// location.replace("...") and location.href = "..." (optionally via window.).
+var jsRedirectRe = regexp.MustCompile(
+	`(?:window\.)?location(?:\.replace\(\s*["']([^"']+)["']\s*\)|\.href\s*=\s*["']([^"']+)["'])`)
+
+// detectWrapperTarget returns the absolute http(s) target of a trivial
+// wrapper page, or "" when the page isn't one. base is the final URL the
+// document was served from (relative targets resolve against it).
+func detectWrapperTarget(body []byte, base *url.URL) string {
+	if base == nil {
+		return ""
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	// Visible text, measured the way extraction sees it (scripts/styles and
+	// chrome removed). This is what separates a wrapper shell from a real
+	// page that merely embeds an iframe.
+	textDoc := doc.Clone()
+	textDoc.Find("script, style, nav, footer, header, aside, iframe, noscript").Remove()
+	visible := []rune(strings.Join(strings.Fields(textDoc.Find("body").Text()), " "))
+	if len(visible) > wrapperMaxVisibleRunes {
+		return ""
+	}
+
+	// Shape 1: exactly one iframe dominating an otherwise empty page.
+	iframes := doc.Find("iframe")
+	if iframes.Length() == 1 {
+		if src, ok := iframes.Attr("src"); ok {
+			return resolveWrapperTarget(base, src)
+		}
+		return ""
+	}
+	if iframes.Length() > 1 {
+		return ""
+	}
+
+	// Shape 2: a tiny document whose script is a location one-liner.
+	if len(body) > wrapperMaxDocBytes {
+		return ""
+	}
+	if m := jsRedirectRe.FindSubmatch(body); m != nil {
+		target := string(m[1])
+		if target == "" {
+			target = string(m[2])
+		}
+		return resolveWrapperTarget(base, target)
+	}
+	return ""
+}
+
+// resolveWrapperTarget resolves raw against base and applies the same surface
+// checks the /fetch handlers apply to caller-supplied URLs (scheme, length,
+// and never "follow" to the page itself). The SSRF chain runs later, inside
+// the follow-up fetchOnce.
+func resolveWrapperTarget(base *url.URL, raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+	u, err := base.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	target := u.String()
+	if len(target) > 8192 || target == base.String() {
+		return ""
+	}
+	return target
+}
+
+// --- extraction levels ------------------------------------------------------
+//
+// Interactive fetches want a fast answer; background indexing wants the best
+// extraction. The level picks which pipeline stages run on an HTML body:
+//
+//	fast      — metadata only (title, meta description, OG tags); the body
+//	            walk is skipped entirely.
+//	standard  — the historical behavior: metadata plus the selector-guided
+//	            paragraph walk.
+//	thorough  — readability-scored main-content selection, JSON-LD metadata
+//	            fill, tables, language detection, markdown-shaped output.
+//
+// The level applied is echoed in FetchResult.ExtractionLevel, and a cached
+// result satisfies a request when its level is at least as rich as the one
+// asked for (see fetchCached).
+
+const (
+	levelFast     = "fast"
+	levelStandard = "standard"
+	levelThorough = "thorough"
+)
+
+// levelRank orders levels by extraction richness. The empty string (results
+// cached before levels existed, and callers that never ask) ranks as standard.
+func levelRank(level string) int {
+	switch level {
+	case levelFast:
+		return 0
+	case levelThorough:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// normalizeExtractionLevel maps a request's level parameter onto a known
+// level; empty means the interactive default (standard). Unknown levels are
+// the caller's error, reported as ok=false rather than silently downgraded.
+func normalizeExtractionLevel(raw string) (string, bool) {
+	switch raw {
+	case "":
+		return levelStandard, true
+	case levelFast, levelStandard, levelThorough:
+		return raw, true
+	}
+	return "", false
+}
+
+// extraction is the output of one HTML extraction pass.
+type extraction struct {
+	Title       string
+	Description string
+	Content     string
+	// Language is only detected at the thorough level (BCP-47 primary
+	// subtag, e.g. "th"); empty elsewhere or when detection is unsure.
+	Language string
+}
+
+// extractHTML runs the level-gated extraction pipeline over an HTML body.
+func extractHTML(body []byte, level string) extraction {
+	var ex extraction
 	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
 	if err != nil {
-		return "", "", string(body)
+		ex.Content = string(body)
+		return ex
 	}
 
-	// Extract title
-	title = strings.TrimSpace(doc.Find("title").First().Text())
+	extractMeta(doc, &ex)
+	if level == levelFast {
+		return ex
+	}
 
-	// Extract meta description
-	description, _ = doc.Find(`meta[name="description"]`).Attr("content")
-	if description == "" {
-		description, _ = doc.Find(`meta[property="og:description"]`).Attr("content")
+	if level == levelThorough {
+		// JSON-LD must be read BEFORE the element purge below — it lives in
+		// a <script> tag the purge removes.
+		extractJSONLD(doc, &ex)
 	}
 
 	// Remove unwanted elements
 	doc.Find("script, style, nav, footer, header, aside, iframe, noscript").Remove()
 
+	if level == levelThorough {
+		extractThoroughBody(doc, &ex)
+		ex.Language = detectLanguage(doc, ex.Content)
+		return ex
+	}
+	extractStandardBody(doc, &ex)
+	return ex
+}
+
+// extractMeta is the stage every level runs: title (with og:title fallback)
+// and meta/OG description.
+func extractMeta(doc *goquery.Document, ex *extraction) {
+	ex.Title = strings.TrimSpace(doc.Find("title").First().Text())
+	if ex.Title == "" {
+		ex.Title, _ = doc.Find(`meta[property="og:title"]`).Attr("content")
+		ex.Title = strings.TrimSpace(ex.Title)
+	}
+
+	ex.Description, _ = doc.Find(`meta[name="description"]`).Attr("content")
+	if ex.Description == "" {
+		ex.Description, _ = doc.Find(`meta[property="og:description"]`).Attr("content")
+	}
+}
+
+// extractStandardBody is the historical body walk: first matching content
+// selector wins, paragraph-level text join, full-text fallback when short.
+func extractStandardBody(doc *goquery.Document, ex *extraction) {
 	// Extract main content
 	var contentBuilder strings.Builder
 
@@ -552,7 +2863,7 @@ func extractHTMLContent(body []byte) (title, description, content string) {
 		}
 	})
 
-	content = strings.TrimSpace(contentBuilder.String())
+	content := strings.TrimSpace(contentBuilder.String())
 
 	// Fallback to all text if content is too short
 	if len(content) < 100 {
@@ -560,9 +2871,171 @@ func extractHTMLContent(body []byte) (title, description, content string) {
 	}
 
 	// Clean up whitespace
-	content = cleanWhitespace(content)
+	ex.Content = cleanWhitespace(content)
+}
+
+// extractHTMLContent extracts meaningful content from HTML at the standard
+// level. Kept as the three-value seam the charset/truncation tests pin.
+func extractHTMLContent(body []byte) (title, description, content string) {
+	ex := extractHTML(body, levelStandard)
+	return ex.Title, ex.Description, ex.Content
+}
+
+// extractJSONLD fills still-empty metadata from the first JSON-LD block that
+// carries a headline/description. Schema.org embeds are how news sites and
+// blogs publish their canonical metadata; only top-level string fields are
+// read — the format nests arbitrarily and anything deeper isn't worth the
+// parse on attacker-controlled input.
+func extractJSONLD(doc *goquery.Document, ex *extraction) {
+	doc.Find(`script[type="application/ld+json"]`).EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		var payload map[string]any
+		if err := json.Unmarshal([]byte(s.Text()), &payload); err != nil {
+			return true // malformed block: try the next one
+		}
+		if ex.Title == "" {
+			if headline, ok := payload["headline"].(string); ok {
+				ex.Title = strings.TrimSpace(headline)
+			}
+		}
+		if ex.Description == "" {
+			if desc, ok := payload["description"].(string); ok {
+				ex.Description = strings.TrimSpace(desc)
+			}
+		}
+		return ex.Title == "" || ex.Description == ""
+	})
+}
+
+// maxReadabilityCandidates bounds the container-scoring walk — a hostile page
+// with tens of thousands of nested divs must not turn scoring quadratic.
+const maxReadabilityCandidates = 250
+
+// bestReadabilityCandidate picks the container to extract from by scoring
+// text density instead of trusting the first matching selector: paragraph
+// text length plus a bonus per comma (prose punctuation), discounted by link
+// density so nav-heavy link farms lose to the actual article.
+func bestReadabilityCandidate(doc *goquery.Document) *goquery.Selection {
+	best := doc.Find("body")
+	bestScore := readabilityScore(best)
+	doc.Find("article, main, section, div").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		if score := readabilityScore(s); score > bestScore {
+			best, bestScore = s, score
+		}
+		return i < maxReadabilityCandidates
+	})
+	return best
+}
+
+func readabilityScore(s *goquery.Selection) float64 {
+	text := s.Find("p").Text()
+	score := float64(len(text)) + 15*float64(strings.Count(text, ","))
+	if total := len(s.Text()); total > 0 {
+		score *= 1 - float64(len(s.Find("a").Text()))/float64(total)
+	}
+	return score
+}
+
+// extractThoroughBody renders the best-scoring container as markdown-shaped
+// text: #-prefixed headings, "-" list items, pipe-delimited table rows. The
+// shape survives cleanWhitespace and gives the RAG indexer structure to
+// chunk on, where the standard walk flattens everything to paragraphs.
+func extractThoroughBody(doc *goquery.Document, ex *extraction) {
+	root := bestReadabilityCandidate(doc)
+
+	var b strings.Builder
+	root.Find("h1, h2, h3, h4, h5, h6, p, li, table").Each(func(_ int, s *goquery.Selection) {
+		switch name := goquery.NodeName(s); name {
+		case "h1", "h2", "h3", "h4", "h5", "h6":
+			if text := strings.TrimSpace(s.Text()); text != "" {
+				b.WriteString(strings.Repeat("#", int(name[1]-'0')) + " " + text + "\n\n")
+			}
+		case "li":
+			// Joined fields so a multi-line item stays one bullet.
+			if text := strings.Join(strings.Fields(s.Text()), " "); text != "" {
+				b.WriteString("- " + text + "\n\n")
+			}
+		case "table":
+			writeTableMarkdown(&b, s)
+		default: // p
+			if text := strings.TrimSpace(s.Text()); text != "" {
+				b.WriteString(text + "\n\n")
+			}
+		}
+	})
+
+	content := strings.TrimSpace(b.String())
+	if len(content) < 100 {
+		content = strings.TrimSpace(root.Text())
+	}
+	ex.Content = cleanWhitespace(content)
+}
+
+// writeTableMarkdown renders one <table> as pipe-delimited rows, with the
+// markdown separator after a header row.
+func writeTableMarkdown(b *strings.Builder, table *goquery.Selection) {
+	table.Find("tr").Each(func(i int, row *goquery.Selection) {
+		var cells []string
+		row.Find("th, td").Each(func(_ int, cell *goquery.Selection) {
+			cells = append(cells, strings.Join(strings.Fields(cell.Text()), " "))
+		})
+		if len(cells) == 0 {
+			return
+		}
+		b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		if i == 0 && row.Find("th").Length() > 0 {
+			b.WriteString("|" + strings.Repeat(" --- |", len(cells)) + "\n")
+		}
+	})
+	b.WriteString("\n")
+}
+
+// detectLanguage reports the document language: the html lang attribute when
+// the author declared one (primary subtag only), else a dominant-script
+// heuristic over the extracted text. Deliberately coarse — the bot only needs
+// to route Thai/CJK/Latin content differently, not full language ID.
+func detectLanguage(doc *goquery.Document, content string) string {
+	if lang, ok := doc.Find("html").Attr("lang"); ok {
+		if primary, _, _ := strings.Cut(strings.TrimSpace(lang), "-"); primary != "" {
+			return strings.ToLower(primary)
+		}
+	}
 
-	return title, description, content
+	var thai, han, kana, hangul, latin, letters int
+	for _, r := range content {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Thai, r):
+			thai++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+	// Kana outranks Han: Japanese text mixes both, Chinese has no kana.
+	switch {
+	case kana*10 > letters:
+		return "ja"
+	case thai*2 > letters:
+		return "th"
+	case han*2 > letters:
+		return "zh"
+	case hangul*2 > letters:
+		return "ko"
+	case latin*2 > letters:
+		return "en"
+	}
+	return ""
 }
 
 // cleanWhitespace normalizes whitespace in text
@@ -601,18 +3074,167 @@ func truncateString(s string, maxLen int) string {
 	return string(runes[:maxLen]) + "..."
 }
 
-func main() {
+// resolvePort reads the configured listener port. Shared between server
+// startup and the -healthcheck client mode so both agree on the address.
+func resolvePort() string {
 	port := os.Getenv("URL_FETCHER_PORT")
 	if port == "" {
 		port = defaultPort
 	}
+	return port
+}
+
+// probeHealth is the Docker HEALTHCHECK client: GET <baseURL>/health and
+// return nil only on 200. Distroless images ship no curl/wget, so the binary
+// itself doubles as the probe client when run with -healthcheck.
+func probeHealth(baseURL string, timeout time.Duration) error {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(baseURL + "/health")
+	if err != nil {
+		return fmt.Errorf("probe failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusOK {
+		// Surface the body: /health's 503 during shutdown says so, and that
+		// wording in `docker inspect` beats a bare status code.
+		return fmt.Errorf("not healthy: HTTP %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// EnvHelp is the environment-variable contract printed by -h. The flag set
+// itself stays small on purpose: configuration is env-first so the Docker and
+// systemd deployments read the same knobs.
+const EnvHelp = `Environment:
+  URL_FETCHER_PORT        listen port on 127.0.0.1 (default ` + defaultPort + `)
+  FETCH_RATE_LIMIT        pin the outbound rate (rps) and disable AIMD adaptation
+  FETCH_DEBUG_TOKEN       bearer token for the /fetch/slow and /fetch/deadletter debug routes
+  FETCH_PREWARM_TOKEN     bearer token for the /fetch/prewarm routes
+  FETCH_DEADLETTER_CAP    dead-letter ring size
+  FETCH_CDN_TEXT_CAP      raised extraction cap for Discord CDN attachments (bytes)
+  BROWSER_LIKE_HOSTS      hosts that get browser-like fingerprint headers
+  SSRF_MIXED_RESOLUTION   policy for mixed public/private DNS answers (block|allow)
+  FETCH_DENY_HOSTS        extra comma-separated entries for the host denylist
+  FETCH_ALLOW_HOSTS       comma-separated hostnames/CIDRs allowed to resolve to
+                          private address space (the denylist still wins)
+  MAX_INFLIGHT            load-shedding concurrency cap (MAX_INFLIGHT_WAIT_MS tunes the queue)
+  HEALTH_API_URL          push url_fetcher_* metrics to this health API base URL
+                          and self-register as service "url_fetcher" (unset:
+                          metrics stay on the local /metrics endpoint)
+  METRICS_PUSH_INTERVAL_SECONDS  push cadence (default 30)
+  HEALTH_API_TOKEN        bearer token for the metrics push
+  SHUTDOWN_DRAIN_SECONDS  delay between readiness flip and Shutdown (default 0)
+  SHUTDOWN_TIMEOUT_SECONDS  bound on the graceful drain (default 10)
+  BOT_VERSION             version string reported by /version and build_info
+  ENABLE_DOCS_UI          serve the Swagger UI page at /docs (default off)
+`
+
+// Run is the url-fetcher entrypoint, invoked by the discord-bot-services
+// binary's url-fetcher subcommand (and by the "all" mode alongside
+// health_api). args are the post-subcommand CLI arguments; signals, when
+// non-nil, replaces the real SIGINT/SIGTERM subscription so the combined
+// binary (and tests) can drive shutdown. It returns after a clean drain, or
+// with server.ErrForcedClose / the underlying serve error.
+func Run(args []string, signals <-chan os.Signal) error {
+	fs := flag.NewFlagSet("url-fetcher", flag.ContinueOnError)
+	healthcheckMode := fs.Bool("healthcheck", false,
+		"probe this service's /health and exit 0/1 instead of starting a server (for Docker HEALTHCHECK)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: discord-bot-services url-fetcher [flags]\n\nFlags:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(fs.Output(), "\n%s", EnvHelp)
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	port := resolvePort()
+
+	if *healthcheckMode {
+		// Client mode: 2-second budget end to end — well inside Docker's
+		// default 30s HEALTHCHECK timeout — then exit 0/1 so the container
+		// runtime can use the binary as its own probe client.
+		if err := probeHealth("http://127.0.0.1:"+port, 2*time.Second); err != nil {
+			fmt.Println(err)
+			return err
+		}
+		fmt.Println("OK")
+		return nil
+	}
+
+	// Hosts that want browser-like fingerprint headers (see applyFetchHeaders).
+	siteRules = siteRulesFromEnv()
+
+	// Mixed public/private DNS answer policy (see vetResolvedIPs).
+	strictMixedResolution = strictMixedFromEnv()
+
+	// Operator-extended host denylist (see denyhosts.go).
+	denyHosts = denyHostsFromEnv()
+	allowHosts = allowHostsFromEnv()
+
+	// Raised extraction cap for Discord CDN attachments (see the CDN section).
+	cdnTextCap = cdnTextCapFromEnv()
 
 	fetcher := NewFetcher()
 
+	// FETCH_RATE_LIMIT pins the outbound rate (rps) and disables the AIMD
+	// loop entirely — operator escape hatch when adaptation misbehaves or an
+	// upstream wants a contractual ceiling. Fail-safe: a non-positive or
+	// unparseable value is ignored with a warning rather than killing startup.
+	if v := os.Getenv("FETCH_RATE_LIMIT"); v != "" {
+		if pinned, err := strconv.ParseFloat(v, 64); err == nil && pinned > 0 {
+			fetcher.pinRate(pinned)
+			log.Printf("Outbound rate pinned to %.1f rps via FETCH_RATE_LIMIT (adaptation disabled)", pinned)
+		} else {
+			log.Printf("⚠️ Invalid FETCH_RATE_LIMIT %q (want positive number), using adaptive rate", v)
+		}
+	} else {
+		outboundRateGauge.Set(fetcher.controller.currentRate())
+		go func() {
+			ticker := fetcher.clock.NewTicker(aimdInterval)
+			defer ticker.Stop()
+			for range ticker.C() {
+				fetcher.adjustRate()
+			}
+		}()
+	}
+
+	// Metrics export: the local /metrics endpoint (see routes.go) is always
+	// there for scrapers; setting HEALTH_API_URL additionally pushes the
+	// url_fetcher_* series to the health API on an interval (see metrics.go).
+	pushCtx, pushCancel := context.WithCancel(context.Background())
+	defer pushCancel()
+	if pusher := metricsPusherFromEnv(prometheus.DefaultGatherer); pusher != nil {
+		log.Printf("Pushing metrics to %s every %v", pusher.target, pusher.interval)
+		go pusher.run(pushCtx)
+	}
+
+	// Self-registration with the health API (see selfreport.go): startup
+	// report, 30s cadence, final healthy=false when pushCtx is cancelled at
+	// shutdown begin.
+	if reporter := selfReporterFromEnv(fetcher); reporter != nil {
+		log.Printf("Registering with health API at %s every %v", reporter.target, reporter.interval)
+		go reporter.run(pushCtx)
+	}
+
+	// Deprecation policy shared with the health API (DEPRECATIONS env, see
+	// healthkit's deprecation framework); applied to the v1 fetch schema.
+	deprecations := healthkit.NewDeprecationSet(prometheus.DefaultRegisterer, "url_fetcher", nil,
+		healthkit.SunsetEnforcementFromEnv(), healthkit.DeprecationsFromEnv()...)
+
 	r := chi.NewRouter()
 
-	// Middleware
+	// Middleware. Per-route metrics go OUTERMOST — in particular before
+	// Timeout below — so a timed-out request is still attributed to its route
+	// with the status it actually got.
+	r.Use(healthkit.NewHTTPMetrics(prometheus.DefaultRegisterer, "url_fetcher").Middleware)
 	r.Use(middleware.Logger)
+	// Load shedding (MAX_INFLIGHT / MAX_INFLIGHT_WAIT_MS, shared env contract
+	// with the health API): excess requests queue briefly, then 503 with
+	// Retry-After instead of piling onto the 125s timeout below. /health
+	// bypasses so the poller keeps its answer during overload.
+	r.Use(healthkit.ConcurrencyLimiterFromEnv(prometheus.DefaultRegisterer, "url_fetcher", "/health").Middleware)
 	r.Use(middleware.Recoverer)
 	// 125s: must exceed the /fetch/batch handler's documented 120s cap — a
 	// child context can never outlive its parent, so a 60s value here
@@ -642,132 +3264,34 @@ func main() {
 		})
 	})
 
-	// Health check
-	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(map[string]string{"status": "healthy"}); err != nil {
-			log.Printf("Failed to encode health response: %v", err)
-		}
-	})
-
-	// Single URL fetch
-	r.Get("/fetch", func(w http.ResponseWriter, r *http.Request) {
-		url := r.URL.Query().Get("url")
-		if url == "" {
-			http.Error(w, "url parameter required", http.StatusBadRequest)
-			return
-		}
-
-		// Reject excessively long URLs to prevent memory/parser abuse
-		if len(url) > 8192 {
-			http.Error(w, "url too long (max 8192 bytes)", http.StatusBadRequest)
-			return
-		}
-
-		// Basic URL validation - must be http/https
-		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
-			http.Error(w, "url must use http or https scheme", http.StatusBadRequest)
-			return
-		}
-
-		result := fetcher.Fetch(r.Context(), url)
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(result); err != nil {
-			log.Printf("Failed to encode fetch response: %v", err)
-		}
-	})
-
-	// Batch URL fetch
-	r.Post("/fetch/batch", func(w http.ResponseWriter, r *http.Request) {
-		// Limit request body size to 1MB
-		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
-
-		var req FetchRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "invalid JSON", http.StatusBadRequest)
-			return
-		}
-
-		if len(req.URLs) == 0 {
-			http.Error(w, "urls required", http.StatusBadRequest)
-			return
-		}
-
-		if len(req.URLs) > 20 {
-			http.Error(w, "max 20 URLs per batch", http.StatusBadRequest)
-			return
-		}
-
-		// Validate all URLs use http/https
-		for _, u := range req.URLs {
-			if len(u) > 8192 {
-				http.Error(w, "url too long (max 8192 bytes)", http.StatusBadRequest)
-				return
-			}
-			if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
-				http.Error(w, "all URLs must use http or https scheme", http.StatusBadRequest)
-				return
-			}
-		}
-
-		ctx := r.Context()
-		if req.Timeout > 0 {
-			// Cap user-provided timeout to 120 seconds max
-			timeout := min(req.Timeout, 120)
-			var cancel context.CancelFunc
-			ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
-			defer cancel()
-		}
-
-		response := fetcher.FetchBatch(ctx, req.URLs)
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(response); err != nil {
-			log.Printf("Failed to encode batch response: %v", err)
-		}
-	})
-
-	// Server — bind to localhost to prevent unauthenticated external access
-	server := &http.Server{
-		Addr:              "127.0.0.1:" + port,
-		Handler:           r,
-		ReadTimeout:       15 * time.Second,
-		ReadHeaderTimeout: 5 * time.Second,
-		// Must exceed the 125s request-timeout middleware (and the batch
-		// handler's 120s cap) or the connection is cut before the
-		// handler's own deadline machinery can respond.
-		WriteTimeout: 130 * time.Second,
-		IdleTimeout:  60 * time.Second,
-	}
-
-	// Graceful shutdown. server.Shutdown closes the listener, which makes the
-	// blocking ListenAndServe below return http.ErrServerClosed immediately —
-	// but the in-flight connection drain keeps running here. main() must wait
-	// on idleConnsClosed before returning, otherwise the process exits the
-	// instant the listener closes and the drain (up to the 10s timeout) is cut
-	// short, killing in-flight /fetch and /fetch/batch responses mid-write.
-	idleConnsClosed := make(chan struct{})
-	go func() {
-		sigCh := make(chan os.Signal, 1)
-		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-		<-sigCh
-
-		log.Println("Shutting down...")
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		if err := server.Shutdown(ctx); err != nil {
-			log.Printf("Graceful shutdown failed: %v", err)
-		}
-		close(idleConnsClosed)
-	}()
-
+	// Build identity: stamp the join gauge once and answer /version with the
+	// same shape as the health API (see healthkit/buildinfo.go).
+	version := serviceVersionFromEnv()
+	build := healthkit.ResolveBuildInfo()
+	buildInfoGauge.WithLabelValues(version, build.GitCommit, build.GoVersion).Set(1)
+	// Route registrations live in registerRoutes (routes.go) so the OpenAPI
+	// conformance test can walk the identical route set on a bare router;
+	// the middleware stack stays here, where its registry wiring belongs.
+	registerRoutes(r, fetcher, version, build, deprecations)
+
+	// Server. Binds to localhost to prevent unauthenticated external access;
+	// the lifecycle (signal handling, readiness flip, drain, forced-close
+	// escalation) is the shared bootstrap in internal/server.
 	log.Printf("URL Fetcher service starting on :%s", port)
-	// Use errors.Is for forward-compatible error comparison.
-	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		log.Fatalf("Server error: %v", err)
-	}
-
-	// ListenAndServe returned ErrServerClosed (clean shutdown path) — wait for
-	// the drain goroutine to finish before exiting so in-flight requests can
-	// complete or hit the 10s timeout.
-	<-idleConnsClosed
+	return server.Run(server.Config{
+		Name:    "url_fetcher",
+		Addr:    "127.0.0.1:" + port,
+		Handler: r,
+		Signals: signals,
+		// Must exceed the 125s request-timeout middleware (and the batch
+		// handler's 120s cap) or the connection is cut before the handler's
+		// own deadline machinery can respond.
+		WriteTimeout:    130 * time.Second,
+		DrainDelay:      healthkit.ShutdownDrainFromEnv(),
+		ShutdownTimeout: healthkit.ShutdownTimeoutFromEnv(),
+		// /health flips 503 first so upstreams stop routing here and the
+		// metrics pusher stops, then the drain delay and bounded Shutdown —
+		// same sequence as the health API.
+		OnShutdownBegin: func() { shuttingDown.Store(true); pushCancel() },
+	}, nil)
 }
@@ -0,0 +1,274 @@
+package urlfetcher
+
+// Fetch-level observability. The HTTP middleware metrics (healthkit) only see
+// requests to THIS service; the counters here describe the outbound side —
+// what the fetcher did on the internet and why it refused to. Everything
+// registers into the default registry, so the local /metrics endpoint
+// (registered in routes.go) always exposes them for scraping.
+//
+// Deployments without a Prometheus scraper set HEALTH_API_URL instead: a
+// background reporter then pushes the url_fetcher_* counter and gauge series
+// to the health API's /metrics/batch endpoint on an interval, with the
+// "absolute" mode so the health API's monotonic recovery handles our
+// restarts. Histograms stay local-only — the batch payload carries single
+// values, not bucket state — and a failed push never blocks fetching: the
+// reporter is its own goroutine and just retries with backoff.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/voraehita25-star/discord-bot/go_services/healthkit"
+)
+
+var (
+	fetchesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "url_fetcher_fetches_total",
+			Help: "Completed fetches by outcome: success or a classifyFetchError category.",
+		},
+		[]string{"outcome"},
+	)
+	fetchBytesTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "url_fetcher_bytes_downloaded_total",
+			Help: "Total response bytes downloaded from upstream hosts.",
+		},
+	)
+	ssrfBlockedTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "url_fetcher_ssrf_blocked_total",
+			Help: "Fetches refused by SSRF policy (private IP, dangerous host, blocked redirect or scheme).",
+		},
+	)
+	redirectLimitTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "url_fetcher_redirect_limit_hits_total",
+			Help: "Fetches aborted for exceeding the redirect hop cap.",
+		},
+	)
+	deniedHostTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "url_fetcher_denied_host_total",
+			Help: "Requests or redirects refused by the hard host denylist, by matched entry.",
+		},
+		[]string{"match"},
+	)
+	allowlistedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "url_fetcher_allowlisted_total",
+			Help: "Private-address fetches or redirect hops permitted by FETCH_ALLOW_HOSTS, by matched entry.",
+		},
+		[]string{"match"},
+	)
+	redirectPrivateBlockedTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "url_fetcher_redirect_private_blocked_total",
+			Help: "Redirect hops rejected because the target was, or resolved to, a private address.",
+		},
+	)
+	fetchDurationHist = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name: "url_fetcher_fetch_duration_seconds",
+			Help: "End-to-end fetch pipeline duration (FetchResult.FetchTimeMs).",
+			// 100ms .. ~102s: the batch handler caps at 120s, so the top
+			// bucket boundary sits just under the hard ceiling.
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 11),
+		},
+	)
+	extractDurationHist = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name: "url_fetcher_extract_duration_seconds",
+			Help: "Content extraction duration (the \"process\" phase of PhaseMs).",
+			// 1ms .. ~2s: extraction is CPU-bound and small.
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 12),
+		},
+	)
+)
+
+// observeFetchMetrics folds one completed (non-cache-hit) fetch into the
+// counters above. Called from fetchUncached alongside the other per-result
+// accounting, so wrapper-shell fetches and their follow-up hops each count
+// once — same attribution as the usage report.
+func observeFetchMetrics(result FetchResult) {
+	outcome := "success"
+	if result.Error != "" {
+		outcome = classifyFetchError(result.Error)
+	}
+	fetchesTotal.WithLabelValues(outcome).Inc()
+	if result.BytesDownloaded > 0 {
+		fetchBytesTotal.Add(float64(result.BytesDownloaded))
+	}
+	if outcome == "ssrf_blocked" {
+		ssrfBlockedTotal.Inc()
+	}
+	if strings.Contains(result.Error, "too many redirects") {
+		redirectLimitTotal.Inc()
+	}
+	fetchDurationHist.Observe(float64(result.FetchTimeMs) / 1000)
+	if processMs, ok := result.PhaseMs["process"]; ok {
+		extractDurationHist.Observe(float64(processMs) / 1000)
+	}
+}
+
+// defaultPushInterval is how often the reporter pushes when
+// METRICS_PUSH_INTERVAL_SECONDS doesn't override it.
+const defaultPushInterval = 30 * time.Second
+
+// metricsPusher ships the url_fetcher_* counter/gauge series to the health
+// API's /metrics/batch endpoint on an interval.
+type metricsPusher struct {
+	target   string // health API base URL, no trailing slash
+	token    string // HEALTH_API_TOKEN; batch is a write endpoint
+	interval time.Duration
+	client   *http.Client
+	gatherer prometheus.Gatherer
+}
+
+// metricsPusherFromEnv builds the reporter, or returns nil when
+// HEALTH_API_URL is unset — the local /metrics endpoint is then the only
+// export, which is the right default for scraper deployments. The interval
+// parse is fail-safe: a bad value warns and keeps the default rather than
+// killing startup or silently hammering the health API.
+func metricsPusherFromEnv(gatherer prometheus.Gatherer) *metricsPusher {
+	target := strings.TrimSpace(os.Getenv("HEALTH_API_URL"))
+	if target == "" {
+		return nil
+	}
+	interval := defaultPushInterval
+	if raw := strings.TrimSpace(os.Getenv("METRICS_PUSH_INTERVAL_SECONDS")); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			interval = time.Duration(n) * time.Second
+		} else {
+			log.Printf("⚠️ Invalid METRICS_PUSH_INTERVAL_SECONDS %q (want positive integer), using %v",
+				raw, defaultPushInterval)
+		}
+	}
+	return &metricsPusher{
+		target:   strings.TrimSuffix(target, "/"),
+		token:    strings.TrimSpace(os.Getenv("HEALTH_API_TOKEN")),
+		interval: interval,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		gatherer: gatherer,
+	}
+}
+
+// run pushes until ctx is cancelled. A failed push retries with doubling
+// backoff (1s up to the normal interval) instead of waiting a full interval
+// with stale data queued; a success resets the cadence.
+func (p *metricsPusher) run(ctx context.Context) {
+	initialBackoff := time.Second
+	if p.interval < initialBackoff {
+		initialBackoff = p.interval // never back off longer than the cadence
+	}
+	delay := p.interval
+	backoff := initialBackoff
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if err := p.pushOnce(ctx); err != nil {
+			log.Printf("⚠️ Metrics push to %s failed (retrying in %v): %v", p.target, backoff, err)
+			delay = backoff
+			if backoff *= 2; backoff > p.interval {
+				backoff = p.interval
+			}
+			continue
+		}
+		delay = p.interval
+		backoff = initialBackoff
+	}
+}
+
+// pushOnce gathers and POSTs one batch. Non-200 answers are errors — the
+// health API's batch endpoint reports per-item problems inside a 200, so a
+// non-200 means the push itself was refused (auth, size, availability).
+func (p *metricsPusher) pushOnce(ctx context.Context) error {
+	batch := p.buildBatch()
+	if len(batch) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("encode batch: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.target+"/metrics/batch", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// buildBatch flattens the url_fetcher_* families into batch payloads.
+// Counters go as "absolute" cumulative values so the health API's monotonic
+// recovery absorbs our restarts; gauges as plain sets. Histogram families are
+// skipped — the batch payload has no bucket transport — and remain visible on
+// the local /metrics endpoint.
+func (p *metricsPusher) buildBatch() []healthkit.MetricsPayload {
+	families, err := p.gatherer.Gather()
+	if err != nil {
+		log.Printf("⚠️ Metrics gather failed: %v", err)
+		return nil
+	}
+	stamp := time.Now().UTC().Format(time.RFC3339)
+	var batch []healthkit.MetricsPayload
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), "url_fetcher_") {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			payload := healthkit.MetricsPayload{
+				Name:            family.GetName(),
+				ClientTimestamp: stamp,
+			}
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				payload.Type = "counter"
+				payload.Value = m.GetCounter().GetValue()
+				payload.Mode = "absolute"
+			case dto.MetricType_GAUGE:
+				payload.Type = "gauge"
+				payload.Value = m.GetGauge().GetValue()
+				payload.Op = "set"
+			default:
+				continue
+			}
+			if labels := m.GetLabel(); len(labels) > 0 {
+				payload.Labels = make(map[string]string, len(labels))
+				for _, l := range labels {
+					payload.Labels[l.GetName()] = l.GetValue()
+				}
+			}
+			batch = append(batch, payload)
+		}
+	}
+	return batch
+}
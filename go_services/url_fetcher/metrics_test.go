@@ -0,0 +1,227 @@
+package urlfetcher
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/voraehita25-star/discord-bot/go_services/healthkit"
+)
+
+// counterValue reads one counter series from the default registry; the fetch
+// metrics are package-level, so tests assert deltas around the call under
+// test rather than absolute values.
+func counterValue(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metric:
+		for _, m := range family.GetMetric() {
+			got := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				got[l.GetName()] = l.GetValue()
+			}
+			for k, v := range labels {
+				if got[k] != v {
+					continue metric
+				}
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestObserveFetchMetrics(t *testing.T) {
+	successBefore := counterValue(t, "url_fetcher_fetches_total", map[string]string{"outcome": "success"})
+	bytesBefore := counterValue(t, "url_fetcher_bytes_downloaded_total", nil)
+	observeFetchMetrics(FetchResult{
+		URL:             "https://example.com",
+		FetchTimeMs:     120,
+		BytesDownloaded: 4096,
+		PhaseMs:         map[string]int64{"process": 7},
+	})
+	if got := counterValue(t, "url_fetcher_fetches_total", map[string]string{"outcome": "success"}); got != successBefore+1 {
+		t.Errorf("fetches_total{success} = %v, want %v", got, successBefore+1)
+	}
+	if got := counterValue(t, "url_fetcher_bytes_downloaded_total", nil); got != bytesBefore+4096 {
+		t.Errorf("bytes_downloaded_total = %v, want %v", got, bytesBefore+4096)
+	}
+
+	ssrfBefore := counterValue(t, "url_fetcher_ssrf_blocked_total", nil)
+	observeFetchMetrics(FetchResult{Error: "SSRF blocked: private IP"})
+	if got := counterValue(t, "url_fetcher_ssrf_blocked_total", nil); got != ssrfBefore+1 {
+		t.Errorf("ssrf_blocked_total = %v, want %v", got, ssrfBefore+1)
+	}
+	if got := counterValue(t, "url_fetcher_fetches_total", map[string]string{"outcome": "ssrf_blocked"}); got < 1 {
+		t.Error("SSRF block not counted under the ssrf_blocked outcome")
+	}
+
+	redirectBefore := counterValue(t, "url_fetcher_redirect_limit_hits_total", nil)
+	observeFetchMetrics(FetchResult{Error: "fetch error: Get \"https://example.com\": too many redirects"})
+	if got := counterValue(t, "url_fetcher_redirect_limit_hits_total", nil); got != redirectBefore+1 {
+		t.Errorf("redirect_limit_hits_total = %v, want %v", got, redirectBefore+1)
+	}
+}
+
+func TestMetricsPusherFromEnv(t *testing.T) {
+	tests := []struct {
+		name, url, interval string
+		want                *metricsPusher // nil means "reporter disabled"
+		wantInterval        time.Duration
+	}{
+		{"unset means local /metrics only", "", "10", nil, 0},
+		{"default interval", "http://127.0.0.1:8082", "", &metricsPusher{}, defaultPushInterval},
+		{"custom interval", "http://127.0.0.1:8082/", "5", &metricsPusher{}, 5 * time.Second},
+		{"bad interval falls back", "http://127.0.0.1:8082", "soon", &metricsPusher{}, defaultPushInterval},
+		{"negative interval falls back", "http://127.0.0.1:8082", "-3", &metricsPusher{}, defaultPushInterval},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("HEALTH_API_URL", tc.url)
+			t.Setenv("METRICS_PUSH_INTERVAL_SECONDS", tc.interval)
+			t.Setenv("HEALTH_API_TOKEN", "secret")
+			got := metricsPusherFromEnv(prometheus.DefaultGatherer)
+			if tc.want == nil {
+				if got != nil {
+					t.Fatalf("pusher = %+v, want nil without HEALTH_API_URL", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("pusher = nil, want one")
+			}
+			if got.target != "http://127.0.0.1:8082" {
+				t.Errorf("target = %q, want trailing slash trimmed", got.target)
+			}
+			if got.interval != tc.wantInterval {
+				t.Errorf("interval = %v, want %v", got.interval, tc.wantInterval)
+			}
+			if got.token != "secret" {
+				t.Errorf("token = %q, want HEALTH_API_TOKEN", got.token)
+			}
+		})
+	}
+}
+
+func TestMetricsPusherBatchPayload(t *testing.T) {
+	// A private registry stands in for the default one so the test controls
+	// exactly which families exist.
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "url_fetcher_fetches_total", Help: "t"}, []string{"outcome"})
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "url_fetcher_outbound_rate", Help: "t"})
+	hist := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "url_fetcher_fetch_duration_seconds", Help: "t"})
+	foreign := prometheus.NewCounter(prometheus.CounterOpts{Name: "go_other_total", Help: "t"})
+	reg.MustRegister(counter, gauge, hist, foreign)
+	counter.WithLabelValues("success").Add(3)
+	gauge.Set(2.5)
+	hist.Observe(0.2)
+	foreign.Inc()
+
+	var gotAuth atomic.Value
+	var gotBatch []healthkit.MetricsPayload
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics/batch" {
+			t.Errorf("pushed to %s, want /metrics/batch", r.URL.Path)
+		}
+		gotAuth.Store(r.Header.Get("Authorization"))
+		if err := json.NewDecoder(r.Body).Decode(&gotBatch); err != nil {
+			t.Errorf("decode batch: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"processed":2,"skipped":0}`))
+	}))
+	defer stub.Close()
+
+	p := &metricsPusher{
+		target:   stub.URL,
+		token:    "secret",
+		interval: time.Second,
+		client:   stub.Client(),
+		gatherer: reg,
+	}
+	if err := p.pushOnce(context.Background()); err != nil {
+		t.Fatalf("pushOnce: %v", err)
+	}
+	if got := gotAuth.Load(); got != "Bearer secret" {
+		t.Errorf("Authorization = %q, want the bearer token", got)
+	}
+	if len(gotBatch) != 2 {
+		t.Fatalf("batch has %d payloads, want 2 (counter + gauge; histogram and foreign families skipped): %+v",
+			len(gotBatch), gotBatch)
+	}
+	byName := make(map[string]healthkit.MetricsPayload)
+	for _, payload := range gotBatch {
+		byName[payload.Name] = payload
+	}
+	counterPayload := byName["url_fetcher_fetches_total"]
+	if counterPayload.Type != "counter" || counterPayload.Value != 3 || counterPayload.Mode != "absolute" {
+		t.Errorf("counter payload = %+v, want type counter value 3 mode absolute", counterPayload)
+	}
+	if counterPayload.Labels["outcome"] != "success" {
+		t.Errorf("counter labels = %v, want outcome=success", counterPayload.Labels)
+	}
+	if counterPayload.ClientTimestamp == "" {
+		t.Error("counter payload missing client_timestamp")
+	}
+	gaugePayload := byName["url_fetcher_outbound_rate"]
+	if gaugePayload.Type != "gauge" || gaugePayload.Value != 2.5 || gaugePayload.Op != "set" {
+		t.Errorf("gauge payload = %+v, want type gauge value 2.5 op set", gaugePayload)
+	}
+}
+
+// TestMetricsPusherRetriesWithBackoff: a push that fails doesn't kill the
+// loop — it retries and eventually succeeds, and cancelling the context
+// stops it.
+func TestMetricsPusherRetriesWithBackoff(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := prometheus.NewCounter(prometheus.CounterOpts{Name: "url_fetcher_fetches_total", Help: "t"})
+	reg.MustRegister(c)
+	c.Inc()
+
+	var requests atomic.Int32
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= 2 {
+			http.Error(w, "not yet", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"processed":1,"skipped":0}`))
+	}))
+	defer stub.Close()
+
+	p := &metricsPusher{
+		target:   stub.URL,
+		interval: 5 * time.Millisecond,
+		client:   stub.Client(),
+		gatherer: reg,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { p.run(ctx); close(done) }()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for requests.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("pusher made %d requests, want at least 3 (two failures + a success)", requests.Load())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not stop on context cancel")
+	}
+}
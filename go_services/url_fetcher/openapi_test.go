@@ -0,0 +1,146 @@
+package urlfetcher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/voraehita25-star/discord-bot/go_services/healthkit"
+)
+
+// apiRouter mounts the full route surface exactly as main() does (see
+// registerRoutes in routes.go), minus the middleware stack — the conformance
+// tests care about paths, methods and handler responses, not the stack.
+func apiRouter(t *testing.T) chi.Router {
+	t.Helper()
+	r := chi.NewRouter()
+	deprecations := healthkit.NewDeprecationSet(prometheus.NewRegistry(), "url_fetcher", nil, false)
+	registerRoutes(r, NewFetcher(), "test", healthkit.BuildInfo{}, deprecations)
+	return r
+}
+
+// TestOpenAPISpecCoversRouter is the drift gate: the embedded spec's path set
+// must equal the registered route set in both directions, so a route added to
+// registerRoutes without a matching openapi.json entry fails here.
+func TestOpenAPISpecCoversRouter(t *testing.T) {
+	t.Setenv("ENABLE_DOCS_UI", "true") // /docs is documented, so mount it
+	doc, err := healthkit.ParseOpenAPI(openAPISpecJSON)
+	if err != nil {
+		t.Fatalf("ParseOpenAPI: %v", err)
+	}
+	documented := make(map[string]bool)
+	for path, methods := range doc.Operations() {
+		for _, method := range methods {
+			documented[method+" "+path] = true
+		}
+	}
+
+	// Routes mounted with Handle() answer every method; chi reports nine
+	// entries, which collapse to the GET the spec documents.
+	methodsByRoute := make(map[string][]string)
+	err = chi.Walk(apiRouter(t), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		methodsByRoute[route] = append(methodsByRoute[route], method)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+	served := make(map[string]bool)
+	for route, methods := range methodsByRoute {
+		if len(methods) >= 8 {
+			methods = []string{http.MethodGet}
+		}
+		for _, method := range methods {
+			served[method+" "+route] = true
+		}
+	}
+
+	var missing, extra []string
+	for route := range documented {
+		if !served[route] {
+			missing = append(missing, route)
+		}
+	}
+	for route := range served {
+		if !documented[route] {
+			extra = append(extra, route)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	if len(missing) > 0 {
+		t.Errorf("documented but not served: %v", missing)
+	}
+	if len(extra) > 0 {
+		t.Errorf("served but not documented (add them to openapi.json): %v", extra)
+	}
+}
+
+// TestOpenAPIResponsesConform exercises documented routes and validates the
+// real responses — status, content type and body — against the spec.
+func TestOpenAPIResponsesConform(t *testing.T) {
+	doc, err := healthkit.ParseOpenAPI(openAPISpecJSON)
+	if err != nil {
+		t.Fatalf("ParseOpenAPI: %v", err)
+	}
+	r := apiRouter(t)
+
+	tests := []struct {
+		name, method, path, body string
+		specPath                 string
+		wantStatus               int
+	}{
+		{"health", http.MethodGet, "/health", "", "/health", http.StatusOK},
+		{"version", http.MethodGet, "/version", "", "/version", http.StatusOK},
+		{"capacity", http.MethodGet, "/fetch/capacity", "", "/fetch/capacity", http.StatusOK},
+		{"report", http.MethodGet, "/fetch/report", "", "/fetch/report", http.StatusOK},
+		{"capabilities", http.MethodGet, "/capabilities", "", "/capabilities", http.StatusOK},
+		{"spec itself", http.MethodGet, "/openapi.json", "", "/openapi.json", http.StatusOK},
+		{"fetch missing url", http.MethodGet, "/fetch", "", "/fetch", http.StatusBadRequest},
+		{"fetch bad scheme", http.MethodGet, "/fetch?url=ftp://example.com", "", "/fetch", http.StatusBadRequest},
+		{"batch empty", http.MethodPost, "/fetch/batch", `{"urls":[]}`, "/fetch/batch", http.StatusBadRequest},
+		{"batch bad json", http.MethodPost, "/fetch/batch", `{`, "/fetch/batch", http.StatusBadRequest},
+		{"debug without token", http.MethodGet, "/fetch/slow", "", "/fetch/slow", http.StatusServiceUnavailable},
+		{"prewarm without token", http.MethodPost, "/fetch/prewarm", `{"urls":["https://example.com"]}`, "/fetch/prewarm", http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			err := doc.ValidateResponse(tt.specPath, tt.method, rec.Code, rec.Header().Get("Content-Type"), rec.Body.Bytes())
+			if err != nil {
+				t.Errorf("response does not conform to spec: %v", err)
+			}
+		})
+	}
+}
+
+// TestDocsUIGate: /docs exists only when ENABLE_DOCS_UI=true.
+func TestDocsUIGate(t *testing.T) {
+	t.Setenv("ENABLE_DOCS_UI", "")
+	req := httptest.NewRequest(http.MethodGet, "/docs", nil)
+	rec := httptest.NewRecorder()
+	apiRouter(t).ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("/docs without the flag: status = %d, want 404", rec.Code)
+	}
+
+	t.Setenv("ENABLE_DOCS_UI", "true")
+	rec = httptest.NewRecorder()
+	apiRouter(t).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/docs with the flag: status = %d, want 200", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "/openapi.json") {
+		t.Error("docs page does not reference /openapi.json")
+	}
+}
@@ -0,0 +1,172 @@
+package urlfetcher
+
+// Route surface for url_fetcher, split from main() so the OpenAPI
+// conformance test (openapi_test.go) can mount the identical set on a bare
+// router and diff it against the embedded contract. The middleware stack
+// (metrics, load shedding, timeout, trace propagation) stays in main(),
+// where its prometheus registrations belong — the conformance walk cares
+// about paths and methods, not the stack around them.
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/voraehita25-star/discord-bot/go_services/healthkit"
+)
+
+//go:embed openapi.json
+var openAPISpecJSON []byte
+
+// registerRoutes mounts every route this service serves on r.
+func registerRoutes(r chi.Router, fetcher *Fetcher, version string, build healthkit.BuildInfo, deprecations *healthkit.DeprecationSet) {
+	r.Get("/version", healthkit.VersionHandler(version, build))
+
+	// Health check (flips 503 while shutting down — see healthHandler).
+	r.Get("/health", healthHandler(version))
+
+	// Current effective outbound capacity (AIMD state). The same number is
+	// exported as the url_fetcher_outbound_rate_limit_rps gauge on /metrics.
+	r.Get("/fetch/capacity", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(fetcher.controller.report()); err != nil {
+			log.Printf("Failed to encode capacity response: %v", err)
+		}
+	})
+
+	// Aggregated usage report for admins (JSON, or CSV via format=csv).
+	r.Get("/fetch/report", fetcher.handleReport)
+
+	// Debug group: token-gated (fail-closed — see requireDebugToken) because
+	// even redacted URLs reveal what the bot's users asked it to fetch.
+	r.Group(func(r chi.Router) {
+		r.Use(requireDebugToken(os.Getenv("FETCH_DEBUG_TOKEN")))
+		r.Get("/fetch/slow", fetcher.handleSlowFetches)
+		r.Get("/fetch/deadletter", fetcher.handleDeadLetters)
+	})
+
+	// Cache-warming group: token-gated like debug (fail-closed) — the caller
+	// is the bot's digest scheduler, not end users, and an open endpoint
+	// would let anyone drive background fetch traffic through this host.
+	r.Group(func(r chi.Router) {
+		r.Use(requirePrewarmToken(os.Getenv("FETCH_PREWARM_TOKEN")))
+		r.Post("/fetch/prewarm", fetcher.handlePrewarm)
+		r.Get("/fetch/prewarm/{id}", fetcher.handlePrewarmStatus)
+	})
+
+	// Prometheus exposition. Safe to serve unauthenticated here because the
+	// server binds to loopback only (see the Addr below).
+	r.Handle("/metrics", promhttp.Handler())
+
+	// Single URL fetch (v1 schema — announces deprecation when configured).
+	r.Get("/fetch", deprecations.Wrap("fetch_schema_v1", func(w http.ResponseWriter, r *http.Request) {
+		url := r.URL.Query().Get("url")
+		if url == "" {
+			http.Error(w, "url parameter required", http.StatusBadRequest)
+			return
+		}
+
+		// Reject excessively long URLs to prevent memory/parser abuse
+		if len(url) > 8192 {
+			http.Error(w, "url too long (max 8192 bytes)", http.StatusBadRequest)
+			return
+		}
+
+		// Basic URL validation - must be http/https
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			http.Error(w, "url must use http or https scheme", http.StatusBadRequest)
+			return
+		}
+
+		level, ok := normalizeExtractionLevel(r.URL.Query().Get("level"))
+		if !ok {
+			http.Error(w, "level must be fast, standard, or thorough", http.StatusBadRequest)
+			return
+		}
+
+		result := fetcher.FetchWithLevel(r.Context(), url, level)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			log.Printf("Failed to encode fetch response: %v", err)
+		}
+	}))
+
+	// Batch URL fetch (same v1 schema policy as /fetch).
+	r.Post("/fetch/batch", deprecations.Wrap("fetch_schema_v1", func(w http.ResponseWriter, r *http.Request) {
+		// Limit request body size to 1MB
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+		var req FetchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if len(req.URLs) == 0 {
+			http.Error(w, "urls required", http.StatusBadRequest)
+			return
+		}
+
+		if len(req.URLs) > 20 {
+			http.Error(w, "max 20 URLs per batch", http.StatusBadRequest)
+			return
+		}
+
+		// Per-item validation. Default: invalid items become individual
+		// validation_failed results (and dead-letter entries) while the rest
+		// of the batch proceeds; strict mode keeps the historical
+		// all-or-nothing 400 with its exact messages.
+		invalid := make(map[int]string)
+		for i, u := range req.URLs {
+			reason := validateBatchURL(u)
+			if reason == "" {
+				continue
+			}
+			if req.Strict {
+				http.Error(w, strictValidationMessage(reason), http.StatusBadRequest)
+				return
+			}
+			invalid[i] = reason
+		}
+
+		ctx := r.Context()
+		if req.Timeout > 0 {
+			// Cap user-provided timeout to 120 seconds max
+			timeout := min(req.Timeout, 120)
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+			defer cancel()
+		}
+
+		level, ok := normalizeExtractionLevel(req.Level)
+		if !ok {
+			http.Error(w, "level must be fast, standard, or thorough", http.StatusBadRequest)
+			return
+		}
+
+		response := fetcher.fetchMixedBatch(ctx, req.URLs, level, invalid)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			log.Printf("Failed to encode batch response: %v", err)
+		}
+	}))
+
+	// Deprecation status for everything this service serves.
+	r.Get("/capabilities", deprecations.CapabilitiesHandler("url_fetcher", ""))
+
+	// Machine-readable API contract (see healthkit/openapi.go for the shared
+	// machinery). Anonymous like /version — it describes the surface, it
+	// carries no data. Kept honest by openapi_test.go.
+	r.Get("/openapi.json", healthkit.OpenAPIHandler(openAPISpecJSON))
+	if healthkit.DocsUIEnabled() {
+		r.Get("/docs", healthkit.SwaggerUIHandler("url_fetcher", "/openapi.json"))
+	}
+}
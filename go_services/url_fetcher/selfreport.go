@@ -0,0 +1,220 @@
+package urlfetcher
+
+// Self-registration with the health API. Operators kept forgetting to wire
+// the fetcher into the health dashboard by hand, so when HEALTH_API_URL is
+// set the fetcher reports itself: a POST to /health/service as "url_fetcher"
+// on startup and every 30 seconds after, and a final healthy=false on
+// graceful shutdown so the dashboard reflects the drain instead of showing a
+// stale green for a process that is gone.
+//
+// The healthy verdict comes from two signals the fetcher tracks about itself
+// (healthTracker): the infra-error rate over the last minute — the same
+// error classification the AIMD controller uses, so upstream 404s and policy
+// refusals don't count against us — and sustained rate-limiter saturation,
+// meaning fetches have been queueing behind the limiter continuously for
+// longer than a grace period. A report that can't reach the health API is
+// logged and dropped; fetch handling never waits on it.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// selfReportInterval is the registration cadence; the health API treats a
+	// service's report as current, so 30s keeps the dashboard fresh without
+	// chatter.
+	selfReportInterval = 30 * time.Second
+	// errorRateWindow / errorRateThreshold / errorRateMinSamples: unhealthy
+	// when more than half the last minute's upstream-reaching fetches were
+	// infra failures, with a sample floor so one bad fetch after a quiet
+	// spell doesn't flip the service red.
+	errorRateWindow     = time.Minute
+	errorRateThreshold  = 0.5
+	errorRateMinSamples = 10
+	// limiterSaturationWait is the per-fetch limiter wait that counts as
+	// "saturated"; limiterSaturationGrace is how long saturation must persist
+	// continuously before it makes the service unhealthy.
+	limiterSaturationWait  = 500 * time.Millisecond
+	limiterSaturationGrace = 30 * time.Second
+)
+
+// healthSample is one upstream-reaching fetch outcome in the rolling window.
+type healthSample struct {
+	at    time.Time
+	infra bool
+}
+
+// healthTracker is the fetcher's self-diagnosis: a pruned one-minute window
+// of infra-error outcomes plus the start time of any ongoing limiter
+// saturation streak.
+type healthTracker struct {
+	mu             sync.Mutex
+	clock          Clock
+	samples        []healthSample
+	saturatedSince time.Time
+}
+
+func newHealthTracker(clock Clock) *healthTracker {
+	return &healthTracker{clock: clock}
+}
+
+// noteOutcome records one fetch that reached (or tried to reach) upstream.
+// Called from recordOutcome with its infra classification, so the exclusions
+// (SSRF blocks, invalid URLs, cancellations) match the controller's.
+func (t *healthTracker) noteOutcome(infra bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.clock.Now()
+	t.samples = append(t.samples, healthSample{at: now, infra: infra})
+	t.pruneLocked(now)
+}
+
+// noteLimiterWait records how long one fetch waited on the rate limiter. A
+// wait past the saturation threshold starts (or continues) a saturation
+// streak; a quick pass ends it.
+func (t *healthTracker) noteLimiterWait(waited time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if waited >= limiterSaturationWait {
+		if t.saturatedSince.IsZero() {
+			t.saturatedSince = t.clock.Now()
+		}
+		return
+	}
+	t.saturatedSince = time.Time{}
+}
+
+func (t *healthTracker) pruneLocked(now time.Time) {
+	cutoff := now.Add(-errorRateWindow)
+	keep := t.samples[:0]
+	for _, s := range t.samples {
+		if s.at.After(cutoff) {
+			keep = append(keep, s)
+		}
+	}
+	t.samples = keep
+}
+
+// snapshot returns the current verdict and a human-readable reason for the
+// dashboard when unhealthy.
+func (t *healthTracker) snapshot() (healthy bool, message string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.clock.Now()
+	t.pruneLocked(now)
+
+	if !t.saturatedSince.IsZero() {
+		if saturated := now.Sub(t.saturatedSince); saturated > limiterSaturationGrace {
+			return false, fmt.Sprintf("rate limiter saturated for %s", saturated.Round(time.Second))
+		}
+	}
+	if len(t.samples) >= errorRateMinSamples {
+		infra := 0
+		for _, s := range t.samples {
+			if s.infra {
+				infra++
+			}
+		}
+		if rate := float64(infra) / float64(len(t.samples)); rate > errorRateThreshold {
+			return false, fmt.Sprintf("infra error rate %.0f%% over the last minute (%d/%d fetches)",
+				rate*100, infra, len(t.samples))
+		}
+	}
+	return true, ""
+}
+
+// selfReporter POSTs the fetcher's status to the health API's /health/service.
+type selfReporter struct {
+	target   string // health API base URL, no trailing slash
+	token    string
+	interval time.Duration
+	client   *http.Client
+	fetcher  *Fetcher
+}
+
+// selfReporterFromEnv builds the reporter, or returns nil when
+// HEALTH_API_URL is unset — same gate as the metrics pusher: no health API,
+// nothing to register with.
+func selfReporterFromEnv(f *Fetcher) *selfReporter {
+	target := strings.TrimSpace(os.Getenv("HEALTH_API_URL"))
+	if target == "" {
+		return nil
+	}
+	return &selfReporter{
+		target:   strings.TrimSuffix(target, "/"),
+		token:    strings.TrimSpace(os.Getenv("HEALTH_API_TOKEN")),
+		interval: selfReportInterval,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		fetcher:  f,
+	}
+}
+
+// run reports immediately, then on the interval, until ctx is cancelled — at
+// which point it sends the final healthy=false (on a fresh short-deadline
+// context; the cancelled one would abort the request) and returns. Failures
+// are logged, never propagated: registration is best-effort by design.
+func (r *selfReporter) run(ctx context.Context) {
+	r.reportCurrent(ctx)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			finalCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			if err := r.report(finalCtx, false, "shutting down"); err != nil {
+				log.Printf("⚠️ Final health report to %s failed: %v", r.target, err)
+			}
+			return
+		case <-ticker.C:
+			r.reportCurrent(ctx)
+		}
+	}
+}
+
+func (r *selfReporter) reportCurrent(ctx context.Context) {
+	healthy, message := r.fetcher.health.snapshot()
+	if err := r.report(ctx, healthy, message); err != nil {
+		log.Printf("⚠️ Health report to %s failed: %v", r.target, err)
+	}
+}
+
+func (r *selfReporter) report(ctx context.Context, healthy bool, message string) error {
+	payload := struct {
+		Name    string `json:"name"`
+		Healthy bool   `json:"healthy"`
+		Message string `json:"message,omitempty"`
+	}{Name: "url_fetcher", Healthy: healthy, Message: message}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.target+"/health/service", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package urlfetcher
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHealthTrackerErrorRate(t *testing.T) {
+	fc := newFakeClock(time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC))
+	tr := newHealthTracker(fc)
+
+	// Below the sample floor: even 100% failures stay healthy.
+	for i := 0; i < errorRateMinSamples-1; i++ {
+		tr.noteOutcome(true)
+	}
+	if healthy, msg := tr.snapshot(); !healthy {
+		t.Errorf("unhealthy below the sample floor: %s", msg)
+	}
+
+	// One more failure crosses the floor at 100% infra errors.
+	tr.noteOutcome(true)
+	healthy, msg := tr.snapshot()
+	if healthy {
+		t.Error("healthy at 100% infra error rate over a full window")
+	}
+	if msg == "" {
+		t.Error("unhealthy verdict carries no message")
+	}
+
+	// The window forgets: advance past it and report successes.
+	fc.Advance(errorRateWindow + time.Second)
+	for i := 0; i < errorRateMinSamples; i++ {
+		tr.noteOutcome(false)
+	}
+	if healthy, msg := tr.snapshot(); !healthy {
+		t.Errorf("unhealthy after the bad minute aged out: %s", msg)
+	}
+
+	// Mixed traffic under the threshold stays healthy.
+	fc.Advance(errorRateWindow + time.Second)
+	for i := 0; i < 10; i++ {
+		tr.noteOutcome(i < 4) // 40% < the 50% threshold
+	}
+	if healthy, msg := tr.snapshot(); !healthy {
+		t.Errorf("unhealthy at 40%% error rate: %s", msg)
+	}
+}
+
+func TestHealthTrackerLimiterSaturation(t *testing.T) {
+	fc := newFakeClock(time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC))
+	tr := newHealthTracker(fc)
+
+	// A long wait starts the streak, but within the grace period the service
+	// is still healthy.
+	tr.noteLimiterWait(limiterSaturationWait)
+	if healthy, msg := tr.snapshot(); !healthy {
+		t.Errorf("unhealthy inside the saturation grace period: %s", msg)
+	}
+
+	// Still saturated past the grace period → unhealthy.
+	fc.Advance(limiterSaturationGrace + time.Second)
+	tr.noteLimiterWait(limiterSaturationWait)
+	if healthy, _ := tr.snapshot(); healthy {
+		t.Error("healthy after sustained limiter saturation")
+	}
+
+	// A quick pass through the limiter ends the streak.
+	tr.noteLimiterWait(time.Millisecond)
+	if healthy, msg := tr.snapshot(); !healthy {
+		t.Errorf("unhealthy after saturation cleared: %s", msg)
+	}
+}
+
+// serviceReport is the wire shape the sink below records.
+type serviceReport struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+}
+
+// reportSink is an httptest /health/service endpoint recording every report.
+type reportSink struct {
+	mu      sync.Mutex
+	reports []serviceReport
+	auth    string
+}
+
+func (s *reportSink) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health/service" {
+			t.Errorf("report went to %s, want /health/service", r.URL.Path)
+		}
+		var report serviceReport
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			t.Errorf("decode report: %v", err)
+		}
+		s.mu.Lock()
+		s.reports = append(s.reports, report)
+		s.auth = r.Header.Get("Authorization")
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (s *reportSink) snapshot() []serviceReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]serviceReport(nil), s.reports...)
+}
+
+func TestSelfReporterCadenceAndShutdown(t *testing.T) {
+	sink := &reportSink{}
+	stub := httptest.NewServer(sink.handler(t))
+	defer stub.Close()
+
+	f := NewFetcher()
+	r := &selfReporter{
+		target:   stub.URL,
+		token:    "secret",
+		interval: 10 * time.Millisecond,
+		client:   stub.Client(),
+		fetcher:  f,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { r.run(ctx); close(done) }()
+
+	// Startup report plus at least one interval report.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sink.snapshot()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d reports, want the startup report plus the cadence", len(sink.snapshot()))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not stop on context cancel")
+	}
+
+	reports := sink.snapshot()
+	first, last := reports[0], reports[len(reports)-1]
+	if first.Name != "url_fetcher" || !first.Healthy {
+		t.Errorf("startup report = %+v, want url_fetcher healthy", first)
+	}
+	if last.Healthy || last.Message != "shutting down" {
+		t.Errorf("final report = %+v, want healthy=false %q", last, "shutting down")
+	}
+	sink.mu.Lock()
+	auth := sink.auth
+	sink.mu.Unlock()
+	if auth != "Bearer secret" {
+		t.Errorf("Authorization = %q, want the bearer token", auth)
+	}
+}
+
+func TestSelfReporterReportsUnhealthy(t *testing.T) {
+	sink := &reportSink{}
+	stub := httptest.NewServer(sink.handler(t))
+	defer stub.Close()
+
+	fc := newFakeClock(time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC))
+	f := NewFetcher(WithClock(fc))
+	for i := 0; i < errorRateMinSamples; i++ {
+		f.health.noteOutcome(true)
+	}
+
+	r := &selfReporter{
+		target:   stub.URL,
+		interval: time.Hour, // only the immediate report fires
+		client:   stub.Client(),
+		fetcher:  f,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.reportCurrent(ctx)
+
+	reports := sink.snapshot()
+	if len(reports) != 1 {
+		t.Fatalf("got %d reports, want 1", len(reports))
+	}
+	if reports[0].Healthy {
+		t.Error("report healthy despite a saturated error window")
+	}
+	if reports[0].Message == "" {
+		t.Error("unhealthy report carries no reason")
+	}
+}
+
+// TestSelfReporterFailureDoesNotPanic: an unreachable health API only logs.
+func TestSelfReporterFailureDoesNotPanic(t *testing.T) {
+	stub := httptest.NewServer(http.NotFoundHandler())
+	stub.Close() // dead listener
+
+	r := &selfReporter{
+		target:   stub.URL,
+		interval: time.Hour,
+		client:   &http.Client{Timeout: time.Second},
+		fetcher:  NewFetcher(),
+	}
+	r.reportCurrent(context.Background()) // must not panic or block
+}
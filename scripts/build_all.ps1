@@ -57,7 +57,7 @@ Write-Host "  [OK] All native extensions built successfully!           " -Foregr
 Write-Host "===========================================================" -ForegroundColor Magenta
 Write-Host ""
 Write-Host "Next steps:" -ForegroundColor Cyan
-Write-Host "  1. Start Go services:    Start-Process .\bin\url_fetcher.exe; Start-Process .\bin\health_api.exe"
+Write-Host "  1. Start Go services:    Start-Process .\bin\discord-bot-services.exe -ArgumentList all"
 Write-Host "  2. Run the bot:          python bot.py"
 Write-Host ""
 Write-Host "The Python code will automatically detect and use native extensions."
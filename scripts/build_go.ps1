@@ -63,38 +63,28 @@ try {
         Write-Host "[BUILD] Building in DEBUG mode" -ForegroundColor Yellow
     }
 
-    # Build URL Fetcher
-    Write-Host "Building url_fetcher..." -ForegroundColor Cyan
-    $UrlFetcherExe = Join-Path $BinDir "url_fetcher.exe"
-    & go build @BuildFlags -o $UrlFetcherExe "./url_fetcher"
+    # Build the single services binary (subcommands: health-api, url-fetcher, all)
+    Write-Host "Building discord-bot-services..." -ForegroundColor Cyan
+    $ServicesExe = Join-Path $BinDir "discord-bot-services.exe"
+    & go build @BuildFlags -o $ServicesExe "./cmd/discord-bot-services"
     if ($LASTEXITCODE -ne 0) {
-        Write-Host "[ERROR] url_fetcher build failed" -ForegroundColor Red
+        Write-Host "[ERROR] discord-bot-services build failed" -ForegroundColor Red
         exit 1
     }
-    Write-Host "[OK] Built $UrlFetcherExe" -ForegroundColor Green
-
-    # Build Health API
-    Write-Host "Building health_api..." -ForegroundColor Cyan
-    $HealthApiExe = Join-Path $BinDir "health_api.exe"
-    & go build @BuildFlags -o $HealthApiExe "./health_api"
-    if ($LASTEXITCODE -ne 0) {
-        Write-Host "[ERROR] health_api build failed" -ForegroundColor Red
-        exit 1
-    }
-    Write-Host "[OK] Built $HealthApiExe" -ForegroundColor Green
+    Write-Host "[OK] Built $ServicesExe" -ForegroundColor Green
 
     Write-Host ""
     Write-Host "[OK] Go build complete!" -ForegroundColor Green
     Write-Host ""
     Write-Host "To run services:" -ForegroundColor Cyan
-    Write-Host "  URL Fetcher:  .\bin\url_fetcher.exe  (port 8081)"
-    Write-Host "  Health API:   .\bin\health_api.exe   (port 8082)"
+    Write-Host "  Both:         .\bin\discord-bot-services.exe all"
+    Write-Host "  URL Fetcher:  .\bin\discord-bot-services.exe url-fetcher  (port 8081)"
+    Write-Host "  Health API:   .\bin\discord-bot-services.exe health-api   (port 8082)"
 
     if ($Run) {
         Write-Host ""
         Write-Host "[RUN] Starting services..." -ForegroundColor Cyan
-        Start-Process -FilePath $UrlFetcherExe -NoNewWindow
-        Start-Process -FilePath $HealthApiExe -NoNewWindow
+        Start-Process -FilePath $ServicesExe -ArgumentList "all" -NoNewWindow
         Write-Host "Services started in background"
     }
 